@@ -0,0 +1,1028 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.10
+// 	protoc        v5.29.3
+// source: api/gateway/v1/gateway.proto
+
+package gatewayv1
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type MessageType int32
+
+const (
+	MessageType_MESSAGE_TYPE_UNSPECIFIED MessageType = 0
+	MessageType_MESSAGE_TYPE_NORMAL      MessageType = 1
+	MessageType_MESSAGE_TYPE_EXPRESS     MessageType = 2
+)
+
+// Enum value maps for MessageType.
+var (
+	MessageType_name = map[int32]string{
+		0: "MESSAGE_TYPE_UNSPECIFIED",
+		1: "MESSAGE_TYPE_NORMAL",
+		2: "MESSAGE_TYPE_EXPRESS",
+	}
+	MessageType_value = map[string]int32{
+		"MESSAGE_TYPE_UNSPECIFIED": 0,
+		"MESSAGE_TYPE_NORMAL":      1,
+		"MESSAGE_TYPE_EXPRESS":     2,
+	}
+)
+
+func (x MessageType) Enum() *MessageType {
+	p := new(MessageType)
+	*p = x
+	return p
+}
+
+func (x MessageType) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (MessageType) Descriptor() protoreflect.EnumDescriptor {
+	return file_api_gateway_v1_gateway_proto_enumTypes[0].Descriptor()
+}
+
+func (MessageType) Type() protoreflect.EnumType {
+	return &file_api_gateway_v1_gateway_proto_enumTypes[0]
+}
+
+func (x MessageType) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use MessageType.Descriptor instead.
+func (MessageType) EnumDescriptor() ([]byte, []int) {
+	return file_api_gateway_v1_gateway_proto_rawDescGZIP(), []int{0}
+}
+
+type MessageStatus int32
+
+const (
+	MessageStatus_MESSAGE_STATUS_UNSPECIFIED MessageStatus = 0
+	MessageStatus_MESSAGE_STATUS_PENDING     MessageStatus = 1
+	MessageStatus_MESSAGE_STATUS_HELD        MessageStatus = 2
+	MessageStatus_MESSAGE_STATUS_SENDING     MessageStatus = 3
+	MessageStatus_MESSAGE_STATUS_DONE        MessageStatus = 4
+	MessageStatus_MESSAGE_STATUS_FAILED      MessageStatus = 5
+	MessageStatus_MESSAGE_STATUS_REJECTED    MessageStatus = 6
+)
+
+// Enum value maps for MessageStatus.
+var (
+	MessageStatus_name = map[int32]string{
+		0: "MESSAGE_STATUS_UNSPECIFIED",
+		1: "MESSAGE_STATUS_PENDING",
+		2: "MESSAGE_STATUS_HELD",
+		3: "MESSAGE_STATUS_SENDING",
+		4: "MESSAGE_STATUS_DONE",
+		5: "MESSAGE_STATUS_FAILED",
+		6: "MESSAGE_STATUS_REJECTED",
+	}
+	MessageStatus_value = map[string]int32{
+		"MESSAGE_STATUS_UNSPECIFIED": 0,
+		"MESSAGE_STATUS_PENDING":     1,
+		"MESSAGE_STATUS_HELD":        2,
+		"MESSAGE_STATUS_SENDING":     3,
+		"MESSAGE_STATUS_DONE":        4,
+		"MESSAGE_STATUS_FAILED":      5,
+		"MESSAGE_STATUS_REJECTED":    6,
+	}
+)
+
+func (x MessageStatus) Enum() *MessageStatus {
+	p := new(MessageStatus)
+	*p = x
+	return p
+}
+
+func (x MessageStatus) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (MessageStatus) Descriptor() protoreflect.EnumDescriptor {
+	return file_api_gateway_v1_gateway_proto_enumTypes[1].Descriptor()
+}
+
+func (MessageStatus) Type() protoreflect.EnumType {
+	return &file_api_gateway_v1_gateway_proto_enumTypes[1]
+}
+
+func (x MessageStatus) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use MessageStatus.Descriptor instead.
+func (MessageStatus) EnumDescriptor() ([]byte, []int) {
+	return file_api_gateway_v1_gateway_proto_rawDescGZIP(), []int{1}
+}
+
+type SendSMSRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Text          string                 `protobuf:"bytes,1,opt,name=text,proto3" json:"text,omitempty"`
+	Recipients    []string               `protobuf:"bytes,2,rep,name=recipients,proto3" json:"recipients,omitempty"`
+	Type          MessageType            `protobuf:"varint,3,opt,name=type,proto3,enum=smsgateway.v1.MessageType" json:"type,omitempty"`
+	Priority      *int32                 `protobuf:"varint,4,opt,name=priority,proto3,oneof" json:"priority,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SendSMSRequest) Reset() {
+	*x = SendSMSRequest{}
+	mi := &file_api_gateway_v1_gateway_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SendSMSRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SendSMSRequest) ProtoMessage() {}
+
+func (x *SendSMSRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_api_gateway_v1_gateway_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SendSMSRequest.ProtoReflect.Descriptor instead.
+func (*SendSMSRequest) Descriptor() ([]byte, []int) {
+	return file_api_gateway_v1_gateway_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *SendSMSRequest) GetText() string {
+	if x != nil {
+		return x.Text
+	}
+	return ""
+}
+
+func (x *SendSMSRequest) GetRecipients() []string {
+	if x != nil {
+		return x.Recipients
+	}
+	return nil
+}
+
+func (x *SendSMSRequest) GetType() MessageType {
+	if x != nil {
+		return x.Type
+	}
+	return MessageType_MESSAGE_TYPE_UNSPECIFIED
+}
+
+func (x *SendSMSRequest) GetPriority() int32 {
+	if x != nil && x.Priority != nil {
+		return *x.Priority
+	}
+	return 0
+}
+
+type SendSMSResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	SmsIdentifier string                 `protobuf:"bytes,1,opt,name=sms_identifier,json=smsIdentifier,proto3" json:"sms_identifier,omitempty"`
+	Status        MessageStatus          `protobuf:"varint,2,opt,name=status,proto3,enum=smsgateway.v1.MessageStatus" json:"status,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SendSMSResponse) Reset() {
+	*x = SendSMSResponse{}
+	mi := &file_api_gateway_v1_gateway_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SendSMSResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SendSMSResponse) ProtoMessage() {}
+
+func (x *SendSMSResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_api_gateway_v1_gateway_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SendSMSResponse.ProtoReflect.Descriptor instead.
+func (*SendSMSResponse) Descriptor() ([]byte, []int) {
+	return file_api_gateway_v1_gateway_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *SendSMSResponse) GetSmsIdentifier() string {
+	if x != nil {
+		return x.SmsIdentifier
+	}
+	return ""
+}
+
+func (x *SendSMSResponse) GetStatus() MessageStatus {
+	if x != nil {
+		return x.Status
+	}
+	return MessageStatus_MESSAGE_STATUS_UNSPECIFIED
+}
+
+type GetMessageRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	SmsIdentifier string                 `protobuf:"bytes,1,opt,name=sms_identifier,json=smsIdentifier,proto3" json:"sms_identifier,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetMessageRequest) Reset() {
+	*x = GetMessageRequest{}
+	mi := &file_api_gateway_v1_gateway_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetMessageRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetMessageRequest) ProtoMessage() {}
+
+func (x *GetMessageRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_api_gateway_v1_gateway_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetMessageRequest.ProtoReflect.Descriptor instead.
+func (*GetMessageRequest) Descriptor() ([]byte, []int) {
+	return file_api_gateway_v1_gateway_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *GetMessageRequest) GetSmsIdentifier() string {
+	if x != nil {
+		return x.SmsIdentifier
+	}
+	return ""
+}
+
+type RecipientStatus struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Recipient     string                 `protobuf:"bytes,1,opt,name=recipient,proto3" json:"recipient,omitempty"`
+	Status        MessageStatus          `protobuf:"varint,2,opt,name=status,proto3,enum=smsgateway.v1.MessageStatus" json:"status,omitempty"`
+	Provider      string                 `protobuf:"bytes,3,opt,name=provider,proto3" json:"provider,omitempty"`
+	UpdatedAt     *timestamppb.Timestamp `protobuf:"bytes,4,opt,name=updated_at,json=updatedAt,proto3" json:"updated_at,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RecipientStatus) Reset() {
+	*x = RecipientStatus{}
+	mi := &file_api_gateway_v1_gateway_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RecipientStatus) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RecipientStatus) ProtoMessage() {}
+
+func (x *RecipientStatus) ProtoReflect() protoreflect.Message {
+	mi := &file_api_gateway_v1_gateway_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RecipientStatus.ProtoReflect.Descriptor instead.
+func (*RecipientStatus) Descriptor() ([]byte, []int) {
+	return file_api_gateway_v1_gateway_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *RecipientStatus) GetRecipient() string {
+	if x != nil {
+		return x.Recipient
+	}
+	return ""
+}
+
+func (x *RecipientStatus) GetStatus() MessageStatus {
+	if x != nil {
+		return x.Status
+	}
+	return MessageStatus_MESSAGE_STATUS_UNSPECIFIED
+}
+
+func (x *RecipientStatus) GetProvider() string {
+	if x != nil {
+		return x.Provider
+	}
+	return ""
+}
+
+func (x *RecipientStatus) GetUpdatedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.UpdatedAt
+	}
+	return nil
+}
+
+type Message struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	SmsIdentifier string                 `protobuf:"bytes,1,opt,name=sms_identifier,json=smsIdentifier,proto3" json:"sms_identifier,omitempty"`
+	Type          MessageType            `protobuf:"varint,2,opt,name=type,proto3,enum=smsgateway.v1.MessageType" json:"type,omitempty"`
+	Recipients    []*RecipientStatus     `protobuf:"bytes,3,rep,name=recipients,proto3" json:"recipients,omitempty"`
+	CreatedAt     *timestamppb.Timestamp `protobuf:"bytes,4,opt,name=created_at,json=createdAt,proto3" json:"created_at,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Message) Reset() {
+	*x = Message{}
+	mi := &file_api_gateway_v1_gateway_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Message) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Message) ProtoMessage() {}
+
+func (x *Message) ProtoReflect() protoreflect.Message {
+	mi := &file_api_gateway_v1_gateway_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Message.ProtoReflect.Descriptor instead.
+func (*Message) Descriptor() ([]byte, []int) {
+	return file_api_gateway_v1_gateway_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *Message) GetSmsIdentifier() string {
+	if x != nil {
+		return x.SmsIdentifier
+	}
+	return ""
+}
+
+func (x *Message) GetType() MessageType {
+	if x != nil {
+		return x.Type
+	}
+	return MessageType_MESSAGE_TYPE_UNSPECIFIED
+}
+
+func (x *Message) GetRecipients() []*RecipientStatus {
+	if x != nil {
+		return x.Recipients
+	}
+	return nil
+}
+
+func (x *Message) GetCreatedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.CreatedAt
+	}
+	return nil
+}
+
+type ListHistoryRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Status        MessageStatus          `protobuf:"varint,1,opt,name=status,proto3,enum=smsgateway.v1.MessageStatus" json:"status,omitempty"`
+	SmsIdentifier string                 `protobuf:"bytes,2,opt,name=sms_identifier,json=smsIdentifier,proto3" json:"sms_identifier,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListHistoryRequest) Reset() {
+	*x = ListHistoryRequest{}
+	mi := &file_api_gateway_v1_gateway_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListHistoryRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListHistoryRequest) ProtoMessage() {}
+
+func (x *ListHistoryRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_api_gateway_v1_gateway_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListHistoryRequest.ProtoReflect.Descriptor instead.
+func (*ListHistoryRequest) Descriptor() ([]byte, []int) {
+	return file_api_gateway_v1_gateway_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *ListHistoryRequest) GetStatus() MessageStatus {
+	if x != nil {
+		return x.Status
+	}
+	return MessageStatus_MESSAGE_STATUS_UNSPECIFIED
+}
+
+func (x *ListHistoryRequest) GetSmsIdentifier() string {
+	if x != nil {
+		return x.SmsIdentifier
+	}
+	return ""
+}
+
+type HistoryEntry struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	SmsIdentifier string                 `protobuf:"bytes,1,opt,name=sms_identifier,json=smsIdentifier,proto3" json:"sms_identifier,omitempty"`
+	Type          MessageType            `protobuf:"varint,2,opt,name=type,proto3,enum=smsgateway.v1.MessageType" json:"type,omitempty"`
+	Recipient     string                 `protobuf:"bytes,3,opt,name=recipient,proto3" json:"recipient,omitempty"`
+	Status        MessageStatus          `protobuf:"varint,4,opt,name=status,proto3,enum=smsgateway.v1.MessageStatus" json:"status,omitempty"`
+	Provider      string                 `protobuf:"bytes,5,opt,name=provider,proto3" json:"provider,omitempty"`
+	CreatedAt     *timestamppb.Timestamp `protobuf:"bytes,6,opt,name=created_at,json=createdAt,proto3" json:"created_at,omitempty"`
+	UpdatedAt     *timestamppb.Timestamp `protobuf:"bytes,7,opt,name=updated_at,json=updatedAt,proto3" json:"updated_at,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *HistoryEntry) Reset() {
+	*x = HistoryEntry{}
+	mi := &file_api_gateway_v1_gateway_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *HistoryEntry) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*HistoryEntry) ProtoMessage() {}
+
+func (x *HistoryEntry) ProtoReflect() protoreflect.Message {
+	mi := &file_api_gateway_v1_gateway_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use HistoryEntry.ProtoReflect.Descriptor instead.
+func (*HistoryEntry) Descriptor() ([]byte, []int) {
+	return file_api_gateway_v1_gateway_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *HistoryEntry) GetSmsIdentifier() string {
+	if x != nil {
+		return x.SmsIdentifier
+	}
+	return ""
+}
+
+func (x *HistoryEntry) GetType() MessageType {
+	if x != nil {
+		return x.Type
+	}
+	return MessageType_MESSAGE_TYPE_UNSPECIFIED
+}
+
+func (x *HistoryEntry) GetRecipient() string {
+	if x != nil {
+		return x.Recipient
+	}
+	return ""
+}
+
+func (x *HistoryEntry) GetStatus() MessageStatus {
+	if x != nil {
+		return x.Status
+	}
+	return MessageStatus_MESSAGE_STATUS_UNSPECIFIED
+}
+
+func (x *HistoryEntry) GetProvider() string {
+	if x != nil {
+		return x.Provider
+	}
+	return ""
+}
+
+func (x *HistoryEntry) GetCreatedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.CreatedAt
+	}
+	return nil
+}
+
+func (x *HistoryEntry) GetUpdatedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.UpdatedAt
+	}
+	return nil
+}
+
+type ListHistoryResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Entries       []*HistoryEntry        `protobuf:"bytes,1,rep,name=entries,proto3" json:"entries,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListHistoryResponse) Reset() {
+	*x = ListHistoryResponse{}
+	mi := &file_api_gateway_v1_gateway_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListHistoryResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListHistoryResponse) ProtoMessage() {}
+
+func (x *ListHistoryResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_api_gateway_v1_gateway_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListHistoryResponse.ProtoReflect.Descriptor instead.
+func (*ListHistoryResponse) Descriptor() ([]byte, []int) {
+	return file_api_gateway_v1_gateway_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *ListHistoryResponse) GetEntries() []*HistoryEntry {
+	if x != nil {
+		return x.Entries
+	}
+	return nil
+}
+
+type GetBalanceRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetBalanceRequest) Reset() {
+	*x = GetBalanceRequest{}
+	mi := &file_api_gateway_v1_gateway_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetBalanceRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetBalanceRequest) ProtoMessage() {}
+
+func (x *GetBalanceRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_api_gateway_v1_gateway_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetBalanceRequest.ProtoReflect.Descriptor instead.
+func (*GetBalanceRequest) Descriptor() ([]byte, []int) {
+	return file_api_gateway_v1_gateway_proto_rawDescGZIP(), []int{8}
+}
+
+type Balance struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Balance       int64                  `protobuf:"varint,1,opt,name=balance,proto3" json:"balance,omitempty"`
+	Held          int64                  `protobuf:"varint,2,opt,name=held,proto3" json:"held,omitempty"`
+	Available     int64                  `protobuf:"varint,3,opt,name=available,proto3" json:"available,omitempty"`
+	AccountMode   string                 `protobuf:"bytes,4,opt,name=account_mode,json=accountMode,proto3" json:"account_mode,omitempty"`
+	CreditLimit   int64                  `protobuf:"varint,5,opt,name=credit_limit,json=creditLimit,proto3" json:"credit_limit,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Balance) Reset() {
+	*x = Balance{}
+	mi := &file_api_gateway_v1_gateway_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Balance) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Balance) ProtoMessage() {}
+
+func (x *Balance) ProtoReflect() protoreflect.Message {
+	mi := &file_api_gateway_v1_gateway_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Balance.ProtoReflect.Descriptor instead.
+func (*Balance) Descriptor() ([]byte, []int) {
+	return file_api_gateway_v1_gateway_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *Balance) GetBalance() int64 {
+	if x != nil {
+		return x.Balance
+	}
+	return 0
+}
+
+func (x *Balance) GetHeld() int64 {
+	if x != nil {
+		return x.Held
+	}
+	return 0
+}
+
+func (x *Balance) GetAvailable() int64 {
+	if x != nil {
+		return x.Available
+	}
+	return 0
+}
+
+func (x *Balance) GetAccountMode() string {
+	if x != nil {
+		return x.AccountMode
+	}
+	return ""
+}
+
+func (x *Balance) GetCreditLimit() int64 {
+	if x != nil {
+		return x.CreditLimit
+	}
+	return 0
+}
+
+type WatchStatusRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	SmsIdentifier string                 `protobuf:"bytes,1,opt,name=sms_identifier,json=smsIdentifier,proto3" json:"sms_identifier,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *WatchStatusRequest) Reset() {
+	*x = WatchStatusRequest{}
+	mi := &file_api_gateway_v1_gateway_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *WatchStatusRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WatchStatusRequest) ProtoMessage() {}
+
+func (x *WatchStatusRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_api_gateway_v1_gateway_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WatchStatusRequest.ProtoReflect.Descriptor instead.
+func (*WatchStatusRequest) Descriptor() ([]byte, []int) {
+	return file_api_gateway_v1_gateway_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *WatchStatusRequest) GetSmsIdentifier() string {
+	if x != nil {
+		return x.SmsIdentifier
+	}
+	return ""
+}
+
+type StatusUpdate struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	SmsIdentifier string                 `protobuf:"bytes,1,opt,name=sms_identifier,json=smsIdentifier,proto3" json:"sms_identifier,omitempty"`
+	Recipients    []string               `protobuf:"bytes,2,rep,name=recipients,proto3" json:"recipients,omitempty"`
+	Status        MessageStatus          `protobuf:"varint,3,opt,name=status,proto3,enum=smsgateway.v1.MessageStatus" json:"status,omitempty"`
+	Provider      string                 `protobuf:"bytes,4,opt,name=provider,proto3" json:"provider,omitempty"`
+	Time          *timestamppb.Timestamp `protobuf:"bytes,5,opt,name=time,proto3" json:"time,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StatusUpdate) Reset() {
+	*x = StatusUpdate{}
+	mi := &file_api_gateway_v1_gateway_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StatusUpdate) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StatusUpdate) ProtoMessage() {}
+
+func (x *StatusUpdate) ProtoReflect() protoreflect.Message {
+	mi := &file_api_gateway_v1_gateway_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StatusUpdate.ProtoReflect.Descriptor instead.
+func (*StatusUpdate) Descriptor() ([]byte, []int) {
+	return file_api_gateway_v1_gateway_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *StatusUpdate) GetSmsIdentifier() string {
+	if x != nil {
+		return x.SmsIdentifier
+	}
+	return ""
+}
+
+func (x *StatusUpdate) GetRecipients() []string {
+	if x != nil {
+		return x.Recipients
+	}
+	return nil
+}
+
+func (x *StatusUpdate) GetStatus() MessageStatus {
+	if x != nil {
+		return x.Status
+	}
+	return MessageStatus_MESSAGE_STATUS_UNSPECIFIED
+}
+
+func (x *StatusUpdate) GetProvider() string {
+	if x != nil {
+		return x.Provider
+	}
+	return ""
+}
+
+func (x *StatusUpdate) GetTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Time
+	}
+	return nil
+}
+
+var File_api_gateway_v1_gateway_proto protoreflect.FileDescriptor
+
+const file_api_gateway_v1_gateway_proto_rawDesc = "" +
+	"\n" +
+	"\x1capi/gateway/v1/gateway.proto\x12\rsmsgateway.v1\x1a\x1fgoogle/protobuf/timestamp.proto\"\xa2\x01\n" +
+	"\x0eSendSMSRequest\x12\x12\n" +
+	"\x04text\x18\x01 \x01(\tR\x04text\x12\x1e\n" +
+	"\n" +
+	"recipients\x18\x02 \x03(\tR\n" +
+	"recipients\x12.\n" +
+	"\x04type\x18\x03 \x01(\x0e2\x1a.smsgateway.v1.MessageTypeR\x04type\x12\x1f\n" +
+	"\bpriority\x18\x04 \x01(\x05H\x00R\bpriority\x88\x01\x01B\v\n" +
+	"\t_priority\"n\n" +
+	"\x0fSendSMSResponse\x12%\n" +
+	"\x0esms_identifier\x18\x01 \x01(\tR\rsmsIdentifier\x124\n" +
+	"\x06status\x18\x02 \x01(\x0e2\x1c.smsgateway.v1.MessageStatusR\x06status\":\n" +
+	"\x11GetMessageRequest\x12%\n" +
+	"\x0esms_identifier\x18\x01 \x01(\tR\rsmsIdentifier\"\xbc\x01\n" +
+	"\x0fRecipientStatus\x12\x1c\n" +
+	"\trecipient\x18\x01 \x01(\tR\trecipient\x124\n" +
+	"\x06status\x18\x02 \x01(\x0e2\x1c.smsgateway.v1.MessageStatusR\x06status\x12\x1a\n" +
+	"\bprovider\x18\x03 \x01(\tR\bprovider\x129\n" +
+	"\n" +
+	"updated_at\x18\x04 \x01(\v2\x1a.google.protobuf.TimestampR\tupdatedAt\"\xdb\x01\n" +
+	"\aMessage\x12%\n" +
+	"\x0esms_identifier\x18\x01 \x01(\tR\rsmsIdentifier\x12.\n" +
+	"\x04type\x18\x02 \x01(\x0e2\x1a.smsgateway.v1.MessageTypeR\x04type\x12>\n" +
+	"\n" +
+	"recipients\x18\x03 \x03(\v2\x1e.smsgateway.v1.RecipientStatusR\n" +
+	"recipients\x129\n" +
+	"\n" +
+	"created_at\x18\x04 \x01(\v2\x1a.google.protobuf.TimestampR\tcreatedAt\"q\n" +
+	"\x12ListHistoryRequest\x124\n" +
+	"\x06status\x18\x01 \x01(\x0e2\x1c.smsgateway.v1.MessageStatusR\x06status\x12%\n" +
+	"\x0esms_identifier\x18\x02 \x01(\tR\rsmsIdentifier\"\xcb\x02\n" +
+	"\fHistoryEntry\x12%\n" +
+	"\x0esms_identifier\x18\x01 \x01(\tR\rsmsIdentifier\x12.\n" +
+	"\x04type\x18\x02 \x01(\x0e2\x1a.smsgateway.v1.MessageTypeR\x04type\x12\x1c\n" +
+	"\trecipient\x18\x03 \x01(\tR\trecipient\x124\n" +
+	"\x06status\x18\x04 \x01(\x0e2\x1c.smsgateway.v1.MessageStatusR\x06status\x12\x1a\n" +
+	"\bprovider\x18\x05 \x01(\tR\bprovider\x129\n" +
+	"\n" +
+	"created_at\x18\x06 \x01(\v2\x1a.google.protobuf.TimestampR\tcreatedAt\x129\n" +
+	"\n" +
+	"updated_at\x18\a \x01(\v2\x1a.google.protobuf.TimestampR\tupdatedAt\"L\n" +
+	"\x13ListHistoryResponse\x125\n" +
+	"\aentries\x18\x01 \x03(\v2\x1b.smsgateway.v1.HistoryEntryR\aentries\"\x13\n" +
+	"\x11GetBalanceRequest\"\x9b\x01\n" +
+	"\aBalance\x12\x18\n" +
+	"\abalance\x18\x01 \x01(\x03R\abalance\x12\x12\n" +
+	"\x04held\x18\x02 \x01(\x03R\x04held\x12\x1c\n" +
+	"\tavailable\x18\x03 \x01(\x03R\tavailable\x12!\n" +
+	"\faccount_mode\x18\x04 \x01(\tR\vaccountMode\x12!\n" +
+	"\fcredit_limit\x18\x05 \x01(\x03R\vcreditLimit\";\n" +
+	"\x12WatchStatusRequest\x12%\n" +
+	"\x0esms_identifier\x18\x01 \x01(\tR\rsmsIdentifier\"\xd7\x01\n" +
+	"\fStatusUpdate\x12%\n" +
+	"\x0esms_identifier\x18\x01 \x01(\tR\rsmsIdentifier\x12\x1e\n" +
+	"\n" +
+	"recipients\x18\x02 \x03(\tR\n" +
+	"recipients\x124\n" +
+	"\x06status\x18\x03 \x01(\x0e2\x1c.smsgateway.v1.MessageStatusR\x06status\x12\x1a\n" +
+	"\bprovider\x18\x04 \x01(\tR\bprovider\x12.\n" +
+	"\x04time\x18\x05 \x01(\v2\x1a.google.protobuf.TimestampR\x04time*^\n" +
+	"\vMessageType\x12\x1c\n" +
+	"\x18MESSAGE_TYPE_UNSPECIFIED\x10\x00\x12\x17\n" +
+	"\x13MESSAGE_TYPE_NORMAL\x10\x01\x12\x18\n" +
+	"\x14MESSAGE_TYPE_EXPRESS\x10\x02*\xd1\x01\n" +
+	"\rMessageStatus\x12\x1e\n" +
+	"\x1aMESSAGE_STATUS_UNSPECIFIED\x10\x00\x12\x1a\n" +
+	"\x16MESSAGE_STATUS_PENDING\x10\x01\x12\x17\n" +
+	"\x13MESSAGE_STATUS_HELD\x10\x02\x12\x1a\n" +
+	"\x16MESSAGE_STATUS_SENDING\x10\x03\x12\x17\n" +
+	"\x13MESSAGE_STATUS_DONE\x10\x04\x12\x19\n" +
+	"\x15MESSAGE_STATUS_FAILED\x10\x05\x12\x1b\n" +
+	"\x17MESSAGE_STATUS_REJECTED\x10\x062\x8a\x03\n" +
+	"\aGateway\x12H\n" +
+	"\aSendSMS\x12\x1d.smsgateway.v1.SendSMSRequest\x1a\x1e.smsgateway.v1.SendSMSResponse\x12F\n" +
+	"\n" +
+	"GetMessage\x12 .smsgateway.v1.GetMessageRequest\x1a\x16.smsgateway.v1.Message\x12T\n" +
+	"\vListHistory\x12!.smsgateway.v1.ListHistoryRequest\x1a\".smsgateway.v1.ListHistoryResponse\x12F\n" +
+	"\n" +
+	"GetBalance\x12 .smsgateway.v1.GetBalanceRequest\x1a\x16.smsgateway.v1.Balance\x12O\n" +
+	"\vWatchStatus\x12!.smsgateway.v1.WatchStatusRequest\x1a\x1b.smsgateway.v1.StatusUpdate0\x01B&Z$sms-gateway/api/gateway/v1;gatewayv1b\x06proto3"
+
+var (
+	file_api_gateway_v1_gateway_proto_rawDescOnce sync.Once
+	file_api_gateway_v1_gateway_proto_rawDescData []byte
+)
+
+func file_api_gateway_v1_gateway_proto_rawDescGZIP() []byte {
+	file_api_gateway_v1_gateway_proto_rawDescOnce.Do(func() {
+		file_api_gateway_v1_gateway_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_api_gateway_v1_gateway_proto_rawDesc), len(file_api_gateway_v1_gateway_proto_rawDesc)))
+	})
+	return file_api_gateway_v1_gateway_proto_rawDescData
+}
+
+var file_api_gateway_v1_gateway_proto_enumTypes = make([]protoimpl.EnumInfo, 2)
+var file_api_gateway_v1_gateway_proto_msgTypes = make([]protoimpl.MessageInfo, 12)
+var file_api_gateway_v1_gateway_proto_goTypes = []any{
+	(MessageType)(0),              // 0: smsgateway.v1.MessageType
+	(MessageStatus)(0),            // 1: smsgateway.v1.MessageStatus
+	(*SendSMSRequest)(nil),        // 2: smsgateway.v1.SendSMSRequest
+	(*SendSMSResponse)(nil),       // 3: smsgateway.v1.SendSMSResponse
+	(*GetMessageRequest)(nil),     // 4: smsgateway.v1.GetMessageRequest
+	(*RecipientStatus)(nil),       // 5: smsgateway.v1.RecipientStatus
+	(*Message)(nil),               // 6: smsgateway.v1.Message
+	(*ListHistoryRequest)(nil),    // 7: smsgateway.v1.ListHistoryRequest
+	(*HistoryEntry)(nil),          // 8: smsgateway.v1.HistoryEntry
+	(*ListHistoryResponse)(nil),   // 9: smsgateway.v1.ListHistoryResponse
+	(*GetBalanceRequest)(nil),     // 10: smsgateway.v1.GetBalanceRequest
+	(*Balance)(nil),               // 11: smsgateway.v1.Balance
+	(*WatchStatusRequest)(nil),    // 12: smsgateway.v1.WatchStatusRequest
+	(*StatusUpdate)(nil),          // 13: smsgateway.v1.StatusUpdate
+	(*timestamppb.Timestamp)(nil), // 14: google.protobuf.Timestamp
+}
+var file_api_gateway_v1_gateway_proto_depIdxs = []int32{
+	0,  // 0: smsgateway.v1.SendSMSRequest.type:type_name -> smsgateway.v1.MessageType
+	1,  // 1: smsgateway.v1.SendSMSResponse.status:type_name -> smsgateway.v1.MessageStatus
+	1,  // 2: smsgateway.v1.RecipientStatus.status:type_name -> smsgateway.v1.MessageStatus
+	14, // 3: smsgateway.v1.RecipientStatus.updated_at:type_name -> google.protobuf.Timestamp
+	0,  // 4: smsgateway.v1.Message.type:type_name -> smsgateway.v1.MessageType
+	5,  // 5: smsgateway.v1.Message.recipients:type_name -> smsgateway.v1.RecipientStatus
+	14, // 6: smsgateway.v1.Message.created_at:type_name -> google.protobuf.Timestamp
+	1,  // 7: smsgateway.v1.ListHistoryRequest.status:type_name -> smsgateway.v1.MessageStatus
+	0,  // 8: smsgateway.v1.HistoryEntry.type:type_name -> smsgateway.v1.MessageType
+	1,  // 9: smsgateway.v1.HistoryEntry.status:type_name -> smsgateway.v1.MessageStatus
+	14, // 10: smsgateway.v1.HistoryEntry.created_at:type_name -> google.protobuf.Timestamp
+	14, // 11: smsgateway.v1.HistoryEntry.updated_at:type_name -> google.protobuf.Timestamp
+	8,  // 12: smsgateway.v1.ListHistoryResponse.entries:type_name -> smsgateway.v1.HistoryEntry
+	1,  // 13: smsgateway.v1.StatusUpdate.status:type_name -> smsgateway.v1.MessageStatus
+	14, // 14: smsgateway.v1.StatusUpdate.time:type_name -> google.protobuf.Timestamp
+	2,  // 15: smsgateway.v1.Gateway.SendSMS:input_type -> smsgateway.v1.SendSMSRequest
+	4,  // 16: smsgateway.v1.Gateway.GetMessage:input_type -> smsgateway.v1.GetMessageRequest
+	7,  // 17: smsgateway.v1.Gateway.ListHistory:input_type -> smsgateway.v1.ListHistoryRequest
+	10, // 18: smsgateway.v1.Gateway.GetBalance:input_type -> smsgateway.v1.GetBalanceRequest
+	12, // 19: smsgateway.v1.Gateway.WatchStatus:input_type -> smsgateway.v1.WatchStatusRequest
+	3,  // 20: smsgateway.v1.Gateway.SendSMS:output_type -> smsgateway.v1.SendSMSResponse
+	6,  // 21: smsgateway.v1.Gateway.GetMessage:output_type -> smsgateway.v1.Message
+	9,  // 22: smsgateway.v1.Gateway.ListHistory:output_type -> smsgateway.v1.ListHistoryResponse
+	11, // 23: smsgateway.v1.Gateway.GetBalance:output_type -> smsgateway.v1.Balance
+	13, // 24: smsgateway.v1.Gateway.WatchStatus:output_type -> smsgateway.v1.StatusUpdate
+	20, // [20:25] is the sub-list for method output_type
+	15, // [15:20] is the sub-list for method input_type
+	15, // [15:15] is the sub-list for extension type_name
+	15, // [15:15] is the sub-list for extension extendee
+	0,  // [0:15] is the sub-list for field type_name
+}
+
+func init() { file_api_gateway_v1_gateway_proto_init() }
+func file_api_gateway_v1_gateway_proto_init() {
+	if File_api_gateway_v1_gateway_proto != nil {
+		return
+	}
+	file_api_gateway_v1_gateway_proto_msgTypes[0].OneofWrappers = []any{}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_api_gateway_v1_gateway_proto_rawDesc), len(file_api_gateway_v1_gateway_proto_rawDesc)),
+			NumEnums:      2,
+			NumMessages:   12,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_api_gateway_v1_gateway_proto_goTypes,
+		DependencyIndexes: file_api_gateway_v1_gateway_proto_depIdxs,
+		EnumInfos:         file_api_gateway_v1_gateway_proto_enumTypes,
+		MessageInfos:      file_api_gateway_v1_gateway_proto_msgTypes,
+	}.Build()
+	File_api_gateway_v1_gateway_proto = out.File
+	file_api_gateway_v1_gateway_proto_goTypes = nil
+	file_api_gateway_v1_gateway_proto_depIdxs = nil
+}
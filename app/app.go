@@ -5,6 +5,7 @@ import (
 	"log/slog"
 	"os"
 	"sms-gateway/config"
+	"sms-gateway/internal/model"
 	"sms-gateway/pkg/db"
 	"sms-gateway/pkg/metrics"
 	amqp "sms-gateway/pkg/queue"
@@ -33,6 +34,15 @@ func Init() {
 	iniRabbit()
 }
 
+// InitCLI initialises config, logging, tracing and the DB only, for command-line tools
+// that neither serve HTTP nor talk to RabbitMQ.
+func InitCLI() {
+	config.Init()
+	initLogger()
+	initTracing()
+	initDB()
+}
+
 func initLogger() {
 	handler := slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{})
 	Logger = slog.New(handler)
@@ -83,6 +93,7 @@ func iniRabbit() {
 			{Queue: config.ExpressQueue, RoutingKey: config.ExpressQueue},
 			{Queue: config.NormalQueue, RoutingKey: config.NormalQueue},
 		},
+		MaxPriority: model.MaxPriority,
 	}); err != nil {
 		panic(err)
 	}
@@ -92,11 +103,14 @@ func initEcho() {
 	Echo = echo.New()
 	Echo.HideBanner = true
 	Echo.HidePort = true
+	Echo.HTTPErrorHandler = httpErrorHandler
+	Echo.Use(middleware.RequestID())
 	Echo.Use(func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
 			ctx, span := tracing.Start(c.Request().Context(), "http.request",
 				tracing.Attr("path", c.Path()),
 				tracing.Attr("method", c.Request().Method),
+				tracing.Attr("request_id", c.Response().Header().Get(echo.HeaderXRequestID)),
 			)
 			defer span.End()
 			c.SetRequest(c.Request().WithContext(ctx))
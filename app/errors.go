@@ -0,0 +1,68 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"sms-gateway/pkg/apierror"
+
+	"github.com/labstack/echo/v4"
+)
+
+// APIVersionPrefix starts the routes that answer errors with the apierror.Error envelope.
+// Unversioned routes are kept for existing clients and answer errors as before, {"message": ...}.
+const APIVersionPrefix = "/v1"
+
+// httpErrorHandler is the Echo HTTPErrorHandler. Errors that are not an *echo.HTTPError (a plain
+// `return err` from a handler) become a 500 with code INTERNAL and are logged with the request
+// id the client sees.
+func httpErrorHandler(err error, c echo.Context) {
+	if c.Response().Committed {
+		return
+	}
+
+	requestID := c.Response().Header().Get(echo.HeaderXRequestID)
+	var he *echo.HTTPError
+	if !errors.As(err, &he) {
+		Logger.Error("request failed", "request_id", requestID, "method", c.Request().Method, "path", c.Request().URL.Path, "err", err)
+		he = echo.NewHTTPError(http.StatusInternalServerError, &apierror.Error{Code: apierror.Internal, Message: "internal error"})
+	}
+	if inner, ok := he.Internal.(*echo.HTTPError); ok {
+		he = inner
+	}
+
+	if !isVersioned(c.Request().URL.Path) {
+		Echo.DefaultHTTPErrorHandler(err, c)
+		return
+	}
+
+	body := toAPIError(he)
+	body.RequestID = requestID
+	if c.Request().Method == http.MethodHead {
+		err = c.NoContent(he.Code)
+	} else {
+		err = c.JSON(he.Code, body)
+	}
+	if err != nil {
+		Logger.Error("write error response", "request_id", requestID, "err", err)
+	}
+}
+
+func toAPIError(he *echo.HTTPError) apierror.Error {
+	switch m := he.Message.(type) {
+	case *apierror.Error:
+		return *m
+	case string:
+		return apierror.Error{Code: apierror.ForStatus(he.Code), Message: m}
+	case error:
+		return apierror.Error{Code: apierror.ForStatus(he.Code), Message: m.Error()}
+	default:
+		return apierror.Error{Code: apierror.ForStatus(he.Code), Message: fmt.Sprint(m)}
+	}
+}
+
+func isVersioned(path string) bool {
+	return path == APIVersionPrefix || strings.HasPrefix(path, APIVersionPrefix+"/")
+}
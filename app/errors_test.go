@@ -0,0 +1,80 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"sms-gateway/pkg/apierror"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestHTTPErrorHandler(t *testing.T) {
+	Logger = slog.New(slog.NewTextHandler(bytes.NewBuffer(nil), nil))
+	Echo = echo.New()
+	Echo.HTTPErrorHandler = httpErrorHandler
+
+	cases := []struct {
+		path   string
+		err    error
+		status int
+		body   map[string]any
+	}{
+		{
+			path:   "/v1/sms/send",
+			err:    apierror.WithDetails(http.StatusBadRequest, apierror.InvalidRecipient, "invalid recipient", map[string]any{"index": 1}),
+			status: http.StatusBadRequest,
+			body:   map[string]any{"code": "INVALID_RECIPIENT", "message": "invalid recipient", "details": map[string]any{"index": float64(1)}, "request_id": "req-1"},
+		},
+		{
+			path:   "/v1/balance",
+			err:    echo.NewHTTPError(http.StatusNotFound, "alert not found"),
+			status: http.StatusNotFound,
+			body:   map[string]any{"code": "NOT_FOUND", "message": "alert not found", "request_id": "req-1"},
+		},
+		{
+			path:   "/v1/balance",
+			err:    errors.New("connection refused"),
+			status: http.StatusInternalServerError,
+			body:   map[string]any{"code": "INTERNAL", "message": "internal error", "request_id": "req-1"},
+		},
+		{
+			path:   "/sms/send",
+			err:    apierror.New(http.StatusPaymentRequired, apierror.InsufficientBalance, "insufficient balance"),
+			status: http.StatusPaymentRequired,
+			body:   map[string]any{"message": "insufficient balance"},
+		},
+		{
+			path:   "/balance",
+			err:    errors.New("connection refused"),
+			status: http.StatusInternalServerError,
+			body:   map[string]any{"message": "Internal Server Error"},
+		},
+	}
+	for _, tc := range cases {
+		rec := httptest.NewRecorder()
+		c := Echo.NewContext(httptest.NewRequest(http.MethodPost, tc.path, nil), rec)
+		c.Response().Header().Set(echo.HeaderXRequestID, "req-1")
+
+		httpErrorHandler(tc.err, c)
+
+		var body map[string]any
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+			t.Fatalf("%s: decode %q: %v", tc.path, rec.Body.String(), err)
+		}
+		if rec.Code != tc.status || !jsonEqual(body, tc.body) {
+			t.Fatalf("%s %v: got %d %v, want %d %v", tc.path, tc.err, rec.Code, body, tc.status, tc.body)
+		}
+	}
+}
+
+func jsonEqual(a, b map[string]any) bool {
+	x, _ := json.Marshal(a)
+	y, _ := json.Marshal(b)
+	return bytes.Equal(x, y)
+}
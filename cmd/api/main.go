@@ -2,44 +2,108 @@ package main
 
 import (
 	"context"
+	"net"
 	"os/signal"
 	"sms-gateway/app"
 	"sms-gateway/config"
+	"sms-gateway/internal/audit"
+	"sms-gateway/internal/auth"
 	"sms-gateway/internal/balance"
+	"sms-gateway/internal/grpcapi"
+	"sms-gateway/internal/idempotency"
+	"sms-gateway/internal/invoice"
+	"sms-gateway/internal/kannel"
+	"sms-gateway/internal/ledger"
+	"sms-gateway/internal/notify"
+	"sms-gateway/internal/otp"
+	"sms-gateway/internal/policy"
+	"sms-gateway/internal/pricing"
+	"sms-gateway/internal/reconcile"
+	"sms-gateway/internal/smppapi"
 	"sms-gateway/internal/sms"
+	"sms-gateway/internal/usage"
 	"sms-gateway/pkg/metrics"
 	"syscall"
 	"time"
 
 	_ "sms-gateway/docs"
 
+	"github.com/labstack/echo/v4"
 	echSwagger "github.com/swaggo/echo-swagger"
+	"google.golang.org/grpc"
 )
 
 // @title           SMS Gateway API
 // @version         1.0
-// @description     Simple SMS gateway with balance management and operator failover.
+// @description     Simple SMS gateway with balance management and operator failover. Failed requests return {code, message, details, request_id}.
 // @host            localhost:8080
-// @BasePath        /
+// @BasePath        /v1
+// @securityDefinitions.apikey BearerAuth
+// @in              header
+// @name            Authorization
+// @description     API key as "Bearer <key>"
+// @securityDefinitions.apikey AdminAuth
+// @in              header
+// @name            Authorization
+// @description     Admin key as "Bearer <key>"
 func main() {
 	app.Init()
 
-	// Handlers
-	app.Echo.POST("/sms/send", sms.SendHandler)
-	app.Echo.GET("/sms/history", sms.HistoryHandler)
+	// The first admin key comes from the environment; further ones are issued through /admin/keys.
+	if config.AdminBootstrapKey != "" {
+		if err := auth.EnsureAdminKey(context.Background(), "bootstrap", config.AdminBootstrapKey); err != nil {
+			panic(err)
+		}
+	}
+
+	// Handlers. Every route is served under /v1 and, for existing clients, unversioned; only /v1
+	// answers errors with the JSON error envelope.
+	registerRoutes(app.Echo.Group(app.APIVersionPrefix))
+	registerRoutes(app.Echo.Group(""))
 
-	app.Echo.GET("/balance", balance.GetBalanceAndHistoryHandler)
-	app.Echo.POST("/balance/add", balance.AddBalanceHandler)
+	// Kannel's sendsms interface for clients migrating from Kannel; it replies in plain text.
+	app.Echo.GET("/cgi-bin/sendsms", kannel.SendHandler)
+	app.Echo.POST("/cgi-bin/sendsms", kannel.SendHandler)
 
 	app.Echo.GET("/swagger/*", echSwagger.WrapHandler)
 	app.Echo.GET("/metrics", metrics.Handler())
 
+	// Shutdown waits for open handlers; ending the status subscriptions ends the event streams.
+	app.Echo.Server.RegisterOnShutdown(sms.CloseStatusSubscribers)
+
 	// Graceful ShoutDown
 	serverErrCh := make(chan error, 1)
 	go func() {
 		serverErrCh <- app.Echo.Start(config.AppListenAddr)
 	}()
 
+	// gRPC API for internal services, next to the HTTP one.
+	var grpcServer *grpc.Server
+	grpcErrCh := make(chan error, 1)
+	if config.GRPCListenAddr != "" {
+		lis, err := net.Listen("tcp", config.GRPCListenAddr)
+		if err != nil {
+			panic(err)
+		}
+		grpcServer = grpcapi.New()
+		go func() {
+			grpcErrCh <- grpcServer.Serve(lis)
+		}()
+	}
+
+	var smppServer *smppapi.Server
+	smppErrCh := make(chan error, 1)
+	if config.SMPPListenAddr != "" {
+		lis, err := net.Listen("tcp", config.SMPPListenAddr)
+		if err != nil {
+			panic(err)
+		}
+		smppServer = smppapi.New()
+		go func() {
+			smppErrCh <- smppServer.Serve(lis)
+		}()
+	}
+
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer stop()
 
@@ -53,6 +117,79 @@ func main() {
 		outboxErrCh <- sms.StartOutboxPublisher(ctx)
 	}()
 
+	holdsErrCh := make(chan error, 1)
+	go func() {
+		holdsErrCh <- balance.StartHoldExpirer(ctx, time.Duration(config.HoldExpiryCheckSec)*time.Second)
+	}()
+
+	heldErrCh := make(chan error, 1)
+	go func() {
+		heldErrCh <- sms.StartHeldExpirer(ctx, time.Duration(config.HoldExpiryCheckSec)*time.Second)
+	}()
+
+	shardsErrCh := make(chan error, 1)
+	if config.ShardRebalanceIntervalSec > 0 {
+		go func() {
+			shardsErrCh <- balance.StartShardRebalancer(ctx, time.Duration(config.ShardRebalanceIntervalSec)*time.Second)
+		}()
+	}
+
+	notifyErrCh := make(chan error, 1)
+	go func() {
+		notifyErrCh <- notify.StartDispatcher(ctx)
+	}()
+
+	reconcileErrCh := make(chan error, 1)
+	if config.ReconcileIntervalSec > 0 {
+		go func() {
+			reconcileErrCh <- reconcile.StartWorker(ctx, time.Duration(config.ReconcileIntervalSec)*time.Second, config.ReconcileBatchSize)
+		}()
+	}
+
+	invoiceErrCh := make(chan error, 1)
+	if config.InvoiceIntervalSec > 0 {
+		go func() {
+			invoiceErrCh <- invoice.StartWorker(ctx, time.Duration(config.InvoiceIntervalSec)*time.Second)
+		}()
+	}
+
+	idempotencyErrCh := make(chan error, 1)
+	go func() {
+		idempotencyErrCh <- idempotency.StartPurger(ctx, time.Hour, time.Duration(config.IdempotencyKeyTTLSec)*time.Second)
+	}()
+
+	statusBridgeErrCh := make(chan error, 1)
+	go func() {
+		statusBridgeErrCh <- sms.StartStatusBridge(ctx)
+	}()
+
+	statusEventsErrCh := make(chan error, 1)
+	go func() {
+		statusEventsErrCh <- sms.StartStatusEventPurger(ctx, time.Hour, time.Duration(config.StatusEventRetentionSec)*time.Second)
+	}()
+
+	kannelErrCh := make(chan error, 1)
+	go func() {
+		kannelErrCh <- kannel.StartDLRDispatcher(ctx)
+	}()
+
+	kannelPurgeErrCh := make(chan error, 1)
+	go func() {
+		kannelPurgeErrCh <- kannel.StartPurger(ctx, time.Hour, time.Duration(config.KannelMessageRetentionSec)*time.Second)
+	}()
+
+	smppPurgeErrCh := make(chan error, 1)
+	if smppServer != nil {
+		go func() {
+			smppPurgeErrCh <- smppapi.StartPurger(ctx, time.Hour, time.Duration(config.SMPPRetentionSec)*time.Second)
+		}()
+	}
+
+	usageErrCh := make(chan error, 1)
+	go func() {
+		usageErrCh <- usage.StartRollup(ctx, time.Duration(config.UsageRollupIntervalSec)*time.Second, config.UsageRollupBatchSize)
+	}()
+
 	select {
 	case err := <-consumerErrCh:
 		if err != nil {
@@ -62,10 +199,70 @@ func main() {
 		if err != nil {
 			app.Logger.Error("outbox error", "err", err)
 		}
+	case err := <-holdsErrCh:
+		if err != nil {
+			app.Logger.Error("hold expirer error", "err", err)
+		}
+	case err := <-heldErrCh:
+		if err != nil {
+			app.Logger.Error("held message expirer error", "err", err)
+		}
+	case err := <-shardsErrCh:
+		if err != nil {
+			app.Logger.Error("shard rebalancer error", "err", err)
+		}
+	case err := <-notifyErrCh:
+		if err != nil {
+			app.Logger.Error("notify dispatcher error", "err", err)
+		}
+	case err := <-reconcileErrCh:
+		if err != nil {
+			app.Logger.Error("reconcile worker error", "err", err)
+		}
+	case err := <-invoiceErrCh:
+		if err != nil {
+			app.Logger.Error("invoice worker error", "err", err)
+		}
+	case err := <-idempotencyErrCh:
+		if err != nil {
+			app.Logger.Error("idempotency purger error", "err", err)
+		}
+	case err := <-statusBridgeErrCh:
+		if err != nil {
+			app.Logger.Error("status bridge error", "err", err)
+		}
+	case err := <-statusEventsErrCh:
+		if err != nil {
+			app.Logger.Error("status event purger error", "err", err)
+		}
+	case err := <-kannelErrCh:
+		if err != nil {
+			app.Logger.Error("kannel dlr dispatcher error", "err", err)
+		}
+	case err := <-kannelPurgeErrCh:
+		if err != nil {
+			app.Logger.Error("kannel purger error", "err", err)
+		}
+	case err := <-smppPurgeErrCh:
+		if err != nil {
+			app.Logger.Error("smpp purger error", "err", err)
+		}
+	case err := <-usageErrCh:
+		if err != nil {
+			app.Logger.Error("usage rollup error", "err", err)
+		}
 	case err := <-serverErrCh:
 		if err != nil {
 			app.Logger.Error("server error", "err", err)
 		}
+	case err := <-grpcErrCh:
+		if err != nil {
+			app.Logger.Error("grpc server error", "err", err)
+		}
+	case err := <-smppErrCh:
+		if err != nil {
+			app.Logger.Error("smpp server error", "err", err)
+		}
 	case <-ctx.Done():
 		app.Logger.Info("shutdown signal received")
 	}
@@ -76,7 +273,110 @@ func main() {
 	if err := app.Echo.Shutdown(shutdownCtx); err != nil {
 		app.Logger.Error("echo shutdown", "err", err)
 	}
+	if grpcServer != nil {
+		stopGRPC(shutdownCtx, grpcServer)
+	}
+	if smppServer != nil {
+		if err := smppServer.Shutdown(shutdownCtx); err != nil {
+			app.Logger.Error("smpp shutdown", "err", err)
+		}
+	}
 
 	stop()
 	app.Shutdown()
 }
+
+// stopGRPC waits for in-flight calls like Echo.Shutdown, then cuts off what is left when ctx
+// ends; WatchStatus streams only end when their clients leave.
+func stopGRPC(ctx context.Context, s *grpc.Server) {
+	done := make(chan struct{})
+	go func() {
+		s.GracefulStop()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		s.Stop()
+	}
+}
+
+// registerRoutes adds the API under g. Customer routes act for the customer of the API key and
+// ignore client-supplied ids; their POSTs honour Idempotency-Key, except the key routes, whose
+// responses carry secrets that must not be stored.
+func registerRoutes(g *echo.Group) {
+	keys := g.Group("", auth.Middleware)
+	keys.GET("/keys", auth.ListKeysHandler)
+	keys.POST("/keys", auth.CreateKeyHandler)
+	keys.POST("/keys/:id/rotate", auth.RotateKeyHandler)
+	keys.DELETE("/keys/:id", auth.RevokeKeyHandler)
+	// Creating a sub-account returns its API key, so it skips the idempotency store too.
+	keys.POST("/sub-accounts", balance.CreateSubAccountHandler)
+
+	api := g.Group("", auth.Middleware, idempotency.Middleware)
+	api.POST("/sms/send", sms.SendHandler)
+	api.GET("/sms/history", sms.HistoryHandler)
+	api.GET("/sms/status/stream", sms.StreamStatusHandler)
+	api.GET("/reports/usage", usage.ReportHandler)
+	api.GET("/invoices", invoice.ListHandler)
+	api.GET("/invoices/:number", invoice.GetHandler)
+
+	api.POST("/otp/send", otp.SendHandler)
+	api.POST("/otp/verify", otp.VerifyHandler)
+
+	api.GET("/balance", balance.GetBalanceAndHistoryHandler)
+	api.GET("/balance/statement", balance.StatementHandler)
+	api.GET("/balance/alerts", balance.ListAlertsHandler)
+	api.POST("/balance/alerts", balance.SetAlertHandler)
+	api.DELETE("/balance/alerts/:id", balance.DeleteAlertHandler)
+	api.GET("/sub-accounts", balance.ListSubAccountsHandler)
+	api.GET("/sub-accounts/usage", balance.SubAccountUsageHandler)
+	api.PUT("/sub-accounts/:child_id", balance.UpdateSubAccountHandler)
+	api.POST("/sub-accounts/:child_id/transfer", balance.TransferHandler)
+	api.GET("/sub-accounts/:child_id/prices", balance.ListSubAccountPricesHandler)
+	api.POST("/sub-accounts/:child_id/prices", balance.CreateSubAccountPriceHandler)
+
+	// Admin routes need an admin key; everything they change is written to the audit log.
+	admin := g.Group("", auth.AdminMiddleware, audit.Middleware)
+	admin.POST("/balance/add", balance.AddBalanceHandler)
+
+	admin.GET("/admin/keys", auth.ListAdminKeysHandler)
+	admin.POST("/admin/keys", auth.CreateAdminKeyHandler)
+	admin.DELETE("/admin/keys/:id", auth.RevokeAdminKeyHandler)
+	admin.GET("/admin/audit-log", audit.ListHandler)
+	admin.POST("/admin/customers", auth.CreateCustomerHandler)
+	admin.GET("/admin/customers/:customer_id/keys", auth.AdminListKeysHandler)
+	admin.POST("/admin/customers/:customer_id/keys", auth.AdminCreateKeyHandler)
+	admin.DELETE("/admin/customers/:customer_id/keys/:id", auth.AdminRevokeKeyHandler)
+	admin.GET("/admin/reports/usage", usage.AdminReportHandler)
+	admin.GET("/admin/content-rules", policy.ListRulesHandler)
+	admin.POST("/admin/content-rules", policy.CreateRuleHandler)
+	admin.DELETE("/admin/content-rules/:id", policy.DeleteRuleHandler)
+	admin.GET("/admin/accounts/:user_id", balance.GetAccountHandler)
+	admin.PUT("/admin/accounts/:user_id", balance.SetAccountHandler)
+	admin.GET("/admin/accounts/:user_id/shards", balance.GetShardsHandler)
+	admin.PUT("/admin/accounts/:user_id/shards", balance.SetShardsHandler)
+	admin.PUT("/admin/sub-accounts/:child_id", balance.LinkSubAccountHandler)
+	admin.GET("/admin/refunds", balance.ListRefundsHandler)
+	admin.POST("/admin/refunds", balance.RefundHandler)
+	admin.POST("/admin/invoices/generate", invoice.GenerateHandler)
+	admin.GET("/admin/ledger/accounts", ledger.BalancesHandler)
+	admin.GET("/admin/ledger/journals", ledger.JournalHandler)
+	admin.GET("/admin/reconciliation/runs", reconcile.ListRunsHandler)
+	admin.POST("/admin/reconciliation/runs", reconcile.RunHandler)
+	admin.GET("/admin/reconciliation/runs/:id/drifts", reconcile.ListDriftsHandler)
+	admin.POST("/admin/reconciliation/drifts/:id/approve", reconcile.ApproveDriftHandler)
+	admin.GET("/admin/prices", pricing.ListPricesHandler)
+	admin.POST("/admin/prices", pricing.CreatePriceHandler)
+	admin.GET("/admin/priority-limits/:customer_id", sms.GetPriorityLimitsHandler)
+	admin.PUT("/admin/priority-limits/:customer_id", sms.SetPriorityLimitsHandler)
+	admin.GET("/admin/send-limits/:customer_id", sms.GetSendLimitsHandler)
+	admin.PUT("/admin/send-limits/:customer_id", sms.SetSendLimitsHandler)
+	admin.GET("/admin/held-messages", sms.ListHeldHandler)
+	admin.POST("/admin/held-messages/:sms_identifier/approve", sms.ApproveHeldHandler)
+	admin.POST("/admin/held-messages/:sms_identifier/reject", sms.RejectHeldHandler)
+	admin.GET("/admin/smpp-accounts", smppapi.ListAccountsHandler)
+	admin.PUT("/admin/smpp-accounts/:system_id", smppapi.SetAccountHandler)
+	admin.POST("/admin/smpp-accounts/:system_id/password", smppapi.ResetPasswordHandler)
+	admin.DELETE("/admin/smpp-accounts/:system_id", smppapi.DeleteAccountHandler)
+}
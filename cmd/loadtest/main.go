@@ -1,13 +1,11 @@
 package main
 
 import (
-	"bytes"
 	"context"
 	"database/sql"
-	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
-	"io"
 	"math/rand"
 	"net/http"
 	"os"
@@ -17,22 +15,12 @@ import (
 	"sync/atomic"
 	"time"
 
+	"sms-gateway/internal/auth"
+	"sms-gateway/pkg/client"
+
 	_ "github.com/go-sql-driver/mysql"
 )
 
-type smsReq struct {
-	CustomerID int64    `json:"customer_id"`
-	Text       string   `json:"text"`
-	Recipients []string `json:"recipients"`
-	Type       string   `json:"type"` // normal|express
-}
-
-type addBalanceReq struct {
-	UserID      int64  `json:"user_id"`
-	Balance     uint64 `json:"balance"`
-	Description string `json:"description,omitempty"`
-}
-
 type result struct {
 	d    time.Duration
 	err  error
@@ -58,8 +46,9 @@ func main() {
 		seedDesc        = flag.String("seed-desc", "loadtest seed", "description used when seeding balances")
 
 		// Fast seeding: bulk upsert directly into MySQL (no HTTP, no per-user tx).
-		seedMethod = flag.String("seed-method", "db", "seed method: db|http")
+		seedMethod = flag.String("seed-method", "db", "seed method for balances and API keys: db|http")
 		seedDBDSN  = flag.String("seed-db-dsn", "", "MySQL DSN used when seed-method=db (optional). If empty, built from DB_* env vars.")
+		adminKey   = flag.String("admin-key", os.Getenv("ADMIN_API_KEY"), "admin key for seed-method=http (defaults to $ADMIN_API_KEY)")
 	)
 	flag.Parse()
 
@@ -79,9 +68,16 @@ func main() {
 		}
 	}
 
-	endpoint := *baseURL + "/sms/send"
-	balanceEndpoint := *baseURL + "/balance/add"
-	client := &http.Client{Timeout: *timeout}
+	if *seedMethod == "http" && *adminKey == "" {
+		panic("invalid args: -seed-method http requires -admin-key")
+	}
+
+	endpoint := *baseURL + client.APIVersionPrefix + "/sms/send"
+	balanceEndpoint := *baseURL + client.APIVersionPrefix + "/balance/add"
+	httpClient := &http.Client{Timeout: *timeout}
+	// Seeding retries failed calls (e.g. deadlocks under load); traffic measures single attempts.
+	admin := client.New(*baseURL, client.WithHTTPClient(httpClient), client.WithAPIKey(*adminKey), client.WithMaxRetries(5))
+	sender := client.New(*baseURL, client.WithHTTPClient(httpClient), client.WithMaxRetries(0))
 
 	if *seedBalance > 0 {
 		seedCtx, seedCancel := context.WithTimeout(context.Background(), *seedTimeout)
@@ -99,7 +95,7 @@ func main() {
 			fmt.Println("seeding balances: done")
 		case "http":
 			fmt.Printf("seeding balances (http): users=%d amount=%d endpoint=%s\n", *users, *seedBalance, balanceEndpoint)
-			if err := seedBalances(seedCtx, client, balanceEndpoint, *userStart, *users, *seedBalance, *seedDesc, *seedConcurrency); err != nil {
+			if err := seedBalances(seedCtx, admin, *userStart, *users, *seedBalance, *seedDesc, *seedConcurrency); err != nil {
 				panic(fmt.Sprintf("seed balances (http) failed: %v", err))
 			}
 			fmt.Println("seeding balances: done")
@@ -112,6 +108,32 @@ func main() {
 		return
 	}
 
+	// Every user gets a fresh API key for this run; requests authenticate with it.
+	keyName := fmt.Sprintf("loadtest-%d", time.Now().UnixNano())
+	keysCtx, keysCancel := context.WithTimeout(context.Background(), *seedTimeout)
+	var keys []string
+	var err error
+	switch *seedMethod {
+	case "db":
+		dsn := *seedDBDSN
+		if dsn == "" {
+			dsn = buildDSNFromEnv()
+		}
+		keys, err = provisionKeysDB(keysCtx, dsn, *userStart, *users, keyName)
+	case "http":
+		keys, err = provisionKeysHTTP(keysCtx, admin, *userStart, *users, keyName, *seedConcurrency)
+	default:
+		panic("invalid -seed-method (db|http)")
+	}
+	keysCancel()
+	if err != nil {
+		panic(fmt.Sprintf("provision api keys failed: %v", err))
+	}
+	senders := make([]*client.Client, len(keys))
+	for i, key := range keys {
+		senders[i] = sender.WithKey(key)
+	}
+
 	// Start traffic timer AFTER seeding, so duration applies to the actual load phase.
 	ctx, cancel := context.WithTimeout(context.Background(), *duration)
 	defer cancel()
@@ -149,38 +171,33 @@ func main() {
 			defer wg.Done()
 			rng := rand.New(rand.NewSource(time.Now().UnixNano() + int64(workerID)))
 			for range tokens {
-				reqBody := smsReq{
-					CustomerID: *userStart + (rng.Int63() % *users),
+				c := senders[rng.Int63()%*users]
+				req := client.SendSMSRequest{
 					Text:       "hello",
 					Recipients: makeRecipients(*recipients),
-					Type:       "normal",
+					Type:       client.Normal,
 				}
 				if rng.Float64() < *expressRatio {
-					reqBody.Type = "express"
+					req.Type = client.Express
 				}
-				b, _ := json.Marshal(reqBody)
 
 				start := time.Now()
-				req, _ := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(b))
-				req.Header.Set("Content-Type", "application/json")
-
-				resp, err := client.Do(req)
+				_, err := c.SendSMS(ctx, req)
 				d := time.Since(start)
 				atomic.AddUint64(&sent, 1)
-				if err != nil {
-					atomic.AddUint64(&httpErr, 1)
-					results <- result{d: d, err: err}
-					continue
-				}
-				_, _ = io.ReadAll(resp.Body)
-				_ = resp.Body.Close()
 
-				if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+				var apiErr *client.Error
+				switch {
+				case err == nil:
 					atomic.AddUint64(&ok, 1)
-				} else {
+					results <- result{d: d, code: http.StatusOK}
+				case errors.As(err, &apiErr):
 					atomic.AddUint64(&bad, 1)
+					results <- result{d: d, code: apiErr.StatusCode}
+				default:
+					atomic.AddUint64(&httpErr, 1)
+					results <- result{d: d, err: err}
 				}
-				results <- result{d: d, code: resp.StatusCode}
 			}
 		}(i)
 	}
@@ -238,8 +255,7 @@ func makeRecipients(n int) []string {
 
 func seedBalances(
 	ctx context.Context,
-	client *http.Client,
-	endpoint string,
+	admin *client.Client,
 	userStart int64,
 	users int64,
 	amount uint64,
@@ -255,6 +271,7 @@ func seedBalances(
 
 	var seeded uint64
 	var failed uint64
+	runID := time.Now().UnixNano()
 
 	worker := func() {
 		defer wg.Done()
@@ -265,31 +282,15 @@ func seedBalances(
 			default:
 			}
 
-			ok := false
-			for attempt := 0; attempt < 6; attempt++ {
-				if attempt > 0 {
-					time.Sleep(time.Duration(30*(1<<attempt)) * time.Millisecond)
-				}
-				body := addBalanceReq{UserID: userID, Balance: amount, Description: description}
-				b, _ := json.Marshal(body)
-				req, _ := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(b))
-				req.Header.Set("Content-Type", "application/json")
-				resp, err := client.Do(req)
-				if err != nil {
-					continue
-				}
-				_, _ = io.ReadAll(resp.Body)
-				_ = resp.Body.Close()
-				if resp.StatusCode >= 200 && resp.StatusCode < 300 {
-					ok = true
-					break
-				}
-				// retry on server-side errors (includes deadlock)
-				if resp.StatusCode < 500 {
-					break
-				}
-			}
-			if ok {
+			// The payment reference makes the client's retries safe.
+			_, err := admin.AddBalance(ctx, client.AddBalanceRequest{
+				UserID:           userID,
+				Amount:           amount,
+				Description:      description,
+				PaymentSource:    "loadtest",
+				PaymentReference: fmt.Sprintf("loadtest-%d-%d", runID, userID),
+			})
+			if err == nil {
 				atomic.AddUint64(&seeded, 1)
 			} else {
 				atomic.AddUint64(&failed, 1)
@@ -397,6 +398,94 @@ func seedBalancesDB(ctx context.Context, dsn string, userStart int64, users int6
 	return tx.Commit()
 }
 
+// provisionKeysDB creates the customers if needed and one API key each, straight in MySQL.
+func provisionKeysDB(ctx context.Context, dsn string, userStart, users int64, name string) ([]string, error) {
+	db, err := sql.Open("mysql", dsn)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := db.Close(); err != nil {
+			fmt.Fprintf(os.Stderr, "error closing db: %v\n", err)
+		}
+	}()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	keys := make([]string, 0, users)
+	const chunk = 2000
+	for offset := int64(0); offset < users; offset += chunk {
+		n := min(int64(chunk), users-offset)
+
+		customerRows := make([]string, 0, n)
+		keyRows := make([]string, 0, n)
+		customerArgs := make([]any, 0, n)
+		keyArgs := make([]any, 0, n*4)
+		for i := int64(0); i < n; i++ {
+			key, err := auth.NewKey()
+			if err != nil {
+				return nil, err
+			}
+			keys = append(keys, key)
+			customerRows = append(customerRows, "(?)")
+			customerArgs = append(customerArgs, userStart+offset+i)
+			keyRows = append(keyRows, "(?,?,?,?)")
+			keyArgs = append(keyArgs, userStart+offset+i, name, auth.DisplayPrefix(key), auth.HashKey(key))
+		}
+		if _, err := tx.ExecContext(ctx, "INSERT IGNORE INTO customers (id) VALUES "+strings.Join(customerRows, ","), customerArgs...); err != nil {
+			return nil, err
+		}
+		if _, err := tx.ExecContext(ctx, "INSERT INTO api_keys (customer_id, name, prefix, key_hash) VALUES "+strings.Join(keyRows, ","), keyArgs...); err != nil {
+			return nil, err
+		}
+	}
+
+	return keys, tx.Commit()
+}
+
+// provisionKeysHTTP creates the customers (or, when they exist, another key) through the admin API.
+func provisionKeysHTTP(ctx context.Context, admin *client.Client, userStart, users int64, name string, concurrency int) ([]string, error) {
+	keys := make([]string, users)
+	jobs := make(chan int64)
+	var failed uint64
+	var wg sync.WaitGroup
+	wg.Add(max(concurrency, 1))
+	for i := 0; i < max(concurrency, 1); i++ {
+		go func() {
+			defer wg.Done()
+			for offset := range jobs {
+				userID := userStart + offset
+				created, err := admin.CreateCustomer(ctx, client.CreateCustomerRequest{CustomerID: userID, KeyName: name})
+				key := created.Key.Key
+				if client.IsStatus(err, http.StatusConflict) {
+					var issued client.IssuedKey
+					issued, err = admin.CreateCustomerKey(ctx, userID, name)
+					key = issued.Key
+				}
+				if err != nil || key == "" {
+					atomic.AddUint64(&failed, 1)
+					continue
+				}
+				keys[offset] = key
+			}
+		}()
+	}
+	for i := int64(0); i < users; i++ {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	if n := atomic.LoadUint64(&failed); n > 0 {
+		return nil, fmt.Errorf("key provisioning failures: %d", n)
+	}
+	return keys, nil
+}
+
 func buildDSNFromEnv() string {
 	user := getenvDefault("DB_USER_NAME", "sms_user")
 	pass := getenvDefault("DB_PASSWORD", "sms_pass")
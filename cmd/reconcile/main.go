@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"sms-gateway/app"
+	"sms-gateway/config"
+	"sms-gateway/internal/reconcile"
+)
+
+// Runs one balance reconciliation (or approves a drift) and exits.
+//
+//	go run ./cmd/reconcile                          # run and print the drifts found
+//	go run ./cmd/reconcile -approve 12 -actor alice # write the correction for drift 12
+func main() {
+	var (
+		batch   = flag.Int("batch", 0, "users per batch (default RECONCILE_BATCH_SIZE)")
+		approve = flag.Int64("approve", 0, "approve the correction of this drift ID instead of running")
+		actor   = flag.String("actor", "", "who approves the correction (required with -approve)")
+	)
+	flag.Parse()
+
+	app.InitCLI()
+	defer app.Shutdown()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	if err := run(ctx, *batch, *approve, *actor); err != nil {
+		fmt.Fprintln(os.Stderr, "reconcile:", err)
+		app.Shutdown()
+		os.Exit(1)
+	}
+}
+
+func run(ctx context.Context, batch int, approve int64, actor string) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+
+	if approve != 0 {
+		if actor == "" {
+			return fmt.Errorf("-actor is required with -approve")
+		}
+		d, err := reconcile.ApproveDrift(ctx, approve, actor)
+		if err != nil {
+			return err
+		}
+		return enc.Encode(d)
+	}
+
+	if batch <= 0 {
+		batch = config.ReconcileBatchSize
+	}
+	r, err := reconcile.Reconcile(ctx, reconcile.TriggerCLI, batch)
+	if err != nil {
+		return err
+	}
+	drifts, err := reconcile.ListDrifts(ctx, r.ID)
+	if err != nil {
+		return err
+	}
+	return enc.Encode(map[string]any{"run": r, "drifts": drifts})
+}
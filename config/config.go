@@ -23,11 +23,80 @@ var (
 	DBMaxOpenConns       int
 	DBMaxIdleConns       int
 	DBConnMaxLifetimeSec int
+
+	// gRPC API, served only when set
+	GRPCListenAddr string
+
+	// Idempotency keys
+	IdempotencyKeyTTLSec int
+
+	// Status stream
+	StatusExchange          string
+	StatusEventRetentionSec int
+
+	// Kannel compatibility
+	KannelDLRTimeoutSec       int
+	KannelMessageRetentionSec int
+
+	// SMPP server, served only when set
+	SMPPListenAddr   string
+	SMPPRetentionSec int
+
+	// Admin
+	AdminBootstrapKey string
+
+	// Content policy
+	ContentRulesCacheTTLSec  int
+	ContentUnlistedURLAction string
+
+	// Priority
+	NormalDefaultPriority  int
+	ExpressDefaultPriority int
+	ConsumerPrefetch       int
+
+	// Pricing
+	PricingCacheTTLSec int
+
+	// Billing holds
+	HoldTTLSec         int
+	ReviewHoldTTLSec   int
+	HoldExpiryCheckSec int
+
+	// Postpaid
+	CreditSoftLimitPercent int
+
+	// Sharded balances
+	ShardRebalanceIntervalSec int
+
+	// Balance notifications
+	BalanceEventsWebhookURL string
+	NotifyWebhookTimeoutSec int
+
+	// Reconciliation
+	ReconcileIntervalSec int
+	ReconcileBatchSize   int
+
+	// Usage reporting
+	UsageRollupIntervalSec int
+	UsageRollupBatchSize   int
+
+	// Invoicing
+	InvoiceIntervalSec int
+
+	// OTP
+	OTPSecret            string
+	OTPLength            int
+	OTPTTLSec            int
+	OTPMaxAttempts       int
+	OTPResendCooldownSec int
+	OTPDefaultTemplate   string
 )
 
 func Init() {
 	AppName = env.Default("APP_NAME", "sms-gateway")
 	AppListenAddr = env.RequiredNotEmpty("LISTEN_ADDR")
+	GRPCListenAddr = env.Default("GRPC_LISTEN_ADDR", "")
+	IdempotencyKeyTTLSec = env.DefaultInt("IDEMPOTENCY_KEY_TTL_SEC", 86400)
 	DBUsername = env.RequiredNotEmpty("DB_USER_NAME")
 	DBPassword = env.RequiredNotEmpty("DB_PASSWORD")
 	DBHost = env.RequiredNotEmpty("DB_HOST")
@@ -41,8 +110,54 @@ func Init() {
 	SmsExchange = env.RequiredNotEmpty("RABBIT_SMS_EXCHANGE")
 	ExpressQueue = env.RequiredNotEmpty("EXPRESS_QUEUE")
 	NormalQueue = env.RequiredNotEmpty("NORMAL_QUEUE")
+	StatusExchange = env.Default("RABBIT_STATUS_EXCHANGE", "sms.status")
+	StatusEventRetentionSec = env.DefaultInt("STATUS_EVENT_RETENTION_SEC", 86400)
 
 	DBMaxOpenConns = env.DefaultInt("DB_MAX_OPEN_CONNS", 50)
 	DBMaxIdleConns = env.DefaultInt("DB_MAX_IDLE_CONNS", 25)
 	DBConnMaxLifetimeSec = env.DefaultInt("DB_CONN_MAX_LIFETIME_SEC", 300)
+
+	AdminBootstrapKey = env.Default("ADMIN_BOOTSTRAP_KEY", "")
+
+	KannelDLRTimeoutSec = env.DefaultInt("KANNEL_DLR_TIMEOUT_SEC", 5)
+	KannelMessageRetentionSec = env.DefaultInt("KANNEL_MESSAGE_RETENTION_SEC", 14*86400)
+
+	SMPPListenAddr = env.Default("SMPP_LISTEN_ADDR", "")
+	SMPPRetentionSec = env.DefaultInt("SMPP_RETENTION_SEC", 14*86400)
+
+	ContentRulesCacheTTLSec = env.DefaultInt("CONTENT_RULES_CACHE_TTL_SEC", 30)
+	ContentUnlistedURLAction = env.Default("CONTENT_UNLISTED_URL_ACTION", "allow")
+
+	NormalDefaultPriority = env.DefaultInt("NORMAL_DEFAULT_PRIORITY", 2)
+	ExpressDefaultPriority = env.DefaultInt("EXPRESS_DEFAULT_PRIORITY", 7)
+	ConsumerPrefetch = env.DefaultInt("CONSUMER_PREFETCH", 50)
+
+	PricingCacheTTLSec = env.DefaultInt("PRICING_CACHE_TTL_SEC", 30)
+
+	HoldTTLSec = env.DefaultInt("HOLD_TTL_SEC", 86400)
+	ReviewHoldTTLSec = env.DefaultInt("REVIEW_HOLD_TTL_SEC", 7*86400)
+	HoldExpiryCheckSec = env.DefaultInt("HOLD_EXPIRY_CHECK_SEC", 60)
+
+	CreditSoftLimitPercent = env.DefaultInt("CREDIT_SOFT_LIMIT_PERCENT", 80)
+
+	ShardRebalanceIntervalSec = env.DefaultInt("SHARD_REBALANCE_INTERVAL_SEC", 5)
+
+	BalanceEventsWebhookURL = env.Default("BALANCE_EVENTS_WEBHOOK_URL", "")
+	NotifyWebhookTimeoutSec = env.DefaultInt("NOTIFY_WEBHOOK_TIMEOUT_SEC", 5)
+
+	ReconcileIntervalSec = env.DefaultInt("RECONCILE_INTERVAL_SEC", 3600)
+	ReconcileBatchSize = env.DefaultInt("RECONCILE_BATCH_SIZE", 500)
+
+	UsageRollupIntervalSec = env.DefaultInt("USAGE_ROLLUP_INTERVAL_SEC", 10)
+	UsageRollupBatchSize = env.DefaultInt("USAGE_ROLLUP_BATCH_SIZE", 1000)
+
+	InvoiceIntervalSec = env.DefaultInt("INVOICE_INTERVAL_SEC", 3600)
+
+	// Codes are hashed with it; an empty key would let a leaked otp_codes table be brute-forced.
+	OTPSecret = env.RequiredNotEmpty("OTP_SECRET")
+	OTPLength = env.DefaultInt("OTP_LENGTH", 6)
+	OTPTTLSec = env.DefaultInt("OTP_TTL_SEC", 120)
+	OTPMaxAttempts = env.DefaultInt("OTP_MAX_ATTEMPTS", 5)
+	OTPResendCooldownSec = env.DefaultInt("OTP_RESEND_COOLDOWN_SEC", 60)
+	OTPDefaultTemplate = env.Default("OTP_DEFAULT_TEMPLATE", "Your verification code is {code}")
 }
@@ -1,11 +1,83 @@
+CREATE TABLE customers (
+    id BIGINT PRIMARY KEY,
+    name VARCHAR(255) NOT NULL DEFAULT '',
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+) ENGINE=InnoDB;
+
+CREATE TABLE api_keys (
+    id BIGINT PRIMARY KEY AUTO_INCREMENT,
+    customer_id BIGINT NOT NULL,
+    name VARCHAR(100) NOT NULL DEFAULT '',
+    prefix VARCHAR(20) NOT NULL,
+    key_hash CHAR(64) NOT NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_used_at DATETIME NULL,
+    expires_at DATETIME NULL,
+    revoked_at DATETIME NULL,
+    UNIQUE KEY uq_api_keys_hash (key_hash),
+    INDEX idx_api_keys_customer (customer_id)
+) ENGINE=InnoDB;
+
+CREATE TABLE admin_keys (
+    id BIGINT PRIMARY KEY AUTO_INCREMENT,
+    name VARCHAR(100) NOT NULL,
+    prefix VARCHAR(20) NOT NULL,
+    key_hash CHAR(64) NOT NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_used_at DATETIME NULL,
+    revoked_at DATETIME NULL,
+    UNIQUE KEY uq_admin_keys_hash (key_hash)
+) ENGINE=InnoDB;
+
+CREATE TABLE admin_audit_log (
+    id BIGINT PRIMARY KEY AUTO_INCREMENT,
+    admin_key_id BIGINT NOT NULL,
+    actor VARCHAR(100) NOT NULL,
+    method VARCHAR(10) NOT NULL,
+    route VARCHAR(255) NOT NULL,
+    path VARCHAR(2048) NOT NULL,
+    payload TEXT NULL,
+    ip VARCHAR(45) NOT NULL DEFAULT '',
+    status INT NOT NULL,
+    error VARCHAR(255) NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_admin_audit_log_actor (actor, id),
+    INDEX idx_admin_audit_log_created (created_at)
+) ENGINE=InnoDB;
+
+CREATE TABLE idempotency_keys (
+    customer_id BIGINT NOT NULL,
+    idem_key VARCHAR(255) NOT NULL,
+    request_hash CHAR(64) NOT NULL,
+    status_code INT NULL,
+    content_type VARCHAR(255) NULL,
+    response MEDIUMBLOB NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (customer_id, idem_key),
+    INDEX idx_idempotency_keys_created (created_at)
+) ENGINE=InnoDB;
+
 CREATE TABLE user_balances (
     id BIGINT PRIMARY KEY AUTO_INCREMENT,
     user_id BIGINT NOT NULL,
     balance BIGINT NOT NULL DEFAULT 0,
+    held BIGINT NOT NULL DEFAULT 0,
+    account_mode VARCHAR(20) NOT NULL DEFAULT 'prepaid',
+    credit_limit BIGINT NOT NULL DEFAULT 0,
+    credit_soft_limit BIGINT NULL,
+    shards INT NOT NULL DEFAULT 0,
     last_updated DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
     UNIQUE KEY uq_user_balances_user_id (user_id)
 ) ENGINE=InnoDB;
 
+CREATE TABLE balance_shards (
+    user_id BIGINT NOT NULL,
+    shard INT NOT NULL,
+    balance BIGINT NOT NULL DEFAULT 0,
+    held BIGINT NOT NULL DEFAULT 0,
+    PRIMARY KEY (user_id, shard)
+) ENGINE=InnoDB;
+
 CREATE TABLE user_transactions (
     id BIGINT PRIMARY KEY AUTO_INCREMENT,
     user_id BIGINT NOT NULL,
@@ -13,9 +85,15 @@ CREATE TABLE user_transactions (
     transaction_type VARCHAR(50) NOT NULL,
     description TEXT,
     transaction_id VARCHAR(50) NOT NULL,
+    reference_id VARCHAR(50) NULL,
+    price_version VARCHAR(255) NULL,
+    payment_source VARCHAR(50) NULL,
+    payment_reference VARCHAR(100) NULL,
     created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
     UNIQUE KEY uq_user_transactions_transaction_id (transaction_id),
-    INDEX idx_user_transactions_user_id (user_id, created_at)
+    UNIQUE KEY uq_user_transactions_payment (payment_source, payment_reference),
+    INDEX idx_user_transactions_user_id (user_id, created_at),
+    INDEX idx_user_transactions_reference_id (reference_id)
 ) ENGINE=InnoDB;
 
 CREATE TABLE sms_status (
@@ -33,10 +111,82 @@ CREATE TABLE sms_status (
     INDEX idx_sms_status_user_status_created (user_id, status, created_at)
 ) ENGINE=InnoDB;
 
+CREATE TABLE sms_status_events (
+    id BIGINT PRIMARY KEY AUTO_INCREMENT,
+    customer_id BIGINT NOT NULL,
+    sms_identifier VARCHAR(50) NOT NULL,
+    recipients JSON NOT NULL,
+    status VARCHAR(50) NOT NULL,
+    provider VARCHAR(50) NOT NULL DEFAULT '',
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_sms_status_events_customer (customer_id, id),
+    INDEX idx_sms_status_events_created (created_at)
+) ENGINE=InnoDB;
+
+CREATE TABLE kannel_messages (
+    sms_identifier VARCHAR(50) PRIMARY KEY,
+    customer_id BIGINT NOT NULL,
+    sender VARCHAR(32) NOT NULL DEFAULT '',
+    dlr_url TEXT NOT NULL,
+    dlr_mask INT NOT NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_kannel_messages_created (created_at)
+) ENGINE=InnoDB;
+
+CREATE TABLE kannel_dlr_cursor (
+    id INT PRIMARY KEY,
+    last_event_id BIGINT NOT NULL
+) ENGINE=InnoDB;
+
+CREATE TABLE smpp_accounts (
+    system_id VARCHAR(16) PRIMARY KEY,
+    customer_id BIGINT NOT NULL,
+    password_salt CHAR(32) NOT NULL,
+    password_hash CHAR(64) NOT NULL,
+    max_tps INT NOT NULL,
+    window_size INT NOT NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    INDEX idx_smpp_accounts_customer (customer_id)
+) ENGINE=InnoDB;
+
+CREATE TABLE smpp_messages (
+    sms_identifier VARCHAR(50) PRIMARY KEY,
+    customer_id BIGINT NOT NULL,
+    system_id VARCHAR(16) NOT NULL,
+    source_addr VARCHAR(21) NOT NULL DEFAULT '',
+    registered_delivery INT NOT NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_smpp_messages_created (created_at)
+) ENGINE=InnoDB;
+
+CREATE TABLE smpp_receipt_cursor (
+    id INT PRIMARY KEY,
+    last_event_id BIGINT NOT NULL
+) ENGINE=InnoDB;
+
+CREATE TABLE smpp_receipts (
+    id BIGINT PRIMARY KEY AUTO_INCREMENT,
+    event_id BIGINT NOT NULL,
+    system_id VARCHAR(16) NOT NULL,
+    sms_identifier VARCHAR(50) NOT NULL,
+    recipient VARCHAR(20) NOT NULL,
+    source_addr VARCHAR(21) NOT NULL DEFAULT '',
+    status VARCHAR(50) NOT NULL,
+    submitted_at DATETIME NOT NULL,
+    done_at DATETIME NOT NULL,
+    attempts INT NOT NULL DEFAULT 0,
+    next_run_at DATETIME NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE KEY uq_smpp_receipts_event (event_id, recipient),
+    INDEX idx_smpp_receipts_system (system_id, id),
+    INDEX idx_smpp_receipts_created (created_at)
+) ENGINE=InnoDB;
+
 CREATE TABLE outbox_events (
     id BIGINT PRIMARY KEY AUTO_INCREMENT,
     aggregate_type VARCHAR(50) NOT NULL,
-    aggregate_id VARCHAR(50) NOT NULL,
+    aggregate_id VARCHAR(100) NOT NULL,
     event_type VARCHAR(100) NOT NULL,
     payload JSON NOT NULL,
     priority INT NOT NULL DEFAULT 0,
@@ -50,6 +200,274 @@ CREATE TABLE outbox_events (
     INDEX idx_outbox_pending (status, priority, next_run_at, created_at)
 ) ENGINE=InnoDB;
 
+CREATE TABLE content_rules (
+    id BIGINT PRIMARY KEY AUTO_INCREMENT,
+    customer_id BIGINT NOT NULL DEFAULT 0,
+    kind VARCHAR(20) NOT NULL,
+    pattern VARCHAR(500) NOT NULL,
+    action VARCHAR(20) NOT NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_content_rules_customer (customer_id)
+) ENGINE=InnoDB;
+
+CREATE TABLE held_messages (
+    id BIGINT PRIMARY KEY AUTO_INCREMENT,
+    sms_identifier VARCHAR(50) NOT NULL,
+    customer_id BIGINT NOT NULL,
+    transaction_id VARCHAR(50) NOT NULL,
+    payload JSON NOT NULL,
+    rule_id BIGINT NOT NULL DEFAULT 0,
+    reason TEXT,
+    status VARCHAR(20) NOT NULL DEFAULT 'held',
+    reviewed_at DATETIME NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE KEY uq_held_messages_sms_identifier (sms_identifier),
+    INDEX idx_held_messages_status_created (status, created_at),
+    INDEX idx_held_messages_transaction (transaction_id, status)
+) ENGINE=InnoDB;
+
+CREATE TABLE otp_codes (
+    id BIGINT PRIMARY KEY AUTO_INCREMENT,
+    customer_id BIGINT NOT NULL,
+    recipient VARCHAR(20) NOT NULL,
+    code_salt CHAR(32) NOT NULL DEFAULT '',
+    code_hash CHAR(64) NOT NULL DEFAULT '',
+    sms_identifier VARCHAR(50) NOT NULL DEFAULT '',
+    attempts INT NOT NULL DEFAULT 0,
+    max_attempts INT NOT NULL DEFAULT 0,
+    expires_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_sent_at DATETIME NULL,
+    verified_at DATETIME NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    UNIQUE KEY uq_otp_codes_customer_recipient (customer_id, recipient)
+) ENGINE=InnoDB;
+
+CREATE TABLE priority_limits (
+    customer_id BIGINT PRIMARY KEY,
+    min_priority INT NOT NULL DEFAULT 0,
+    max_priority INT NOT NULL DEFAULT 0,
+    updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP
+) ENGINE=InnoDB;
+
+CREATE TABLE send_limits (
+    customer_id BIGINT PRIMARY KEY,
+    daily_quota BIGINT NOT NULL DEFAULT 0,
+    monthly_quota BIGINT NOT NULL DEFAULT 0,
+    requests_per_sec INT NOT NULL DEFAULT 0,
+    recipients_per_sec INT NOT NULL DEFAULT 0,
+    day_start DATE NULL,
+    day_used BIGINT NOT NULL DEFAULT 0,
+    month_start DATE NULL,
+    month_used BIGINT NOT NULL DEFAULT 0,
+    window_start BIGINT NOT NULL DEFAULT 0,
+    window_requests INT NOT NULL DEFAULT 0,
+    window_recipients INT NOT NULL DEFAULT 0,
+    updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP
+) ENGINE=InnoDB;
+
+CREATE TABLE prices (
+    id BIGINT PRIMARY KEY AUTO_INCREMENT,
+    customer_id BIGINT NOT NULL DEFAULT 0,
+    type VARCHAR(50) NOT NULL,
+    destination_prefix VARCHAR(20) NOT NULL DEFAULT '',
+    min_volume INT NOT NULL DEFAULT 0,
+    price BIGINT NOT NULL,
+    effective_from DATETIME NOT NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_prices_customer_type (customer_id, type)
+) ENGINE=InnoDB;
+
+CREATE TABLE balance_holds (
+    id BIGINT PRIMARY KEY AUTO_INCREMENT,
+    transaction_id VARCHAR(50) NOT NULL,
+    user_id BIGINT NOT NULL,
+    customer_id BIGINT NOT NULL DEFAULT 0,
+    sms_identifier VARCHAR(50) NOT NULL DEFAULT '',
+    recipient VARCHAR(20) NOT NULL DEFAULT '',
+    type VARCHAR(50) NOT NULL,
+    destination_prefix VARCHAR(20) NOT NULL DEFAULT '',
+    price_version VARCHAR(50) NOT NULL DEFAULT '',
+    amount BIGINT NOT NULL,
+    shard INT NOT NULL DEFAULT 0,
+    status VARCHAR(20) NOT NULL DEFAULT 'held',
+    expires_at DATETIME NOT NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    INDEX idx_balance_holds_transaction (transaction_id, recipient),
+    INDEX idx_balance_holds_status_expires (status, expires_at),
+    INDEX idx_balance_holds_user_status (user_id, status),
+    INDEX idx_balance_holds_customer_status (customer_id, status, updated_at),
+    INDEX idx_balance_holds_user_status_updated (user_id, status, updated_at)
+) ENGINE=InnoDB;
+
+CREATE TABLE refunds (
+    id BIGINT PRIMARY KEY AUTO_INCREMENT,
+    user_id BIGINT NOT NULL,
+    original_transaction_id VARCHAR(50) NOT NULL,
+    refund_transaction_id VARCHAR(50) NOT NULL,
+    amount BIGINT NOT NULL,
+    refund_key VARCHAR(100) NOT NULL,
+    reason VARCHAR(255) NOT NULL DEFAULT '',
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE KEY uq_refunds_original_key (original_transaction_id, refund_key),
+    UNIQUE KEY uq_refunds_refund_transaction (refund_transaction_id)
+) ENGINE=InnoDB;
+
+CREATE TABLE account_limit_audit (
+    id BIGINT PRIMARY KEY AUTO_INCREMENT,
+    user_id BIGINT NOT NULL,
+    old_account_mode VARCHAR(20) NOT NULL,
+    new_account_mode VARCHAR(20) NOT NULL,
+    old_credit_limit BIGINT NOT NULL,
+    new_credit_limit BIGINT NOT NULL,
+    old_credit_soft_limit BIGINT NULL,
+    new_credit_soft_limit BIGINT NULL,
+    actor VARCHAR(100) NOT NULL DEFAULT '',
+    reason VARCHAR(255) NOT NULL DEFAULT '',
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_account_limit_audit_user (user_id, created_at)
+) ENGINE=InnoDB;
+
+CREATE TABLE low_balance_alerts (
+    id BIGINT PRIMARY KEY AUTO_INCREMENT,
+    user_id BIGINT NOT NULL,
+    threshold BIGINT NOT NULL,
+    webhook_url VARCHAR(2048) NULL,
+    contact_number VARCHAR(20) NULL,
+    armed TINYINT(1) NOT NULL DEFAULT 1,
+    last_fired_at DATETIME NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    UNIQUE KEY uq_low_balance_alerts_user_threshold (user_id, threshold)
+) ENGINE=InnoDB;
+
+CREATE TABLE reconciliation_runs (
+    id BIGINT PRIMARY KEY AUTO_INCREMENT,
+    trigger_source VARCHAR(20) NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'running',
+    users_checked BIGINT NOT NULL DEFAULT 0,
+    drift_count BIGINT NOT NULL DEFAULT 0,
+    drift_total BIGINT NOT NULL DEFAULT 0,
+    error TEXT NULL,
+    started_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    finished_at DATETIME NULL,
+    INDEX idx_reconciliation_runs_started (started_at)
+) ENGINE=InnoDB;
+
+CREATE TABLE reconciliation_drifts (
+    id BIGINT PRIMARY KEY AUTO_INCREMENT,
+    run_id BIGINT NOT NULL,
+    user_id BIGINT NOT NULL,
+    balance BIGINT NOT NULL,
+    transactions_sum BIGINT NOT NULL,
+    drift BIGINT NOT NULL,
+    ledger_sum BIGINT NOT NULL DEFAULT 0,
+    ledger_drift BIGINT NOT NULL DEFAULT 0,
+    status VARCHAR(20) NOT NULL DEFAULT 'open',
+    corrective_transaction_id VARCHAR(50) NULL,
+    approved_by VARCHAR(100) NULL,
+    resolved_at DATETIME NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_reconciliation_drifts_run (run_id),
+    INDEX idx_reconciliation_drifts_status (status, user_id)
+) ENGINE=InnoDB;
+
+CREATE TABLE ledger_accounts (
+    id BIGINT PRIMARY KEY AUTO_INCREMENT,
+    code VARCHAR(100) NOT NULL,
+    kind VARCHAR(20) NOT NULL,
+    user_id BIGINT NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE KEY uq_ledger_accounts_code (code)
+) ENGINE=InnoDB;
+
+CREATE TABLE ledger_journals (
+    id BIGINT PRIMARY KEY AUTO_INCREMENT,
+    journal_type VARCHAR(20) NOT NULL,
+    reference_id VARCHAR(50) NOT NULL,
+    user_id BIGINT NOT NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE KEY uq_ledger_journals_type_reference (journal_type, reference_id),
+    INDEX idx_ledger_journals_reference (reference_id)
+) ENGINE=InnoDB;
+
+CREATE TABLE ledger_entries (
+    id BIGINT PRIMARY KEY AUTO_INCREMENT,
+    journal_id BIGINT NOT NULL,
+    account_id BIGINT NOT NULL,
+    amount BIGINT NOT NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_ledger_entries_journal (journal_id),
+    INDEX idx_ledger_entries_account (account_id, amount)
+) ENGINE=InnoDB;
+
+CREATE TABLE sub_accounts (
+    child_id BIGINT PRIMARY KEY,
+    parent_id BIGINT NOT NULL,
+    name VARCHAR(100) NOT NULL DEFAULT '',
+    charge_parent TINYINT(1) NOT NULL DEFAULT 0,
+    created_by_parent TINYINT(1) NOT NULL DEFAULT 0,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    INDEX idx_sub_accounts_parent (parent_id)
+) ENGINE=InnoDB;
+
+CREATE TABLE usage_deltas (
+    id BIGINT PRIMARY KEY AUTO_INCREMENT,
+    day DATE NOT NULL,
+    user_id BIGINT NOT NULL,
+    type VARCHAR(50) NOT NULL,
+    provider VARCHAR(50) NOT NULL DEFAULT '',
+    status VARCHAR(50) NOT NULL,
+    messages BIGINT NOT NULL
+) ENGINE=InnoDB;
+
+CREATE TABLE usage_daily (
+    day DATE NOT NULL,
+    user_id BIGINT NOT NULL,
+    type VARCHAR(50) NOT NULL,
+    provider VARCHAR(50) NOT NULL DEFAULT '',
+    status VARCHAR(50) NOT NULL,
+    messages BIGINT NOT NULL DEFAULT 0,
+    updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, day, type, provider, status),
+    INDEX idx_usage_daily_day (day)
+) ENGINE=InnoDB;
+
+CREATE TABLE invoice_sequences (
+    year INT PRIMARY KEY,
+    last_value BIGINT NOT NULL
+) ENGINE=InnoDB;
+
+CREATE TABLE invoices (
+    id BIGINT PRIMARY KEY AUTO_INCREMENT,
+    invoice_number VARCHAR(30) NOT NULL,
+    user_id BIGINT NOT NULL,
+    period CHAR(7) NOT NULL,
+    period_start DATETIME NOT NULL,
+    period_end DATETIME NOT NULL,
+    charges BIGINT NOT NULL,
+    refunds BIGINT NOT NULL,
+    total BIGINT NOT NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE KEY uq_invoices_number (invoice_number),
+    UNIQUE KEY uq_invoices_user_period (user_id, period)
+) ENGINE=InnoDB;
+
+CREATE TABLE invoice_lines (
+    id BIGINT PRIMARY KEY AUTO_INCREMENT,
+    invoice_id BIGINT NOT NULL,
+    line_no INT NOT NULL,
+    kind VARCHAR(20) NOT NULL,
+    type VARCHAR(50) NOT NULL DEFAULT '',
+    destination_prefix VARCHAR(20) NOT NULL DEFAULT '',
+    unit_price BIGINT NOT NULL,
+    quantity BIGINT NOT NULL,
+    amount BIGINT NOT NULL,
+    UNIQUE KEY uq_invoice_lines_invoice_line (invoice_id, line_no)
+) ENGINE=InnoDB;
+
 # truncate table sms_status
 # truncate table user_transactions
 # truncate table user_balances
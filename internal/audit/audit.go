@@ -0,0 +1,132 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"sms-gateway/app"
+	"sms-gateway/pkg/metrics"
+)
+
+// maxPayloadBytes caps the request body kept per entry; longer bodies are cut.
+const maxPayloadBytes = 16 << 10
+
+const (
+	maxPathLen  = 2048
+	maxErrorLen = 255
+)
+
+const (
+	defaultListLimit = 100
+	maxListLimit     = 1000
+)
+
+var ErrInvalidQuery = errors.New("invalid audit query")
+
+// Entry is one admin request. The log is append-only: this package has no way to change or
+// delete an entry.
+type Entry struct {
+	ID         int64     `db:"id" json:"id"`
+	AdminKeyID int64     `db:"admin_key_id" json:"admin_key_id"`
+	Actor      string    `db:"actor" json:"actor"`
+	Method     string    `db:"method" json:"method"`
+	Route      string    `db:"route" json:"route"`
+	Path       string    `db:"path" json:"path"`
+	Payload    *string   `db:"payload" json:"payload,omitempty"`
+	IP         string    `db:"ip" json:"ip"`
+	Status     int       `db:"status" json:"status"`
+	Error      *string   `db:"error" json:"error,omitempty"`
+	CreatedAt  time.Time `db:"created_at" json:"created_at"`
+}
+
+// Query filters List. Zero fields match everything; BeforeID pages backwards from the
+// previous page's last id.
+type Query struct {
+	Actor    string
+	Route    string
+	From     time.Time
+	To       time.Time
+	BeforeID int64
+	Limit    int
+}
+
+// Record appends e to the log.
+func Record(ctx context.Context, e Entry) error {
+	e.Payload = truncate(e.Payload, maxPayloadBytes)
+	e.Error = truncate(e.Error, maxErrorLen)
+	if len(e.Path) > maxPathLen {
+		e.Path = *truncate(&e.Path, maxPathLen)
+	}
+
+	const q = `
+		INSERT INTO admin_audit_log (admin_key_id, actor, method, route, path, payload, ip, status, error)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+	execFn := metrics.DBExecObserver("insert_admin_audit_log", func(c context.Context) error {
+		_, err := app.DB.ExecContext(c, q, e.AdminKeyID, e.Actor, e.Method, e.Route, e.Path, e.Payload, e.IP, e.Status, e.Error)
+		return err
+	})
+	return execFn(ctx)
+}
+
+// List returns matching entries, newest first.
+func List(ctx context.Context, q Query) ([]Entry, error) {
+	if q.Limit == 0 {
+		q.Limit = defaultListLimit
+	}
+	if q.Limit < 0 || q.Limit > maxListLimit || q.BeforeID < 0 {
+		return nil, ErrInvalidQuery
+	}
+
+	var (
+		where []string
+		args  []any
+	)
+	if q.Actor != "" {
+		where = append(where, "actor = ?")
+		args = append(args, q.Actor)
+	}
+	if q.Route != "" {
+		where = append(where, "route = ?")
+		args = append(args, q.Route)
+	}
+	if !q.From.IsZero() {
+		where = append(where, "created_at >= ?")
+		args = append(args, q.From)
+	}
+	if !q.To.IsZero() {
+		where = append(where, "created_at < ?")
+		args = append(args, q.To)
+	}
+	if q.BeforeID > 0 {
+		where = append(where, "id < ?")
+		args = append(args, q.BeforeID)
+	}
+
+	query := `SELECT id, admin_key_id, actor, method, route, path, payload, ip, status, error, created_at FROM admin_audit_log`
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY id DESC LIMIT ?"
+	args = append(args, q.Limit)
+
+	out := []Entry{}
+	queryFn := metrics.DBExecObserver("select_admin_audit_log", func(c context.Context) error {
+		return app.DB.SelectContext(c, &out, query, args...)
+	})
+	if err := queryFn(ctx); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// truncate cuts s to at most n bytes without splitting a UTF-8 sequence.
+func truncate(s *string, n int) *string {
+	if s == nil || len(*s) <= n {
+		return s
+	}
+	cut := strings.ToValidUTF8((*s)[:n], "")
+	return &cut
+}
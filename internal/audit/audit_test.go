@@ -0,0 +1,92 @@
+package audit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"sms-gateway/internal/auth"
+	"sms-gateway/testutil"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestTruncate(t *testing.T) {
+	s := "ab" + strings.Repeat("é", 3)
+	if got := *truncate(&s, 3); got != "ab" {
+		t.Fatalf("expected cut before a split rune, got %q", got)
+	}
+	if got := *truncate(&s, 100); got != s {
+		t.Fatalf("expected short string unchanged, got %q", got)
+	}
+	if truncate(nil, 3) != nil {
+		t.Fatalf("expected nil to stay nil")
+	}
+}
+
+func TestMiddlewareRecordsAdminActions(t *testing.T) {
+	ctx := testutil.EnsureSetup(t)
+	testutil.ResetTables(ctx, t)
+
+	key, err := auth.CreateAdminKey(ctx, "ops")
+	if err != nil {
+		t.Fatalf("create admin key: %v", err)
+	}
+
+	e := echo.New()
+	admin := e.Group("", auth.AdminMiddleware, Middleware)
+	admin.POST("/balance/add", func(c echo.Context) error {
+		var body map[string]any
+		if err := c.Bind(&body); err != nil || body["user_id"] == nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid input")
+		}
+		return c.JSON(http.StatusOK, "done")
+	})
+	admin.GET("/admin/keys", func(c echo.Context) error { return c.JSON(http.StatusOK, "done") })
+
+	do := func(method, path, body, token string) int {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		req.Header.Set(echo.HeaderXRealIP, "10.0.0.7")
+		if token != "" {
+			req.Header.Set(echo.HeaderAuthorization, "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	if code := do(http.MethodPost, "/balance/add", `{"user_id":1,"balance":100}`, key.Key); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+	if code := do(http.MethodPost, "/balance/add", `{}`, key.Key); code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", code)
+	}
+	if code := do(http.MethodPost, "/balance/add", `{"user_id":1}`, ""); code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without admin key, got %d", code)
+	}
+	if code := do(http.MethodGet, "/admin/keys", "", key.Key); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+
+	entries, err := List(ctx, Query{Actor: "ops"})
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("expected the two authenticated writes, got %d", len(entries))
+	}
+	failed, ok := entries[0], entries[1]
+	if ok.Status != http.StatusOK || ok.Route != "/balance/add" || ok.IP != "10.0.0.7" || ok.AdminKeyID != key.ID ||
+		ok.Payload == nil || *ok.Payload != `{"user_id":1,"balance":100}` || ok.Error != nil {
+		t.Fatalf("unexpected entry %+v", ok)
+	}
+	if failed.Status != http.StatusBadRequest || failed.Error == nil || *failed.Error != "invalid input" {
+		t.Fatalf("unexpected entry %+v", failed)
+	}
+
+	if page, err := List(ctx, Query{BeforeID: failed.ID}); err != nil || len(page) != 1 || page[0].ID != ok.ID {
+		t.Fatalf("expected the older entry before %d, got %+v err=%v", failed.ID, page, err)
+	}
+}
@@ -0,0 +1,81 @@
+package audit
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"sms-gateway/app"
+
+	"github.com/labstack/echo/v4"
+)
+
+// ListHandler godoc
+// @Summary      Admin audit log
+// @Description  Admin requests that changed something, newest first. Page with before_id set to the last id of the previous page
+// @Tags         admin
+// @Produce      json
+// @Security     AdminAuth
+// @Param        actor query string false "Only this admin key name"
+// @Param        route query string false "Only this route, e.g. /balance/add"
+// @Param        from query string false "From (YYYY-MM-DD or RFC3339), inclusive"
+// @Param        to query string false "To (YYYY-MM-DD or RFC3339), exclusive"
+// @Param        before_id query int false "Only entries older than this id"
+// @Param        limit query int false "Max rows (default 100, max 1000)"
+// @Success      200 {object} map[string]any
+// @Failure      400 {object} apierror.Error "invalid input"
+// @Failure      401 {object} apierror.Error "unauthenticated"
+// @Failure      500 {object} apierror.Error "internal error"
+// @Router       /admin/audit-log [get]
+func ListHandler(c echo.Context) error {
+	q := Query{
+		Actor: c.QueryParam("actor"),
+		Route: c.QueryParam("route"),
+	}
+
+	var err error
+	if q.From, err = parseTime(c.QueryParam("from")); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid from")
+	}
+	if q.To, err = parseTime(c.QueryParam("to")); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid to")
+	}
+	if v := c.QueryParam("before_id"); v != "" {
+		if q.BeforeID, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid before_id")
+		}
+	}
+	if v := c.QueryParam("limit"); v != "" {
+		if q.Limit, err = strconv.Atoi(v); err != nil || q.Limit <= 0 {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid limit")
+		}
+	}
+
+	entries, err := List(c.Request().Context(), q)
+	if err != nil {
+		if errors.Is(err, ErrInvalidQuery) {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		app.Logger.Error("list audit log", "err", err)
+		return err
+	}
+
+	out := map[string]any{}
+	out["entries"] = entries
+	if len(entries) > 0 {
+		out["next_before_id"] = entries[len(entries)-1].ID
+	}
+
+	return c.JSON(http.StatusOK, out)
+}
+
+func parseTime(v string) (time.Time, error) {
+	if v == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.ParseInLocation(time.DateOnly, v, time.Local); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, v)
+}
@@ -0,0 +1,77 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"sms-gateway/app"
+	"sms-gateway/internal/auth"
+	"sms-gateway/pkg/metrics"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Middleware records every admin request that changes something (anything but GET and HEAD)
+// with its actor, body, client IP and outcome. It goes behind auth.AdminMiddleware so the actor
+// is known. The entry is written after the handler ran; a failed write is logged and counted
+// but does not fail the request, which has already taken effect.
+func Middleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := c.Request()
+		if req.Method == http.MethodGet || req.Method == http.MethodHead {
+			return next(c)
+		}
+
+		var payload *string
+		if req.Body != nil {
+			body, err := io.ReadAll(req.Body)
+			if err != nil {
+				return echo.NewHTTPError(http.StatusBadRequest, "invalid input")
+			}
+			req.Body = io.NopCloser(bytes.NewReader(body))
+			if len(body) > 0 {
+				p := string(body)
+				payload = &p
+			}
+		}
+
+		err := next(c)
+
+		e := Entry{
+			Method:  req.Method,
+			Route:   strings.TrimPrefix(c.Path(), app.APIVersionPrefix),
+			Path:    req.URL.RequestURI(),
+			Payload: payload,
+			IP:      c.RealIP(),
+		}
+		if k, ok := auth.AdminFrom(req.Context()); ok {
+			e.AdminKeyID, e.Actor = k.ID, k.Name
+		}
+		e.Status, e.Error = outcome(c, err)
+
+		// Record even when the client went away: the action itself may have gone through.
+		if recErr := Record(context.WithoutCancel(req.Context()), e); recErr != nil {
+			metrics.AuditWriteFailed()
+			app.Logger.Error("write audit log", "actor", e.Actor, "method", e.Method, "path", e.Path, "status", e.Status, "err", recErr)
+		}
+		return err
+	}
+}
+
+// outcome returns the status the client gets for err and, for failures, the error message.
+func outcome(c echo.Context, err error) (int, *string) {
+	if err == nil {
+		return c.Response().Status, nil
+	}
+	status, msg := http.StatusInternalServerError, err.Error()
+	var he *echo.HTTPError
+	if errors.As(err, &he) {
+		status, msg = he.Code, fmt.Sprint(he.Message)
+	}
+	return status, &msg
+}
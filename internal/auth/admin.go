@@ -0,0 +1,194 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"sms-gateway/app"
+	"sms-gateway/pkg/metrics"
+)
+
+// AdminKeyPrefix starts every admin key. Admin keys live in their own table and never pass the
+// customer Middleware, nor customer keys the AdminMiddleware.
+const AdminKeyPrefix = "sga_"
+
+// minBootstrapKeyLen keeps an operator-chosen bootstrap key from being guessable.
+const minBootstrapKeyLen = len(AdminKeyPrefix) + 32
+
+var (
+	ErrInvalidAdminName = errors.New("admin key name is required")
+	ErrWeakAdminKey     = errors.New("bootstrap admin key must start with " + AdminKeyPrefix + " and carry at least 32 more characters")
+)
+
+// AdminKey describes an admin key without its secret. Its name is the actor recorded in the
+// audit log.
+type AdminKey struct {
+	ID         int64      `db:"id" json:"id"`
+	Name       string     `db:"name" json:"name"`
+	Prefix     string     `db:"prefix" json:"prefix"`
+	CreatedAt  time.Time  `db:"created_at" json:"created_at"`
+	LastUsedAt *time.Time `db:"last_used_at" json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `db:"revoked_at" json:"revoked_at,omitempty"`
+}
+
+// IssuedAdminKey is a newly created admin key. Key is returned once and cannot be recovered later.
+type IssuedAdminKey struct {
+	AdminKey
+	Key string `json:"key"`
+}
+
+type adminCtxKey struct{}
+
+// WithAdmin returns ctx carrying the authenticated admin key.
+func WithAdmin(ctx context.Context, k AdminKey) context.Context {
+	return context.WithValue(ctx, adminCtxKey{}, k)
+}
+
+// AdminFrom returns the admin key authenticated for ctx, if any.
+func AdminFrom(ctx context.Context) (AdminKey, bool) {
+	k, ok := ctx.Value(adminCtxKey{}).(AdminKey)
+	return k, ok
+}
+
+// NewAdminKey generates a random admin key.
+func NewAdminKey() (string, error) {
+	key, err := NewKey()
+	if err != nil {
+		return "", err
+	}
+	return AdminKeyPrefix + strings.TrimPrefix(key, KeyPrefix), nil
+}
+
+// CreateAdminKey issues a new admin key.
+func CreateAdminKey(ctx context.Context, name string) (IssuedAdminKey, error) {
+	raw, err := NewAdminKey()
+	if err != nil {
+		return IssuedAdminKey{}, err
+	}
+	return insertAdminKey(ctx, name, raw)
+}
+
+// EnsureAdminKey stores key as an admin key unless it is already stored, so a fresh deployment
+// can be given its first admin key through the environment. A revoked key stays revoked.
+func EnsureAdminKey(ctx context.Context, name, key string) error {
+	if !strings.HasPrefix(key, AdminKeyPrefix) || len(key) < minBootstrapKeyLen {
+		return ErrWeakAdminKey
+	}
+
+	var exists bool
+	queryFn := metrics.DBExecObserver("select_admin_key_exists", func(c context.Context) error {
+		return app.DB.GetContext(c, &exists, `SELECT EXISTS(SELECT 1 FROM admin_keys WHERE key_hash = ?)`, HashKey(key))
+	})
+	if err := queryFn(ctx); err != nil {
+		return err
+	}
+	if exists {
+		return nil
+	}
+	_, err := insertAdminKey(ctx, name, key)
+	return err
+}
+
+// RevokeAdminKey disables an admin key immediately.
+func RevokeAdminKey(ctx context.Context, id int64) error {
+	const q = `UPDATE admin_keys SET revoked_at = NOW() WHERE id = ? AND revoked_at IS NULL`
+	var rows int64
+	execFn := metrics.DBExecObserver("update_admin_key_revoked", func(c context.Context) error {
+		res, err := app.DB.ExecContext(c, q, id)
+		if err != nil {
+			return err
+		}
+		rows, err = res.RowsAffected()
+		return err
+	})
+	if err := execFn(ctx); err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrKeyNotFound
+	}
+	return nil
+}
+
+// ListAdminKeys returns all admin keys, revoked ones included, newest first.
+func ListAdminKeys(ctx context.Context) ([]AdminKey, error) {
+	const q = `
+		SELECT id, name, prefix, created_at, last_used_at, revoked_at
+		FROM admin_keys
+		ORDER BY id DESC
+	`
+	out := []AdminKey{}
+	queryFn := metrics.DBExecObserver("select_admin_keys", func(c context.Context) error {
+		return app.DB.SelectContext(c, &out, q)
+	})
+	if err := queryFn(ctx); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// AuthenticateAdmin returns the active admin key matching key, or ErrUnauthenticated.
+func AuthenticateAdmin(ctx context.Context, key string) (AdminKey, error) {
+	if !strings.HasPrefix(key, AdminKeyPrefix) {
+		return AdminKey{}, ErrUnauthenticated
+	}
+
+	var k AdminKey
+	const q = `
+		SELECT id, name, prefix, created_at, last_used_at, revoked_at
+		FROM admin_keys
+		WHERE key_hash = ? AND revoked_at IS NULL
+	`
+	queryFn := metrics.DBExecObserver("select_admin_key_by_hash", func(c context.Context) error {
+		return app.DB.GetContext(c, &k, q, HashKey(key))
+	})
+	if err := queryFn(ctx); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return AdminKey{}, ErrUnauthenticated
+		}
+		return AdminKey{}, err
+	}
+
+	if k.LastUsedAt == nil || time.Since(*k.LastUsedAt) > lastUsedResolution {
+		touchFn := metrics.DBExecObserver("update_admin_key_last_used", func(c context.Context) error {
+			_, err := app.DB.ExecContext(c, `UPDATE admin_keys SET last_used_at = NOW() WHERE id = ?`, k.ID)
+			return err
+		})
+		if err := touchFn(ctx); err != nil {
+			app.Logger.Error("touch admin key", "id", k.ID, "err", err)
+		}
+	}
+	return k, nil
+}
+
+func insertAdminKey(ctx context.Context, name, raw string) (IssuedAdminKey, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return IssuedAdminKey{}, ErrInvalidAdminName
+	}
+
+	var id int64
+	const insertQ = `INSERT INTO admin_keys (name, prefix, key_hash) VALUES (?, ?, ?)`
+	if err := metrics.DBExecObserver("insert_admin_key", func(c context.Context) error {
+		res, err := app.DB.ExecContext(c, insertQ, name, DisplayPrefix(raw), HashKey(raw))
+		if err != nil {
+			return err
+		}
+		id, err = res.LastInsertId()
+		return err
+	})(ctx); err != nil {
+		return IssuedAdminKey{}, err
+	}
+
+	key := IssuedAdminKey{Key: raw}
+	const selectQ = `SELECT id, name, prefix, created_at, last_used_at, revoked_at FROM admin_keys WHERE id = ?`
+	if err := metrics.DBExecObserver("select_admin_key", func(c context.Context) error {
+		return app.DB.GetContext(c, &key.AdminKey, selectQ, id)
+	})(ctx); err != nil {
+		return IssuedAdminKey{}, err
+	}
+	return key, nil
+}
@@ -0,0 +1,341 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"sms-gateway/app"
+	"sms-gateway/pkg/metrics"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jmoiron/sqlx"
+)
+
+// KeyPrefix starts every API key, so leaked keys are easy to recognise and scan for.
+const KeyPrefix = "sgw_"
+
+const displayPrefixLen = len(KeyPrefix) + 8
+
+// lastUsedResolution bounds how often authenticating with a key writes its last_used_at.
+const lastUsedResolution = time.Minute
+
+var (
+	ErrUnauthenticated  = errors.New("invalid api key")
+	ErrInvalidCustomer  = errors.New("invalid customer")
+	ErrCustomerExists   = errors.New("customer already exists")
+	ErrCustomerNotFound = errors.New("customer not found")
+	ErrKeyNotFound      = errors.New("api key not found")
+)
+
+// Customer is an account that can authenticate with API keys. Its id is the user_id of its
+// balance, transactions and messages.
+type Customer struct {
+	ID        int64     `db:"id" json:"id"`
+	Name      string    `db:"name" json:"name"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+}
+
+// APIKey describes a key without its secret; only the SHA-256 of a key is stored.
+type APIKey struct {
+	ID         int64      `db:"id" json:"id"`
+	CustomerID int64      `db:"customer_id" json:"customer_id"`
+	Name       string     `db:"name" json:"name"`
+	Prefix     string     `db:"prefix" json:"prefix"`
+	CreatedAt  time.Time  `db:"created_at" json:"created_at"`
+	LastUsedAt *time.Time `db:"last_used_at" json:"last_used_at,omitempty"`
+	ExpiresAt  *time.Time `db:"expires_at" json:"expires_at,omitempty"`
+	RevokedAt  *time.Time `db:"revoked_at" json:"revoked_at,omitempty"`
+}
+
+// IssuedKey is a newly created key. Key is returned once and cannot be recovered later.
+type IssuedKey struct {
+	APIKey
+	Key string `json:"key"`
+}
+
+type ctxKey struct{}
+
+// WithCustomer returns ctx carrying the authenticated customer.
+func WithCustomer(ctx context.Context, customerID int64) context.Context {
+	return context.WithValue(ctx, ctxKey{}, customerID)
+}
+
+// CustomerFrom returns the customer authenticated for ctx, if any.
+func CustomerFrom(ctx context.Context) (int64, bool) {
+	id, ok := ctx.Value(ctxKey{}).(int64)
+	return id, ok
+}
+
+// NewKey generates a random key. Keys carry 192 bits of entropy, so a plain SHA-256 is enough
+// to store them and allows looking them up by hash.
+func NewKey() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return KeyPrefix + base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// DisplayPrefix returns the part of a key stored in clear to tell keys apart in listings.
+func DisplayPrefix(key string) string {
+	return key[:min(len(key), displayPrefixLen)]
+}
+
+// HashKey returns the stored form of a key.
+func HashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateCustomer creates a customer together with its first API key.
+func CreateCustomer(ctx context.Context, c Customer, keyName string) (_ Customer, _ IssuedKey, err error) {
+	tx, err := app.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return Customer{}, IssuedKey{}, err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	c, key, err := CreateCustomerTx(ctx, tx, c, keyName)
+	if err != nil {
+		return Customer{}, IssuedKey{}, err
+	}
+	if err = tx.Commit(); err != nil {
+		return Customer{}, IssuedKey{}, err
+	}
+	return c, key, nil
+}
+
+// CreateCustomerTx is CreateCustomer inside the caller's transaction.
+func CreateCustomerTx(ctx context.Context, tx *sqlx.Tx, c Customer, keyName string) (Customer, IssuedKey, error) {
+	c.Name = strings.TrimSpace(c.Name)
+	if c.ID <= 0 {
+		return Customer{}, IssuedKey{}, ErrInvalidCustomer
+	}
+
+	const insertQ = `INSERT INTO customers (id, name) VALUES (?, ?)`
+	if err := metrics.DBExecObserver("insert_customer", func(c2 context.Context) error {
+		_, execErr := tx.ExecContext(c2, insertQ, c.ID, c.Name)
+		return execErr
+	})(ctx); err != nil {
+		var me *mysql.MySQLError
+		if errors.As(err, &me) && me.Number == 1062 {
+			err = ErrCustomerExists
+		}
+		return Customer{}, IssuedKey{}, err
+	}
+
+	key, err := insertKeyTx(ctx, tx, c.ID, keyName)
+	if err != nil {
+		return Customer{}, IssuedKey{}, err
+	}
+
+	if err := metrics.DBExecObserver("select_customer", func(c2 context.Context) error {
+		return tx.GetContext(c2, &c, `SELECT id, name, created_at FROM customers WHERE id = ?`, c.ID)
+	})(ctx); err != nil {
+		return Customer{}, IssuedKey{}, err
+	}
+	return c, key, nil
+}
+
+// CreateKey issues a new key for an existing customer.
+func CreateKey(ctx context.Context, customerID int64, name string) (_ IssuedKey, err error) {
+	tx, err := app.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return IssuedKey{}, err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	var exists bool
+	if err = metrics.DBExecObserver("select_customer_exists", func(c context.Context) error {
+		return tx.GetContext(c, &exists, `SELECT EXISTS(SELECT 1 FROM customers WHERE id = ?)`, customerID)
+	})(ctx); err != nil {
+		return IssuedKey{}, err
+	}
+	if !exists {
+		err = ErrCustomerNotFound
+		return IssuedKey{}, err
+	}
+
+	key, err := insertKeyTx(ctx, tx, customerID, name)
+	if err != nil {
+		return IssuedKey{}, err
+	}
+	if err = tx.Commit(); err != nil {
+		return IssuedKey{}, err
+	}
+	return key, nil
+}
+
+// RotateKey issues a replacement for a key under the same name. The old key stops working
+// after grace, or at once when grace is 0, so callers can roll the new key out first.
+func RotateKey(ctx context.Context, customerID, keyID int64, grace time.Duration) (_ IssuedKey, err error) {
+	tx, err := app.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return IssuedKey{}, err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	var old APIKey
+	const selectQ = `
+		SELECT id, customer_id, name, prefix, created_at, last_used_at, expires_at, revoked_at
+		FROM api_keys
+		WHERE id = ? AND customer_id = ? AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > NOW())
+		FOR UPDATE
+	`
+	if err = metrics.DBExecObserver("select_api_key_for_update", func(c context.Context) error {
+		return tx.GetContext(c, &old, selectQ, keyID, customerID)
+	})(ctx); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = ErrKeyNotFound
+		}
+		return IssuedKey{}, err
+	}
+
+	key, err := insertKeyTx(ctx, tx, customerID, old.Name)
+	if err != nil {
+		return IssuedKey{}, err
+	}
+
+	q, args := `UPDATE api_keys SET revoked_at = NOW() WHERE id = ?`, []any{old.ID}
+	if grace > 0 {
+		q = `UPDATE api_keys SET expires_at = LEAST(COALESCE(expires_at, NOW() + INTERVAL ? SECOND), NOW() + INTERVAL ? SECOND) WHERE id = ?`
+		secs := int64(grace / time.Second)
+		args = []any{secs, secs, old.ID}
+	}
+	if err = metrics.DBExecObserver("update_api_key_rotated", func(c context.Context) error {
+		_, execErr := tx.ExecContext(c, q, args...)
+		return execErr
+	})(ctx); err != nil {
+		return IssuedKey{}, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return IssuedKey{}, err
+	}
+	return key, nil
+}
+
+// RevokeKey disables one of the customer's keys immediately.
+func RevokeKey(ctx context.Context, customerID, keyID int64) error {
+	const q = `UPDATE api_keys SET revoked_at = NOW() WHERE id = ? AND customer_id = ? AND revoked_at IS NULL`
+	var rows int64
+	execFn := metrics.DBExecObserver("update_api_key_revoked", func(c context.Context) error {
+		res, err := app.DB.ExecContext(c, q, keyID, customerID)
+		if err != nil {
+			return err
+		}
+		rows, err = res.RowsAffected()
+		return err
+	})
+	if err := execFn(ctx); err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrKeyNotFound
+	}
+	return nil
+}
+
+// ListKeys returns the customer's keys, revoked ones included, newest first.
+func ListKeys(ctx context.Context, customerID int64) ([]APIKey, error) {
+	const q = `
+		SELECT id, customer_id, name, prefix, created_at, last_used_at, expires_at, revoked_at
+		FROM api_keys
+		WHERE customer_id = ?
+		ORDER BY id DESC
+	`
+	out := []APIKey{}
+	queryFn := metrics.DBExecObserver("select_api_keys", func(c context.Context) error {
+		return app.DB.SelectContext(c, &out, q, customerID)
+	})
+	if err := queryFn(ctx); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Authenticate returns the active key matching key, or ErrUnauthenticated.
+func Authenticate(ctx context.Context, key string) (APIKey, error) {
+	if !strings.HasPrefix(key, KeyPrefix) {
+		return APIKey{}, ErrUnauthenticated
+	}
+
+	var k APIKey
+	const q = `
+		SELECT id, customer_id, name, prefix, created_at, last_used_at, expires_at, revoked_at
+		FROM api_keys
+		WHERE key_hash = ? AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > NOW())
+	`
+	queryFn := metrics.DBExecObserver("select_api_key_by_hash", func(c context.Context) error {
+		return app.DB.GetContext(c, &k, q, HashKey(key))
+	})
+	if err := queryFn(ctx); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return APIKey{}, ErrUnauthenticated
+		}
+		return APIKey{}, err
+	}
+
+	if k.LastUsedAt == nil || time.Since(*k.LastUsedAt) > lastUsedResolution {
+		touchFn := metrics.DBExecObserver("update_api_key_last_used", func(c context.Context) error {
+			_, err := app.DB.ExecContext(c, `UPDATE api_keys SET last_used_at = NOW() WHERE id = ?`, k.ID)
+			return err
+		})
+		if err := touchFn(ctx); err != nil {
+			app.Logger.Error("touch api key", "id", k.ID, "err", err)
+		}
+	}
+	return k, nil
+}
+
+func insertKeyTx(ctx context.Context, tx *sqlx.Tx, customerID int64, name string) (IssuedKey, error) {
+	raw, err := NewKey()
+	if err != nil {
+		return IssuedKey{}, err
+	}
+
+	var id int64
+	const insertQ = `INSERT INTO api_keys (customer_id, name, prefix, key_hash) VALUES (?, ?, ?, ?)`
+	if err := metrics.DBExecObserver("insert_api_key", func(c context.Context) error {
+		res, err := tx.ExecContext(c, insertQ, customerID, strings.TrimSpace(name), DisplayPrefix(raw), HashKey(raw))
+		if err != nil {
+			return err
+		}
+		id, err = res.LastInsertId()
+		return err
+	})(ctx); err != nil {
+		return IssuedKey{}, err
+	}
+
+	key := IssuedKey{Key: raw}
+	const selectQ = `
+		SELECT id, customer_id, name, prefix, created_at, last_used_at, expires_at, revoked_at
+		FROM api_keys
+		WHERE id = ?
+	`
+	if err := metrics.DBExecObserver("select_api_key", func(c context.Context) error {
+		return tx.GetContext(c, &key.APIKey, selectQ, id)
+	})(ctx); err != nil {
+		return IssuedKey{}, err
+	}
+	return key, nil
+}
@@ -0,0 +1,182 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"sms-gateway/app"
+	"sms-gateway/testutil"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestBearerToken(t *testing.T) {
+	cases := []struct {
+		header string
+		token  string
+		ok     bool
+	}{
+		{header: "Bearer sgw_abc", token: "sgw_abc", ok: true},
+		{header: "bearer  sgw_abc ", token: "sgw_abc", ok: true},
+		{header: "Basic dXNlcjpwYXNz"},
+		{header: "Bearer "},
+		{header: "sgw_abc"},
+		{header: ""},
+	}
+	for _, tc := range cases {
+		token, ok := BearerToken(tc.header)
+		if ok != tc.ok || token != tc.token {
+			t.Fatalf("%q: got %q %v, want %q %v", tc.header, token, ok, tc.token, tc.ok)
+		}
+	}
+}
+
+func TestNewKey(t *testing.T) {
+	a, err := NewKey()
+	if err != nil {
+		t.Fatalf("new key: %v", err)
+	}
+	b, _ := NewKey()
+	if a == b || !strings.HasPrefix(a, KeyPrefix) || len(a) < displayPrefixLen+16 {
+		t.Fatalf("unexpected keys %q %q", a, b)
+	}
+	if h := HashKey(a); len(h) != 64 || h == HashKey(b) || h != HashKey(a) {
+		t.Fatalf("unexpected hash %q", h)
+	}
+}
+
+func TestMiddlewareRequiresBearer(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/balance?user_id=1", nil)
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(req, rec)
+
+	called := false
+	err := Middleware(func(echo.Context) error { called = true; return nil })(c)
+	var he *echo.HTTPError
+	if !errors.As(err, &he) || he.Code != http.StatusUnauthorized || called {
+		t.Fatalf("expected 401, got %v", err)
+	}
+	if rec.Header().Get(echo.HeaderWWWAuthenticate) == "" {
+		t.Fatalf("expected WWW-Authenticate header")
+	}
+}
+
+func TestKeyLifecycle(t *testing.T) {
+	ctx := testutil.EnsureSetup(t)
+	testutil.ResetTables(ctx, t)
+
+	_, first, err := CreateCustomer(ctx, Customer{ID: 51, Name: "acme"}, "default")
+	if err != nil {
+		t.Fatalf("create customer: %v", err)
+	}
+	if _, _, err := CreateCustomer(ctx, Customer{ID: 51}, ""); !errors.Is(err, ErrCustomerExists) {
+		t.Fatalf("expected existing customer, got %v", err)
+	}
+	if _, err := CreateKey(ctx, 52, "x"); !errors.Is(err, ErrCustomerNotFound) {
+		t.Fatalf("expected unknown customer, got %v", err)
+	}
+	if k, err := Authenticate(ctx, first.Key); err != nil || k.CustomerID != 51 {
+		t.Fatalf("expected first key to authenticate, got %+v err=%v", k, err)
+	}
+
+	// Rotating with a grace period keeps the old key working for now.
+	second, err := RotateKey(ctx, 51, first.ID, time.Hour)
+	if err != nil {
+		t.Fatalf("rotate: %v", err)
+	}
+	if _, err := Authenticate(ctx, first.Key); err != nil {
+		t.Fatalf("expected old key within grace, got %v", err)
+	}
+
+	third, err := RotateKey(ctx, 51, second.ID, 0)
+	if err != nil {
+		t.Fatalf("rotate: %v", err)
+	}
+	if _, err := Authenticate(ctx, second.Key); !errors.Is(err, ErrUnauthenticated) {
+		t.Fatalf("expected rotated key to be rejected, got %v", err)
+	}
+	if third.Name != "default" {
+		t.Fatalf("expected name to carry over, got %q", third.Name)
+	}
+
+	if err := RevokeKey(ctx, 99, third.ID); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("expected other customer's key to be not found, got %v", err)
+	}
+	if err := RevokeKey(ctx, 51, third.ID); err != nil {
+		t.Fatalf("revoke: %v", err)
+	}
+	if _, err := Authenticate(ctx, third.Key); !errors.Is(err, ErrUnauthenticated) {
+		t.Fatalf("expected revoked key to be rejected, got %v", err)
+	}
+
+	keys, err := ListKeys(ctx, 51)
+	if err != nil || len(keys) != 3 {
+		t.Fatalf("expected 3 keys, got %d err=%v", len(keys), err)
+	}
+}
+
+func TestMiddlewareSetsCustomer(t *testing.T) {
+	ctx := testutil.EnsureSetup(t)
+	testutil.ResetTables(ctx, t)
+
+	_, key, err := CreateCustomer(ctx, Customer{ID: 61}, "")
+	if err != nil {
+		t.Fatalf("create customer: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/balance?user_id=1", nil)
+	req.Header.Set(echo.HeaderAuthorization, "Bearer "+key.Key)
+	c := app.Echo.NewContext(req, httptest.NewRecorder())
+
+	var got int64
+	if err := Middleware(func(c echo.Context) error {
+		got, err = CustomerID(c)
+		return err
+	})(c); err != nil {
+		t.Fatalf("middleware: %v", err)
+	}
+	if got != 61 {
+		t.Fatalf("expected customer 61, got %d", got)
+	}
+}
+
+func TestAdminKeys(t *testing.T) {
+	ctx := testutil.EnsureSetup(t)
+	testutil.ResetTables(ctx, t)
+
+	if err := EnsureAdminKey(ctx, "bootstrap", AdminKeyPrefix+"short"); !errors.Is(err, ErrWeakAdminKey) {
+		t.Fatalf("expected weak key to be refused, got %v", err)
+	}
+	bootstrap := AdminKeyPrefix + strings.Repeat("k", 40)
+	for range 2 {
+		if err := EnsureAdminKey(ctx, "bootstrap", bootstrap); err != nil {
+			t.Fatalf("ensure admin key: %v", err)
+		}
+	}
+	if k, err := AuthenticateAdmin(ctx, bootstrap); err != nil || k.Name != "bootstrap" {
+		t.Fatalf("expected bootstrap key to authenticate, got %+v err=%v", k, err)
+	}
+
+	issued, err := CreateAdminKey(ctx, "ops")
+	if err != nil {
+		t.Fatalf("create admin key: %v", err)
+	}
+	if _, err := Authenticate(ctx, issued.Key); !errors.Is(err, ErrUnauthenticated) {
+		t.Fatalf("expected admin key to be rejected as a customer key, got %v", err)
+	}
+	if err := RevokeAdminKey(ctx, issued.ID); err != nil {
+		t.Fatalf("revoke admin key: %v", err)
+	}
+	if _, err := AuthenticateAdmin(ctx, issued.Key); !errors.Is(err, ErrUnauthenticated) {
+		t.Fatalf("expected revoked admin key to be rejected, got %v", err)
+	}
+
+	keys, err := ListAdminKeys(ctx)
+	if err != nil || len(keys) != 2 {
+		t.Fatalf("expected 2 admin keys, got %d err=%v", len(keys), err)
+	}
+}
@@ -0,0 +1,372 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"sms-gateway/app"
+
+	"github.com/labstack/echo/v4"
+)
+
+// CustomerPayload represents the request body for creating a customer.
+type CustomerPayload struct {
+	CustomerID int64  `json:"customer_id"`
+	Name       string `json:"name"`
+	KeyName    string `json:"key_name"`
+}
+
+// KeyPayload represents the request body for creating an API key.
+type KeyPayload struct {
+	Name string `json:"name"`
+}
+
+// RotatePayload represents the request body for rotating an API key.
+type RotatePayload struct {
+	// GraceSec keeps the old key working for this long; 0 revokes it at once.
+	GraceSec int `json:"grace_sec"`
+}
+
+// CreateCustomerHandler godoc
+// @Summary      Create customer
+// @Description  Creates a customer and its first API key. The key is only returned here
+// @Tags         admin
+// @Accept       json
+// @Produce      json
+// @Security     AdminAuth
+// @Param        request body CustomerPayload true "Customer"
+// @Success      200 {object} map[string]any "customer and key"
+// @Failure      400 {object} apierror.Error "invalid input"
+// @Failure      401 {object} apierror.Error "unauthenticated"
+// @Failure      409 {object} apierror.Error "customer already exists"
+// @Failure      500 {object} apierror.Error "internal error"
+// @Router       /admin/customers [post]
+func CreateCustomerHandler(c echo.Context) error {
+	var req CustomerPayload
+	if err := json.NewDecoder(c.Request().Body).Decode(&req); err != nil {
+		app.Logger.Error("invalid input ", "err", err)
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid input")
+	}
+
+	customer, key, err := CreateCustomer(c.Request().Context(), Customer{ID: req.CustomerID, Name: req.Name}, req.KeyName)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrInvalidCustomer):
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		case errors.Is(err, ErrCustomerExists):
+			return echo.NewHTTPError(http.StatusConflict, err.Error())
+		}
+		app.Logger.Error("create customer", "customer_id", req.CustomerID, "err", err)
+		return err
+	}
+
+	out := map[string]any{}
+	out["customer"] = customer
+	out["key"] = key
+
+	return c.JSON(http.StatusOK, out)
+}
+
+// AdminCreateKeyHandler godoc
+// @Summary      Issue an API key for a customer
+// @Tags         admin
+// @Accept       json
+// @Produce      json
+// @Security     AdminAuth
+// @Param        customer_id path int true "Customer ID"
+// @Param        request body KeyPayload true "Key"
+// @Success      200 {object} IssuedKey
+// @Failure      400 {object} apierror.Error "invalid input"
+// @Failure      401 {object} apierror.Error "unauthenticated"
+// @Failure      404 {object} apierror.Error "customer not found"
+// @Failure      500 {object} apierror.Error "internal error"
+// @Router       /admin/customers/{customer_id}/keys [post]
+func AdminCreateKeyHandler(c echo.Context) error {
+	customerID, err := strconv.ParseInt(c.Param("customer_id"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid customer_id")
+	}
+	return createKey(c, customerID)
+}
+
+// AdminListKeysHandler godoc
+// @Summary      List a customer's API keys
+// @Tags         admin
+// @Produce      json
+// @Security     AdminAuth
+// @Param        customer_id path int true "Customer ID"
+// @Success      200 {object} map[string]any
+// @Failure      400 {object} apierror.Error "invalid customer_id"
+// @Failure      401 {object} apierror.Error "unauthenticated"
+// @Failure      500 {object} apierror.Error "internal error"
+// @Router       /admin/customers/{customer_id}/keys [get]
+func AdminListKeysHandler(c echo.Context) error {
+	customerID, err := strconv.ParseInt(c.Param("customer_id"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid customer_id")
+	}
+	return listKeys(c, customerID)
+}
+
+// AdminRevokeKeyHandler godoc
+// @Summary      Revoke a customer's API key
+// @Tags         admin
+// @Produce      json
+// @Security     AdminAuth
+// @Param        customer_id path int true "Customer ID"
+// @Param        id path int true "Key ID"
+// @Success      200 {string} string "done"
+// @Failure      400 {object} apierror.Error "invalid id"
+// @Failure      401 {object} apierror.Error "unauthenticated"
+// @Failure      404 {object} apierror.Error "api key not found"
+// @Failure      500 {object} apierror.Error "internal error"
+// @Router       /admin/customers/{customer_id}/keys/{id} [delete]
+func AdminRevokeKeyHandler(c echo.Context) error {
+	customerID, err := strconv.ParseInt(c.Param("customer_id"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid customer_id")
+	}
+	return revokeKey(c, customerID)
+}
+
+// ListKeysHandler godoc
+// @Summary      List API keys
+// @Description  Returns the authenticated customer's keys, without their secrets
+// @Tags         keys
+// @Produce      json
+// @Security     BearerAuth
+// @Success      200 {object} map[string]any
+// @Failure      401 {object} apierror.Error "unauthenticated"
+// @Failure      500 {object} apierror.Error "internal error"
+// @Router       /keys [get]
+func ListKeysHandler(c echo.Context) error {
+	customerID, err := CustomerID(c)
+	if err != nil {
+		return err
+	}
+	return listKeys(c, customerID)
+}
+
+// CreateKeyHandler godoc
+// @Summary      Create API key
+// @Description  Issues another key for the authenticated customer. The key is only returned here
+// @Tags         keys
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        request body KeyPayload true "Key"
+// @Success      200 {object} IssuedKey
+// @Failure      400 {object} apierror.Error "invalid input"
+// @Failure      401 {object} apierror.Error "unauthenticated"
+// @Failure      500 {object} apierror.Error "internal error"
+// @Router       /keys [post]
+func CreateKeyHandler(c echo.Context) error {
+	customerID, err := CustomerID(c)
+	if err != nil {
+		return err
+	}
+	return createKey(c, customerID)
+}
+
+// RotateKeyHandler godoc
+// @Summary      Rotate API key
+// @Description  Issues a replacement key; the old one keeps working for grace_sec (0 revokes it at once)
+// @Tags         keys
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id path int true "Key ID"
+// @Param        request body RotatePayload false "Rotation"
+// @Success      200 {object} IssuedKey
+// @Failure      400 {object} apierror.Error "invalid input"
+// @Failure      401 {object} apierror.Error "unauthenticated"
+// @Failure      404 {object} apierror.Error "api key not found"
+// @Failure      500 {object} apierror.Error "internal error"
+// @Router       /keys/{id}/rotate [post]
+func RotateKeyHandler(c echo.Context) error {
+	customerID, err := CustomerID(c)
+	if err != nil {
+		return err
+	}
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid id")
+	}
+
+	var req RotatePayload
+	if c.Request().ContentLength != 0 {
+		if err := json.NewDecoder(c.Request().Body).Decode(&req); err != nil {
+			app.Logger.Error("invalid input ", "err", err)
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid input")
+		}
+	}
+	if req.GraceSec < 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid grace_sec")
+	}
+
+	key, err := RotateKey(c.Request().Context(), customerID, id, time.Duration(req.GraceSec)*time.Second)
+	if err != nil {
+		if errors.Is(err, ErrKeyNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, err.Error())
+		}
+		app.Logger.Error("rotate api key", "customer_id", customerID, "id", id, "err", err)
+		return err
+	}
+
+	return c.JSON(http.StatusOK, key)
+}
+
+// RevokeKeyHandler godoc
+// @Summary      Revoke API key
+// @Tags         keys
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id path int true "Key ID"
+// @Success      200 {string} string "done"
+// @Failure      400 {object} apierror.Error "invalid id"
+// @Failure      401 {object} apierror.Error "unauthenticated"
+// @Failure      404 {object} apierror.Error "api key not found"
+// @Failure      500 {object} apierror.Error "internal error"
+// @Router       /keys/{id} [delete]
+func RevokeKeyHandler(c echo.Context) error {
+	customerID, err := CustomerID(c)
+	if err != nil {
+		return err
+	}
+	return revokeKey(c, customerID)
+}
+
+func createKey(c echo.Context, customerID int64) error {
+	var req KeyPayload
+	if err := json.NewDecoder(c.Request().Body).Decode(&req); err != nil {
+		app.Logger.Error("invalid input ", "err", err)
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid input")
+	}
+
+	key, err := CreateKey(c.Request().Context(), customerID, req.Name)
+	if err != nil {
+		if errors.Is(err, ErrCustomerNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, err.Error())
+		}
+		app.Logger.Error("create api key", "customer_id", customerID, "err", err)
+		return err
+	}
+
+	return c.JSON(http.StatusOK, key)
+}
+
+func listKeys(c echo.Context, customerID int64) error {
+	keys, err := ListKeys(c.Request().Context(), customerID)
+	if err != nil {
+		app.Logger.Error("list api keys", "customer_id", customerID, "err", err)
+		return err
+	}
+
+	out := map[string]any{}
+	out["keys"] = keys
+
+	return c.JSON(http.StatusOK, out)
+}
+
+func revokeKey(c echo.Context, customerID int64) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid id")
+	}
+
+	if err := RevokeKey(c.Request().Context(), customerID, id); err != nil {
+		if errors.Is(err, ErrKeyNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, err.Error())
+		}
+		app.Logger.Error("revoke api key", "customer_id", customerID, "id", id, "err", err)
+		return err
+	}
+
+	return c.JSON(http.StatusOK, "done")
+}
+
+// ListAdminKeysHandler godoc
+// @Summary      List admin keys
+// @Tags         admin
+// @Produce      json
+// @Security     AdminAuth
+// @Success      200 {object} map[string]any
+// @Failure      401 {object} apierror.Error "unauthenticated"
+// @Failure      500 {object} apierror.Error "internal error"
+// @Router       /admin/keys [get]
+func ListAdminKeysHandler(c echo.Context) error {
+	keys, err := ListAdminKeys(c.Request().Context())
+	if err != nil {
+		app.Logger.Error("list admin keys", "err", err)
+		return err
+	}
+
+	out := map[string]any{}
+	out["keys"] = keys
+
+	return c.JSON(http.StatusOK, out)
+}
+
+// CreateAdminKeyHandler godoc
+// @Summary      Create admin key
+// @Description  Issues an admin key; its name is the actor in the audit log. The key is only returned here
+// @Tags         admin
+// @Accept       json
+// @Produce      json
+// @Security     AdminAuth
+// @Param        request body KeyPayload true "Key"
+// @Success      200 {object} IssuedAdminKey
+// @Failure      400 {object} apierror.Error "invalid input"
+// @Failure      401 {object} apierror.Error "unauthenticated"
+// @Failure      500 {object} apierror.Error "internal error"
+// @Router       /admin/keys [post]
+func CreateAdminKeyHandler(c echo.Context) error {
+	var req KeyPayload
+	if err := json.NewDecoder(c.Request().Body).Decode(&req); err != nil {
+		app.Logger.Error("invalid input ", "err", err)
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid input")
+	}
+
+	key, err := CreateAdminKey(c.Request().Context(), req.Name)
+	if err != nil {
+		if errors.Is(err, ErrInvalidAdminName) {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		app.Logger.Error("create admin key", "err", err)
+		return err
+	}
+
+	return c.JSON(http.StatusOK, key)
+}
+
+// RevokeAdminKeyHandler godoc
+// @Summary      Revoke admin key
+// @Tags         admin
+// @Produce      json
+// @Security     AdminAuth
+// @Param        id path int true "Key ID"
+// @Success      200 {string} string "done"
+// @Failure      400 {object} apierror.Error "invalid id"
+// @Failure      401 {object} apierror.Error "unauthenticated"
+// @Failure      404 {object} apierror.Error "api key not found"
+// @Failure      500 {object} apierror.Error "internal error"
+// @Router       /admin/keys/{id} [delete]
+func RevokeAdminKeyHandler(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid id")
+	}
+
+	if err := RevokeAdminKey(c.Request().Context(), id); err != nil {
+		if errors.Is(err, ErrKeyNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, err.Error())
+		}
+		app.Logger.Error("revoke admin key", "id", id, "err", err)
+		return err
+	}
+
+	return c.JSON(http.StatusOK, "done")
+}
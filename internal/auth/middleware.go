@@ -0,0 +1,97 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"sms-gateway/app"
+	"sms-gateway/pkg/apierror"
+	"sms-gateway/pkg/tracing"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Middleware authenticates `Authorization: Bearer <api key>` and puts the key's customer into
+// the request context. Handlers behind it take the customer from there (see CustomerID) and
+// ignore any customer or user id the client sends.
+func Middleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		key, ok := BearerToken(c.Request().Header.Get(echo.HeaderAuthorization))
+		if !ok {
+			c.Response().Header().Set(echo.HeaderWWWAuthenticate, `Bearer realm="api"`)
+			return echo.NewHTTPError(http.StatusUnauthorized, "missing bearer token")
+		}
+
+		k, err := Authenticate(c.Request().Context(), key)
+		if err != nil {
+			if errors.Is(err, ErrUnauthenticated) {
+				c.Response().Header().Set(echo.HeaderWWWAuthenticate, `Bearer realm="api", error="invalid_token"`)
+				return apierror.New(http.StatusUnauthorized, apierror.InvalidAPIKey, err.Error())
+			}
+			app.Logger.Error("authenticate api key", "err", err)
+			return echo.NewHTTPError(http.StatusInternalServerError, "internal error")
+		}
+
+		ctx := WithCustomer(c.Request().Context(), k.CustomerID)
+		ctx = tracing.WithUser(ctx, fmt.Sprint(k.CustomerID))
+		c.SetRequest(c.Request().WithContext(ctx))
+		return next(c)
+	}
+}
+
+// AdminMiddleware authenticates `Authorization: Bearer <admin key>` for the admin routes and
+// puts the admin key into the request context (see Actor).
+func AdminMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		key, ok := BearerToken(c.Request().Header.Get(echo.HeaderAuthorization))
+		if !ok {
+			c.Response().Header().Set(echo.HeaderWWWAuthenticate, `Bearer realm="admin"`)
+			return echo.NewHTTPError(http.StatusUnauthorized, "missing bearer token")
+		}
+
+		k, err := AuthenticateAdmin(c.Request().Context(), key)
+		if err != nil {
+			if errors.Is(err, ErrUnauthenticated) {
+				c.Response().Header().Set(echo.HeaderWWWAuthenticate, `Bearer realm="admin", error="invalid_token"`)
+				return apierror.New(http.StatusUnauthorized, apierror.InvalidAPIKey, err.Error())
+			}
+			app.Logger.Error("authenticate admin key", "err", err)
+			return echo.NewHTTPError(http.StatusInternalServerError, "internal error")
+		}
+
+		ctx := WithAdmin(c.Request().Context(), k)
+		ctx = tracing.WithUser(ctx, "admin:"+k.Name)
+		c.SetRequest(c.Request().WithContext(ctx))
+		return next(c)
+	}
+}
+
+// Actor names the admin authenticated by AdminMiddleware, falling back to fallback (the actor a
+// client sent) when the handler runs without it.
+func Actor(c echo.Context, fallback string) string {
+	if k, ok := AdminFrom(c.Request().Context()); ok {
+		return k.Name
+	}
+	return fallback
+}
+
+// CustomerID returns the customer authenticated by Middleware, or a 401 error.
+func CustomerID(c echo.Context) (int64, error) {
+	id, ok := CustomerFrom(c.Request().Context())
+	if !ok {
+		return 0, echo.NewHTTPError(http.StatusUnauthorized, "unauthenticated")
+	}
+	return id, nil
+}
+
+// BearerToken returns the token of an "Authorization: Bearer <token>" header value.
+func BearerToken(header string) (string, bool) {
+	scheme, token, ok := strings.Cut(header, " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
@@ -0,0 +1,216 @@
+package balance
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"sms-gateway/app"
+	"sms-gateway/config"
+	"sms-gateway/internal/outbox"
+	"sms-gateway/pkg/metrics"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type AccountMode string
+
+const (
+	Prepaid  AccountMode = "prepaid"
+	Postpaid AccountMode = "postpaid"
+)
+
+// EventCreditThreshold is written to the outbox when a postpaid account's used credit
+// crosses its soft limit.
+const EventCreditThreshold = "balance.credit_threshold_crossed"
+
+var ErrInvalidAccount = errors.New("invalid account settings")
+
+// spendableExpr is what a charge may reserve on the user_balances row: its available balance
+// plus, for postpaid accounts, the credit limit.
+const spendableExpr = `balance - held + CASE WHEN account_mode = 'postpaid' THEN credit_limit ELSE 0 END`
+
+type Account struct {
+	UserID      int64       `db:"user_id" json:"user_id"`
+	Mode        AccountMode `db:"account_mode" json:"account_mode"`
+	CreditLimit int64       `db:"credit_limit" json:"credit_limit"`
+	// SoftLimit is the used credit that raises EventCreditThreshold;
+	// nil means CREDIT_SOFT_LIMIT_PERCENT of CreditLimit.
+	SoftLimit *int64 `db:"credit_soft_limit" json:"credit_soft_limit"`
+}
+
+func (a Account) Validate() error {
+	if a.UserID == 0 {
+		return ErrInvalidAccount
+	}
+	if a.Mode != Prepaid && a.Mode != Postpaid {
+		return ErrInvalidAccount
+	}
+	if a.CreditLimit < 0 {
+		return ErrInvalidAccount
+	}
+	if a.SoftLimit != nil && (*a.SoftLimit < 0 || *a.SoftLimit > a.CreditLimit) {
+		return ErrInvalidAccount
+	}
+	return nil
+}
+
+func (a Account) softLimit() int64 {
+	if a.SoftLimit != nil {
+		return *a.SoftLimit
+	}
+	return a.CreditLimit * int64(config.CreditSoftLimitPercent) / 100
+}
+
+// creditThresholdCrossed reports whether a charge of price moved the used credit
+// (the negative part of balance - held) from below the soft limit to at or above it.
+func creditThresholdCrossed(a Account, availableAfter, price int64) bool {
+	if a.Mode != Postpaid || a.CreditLimit == 0 {
+		return false
+	}
+	soft := a.softLimit()
+	if soft <= 0 {
+		return false
+	}
+	usedAfter := -availableAfter
+	usedBefore := usedAfter - price
+	return usedBefore < soft && usedAfter >= soft
+}
+
+type AccountAudit struct {
+	ID                 int64       `db:"id" json:"id"`
+	UserID             int64       `db:"user_id" json:"user_id"`
+	OldMode            AccountMode `db:"old_account_mode" json:"old_account_mode"`
+	NewMode            AccountMode `db:"new_account_mode" json:"new_account_mode"`
+	OldCreditLimit     int64       `db:"old_credit_limit" json:"old_credit_limit"`
+	NewCreditLimit     int64       `db:"new_credit_limit" json:"new_credit_limit"`
+	OldCreditSoftLimit *int64      `db:"old_credit_soft_limit" json:"old_credit_soft_limit"`
+	NewCreditSoftLimit *int64      `db:"new_credit_soft_limit" json:"new_credit_soft_limit"`
+	Actor              string      `db:"actor" json:"actor"`
+	Reason             string      `db:"reason" json:"reason"`
+	CreatedAt          string      `db:"created_at" json:"created_at"`
+}
+
+func GetAccount(ctx context.Context, userID int64) (Account, error) {
+	const q = `SELECT user_id, account_mode, credit_limit, credit_soft_limit FROM user_balances WHERE user_id = ?`
+	a := Account{UserID: userID, Mode: Prepaid}
+	queryFn := metrics.DBExecObserver("select_account", func(c context.Context) error {
+		return app.DB.GetContext(c, &a, q, userID)
+	})
+	if err := queryFn(ctx); err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return Account{}, err
+	}
+	return a, nil
+}
+
+// SetAccount changes the account mode and credit limits and records the change, with the
+// previous values, in account_limit_audit in the same DB transaction.
+func SetAccount(ctx context.Context, a Account, actor, reason string) (err error) {
+	if err := a.Validate(); err != nil {
+		return err
+	}
+
+	tx, err := app.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	// Make sure the row exists so the old values can be locked.
+	const ensureQ = `INSERT INTO user_balances (user_id, balance) VALUES (?, 0) ON DUPLICATE KEY UPDATE user_id = user_id`
+	if err = metrics.DBExecObserver("ensure_user_balance", func(c context.Context) error {
+		_, execErr := tx.ExecContext(c, ensureQ, a.UserID)
+		return execErr
+	})(ctx); err != nil {
+		return err
+	}
+
+	var old Account
+	const selectQ = `SELECT user_id, account_mode, credit_limit, credit_soft_limit FROM user_balances WHERE user_id = ? FOR UPDATE`
+	if err = metrics.DBExecObserver("select_account_for_update", func(c context.Context) error {
+		return tx.GetContext(c, &old, selectQ, a.UserID)
+	})(ctx); err != nil {
+		return err
+	}
+
+	const updateQ = `UPDATE user_balances SET account_mode = ?, credit_limit = ?, credit_soft_limit = ? WHERE user_id = ?`
+	if err = metrics.DBExecObserver("update_account", func(c context.Context) error {
+		_, execErr := tx.ExecContext(c, updateQ, a.Mode, a.CreditLimit, a.SoftLimit, a.UserID)
+		return execErr
+	})(ctx); err != nil {
+		return err
+	}
+
+	if err = insertAccountAuditTx(ctx, tx, old, a, actor, reason); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func insertAccountAuditTx(ctx context.Context, tx *sqlx.Tx, old, updated Account, actor, reason string) error {
+	const q = `
+		INSERT INTO account_limit_audit
+			(user_id, old_account_mode, new_account_mode, old_credit_limit, new_credit_limit, old_credit_soft_limit, new_credit_soft_limit, actor, reason)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+	execFn := metrics.DBExecObserver("insert_account_limit_audit", func(c context.Context) error {
+		_, err := tx.ExecContext(c, q, updated.UserID, old.Mode, updated.Mode, old.CreditLimit, updated.CreditLimit, old.SoftLimit, updated.SoftLimit, actor, reason)
+		return err
+	})
+	return execFn(ctx)
+}
+
+func ListAccountAudit(ctx context.Context, userID int64) ([]AccountAudit, error) {
+	const q = `
+		SELECT id, user_id, old_account_mode, new_account_mode, old_credit_limit, new_credit_limit,
+		       old_credit_soft_limit, new_credit_soft_limit, actor, reason, created_at
+		FROM account_limit_audit
+		WHERE user_id = ?
+		ORDER BY id DESC
+	`
+	var out []AccountAudit
+	queryFn := metrics.DBExecObserver("select_account_limit_audit", func(c context.Context) error {
+		return app.DB.SelectContext(c, &out, q, userID)
+	})
+	if err := queryFn(ctx); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// checkCreditThresholdTx runs after a hold was placed and writes an outbox event when the hold
+// pushed a postpaid account over its soft limit.
+func checkCreditThresholdTx(ctx context.Context, tx *sqlx.Tx, userID int64, txID string, price int64) error {
+	var row struct {
+		Account
+		Available int64 `db:"available"`
+	}
+	const q = `SELECT b.user_id, b.account_mode, b.credit_limit, b.credit_soft_limit, ` + totalAvailableExpr + ` AS available FROM user_balances b WHERE b.user_id = ?`
+	if err := metrics.DBExecObserver("select_account_after_charge", func(c context.Context) error {
+		return tx.GetContext(c, &row, q, userID)
+	})(ctx); err != nil {
+		return err
+	}
+	if !creditThresholdCrossed(row.Account, row.Available, price) {
+		return nil
+	}
+
+	app.Logger.Warn("postpaid account crossed soft credit limit", "user_id", userID, "credit_limit", row.CreditLimit, "used", -row.Available)
+	return outbox.InsertTx(ctx, tx, outbox.Event{
+		AggregateType: "balance",
+		AggregateID:   txID,
+		EventType:     EventCreditThreshold,
+		Status:        outbox.StatusPending,
+		Payload: map[string]any{
+			"user_id":        userID,
+			"credit_limit":   row.CreditLimit,
+			"soft_limit":     row.softLimit(),
+			"used":           -row.Available,
+			"transaction_id": txID,
+		},
+	})
+}
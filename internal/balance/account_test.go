@@ -0,0 +1,143 @@
+package balance
+
+import (
+	"errors"
+	"testing"
+
+	"sms-gateway/app"
+	"sms-gateway/config"
+	"sms-gateway/internal/model"
+	"sms-gateway/testutil"
+)
+
+func TestCreditThresholdCrossed(t *testing.T) {
+	prev := config.CreditSoftLimitPercent
+	config.CreditSoftLimitPercent = 80
+	defer func() { config.CreditSoftLimitPercent = prev }()
+
+	soft := int64(50)
+	postpaid := Account{Mode: Postpaid, CreditLimit: 100, SoftLimit: &soft}
+	cases := []struct {
+		name      string
+		account   Account
+		available int64
+		price     int64
+		want      bool
+	}{
+		{"prepaid never fires", Account{Mode: Prepaid, CreditLimit: 100}, -60, 20, false},
+		{"still below soft limit", postpaid, -40, 10, false},
+		{"crosses soft limit", postpaid, -55, 10, true},
+		{"lands exactly on soft limit", postpaid, -50, 10, true},
+		{"already above soft limit", postpaid, -70, 10, false},
+		{"default percent of limit", Account{Mode: Postpaid, CreditLimit: 100}, -85, 10, true},
+	}
+	for _, tc := range cases {
+		if got := creditThresholdCrossed(tc.account, tc.available, tc.price); got != tc.want {
+			t.Errorf("%s: got %v want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestPostpaidChargeWithinCreditLimit(t *testing.T) {
+	ctx := testutil.EnsureSetup(t)
+	testutil.ResetTables(ctx, t)
+
+	soft := int64(4)
+	if err := SetAccount(ctx, Account{UserID: 801, Mode: Postpaid, CreditLimit: 6, SoftLimit: &soft}, "finance", "enterprise contract"); err != nil {
+		t.Fatalf("set account: %v", err)
+	}
+
+	// Balance is 0: 3 express messages use 9 > 6 of credit, 2 use 6.
+	if _, err := Charge(ctx, ChargeRequest{CustomerID: 801, Quantity: 3, Type: model.EXPRESS}); !errors.Is(err, ErrInsufficientBalance) {
+		t.Fatalf("expected charge over the credit limit to fail, got %v", err)
+	}
+	txID, err := Charge(ctx, ChargeRequest{CustomerID: 801, Quantity: 2, Type: model.EXPRESS})
+	if err != nil {
+		t.Fatalf("charge within credit: %v", err)
+	}
+	if err := Capture(ctx, model.SMS{CustomerID: 801, TransactionID: txID}); err != nil {
+		t.Fatalf("capture: %v", err)
+	}
+	if b, _ := GetUserBalances(ctx, "801"); b.Balance != -6 || b.AccountMode != Postpaid {
+		t.Fatalf("expected balance -6 on postpaid account, got %+v", b)
+	}
+
+	var n int
+	if err := app.DB.GetContext(ctx, &n, "SELECT COUNT(*) FROM outbox_events WHERE event_type = ? AND aggregate_id = ?", EventCreditThreshold, txID); err != nil || n != 1 {
+		t.Fatalf("expected one threshold event, got %d err=%v", n, err)
+	}
+
+	audit, err := ListAccountAudit(ctx, 801)
+	if err != nil || len(audit) != 1 || audit[0].OldMode != Prepaid || audit[0].NewCreditLimit != 6 || audit[0].Actor != "finance" {
+		t.Fatalf("unexpected audit %+v err=%v", audit, err)
+	}
+}
+
+func TestSetAccountRejectsInvalidLimits(t *testing.T) {
+	soft := int64(10)
+	if err := (Account{UserID: 1, Mode: Postpaid, CreditLimit: 5, SoftLimit: &soft}).Validate(); !errors.Is(err, ErrInvalidAccount) {
+		t.Fatalf("expected soft limit above credit limit to be invalid, got %v", err)
+	}
+	if err := (Account{UserID: 1, Mode: "credit"}).Validate(); !errors.Is(err, ErrInvalidAccount) {
+		t.Fatalf("expected unknown mode to be invalid, got %v", err)
+	}
+}
+
+func TestLowBalanceAlertRejectsInternalWebhooks(t *testing.T) {
+	for _, u := range []string{"http://127.0.0.1/hook", "http://10.0.0.5/hook", "http://169.254.169.254/latest", "http://[::1]:8080/", "ftp://93.184.216.34/"} {
+		if err := (LowBalanceAlert{UserID: 1, Threshold: 5, WebhookURL: u}).Validate(); !errors.Is(err, ErrInvalidAlert) {
+			t.Fatalf("expected %s to be invalid, got %v", u, err)
+		}
+	}
+	if err := (LowBalanceAlert{UserID: 1, Threshold: 5, WebhookURL: "https://93.184.216.34/hook"}).Validate(); err != nil {
+		t.Fatalf("expected public webhook to be valid, got %v", err)
+	}
+}
+
+func TestLowBalanceAlertFiresOncePerCrossing(t *testing.T) {
+	ctx := testutil.EnsureSetup(t)
+	testutil.ResetTables(ctx, t)
+	if _, err := app.DB.ExecContext(ctx, "INSERT INTO user_balances (user_id, balance) VALUES (?, ?)", 901, 10); err != nil {
+		t.Fatalf("seed balance: %v", err)
+	}
+	if err := SetAlert(ctx, LowBalanceAlert{UserID: 901, Threshold: 8, WebhookURL: "https://example.com/alerts", ContactNumber: "+98912"}); err != nil {
+		t.Fatalf("set alert: %v", err)
+	}
+
+	count := func() int {
+		var n int
+		if err := app.DB.GetContext(ctx, &n, "SELECT COUNT(*) FROM outbox_events WHERE event_type = ?", EventLowBalance); err != nil {
+			t.Fatalf("count events: %v", err)
+		}
+		return n
+	}
+
+	// 10 -> 9: above the threshold.
+	if _, err := Charge(ctx, ChargeRequest{CustomerID: 901, Quantity: 1, Type: model.NORMAL}); err != nil {
+		t.Fatalf("charge: %v", err)
+	}
+	if n := count(); n != 0 {
+		t.Fatalf("expected no alert yet, got %d", n)
+	}
+	// 9 -> 8 -> 7 -> 6: crosses below 8 once, then stays below.
+	for i := 0; i < 3; i++ {
+		if _, err := Charge(ctx, ChargeRequest{CustomerID: 901, Quantity: 1, Type: model.NORMAL}); err != nil {
+			t.Fatalf("charge: %v", err)
+		}
+	}
+	// One event per channel: webhook and SMS.
+	if n := count(); n != 2 {
+		t.Fatalf("expected one alert per channel for one crossing, got %d", n)
+	}
+
+	// Top-up re-arms, next drop fires again.
+	if _, err := AddBalance(ctx, AddBalanceRequest{CustomerID: 901, Amount: 10}); err != nil {
+		t.Fatalf("add balance: %v", err)
+	}
+	if _, err := Charge(ctx, ChargeRequest{CustomerID: 901, Quantity: 4, Type: model.EXPRESS}); err != nil {
+		t.Fatalf("charge: %v", err)
+	}
+	if n := count(); n != 4 {
+		t.Fatalf("expected second alert after re-arm, got %d", n)
+	}
+}
@@ -0,0 +1,181 @@
+package balance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"sms-gateway/app"
+	"sms-gateway/internal/outbox"
+	"sms-gateway/pkg/metrics"
+	"sms-gateway/pkg/webhook"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// EventLowBalance is written to the outbox when a charge takes the available balance
+// below one of the customer's alert thresholds.
+const EventLowBalance = "balance.low_balance"
+
+var (
+	ErrInvalidAlert  = errors.New("invalid low-balance alert")
+	ErrAlertNotFound = errors.New("low-balance alert not found")
+)
+
+// LowBalanceAlert fires once when the available balance drops below Threshold and is
+// re-armed when the balance is back at or above it.
+type LowBalanceAlert struct {
+	ID            int64   `db:"id" json:"id"`
+	UserID        int64   `db:"user_id" json:"user_id"`
+	Threshold     int64   `db:"threshold" json:"threshold"`
+	WebhookURL    string  `db:"webhook_url" json:"webhook_url,omitempty"`
+	ContactNumber string  `db:"contact_number" json:"contact_number,omitempty"`
+	Armed         bool    `db:"armed" json:"armed"`
+	LastFiredAt   *string `db:"last_fired_at" json:"last_fired_at"`
+}
+
+func (a LowBalanceAlert) Validate() error {
+	if a.UserID == 0 || a.Threshold <= 0 {
+		return ErrInvalidAlert
+	}
+	if a.WebhookURL == "" && a.ContactNumber == "" {
+		return ErrInvalidAlert
+	}
+	if a.WebhookURL != "" {
+		// The dispatcher checks the address again when it connects.
+		if err := webhook.CheckURL(context.Background(), a.WebhookURL); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidAlert, err)
+		}
+	}
+	return nil
+}
+
+const alertColumns = `id, user_id, threshold, COALESCE(webhook_url, '') AS webhook_url, COALESCE(contact_number, '') AS contact_number, armed, last_fired_at`
+
+func ListAlerts(ctx context.Context, userID int64) ([]LowBalanceAlert, error) {
+	q := `SELECT ` + alertColumns + ` FROM low_balance_alerts WHERE user_id = ? ORDER BY threshold DESC`
+	var out []LowBalanceAlert
+	queryFn := metrics.DBExecObserver("select_low_balance_alerts", func(c context.Context) error {
+		return app.DB.SelectContext(c, &out, q, userID)
+	})
+	if err := queryFn(ctx); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// SetAlert creates the alert for (user, threshold) or replaces its channels; it is (re-)armed.
+func SetAlert(ctx context.Context, a LowBalanceAlert) error {
+	if err := a.Validate(); err != nil {
+		return err
+	}
+	const q = `
+		INSERT INTO low_balance_alerts (user_id, threshold, webhook_url, contact_number, armed)
+		VALUES (?, ?, NULLIF(?, ''), NULLIF(?, ''), 1)
+		ON DUPLICATE KEY UPDATE
+			webhook_url = VALUES(webhook_url),
+			contact_number = VALUES(contact_number),
+			armed = 1
+	`
+	execFn := metrics.DBExecObserver("upsert_low_balance_alert", func(c context.Context) error {
+		_, err := app.DB.ExecContext(c, q, a.UserID, a.Threshold, a.WebhookURL, a.ContactNumber)
+		return err
+	})
+	return execFn(ctx)
+}
+
+func DeleteAlert(ctx context.Context, userID, id int64) error {
+	const q = `DELETE FROM low_balance_alerts WHERE id = ? AND user_id = ?`
+	var rows int64
+	execFn := metrics.DBExecObserver("delete_low_balance_alert", func(c context.Context) error {
+		res, err := app.DB.ExecContext(c, q, id, userID)
+		if err != nil {
+			return err
+		}
+		rows, err = res.RowsAffected()
+		return err
+	})
+	if err := execFn(ctx); err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrAlertNotFound
+	}
+	return nil
+}
+
+// fireLowBalanceAlertsTx runs after a hold was placed. Armed alerts whose threshold is now above
+// the available balance are disarmed and each writes one outbox event, so an alert fires once
+// per crossing instead of on every send.
+func fireLowBalanceAlertsTx(ctx context.Context, tx *sqlx.Tx, userID int64, txID string) error {
+	var fired []struct {
+		LowBalanceAlert
+		Available int64 `db:"available"`
+	}
+	// Only the alerts are locked: a sharded balance must not be serialised on its main row here.
+	const selectQ = `
+		SELECT a.id, a.user_id, a.threshold, COALESCE(a.webhook_url, '') AS webhook_url,
+		       COALESCE(a.contact_number, '') AS contact_number, a.armed, a.last_fired_at,
+		       ` + totalAvailableExpr + ` AS available
+		FROM low_balance_alerts a
+		JOIN user_balances b ON b.user_id = a.user_id
+		WHERE a.user_id = ? AND a.armed = 1 AND ` + totalAvailableExpr + ` < a.threshold
+		FOR UPDATE OF a
+	`
+	if err := metrics.DBExecObserver("select_low_balance_alerts_to_fire", func(c context.Context) error {
+		return tx.SelectContext(c, &fired, selectQ, userID)
+	})(ctx); err != nil {
+		return err
+	}
+
+	for _, f := range fired {
+		const disarmQ = `UPDATE low_balance_alerts SET armed = 0, last_fired_at = CURRENT_TIMESTAMP WHERE id = ?`
+		if err := metrics.DBExecObserver("disarm_low_balance_alert", func(c context.Context) error {
+			_, err := tx.ExecContext(c, disarmQ, f.ID)
+			return err
+		})(ctx); err != nil {
+			return err
+		}
+
+		// One event per channel, so the dispatcher retries a failing webhook without sending
+		// the SMS again, and the other way round.
+		channels := map[string]map[string]any{}
+		if f.WebhookURL != "" {
+			channels["webhook"] = map[string]any{"webhook_url": f.WebhookURL}
+		}
+		if f.ContactNumber != "" {
+			channels["sms"] = map[string]any{"contact_number": f.ContactNumber}
+		}
+		for channel, payload := range channels {
+			payload["user_id"] = f.UserID
+			payload["threshold"] = f.Threshold
+			payload["available"] = f.Available
+			payload["text"] = fmt.Sprintf("Your SMS balance is %d, below your alert threshold of %d.", f.Available, f.Threshold)
+			if err := outbox.InsertTx(ctx, tx, outbox.Event{
+				AggregateType: "balance",
+				AggregateID:   fmt.Sprintf("%s:%d:%s", txID, f.ID, channel),
+				EventType:     EventLowBalance,
+				Status:        outbox.StatusPending,
+				Payload:       payload,
+			}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// rearmAlertsTx re-arms the user's fired alerts whose threshold the available balance reached again.
+func rearmAlertsTx(ctx context.Context, tx *sqlx.Tx, userID int64) error {
+	const q = `
+		UPDATE low_balance_alerts a
+		JOIN user_balances b ON b.user_id = a.user_id
+		SET a.armed = 1
+		WHERE a.user_id = ? AND a.armed = 0 AND ` + totalAvailableExpr + ` >= a.threshold
+	`
+	execFn := metrics.DBExecObserver("rearm_low_balance_alerts", func(c context.Context) error {
+		_, err := tx.ExecContext(c, q, userID)
+		return err
+	})
+	return execFn(ctx)
+}
@@ -1,9 +1,20 @@
 package balance
 
 import (
+	"encoding/csv"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
 	"net/http"
 	"sms-gateway/app"
+	"sms-gateway/internal/auth"
+	"sms-gateway/internal/model"
+	"sms-gateway/internal/pricing"
+	"sms-gateway/pkg/apierror"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/labstack/echo/v4"
 )
@@ -13,25 +24,30 @@ type AddBalancePayload struct {
 	UserID      int64  `json:"user_id"`
 	Balance     uint64 `json:"balance"`
 	Description string `json:"description"`
+	Promo       bool   `json:"promo"`
+	// PaymentReference is the payment's id at PaymentSource (default "manual"); it is credited once.
+	PaymentSource    string `json:"payment_source"`
+	PaymentReference string `json:"payment_reference"`
 }
 
 // GetBalanceAndHistoryHandler godoc
 // @Summary      Get user balance and transactions
-// @Description  Returns current balance and transaction history
+// @Description  Returns current balance, the part held for in-flight messages, the available balance and the latest 50 transactions (see /balance/statement for the full history)
 // @Tags         balance
 // @Produce      json
-// @Param        user_id query string true "User ID"
+// @Security     BearerAuth
 // @Success      200 {object} map[string]any
-// @Failure      400 {string} string "user_id is required"
-// @Failure      500 {string} string "internal error"
+// @Failure      401 {object} apierror.Error "unauthenticated"
+// @Failure      500 {object} apierror.Error "internal error"
 // @Router       /balance [get]
 func GetBalanceAndHistoryHandler(c echo.Context) error {
-	userID := c.QueryParam("user_id")
-	if userID == "" {
-		return echo.NewHTTPError(http.StatusBadRequest, "user_id is required")
+	customerID, err := auth.CustomerID(c)
+	if err != nil {
+		return err
 	}
+	userID := strconv.FormatInt(customerID, 10)
 
-	balance, err := GetUserBalance(c.Request().Context(), userID)
+	balances, err := GetUserBalances(c.Request().Context(), userID)
 	if err != nil {
 		app.Logger.Error("get balance and history", "user_id", userID, "err", err)
 		return err
@@ -44,7 +60,11 @@ func GetBalanceAndHistoryHandler(c echo.Context) error {
 	}
 
 	out := map[string]any{}
-	out["balance"] = balance
+	out["balance"] = balances.Balance
+	out["held"] = balances.Held
+	out["available"] = balances.Available
+	out["account_mode"] = balances.AccountMode
+	out["credit_limit"] = balances.CreditLimit
 	out["transactions"] = Transactions
 
 	return c.JSON(http.StatusOK, out)
@@ -52,14 +72,17 @@ func GetBalanceAndHistoryHandler(c echo.Context) error {
 
 // AddBalanceHandler godoc
 // @Summary      Add balance for user
-// @Description  Increases user balance and records transaction
+// @Description  Increases user balance and records a deposit carrying the payment reference. Replaying a payment reference returns the original deposit with replayed=true
 // @Tags         balance
 // @Accept       json
 // @Produce      json
+// @Security     AdminAuth
 // @Param        request body AddBalancePayload true "Add balance request"
-// @Success      200 {string} string "done"
-// @Failure      400 {string} string "invalid input"
-// @Failure      500 {string} string "internal error"
+// @Success      200 {object} TopUp
+// @Failure      400 {object} apierror.Error "invalid input, non-positive user_id or balance, or missing payment_reference"
+// @Failure      401 {object} apierror.Error "unauthenticated"
+// @Failure      409 {object} apierror.Error "payment reference already used for a different top-up"
+// @Failure      500 {object} apierror.Error "internal error"
 // @Router       /balance/add [post]
 func AddBalanceHandler(c echo.Context) error {
 	var req AddBalancePayload
@@ -67,15 +90,928 @@ func AddBalanceHandler(c echo.Context) error {
 		app.Logger.Error("invalid input ", "err", err)
 		return echo.NewHTTPError(http.StatusBadRequest, "invalid input")
 	}
+	if req.UserID <= 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, "user_id must be positive")
+	}
+	if req.Balance == 0 || req.Balance > math.MaxInt64 {
+		return echo.NewHTTPError(http.StatusBadRequest, "balance must be positive")
+	}
+	if req.PaymentReference == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "payment_reference is required")
+	}
 
-	if err := AddBalance(c.Request().Context(), AddBalanceRequest{
-		CustomerID:  req.UserID,
-		Amount:      req.Balance,
-		Description: req.Description,
-	}); err != nil {
+	topUp, err := AddBalance(c.Request().Context(), AddBalanceRequest{
+		CustomerID:       req.UserID,
+		Amount:           req.Balance,
+		Description:      req.Description,
+		Promo:            req.Promo,
+		PaymentSource:    req.PaymentSource,
+		PaymentReference: req.PaymentReference,
+	})
+	if err != nil {
+		if errors.Is(err, ErrPaymentReferenceConflict) {
+			return apierror.New(http.StatusConflict, apierror.PaymentReferenceConflict, err.Error())
+		}
 		app.Logger.Error("add balance", "user_id", req.UserID, "err", err)
 		return err
 	}
 
+	return c.JSON(http.StatusOK, topUp)
+}
+
+// RefundPayload represents the request body for refunding a charge.
+type RefundPayload struct {
+	UserID        int64  `json:"user_id"`
+	TransactionID string `json:"transaction_id"`
+	Amount        int64  `json:"amount"`
+	Key           string `json:"key"`
+	Reason        string `json:"reason"`
+}
+
+// RefundHandler godoc
+// @Summary      Refund a charge
+// @Description  Refunds (part of) a charge. amount 0 refunds the rest; a partial refund needs a key. A replay with the same key returns the first refund
+// @Tags         admin
+// @Accept       json
+// @Produce      json
+// @Security     AdminAuth
+// @Param        request body RefundPayload true "Refund request"
+// @Success      200 {object} RefundRecord
+// @Failure      400 {object} apierror.Error "invalid input"
+// @Failure      401 {object} apierror.Error "unauthenticated"
+// @Failure      404 {object} apierror.Error "transaction not found"
+// @Failure      422 {object} apierror.Error "refund exceeds the charged amount"
+// @Failure      500 {object} apierror.Error "internal error"
+// @Router       /admin/refunds [post]
+func RefundHandler(c echo.Context) error {
+	var req RefundPayload
+	if err := json.NewDecoder(c.Request().Body).Decode(&req); err != nil {
+		app.Logger.Error("invalid input ", "err", err)
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid input")
+	}
+	if req.UserID == 0 || req.TransactionID == "" || req.Amount < 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid input")
+	}
+
+	if req.Amount > 0 && req.Key == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, ErrRefundKeyRequired.Error())
+	}
+
+	r, err := Refund(c.Request().Context(), RefundRequest{
+		CustomerID:    req.UserID,
+		TransactionID: req.TransactionID,
+		Amount:        req.Amount,
+		Key:           req.Key,
+		Reason:        req.Reason,
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrTransactionNotFound):
+			return echo.NewHTTPError(http.StatusNotFound, "transaction not found")
+		case errors.Is(err, ErrRefundExceedsCharge):
+			return apierror.New(http.StatusUnprocessableEntity, apierror.RefundExceedsCharge, "refund exceeds the charged amount")
+		}
+		app.Logger.Error("refund", "transaction_id", req.TransactionID, "err", err)
+		return err
+	}
+
+	return c.JSON(http.StatusOK, r)
+}
+
+// ListRefundsHandler godoc
+// @Summary      List refunds of a charge
+// @Description  Returns every refund recorded against the given original transaction
+// @Tags         admin
+// @Produce      json
+// @Security     AdminAuth
+// @Param        transaction_id query string true "Original transaction ID"
+// @Success      200 {object} map[string]any
+// @Failure      400 {object} apierror.Error "transaction_id is required"
+// @Failure      401 {object} apierror.Error "unauthenticated"
+// @Failure      500 {object} apierror.Error "internal error"
+// @Router       /admin/refunds [get]
+func ListRefundsHandler(c echo.Context) error {
+	transactionID := c.QueryParam("transaction_id")
+	if transactionID == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "transaction_id is required")
+	}
+
+	refunds, err := ListRefunds(c.Request().Context(), transactionID)
+	if err != nil {
+		app.Logger.Error("list refunds", "transaction_id", transactionID, "err", err)
+		return err
+	}
+
+	out := map[string]any{}
+	out["refunds"] = refunds
+
+	return c.JSON(http.StatusOK, out)
+}
+
+// AccountPayload represents the request body for changing an account's billing mode.
+type AccountPayload struct {
+	AccountMode AccountMode `json:"account_mode"`
+	CreditLimit int64       `json:"credit_limit"`
+	SoftLimit   *int64      `json:"credit_soft_limit"`
+	Actor       string      `json:"actor"`
+	Reason      string      `json:"reason"`
+}
+
+// GetAccountHandler godoc
+// @Summary      Get account billing settings
+// @Description  Returns the account mode, credit limits and the audit trail of limit changes
+// @Tags         admin
+// @Produce      json
+// @Security     AdminAuth
+// @Param        user_id path int true "User ID"
+// @Success      200 {object} map[string]any
+// @Failure      400 {object} apierror.Error "invalid user_id"
+// @Failure      401 {object} apierror.Error "unauthenticated"
+// @Failure      500 {object} apierror.Error "internal error"
+// @Router       /admin/accounts/{user_id} [get]
+func GetAccountHandler(c echo.Context) error {
+	userID, err := strconv.ParseInt(c.Param("user_id"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid user_id")
+	}
+
+	account, err := GetAccount(c.Request().Context(), userID)
+	if err != nil {
+		app.Logger.Error("get account", "user_id", userID, "err", err)
+		return err
+	}
+	audit, err := ListAccountAudit(c.Request().Context(), userID)
+	if err != nil {
+		app.Logger.Error("get account audit", "user_id", userID, "err", err)
+		return err
+	}
+
+	out := map[string]any{}
+	out["account"] = account
+	out["audit"] = audit
+
+	return c.JSON(http.StatusOK, out)
+}
+
+// SetAccountHandler godoc
+// @Summary      Set account billing settings
+// @Description  Switches between prepaid and postpaid and sets the credit limit; every change is audited with the admin key's name as actor
+// @Tags         admin
+// @Accept       json
+// @Produce      json
+// @Security     AdminAuth
+// @Param        user_id path int true "User ID"
+// @Param        request body AccountPayload true "Account settings"
+// @Success      200 {string} string "done"
+// @Failure      400 {object} apierror.Error "invalid input"
+// @Failure      401 {object} apierror.Error "unauthenticated"
+// @Failure      500 {object} apierror.Error "internal error"
+// @Router       /admin/accounts/{user_id} [put]
+func SetAccountHandler(c echo.Context) error {
+	userID, err := strconv.ParseInt(c.Param("user_id"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid user_id")
+	}
+
+	var req AccountPayload
+	if err := json.NewDecoder(c.Request().Body).Decode(&req); err != nil {
+		app.Logger.Error("invalid input ", "err", err)
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid input")
+	}
+
+	if err := SetAccount(c.Request().Context(), Account{
+		UserID:      userID,
+		Mode:        req.AccountMode,
+		CreditLimit: req.CreditLimit,
+		SoftLimit:   req.SoftLimit,
+	}, auth.Actor(c, req.Actor), req.Reason); err != nil {
+		if errors.Is(err, ErrInvalidAccount) {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		app.Logger.Error("set account", "user_id", userID, "err", err)
+		return err
+	}
+
+	return c.JSON(http.StatusOK, "done")
+}
+
+// ShardsPayload represents the request body for sharding an account's balance.
+type ShardsPayload struct {
+	Shards int `json:"shards"`
+}
+
+// GetShardsHandler godoc
+// @Summary      Get balance shards
+// @Description  Returns how the account's balance is spread over its shards (the main balance row not included)
+// @Tags         admin
+// @Produce      json
+// @Security     AdminAuth
+// @Param        user_id path int true "User ID"
+// @Success      200 {object} map[string]any
+// @Failure      400 {object} apierror.Error "invalid user_id"
+// @Failure      401 {object} apierror.Error "unauthenticated"
+// @Failure      500 {object} apierror.Error "internal error"
+// @Router       /admin/accounts/{user_id}/shards [get]
+func GetShardsHandler(c echo.Context) error {
+	userID, err := strconv.ParseInt(c.Param("user_id"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid user_id")
+	}
+
+	shards, err := GetBalanceShards(c.Request().Context(), userID)
+	if err != nil {
+		app.Logger.Error("get balance shards", "user_id", userID, "err", err)
+		return err
+	}
+
+	out := map[string]any{}
+	out["shards"] = shards
+	return c.JSON(http.StatusOK, out)
+}
+
+// SetShardsHandler godoc
+// @Summary      Shard an account's balance
+// @Description  Spreads a high-volume account's balance over N rows so concurrent sends do not queue on one row lock; 0 turns sharding off
+// @Tags         admin
+// @Accept       json
+// @Produce      json
+// @Security     AdminAuth
+// @Param        user_id path int true "User ID"
+// @Param        request body ShardsPayload true "Shard count"
+// @Success      200 {string} string "done"
+// @Failure      400 {object} apierror.Error "invalid input"
+// @Failure      401 {object} apierror.Error "unauthenticated"
+// @Failure      500 {object} apierror.Error "internal error"
+// @Router       /admin/accounts/{user_id}/shards [put]
+func SetShardsHandler(c echo.Context) error {
+	userID, err := strconv.ParseInt(c.Param("user_id"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid user_id")
+	}
+
+	var req ShardsPayload
+	if err := json.NewDecoder(c.Request().Body).Decode(&req); err != nil {
+		app.Logger.Error("invalid input ", "err", err)
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid input")
+	}
+
+	if err := SetBalanceShards(c.Request().Context(), userID, req.Shards); err != nil {
+		if errors.Is(err, ErrInvalidShards) {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("shards must be between 0 and %d", MaxBalanceShards))
+		}
+		app.Logger.Error("set balance shards", "user_id", userID, "err", err)
+		return err
+	}
+
+	return c.JSON(http.StatusOK, "done")
+}
+
+// AlertPayload represents the request body for a low-balance alert.
+type AlertPayload struct {
+	Threshold     int64  `json:"threshold"`
+	WebhookURL    string `json:"webhook_url"`
+	ContactNumber string `json:"contact_number"`
+}
+
+// ListAlertsHandler godoc
+// @Summary      List low-balance alerts
+// @Tags         balance
+// @Produce      json
+// @Security     BearerAuth
+// @Success      200 {object} map[string]any
+// @Failure      401 {object} apierror.Error "unauthenticated"
+// @Failure      500 {object} apierror.Error "internal error"
+// @Router       /balance/alerts [get]
+func ListAlertsHandler(c echo.Context) error {
+	userID, err := auth.CustomerID(c)
+	if err != nil {
+		return err
+	}
+
+	alerts, err := ListAlerts(c.Request().Context(), userID)
+	if err != nil {
+		app.Logger.Error("list low balance alerts", "user_id", userID, "err", err)
+		return err
+	}
+
+	out := map[string]any{}
+	out["alerts"] = alerts
+
+	return c.JSON(http.StatusOK, out)
+}
+
+// SetAlertHandler godoc
+// @Summary      Set low-balance alert
+// @Description  Creates or updates the alert for a threshold; it fires once (webhook and/or SMS) each time the available balance drops below it
+// @Tags         balance
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        request body AlertPayload true "Low-balance alert"
+// @Param        Idempotency-Key header string false "Makes the request safe to retry; repeats return the first response"
+// @Success      200 {string} string "done"
+// @Failure      400 {object} apierror.Error "invalid input"
+// @Failure      401 {object} apierror.Error "unauthenticated"
+// @Failure      500 {object} apierror.Error "internal error"
+// @Router       /balance/alerts [post]
+func SetAlertHandler(c echo.Context) error {
+	userID, err := auth.CustomerID(c)
+	if err != nil {
+		return err
+	}
+
+	var req AlertPayload
+	if err := json.NewDecoder(c.Request().Body).Decode(&req); err != nil {
+		app.Logger.Error("invalid input ", "err", err)
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid input")
+	}
+
+	if err := SetAlert(c.Request().Context(), LowBalanceAlert{
+		UserID:        userID,
+		Threshold:     req.Threshold,
+		WebhookURL:    req.WebhookURL,
+		ContactNumber: req.ContactNumber,
+	}); err != nil {
+		if errors.Is(err, ErrInvalidAlert) {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		app.Logger.Error("set low balance alert", "user_id", userID, "err", err)
+		return err
+	}
+
+	return c.JSON(http.StatusOK, "done")
+}
+
+// DeleteAlertHandler godoc
+// @Summary      Delete low-balance alert
+// @Tags         balance
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id path int true "Alert ID"
+// @Success      200 {string} string "done"
+// @Failure      400 {object} apierror.Error "invalid id"
+// @Failure      401 {object} apierror.Error "unauthenticated"
+// @Failure      404 {object} apierror.Error "alert not found"
+// @Failure      500 {object} apierror.Error "internal error"
+// @Router       /balance/alerts/{id} [delete]
+func DeleteAlertHandler(c echo.Context) error {
+	userID, err := auth.CustomerID(c)
+	if err != nil {
+		return err
+	}
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid id")
+	}
+
+	if err := DeleteAlert(c.Request().Context(), userID, id); err != nil {
+		if errors.Is(err, ErrAlertNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, "alert not found")
+		}
+		app.Logger.Error("delete low balance alert", "id", id, "err", err)
+		return err
+	}
+
+	return c.JSON(http.StatusOK, "done")
+}
+
+// StatementHandler godoc
+// @Summary      Balance statement
+// @Description  Pages through the user's transactions in [from, to), oldest first, with the opening and closing balance of the period. format=csv exports the whole period
+// @Tags         balance
+// @Produce      json
+// @Produce      text/csv
+// @Security     BearerAuth
+// @Param        from query string false "Start (RFC3339 or YYYY-MM-DD), inclusive"
+// @Param        to query string false "End (RFC3339 or YYYY-MM-DD), exclusive; defaults to now"
+// @Param        type query string false "Comma-separated transaction types (deposit, withdrawal, Corrective, transfer)"
+// @Param        cursor query string false "next_cursor of the previous page"
+// @Param        limit query int false "Page size (default 100, max 1000)"
+// @Param        format query string false "json (default) or csv"
+// @Success      200 {object} Statement
+// @Failure      400 {object} apierror.Error "invalid input"
+// @Failure      401 {object} apierror.Error "unauthenticated"
+// @Failure      500 {object} apierror.Error "internal error"
+// @Router       /balance/statement [get]
+func StatementHandler(c echo.Context) error {
+	userID, err := auth.CustomerID(c)
+	if err != nil {
+		return err
+	}
+	req, err := parseStatementRequest(c, userID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	if c.QueryParam("format") == "csv" {
+		return writeStatementCSV(c, req)
+	}
+
+	st, err := GetStatement(c.Request().Context(), req)
+	if err != nil {
+		if errors.Is(err, ErrInvalidCursor) {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		app.Logger.Error("get statement", "user_id", req.UserID, "err", err)
+		return err
+	}
+
+	return c.JSON(http.StatusOK, st)
+}
+
+func parseStatementRequest(c echo.Context, userID int64) (StatementRequest, error) {
+	req := StatementRequest{UserID: userID}
+
+	var err error
+	if req.From, err = parseStatementTime(c.QueryParam("from")); err != nil {
+		return req, errors.New("invalid from")
+	}
+	if req.To, err = parseStatementTime(c.QueryParam("to")); err != nil {
+		return req, errors.New("invalid to")
+	}
+	if !req.From.IsZero() && !req.To.IsZero() && !req.From.Before(req.To) {
+		return req, errors.New("from must be before to")
+	}
+
+	if v := c.QueryParam("type"); v != "" {
+		for _, t := range strings.Split(v, ",") {
+			switch tt := transactionType(strings.TrimSpace(t)); tt {
+			case Deposit, Withdrawal, CorrectiveTransaction, Transfer:
+				req.Types = append(req.Types, tt)
+			default:
+				return req, fmt.Errorf("invalid type %q", t)
+			}
+		}
+	}
+
+	if v := c.QueryParam("limit"); v != "" {
+		if req.Limit, err = strconv.Atoi(v); err != nil || req.Limit <= 0 || req.Limit > maxStatementLimit {
+			return req, errors.New("invalid limit")
+		}
+	}
+	req.Cursor = c.QueryParam("cursor")
+	return req, nil
+}
+
+func parseStatementTime(v string) (time.Time, error) {
+	if v == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.ParseInLocation(time.DateOnly, v, time.Local); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, v)
+}
+
+// writeStatementCSV streams every page of the period; the opening and closing balances go in
+// the first and last rows so the file reconciles on its own.
+func writeStatementCSV(c echo.Context, req StatementRequest) error {
+	req.Cursor = ""
+	req.Limit = maxStatementLimit
+
+	res := c.Response()
+	res.Header().Set(echo.HeaderContentType, "text/csv")
+	res.Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=statement-%d.csv", req.UserID))
+
+	w := csv.NewWriter(res)
+	headerWritten := false
+	var closing int64
+	for {
+		st, err := GetStatement(c.Request().Context(), req)
+		if err != nil {
+			app.Logger.Error("export statement", "user_id", req.UserID, "err", err)
+			if !headerWritten {
+				return err
+			}
+			// The status line is already sent; cut the file short so it does not reconcile.
+			return nil
+		}
+		if !headerWritten {
+			res.WriteHeader(http.StatusOK)
+			_ = w.Write([]string{"created_at", "transaction_id", "transaction_type", "amount", "reference_id", "price_version", "description"})
+			_ = w.Write([]string{"", "", "opening_balance", strconv.FormatInt(st.OpeningBalance, 10), "", "", ""})
+			headerWritten = true
+		}
+		for _, l := range st.Transactions {
+			_ = w.Write([]string{
+				l.CreatedAt.Format(time.RFC3339),
+				l.TransactionID,
+				string(l.TransactionType),
+				strconv.FormatInt(l.Amount, 10),
+				l.ReferenceID,
+				l.PriceVersion,
+				l.Description,
+			})
+		}
+		closing = st.ClosingBalance
+		if st.NextCursor == "" {
+			break
+		}
+		req.Cursor = st.NextCursor
+	}
+	_ = w.Write([]string{"", "", "closing_balance", strconv.FormatInt(closing, 10), "", "", ""})
+	w.Flush()
+	return w.Error()
+}
+
+// SubAccountPayload represents the request body for creating a sub-account.
+type SubAccountPayload struct {
+	ChildID      int64  `json:"child_id"`
+	Name         string `json:"name"`
+	ChargeParent bool   `json:"charge_parent"`
+	KeyName      string `json:"key_name"`
+}
+
+// SubAccountUpdatePayload represents the request body for updating a sub-account.
+type SubAccountUpdatePayload struct {
+	Name         string `json:"name"`
+	ChargeParent bool   `json:"charge_parent"`
+}
+
+// LinkSubAccountPayload represents the request body for linking an existing customer as a
+// sub-account.
+type LinkSubAccountPayload struct {
+	ParentID     int64  `json:"parent_id"`
+	Name         string `json:"name"`
+	ChargeParent bool   `json:"charge_parent"`
+}
+
+// TransferPayload represents the request body for moving balance to or from a sub-account.
+type TransferPayload struct {
+	Amount      int64  `json:"amount"`
+	Description string `json:"description"`
+}
+
+// SubAccountPricePayload represents the request body for a sub-account price row.
+type SubAccountPricePayload struct {
+	Type              model.Type `json:"type"`
+	DestinationPrefix string     `json:"destination_prefix"`
+	MinVolume         int        `json:"min_volume"`
+	Price             int64      `json:"price"`
+	EffectiveFrom     *time.Time `json:"effective_from"`
+}
+
+// parentAndChild returns the authenticated customer as the parent and the child_id path param.
+func parentAndChild(c echo.Context) (int64, int64, error) {
+	parentID, err := auth.CustomerID(c)
+	if err != nil {
+		return 0, 0, err
+	}
+	childID, err := strconv.ParseInt(c.Param("child_id"), 10, 64)
+	if err != nil {
+		return 0, 0, echo.NewHTTPError(http.StatusBadRequest, "invalid child_id")
+	}
+	return parentID, childID, nil
+}
+
+// ListSubAccountsHandler godoc
+// @Summary      List sub-accounts
+// @Tags         accounts
+// @Produce      json
+// @Security     BearerAuth
+// @Success      200 {object} map[string]any
+// @Failure      401 {object} apierror.Error "unauthenticated"
+// @Failure      500 {object} apierror.Error "internal error"
+// @Router       /sub-accounts [get]
+func ListSubAccountsHandler(c echo.Context) error {
+	parentID, err := auth.CustomerID(c)
+	if err != nil {
+		return err
+	}
+
+	subs, err := ListSubAccounts(c.Request().Context(), parentID)
+	if err != nil {
+		app.Logger.Error("list sub-accounts", "parent_id", parentID, "err", err)
+		return err
+	}
+
+	out := map[string]any{}
+	out["sub_accounts"] = subs
+
+	return c.JSON(http.StatusOK, out)
+}
+
+// CreateSubAccountHandler godoc
+// @Summary      Create a sub-account
+// @Description  Creates customer child_id with its first API key, which is only returned here, as a sub-account of the authenticated customer. With charge_parent, messages the child cannot pay for are charged to the parent. Existing customers are linked by an admin
+// @Tags         accounts
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        request body SubAccountPayload true "Sub-account"
+// @Success      200 {object} map[string]any "sub-account and key"
+// @Failure      400 {object} apierror.Error "invalid input"
+// @Failure      401 {object} apierror.Error "unauthenticated"
+// @Failure      409 {object} apierror.Error "customer already exists"
+// @Failure      500 {object} apierror.Error "internal error"
+// @Router       /sub-accounts [post]
+func CreateSubAccountHandler(c echo.Context) error {
+	parentID, err := auth.CustomerID(c)
+	if err != nil {
+		return err
+	}
+	var req SubAccountPayload
+	if err := json.NewDecoder(c.Request().Body).Decode(&req); err != nil {
+		app.Logger.Error("invalid input ", "err", err)
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid input")
+	}
+
+	sub, key, err := CreateSubAccount(c.Request().Context(), SubAccount{
+		ParentID:     parentID,
+		ChildID:      req.ChildID,
+		Name:         req.Name,
+		ChargeParent: req.ChargeParent,
+	}, req.KeyName)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrInvalidSubAccount), errors.Is(err, auth.ErrInvalidCustomer):
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		case errors.Is(err, auth.ErrCustomerExists):
+			return echo.NewHTTPError(http.StatusConflict, err.Error())
+		}
+		app.Logger.Error("create sub-account", "parent_id", parentID, "child_id", req.ChildID, "err", err)
+		return err
+	}
+
+	out := map[string]any{}
+	out["sub_account"] = sub
+	out["key"] = key
+
+	return c.JSON(http.StatusOK, out)
+}
+
+// UpdateSubAccountHandler godoc
+// @Summary      Update a sub-account
+// @Description  Changes the name of one of the caller's sub-accounts and whether the caller pays for messages the child cannot
+// @Tags         accounts
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        child_id path int true "Sub-account user ID"
+// @Param        request body SubAccountUpdatePayload true "Sub-account"
+// @Param        Idempotency-Key header string false "Makes the request safe to retry; repeats return the first response"
+// @Success      200 {string} string "done"
+// @Failure      400 {object} apierror.Error "invalid input"
+// @Failure      401 {object} apierror.Error "unauthenticated"
+// @Failure      404 {object} apierror.Error "not a sub-account of the caller"
+// @Failure      500 {object} apierror.Error "internal error"
+// @Router       /sub-accounts/{child_id} [put]
+func UpdateSubAccountHandler(c echo.Context) error {
+	parentID, childID, err := parentAndChild(c)
+	if err != nil {
+		return err
+	}
+	var req SubAccountUpdatePayload
+	if err := json.NewDecoder(c.Request().Body).Decode(&req); err != nil {
+		app.Logger.Error("invalid input ", "err", err)
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid input")
+	}
+
+	if err := UpdateSubAccount(c.Request().Context(), SubAccount{
+		ParentID:     parentID,
+		ChildID:      childID,
+		Name:         req.Name,
+		ChargeParent: req.ChargeParent,
+	}); err != nil {
+		if errors.Is(err, ErrNotSubAccount) {
+			return echo.NewHTTPError(http.StatusNotFound, err.Error())
+		}
+		app.Logger.Error("update sub-account", "parent_id", parentID, "child_id", childID, "err", err)
+		return err
+	}
+
+	return c.JSON(http.StatusOK, "done")
+}
+
+// LinkSubAccountHandler godoc
+// @Summary      Link an existing customer as a sub-account
+// @Description  Makes customer child_id a sub-account of parent_id. The parent sees the child's usage and, with charge_parent, pays for what the child cannot, but cannot take the child's balance
+// @Tags         admin
+// @Accept       json
+// @Produce      json
+// @Security     AdminAuth
+// @Param        child_id path int true "Customer to link"
+// @Param        request body LinkSubAccountPayload true "Link"
+// @Success      200 {string} string "done"
+// @Failure      400 {object} apierror.Error "invalid input"
+// @Failure      401 {object} apierror.Error "unauthenticated"
+// @Failure      500 {object} apierror.Error "internal error"
+// @Router       /admin/sub-accounts/{child_id} [put]
+func LinkSubAccountHandler(c echo.Context) error {
+	childID, err := strconv.ParseInt(c.Param("child_id"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid child_id")
+	}
+	var req LinkSubAccountPayload
+	if err := json.NewDecoder(c.Request().Body).Decode(&req); err != nil {
+		app.Logger.Error("invalid input ", "err", err)
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid input")
+	}
+
+	if err := LinkSubAccount(c.Request().Context(), SubAccount{
+		ParentID:     req.ParentID,
+		ChildID:      childID,
+		Name:         req.Name,
+		ChargeParent: req.ChargeParent,
+	}); err != nil {
+		if errors.Is(err, ErrInvalidSubAccount) {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		app.Logger.Error("link sub-account", "parent_id", req.ParentID, "child_id", childID, "err", err)
+		return err
+	}
+
 	return c.JSON(http.StatusOK, "done")
 }
+
+// TransferHandler godoc
+// @Summary      Transfer balance to or from a sub-account
+// @Description  A positive amount moves the parent's available balance to the child; a negative amount takes the child's back, for sub-accounts the caller created
+// @Tags         accounts
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        child_id path int true "Sub-account user ID"
+// @Param        request body TransferPayload true "Transfer"
+// @Param        Idempotency-Key header string false "Makes the request safe to retry; repeats return the first response"
+// @Success      200 {object} TransferResult
+// @Failure      400 {object} apierror.Error "invalid input"
+// @Failure      401 {object} apierror.Error "unauthenticated"
+// @Failure      402 {object} apierror.Error "insufficient balance"
+// @Failure      404 {object} apierror.Error "not a sub-account of the caller"
+// @Failure      500 {object} apierror.Error "internal error"
+// @Router       /sub-accounts/{child_id}/transfer [post]
+func TransferHandler(c echo.Context) error {
+	parentID, childID, err := parentAndChild(c)
+	if err != nil {
+		return err
+	}
+	var req TransferPayload
+	if err := json.NewDecoder(c.Request().Body).Decode(&req); err != nil {
+		app.Logger.Error("invalid input ", "err", err)
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid input")
+	}
+
+	res, err := TransferBalance(c.Request().Context(), TransferRequest{
+		ParentID:    parentID,
+		ChildID:     childID,
+		Amount:      req.Amount,
+		Description: req.Description,
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrInvalidTransfer):
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		case errors.Is(err, ErrNotSubAccount):
+			return echo.NewHTTPError(http.StatusNotFound, err.Error())
+		case errors.Is(err, ErrInsufficientBalance):
+			return apierror.New(http.StatusPaymentRequired, apierror.InsufficientBalance, err.Error())
+		}
+		app.Logger.Error("transfer balance", "parent_id", parentID, "child_id", childID, "err", err)
+		return err
+	}
+
+	return c.JSON(http.StatusOK, res)
+}
+
+// ListSubAccountPricesHandler godoc
+// @Summary      List a sub-account's prices
+// @Tags         accounts
+// @Produce      json
+// @Security     BearerAuth
+// @Param        child_id path int true "Sub-account user ID"
+// @Success      200 {object} map[string]any
+// @Failure      400 {object} apierror.Error "invalid input"
+// @Failure      401 {object} apierror.Error "unauthenticated"
+// @Failure      404 {object} apierror.Error "not a sub-account of the caller"
+// @Failure      500 {object} apierror.Error "internal error"
+// @Router       /sub-accounts/{child_id}/prices [get]
+func ListSubAccountPricesHandler(c echo.Context) error {
+	parentID, childID, err := parentAndChild(c)
+	if err != nil {
+		return err
+	}
+	if err := CheckSubAccount(c.Request().Context(), parentID, childID); err != nil {
+		if errors.Is(err, ErrNotSubAccount) {
+			return echo.NewHTTPError(http.StatusNotFound, err.Error())
+		}
+		return err
+	}
+
+	prices, err := pricing.ListPrices(c.Request().Context(), &childID)
+	if err != nil {
+		app.Logger.Error("list sub-account prices", "child_id", childID, "err", err)
+		return err
+	}
+
+	out := map[string]any{}
+	out["prices"] = prices
+
+	return c.JSON(http.StatusOK, out)
+}
+
+// CreateSubAccountPriceHandler godoc
+// @Summary      Set a sub-account's price
+// @Description  Adds a price row for the sub-account; it overrides the default list for the child's messages, also when they are charged to the parent. The price must not be below what the caller pays for the destinations and volumes the row covers
+// @Tags         accounts
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        child_id path int true "Sub-account user ID"
+// @Param        request body SubAccountPricePayload true "Price row"
+// @Param        Idempotency-Key header string false "Makes the request safe to retry; repeats return the first response"
+// @Success      200 {object} pricing.Price
+// @Failure      400 {object} apierror.Error "invalid input"
+// @Failure      401 {object} apierror.Error "unauthenticated"
+// @Failure      404 {object} apierror.Error "not a sub-account of the caller"
+// @Failure      500 {object} apierror.Error "internal error"
+// @Router       /sub-accounts/{child_id}/prices [post]
+func CreateSubAccountPriceHandler(c echo.Context) error {
+	parentID, childID, err := parentAndChild(c)
+	if err != nil {
+		return err
+	}
+	var req SubAccountPricePayload
+	if err := json.NewDecoder(c.Request().Body).Decode(&req); err != nil {
+		app.Logger.Error("invalid input ", "err", err)
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid input")
+	}
+	p := pricing.Price{
+		CustomerID:        childID,
+		Type:              req.Type,
+		DestinationPrefix: req.DestinationPrefix,
+		MinVolume:         req.MinVolume,
+		Price:             req.Price,
+	}
+	if req.EffectiveFrom != nil {
+		p.EffectiveFrom = *req.EffectiveFrom
+	}
+	p, err = CreateSubAccountPrice(c.Request().Context(), parentID, p)
+	if err != nil {
+		switch {
+		case errors.Is(err, pricing.ErrInvalidPrice):
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		case errors.Is(err, ErrNotSubAccount):
+			return echo.NewHTTPError(http.StatusNotFound, err.Error())
+		}
+		app.Logger.Error("create sub-account price", "child_id", childID, "err", err)
+		return err
+	}
+
+	return c.JSON(http.StatusOK, p)
+}
+
+// SubAccountUsageHandler godoc
+// @Summary      Aggregated sub-account usage
+// @Description  Delivered messages and their cost per sub-account and type in [from, to), with the part charged to the parent
+// @Tags         accounts
+// @Produce      json
+// @Security     BearerAuth
+// @Param        from query string false "Start (RFC3339 or YYYY-MM-DD), inclusive; defaults to 30 days ago"
+// @Param        to query string false "End (RFC3339 or YYYY-MM-DD), exclusive; defaults to now"
+// @Success      200 {object} map[string]any
+// @Failure      400 {object} apierror.Error "invalid input"
+// @Failure      401 {object} apierror.Error "unauthenticated"
+// @Failure      500 {object} apierror.Error "internal error"
+// @Router       /sub-accounts/usage [get]
+func SubAccountUsageHandler(c echo.Context) error {
+	parentID, err := auth.CustomerID(c)
+	if err != nil {
+		return err
+	}
+	from, err := parseStatementTime(c.QueryParam("from"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid from")
+	}
+	to, err := parseStatementTime(c.QueryParam("to"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid to")
+	}
+	if to.IsZero() {
+		to = time.Now()
+	}
+	if from.IsZero() {
+		from = to.AddDate(0, 0, -30)
+	}
+
+	usage, err := GetSubAccountUsage(c.Request().Context(), parentID, from, to)
+	if err != nil {
+		app.Logger.Error("sub-account usage", "parent_id", parentID, "err", err)
+		return err
+	}
+
+	var messages, amount, paidByParent int64
+	for _, u := range usage {
+		messages += u.Messages
+		amount += u.Amount
+		paidByParent += u.PaidByParent
+	}
+
+	out := map[string]any{}
+	out["from"] = from
+	out["to"] = to
+	out["usage"] = usage
+	out["total"] = map[string]int64{"messages": messages, "amount": amount, "paid_by_parent": paidByParent}
+
+	return c.JSON(http.StatusOK, out)
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
@@ -11,11 +12,19 @@ import (
 	"testing"
 
 	"sms-gateway/app"
+	"sms-gateway/internal/auth"
+
+	"github.com/labstack/echo/v4"
 )
 
 // handlerCtx now comes from main_test.go via testutil.SetupAppTest
 // remove local handlerCtx var; rely on HandlerCtx set by ensureSetup
 
+// authed returns req as authenticated for customerID, like auth.Middleware does.
+func authed(req *http.Request, customerID int64) *http.Request {
+	return req.WithContext(auth.WithCustomer(req.Context(), customerID))
+}
+
 func TestGetBalanceAndHistoryHandler(t *testing.T) {
 	ctx := testutil.EnsureSetup(t)
 	_, err := app.DB.ExecContext(ctx, "INSERT INTO user_balances (user_id, balance) VALUES (?, ?)", 1, 100)
@@ -27,7 +36,7 @@ func TestGetBalanceAndHistoryHandler(t *testing.T) {
 		t.Fatalf("seed tx: %v", err)
 	}
 
-	req := httptest.NewRequest(http.MethodGet, "/balance?user_id=1", nil)
+	req := authed(httptest.NewRequest(http.MethodGet, "/balance", nil), 1)
 	rec := httptest.NewRecorder()
 	c := app.Echo.NewContext(req, rec)
 
@@ -43,15 +52,15 @@ func TestGetBalanceAndHistoryHandler(t *testing.T) {
 	}
 }
 
-func TestGetBalanceAndHistoryHandlerMissingUser(t *testing.T) {
+func TestGetBalanceAndHistoryHandlerUnauthenticated(t *testing.T) {
 	_ = testutil.EnsureSetup(t)
-	req := httptest.NewRequest(http.MethodGet, "/balance", nil)
+	req := httptest.NewRequest(http.MethodGet, "/balance?user_id=1", nil)
 	rec := httptest.NewRecorder()
 	c := app.Echo.NewContext(req, rec)
 
-	err := GetBalanceAndHistoryHandler(c)
-	if err == nil {
-		t.Fatalf("expected error for missing user_id")
+	var he *echo.HTTPError
+	if err := GetBalanceAndHistoryHandler(c); !errors.As(err, &he) || he.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401, got %v", err)
 	}
 }
 
@@ -60,7 +69,7 @@ func TestGetBalanceAndHistoryHandlerCanceledContext(t *testing.T) {
 	cancelCtx, cancel := context.WithCancel(ctx)
 	cancel()
 
-	req := httptest.NewRequest(http.MethodGet, "/balance?user_id=123", nil).WithContext(cancelCtx)
+	req := authed(httptest.NewRequest(http.MethodGet, "/balance", nil).WithContext(cancelCtx), 123)
 	rec := httptest.NewRecorder()
 	c := app.Echo.NewContext(req, rec)
 
@@ -71,7 +80,7 @@ func TestGetBalanceAndHistoryHandlerCanceledContext(t *testing.T) {
 
 func TestAddBalanceHandler(t *testing.T) {
 	ctx := testutil.EnsureSetup(t)
-	payload := AddBalancePayload{UserID: 2, Balance: 20, Description: "test add"}
+	payload := AddBalancePayload{UserID: 2, Balance: 20, Description: "test add", PaymentReference: "pay-2"}
 	b, _ := json.Marshal(payload)
 	req := httptest.NewRequest(http.MethodPost, "/balance/add", bytes.NewReader(b))
 	req.Header.Set("Content-Type", "application/json")
@@ -105,12 +114,55 @@ func TestAddBalanceHandlerInvalid(t *testing.T) {
 	}
 }
 
+func TestAddBalanceHandlerMissingPaymentReference(t *testing.T) {
+	_ = testutil.EnsureSetup(t)
+	b, _ := json.Marshal(AddBalancePayload{UserID: 2, Balance: 20})
+	req := httptest.NewRequest(http.MethodPost, "/balance/add", bytes.NewReader(b))
+	c := app.Echo.NewContext(req, httptest.NewRecorder())
+
+	var he *echo.HTTPError
+	if err := AddBalanceHandler(c); !errors.As(err, &he) || he.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %v", err)
+	}
+}
+
+func TestAddBalanceHandlerRejectsNonPositiveInput(t *testing.T) {
+	_ = testutil.EnsureSetup(t)
+	for _, body := range []string{
+		`{"user_id": 0, "balance": 20, "payment_reference": "pay-0"}`,
+		`{"user_id": -4, "balance": 20, "payment_reference": "pay-0"}`,
+		`{"user_id": 2, "balance": 0, "payment_reference": "pay-0"}`,
+		`{"user_id": 2, "balance": 18446744073709551615, "payment_reference": "pay-0"}`,
+		`{"user_id": 2, "balance": -5, "payment_reference": "pay-0"}`,
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/balance/add", bytes.NewReader([]byte(body)))
+		c := app.Echo.NewContext(req, httptest.NewRecorder())
+
+		var he *echo.HTTPError
+		if err := AddBalanceHandler(c); !errors.As(err, &he) || he.Code != http.StatusBadRequest {
+			t.Fatalf("expected 400 for %s, got %v", body, err)
+		}
+	}
+}
+
+func TestRefundHandlerPartialWithoutKey(t *testing.T) {
+	_ = testutil.EnsureSetup(t)
+	b, _ := json.Marshal(RefundPayload{UserID: 2, TransactionID: "tx", Amount: 30})
+	req := httptest.NewRequest(http.MethodPost, "/admin/refunds", bytes.NewReader(b))
+	c := app.Echo.NewContext(req, httptest.NewRecorder())
+
+	var he *echo.HTTPError
+	if err := RefundHandler(c); !errors.As(err, &he) || he.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %v", err)
+	}
+}
+
 func TestAddBalanceHandlerCanceledContext(t *testing.T) {
 	ctx := testutil.EnsureSetup(t)
 	cancelCtx, cancel := context.WithCancel(ctx)
 	cancel()
 
-	payload := AddBalancePayload{UserID: 3, Balance: 10, Description: "ctx canceled"}
+	payload := AddBalancePayload{UserID: 3, Balance: 10, Description: "ctx canceled", PaymentReference: "pay-3"}
 	b, _ := json.Marshal(payload)
 	req := httptest.NewRequest(http.MethodPost, "/balance/add", bytes.NewReader(b)).WithContext(cancelCtx)
 	req.Header.Set("Content-Type", "application/json")
@@ -121,3 +173,37 @@ func TestAddBalanceHandlerCanceledContext(t *testing.T) {
 		t.Fatalf("expected error due to canceled context")
 	}
 }
+
+func TestStatementHandlerCSV(t *testing.T) {
+	ctx := testutil.EnsureSetup(t)
+	testutil.ResetTables(ctx, t)
+	if _, err := AddBalance(ctx, AddBalanceRequest{CustomerID: 802, Amount: 30, Description: "top-up"}); err != nil {
+		t.Fatalf("add balance: %v", err)
+	}
+
+	req := authed(httptest.NewRequest(http.MethodGet, "/balance/statement?format=csv", nil), 802)
+	rec := httptest.NewRecorder()
+	c := app.Echo.NewContext(req, rec)
+
+	if err := StatementHandler(c); err != nil {
+		t.Fatalf("handler err: %v", err)
+	}
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "text/csv" {
+		t.Fatalf("unexpected response %d %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	body := rec.Body.String()
+	if !bytes.Contains(rec.Body.Bytes(), []byte(",opening_balance,0,")) || !bytes.Contains(rec.Body.Bytes(), []byte(",closing_balance,30,")) {
+		t.Fatalf("unexpected csv: %s", body)
+	}
+}
+
+func TestStatementHandlerInvalidInput(t *testing.T) {
+	_ = testutil.EnsureSetup(t)
+	for _, q := range []string{"from=yesterday", "type=bonus", "from=2026-02-01&to=2026-01-01", "limit=0"} {
+		req := authed(httptest.NewRequest(http.MethodGet, "/balance/statement?"+q, nil), 1)
+		c := app.Echo.NewContext(req, httptest.NewRecorder())
+		if err := StatementHandler(c); err == nil {
+			t.Fatalf("expected error for %q", q)
+		}
+	}
+}
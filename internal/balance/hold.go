@@ -0,0 +1,361 @@
+package balance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"sms-gateway/app"
+	"sms-gateway/internal/ledger"
+	"sms-gateway/internal/model"
+	"sms-gateway/internal/pricing"
+	"sms-gateway/pkg/metrics"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+type holdStatus string
+
+const (
+	HoldHeld     holdStatus = "held"
+	HoldCaptured holdStatus = "captured"
+	HoldReleased holdStatus = "released"
+	// HoldExpired is a hold released by the expirer; a late delivery still captures it.
+	HoldExpired holdStatus = "expired"
+)
+
+var ErrNoActiveHold = errors.New("no active hold for transaction")
+
+type hold struct {
+	ID           int64      `db:"id"`
+	UserID       int64      `db:"user_id"`
+	Type         model.Type `db:"type"`
+	Amount       int64      `db:"amount"`
+	PriceVersion string     `db:"price_version"`
+	Shard        int        `db:"shard"`
+}
+
+// insertHoldsTx writes one hold per quote line. payerID is whose balance is reserved: the
+// customer itself, or its parent when the charge fell back to it; shard is where.
+func insertHoldsTx(ctx context.Context, tx *sqlx.Tx, req ChargeRequest, payerID int64, shard int, txID string, q pricing.Quote, ttl time.Duration) error {
+	const prefix = `INSERT INTO balance_holds (transaction_id, user_id, customer_id, sms_identifier, recipient, type, destination_prefix, price_version, amount, shard, status, expires_at) VALUES `
+	execFn := metrics.DBExecObserver("insert_balance_holds", func(c context.Context) error {
+		valueStrings := make([]string, 0, len(q.Lines))
+		args := make([]any, 0, len(q.Lines)*12)
+		for _, l := range q.Lines {
+			version := pricing.BuiltinVersion
+			if l.PriceID != 0 {
+				version = fmt.Sprint(l.PriceID)
+			}
+			valueStrings = append(valueStrings, "(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP + INTERVAL ? SECOND)")
+			args = append(args, txID, payerID, req.CustomerID, req.SmsIdentifier, l.Recipient, req.Type, l.DestinationPrefix, version, l.Price, shard, HoldHeld, int64(ttl.Seconds()))
+		}
+		_, err := tx.ExecContext(c, prefix+strings.Join(valueStrings, ","), args...)
+		return err
+	})
+	return execFn(ctx)
+}
+
+// lockHoldsTx locks the holds of s.TransactionID in status, limited to s.Recipients when set.
+func lockHoldsTx(ctx context.Context, tx *sqlx.Tx, s model.SMS, status holdStatus) ([]hold, error) {
+	if s.TransactionID == "" {
+		return nil, errors.New("transaction_id is required")
+	}
+
+	query := `SELECT id, user_id, type, amount, price_version, shard FROM balance_holds WHERE transaction_id = ? AND status = ?`
+	args := []any{s.TransactionID, status}
+	if len(s.Recipients) > 0 {
+		query += ` AND recipient IN (?` + strings.Repeat(",?", len(s.Recipients)-1) + `)`
+		for _, r := range s.Recipients {
+			args = append(args, r)
+		}
+	}
+	query += ` FOR UPDATE`
+
+	var holds []hold
+	queryFn := metrics.DBExecObserver("select_balance_holds_for_update", func(c context.Context) error {
+		return tx.SelectContext(c, &holds, query, args...)
+	})
+	if err := queryFn(ctx); err != nil {
+		return nil, err
+	}
+	return holds, nil
+}
+
+func setHoldStatusTx(ctx context.Context, tx *sqlx.Tx, holds []hold, status holdStatus) error {
+	args := make([]any, 0, len(holds)+1)
+	args = append(args, status)
+	for _, h := range holds {
+		args = append(args, h.ID)
+	}
+	q := `UPDATE balance_holds SET status = ? WHERE id IN (?` + strings.Repeat(",?", len(holds)-1) + `)`
+	execFn := metrics.DBExecObserver("update_balance_holds_status", func(c context.Context) error {
+		_, err := tx.ExecContext(c, q, args...)
+		return err
+	})
+	return execFn(ctx)
+}
+
+// Capture runs CaptureTx in its own DB transaction.
+func Capture(ctx context.Context, s model.SMS) (err error) {
+	tx, err := app.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	if err = CaptureTx(ctx, tx, s); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// CaptureTx debits the active holds of the delivered recipients and records one withdrawal
+// referencing the original transaction, mirrored by a wallet -> revenue journal. Holds already captured or released are skipped,
+// so redelivered messages are not charged twice. Holds that expired before the delivery was
+// reported gave their amount back already; the message went out, so it is charged from the
+// balance again, which may leave it negative. Expired holds are charged to the user_balances
+// row, since the shard they were reserved on may have been retired since.
+func CaptureTx(ctx context.Context, tx *sqlx.Tx, s model.SMS) error {
+	if tx == nil {
+		return errors.New("tx is required")
+	}
+	active, err := lockHoldsTx(ctx, tx, s, HoldHeld)
+	if err != nil {
+		return err
+	}
+	expired, err := lockHoldsTx(ctx, tx, s, HoldExpired)
+	if err != nil {
+		return err
+	}
+	holds := append(active, expired...)
+	if len(holds) == 0 {
+		return nil
+	}
+	if len(expired) > 0 {
+		app.Logger.Warn("capturing expired holds", "user_id", expired[0].UserID, "transaction_id", s.TransactionID, "count", len(expired))
+		metrics.ExpiredHoldsCaptured(len(expired))
+	}
+
+	var amount, held int64
+	versions := map[string]struct{}{}
+	for _, h := range holds {
+		amount += h.Amount
+		versions[h.PriceVersion] = struct{}{}
+	}
+	for _, h := range active {
+		held += h.Amount
+	}
+	lapsed := amount - held
+	// The holds of one charge share the payer and the shard.
+	userID := holds[0].UserID
+
+	if err := setHoldStatusTx(ctx, tx, holds, HoldCaptured); err != nil {
+		return err
+	}
+	if len(active) > 0 {
+		if err := adjustShardTx(ctx, tx, "update_balance_capture", userID, active[0].Shard, -held, -held); err != nil {
+			return err
+		}
+	}
+	if err := adjustShardTx(ctx, tx, "update_balance_capture", userID, 0, -lapsed, 0); err != nil {
+		return err
+	}
+
+	// Each hold keeps its own price row; the withdrawal names it only when they all agree, as
+	// a list of every row used does not fit the column.
+	var version string
+	if len(versions) == 1 {
+		version = holds[0].PriceVersion
+	}
+
+	captureTxID := uuid.NewString()
+	const insertTxn = `INSERT INTO user_transactions (user_id, amount, transaction_type, description, transaction_id, reference_id, price_version) VALUES (?, ?, ?, ?, ?, ?, NULLIF(?, ''))`
+	if err := metrics.DBExecObserver("insert_capture_txn", func(c context.Context) error {
+		_, execErr := tx.ExecContext(c, insertTxn,
+			userID,
+			-amount,
+			Withdrawal,
+			fmt.Sprintf("بابت خرید %d پیامک تایپ %s", len(holds), holds[0].Type),
+			captureTxID,
+			s.TransactionID,
+			version)
+		return execErr
+	})(ctx); err != nil {
+		return err
+	}
+
+	return ledger.PostTx(ctx, tx, ledger.Transfer(ledger.JournalCapture, captureTxID, userID, ledger.WalletAccount(userID), ledger.Revenue, amount))
+}
+
+// Release runs ReleaseTx in its own DB transaction.
+func Release(ctx context.Context, s model.SMS) (err error) {
+	tx, err := app.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	if err = ReleaseTx(ctx, tx, s); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ReleaseTx gives back the active holds of the failed recipients (all recipients when
+// s.Recipients is empty). Nothing was debited, so no transaction is recorded.
+func ReleaseTx(ctx context.Context, tx *sqlx.Tx, s model.SMS) error {
+	if tx == nil {
+		return errors.New("tx is required")
+	}
+	holds, err := lockHoldsTx(ctx, tx, s, HoldHeld)
+	if err != nil || len(holds) == 0 {
+		return err
+	}
+	return releaseHoldsTx(ctx, tx, holds, HoldReleased)
+}
+
+// releaseHoldsTx gives back holds and leaves them in status, HoldReleased or HoldExpired.
+func releaseHoldsTx(ctx context.Context, tx *sqlx.Tx, holds []hold, status holdStatus) error {
+	if err := setHoldStatusTx(ctx, tx, holds, status); err != nil {
+		return err
+	}
+
+	type shardKey struct {
+		userID int64
+		shard  int
+	}
+	perShard := map[shardKey]int64{}
+	for _, h := range holds {
+		perShard[shardKey{h.UserID, h.Shard}] += h.Amount
+	}
+	// Release in key order so concurrent expiry batches lock balance rows in the same order.
+	keys := make([]shardKey, 0, len(perShard))
+	for k := range perShard {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].userID != keys[j].userID {
+			return keys[i].userID < keys[j].userID
+		}
+		return keys[i].shard < keys[j].shard
+	})
+	for i, k := range keys {
+		if err := adjustShardTx(ctx, tx, "update_balance_release", k.userID, k.shard, 0, -perShard[k]); err != nil {
+			return err
+		}
+		if i == len(keys)-1 || keys[i+1].userID != k.userID {
+			if err := rearmAlertsTx(ctx, tx, k.userID); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// ExtendHoldsTx moves the expiry of the transaction's active holds to now + ttl.
+// It returns ErrNoActiveHold when they already expired or were settled.
+func ExtendHoldsTx(ctx context.Context, tx *sqlx.Tx, transactionID string, ttl time.Duration) error {
+	const q = `UPDATE balance_holds SET expires_at = CURRENT_TIMESTAMP + INTERVAL ? SECOND WHERE transaction_id = ? AND status = ?`
+	var rows int64
+	if err := metrics.DBExecObserver("update_balance_holds_expiry", func(c context.Context) error {
+		res, err := tx.ExecContext(c, q, int64(ttl.Seconds()), transactionID, HoldHeld)
+		if err != nil {
+			return err
+		}
+		rows, err = res.RowsAffected()
+		return err
+	})(ctx); err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrNoActiveHold
+	}
+	return nil
+}
+
+const expireBatchSize = 500
+
+// StartHoldExpirer periodically releases holds that were neither captured nor released in time.
+// Holds of messages still waiting for review are left to sms.StartHeldExpirer, which rejects the
+// message and releases them together.
+func StartHoldExpirer(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		for {
+			n, err := releaseExpired(ctx, expireBatchSize)
+			if err != nil {
+				app.Logger.Error("release expired holds", "err", err)
+				break
+			}
+			if n > 0 {
+				app.Logger.Info("released expired holds", "count", n)
+			}
+			if n < expireBatchSize {
+				break
+			}
+		}
+	}
+}
+
+func releaseExpired(ctx context.Context, limit int) (_ int, err error) {
+	tx, err := app.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	const selectQ = `
+		SELECT id, user_id, type, amount, price_version, shard
+		FROM balance_holds
+		WHERE status = ? AND expires_at <= CURRENT_TIMESTAMP
+		  AND NOT EXISTS (
+			SELECT 1 FROM held_messages m
+			WHERE m.transaction_id = balance_holds.transaction_id AND m.status = 'held'
+		  )
+		ORDER BY id
+		LIMIT ?
+		FOR UPDATE SKIP LOCKED
+	`
+	var holds []hold
+	if err = metrics.DBExecObserver("select_expired_holds", func(c context.Context) error {
+		return tx.SelectContext(c, &holds, selectQ, HoldHeld, limit)
+	})(ctx); err != nil {
+		return 0, err
+	}
+	if len(holds) == 0 {
+		return 0, tx.Commit()
+	}
+
+	if err = releaseHoldsTx(ctx, tx, holds, HoldExpired); err != nil {
+		return 0, err
+	}
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+	return len(holds), nil
+}
@@ -0,0 +1,220 @@
+package balance
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"sms-gateway/app"
+	"sms-gateway/internal/ledger"
+	"sms-gateway/pkg/metrics"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+// FullRefundKey is the refund key used when a full refund (Amount 0) does not pass one, so that
+// repeated "refund everything" calls for the same charge collapse into one refund.
+const FullRefundKey = "full"
+
+var (
+	ErrTransactionNotFound = errors.New("transaction not found")
+	ErrRefundExceedsCharge = errors.New("refund exceeds the charged amount")
+	ErrRefundKeyRequired   = errors.New("key is required for a partial refund")
+)
+
+type RefundRequest struct {
+	CustomerID int64
+	// TransactionID is the charge to refund: a withdrawal's own transaction_id or the
+	// transaction_id returned by ChargeTx (captures reference it).
+	TransactionID string
+	// Amount to refund; 0 refunds whatever has not been refunded yet.
+	Amount int64
+	// Key makes the refund idempotent per charge; a replay returns the first refund. Partial
+	// refunds need one each; a full refund defaults to FullRefundKey.
+	Key    string
+	Reason string
+}
+
+type RefundRecord struct {
+	ID                    int64  `db:"id" json:"id"`
+	UserID                int64  `db:"user_id" json:"user_id"`
+	OriginalTransactionID string `db:"original_transaction_id" json:"original_transaction_id"`
+	RefundTransactionID   string `db:"refund_transaction_id" json:"refund_transaction_id"`
+	Amount                int64  `db:"amount" json:"amount"`
+	RefundKey             string `db:"refund_key" json:"refund_key"`
+	Reason                string `db:"reason" json:"reason"`
+	CreatedAt             string `db:"created_at" json:"created_at"`
+}
+
+// Refund runs RefundTx in its own DB transaction.
+func Refund(ctx context.Context, req RefundRequest) (_ RefundRecord, err error) {
+	tx, err := app.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return RefundRecord{}, err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	r, err := RefundTx(ctx, tx, req)
+	if err != nil {
+		return RefundRecord{}, err
+	}
+	if err = tx.Commit(); err != nil {
+		return RefundRecord{}, err
+	}
+	return r, nil
+}
+
+// RefundTx credits back (part of) a charge and records a corrective transaction referencing it.
+// The money goes to whoever paid: the customer, or its parent when the charge fell back to it,
+// as the withdrawals of the charge record. They are locked while refunding, so concurrent
+// refunds are serialised and their total never exceeds the charged amount. A refund with an
+// already used key returns the existing refund instead of paying again.
+func RefundTx(ctx context.Context, tx *sqlx.Tx, req RefundRequest) (RefundRecord, error) {
+	if tx == nil {
+		return RefundRecord{}, errors.New("tx is required")
+	}
+	if req.TransactionID == "" {
+		return RefundRecord{}, errors.New("transaction_id is required for refund")
+	}
+	if req.CustomerID == 0 {
+		return RefundRecord{}, errors.New("customer_id is required for refund")
+	}
+	if req.Amount < 0 {
+		return RefundRecord{}, errors.New("refund amount must not be negative")
+	}
+	if req.Key == "" {
+		if req.Amount > 0 {
+			return RefundRecord{}, ErrRefundKeyRequired
+		}
+		req.Key = FullRefundKey
+	}
+
+	// A charge is the customer's when it paid for it or when the holds it captured were placed
+	// for its messages, which is how a parent's captures for a sub-account are found.
+	const selectCharge = `
+		SELECT user_id, amount FROM user_transactions
+		WHERE transaction_type = ? AND (transaction_id = ? OR reference_id = ?)
+			AND (user_id = ? OR EXISTS (SELECT 1 FROM balance_holds WHERE transaction_id = ? AND customer_id = ?))
+		FOR UPDATE
+	`
+	var withdrawals []struct {
+		UserID int64 `db:"user_id"`
+		Amount int64 `db:"amount"`
+	}
+	if err := metrics.DBExecObserver("select_refund_txn", func(c context.Context) error {
+		return tx.SelectContext(c, &withdrawals, selectCharge, Withdrawal, req.TransactionID, req.TransactionID, req.CustomerID, req.TransactionID, req.CustomerID)
+	})(ctx); err != nil {
+		return RefundRecord{}, err
+	}
+	if len(withdrawals) == 0 {
+		return RefundRecord{}, ErrTransactionNotFound
+	}
+	// The withdrawals of one charge share the payer.
+	payerID := withdrawals[0].UserID
+	var charged int64
+	for _, w := range withdrawals {
+		charged -= w.Amount
+	}
+
+	existing, err := getRefundTx(ctx, tx, req.TransactionID, req.Key)
+	if err == nil {
+		return existing, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return RefundRecord{}, err
+	}
+
+	var refunded int64
+	const sumRefunds = `SELECT COALESCE(SUM(amount), 0) FROM refunds WHERE original_transaction_id = ?`
+	if err := metrics.DBExecObserver("select_refunded_amount", func(c context.Context) error {
+		return tx.GetContext(c, &refunded, sumRefunds, req.TransactionID)
+	})(ctx); err != nil {
+		return RefundRecord{}, err
+	}
+
+	remaining := charged - refunded
+	amount := req.Amount
+	if amount == 0 {
+		if remaining == 0 && refunded > 0 {
+			// Partial refunds already gave everything back; there is nothing left to refund.
+			return lastRefundTx(ctx, tx, req.TransactionID)
+		}
+		amount = remaining
+	}
+	if amount <= 0 || amount > remaining {
+		return RefundRecord{}, ErrRefundExceedsCharge
+	}
+
+	const updateBalance = `UPDATE user_balances SET balance = balance + ? WHERE user_id = ?`
+	if err := metrics.DBExecObserver("update_balance_refund", func(c context.Context) error {
+		_, execErr := tx.ExecContext(c, updateBalance, amount, payerID)
+		return execErr
+	})(ctx); err != nil {
+		return RefundRecord{}, err
+	}
+
+	refundTxID := uuid.NewString()
+	desc := fmt.Sprintf("%s :  تراکنش اصلاحی برای  ", req.TransactionID)
+	const insertTxn = `INSERT INTO user_transactions (user_id, amount, transaction_type, description, transaction_id, reference_id) VALUES (?, ?, ?, ?, ?, ?)`
+	if err := metrics.DBExecObserver("insert_refund_txn", func(c context.Context) error {
+		_, execErr := tx.ExecContext(c, insertTxn, payerID, amount, CorrectiveTransaction, desc, refundTxID, req.TransactionID)
+		return execErr
+	})(ctx); err != nil {
+		return RefundRecord{}, err
+	}
+
+	const insertRefund = `INSERT INTO refunds (user_id, original_transaction_id, refund_transaction_id, amount, refund_key, reason) VALUES (?, ?, ?, ?, ?, ?)`
+	if err := metrics.DBExecObserver("insert_refund", func(c context.Context) error {
+		_, execErr := tx.ExecContext(c, insertRefund, payerID, req.TransactionID, refundTxID, amount, req.Key, req.Reason)
+		return execErr
+	})(ctx); err != nil {
+		return RefundRecord{}, err
+	}
+
+	if err := ledger.PostTx(ctx, tx, ledger.Transfer(ledger.JournalRefund, refundTxID, payerID, ledger.Refunds, ledger.WalletAccount(payerID), amount)); err != nil {
+		return RefundRecord{}, err
+	}
+
+	if err := rearmAlertsTx(ctx, tx, payerID); err != nil {
+		return RefundRecord{}, err
+	}
+
+	return getRefundTx(ctx, tx, req.TransactionID, req.Key)
+}
+
+func getRefundTx(ctx context.Context, tx *sqlx.Tx, transactionID, key string) (RefundRecord, error) {
+	const q = `SELECT id, user_id, original_transaction_id, refund_transaction_id, amount, refund_key, reason, created_at FROM refunds WHERE original_transaction_id = ? AND refund_key = ?`
+	var r RefundRecord
+	err := metrics.DBExecObserver("select_refund", func(c context.Context) error {
+		return tx.GetContext(c, &r, q, transactionID, key)
+	})(ctx)
+	return r, err
+}
+
+func lastRefundTx(ctx context.Context, tx *sqlx.Tx, transactionID string) (RefundRecord, error) {
+	const q = `SELECT id, user_id, original_transaction_id, refund_transaction_id, amount, refund_key, reason, created_at FROM refunds WHERE original_transaction_id = ? ORDER BY id DESC LIMIT 1`
+	var r RefundRecord
+	err := metrics.DBExecObserver("select_last_refund", func(c context.Context) error {
+		return tx.GetContext(c, &r, q, transactionID)
+	})(ctx)
+	return r, err
+}
+
+// ListRefunds returns the refunds of one original charge, oldest first.
+func ListRefunds(ctx context.Context, transactionID string) ([]RefundRecord, error) {
+	const q = `SELECT id, user_id, original_transaction_id, refund_transaction_id, amount, refund_key, reason, created_at FROM refunds WHERE original_transaction_id = ? ORDER BY id`
+	var out []RefundRecord
+	queryFn := metrics.DBExecObserver("select_refunds", func(c context.Context) error {
+		return app.DB.SelectContext(c, &out, q, transactionID)
+	})
+	if err := queryFn(ctx); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
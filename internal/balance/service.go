@@ -6,7 +6,10 @@ import (
 	"errors"
 	"fmt"
 	"sms-gateway/app"
+	"sms-gateway/config"
+	"sms-gateway/internal/ledger"
 	"sms-gateway/internal/model"
+	"sms-gateway/internal/pricing"
 	"sms-gateway/pkg/metrics"
 	"time"
 
@@ -21,6 +24,7 @@ const (
 	Withdrawal            transactionType = "withdrawal"
 	Deposit               transactionType = "deposit"
 	CorrectiveTransaction transactionType = "Corrective"
+	Transfer              transactionType = "transfer"
 )
 
 var ErrInsufficientBalance = errors.New("insufficient balance")
@@ -33,7 +37,7 @@ type UserHasEnoughBalanceRequest struct {
 
 func UserHasBalance(ctx context.Context, req UserHasEnoughBalanceRequest) (bool, error) {
 
-	const query = `SELECT balance FROM user_balances WHERE user_id = ?`
+	const query = `SELECT ` + totalAvailableExpr + ` + CASE WHEN b.account_mode = 'postpaid' THEN b.credit_limit ELSE 0 END FROM user_balances b WHERE b.user_id = ?`
 	var balance int64
 	if err := app.DB.QueryRowxContext(ctx, query, req.CustomerID).Scan(&balance); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
@@ -42,53 +46,124 @@ func UserHasBalance(ctx context.Context, req UserHasEnoughBalanceRequest) (bool,
 		return false, err
 	}
 
-	price := calculatePrice(req.Type, req.Quantity)
-	return balance >= price, nil
+	q, err := pricing.Get(ctx, pricing.QuoteRequest{CustomerID: req.CustomerID, Type: req.Type, Quantity: req.Quantity})
+	if err != nil {
+		return false, err
+	}
+	return balance >= q.Total, nil
 }
 
 type ChargeRequest struct {
 	CustomerID int64
 	Quantity   int
 	Type       model.Type
+	// Recipients, when set, are priced by destination prefix; otherwise Quantity is used.
+	Recipients []string
+	// SmsIdentifier is stored on the holds for traceability.
+	SmsIdentifier string
+	// HoldTTL overrides HOLD_TTL_SEC, e.g. for messages parked for manual review.
+	HoldTTL time.Duration
 }
 
-// ChargeTx atomically checks and deducts user balance and records a withdrawal transaction
-// using the provided DB transaction.
+// ChargeTx atomically checks the available balance (balance - held, plus the credit limit
+// for postpaid accounts) and places a hold per recipient using the provided DB transaction. Nothing is debited yet: holds are captured
+// per recipient on successful delivery and released on failure or expiry.
+// A sub-account with charge_parent set is charged to its parent when its own balance is short;
+// the price is still the sub-account's.
+// It returns the transaction_id grouping the holds.
 func ChargeTx(ctx context.Context, tx *sqlx.Tx, req ChargeRequest) (string, error) {
 	if tx == nil {
 		return "", errors.New("tx is required")
 	}
-	price := calculatePrice(req.Type, req.Quantity)
-
-	const updateBalanceQuery = `UPDATE user_balances SET balance = balance - ? WHERE user_id = ? AND balance >= ?`
-	res, err := tx.ExecContext(ctx, updateBalanceQuery, price, req.CustomerID, price)
+	q, err := pricing.Get(ctx, pricing.QuoteRequest{
+		CustomerID: req.CustomerID,
+		Type:       req.Type,
+		Recipients: req.Recipients,
+		Quantity:   req.Quantity,
+	})
 	if err != nil {
 		return "", err
 	}
+	price := q.Total
 
-	rows, err := res.RowsAffected()
+	payerID := req.CustomerID
+	shard, ok, err := placeHoldTx(ctx, tx, payerID, price)
 	if err != nil {
 		return "", err
 	}
-	if rows == 0 {
-		return "", ErrInsufficientBalance
+	if !ok {
+		// Sub-accounts with charge_parent fall back to the parent's balance.
+		parentID, found, err := chargeParentTx(ctx, tx, req.CustomerID)
+		if err != nil {
+			return "", err
+		}
+		if !found {
+			return "", ErrInsufficientBalance
+		}
+		if shard, ok, err = placeHoldTx(ctx, tx, parentID, price); err != nil {
+			return "", err
+		}
+		if !ok {
+			return "", ErrInsufficientBalance
+		}
+		payerID = parentID
+	}
+
+	ttl := req.HoldTTL
+	if ttl <= 0 {
+		ttl = time.Duration(config.HoldTTLSec) * time.Second
 	}
 
 	txID := uuid.NewString()
-	const insertTransactionQuery = `INSERT INTO user_transactions (user_id, amount, transaction_type, description, transaction_id) VALUES (?, ?, ?, ?, ?)`
-	if _, err = tx.ExecContext(ctx,
-		insertTransactionQuery,
-		req.CustomerID,
-		-price,
-		Withdrawal,
-		fmt.Sprintf("بابت خرید %d پیامک تایپ %s", req.Quantity, req.Type),
-		txID); err != nil {
+	if err := insertHoldsTx(ctx, tx, req, payerID, shard, txID, q, ttl); err != nil {
+		return "", err
+	}
+	if err := checkCreditThresholdTx(ctx, tx, payerID, txID, price); err != nil {
+		return "", err
+	}
+	if err := fireLowBalanceAlertsTx(ctx, tx, payerID, txID); err != nil {
 		return "", err
 	}
 
 	return txID, nil
 }
 
+// placeHoldTx reserves price on the user's balance if it is spendable; ok is false otherwise.
+// It returns the shard the hold was placed on (0 is the user_balances row).
+func placeHoldTx(ctx context.Context, tx *sqlx.Tx, userID, price int64) (int, bool, error) {
+	if shard, ok, err := holdOnShardTx(ctx, tx, userID, price); err != nil || ok {
+		return shard, ok, err
+	}
+	if ok, err := holdOnMainTx(ctx, tx, userID, price); err != nil || ok {
+		return 0, ok, err
+	}
+	// A sharded balance can cover price in total without any single shard covering it.
+	moved, err := pullShardsTx(ctx, tx, userID, price)
+	if err != nil || moved == 0 {
+		return 0, false, err
+	}
+	ok, err := holdOnMainTx(ctx, tx, userID, price)
+	return 0, ok, err
+}
+
+// holdOnMainTx reserves price on the user_balances row if it is spendable.
+func holdOnMainTx(ctx context.Context, tx *sqlx.Tx, userID, price int64) (bool, error) {
+	const q = `UPDATE user_balances SET held = held + ? WHERE user_id = ? AND ` + spendableExpr + ` >= ?`
+	var rows int64
+	execFn := metrics.DBExecObserver("update_balance_hold", func(c context.Context) error {
+		res, err := tx.ExecContext(c, q, price, userID, price)
+		if err != nil {
+			return err
+		}
+		rows, err = res.RowsAffected()
+		return err
+	})
+	if err := execFn(ctx); err != nil {
+		return false, err
+	}
+	return rows > 0, nil
+}
+
 // Charge runs ChargeTx in its own DB transaction.
 func Charge(ctx context.Context, req ChargeRequest) (string, error) {
 	tx, err := app.DB.BeginTxx(ctx, nil)
@@ -118,14 +193,26 @@ type UserTransaction struct {
 	TransactionType transactionType `db:"transaction_type"`
 	Description     string          `db:"description"`
 	TransactionID   string          `db:"transaction_id" json:"transaction_id"`
+	PriceVersion    string          `db:"price_version" json:"price_version,omitempty"`
+	CreatedAt       time.Time       `db:"created_at" json:"created_at"`
 }
 
+// recentTransactionsLimit bounds GetUserTransactions; the full history is paged through GetStatement.
+const recentTransactionsLimit = 50
+
+// GetUserTransactions returns the user's latest transactions, newest first.
 func GetUserTransactions(ctx context.Context, userID string) ([]UserTransaction, error) {
-	const query = `SELECT user_id, amount, transaction_type, description, transaction_id FROM user_transactions WHERE user_id = ?`
+	const query = `
+		SELECT user_id, amount, transaction_type, description, transaction_id, COALESCE(price_version, '') AS price_version, created_at
+		FROM user_transactions
+		WHERE user_id = ?
+		ORDER BY created_at DESC, id DESC
+		LIMIT ?
+	`
 
 	var transactions []UserTransaction
 	queryFn := metrics.DBExecObserver("select_user_transactions", func(c context.Context) error {
-		return app.DB.SelectContext(c, &transactions, query, userID)
+		return app.DB.SelectContext(c, &transactions, query, userID, recentTransactionsLimit)
 	})
 	if err := queryFn(ctx); err != nil {
 		return nil, err
@@ -134,9 +221,41 @@ func GetUserTransactions(ctx context.Context, userID string) ([]UserTransaction,
 	return transactions, nil
 }
 
+// Balances splits a user's balance into what is spendable and what is reserved by holds.
+// Available goes negative on postpaid accounts, down to -CreditLimit.
+type Balances struct {
+	Balance     int64       `db:"balance" json:"balance"`
+	Held        int64       `db:"held" json:"held"`
+	Available   int64       `db:"available" json:"available"`
+	AccountMode AccountMode `db:"account_mode" json:"account_mode"`
+	CreditLimit int64       `db:"credit_limit" json:"credit_limit"`
+	// Shards is the number of rows the balance is spread over besides the main one.
+	Shards int `db:"shards" json:"shards,omitempty"`
+}
+
+func GetUserBalances(ctx context.Context, userID string) (Balances, error) {
+	const query = `
+		SELECT ` + totalBalanceExpr + ` AS balance, ` + totalHeldExpr + ` AS held, ` + totalAvailableExpr + ` AS available,
+		       b.account_mode, b.credit_limit, b.shards
+		FROM user_balances b
+		WHERE b.user_id = ?
+	`
+	out := Balances{AccountMode: Prepaid}
+	queryFn := metrics.DBExecObserver("select_user_balances", func(c context.Context) error {
+		return app.DB.GetContext(c, &out, query, userID)
+	})
+	if err := queryFn(ctx); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Balances{AccountMode: Prepaid}, nil
+		}
+		return Balances{}, err
+	}
+	return out, nil
+}
+
 func GetUserBalance(ctx context.Context, userID string) (int64, error) {
 
-	const query = `SELECT balance FROM user_balances WHERE user_id = ?`
+	const query = `SELECT ` + totalBalanceExpr + ` FROM user_balances b WHERE b.user_id = ?`
 	var balance int64
 	queryFn := metrics.DBExecObserver("select_user_balance", func(c context.Context) error {
 		return app.DB.QueryRowxContext(c, query, userID).Scan(&balance)
@@ -151,83 +270,68 @@ func GetUserBalance(ctx context.Context, userID string) (int64, error) {
 	return balance, nil
 }
 
-func Refund(ctx context.Context, s model.SMS) (err error) {
-	if s.TransactionID == "" {
-		return errors.New("transaction_id is required for refund")
-	}
-	if s.CustomerID == 0 {
-		return errors.New("customer_id is required for refund")
-	}
-
-	tx, err := app.DB.BeginTxx(ctx, nil)
-	if err != nil {
-		return err
-	}
-	defer func() {
-		if err != nil {
-			_ = tx.Rollback()
-		}
-	}()
-
-	const selectTxn = `SELECT amount FROM user_transactions WHERE transaction_id = ? AND user_id = ? LIMIT 1`
-	var amount int64
-	queryFn := metrics.DBExecObserver("select_refund_txn", func(c context.Context) error {
-		return tx.QueryRowxContext(c, selectTxn, s.TransactionID, s.CustomerID).Scan(&amount)
-	})
-	if err = queryFn(ctx); err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return errors.New("transaction not found")
-		}
-		return err
+// InsertCorrectionTx records a corrective transaction without touching user_balances, for
+// bringing the transaction history back in line with a balance that is known to be right.
+func InsertCorrectionTx(ctx context.Context, tx *sqlx.Tx, userID, amount int64, description string) (string, error) {
+	if tx == nil {
+		return "", errors.New("tx is required")
 	}
-
-	refundAmount := -1 * amount
-	const updateBalance = `UPDATE user_balances SET balance = balance + ? WHERE user_id = ?`
-	execUpdate := metrics.DBExecObserver("update_balance_refund", func(c context.Context) error {
-		_, execErr := tx.ExecContext(c, updateBalance, refundAmount, s.CustomerID)
-		return execErr
-	})
-	if err = execUpdate(ctx); err != nil {
+	txID := uuid.NewString()
+	const q = `INSERT INTO user_transactions (user_id, amount, transaction_type, description, transaction_id) VALUES (?, ?, ?, ?, ?)`
+	execFn := metrics.DBExecObserver("insert_correction_txn", func(c context.Context) error {
+		_, err := tx.ExecContext(c, q, userID, amount, CorrectiveTransaction, description, txID)
 		return err
-	}
-
-	const insertTxn = `INSERT INTO user_transactions (user_id, amount, transaction_type, description, transaction_id) VALUES (?, ?, ?, ?, ?)`
-	refundTxID := uuid.NewString()
-	desc := fmt.Sprintf("%s :  تراکنش اصلاحی برای  ", s.TransactionID)
-	execInsert := metrics.DBExecObserver("insert_refund_txn", func(c context.Context) error {
-		_, execErr := tx.ExecContext(c, insertTxn, s.CustomerID, refundAmount, CorrectiveTransaction, desc, refundTxID)
-		return execErr
 	})
-	if err = execInsert(ctx); err != nil {
-		return err
-	}
-
-	if err = tx.Commit(); err != nil {
-		return err
+	if err := execFn(ctx); err != nil {
+		return "", err
 	}
-
-	return nil
+	return txID, nil
 }
 
-func calculatePrice(Type model.Type, Quantity int) int64 {
-	return int64(getPricePerType(Type) * Quantity)
-}
+// DefaultPaymentSource is used for top-ups that do not name a payment source.
+const DefaultPaymentSource = "manual"
 
-// could read from DB
-func getPricePerType(t model.Type) int {
-	if t == model.EXPRESS {
-		return 3
-	}
-	return 1
-}
+var ErrPaymentReferenceConflict = errors.New("payment reference already used for a different top-up")
 
 type AddBalanceRequest struct {
 	CustomerID  int64
 	Amount      uint64
 	Description string
+	// Promo credits come out of the promo_credit ledger account instead of funding.
+	Promo bool
+	// PaymentReference identifies the payment in PaymentSource (e.g. a bank transfer id). A
+	// reference is credited once per source; empty means no de-duplication.
+	PaymentSource    string
+	PaymentReference string
+}
+
+// TopUp is the result of AddBalance. Replayed is set when the payment reference had already
+// been credited and the original deposit is returned.
+type TopUp struct {
+	TransactionID    string    `db:"transaction_id" json:"transaction_id"`
+	UserID           int64     `db:"user_id" json:"user_id"`
+	Amount           int64     `db:"amount" json:"amount"`
+	PaymentSource    string    `db:"payment_source" json:"payment_source,omitempty"`
+	PaymentReference string    `db:"payment_reference" json:"payment_reference,omitempty"`
+	CreatedAt        time.Time `db:"created_at" json:"created_at"`
+	Replayed         bool      `db:"-" json:"replayed"`
 }
 
-func AddBalance(ctx context.Context, req AddBalanceRequest) (err error) {
+// AddBalance credits the user and records a deposit. With a payment reference, a replay of the
+// same top-up returns the original deposit instead of crediting again, and a reference reused
+// for another user or amount returns ErrPaymentReferenceConflict.
+func AddBalance(ctx context.Context, req AddBalanceRequest) (TopUp, error) {
+	var source, reference any
+	if req.PaymentReference != "" {
+		if req.PaymentSource == "" {
+			req.PaymentSource = DefaultPaymentSource
+		}
+		source, reference = req.PaymentSource, req.PaymentReference
+		if d, err := findTopUp(ctx, req); err == nil || !errors.Is(err, sql.ErrNoRows) {
+			return d, err
+		}
+	}
+
 	// Retry deadlocks/lock timeouts (common during load test seeding).
 	var lastErr error
 	for attempt := 0; attempt < 6; attempt++ {
@@ -237,15 +341,16 @@ func AddBalance(ctx context.Context, req AddBalanceRequest) (err error) {
 
 		tx, txErr := app.DB.BeginTxx(ctx, nil)
 		if txErr != nil {
-			return txErr
+			return TopUp{}, txErr
 		}
 
-		// Single statement upsert avoids UPDATE+INSERT deadlocks.
+		// Single statement upsert avoids UPDATE+INSERT deadlocks. Sharded accounts get the
+		// deposit on their shards instead.
 		const upsertBalance = `
 			INSERT INTO user_balances (user_id, balance)
 			VALUES (?, ?)
 			ON DUPLICATE KEY UPDATE
-				balance = balance + VALUES(balance),
+				balance = balance + IF(shards > 0, 0, VALUES(balance)),
 				last_updated = CURRENT_TIMESTAMP
 		`
 		if lastErr = metrics.DBExecObserver("upsert_balance_add", func(c context.Context) error {
@@ -256,7 +361,21 @@ func AddBalance(ctx context.Context, req AddBalanceRequest) (err error) {
 			if isRetryableMySQLError(lastErr) {
 				continue
 			}
-			return lastErr
+			return TopUp{}, lastErr
+		}
+
+		var shards int
+		if lastErr = metrics.DBExecObserver("select_balance_shards_count", func(c context.Context) error {
+			return tx.GetContext(c, &shards, `SELECT shards FROM user_balances WHERE user_id = ?`, req.CustomerID)
+		})(ctx); lastErr == nil && shards > 0 {
+			lastErr = depositToShardsTx(ctx, tx, req.CustomerID, shards, int64(req.Amount))
+		}
+		if lastErr != nil {
+			_ = tx.Rollback()
+			if isRetryableMySQLError(lastErr) {
+				continue
+			}
+			return TopUp{}, lastErr
 		}
 
 		description := req.Description
@@ -265,16 +384,40 @@ func AddBalance(ctx context.Context, req AddBalanceRequest) (err error) {
 		}
 
 		txID := uuid.NewString()
-		const insertTransactionQuery = `INSERT INTO user_transactions (user_id, amount, transaction_type, description, transaction_id) VALUES (?, ?, ?, ?, ?)`
+		const insertTransactionQuery = `INSERT INTO user_transactions (user_id, amount, transaction_type, description, transaction_id, payment_source, payment_reference) VALUES (?, ?, ?, ?, ?, ?, ?)`
 		if lastErr = metrics.DBExecObserver("insert_deposit_txn", func(c context.Context) error {
-			_, execErr := tx.ExecContext(c, insertTransactionQuery, req.CustomerID, req.Amount, Deposit, description, txID)
+			_, execErr := tx.ExecContext(c, insertTransactionQuery, req.CustomerID, req.Amount, Deposit, description, txID, source, reference)
 			return execErr
 		})(ctx); lastErr != nil {
 			_ = tx.Rollback()
 			if isRetryableMySQLError(lastErr) {
 				continue
 			}
-			return lastErr
+			if isDuplicateKeyError(lastErr) && reference != nil {
+				// A concurrent request with the same reference committed first.
+				return findTopUp(ctx, req)
+			}
+			return TopUp{}, lastErr
+		}
+
+		journal := ledger.Transfer(ledger.JournalDeposit, txID, req.CustomerID, ledger.Funding, ledger.WalletAccount(req.CustomerID), int64(req.Amount))
+		if req.Promo {
+			journal = ledger.Transfer(ledger.JournalPromo, txID, req.CustomerID, ledger.PromoCredit, ledger.WalletAccount(req.CustomerID), int64(req.Amount))
+		}
+		if lastErr = ledger.PostTx(ctx, tx, journal); lastErr != nil {
+			_ = tx.Rollback()
+			if isRetryableMySQLError(lastErr) {
+				continue
+			}
+			return TopUp{}, lastErr
+		}
+
+		if lastErr = rearmAlertsTx(ctx, tx, req.CustomerID); lastErr != nil {
+			_ = tx.Rollback()
+			if isRetryableMySQLError(lastErr) {
+				continue
+			}
+			return TopUp{}, lastErr
 		}
 
 		if lastErr = tx.Commit(); lastErr != nil {
@@ -282,11 +425,46 @@ func AddBalance(ctx context.Context, req AddBalanceRequest) (err error) {
 			if isRetryableMySQLError(lastErr) {
 				continue
 			}
-			return lastErr
+			return TopUp{}, lastErr
 		}
-		return nil
+		return TopUp{
+			TransactionID:    txID,
+			UserID:           req.CustomerID,
+			Amount:           int64(req.Amount),
+			PaymentSource:    req.PaymentSource,
+			PaymentReference: req.PaymentReference,
+			CreatedAt:        time.Now(),
+		}, nil
 	}
-	return lastErr
+	return TopUp{}, lastErr
+}
+
+// findTopUp returns the deposit already recorded for req's payment reference, or
+// sql.ErrNoRows.
+func findTopUp(ctx context.Context, req AddBalanceRequest) (TopUp, error) {
+	const q = `
+		SELECT transaction_id, user_id, amount, payment_source, payment_reference, created_at
+		FROM user_transactions
+		WHERE payment_source = ? AND payment_reference = ?
+	`
+	var d TopUp
+	queryFn := metrics.DBExecObserver("select_deposit_by_payment_reference", func(c context.Context) error {
+		return app.DB.GetContext(c, &d, q, req.PaymentSource, req.PaymentReference)
+	})
+	if err := queryFn(ctx); err != nil {
+		return TopUp{}, err
+	}
+	if d.UserID != req.CustomerID || d.Amount != int64(req.Amount) {
+		return TopUp{}, ErrPaymentReferenceConflict
+	}
+	d.Replayed = true
+	return d, nil
+}
+
+// IsRetryable reports whether err is a deadlock or lock wait timeout, after which the caller
+// can roll back and run the whole transaction again.
+func IsRetryable(err error) bool {
+	return isRetryableMySQLError(err)
 }
 
 func isRetryableMySQLError(err error) bool {
@@ -297,3 +475,11 @@ func isRetryableMySQLError(err error) bool {
 	}
 	return false
 }
+
+func isDuplicateKeyError(err error) bool {
+	var myErr *mysql.MySQLError
+	if errors.As(err, &myErr) {
+		return myErr.Number == 1062
+	}
+	return false
+}
@@ -1,11 +1,16 @@
 package balance
 
 import (
+	"errors"
+	"fmt"
 	"sms-gateway/testutil"
 	"testing"
+	"time"
 
 	"sms-gateway/app"
+	"sms-gateway/internal/ledger"
 	"sms-gateway/internal/model"
+	"sms-gateway/internal/pricing"
 )
 
 func TestUserHasBalance(t *testing.T) {
@@ -71,33 +76,101 @@ func TestRefund(t *testing.T) {
 	if err != nil {
 		t.Fatalf("seed balance: %v", err)
 	}
-	if err := Refund(ctx, model.SMS{CustomerID: 501, TransactionID: "tx123"}); err != nil {
+	if _, err := Refund(ctx, RefundRequest{CustomerID: 501, TransactionID: "tx123"}); err != nil {
 		t.Fatalf("refund: %v", err)
 	}
+	// A redelivered failure must not refund again.
+	if _, err := Refund(ctx, RefundRequest{CustomerID: 501, TransactionID: "tx123"}); err != nil {
+		t.Fatalf("replayed refund: %v", err)
+	}
 	bal, _ := GetUserBalance(ctx, "501")
 	if bal != 2 {
 		t.Fatalf("expected balance 2, got %d", bal)
 	}
 	txs, _ := GetUserTransactions(ctx, "501")
-	if len(txs) < 2 {
-		t.Fatalf("expected at least 2 transactions, got %+v", txs)
-	}
-	foundCorrective := false
+	corrective := 0
 	for _, tx := range txs {
 		if tx.TransactionType == CorrectiveTransaction {
-			foundCorrective = true
-			break
+			corrective++
 		}
 	}
-	if !foundCorrective {
-		t.Fatalf("expected corrective transaction, got %+v", txs)
+	if corrective != 1 {
+		t.Fatalf("expected one corrective transaction, got %+v", txs)
+	}
+}
+
+func TestRefund_PartialCappedAtCharge(t *testing.T) {
+	ctx := testutil.EnsureSetup(t)
+	testutil.ResetTables(ctx, t)
+	_, err := app.DB.ExecContext(ctx, "INSERT INTO user_transactions (user_id, amount, transaction_type, description, transaction_id) VALUES (?, ?, ?, ?, ?)", 502, -10, "withdrawal", "charge", "tx-partial")
+	if err != nil {
+		t.Fatalf("seed tx: %v", err)
+	}
+	_, err = app.DB.ExecContext(ctx, "INSERT INTO user_balances (user_id, balance) VALUES (?, ?)", 502, 0)
+	if err != nil {
+		t.Fatalf("seed balance: %v", err)
+	}
+
+	if _, err := Refund(ctx, RefundRequest{CustomerID: 502, TransactionID: "tx-partial", Amount: 3, Key: "+1"}); err != nil {
+		t.Fatalf("first partial refund: %v", err)
+	}
+	if _, err := Refund(ctx, RefundRequest{CustomerID: 502, TransactionID: "tx-partial", Amount: 8, Key: "+2"}); !errors.Is(err, ErrRefundExceedsCharge) {
+		t.Fatalf("expected refund over the charge to fail, got %v", err)
+	}
+	r, err := Refund(ctx, RefundRequest{CustomerID: 502, TransactionID: "tx-partial", Key: "rest"})
+	if err != nil || r.Amount != 7 {
+		t.Fatalf("expected remaining 7 refunded, got %+v err=%v", r, err)
+	}
+
+	refunds, err := ListRefunds(ctx, "tx-partial")
+	if err != nil || len(refunds) != 2 {
+		t.Fatalf("expected 2 refunds, got %+v err=%v", refunds, err)
+	}
+	if bal, _ := GetUserBalance(ctx, "502"); bal != 10 {
+		t.Fatalf("expected balance 10, got %d", bal)
+	}
+	if _, err := Refund(ctx, RefundRequest{CustomerID: 502, TransactionID: "missing"}); !errors.Is(err, ErrTransactionNotFound) {
+		t.Fatalf("expected not found, got %v", err)
+	}
+}
+
+func TestRefund_PartialNeedsKey(t *testing.T) {
+	ctx := testutil.EnsureSetup(t)
+	testutil.ResetTables(ctx, t)
+	_, err := app.DB.ExecContext(ctx, "INSERT INTO user_transactions (user_id, amount, transaction_type, description, transaction_id) VALUES (?, ?, ?, ?, ?)", 503, -50, "withdrawal", "charge", "tx-unkeyed")
+	if err != nil {
+		t.Fatalf("seed tx: %v", err)
+	}
+	_, err = app.DB.ExecContext(ctx, "INSERT INTO user_balances (user_id, balance) VALUES (?, ?)", 503, 0)
+	if err != nil {
+		t.Fatalf("seed balance: %v", err)
+	}
+
+	// Without keys the second partial refund would replay the first and pay nothing.
+	for _, amount := range []int64{30, 20} {
+		if _, err := Refund(ctx, RefundRequest{CustomerID: 503, TransactionID: "tx-unkeyed", Amount: amount}); !errors.Is(err, ErrRefundKeyRequired) {
+			t.Fatalf("expected ErrRefundKeyRequired for %d, got %v", amount, err)
+		}
+	}
+	for _, key := range []string{"a", "b"} {
+		if _, err := Refund(ctx, RefundRequest{CustomerID: 503, TransactionID: "tx-unkeyed", Amount: 25, Key: key}); err != nil {
+			t.Fatalf("keyed partial refund %s: %v", key, err)
+		}
+	}
+	// Nothing is left, so a full refund returns the last refund instead of failing.
+	r, err := Refund(ctx, RefundRequest{CustomerID: 503, TransactionID: "tx-unkeyed"})
+	if err != nil || r.RefundKey != "b" {
+		t.Fatalf("expected the last refund, got %+v err=%v", r, err)
+	}
+	if bal, _ := GetUserBalance(ctx, "503"); bal != 50 {
+		t.Fatalf("expected balance 50, got %d", bal)
 	}
 }
 
 func TestAddBalance(t *testing.T) {
 	ctx := testutil.EnsureSetup(t)
 	testutil.ResetTables(ctx, t)
-	if err := AddBalance(ctx, AddBalanceRequest{CustomerID: 601, Amount: 10}); err != nil {
+	if _, err := AddBalance(ctx, AddBalanceRequest{CustomerID: 601, Amount: 10}); err != nil {
 		t.Fatalf("add balance: %v", err)
 	}
 	bal, _ := GetUserBalance(ctx, "601")
@@ -110,20 +183,194 @@ func TestAddBalance(t *testing.T) {
 	}
 }
 
-func TestCalculatePrice(t *testing.T) {
-	if v := calculatePrice(model.EXPRESS, 2); v != 6 {
-		t.Fatalf("expected express price 6 got %d", v)
+func TestAddBalanceReplaysPaymentReference(t *testing.T) {
+	ctx := testutil.EnsureSetup(t)
+	testutil.ResetTables(ctx, t)
+	req := AddBalanceRequest{CustomerID: 602, Amount: 25, PaymentSource: "psp", PaymentReference: "pay-602"}
+	first, err := AddBalance(ctx, req)
+	if err != nil || first.Replayed {
+		t.Fatalf("first top-up: %+v err=%v", first, err)
+	}
+	again, err := AddBalance(ctx, req)
+	if err != nil || !again.Replayed || again.TransactionID != first.TransactionID {
+		t.Fatalf("expected replay of %s, got %+v err=%v", first.TransactionID, again, err)
 	}
-	if v := calculatePrice(model.NORMAL, 3); v != 3 {
-		t.Fatalf("expected normal price 3 got %d", v)
+	if bal, _ := GetUserBalance(ctx, "602"); bal != 25 {
+		t.Fatalf("expected balance credited once, got %d", bal)
+	}
+
+	req.Amount = 30
+	if _, err := AddBalance(ctx, req); !errors.Is(err, ErrPaymentReferenceConflict) {
+		t.Fatalf("expected conflict, got %v", err)
+	}
+	// The same reference at another source is a different payment.
+	if _, err := AddBalance(ctx, AddBalanceRequest{CustomerID: 602, Amount: 5, PaymentReference: "pay-602"}); err != nil {
+		t.Fatalf("manual top-up: %v", err)
+	}
+	if bal, _ := GetUserBalance(ctx, "602"); bal != 30 {
+		t.Fatalf("expected balance 30, got %d", bal)
 	}
 }
 
-func TestGetPricePerType(t *testing.T) {
-	if getPricePerType(model.EXPRESS) != 3 {
-		t.Fatalf("express price mismatch")
+func TestChargeHoldsThenCapturesAndReleasesPerRecipient(t *testing.T) {
+	ctx := testutil.EnsureSetup(t)
+	testutil.ResetTables(ctx, t)
+	_, err := app.DB.ExecContext(ctx, "INSERT INTO user_balances (user_id, balance) VALUES (?, ?)", 701, 100)
+	if err != nil {
+		t.Fatalf("seed balance: %v", err)
+	}
+	p, err := pricing.CreatePrice(ctx, pricing.Price{CustomerID: 701, Type: model.NORMAL, Price: 4})
+	if err != nil {
+		t.Fatalf("seed price: %v", err)
+	}
+
+	txID, err := Charge(ctx, ChargeRequest{CustomerID: 701, Quantity: 3, Type: model.NORMAL, Recipients: []string{"+1", "+2", "+3"}})
+	if err != nil {
+		t.Fatalf("charge: %v", err)
+	}
+	b, _ := GetUserBalances(ctx, "701")
+	if b.Balance != 100 || b.Held != 12 || b.Available != 88 {
+		t.Fatalf("expected 12 held out of 100, got %+v", b)
+	}
+
+	if err := Capture(ctx, model.SMS{CustomerID: 701, TransactionID: txID, Recipients: []string{"+1", "+2"}}); err != nil {
+		t.Fatalf("capture: %v", err)
+	}
+	if err := Release(ctx, model.SMS{CustomerID: 701, TransactionID: txID, Recipients: []string{"+3"}}); err != nil {
+		t.Fatalf("release: %v", err)
+	}
+	// Redelivery must not charge again.
+	if err := Capture(ctx, model.SMS{CustomerID: 701, TransactionID: txID, Recipients: []string{"+1", "+2", "+3"}}); err != nil {
+		t.Fatalf("second capture: %v", err)
+	}
+
+	b, _ = GetUserBalances(ctx, "701")
+	if b.Balance != 92 || b.Held != 0 || b.Available != 92 {
+		t.Fatalf("expected 8 captured and 4 released, got %+v", b)
+	}
+	txs, _ := GetUserTransactions(ctx, "701")
+	if len(txs) != 1 || txs[0].Amount != -8 || txs[0].PriceVersion != fmt.Sprint(p.ID) {
+		t.Fatalf("expected one withdrawal of 8 with price version %d, got %+v", p.ID, txs)
+	}
+}
+
+func TestChargeRespectsHeldBalance(t *testing.T) {
+	ctx := testutil.EnsureSetup(t)
+	testutil.ResetTables(ctx, t)
+	_, err := app.DB.ExecContext(ctx, "INSERT INTO user_balances (user_id, balance) VALUES (?, ?)", 702, 3)
+	if err != nil {
+		t.Fatalf("seed balance: %v", err)
+	}
+	if _, err := Charge(ctx, ChargeRequest{CustomerID: 702, Quantity: 2, Type: model.NORMAL}); err != nil {
+		t.Fatalf("first charge: %v", err)
+	}
+	if _, err := Charge(ctx, ChargeRequest{CustomerID: 702, Quantity: 2, Type: model.NORMAL}); !errors.Is(err, ErrInsufficientBalance) {
+		t.Fatalf("expected insufficient balance while 2 of 3 are held, got %v", err)
+	}
+}
+
+func TestReleaseExpiredHolds(t *testing.T) {
+	ctx := testutil.EnsureSetup(t)
+	testutil.ResetTables(ctx, t)
+	_, err := app.DB.ExecContext(ctx, "INSERT INTO user_balances (user_id, balance) VALUES (?, ?)", 703, 10)
+	if err != nil {
+		t.Fatalf("seed balance: %v", err)
+	}
+	txID, err := Charge(ctx, ChargeRequest{CustomerID: 703, Quantity: 2, Type: model.EXPRESS, Recipients: []string{"+1", "+2"}, HoldTTL: time.Second})
+	if err != nil {
+		t.Fatalf("charge: %v", err)
+	}
+	charged, _ := GetUserBalances(ctx, "703")
+	if _, err := app.DB.ExecContext(ctx, "UPDATE balance_holds SET expires_at = CURRENT_TIMESTAMP - INTERVAL 1 MINUTE"); err != nil {
+		t.Fatalf("expire holds: %v", err)
+	}
+
+	n, err := releaseExpired(ctx, expireBatchSize)
+	if err != nil || n != 2 {
+		t.Fatalf("expected 2 released holds, got %d err=%v", n, err)
+	}
+	b, _ := GetUserBalances(ctx, "703")
+	if b.Held != 0 || b.Available != 10 {
+		t.Fatalf("expected hold to be released, got %+v", b)
+	}
+
+	// A delivery reported after the expiry is still charged, once.
+	for i := 0; i < 2; i++ {
+		if err := Capture(ctx, model.SMS{CustomerID: 703, TransactionID: txID, Recipients: []string{"+1"}}); err != nil {
+			t.Fatalf("late capture: %v", err)
+		}
+	}
+	b, _ = GetUserBalances(ctx, "703")
+	if b.Held != 0 || b.Balance != 10-charged.Held/2 {
+		t.Fatalf("expected one recipient charged after expiry, got %+v (held was %d)", b, charged.Held)
+	}
+}
+
+func TestReleaseExpiredHoldsSkipsMessagesInReview(t *testing.T) {
+	ctx := testutil.EnsureSetup(t)
+	testutil.ResetTables(ctx, t)
+	if _, err := app.DB.ExecContext(ctx, "INSERT INTO user_balances (user_id, balance) VALUES (?, ?)", 704, 10); err != nil {
+		t.Fatalf("seed balance: %v", err)
+	}
+	txID, err := Charge(ctx, ChargeRequest{CustomerID: 704, Quantity: 1, Type: model.EXPRESS, Recipients: []string{"+1"}})
+	if err != nil {
+		t.Fatalf("charge: %v", err)
+	}
+	if _, err := app.DB.ExecContext(ctx,
+		"INSERT INTO held_messages (sms_identifier, customer_id, transaction_id, payload, status) VALUES ('review-1', 704, ?, CAST('{}' AS JSON), 'held')", txID); err != nil {
+		t.Fatalf("seed held message: %v", err)
+	}
+	if _, err := app.DB.ExecContext(ctx, "UPDATE balance_holds SET expires_at = CURRENT_TIMESTAMP - INTERVAL 1 MINUTE"); err != nil {
+		t.Fatalf("expire holds: %v", err)
+	}
+
+	if n, err := releaseExpired(ctx, expireBatchSize); err != nil || n != 0 {
+		t.Fatalf("expected the hold in review to be left alone, got %d err=%v", n, err)
+	}
+}
+
+func TestLedgerMirrorsBalance(t *testing.T) {
+	ctx := testutil.EnsureSetup(t)
+	testutil.ResetTables(ctx, t)
+
+	if _, err := AddBalance(ctx, AddBalanceRequest{CustomerID: 1001, Amount: 20}); err != nil {
+		t.Fatalf("add balance: %v", err)
+	}
+	if _, err := AddBalance(ctx, AddBalanceRequest{CustomerID: 1001, Amount: 5, Promo: true}); err != nil {
+		t.Fatalf("add promo: %v", err)
+	}
+	txID, err := Charge(ctx, ChargeRequest{CustomerID: 1001, Quantity: 2, Type: model.EXPRESS})
+	if err != nil {
+		t.Fatalf("charge: %v", err)
+	}
+	if err := Capture(ctx, model.SMS{CustomerID: 1001, TransactionID: txID}); err != nil {
+		t.Fatalf("capture: %v", err)
+	}
+	if _, err := Refund(ctx, RefundRequest{CustomerID: 1001, TransactionID: txID, Amount: 2, Key: "partial"}); err != nil {
+		t.Fatalf("refund: %v", err)
+	}
+
+	userID := int64(1001)
+	wallet, err := ledger.Balances(ctx, &userID)
+	if err != nil || len(wallet) != 1 {
+		t.Fatalf("wallet balance: %+v err=%v", wallet, err)
+	}
+	bal, _ := GetUserBalance(ctx, "1001")
+	if bal != 21 || wallet[0].Balance != bal {
+		t.Fatalf("expected wallet to equal balance 21, got wallet %d balance %d", wallet[0].Balance, bal)
+	}
+
+	system, err := ledger.Balances(ctx, nil)
+	if err != nil {
+		t.Fatalf("system balances: %v", err)
+	}
+	want := map[string]int64{ledger.Funding: -20, ledger.PromoCredit: -5, ledger.Revenue: 6, ledger.Refunds: -2}
+	for _, a := range system {
+		if a.Balance != want[a.Code] {
+			t.Fatalf("account %s: expected %d, got %d", a.Code, want[a.Code], a.Balance)
+		}
 	}
-	if getPricePerType(model.NORMAL) != 1 {
-		t.Fatalf("normal price mismatch")
+	if sum, err := ledger.TrialBalance(ctx); err != nil || sum != 0 {
+		t.Fatalf("expected trial balance 0, got %d err=%v", sum, err)
 	}
 }
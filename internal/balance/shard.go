@@ -0,0 +1,400 @@
+package balance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"sort"
+	"strings"
+	"time"
+
+	"sms-gateway/app"
+	"sms-gateway/pkg/metrics"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// A sharded account spreads its balance over several rows so concurrent charges do not all
+// queue on one row lock. The user_balances row is shard 0 and keeps the account settings;
+// balance_shards holds shards 1..user_balances.shards. The user's balance and held amount are
+// the sums over all of them. Charges reserve on a single shard, deposits are split over the
+// shards and StartShardRebalancer evens them out again.
+
+// MaxBalanceShards bounds user_balances.shards.
+const MaxBalanceShards = 64
+
+var ErrInvalidShards = errors.New("invalid shard count")
+
+// errShardNotFound is returned when a balance update matches no user_balances or balance_shards row.
+var errShardNotFound = errors.New("balance shard not found")
+
+// Balance, held and available amounts of the user_balances row aliased b summed with its
+// shards. Reads of a whole balance use these instead of b.balance and b.held.
+const (
+	totalBalanceExpr   = `(b.balance + (SELECT COALESCE(SUM(s.balance), 0) FROM balance_shards s WHERE s.user_id = b.user_id))`
+	totalHeldExpr      = `(b.held + (SELECT COALESCE(SUM(s.held), 0) FROM balance_shards s WHERE s.user_id = b.user_id))`
+	totalAvailableExpr = `(b.balance - b.held + (SELECT COALESCE(SUM(s.balance - s.held), 0) FROM balance_shards s WHERE s.user_id = b.user_id))`
+)
+
+type BalanceShard struct {
+	Shard   int   `db:"shard" json:"shard"`
+	Balance int64 `db:"balance" json:"balance"`
+	Held    int64 `db:"held" json:"held"`
+}
+
+func (s BalanceShard) free() int64 {
+	return s.Balance - s.Held
+}
+
+// holdOnShardTx reserves price on a random shard (1..n) that covers it. The shards are read
+// without locking and only the chosen one is updated, so charges of the same user run in
+// parallel. ok is false when the user is not sharded, no shard covers price or the chosen
+// shard was drained meanwhile.
+func holdOnShardTx(ctx context.Context, tx *sqlx.Tx, userID, price int64) (int, bool, error) {
+	var candidates []int
+	const selectQ = `SELECT shard FROM balance_shards WHERE user_id = ? AND balance - held >= ?`
+	if err := metrics.DBExecObserver("select_balance_shards_spendable", func(c context.Context) error {
+		return tx.SelectContext(c, &candidates, selectQ, userID, price)
+	})(ctx); err != nil {
+		return 0, false, err
+	}
+	if len(candidates) == 0 {
+		return 0, false, nil
+	}
+
+	shard := candidates[rand.IntN(len(candidates))]
+	const updateQ = `UPDATE balance_shards SET held = held + ? WHERE user_id = ? AND shard = ? AND balance - held >= ?`
+	var rows int64
+	if err := metrics.DBExecObserver("update_balance_shard_hold", func(c context.Context) error {
+		res, err := tx.ExecContext(c, updateQ, price, userID, shard, price)
+		if err != nil {
+			return err
+		}
+		rows, err = res.RowsAffected()
+		return err
+	})(ctx); err != nil {
+		return 0, false, err
+	}
+	return shard, rows > 0, nil
+}
+
+// pullShardsTx moves up to amount of free balance from the user's shards into the
+// user_balances row and returns how much it moved. It is the slow path for charges and
+// transfers that no single shard covers; the caller must already hold the user_balances row
+// lock. Transfers, deposits and the rebalancer lock the row, then the shards by number, but a
+// charge whose shard was drained between its read and its update falls back here still holding
+// that shard, so the two can deadlock: sms.Submit runs the send transaction again when they do.
+func pullShardsTx(ctx context.Context, tx *sqlx.Tx, userID, amount int64) (int64, error) {
+	var shards []BalanceShard
+	const selectQ = `SELECT shard, balance, held FROM balance_shards WHERE user_id = ? ORDER BY shard FOR UPDATE`
+	if err := metrics.DBExecObserver("select_balance_shards_for_update", func(c context.Context) error {
+		return tx.SelectContext(c, &shards, selectQ, userID)
+	})(ctx); err != nil {
+		return 0, err
+	}
+
+	var moved int64
+	for _, s := range shards {
+		take := min(s.free(), amount-moved)
+		if take <= 0 {
+			continue
+		}
+		if err := adjustShardTx(ctx, tx, "update_balance_shard_pull", userID, s.Shard, -take, 0); err != nil {
+			return 0, err
+		}
+		moved += take
+		if moved == amount {
+			break
+		}
+	}
+	if moved == 0 {
+		return 0, nil
+	}
+	if err := adjustShardTx(ctx, tx, "update_balance_shard_pull", userID, 0, moved, 0); err != nil {
+		return 0, err
+	}
+	return moved, nil
+}
+
+// adjustShardTx adds balanceDelta and heldDelta to one shard of the user's balance; shard 0 is
+// the user_balances row. It returns errShardNotFound when the row is missing, so money is never
+// moved against a shard that the rebalancer already dropped.
+func adjustShardTx(ctx context.Context, tx *sqlx.Tx, metric string, userID int64, shard int, balanceDelta, heldDelta int64) error {
+	if balanceDelta == 0 && heldDelta == 0 {
+		return nil
+	}
+	q := `UPDATE user_balances SET balance = balance + ?, held = held + ? WHERE user_id = ?`
+	args := []any{balanceDelta, heldDelta, userID}
+	if shard != 0 {
+		q = `UPDATE balance_shards SET balance = balance + ?, held = held + ? WHERE user_id = ? AND shard = ?`
+		args = append(args, shard)
+	}
+	var rows int64
+	execFn := metrics.DBExecObserver(metric, func(c context.Context) error {
+		res, err := tx.ExecContext(c, q, args...)
+		if err != nil {
+			return err
+		}
+		rows, err = res.RowsAffected()
+		return err
+	})
+	if err := execFn(ctx); err != nil {
+		return err
+	}
+	if rows == 0 {
+		return fmt.Errorf("%w: user %d shard %d", errShardNotFound, userID, shard)
+	}
+	return nil
+}
+
+// depositToShardsTx splits amount evenly over shards 1..n. The caller holds the user_balances
+// row lock, under which SetBalanceShards keeps those shards in place.
+func depositToShardsTx(ctx context.Context, tx *sqlx.Tx, userID int64, n int, amount int64) error {
+	per, rem := amount/int64(n), amount%int64(n)
+	const q = `UPDATE balance_shards SET balance = balance + ? + IF(shard <= ?, 1, 0) WHERE user_id = ? AND shard BETWEEN 1 AND ?`
+	execFn := metrics.DBExecObserver("update_balance_shards_deposit", func(c context.Context) error {
+		_, err := tx.ExecContext(c, q, per, rem, userID, n)
+		return err
+	})
+	return execFn(ctx)
+}
+
+// SetBalanceShards spreads the user's balance over n shards; 0 turns sharding off and moves
+// the free balance back to the user_balances row. Lowering n retires the shards above it: they
+// keep the amounts still held on them until those holds settle and the rebalancer empties them.
+func SetBalanceShards(ctx context.Context, userID int64, n int) (err error) {
+	if userID == 0 || n < 0 || n > MaxBalanceShards {
+		return ErrInvalidShards
+	}
+
+	tx, err := app.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	const upsertQ = `INSERT INTO user_balances (user_id, balance, shards) VALUES (?, 0, ?) ON DUPLICATE KEY UPDATE shards = VALUES(shards)`
+	if err = metrics.DBExecObserver("upsert_balance_shards_count", func(c context.Context) error {
+		_, execErr := tx.ExecContext(c, upsertQ, userID, n)
+		return execErr
+	})(ctx); err != nil {
+		return err
+	}
+
+	if n > 0 {
+		valueStrings := make([]string, 0, n)
+		args := make([]any, 0, n*2)
+		for shard := 1; shard <= n; shard++ {
+			valueStrings = append(valueStrings, "(?, ?)")
+			args = append(args, userID, shard)
+		}
+		insertQ := `INSERT INTO balance_shards (user_id, shard) VALUES ` + strings.Join(valueStrings, ",") + ` ON DUPLICATE KEY UPDATE shard = shard`
+		if err = metrics.DBExecObserver("insert_balance_shards", func(c context.Context) error {
+			_, execErr := tx.ExecContext(c, insertQ, args...)
+			return execErr
+		})(ctx); err != nil {
+			return err
+		}
+	}
+
+	if _, err = rebalanceTx(ctx, tx, userID, true); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// planRebalance returns the balance change per shard (0 is the user_balances row) that spreads
+// the user's free balance (balance - held) evenly over shards 1..n and empties the
+// user_balances row and the retired shards above n. Held amounts stay on the shard of their
+// hold, and a negative free balance (used postpaid credit) stays on the user_balances row.
+// Unless force is set it returns nil while the shards are roughly even, so busy accounts are
+// not locked on every tick.
+func planRebalance(mainFree int64, n int, shards []BalanceShard, force bool) map[int]int64 {
+	total, active, retired := mainFree, 0, false
+	for _, s := range shards {
+		total += s.free()
+		if s.Shard <= n {
+			active++
+		} else {
+			retired = true
+		}
+	}
+
+	target := map[int]int64{0: total}
+	if active > 0 && total > 0 {
+		target[0] = 0
+		per, rem := total/int64(active), total%int64(active)
+		for _, s := range shards {
+			if s.Shard > n {
+				continue
+			}
+			target[s.Shard] = per
+			if rem > 0 {
+				target[s.Shard]++
+				rem--
+			}
+		}
+	}
+
+	needed := force || retired || mainFree != target[0]
+	for _, s := range shards {
+		if s.Shard <= n && s.free()*2 < target[s.Shard] {
+			needed = true
+		}
+	}
+	if !needed {
+		return nil
+	}
+
+	deltas := map[int]int64{}
+	if d := target[0] - mainFree; d != 0 {
+		deltas[0] = d
+	}
+	for _, s := range shards {
+		if d := target[s.Shard] - s.free(); d != 0 {
+			deltas[s.Shard] = d
+		}
+	}
+	return deltas
+}
+
+// rebalanceTx locks the user's balance rows and applies planRebalance. It reports whether
+// anything was moved.
+func rebalanceTx(ctx context.Context, tx *sqlx.Tx, userID int64, force bool) (bool, error) {
+	var main struct {
+		Shards int   `db:"shards"`
+		Free   int64 `db:"free"`
+	}
+	const mainQ = `SELECT shards, balance - held AS free FROM user_balances WHERE user_id = ? FOR UPDATE`
+	if err := metrics.DBExecObserver("select_user_balance_for_rebalance", func(c context.Context) error {
+		return tx.GetContext(c, &main, mainQ, userID)
+	})(ctx); err != nil {
+		return false, err
+	}
+	var shards []BalanceShard
+	const shardsQ = `SELECT shard, balance, held FROM balance_shards WHERE user_id = ? ORDER BY shard FOR UPDATE`
+	if err := metrics.DBExecObserver("select_balance_shards_for_update", func(c context.Context) error {
+		return tx.SelectContext(c, &shards, shardsQ, userID)
+	})(ctx); err != nil {
+		return false, err
+	}
+
+	deltas := planRebalance(main.Free, main.Shards, shards, force)
+	if deltas == nil {
+		return false, nil
+	}
+	keys := make([]int, 0, len(deltas))
+	for shard := range deltas {
+		keys = append(keys, shard)
+	}
+	sort.Ints(keys)
+	for _, shard := range keys {
+		if err := adjustShardTx(ctx, tx, "update_balance_shard_rebalance", userID, shard, deltas[shard], 0); err != nil {
+			return false, err
+		}
+	}
+
+	// Expired holds on retired shards are captured from the user_balances row, so they are moved
+	// there; a shard is only dropped once no active hold points at it.
+	const moveHoldsQ = `UPDATE balance_holds SET shard = 0 WHERE user_id = ? AND shard > ? AND status = ?`
+	if err := metrics.DBExecObserver("update_retired_shard_holds", func(c context.Context) error {
+		_, err := tx.ExecContext(c, moveHoldsQ, userID, main.Shards, HoldExpired)
+		return err
+	})(ctx); err != nil {
+		return false, err
+	}
+	const deleteQ = `DELETE FROM balance_shards WHERE user_id = ? AND shard > ? AND balance = 0 AND held = 0
+		AND NOT EXISTS (SELECT 1 FROM balance_holds h WHERE h.user_id = balance_shards.user_id AND h.shard = balance_shards.shard AND h.status IN (?, ?))`
+	if err := metrics.DBExecObserver("delete_retired_balance_shards", func(c context.Context) error {
+		_, err := tx.ExecContext(c, deleteQ, userID, main.Shards, HoldHeld, HoldExpired)
+		return err
+	})(ctx); err != nil {
+		return false, err
+	}
+	return len(deltas) > 0, nil
+}
+
+// RebalanceShards evens out one user's shards if they drifted apart. The check runs on a
+// non-locking read first; the rows are only locked when there is something to move.
+func RebalanceShards(ctx context.Context, userID int64) (err error) {
+	var main struct {
+		Shards int   `db:"shards"`
+		Free   int64 `db:"free"`
+	}
+	const mainQ = `SELECT shards, balance - held AS free FROM user_balances WHERE user_id = ?`
+	if err := metrics.DBExecObserver("select_user_balance_shards", func(c context.Context) error {
+		return app.DB.GetContext(c, &main, mainQ, userID)
+	})(ctx); err != nil {
+		return err
+	}
+	var shards []BalanceShard
+	const shardsQ = `SELECT shard, balance, held FROM balance_shards WHERE user_id = ? ORDER BY shard`
+	if err := metrics.DBExecObserver("select_balance_shards", func(c context.Context) error {
+		return app.DB.SelectContext(c, &shards, shardsQ, userID)
+	})(ctx); err != nil {
+		return err
+	}
+	if planRebalance(main.Free, main.Shards, shards, false) == nil {
+		return nil
+	}
+
+	tx, err := app.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+	if _, err = rebalanceTx(ctx, tx, userID, true); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetBalanceShards returns the user's shards (without the user_balances row).
+func GetBalanceShards(ctx context.Context, userID int64) ([]BalanceShard, error) {
+	const q = `SELECT shard, balance, held FROM balance_shards WHERE user_id = ? ORDER BY shard`
+	var out []BalanceShard
+	queryFn := metrics.DBExecObserver("select_balance_shards", func(c context.Context) error {
+		return app.DB.SelectContext(c, &out, q, userID)
+	})
+	if err := queryFn(ctx); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// StartShardRebalancer rebalances every sharded user each interval until ctx is done.
+func StartShardRebalancer(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		var users []int64
+		const q = `SELECT DISTINCT user_id FROM balance_shards ORDER BY user_id`
+		if err := metrics.DBExecObserver("select_sharded_users", func(c context.Context) error {
+			return app.DB.SelectContext(c, &users, q)
+		})(ctx); err != nil {
+			app.Logger.Error("list sharded balances", "err", err)
+			continue
+		}
+		for _, userID := range users {
+			if err := RebalanceShards(ctx, userID); err != nil {
+				app.Logger.Error("rebalance balance shards", "user_id", userID, "err", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package balance
+
+import (
+	"fmt"
+	"reflect"
+	"sms-gateway/testutil"
+	"testing"
+
+	"sms-gateway/app"
+	"sms-gateway/internal/model"
+	"sms-gateway/internal/pricing"
+)
+
+func TestPlanRebalance(t *testing.T) {
+	cases := []struct {
+		name     string
+		mainFree int64
+		n        int
+		shards   []BalanceShard
+		force    bool
+		want     map[int]int64
+	}{
+		{
+			name:     "spreads main row over shards",
+			mainFree: 10,
+			n:        3,
+			shards:   []BalanceShard{{Shard: 1}, {Shard: 2}, {Shard: 3}},
+			want:     map[int]int64{0: -10, 1: 4, 2: 3, 3: 3},
+		},
+		{
+			name:   "even shards are left alone",
+			n:      2,
+			shards: []BalanceShard{{Shard: 1, Balance: 6, Held: 2}, {Shard: 2, Balance: 3}},
+			want:   nil,
+		},
+		{
+			name:   "drained shard is refilled, held stays",
+			n:      2,
+			shards: []BalanceShard{{Shard: 1, Balance: 10, Held: 9}, {Shard: 2, Balance: 9}},
+			want:   map[int]int64{1: 4, 2: -4},
+		},
+		{
+			name:     "retired shard is emptied",
+			mainFree: 0,
+			n:        1,
+			shards:   []BalanceShard{{Shard: 1, Balance: 5}, {Shard: 2, Balance: 7, Held: 2}},
+			want:     map[int]int64{1: 5, 2: -5},
+		},
+		{
+			name:   "sharding off moves everything back",
+			n:      0,
+			shards: []BalanceShard{{Shard: 1, Balance: 5}, {Shard: 2, Balance: 5}},
+			want:   map[int]int64{0: 10, 1: -5, 2: -5},
+		},
+		{
+			name:     "shards cover used credit first",
+			mainFree: -20,
+			n:        2,
+			shards:   []BalanceShard{{Shard: 1, Balance: 5}, {Shard: 2, Balance: 5}},
+			want:     map[int]int64{0: 10, 1: -5, 2: -5},
+		},
+		{
+			name:   "forced with nothing to move",
+			n:      2,
+			shards: []BalanceShard{{Shard: 1, Balance: 1}, {Shard: 2, Balance: 1}},
+			force:  true,
+			want:   map[int]int64{},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := planRebalance(tc.mainFree, tc.n, tc.shards, tc.force)
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("got %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestShardedBalanceChargesDepositsAndRebalances(t *testing.T) {
+	ctx := testutil.EnsureSetup(t)
+	testutil.ResetTables(ctx, t)
+	if _, err := AddBalance(ctx, AddBalanceRequest{CustomerID: 1101, Amount: 100}); err != nil {
+		t.Fatalf("add balance: %v", err)
+	}
+	if _, err := pricing.CreatePrice(ctx, pricing.Price{CustomerID: 1101, Type: model.NORMAL, Price: 4}); err != nil {
+		t.Fatalf("seed price: %v", err)
+	}
+	if err := SetBalanceShards(ctx, 1101, 4); err != nil {
+		t.Fatalf("set shards: %v", err)
+	}
+
+	shards, _ := GetBalanceShards(ctx, 1101)
+	if len(shards) != 4 || shards[0].Balance != 25 || shards[3].Balance != 25 {
+		t.Fatalf("expected 4 shards of 25, got %+v", shards)
+	}
+
+	txID, err := Charge(ctx, ChargeRequest{CustomerID: 1101, Quantity: 3, Type: model.NORMAL, Recipients: []string{"+1", "+2", "+3"}})
+	if err != nil {
+		t.Fatalf("charge: %v", err)
+	}
+	if b, _ := GetUserBalances(ctx, "1101"); b.Balance != 100 || b.Held != 12 || b.Shards != 4 {
+		t.Fatalf("expected 12 held out of 100 over 4 shards, got %+v", b)
+	}
+	if err := Capture(ctx, model.SMS{CustomerID: 1101, TransactionID: txID, Recipients: []string{"+1", "+2"}}); err != nil {
+		t.Fatalf("capture: %v", err)
+	}
+	if err := Release(ctx, model.SMS{CustomerID: 1101, TransactionID: txID, Recipients: []string{"+3"}}); err != nil {
+		t.Fatalf("release: %v", err)
+	}
+
+	// Deposits are split over the shards, not put on the main row.
+	if _, err := AddBalance(ctx, AddBalanceRequest{CustomerID: 1101, Amount: 8}); err != nil {
+		t.Fatalf("add balance: %v", err)
+	}
+	var main int64
+	if err := app.DB.GetContext(ctx, &main, "SELECT balance FROM user_balances WHERE user_id = ?", 1101); err != nil || main != 0 {
+		t.Fatalf("expected empty main row, got %d err=%v", main, err)
+	}
+	if b, _ := GetUserBalances(ctx, "1101"); b.Balance != 100 || b.Held != 0 {
+		t.Fatalf("expected balance 100, got %+v", b)
+	}
+
+	// 10 messages (40) fit in no single shard and are drawn from several.
+	recipients := make([]string, 10)
+	for i := range recipients {
+		recipients[i] = fmt.Sprintf("+9%d", i)
+	}
+	if _, err := Charge(ctx, ChargeRequest{CustomerID: 1101, Quantity: len(recipients), Type: model.NORMAL, Recipients: recipients}); err != nil {
+		t.Fatalf("large charge: %v", err)
+	}
+	if b, _ := GetUserBalances(ctx, "1101"); b.Balance != 100 || b.Held != 40 || b.Available != 60 {
+		t.Fatalf("expected 40 held out of 100, got %+v", b)
+	}
+
+	if err := RebalanceShards(ctx, 1101); err != nil {
+		t.Fatalf("rebalance: %v", err)
+	}
+	shards, _ = GetBalanceShards(ctx, 1101)
+	for _, s := range shards {
+		if s.free() != 15 {
+			t.Fatalf("expected 15 free on every shard, got %+v", shards)
+		}
+	}
+
+	if err := SetBalanceShards(ctx, 1101, 0); err != nil {
+		t.Fatalf("unshard: %v", err)
+	}
+	if b, _ := GetUserBalances(ctx, "1101"); b.Balance != 100 || b.Available != 60 || b.Shards != 0 {
+		t.Fatalf("expected balance kept after unsharding, got %+v", b)
+	}
+}
+
+func TestExpiredHoldOnRetiredShardIsCapturedFromMainRow(t *testing.T) {
+	ctx := testutil.EnsureSetup(t)
+	testutil.ResetTables(ctx, t)
+	if _, err := AddBalance(ctx, AddBalanceRequest{CustomerID: 1102, Amount: 20}); err != nil {
+		t.Fatalf("add balance: %v", err)
+	}
+	if _, err := pricing.CreatePrice(ctx, pricing.Price{CustomerID: 1102, Type: model.NORMAL, Price: 4}); err != nil {
+		t.Fatalf("seed price: %v", err)
+	}
+	if err := SetBalanceShards(ctx, 1102, 2); err != nil {
+		t.Fatalf("set shards: %v", err)
+	}
+	txID, err := Charge(ctx, ChargeRequest{CustomerID: 1102, Quantity: 1, Type: model.NORMAL, Recipients: []string{"+1"}})
+	if err != nil {
+		t.Fatalf("charge: %v", err)
+	}
+	if _, err := app.DB.ExecContext(ctx, "UPDATE balance_holds SET expires_at = CURRENT_TIMESTAMP - INTERVAL 1 MINUTE"); err != nil {
+		t.Fatalf("expire holds: %v", err)
+	}
+	if n, err := releaseExpired(ctx, expireBatchSize); err != nil || n != 1 {
+		t.Fatalf("expected 1 released hold, got %d err=%v", n, err)
+	}
+	if err := SetBalanceShards(ctx, 1102, 0); err != nil {
+		t.Fatalf("unshard: %v", err)
+	}
+
+	if err := Capture(ctx, model.SMS{CustomerID: 1102, TransactionID: txID, Recipients: []string{"+1"}}); err != nil {
+		t.Fatalf("late capture: %v", err)
+	}
+	var main int64
+	if err := app.DB.GetContext(ctx, &main, "SELECT balance FROM user_balances WHERE user_id = ?", 1102); err != nil || main != 16 {
+		t.Fatalf("expected the main row charged down to 16, got %d err=%v", main, err)
+	}
+	if b, _ := GetUserBalances(ctx, "1102"); b.Balance != 16 || b.Held != 0 {
+		t.Fatalf("expected balance 16 after the late capture, got %+v", b)
+	}
+}
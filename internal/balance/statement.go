@@ -0,0 +1,178 @@
+package balance
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"sms-gateway/app"
+	"sms-gateway/pkg/metrics"
+)
+
+const (
+	defaultStatementLimit = 100
+	maxStatementLimit     = 1000
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// StatementRequest selects a user's transactions in [From, To). Zero From means from the
+// first transaction, zero To means up to now.
+type StatementRequest struct {
+	UserID int64
+	From   time.Time
+	To     time.Time
+	Types  []transactionType
+	// Cursor is the NextCursor of the previous page.
+	Cursor string
+	Limit  int
+}
+
+type StatementLine struct {
+	ID              int64           `db:"id" json:"id"`
+	Amount          int64           `db:"amount" json:"amount"`
+	TransactionType transactionType `db:"transaction_type" json:"transaction_type"`
+	Description     string          `db:"description" json:"description"`
+	TransactionID   string          `db:"transaction_id" json:"transaction_id"`
+	ReferenceID     string          `db:"reference_id" json:"reference_id,omitempty"`
+	PriceVersion    string          `db:"price_version" json:"price_version,omitempty"`
+	// PaymentSource and PaymentReference identify the external payment behind a deposit.
+	PaymentSource    string    `db:"payment_source" json:"payment_source,omitempty"`
+	PaymentReference string    `db:"payment_reference" json:"payment_reference,omitempty"`
+	CreatedAt        time.Time `db:"created_at" json:"created_at"`
+}
+
+// Statement is one page of a user's transactions. Opening and closing balances are the sums
+// of all transactions (whatever the type filter) before From and before To, so they are the
+// same on every page of the period.
+type Statement struct {
+	UserID         int64           `json:"user_id"`
+	From           *time.Time      `json:"from,omitempty"`
+	To             time.Time       `json:"to"`
+	OpeningBalance int64           `json:"opening_balance"`
+	ClosingBalance int64           `json:"closing_balance"`
+	Transactions   []StatementLine `json:"transactions"`
+	NextCursor     string          `json:"next_cursor,omitempty"`
+}
+
+// cursor is the (created_at, id) of the last line of a page; lines are ordered by both, so
+// the next page starts strictly after it even when several rows share a second.
+type cursor struct {
+	CreatedAt time.Time
+	ID        int64
+}
+
+func (c cursor) encode() string {
+	return base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%d|%d", c.CreatedAt.Unix(), c.ID)))
+}
+
+func decodeCursor(s string) (cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return cursor{}, ErrInvalidCursor
+	}
+	ts, id, ok := strings.Cut(string(raw), "|")
+	if !ok {
+		return cursor{}, ErrInvalidCursor
+	}
+	var sec, rowID int64
+	if _, err := fmt.Sscanf(ts, "%d", &sec); err != nil {
+		return cursor{}, ErrInvalidCursor
+	}
+	if _, err := fmt.Sscanf(id, "%d", &rowID); err != nil || rowID <= 0 {
+		return cursor{}, ErrInvalidCursor
+	}
+	return cursor{CreatedAt: time.Unix(sec, 0), ID: rowID}, nil
+}
+
+// GetStatement returns a page of the user's transactions, oldest first. All queries are
+// range scans on idx_user_transactions_user_id (user_id, created_at), whose entries also
+// carry the primary key used as tie-breaker.
+func GetStatement(ctx context.Context, req StatementRequest) (Statement, error) {
+	if req.UserID == 0 {
+		return Statement{}, errors.New("user_id is required")
+	}
+	if req.To.IsZero() {
+		req.To = time.Now()
+	}
+	if !req.From.IsZero() && !req.From.Before(req.To) {
+		return Statement{}, errors.New("from must be before to")
+	}
+	if req.Limit <= 0 || req.Limit > maxStatementLimit {
+		req.Limit = defaultStatementLimit
+	}
+
+	out := Statement{UserID: req.UserID, To: req.To, Transactions: []StatementLine{}}
+	if !req.From.IsZero() {
+		from := req.From
+		out.From = &from
+	}
+
+	q := `
+		SELECT id, amount, transaction_type, COALESCE(description, '') AS description, transaction_id,
+		       COALESCE(reference_id, '') AS reference_id, COALESCE(price_version, '') AS price_version,
+		       COALESCE(payment_source, '') AS payment_source, COALESCE(payment_reference, '') AS payment_reference, created_at
+		FROM user_transactions
+		WHERE user_id = ? AND created_at < ?
+	`
+	args := []any{req.UserID, req.To}
+	if !req.From.IsZero() {
+		q += ` AND created_at >= ?`
+		args = append(args, req.From)
+	}
+	if len(req.Types) > 0 {
+		q += ` AND transaction_type IN (?` + strings.Repeat(",?", len(req.Types)-1) + `)`
+		for _, t := range req.Types {
+			args = append(args, t)
+		}
+	}
+	if req.Cursor != "" {
+		c, err := decodeCursor(req.Cursor)
+		if err != nil {
+			return Statement{}, err
+		}
+		q += ` AND (created_at > ? OR (created_at = ? AND id > ?))`
+		args = append(args, c.CreatedAt, c.CreatedAt, c.ID)
+	}
+	// One extra row tells whether there is a next page.
+	q += ` ORDER BY created_at, id LIMIT ?`
+	args = append(args, req.Limit+1)
+
+	queryFn := metrics.DBExecObserver("select_statement_lines", func(c context.Context) error {
+		return app.DB.SelectContext(c, &out.Transactions, q, args...)
+	})
+	if err := queryFn(ctx); err != nil {
+		return Statement{}, err
+	}
+	if len(out.Transactions) > req.Limit {
+		out.Transactions = out.Transactions[:req.Limit]
+		last := out.Transactions[req.Limit-1]
+		out.NextCursor = cursor{CreatedAt: last.CreatedAt, ID: last.ID}.encode()
+	}
+
+	var err error
+	if !req.From.IsZero() {
+		if out.OpeningBalance, err = sumTransactionsBefore(ctx, req.UserID, req.From); err != nil {
+			return Statement{}, err
+		}
+	}
+	if out.ClosingBalance, err = sumTransactionsBefore(ctx, req.UserID, req.To); err != nil {
+		return Statement{}, err
+	}
+	return out, nil
+}
+
+func sumTransactionsBefore(ctx context.Context, userID int64, before time.Time) (int64, error) {
+	const q = `SELECT COALESCE(SUM(amount), 0) FROM user_transactions WHERE user_id = ? AND created_at < ?`
+	var sum int64
+	queryFn := metrics.DBExecObserver("select_statement_balance", func(c context.Context) error {
+		return app.DB.GetContext(c, &sum, q, userID, before)
+	})
+	if err := queryFn(ctx); err != nil {
+		return 0, err
+	}
+	return sum, nil
+}
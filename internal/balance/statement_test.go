@@ -0,0 +1,87 @@
+package balance
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"sms-gateway/app"
+	"sms-gateway/testutil"
+)
+
+func TestStatementCursorRoundTrip(t *testing.T) {
+	in := cursor{CreatedAt: time.Date(2026, 3, 1, 10, 0, 5, 0, time.UTC), ID: 42}
+	out, err := decodeCursor(in.encode())
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if !out.CreatedAt.Equal(in.CreatedAt) || out.ID != in.ID {
+		t.Fatalf("round trip: got %+v want %+v", out, in)
+	}
+
+	for _, bad := range []string{"!!", "bm9waXBl", "MTIzfDA"} {
+		if _, err := decodeCursor(bad); !errors.Is(err, ErrInvalidCursor) {
+			t.Fatalf("decodeCursor(%q) err = %v, want ErrInvalidCursor", bad, err)
+		}
+	}
+}
+
+func TestGetStatement_PagesAndBalances(t *testing.T) {
+	ctx := testutil.EnsureSetup(t)
+	testutil.ResetTables(ctx, t)
+
+	seed := []struct {
+		amount int64
+		typ    transactionType
+		at     string
+	}{
+		{100, Deposit, "2026-01-31 23:00:00"},
+		{-10, Withdrawal, "2026-02-01 09:00:00"},
+		{-20, Withdrawal, "2026-02-01 09:00:00"},
+		{50, Deposit, "2026-02-10 12:00:00"},
+		{-5, Withdrawal, "2026-02-20 08:00:00"},
+		{-7, Withdrawal, "2026-03-01 00:00:00"},
+	}
+	for i, s := range seed {
+		if _, err := app.DB.ExecContext(ctx,
+			"INSERT INTO user_transactions (user_id, amount, transaction_type, description, transaction_id, created_at) VALUES (?, ?, ?, ?, ?, ?)",
+			801, s.amount, s.typ, "seed", "st-"+string(rune('a'+i)), s.at); err != nil {
+			t.Fatalf("seed tx: %v", err)
+		}
+	}
+
+	from := time.Date(2026, 2, 1, 0, 0, 0, 0, time.Local)
+	to := time.Date(2026, 3, 1, 0, 0, 0, 0, time.Local)
+	req := StatementRequest{UserID: 801, From: from, To: to, Limit: 2}
+
+	var lines []StatementLine
+	for page := 0; ; page++ {
+		st, err := GetStatement(ctx, req)
+		if err != nil {
+			t.Fatalf("statement: %v", err)
+		}
+		if st.OpeningBalance != 100 || st.ClosingBalance != 115 {
+			t.Fatalf("page %d: opening/closing = %d/%d, want 100/115", page, st.OpeningBalance, st.ClosingBalance)
+		}
+		lines = append(lines, st.Transactions...)
+		if st.NextCursor == "" {
+			break
+		}
+		req.Cursor = st.NextCursor
+	}
+	if len(lines) != 4 {
+		t.Fatalf("expected 4 lines in February, got %d: %+v", len(lines), lines)
+	}
+	// Two rows share 09:00:00; the id tie-breaker keeps both, in insert order.
+	if lines[0].Amount != -10 || lines[1].Amount != -20 || lines[3].Amount != -5 {
+		t.Fatalf("unexpected order: %+v", lines)
+	}
+
+	st, err := GetStatement(ctx, StatementRequest{UserID: 801, From: from, To: to, Types: []transactionType{Deposit}})
+	if err != nil {
+		t.Fatalf("statement by type: %v", err)
+	}
+	if len(st.Transactions) != 1 || st.Transactions[0].Amount != 50 || st.ClosingBalance != 115 {
+		t.Fatalf("unexpected filtered statement: %+v", st)
+	}
+}
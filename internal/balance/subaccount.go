@@ -0,0 +1,425 @@
+package balance
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"sms-gateway/app"
+	"sms-gateway/internal/auth"
+	"sms-gateway/internal/ledger"
+	"sms-gateway/internal/model"
+	"sms-gateway/internal/pricing"
+	"sms-gateway/pkg/metrics"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+var (
+	ErrInvalidSubAccount = errors.New("invalid sub-account")
+	ErrNotSubAccount     = errors.New("not a sub-account of this parent")
+	ErrInvalidTransfer   = errors.New("invalid transfer")
+)
+
+// SubAccount links a reseller's client (ChildID) to the reseller (ParentID). The hierarchy is
+// one level deep: a parent cannot itself be a sub-account and a sub-account cannot have
+// children, so there are no cycles and the fallback charge touches at most two balances.
+type SubAccount struct {
+	ChildID  int64  `db:"child_id" json:"child_id"`
+	ParentID int64  `db:"parent_id" json:"parent_id"`
+	Name     string `db:"name" json:"name"`
+	// ChargeParent lets ChargeTx reserve on the parent's balance when the child's is short.
+	ChargeParent bool `db:"charge_parent" json:"charge_parent"`
+	// CreatedByParent is set for children the parent created; only their balance can be
+	// taken back. Existing customers linked by an admin keep what they have.
+	CreatedByParent bool      `db:"created_by_parent" json:"created_by_parent"`
+	CreatedAt       time.Time `db:"created_at" json:"created_at"`
+	Balance         int64     `db:"balance" json:"balance"`
+	Available       int64     `db:"available" json:"available"`
+}
+
+// CreateSubAccount creates the customer sa.ChildID with its first API key and makes it a
+// sub-account of sa.ParentID, in one transaction. An existing customer id is rejected with
+// auth.ErrCustomerExists; linking existing customers is LinkSubAccount, for admins.
+func CreateSubAccount(ctx context.Context, sa SubAccount, keyName string) (_ SubAccount, _ auth.IssuedKey, err error) {
+	if sa.ParentID == 0 || sa.ChildID == 0 || sa.ParentID == sa.ChildID {
+		return SubAccount{}, auth.IssuedKey{}, ErrInvalidSubAccount
+	}
+
+	tx, err := app.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return SubAccount{}, auth.IssuedKey{}, err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	if err = checkHierarchyTx(ctx, tx, sa); err != nil {
+		return SubAccount{}, auth.IssuedKey{}, err
+	}
+	if _, existing, lookupErr := subAccountTx(ctx, tx, sa.ChildID); lookupErr != nil {
+		err = lookupErr
+		return SubAccount{}, auth.IssuedKey{}, err
+	} else if existing {
+		err = auth.ErrCustomerExists
+		return SubAccount{}, auth.IssuedKey{}, err
+	}
+	_, key, err := auth.CreateCustomerTx(ctx, tx, auth.Customer{ID: sa.ChildID, Name: sa.Name}, keyName)
+	if err != nil {
+		return SubAccount{}, auth.IssuedKey{}, err
+	}
+
+	sa.CreatedByParent = true
+	if err = upsertSubAccountTx(ctx, tx, sa); err != nil {
+		return SubAccount{}, auth.IssuedKey{}, err
+	}
+	out, _, err := subAccountTx(ctx, tx, sa.ChildID)
+	if err != nil {
+		return SubAccount{}, auth.IssuedKey{}, err
+	}
+	if err = tx.Commit(); err != nil {
+		return SubAccount{}, auth.IssuedKey{}, err
+	}
+	return out, key, nil
+}
+
+// UpdateSubAccount changes the name and charge_parent of one of the parent's sub-accounts.
+func UpdateSubAccount(ctx context.Context, sa SubAccount) error {
+	if err := CheckSubAccount(ctx, sa.ParentID, sa.ChildID); err != nil {
+		return err
+	}
+	const q = `UPDATE sub_accounts SET name = ?, charge_parent = ? WHERE child_id = ? AND parent_id = ?`
+	execFn := metrics.DBExecObserver("update_sub_account", func(c context.Context) error {
+		_, err := app.DB.ExecContext(c, q, sa.Name, sa.ChargeParent, sa.ChildID, sa.ParentID)
+		return err
+	})
+	return execFn(ctx)
+}
+
+// LinkSubAccount makes an existing customer a sub-account of sa.ParentID, or updates its name
+// and charge_parent when it already belongs to the same parent. It is for admins: the parent
+// gets the fallback charge and the child's usage, but cannot take its balance.
+func LinkSubAccount(ctx context.Context, sa SubAccount) (err error) {
+	if sa.ParentID == 0 || sa.ChildID == 0 || sa.ParentID == sa.ChildID {
+		return ErrInvalidSubAccount
+	}
+
+	tx, err := app.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	if err = checkHierarchyTx(ctx, tx, sa); err != nil {
+		return err
+	}
+	sa.CreatedByParent = false
+	if err = upsertSubAccountTx(ctx, tx, sa); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// checkHierarchyTx locks the rows (and index gaps) that decide where the pair may sit in the
+// hierarchy and rejects links that would break it.
+func checkHierarchyTx(ctx context.Context, tx *sqlx.Tx, sa SubAccount) error {
+	var links []SubAccount
+	const hierarchyQ = `SELECT child_id, parent_id FROM sub_accounts WHERE child_id IN (?, ?) OR parent_id = ? FOR UPDATE`
+	if err := metrics.DBExecObserver("select_sub_account_hierarchy", func(c context.Context) error {
+		return tx.SelectContext(c, &links, hierarchyQ, sa.ParentID, sa.ChildID, sa.ChildID)
+	})(ctx); err != nil {
+		return err
+	}
+	for _, l := range links {
+		switch {
+		case l.ChildID == sa.ParentID, l.ParentID == sa.ChildID:
+			return fmt.Errorf("%w: hierarchy is one level deep", ErrInvalidSubAccount)
+		case l.ChildID == sa.ChildID && l.ParentID != sa.ParentID:
+			return fmt.Errorf("%w: already a sub-account of another parent", ErrInvalidSubAccount)
+		}
+	}
+	return nil
+}
+
+// upsertSubAccountTx writes the link; created_by_parent is only set on insert.
+func upsertSubAccountTx(ctx context.Context, tx *sqlx.Tx, sa SubAccount) error {
+	const upsertQ = `
+		INSERT INTO sub_accounts (child_id, parent_id, name, charge_parent, created_by_parent)
+		VALUES (?, ?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE name = VALUES(name), charge_parent = VALUES(charge_parent)
+	`
+	if err := metrics.DBExecObserver("upsert_sub_account", func(c context.Context) error {
+		_, execErr := tx.ExecContext(c, upsertQ, sa.ChildID, sa.ParentID, sa.Name, sa.ChargeParent, sa.CreatedByParent)
+		return execErr
+	})(ctx); err != nil {
+		return err
+	}
+
+	// Transfers lock both balance rows, so make sure they exist.
+	const ensureQ = `INSERT INTO user_balances (user_id, balance) VALUES (?, 0), (?, 0) ON DUPLICATE KEY UPDATE user_id = user_id`
+	return metrics.DBExecObserver("ensure_user_balance", func(c context.Context) error {
+		_, execErr := tx.ExecContext(c, ensureQ, sa.ParentID, sa.ChildID)
+		return execErr
+	})(ctx)
+}
+
+func subAccountTx(ctx context.Context, tx *sqlx.Tx, childID int64) (SubAccount, bool, error) {
+	const q = `SELECT child_id, parent_id, name, charge_parent, created_by_parent, created_at FROM sub_accounts WHERE child_id = ?`
+	var sa SubAccount
+	queryFn := metrics.DBExecObserver("select_sub_account", func(c context.Context) error {
+		return tx.GetContext(c, &sa, q, childID)
+	})
+	if err := queryFn(ctx); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return SubAccount{}, false, nil
+		}
+		return SubAccount{}, false, err
+	}
+	return sa, true, nil
+}
+
+// ListSubAccounts returns the parent's sub-accounts with their balances.
+func ListSubAccounts(ctx context.Context, parentID int64) ([]SubAccount, error) {
+	const q = `
+		SELECT s.child_id, s.parent_id, s.name, s.charge_parent, s.created_by_parent, s.created_at,
+		       COALESCE(` + totalBalanceExpr + `, 0) AS balance, COALESCE(` + totalAvailableExpr + `, 0) AS available
+		FROM sub_accounts s
+		LEFT JOIN user_balances b ON b.user_id = s.child_id
+		WHERE s.parent_id = ?
+		ORDER BY s.child_id
+	`
+	var out []SubAccount
+	queryFn := metrics.DBExecObserver("select_sub_accounts", func(c context.Context) error {
+		return app.DB.SelectContext(c, &out, q, parentID)
+	})
+	if err := queryFn(ctx); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// CheckSubAccount returns ErrNotSubAccount unless childID is a sub-account of parentID.
+func CheckSubAccount(ctx context.Context, parentID, childID int64) error {
+	_, err := getSubAccount(ctx, parentID, childID)
+	return err
+}
+
+// getSubAccount returns the link of childID, or ErrNotSubAccount unless it belongs to parentID.
+func getSubAccount(ctx context.Context, parentID, childID int64) (SubAccount, error) {
+	const q = `SELECT child_id, parent_id, name, charge_parent, created_by_parent, created_at FROM sub_accounts WHERE child_id = ?`
+	var sa SubAccount
+	queryFn := metrics.DBExecObserver("select_sub_account_parent", func(c context.Context) error {
+		return app.DB.GetContext(c, &sa, q, childID)
+	})
+	if err := queryFn(ctx); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return SubAccount{}, ErrNotSubAccount
+		}
+		return SubAccount{}, err
+	}
+	if sa.ParentID != parentID {
+		return SubAccount{}, ErrNotSubAccount
+	}
+	return sa, nil
+}
+
+// CreateSubAccountPrice adds a price row for one of the parent's sub-accounts. The child's
+// rows override the default list for everything it sends, also when it pays itself, so a row
+// below what the parent pays for the destinations and volumes it covers is rejected; the
+// parent could otherwise send through the child for less.
+func CreateSubAccountPrice(ctx context.Context, parentID int64, p pricing.Price) (pricing.Price, error) {
+	if err := CheckSubAccount(ctx, parentID, p.CustomerID); err != nil {
+		return pricing.Price{}, err
+	}
+
+	at := time.Now()
+	if p.EffectiveFrom.After(at) {
+		at = p.EffectiveFrom
+	}
+	floor, err := pricing.HighestPrice(ctx, parentID, p.Type, p.DestinationPrefix, p.MinVolume, at)
+	if err != nil {
+		return pricing.Price{}, err
+	}
+	if p.Price < floor {
+		return pricing.Price{}, fmt.Errorf("%w: below the parent's price of %d", pricing.ErrInvalidPrice, floor)
+	}
+	return pricing.CreatePrice(ctx, p)
+}
+
+// chargeParentTx returns the parent to fall back to when customerID is a sub-account with
+// charge_parent set.
+func chargeParentTx(ctx context.Context, tx *sqlx.Tx, customerID int64) (int64, bool, error) {
+	const q = `SELECT parent_id FROM sub_accounts WHERE child_id = ? AND charge_parent = 1`
+	var parentID int64
+	queryFn := metrics.DBExecObserver("select_charge_parent", func(c context.Context) error {
+		return tx.GetContext(c, &parentID, q, customerID)
+	})
+	if err := queryFn(ctx); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, false, nil
+		}
+		return 0, false, err
+	}
+	return parentID, true, nil
+}
+
+type TransferRequest struct {
+	ParentID int64
+	ChildID  int64
+	// Amount > 0 moves balance from the parent to the child, Amount < 0 takes it back; only
+	// from children the parent created.
+	Amount      int64
+	Description string
+}
+
+type TransferResult struct {
+	TransactionID string `json:"transaction_id"`
+	From          int64  `json:"from"`
+	To            int64  `json:"to"`
+	Amount        int64  `json:"amount"`
+}
+
+// TransferBalance moves available balance between a parent and one of its sub-accounts in a single
+// DB transaction: both balance rows are locked (in user_id order, so concurrent transfers in
+// opposite directions cannot deadlock) and the source's shards are drawn on when its own row
+// falls short, one transaction is recorded per side and a
+// wallet -> wallet journal is posted. Credit limits are not transferable: only the source's
+// available balance (balance - held) can be moved.
+func TransferBalance(ctx context.Context, req TransferRequest) (res TransferResult, err error) {
+	if req.Amount == 0 {
+		return TransferResult{}, ErrInvalidTransfer
+	}
+	sa, err := getSubAccount(ctx, req.ParentID, req.ChildID)
+	if err != nil {
+		return TransferResult{}, err
+	}
+	if req.Amount < 0 && !sa.CreatedByParent {
+		return TransferResult{}, fmt.Errorf("%w: balance of a linked sub-account cannot be taken back", ErrInvalidTransfer)
+	}
+
+	from, to, amount := req.ParentID, req.ChildID, req.Amount
+	if amount < 0 {
+		from, to, amount = req.ChildID, req.ParentID, -amount
+	}
+
+	tx, err := app.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return TransferResult{}, err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	var rows []struct {
+		UserID    int64 `db:"user_id"`
+		Available int64 `db:"available"`
+	}
+	const lockQ = `SELECT user_id, balance - held AS available FROM user_balances WHERE user_id IN (?, ?) ORDER BY user_id FOR UPDATE`
+	if err = metrics.DBExecObserver("select_balances_for_transfer", func(c context.Context) error {
+		return tx.SelectContext(c, &rows, lockQ, from, to)
+	})(ctx); err != nil {
+		return TransferResult{}, err
+	}
+	if len(rows) != 2 {
+		return TransferResult{}, ErrInsufficientBalance
+	}
+	for _, r := range rows {
+		if r.UserID != from || r.Available >= amount {
+			continue
+		}
+		// The rest may sit on the source's balance shards.
+		moved, err := pullShardsTx(ctx, tx, from, amount-r.Available)
+		if err != nil {
+			return TransferResult{}, err
+		}
+		if r.Available+moved < amount {
+			return TransferResult{}, ErrInsufficientBalance
+		}
+	}
+
+	const updateQ = `UPDATE user_balances SET balance = balance + ? WHERE user_id = ?`
+	for _, u := range []struct {
+		userID int64
+		delta  int64
+	}{{from, -amount}, {to, amount}} {
+		if err = metrics.DBExecObserver("update_balance_transfer", func(c context.Context) error {
+			_, execErr := tx.ExecContext(c, updateQ, u.delta, u.userID)
+			return execErr
+		})(ctx); err != nil {
+			return TransferResult{}, err
+		}
+	}
+
+	description := req.Description
+	if description == "" {
+		description = fmt.Sprintf("انتقال موجودی از %d به %d", from, to)
+	}
+	txID := uuid.NewString()
+	const insertTxn = `INSERT INTO user_transactions (user_id, amount, transaction_type, description, transaction_id, reference_id) VALUES (?, ?, ?, ?, ?, ?), (?, ?, ?, ?, ?, ?)`
+	if err = metrics.DBExecObserver("insert_transfer_txns", func(c context.Context) error {
+		_, execErr := tx.ExecContext(c, insertTxn,
+			from, -amount, Transfer, description, txID, nil,
+			to, amount, Transfer, description, uuid.NewString(), txID)
+		return execErr
+	})(ctx); err != nil {
+		return TransferResult{}, err
+	}
+
+	if err = ledger.PostTx(ctx, tx, ledger.Transfer(ledger.JournalTransfer, txID, req.ParentID, ledger.WalletAccount(from), ledger.WalletAccount(to), amount)); err != nil {
+		return TransferResult{}, err
+	}
+	if err = fireLowBalanceAlertsTx(ctx, tx, from, txID); err != nil {
+		return TransferResult{}, err
+	}
+	if err = rearmAlertsTx(ctx, tx, to); err != nil {
+		return TransferResult{}, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return TransferResult{}, err
+	}
+	return TransferResult{TransactionID: txID, From: from, To: to, Amount: amount}, nil
+}
+
+// SubAccountUsage is what one sub-account spent on one message type in a period.
+type SubAccountUsage struct {
+	CustomerID int64      `db:"customer_id" json:"customer_id"`
+	Type       model.Type `db:"type" json:"type"`
+	Messages   int64      `db:"messages" json:"messages"`
+	Amount     int64      `db:"amount" json:"amount"`
+	// PaidByParent is the part of Amount charged to the parent by the fallback.
+	PaidByParent int64 `db:"paid_by_parent" json:"paid_by_parent"`
+}
+
+// GetSubAccountUsage aggregates the delivered (captured) messages of the parent's
+// sub-accounts in [from, to), per sub-account and type.
+func GetSubAccountUsage(ctx context.Context, parentID int64, from, to time.Time) ([]SubAccountUsage, error) {
+	const q = `
+		SELECT h.customer_id, h.type, COUNT(*) AS messages, SUM(h.amount) AS amount,
+		       SUM(CASE WHEN h.user_id = s.parent_id THEN h.amount ELSE 0 END) AS paid_by_parent
+		FROM sub_accounts s
+		JOIN balance_holds h ON h.customer_id = s.child_id AND h.status = ? AND h.updated_at >= ? AND h.updated_at < ?
+		WHERE s.parent_id = ?
+		GROUP BY h.customer_id, h.type
+		ORDER BY h.customer_id, h.type
+	`
+	var out []SubAccountUsage
+	queryFn := metrics.DBExecObserver("select_sub_account_usage", func(c context.Context) error {
+		return app.DB.SelectContext(c, &out, q, HoldCaptured, from, to, parentID)
+	})
+	if err := queryFn(ctx); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
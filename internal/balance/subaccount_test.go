@@ -0,0 +1,205 @@
+package balance
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"sms-gateway/internal/auth"
+	"sms-gateway/internal/ledger"
+	"sms-gateway/internal/model"
+	"sms-gateway/internal/pricing"
+	"sms-gateway/testutil"
+)
+
+func TestCreateSubAccount(t *testing.T) {
+	ctx := testutil.EnsureSetup(t)
+	testutil.ResetTables(ctx, t)
+
+	sub, key, err := CreateSubAccount(ctx, SubAccount{ParentID: 1000, ChildID: 1001, Name: "shop"}, "")
+	if err != nil {
+		t.Fatalf("create sub-account: %v", err)
+	}
+	if !sub.CreatedByParent || sub.ParentID != 1000 || key.Key == "" {
+		t.Fatalf("unexpected sub-account %+v key %+v", sub, key)
+	}
+	if k, err := auth.Authenticate(ctx, key.Key); err != nil || k.CustomerID != 1001 {
+		t.Fatalf("child key authenticates as %+v, %v", k, err)
+	}
+
+	// An existing customer cannot be adopted, only linked by an admin.
+	if _, _, err := auth.CreateCustomer(ctx, auth.Customer{ID: 1002}, ""); err != nil {
+		t.Fatalf("create customer: %v", err)
+	}
+	for _, id := range []int64{1001, 1002} {
+		if _, _, err := CreateSubAccount(ctx, SubAccount{ParentID: 1000, ChildID: id}, ""); !errors.Is(err, auth.ErrCustomerExists) {
+			t.Fatalf("CreateSubAccount(%d) err = %v, want ErrCustomerExists", id, err)
+		}
+	}
+
+	if err := UpdateSubAccount(ctx, SubAccount{ParentID: 1000, ChildID: 1001, Name: "shop 2", ChargeParent: true}); err != nil {
+		t.Fatalf("update sub-account: %v", err)
+	}
+	if err := UpdateSubAccount(ctx, SubAccount{ParentID: 1000, ChildID: 1002}); !errors.Is(err, ErrNotSubAccount) {
+		t.Fatalf("update of a stranger: got %v, want ErrNotSubAccount", err)
+	}
+	subs, err := ListSubAccounts(ctx, 1000)
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if len(subs) != 1 || subs[0].Name != "shop 2" || !subs[0].ChargeParent || !subs[0].CreatedByParent {
+		t.Fatalf("unexpected sub-accounts: %+v", subs)
+	}
+}
+
+func TestLinkSubAccountHierarchyIsOneLevel(t *testing.T) {
+	ctx := testutil.EnsureSetup(t)
+	testutil.ResetTables(ctx, t)
+
+	if err := LinkSubAccount(ctx, SubAccount{ParentID: 1100, ChildID: 1101}); err != nil {
+		t.Fatalf("link sub-account: %v", err)
+	}
+	// Updating the same link is fine.
+	if err := LinkSubAccount(ctx, SubAccount{ParentID: 1100, ChildID: 1101, Name: "shop", ChargeParent: true}); err != nil {
+		t.Fatalf("update sub-account: %v", err)
+	}
+
+	for _, sa := range []SubAccount{
+		{ParentID: 1101, ChildID: 1102}, // a child cannot have children
+		{ParentID: 1102, ChildID: 1100}, // a parent cannot become a child
+		{ParentID: 1103, ChildID: 1101}, // a child has one parent
+		{ParentID: 1100, ChildID: 1100},
+	} {
+		if err := LinkSubAccount(ctx, sa); !errors.Is(err, ErrInvalidSubAccount) {
+			t.Fatalf("LinkSubAccount(%+v) err = %v, want ErrInvalidSubAccount", sa, err)
+		}
+	}
+
+	subs, err := ListSubAccounts(ctx, 1100)
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if len(subs) != 1 || subs[0].Name != "shop" || !subs[0].ChargeParent || subs[0].CreatedByParent {
+		t.Fatalf("unexpected sub-accounts: %+v", subs)
+	}
+}
+
+func TestTransferBalance(t *testing.T) {
+	ctx := testutil.EnsureSetup(t)
+	testutil.ResetTables(ctx, t)
+
+	if _, err := AddBalance(ctx, AddBalanceRequest{CustomerID: 1200, Amount: 50}); err != nil {
+		t.Fatalf("add balance: %v", err)
+	}
+	if _, _, err := CreateSubAccount(ctx, SubAccount{ParentID: 1200, ChildID: 1201}, ""); err != nil {
+		t.Fatalf("create sub-account: %v", err)
+	}
+	if _, err := AddBalance(ctx, AddBalanceRequest{CustomerID: 1202, Amount: 10}); err != nil {
+		t.Fatalf("add balance: %v", err)
+	}
+	if err := LinkSubAccount(ctx, SubAccount{ParentID: 1200, ChildID: 1202}); err != nil {
+		t.Fatalf("link sub-account: %v", err)
+	}
+
+	if _, err := TransferBalance(ctx, TransferRequest{ParentID: 1200, ChildID: 1201, Amount: 30}); err != nil {
+		t.Fatalf("transfer: %v", err)
+	}
+	if _, err := TransferBalance(ctx, TransferRequest{ParentID: 1200, ChildID: 1201, Amount: -10}); err != nil {
+		t.Fatalf("transfer back: %v", err)
+	}
+	if _, err := TransferBalance(ctx, TransferRequest{ParentID: 1200, ChildID: 1201, Amount: 31}); !errors.Is(err, ErrInsufficientBalance) {
+		t.Fatalf("expected ErrInsufficientBalance, got %v", err)
+	}
+	// A linked customer's balance is its own.
+	if _, err := TransferBalance(ctx, TransferRequest{ParentID: 1200, ChildID: 1202, Amount: -10}); !errors.Is(err, ErrInvalidTransfer) {
+		t.Fatalf("expected ErrInvalidTransfer, got %v", err)
+	}
+	if _, err := TransferBalance(ctx, TransferRequest{ParentID: 1201, ChildID: 1200, Amount: 1}); !errors.Is(err, ErrNotSubAccount) {
+		t.Fatalf("expected ErrNotSubAccount, got %v", err)
+	}
+
+	parent, _ := GetUserBalances(ctx, "1200")
+	child, _ := GetUserBalances(ctx, "1201")
+	if parent.Balance != 30 || child.Balance != 20 {
+		t.Fatalf("expected 30/20 after transfers, got %d/%d", parent.Balance, child.Balance)
+	}
+
+	for _, id := range []int64{1200, 1201} {
+		accounts, err := ledger.Balances(ctx, &id)
+		if err != nil {
+			t.Fatalf("ledger balances: %v", err)
+		}
+		b, _ := GetUserBalance(ctx, strconv.FormatInt(id, 10))
+		if len(accounts) != 1 || accounts[0].Balance != b {
+			t.Fatalf("wallet %d does not match balance %d: %+v", id, b, accounts)
+		}
+	}
+}
+
+func TestChargeFallsBackToParent(t *testing.T) {
+	ctx := testutil.EnsureSetup(t)
+	testutil.ResetTables(ctx, t)
+
+	if _, err := AddBalance(ctx, AddBalanceRequest{CustomerID: 1300, Amount: 100}); err != nil {
+		t.Fatalf("add balance: %v", err)
+	}
+	if _, err := AddBalance(ctx, AddBalanceRequest{CustomerID: 1301, Amount: 5}); err != nil {
+		t.Fatalf("add balance: %v", err)
+	}
+
+	// Without charge_parent the child is simply short.
+	if err := LinkSubAccount(ctx, SubAccount{ParentID: 1300, ChildID: 1301}); err != nil {
+		t.Fatalf("link sub-account: %v", err)
+	}
+	// The parent pays the builtin 1, so the child cannot be priced at 0.
+	if _, err := CreateSubAccountPrice(ctx, 1300, pricing.Price{CustomerID: 1301, Type: model.NORMAL, Price: 0}); !errors.Is(err, pricing.ErrInvalidPrice) {
+		t.Fatalf("expected ErrInvalidPrice, got %v", err)
+	}
+	if _, err := CreateSubAccountPrice(ctx, 1300, pricing.Price{CustomerID: 1301, Type: model.NORMAL, Price: 4}); err != nil {
+		t.Fatalf("seed price: %v", err)
+	}
+	req := ChargeRequest{CustomerID: 1301, Quantity: 2, Type: model.NORMAL, Recipients: []string{"+1", "+2"}}
+	if _, err := Charge(ctx, req); !errors.Is(err, ErrInsufficientBalance) {
+		t.Fatalf("expected ErrInsufficientBalance, got %v", err)
+	}
+
+	if err := UpdateSubAccount(ctx, SubAccount{ParentID: 1300, ChildID: 1301, ChargeParent: true}); err != nil {
+		t.Fatalf("set charge_parent: %v", err)
+	}
+	txID, err := Charge(ctx, req)
+	if err != nil {
+		t.Fatalf("fallback charge: %v", err)
+	}
+	if err := Capture(ctx, model.SMS{CustomerID: 1301, TransactionID: txID}); err != nil {
+		t.Fatalf("capture: %v", err)
+	}
+
+	parent, _ := GetUserBalances(ctx, "1300")
+	child, _ := GetUserBalances(ctx, "1301")
+	if parent.Balance != 92 || child.Balance != 5 {
+		t.Fatalf("expected the child's price (8) on the parent, got parent %+v child %+v", parent, child)
+	}
+
+	usage, err := GetSubAccountUsage(ctx, 1300, time.Now().Add(-time.Hour), time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("usage: %v", err)
+	}
+	if len(usage) != 1 || usage[0].CustomerID != 1301 || usage[0].Messages != 2 || usage[0].Amount != 8 || usage[0].PaidByParent != 8 {
+		t.Fatalf("unexpected usage: %+v", usage)
+	}
+
+	// The refund of the child's message goes back to the parent, who paid for it.
+	r, err := Refund(ctx, RefundRequest{CustomerID: 1301, TransactionID: txID})
+	if err != nil {
+		t.Fatalf("refund: %v", err)
+	}
+	parent, _ = GetUserBalances(ctx, "1300")
+	child, _ = GetUserBalances(ctx, "1301")
+	if r.UserID != 1300 || r.Amount != 8 || parent.Balance != 100 || child.Balance != 5 {
+		t.Fatalf("expected 8 refunded to the parent, got %+v parent %+v child %+v", r, parent, child)
+	}
+	if _, err := Refund(ctx, RefundRequest{CustomerID: 1302, TransactionID: txID, Key: "other"}); !errors.Is(err, ErrTransactionNotFound) {
+		t.Fatalf("expected another customer's refund to be not found, got %v", err)
+	}
+}
@@ -0,0 +1,71 @@
+package grpcapi
+
+import (
+	"errors"
+	"strconv"
+
+	"sms-gateway/app"
+	"sms-gateway/internal/balance"
+	"sms-gateway/internal/sms"
+	"sms-gateway/pkg/apierror"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// errorDomain is the ErrorInfo domain of every error this API returns.
+const errorDomain = "sms-gateway"
+
+// toStatus turns the errors of the shared sms and balance functions into gRPC statuses. Like
+// the HTTP envelope, each carries the apierror code, as the ErrorInfo reason, so clients of
+// both APIs branch on the same codes.
+func toStatus(err error) error {
+	var (
+		re *sms.RecipientError
+		le *sms.LimitError
+	)
+	switch {
+	case errors.Is(err, sms.ErrNoRecipients):
+		return newStatus(codes.InvalidArgument, apierror.InvalidRecipient, err.Error(), nil)
+	case errors.As(err, &re):
+		return newStatus(codes.InvalidArgument, apierror.InvalidRecipient, err.Error(), map[string]string{
+			"index":     strconv.Itoa(re.Index),
+			"recipient": re.Recipient,
+		})
+	case errors.As(err, &le):
+		st := newStatus(codes.ResourceExhausted, le.Code(), err.Error(), map[string]string{
+			"limit":           le.Limit,
+			"retry_after_sec": strconv.Itoa(le.RetryAfterSeconds()),
+		})
+		withRetry, detailsErr := status.Convert(st).WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(le.RetryAfter)})
+		if detailsErr != nil {
+			return st
+		}
+		return withRetry.Err()
+	case errors.Is(err, sms.ErrOverLimit):
+		return newStatus(codes.InvalidArgument, apierror.OverLimit, err.Error(), nil)
+	case errors.Is(err, balance.ErrInsufficientBalance):
+		return newStatus(codes.FailedPrecondition, apierror.InsufficientBalance, "insufficient balance", nil)
+	case errors.Is(err, sms.ErrBlocked):
+		return newStatus(codes.FailedPrecondition, apierror.ContentBlocked, err.Error(), nil)
+	case errors.Is(err, sms.ErrPriorityOutOfRange):
+		return newStatus(codes.InvalidArgument, apierror.PriorityOutOfRange, err.Error(), nil)
+	}
+	app.Logger.Error("grpc call failed", "err", err)
+	return newStatus(codes.Internal, apierror.Internal, "internal error", nil)
+}
+
+func newStatus(c codes.Code, code apierror.Code, message string, metadata map[string]string) error {
+	st := status.New(c, message)
+	withInfo, err := st.WithDetails(&errdetails.ErrorInfo{
+		Reason:   string(code),
+		Domain:   errorDomain,
+		Metadata: metadata,
+	})
+	if err != nil {
+		return st.Err()
+	}
+	return withInfo.Err()
+}
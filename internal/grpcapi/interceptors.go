@@ -0,0 +1,102 @@
+package grpcapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+
+	"sms-gateway/app"
+	"sms-gateway/internal/auth"
+	"sms-gateway/pkg/apierror"
+	"sms-gateway/pkg/tracing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// authenticate is the gRPC counterpart of auth.Middleware: it reads the API key from the
+// "authorization: Bearer <key>" metadata and puts its customer into the context.
+func authenticate(ctx context.Context) (context.Context, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get("authorization")
+	if len(values) == 0 {
+		return ctx, status.Error(codes.Unauthenticated, "missing bearer token")
+	}
+	key, ok := auth.BearerToken(values[0])
+	if !ok {
+		return ctx, status.Error(codes.Unauthenticated, "missing bearer token")
+	}
+
+	k, err := auth.Authenticate(ctx, key)
+	if err != nil {
+		if errors.Is(err, auth.ErrUnauthenticated) {
+			return ctx, newStatus(codes.Unauthenticated, apierror.InvalidAPIKey, err.Error(), nil)
+		}
+		app.Logger.Error("authenticate api key", "err", err)
+		return ctx, status.Error(codes.Internal, "internal error")
+	}
+
+	ctx = auth.WithCustomer(ctx, k.CustomerID)
+	ctx = tracing.WithUser(ctx, fmt.Sprint(k.CustomerID))
+	return ctx, nil
+}
+
+func authUnary(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	ctx, err := authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func authStream(srv any, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := authenticate(ss.Context())
+	if err != nil {
+		return err
+	}
+	return handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+}
+
+func tracingUnary(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	ctx, span := tracing.Start(ctx, "grpc.request", tracing.Attr("method", info.FullMethod))
+	defer span.End()
+	return handler(ctx, req)
+}
+
+func tracingStream(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, span := tracing.Start(ss.Context(), "grpc.stream", tracing.Attr("method", info.FullMethod))
+	defer span.End()
+	return handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+}
+
+// recoverUnary and recoverStream turn a panicking call into an Internal error, like echo's
+// Recover middleware does for HTTP.
+func recoverUnary(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (_ any, err error) {
+	defer recoverCall(info.FullMethod, &err)
+	return handler(ctx, req)
+}
+
+func recoverStream(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+	defer recoverCall(info.FullMethod, &err)
+	return handler(srv, ss)
+}
+
+func recoverCall(method string, err *error) {
+	if r := recover(); r != nil {
+		app.Logger.Error("grpc panic", "method", method, "panic", r, "stack", string(debug.Stack()))
+		*err = status.Error(codes.Internal, "internal error")
+	}
+}
+
+// serverStream overrides the context of a stream, which grpc.ServerStream does not allow.
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
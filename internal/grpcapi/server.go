@@ -0,0 +1,261 @@
+package grpcapi
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	gatewayv1 "sms-gateway/api/gateway/v1"
+	"sms-gateway/app"
+	"sms-gateway/internal/auth"
+	"sms-gateway/internal/balance"
+	"sms-gateway/internal/model"
+	"sms-gateway/internal/sms"
+	"sms-gateway/pkg/metrics"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Server implements the Gateway service on top of the same sms and balance functions the HTTP
+// handlers use.
+type Server struct {
+	gatewayv1.UnimplementedGatewayServer
+}
+
+// New returns a gRPC server with the Gateway service registered. Every call is traced, measured
+// and authenticated with the caller's API key, like the customer HTTP routes.
+func New() *grpc.Server {
+	s := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(tracingUnary, metrics.GRPCUnaryInterceptor(), recoverUnary, authUnary),
+		grpc.ChainStreamInterceptor(tracingStream, metrics.GRPCStreamInterceptor(), recoverStream, authStream),
+	)
+	gatewayv1.RegisterGatewayServer(s, &Server{})
+	reflection.Register(s)
+	return s
+}
+
+func (*Server) SendSMS(ctx context.Context, req *gatewayv1.SendSMSRequest) (*gatewayv1.SendSMSResponse, error) {
+	customerID, err := customerID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	typ, err := fromMessageType(req.GetType())
+	if err != nil {
+		return nil, err
+	}
+	s := model.SMS{
+		CustomerID: customerID,
+		Text:       req.GetText(),
+		Recipients: req.GetRecipients(),
+		Type:       typ,
+	}
+	if req.Priority != nil {
+		p := int(req.GetPriority())
+		s.Priority = &p
+	}
+
+	s, state, err := sms.Send(ctx, s)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &gatewayv1.SendSMSResponse{
+		SmsIdentifier: s.SmsIdentifier,
+		Status:        toMessageStatus(state),
+	}, nil
+}
+
+func (*Server) GetMessage(ctx context.Context, req *gatewayv1.GetMessageRequest) (*gatewayv1.Message, error) {
+	customerID, err := customerID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if req.GetSmsIdentifier() == "" {
+		return nil, status.Error(codes.InvalidArgument, "sms_identifier is required")
+	}
+
+	rows, err := sms.GetUserHistory(ctx, fmt.Sprint(customerID), "", req.GetSmsIdentifier())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	if len(rows) == 0 {
+		return nil, status.Error(codes.NotFound, "message not found")
+	}
+
+	out := &gatewayv1.Message{
+		SmsIdentifier: req.GetSmsIdentifier(),
+		Type:          toMessageType(rows[0].Type),
+		CreatedAt:     parseTimestamp(rows[0].CreatedAt),
+	}
+	for _, r := range rows {
+		out.Recipients = append(out.Recipients, &gatewayv1.RecipientStatus{
+			Recipient: r.Recipient,
+			Status:    toMessageStatus(r.Status),
+			Provider:  r.Provider,
+			UpdatedAt: parseTimestamp(r.UpdatedAt),
+		})
+	}
+	return out, nil
+}
+
+func (*Server) ListHistory(ctx context.Context, req *gatewayv1.ListHistoryRequest) (*gatewayv1.ListHistoryResponse, error) {
+	customerID, err := customerID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	state, err := fromMessageStatus(req.GetStatus())
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := sms.GetUserHistory(ctx, fmt.Sprint(customerID), string(state), req.GetSmsIdentifier())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	out := &gatewayv1.ListHistoryResponse{Entries: make([]*gatewayv1.HistoryEntry, 0, len(rows))}
+	for _, r := range rows {
+		out.Entries = append(out.Entries, &gatewayv1.HistoryEntry{
+			SmsIdentifier: r.SmsIdentifier,
+			Type:          toMessageType(r.Type),
+			Recipient:     r.Recipient,
+			Status:        toMessageStatus(r.Status),
+			Provider:      r.Provider,
+			CreatedAt:     parseTimestamp(r.CreatedAt),
+			UpdatedAt:     parseTimestamp(r.UpdatedAt),
+		})
+	}
+	return out, nil
+}
+
+func (*Server) GetBalance(ctx context.Context, _ *gatewayv1.GetBalanceRequest) (*gatewayv1.Balance, error) {
+	customerID, err := customerID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := balance.GetUserBalances(ctx, fmt.Sprint(customerID))
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &gatewayv1.Balance{
+		Balance:     b.Balance,
+		Held:        b.Held,
+		Available:   b.Available,
+		AccountMode: string(b.AccountMode),
+		CreditLimit: b.CreditLimit,
+	}, nil
+}
+
+// WatchStatus streams the status changes made to the customer's messages by any instance
+// bridged over RABBIT_STATUS_EXCHANGE. Changes made while the stream was not open are not sent;
+// the HTTP event stream can replay them.
+func (*Server) WatchStatus(req *gatewayv1.WatchStatusRequest, stream grpc.ServerStreamingServer[gatewayv1.StatusUpdate]) error {
+	ctx := stream.Context()
+	customerID, err := customerID(ctx)
+	if err != nil {
+		return err
+	}
+
+	events, cancel := sms.SubscribeStatus(customerID)
+	defer cancel()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case e, ok := <-events:
+			if !ok {
+				return nil
+			}
+			if req.GetSmsIdentifier() != "" && e.SmsIdentifier != req.GetSmsIdentifier() {
+				continue
+			}
+			if err := stream.Send(toStatusUpdate(e)); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func customerID(ctx context.Context) (int64, error) {
+	id, ok := auth.CustomerFrom(ctx)
+	if !ok {
+		return 0, status.Error(codes.Unauthenticated, "unauthenticated")
+	}
+	return id, nil
+}
+
+func toStatusUpdate(e sms.StatusEvent) *gatewayv1.StatusUpdate {
+	return &gatewayv1.StatusUpdate{
+		SmsIdentifier: e.SmsIdentifier,
+		Recipients:    e.Recipients,
+		Status:        toMessageStatus(e.Status),
+		Provider:      e.Provider,
+		Time:          timestamppb.New(e.Time),
+	}
+}
+
+func toMessageType(t model.Type) gatewayv1.MessageType {
+	switch t {
+	case model.NORMAL:
+		return gatewayv1.MessageType_MESSAGE_TYPE_NORMAL
+	case model.EXPRESS:
+		return gatewayv1.MessageType_MESSAGE_TYPE_EXPRESS
+	}
+	return gatewayv1.MessageType_MESSAGE_TYPE_UNSPECIFIED
+}
+
+// fromMessageType maps an unset type to normal, like an empty type over HTTP.
+func fromMessageType(t gatewayv1.MessageType) (model.Type, error) {
+	switch t {
+	case gatewayv1.MessageType_MESSAGE_TYPE_UNSPECIFIED, gatewayv1.MessageType_MESSAGE_TYPE_NORMAL:
+		return model.NORMAL, nil
+	case gatewayv1.MessageType_MESSAGE_TYPE_EXPRESS:
+		return model.EXPRESS, nil
+	}
+	return "", status.Errorf(codes.InvalidArgument, "unknown message type %d", t)
+}
+
+var messageStatuses = map[sms.State]gatewayv1.MessageStatus{
+	sms.Pending:  gatewayv1.MessageStatus_MESSAGE_STATUS_PENDING,
+	sms.Held:     gatewayv1.MessageStatus_MESSAGE_STATUS_HELD,
+	sms.Sending:  gatewayv1.MessageStatus_MESSAGE_STATUS_SENDING,
+	sms.Done:     gatewayv1.MessageStatus_MESSAGE_STATUS_DONE,
+	sms.Failed:   gatewayv1.MessageStatus_MESSAGE_STATUS_FAILED,
+	sms.Rejected: gatewayv1.MessageStatus_MESSAGE_STATUS_REJECTED,
+}
+
+func toMessageStatus(s sms.State) gatewayv1.MessageStatus {
+	return messageStatuses[s]
+}
+
+// fromMessageStatus maps an unset status to "" (no filter).
+func fromMessageStatus(s gatewayv1.MessageStatus) (sms.State, error) {
+	if s == gatewayv1.MessageStatus_MESSAGE_STATUS_UNSPECIFIED {
+		return "", nil
+	}
+	for state, ms := range messageStatuses {
+		if ms == s {
+			return state, nil
+		}
+	}
+	return "", status.Errorf(codes.InvalidArgument, "unknown message status %d", s)
+}
+
+// parseTimestamp reads the timestamps of UserHistory, which database/sql formats as RFC 3339.
+func parseTimestamp(s string) *timestamppb.Timestamp {
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		app.Logger.Warn("unparsable sms timestamp", "value", s, "err", err)
+		return nil
+	}
+	return timestamppb.New(t)
+}
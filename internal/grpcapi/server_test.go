@@ -0,0 +1,113 @@
+package grpcapi
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"testing"
+	"time"
+
+	gatewayv1 "sms-gateway/api/gateway/v1"
+	"sms-gateway/app"
+	"sms-gateway/internal/balance"
+	"sms-gateway/internal/sms"
+	"sms-gateway/pkg/apierror"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func init() {
+	if app.Logger == nil {
+		app.Logger = slog.New(slog.NewTextHandler(bytes.NewBuffer(nil), nil))
+	}
+}
+
+func TestToStatus(t *testing.T) {
+	cases := []struct {
+		err    error
+		code   codes.Code
+		reason apierror.Code
+	}{
+		{sms.ErrNoRecipients, codes.InvalidArgument, apierror.InvalidRecipient},
+		{&sms.RecipientError{Index: 1, Recipient: "abc"}, codes.InvalidArgument, apierror.InvalidRecipient},
+		{&sms.LimitError{Limit: sms.LimitDailyQuota, RetryAfter: time.Hour}, codes.ResourceExhausted, apierror.QuotaExceeded},
+		{&sms.LimitError{Limit: sms.LimitRequestsPerSec, RetryAfter: time.Second}, codes.ResourceExhausted, apierror.RateLimited},
+		{sms.ErrOverLimit, codes.InvalidArgument, apierror.OverLimit},
+		{balance.ErrInsufficientBalance, codes.FailedPrecondition, apierror.InsufficientBalance},
+		{sms.ErrBlocked, codes.FailedPrecondition, apierror.ContentBlocked},
+		{errors.New("db down"), codes.Internal, apierror.Internal},
+	}
+	for _, tc := range cases {
+		st := status.Convert(toStatus(tc.err))
+		if st.Code() != tc.code {
+			t.Fatalf("%v: code %v, want %v", tc.err, st.Code(), tc.code)
+		}
+		var info *errdetails.ErrorInfo
+		for _, d := range st.Details() {
+			if i, ok := d.(*errdetails.ErrorInfo); ok {
+				info = i
+			}
+		}
+		if info == nil || info.Reason != string(tc.reason) {
+			t.Fatalf("%v: error info %v, want reason %s", tc.err, info, tc.reason)
+		}
+	}
+}
+
+func TestToStatus_RetryInfo(t *testing.T) {
+	st := status.Convert(toStatus(&sms.LimitError{Limit: sms.LimitRecipientsPerSec, RetryAfter: 1500 * time.Millisecond}))
+	for _, d := range st.Details() {
+		if ri, ok := d.(*errdetails.RetryInfo); ok {
+			if got := ri.RetryDelay.AsDuration(); got != 1500*time.Millisecond {
+				t.Fatalf("retry delay %v", got)
+			}
+			return
+		}
+	}
+	t.Fatalf("no RetryInfo in %v", st.Details())
+}
+
+func TestMessageStatusMapping(t *testing.T) {
+	for state := range messageStatuses {
+		got, err := fromMessageStatus(toMessageStatus(state))
+		if err != nil || got != state {
+			t.Fatalf("%s: round trip gave %q %v", state, got, err)
+		}
+	}
+	if got, err := fromMessageStatus(gatewayv1.MessageStatus_MESSAGE_STATUS_UNSPECIFIED); err != nil || got != "" {
+		t.Fatalf("unspecified: %q %v", got, err)
+	}
+	if _, err := fromMessageStatus(gatewayv1.MessageStatus(42)); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("unknown status: %v", err)
+	}
+	if _, err := fromMessageType(gatewayv1.MessageType(42)); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("unknown type: %v", err)
+	}
+}
+
+func TestAuthUnary_MissingToken(t *testing.T) {
+	called := false
+	handler := func(context.Context, any) (any, error) {
+		called = true
+		return nil, nil
+	}
+
+	for _, md := range []metadata.MD{nil, metadata.Pairs("authorization", "Basic dXNlcjpwYXNz")} {
+		ctx := context.Background()
+		if md != nil {
+			ctx = metadata.NewIncomingContext(ctx, md)
+		}
+		_, err := authUnary(ctx, nil, &grpc.UnaryServerInfo{FullMethod: gatewayv1.Gateway_GetBalance_FullMethodName}, handler)
+		if status.Code(err) != codes.Unauthenticated {
+			t.Fatalf("%v: got %v, want Unauthenticated", md, err)
+		}
+	}
+	if called {
+		t.Fatal("handler ran without authentication")
+	}
+}
@@ -0,0 +1,166 @@
+package idempotency
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"sms-gateway/app"
+	"sms-gateway/pkg/metrics"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// MaxKeyLen bounds the Idempotency-Key header.
+const MaxKeyLen = 255
+
+const purgeBatchSize = 1000
+
+var (
+	// ErrInProgress means an earlier request with the key has not finished yet.
+	ErrInProgress = errors.New("a request with this idempotency key is in progress")
+	// ErrKeyReused means the key was first used for a different request.
+	ErrKeyReused = errors.New("idempotency key was used for a different request")
+)
+
+// Response is the stored outcome of the first request with a key.
+type Response struct {
+	Status      int    `db:"status_code"`
+	ContentType string `db:"content_type"`
+	Body        []byte `db:"response"`
+}
+
+type keyRow struct {
+	RequestHash string         `db:"request_hash"`
+	Status      sql.NullInt64  `db:"status_code"`
+	ContentType sql.NullString `db:"content_type"`
+	Body        []byte         `db:"response"`
+	CreatedAt   time.Time      `db:"created_at"`
+	Expired     bool           `db:"expired"`
+}
+
+// Claim reserves key for the customer's request with the given hash. It returns nil, nil when
+// the caller now owns the key and must Complete or Release it, and the stored response when
+// the request already succeeded. Keys older than ttl are treated as unused.
+func Claim(ctx context.Context, customerID int64, key, requestHash string, ttl time.Duration) (*Response, error) {
+	const insertQ = `INSERT INTO idempotency_keys (customer_id, idem_key, request_hash) VALUES (?, ?, ?)`
+	err := metrics.DBExecObserver("insert_idempotency_key", func(c context.Context) error {
+		_, err := app.DB.ExecContext(c, insertQ, customerID, key, requestHash)
+		return err
+	})(ctx)
+	if err == nil {
+		return nil, nil
+	}
+	var me *mysql.MySQLError
+	if !errors.As(err, &me) || me.Number != 1062 {
+		return nil, err
+	}
+
+	var row keyRow
+	const selectQ = `
+		SELECT request_hash, status_code, content_type, response, created_at,
+		       created_at <= CURRENT_TIMESTAMP - INTERVAL ? SECOND AS expired
+		FROM idempotency_keys WHERE customer_id = ? AND idem_key = ?
+	`
+	err = metrics.DBExecObserver("select_idempotency_key", func(c context.Context) error {
+		return app.DB.GetContext(c, &row, selectQ, int64(ttl.Seconds()), customerID, key)
+	})(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		// Released or purged in between; the client may simply retry.
+		return nil, ErrInProgress
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if row.Expired {
+		// Take the expired key over, unless a concurrent request just did.
+		const resetQ = `UPDATE idempotency_keys SET request_hash = ?, status_code = NULL, content_type = NULL, response = NULL, created_at = CURRENT_TIMESTAMP WHERE customer_id = ? AND idem_key = ? AND created_at = ?`
+		var taken int64
+		err = metrics.DBExecObserver("reset_idempotency_key", func(c context.Context) error {
+			res, err := app.DB.ExecContext(c, resetQ, requestHash, customerID, key, row.CreatedAt)
+			if err != nil {
+				return err
+			}
+			taken, err = res.RowsAffected()
+			return err
+		})(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if taken == 0 {
+			return nil, ErrInProgress
+		}
+		return nil, nil
+	}
+
+	if row.RequestHash != requestHash {
+		return nil, ErrKeyReused
+	}
+	if !row.Status.Valid {
+		return nil, ErrInProgress
+	}
+	return &Response{Status: int(row.Status.Int64), ContentType: row.ContentType.String, Body: row.Body}, nil
+}
+
+// Complete stores the response of a claimed key; later requests with the key get it back.
+func Complete(ctx context.Context, customerID int64, key string, r Response) error {
+	const q = `UPDATE idempotency_keys SET status_code = ?, content_type = ?, response = ? WHERE customer_id = ? AND idem_key = ?`
+	execFn := metrics.DBExecObserver("complete_idempotency_key", func(c context.Context) error {
+		_, err := app.DB.ExecContext(c, q, r.Status, r.ContentType, r.Body, customerID, key)
+		return err
+	})
+	return execFn(ctx)
+}
+
+// Release gives up a claimed key after a failed request, so a retry with it runs again.
+func Release(ctx context.Context, customerID int64, key string) error {
+	const q = `DELETE FROM idempotency_keys WHERE customer_id = ? AND idem_key = ? AND status_code IS NULL`
+	execFn := metrics.DBExecObserver("release_idempotency_key", func(c context.Context) error {
+		_, err := app.DB.ExecContext(c, q, customerID, key)
+		return err
+	})
+	return execFn(ctx)
+}
+
+// Purge deletes keys older than ttl, at most limit of them, and returns how many it deleted.
+func Purge(ctx context.Context, ttl time.Duration, limit int) (int64, error) {
+	const q = `DELETE FROM idempotency_keys WHERE created_at <= CURRENT_TIMESTAMP - INTERVAL ? SECOND LIMIT ?`
+	var n int64
+	execFn := metrics.DBExecObserver("purge_idempotency_keys", func(c context.Context) error {
+		res, err := app.DB.ExecContext(c, q, int64(ttl.Seconds()), limit)
+		if err != nil {
+			return err
+		}
+		n, err = res.RowsAffected()
+		return err
+	})
+	if err := execFn(ctx); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// StartPurger deletes expired keys every interval until ctx is done.
+func StartPurger(ctx context.Context, interval, ttl time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+		for {
+			n, err := Purge(ctx, ttl, purgeBatchSize)
+			if err != nil {
+				app.Logger.Error("purge idempotency keys", "err", err)
+				break
+			}
+			if n < purgeBatchSize {
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package idempotency
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"sms-gateway/app"
+	"sms-gateway/config"
+	"sms-gateway/internal/auth"
+	"sms-gateway/pkg/apierror"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// HeaderKey carries the client's key for a POST it may retry.
+	HeaderKey = "Idempotency-Key"
+	// HeaderReplayed is set on responses replayed for a key that was used before.
+	HeaderReplayed = "Idempotent-Replayed"
+)
+
+// Middleware makes customer POSTs that carry an Idempotency-Key safe to retry: the first
+// successful response is stored per customer and key and returned again, unchanged, for
+// repeats of the same request. A failed request frees its key, so a retry runs it again.
+// It goes behind auth.Middleware; requests without a key pass through.
+func Middleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := c.Request()
+		key := req.Header.Get(HeaderKey)
+		if req.Method != http.MethodPost || key == "" {
+			return next(c)
+		}
+		if len(key) > MaxKeyLen {
+			return apierror.New(http.StatusBadRequest, apierror.InvalidInput, "idempotency key too long")
+		}
+		customerID, ok := auth.CustomerFrom(req.Context())
+		if !ok {
+			return next(c)
+		}
+
+		var body []byte
+		if req.Body != nil {
+			var err error
+			if body, err = io.ReadAll(req.Body); err != nil {
+				return echo.NewHTTPError(http.StatusBadRequest, "invalid input")
+			}
+			req.Body = io.NopCloser(bytes.NewReader(body))
+		}
+
+		ttl := time.Duration(config.IdempotencyKeyTTLSec) * time.Second
+		stored, err := Claim(req.Context(), customerID, key, requestHash(req, body), ttl)
+		switch {
+		case errors.Is(err, ErrInProgress):
+			return apierror.New(http.StatusConflict, apierror.IdempotencyKeyInUse, err.Error())
+		case errors.Is(err, ErrKeyReused):
+			return apierror.New(http.StatusUnprocessableEntity, apierror.IdempotencyKeyReused, err.Error())
+		case err != nil:
+			app.Logger.Error("claim idempotency key", "customer_id", customerID, "err", err)
+			return echo.NewHTTPError(http.StatusInternalServerError, "internal error")
+		}
+		if stored != nil {
+			c.Response().Header().Set(HeaderReplayed, "true")
+			return c.Blob(stored.Status, stored.ContentType, stored.Body)
+		}
+
+		res := c.Response()
+		rec := &recorder{ResponseWriter: res.Writer}
+		res.Writer = rec
+		err = next(c)
+		res.Writer = rec.ResponseWriter
+
+		// The outcome must be kept even when the client went away; it is the one retrying.
+		ctx := context.WithoutCancel(req.Context())
+		if err == nil && res.Status < http.StatusInternalServerError {
+			r := Response{Status: res.Status, ContentType: res.Header().Get(echo.HeaderContentType), Body: rec.body.Bytes()}
+			if cErr := Complete(ctx, customerID, key, r); cErr != nil {
+				app.Logger.Error("store idempotent response", "customer_id", customerID, "err", cErr)
+			}
+			return nil
+		}
+		if rErr := Release(ctx, customerID, key); rErr != nil {
+			app.Logger.Error("release idempotency key", "customer_id", customerID, "err", rErr)
+		}
+		return err
+	}
+}
+
+// requestHash identifies a request independently of the /v1 prefix, so a retry is recognised
+// on either route.
+func requestHash(req *http.Request, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(req.Method + " " + strings.TrimPrefix(req.URL.Path, app.APIVersionPrefix) + "?" + req.URL.RawQuery + "\n"))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// recorder keeps a copy of the response body.
+type recorder struct {
+	http.ResponseWriter
+	body bytes.Buffer
+}
+
+func (r *recorder) Write(b []byte) (int, error) {
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
@@ -0,0 +1,70 @@
+package idempotency
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"sms-gateway/internal/auth"
+	"sms-gateway/testutil"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestMiddlewareReplaysSuccessfulRequests(t *testing.T) {
+	ctx := testutil.EnsureSetup(t)
+	testutil.ResetTables(ctx, t)
+
+	calls := 0
+	e := echo.New()
+	e.POST("/sms/send", func(c echo.Context) error {
+		calls++
+		if strings.Contains(c.Request().URL.RawQuery, "fail") {
+			return echo.NewHTTPError(http.StatusInternalServerError, "internal error")
+		}
+		return c.JSON(http.StatusOK, map[string]int{"call": calls})
+	}, func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			c.SetRequest(c.Request().WithContext(auth.WithCustomer(c.Request().Context(), 42)))
+			return next(c)
+		}
+	}, Middleware)
+
+	do := func(path, key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		if key != "" {
+			req.Header.Set(HeaderKey, key)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	first := do("/sms/send", "k1", `{"text":"hi"}`)
+	again := do("/sms/send", "k1", `{"text":"hi"}`)
+	if first.Code != http.StatusOK || again.Code != http.StatusOK || calls != 1 {
+		t.Fatalf("expected one call and two 200s, got %d %d calls=%d", first.Code, again.Code, calls)
+	}
+	if again.Body.String() != first.Body.String() || again.Header().Get(HeaderReplayed) != "true" {
+		t.Fatalf("expected replay of %q, got %q (replayed=%q)", first.Body.String(), again.Body.String(), again.Header().Get(HeaderReplayed))
+	}
+
+	if rec := do("/sms/send", "k1", `{"text":"other"}`); rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected 422 for a reused key, got %d", rec.Code)
+	}
+
+	if rec := do("/sms/send?fail", "k2", `{}`); rec.Code != http.StatusInternalServerError {
+		t.Fatalf("expected 500, got %d", rec.Code)
+	}
+	if rec := do("/sms/send?fail", "k2", `{}`); rec.Code != http.StatusInternalServerError || calls != 3 {
+		t.Fatalf("expected a failed request to run again, got %d calls=%d", rec.Code, calls)
+	}
+
+	do("/sms/send", "", `{"text":"hi"}`)
+	do("/sms/send", "", `{"text":"hi"}`)
+	if calls != 5 {
+		t.Fatalf("expected requests without a key to always run, calls=%d", calls)
+	}
+}
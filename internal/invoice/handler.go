@@ -0,0 +1,167 @@
+package invoice
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"sms-gateway/app"
+	"sms-gateway/internal/auth"
+
+	"github.com/labstack/echo/v4"
+)
+
+// GeneratePayload represents the request body for generating invoices.
+type GeneratePayload struct {
+	Period string `json:"period"`
+	// UserID limits generation to one customer; otherwise every postpaid customer is invoiced.
+	UserID int64 `json:"user_id"`
+}
+
+// GenerateHandler godoc
+// @Summary      Generate invoices
+// @Description  Invoices a closed month (YYYY-MM) for one customer or every postpaid customer. Existing invoices are left as they are
+// @Tags         admin
+// @Accept       json
+// @Produce      json
+// @Security     AdminAuth
+// @Param        request body GeneratePayload true "Period and optional customer"
+// @Success      200 {object} map[string]any
+// @Failure      400 {object} apierror.Error "invalid input"
+// @Failure      401 {object} apierror.Error "unauthenticated"
+// @Failure      409 {object} apierror.Error "period has not ended yet"
+// @Failure      500 {object} apierror.Error "internal error"
+// @Router       /admin/invoices/generate [post]
+func GenerateHandler(c echo.Context) error {
+	var req GeneratePayload
+	if err := json.NewDecoder(c.Request().Body).Decode(&req); err != nil {
+		app.Logger.Error("invalid input ", "err", err)
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid input")
+	}
+	p, err := ParsePeriod(req.Period)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	out := map[string]any{}
+	out["period"] = p.String()
+	if req.UserID != 0 {
+		inv, created, err := Generate(c.Request().Context(), req.UserID, p, time.Now())
+		if err != nil {
+			return generateError(err)
+		}
+		out["created"] = created
+		if inv.ID != 0 {
+			out["invoice"] = inv
+		}
+		return c.JSON(http.StatusOK, out)
+	}
+
+	n, err := GenerateAll(c.Request().Context(), p, time.Now())
+	if err != nil {
+		return generateError(err)
+	}
+	out["created"] = n
+	return c.JSON(http.StatusOK, out)
+}
+
+func generateError(err error) error {
+	if errors.Is(err, ErrPeriodOpen) {
+		return echo.NewHTTPError(http.StatusConflict, err.Error())
+	}
+	app.Logger.Error("generate invoices", "err", err)
+	return err
+}
+
+// ListHandler godoc
+// @Summary      List invoices
+// @Tags         invoices
+// @Produce      json
+// @Security     BearerAuth
+// @Success      200 {object} map[string]any
+// @Failure      401 {object} apierror.Error "unauthenticated"
+// @Failure      500 {object} apierror.Error "internal error"
+// @Router       /invoices [get]
+func ListHandler(c echo.Context) error {
+	userID, err := auth.CustomerID(c)
+	if err != nil {
+		return err
+	}
+
+	invoices, err := List(c.Request().Context(), userID)
+	if err != nil {
+		app.Logger.Error("list invoices", "user_id", userID, "err", err)
+		return err
+	}
+
+	out := map[string]any{}
+	out["invoices"] = invoices
+
+	return c.JSON(http.StatusOK, out)
+}
+
+// GetHandler godoc
+// @Summary      Download an invoice
+// @Tags         invoices
+// @Produce      json
+// @Produce      text/csv
+// @Security     BearerAuth
+// @Param        number path string true "Invoice number"
+// @Param        format query string false "json (default) or csv"
+// @Success      200 {object} Invoice
+// @Failure      401 {object} apierror.Error "unauthenticated"
+// @Failure      404 {object} apierror.Error "invoice not found"
+// @Failure      500 {object} apierror.Error "internal error"
+// @Router       /invoices/{number} [get]
+func GetHandler(c echo.Context) error {
+	userID, err := auth.CustomerID(c)
+	if err != nil {
+		return err
+	}
+
+	inv, err := GetByNumber(c.Request().Context(), c.Param("number"))
+	if err != nil {
+		if errors.Is(err, ErrInvoiceNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, err.Error())
+		}
+		app.Logger.Error("get invoice", "number", c.Param("number"), "err", err)
+		return err
+	}
+	// Other customers' invoices look the same as missing ones.
+	if inv.UserID != userID {
+		return echo.NewHTTPError(http.StatusNotFound, ErrInvoiceNotFound.Error())
+	}
+
+	if c.QueryParam("format") != "csv" {
+		return c.JSON(http.StatusOK, inv)
+	}
+
+	res := c.Response()
+	res.Header().Set(echo.HeaderContentType, "text/csv")
+	res.Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%s.csv", inv.Number))
+	res.WriteHeader(http.StatusOK)
+
+	w := csv.NewWriter(res)
+	_ = w.Write([]string{"invoice_number", inv.Number, "user_id", strconv.FormatInt(inv.UserID, 10), "period", inv.Period})
+	_ = w.Write([]string{"line_no", "kind", "type", "destination_prefix", "unit_price", "quantity", "amount"})
+	for _, l := range inv.Lines {
+		_ = w.Write([]string{
+			strconv.Itoa(l.LineNo),
+			string(l.Kind),
+			l.Type,
+			l.DestinationPrefix,
+			strconv.FormatInt(l.UnitPrice, 10),
+			strconv.FormatInt(l.Quantity, 10),
+			strconv.FormatInt(l.Amount, 10),
+		})
+	}
+	_ = w.Write([]string{"", "charges", "", "", "", "", strconv.FormatInt(inv.Charges, 10)})
+	_ = w.Write([]string{"", "refunds", "", "", "", "", strconv.FormatInt(-inv.Refunds, 10)})
+	_ = w.Write([]string{"", "total", "", "", "", "", strconv.FormatInt(inv.Total, 10)})
+	w.Flush()
+	return w.Error()
+}
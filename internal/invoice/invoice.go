@@ -0,0 +1,371 @@
+package invoice
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"sms-gateway/app"
+	"sms-gateway/pkg/metrics"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jmoiron/sqlx"
+)
+
+type lineKind string
+
+const (
+	LineCharge lineKind = "charge"
+	LineRefund lineKind = "refund"
+)
+
+const periodLayout = "2006-01"
+
+var (
+	ErrInvalidPeriod   = errors.New("invalid period, want YYYY-MM")
+	ErrPeriodOpen      = errors.New("period has not ended yet")
+	ErrInvoiceNotFound = errors.New("invoice not found")
+)
+
+// Period is a calendar month in server local time.
+type Period struct {
+	Start time.Time
+	End   time.Time
+}
+
+func (p Period) String() string {
+	return p.Start.Format(periodLayout)
+}
+
+func ParsePeriod(v string) (Period, error) {
+	start, err := time.ParseInLocation(periodLayout, v, time.Local)
+	if err != nil {
+		return Period{}, ErrInvalidPeriod
+	}
+	return Period{Start: start, End: start.AddDate(0, 1, 0)}, nil
+}
+
+// PreviousPeriod is the last month that has fully ended at now.
+func PreviousPeriod(now time.Time) Period {
+	start := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location()).AddDate(0, -1, 0)
+	return Period{Start: start, End: start.AddDate(0, 1, 0)}
+}
+
+// Invoice is stored once per (customer, period) and never changed afterwards.
+type Invoice struct {
+	ID          int64     `db:"id" json:"id"`
+	Number      string    `db:"invoice_number" json:"invoice_number"`
+	UserID      int64     `db:"user_id" json:"user_id"`
+	Period      string    `db:"period" json:"period"`
+	PeriodStart time.Time `db:"period_start" json:"period_start"`
+	PeriodEnd   time.Time `db:"period_end" json:"period_end"`
+	Charges     int64     `db:"charges" json:"charges"`
+	Refunds     int64     `db:"refunds" json:"refunds"`
+	Total       int64     `db:"total" json:"total"`
+	CreatedAt   time.Time `db:"created_at" json:"created_at"`
+	Lines       []Line    `json:"lines,omitempty"`
+}
+
+type Line struct {
+	LineNo            int      `db:"line_no" json:"line_no"`
+	Kind              lineKind `db:"kind" json:"kind"`
+	Type              string   `db:"type" json:"type,omitempty"`
+	DestinationPrefix string   `db:"destination_prefix" json:"destination_prefix,omitempty"`
+	UnitPrice         int64    `db:"unit_price" json:"unit_price"`
+	Quantity          int64    `db:"quantity" json:"quantity"`
+	Amount            int64    `db:"amount" json:"amount"`
+}
+
+// invoiceNumber formats the n-th invoice of a year, e.g. INV-2026-000042.
+func invoiceNumber(year int, n int64) string {
+	return fmt.Sprintf("INV-%d-%06d", year, n)
+}
+
+// Generate produces the customer's invoice for a period that has ended. It is idempotent: when
+// the invoice already exists it is returned unchanged (created is false). Charges are the
+// holds captured in the period, by type, destination prefix and unit price; refunds are the
+// refunds recorded in the period. Periods without charges or refunds get no invoice.
+func Generate(ctx context.Context, userID int64, p Period, now time.Time) (inv Invoice, created bool, err error) {
+	if now.Before(p.End) {
+		return Invoice{}, false, ErrPeriodOpen
+	}
+	if inv, err := Get(ctx, userID, p.String()); err == nil {
+		return inv, false, nil
+	} else if !errors.Is(err, ErrInvoiceNotFound) {
+		return Invoice{}, false, err
+	}
+
+	tx, err := app.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return Invoice{}, false, err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	lines, err := collectLinesTx(ctx, tx, userID, p)
+	if err != nil {
+		return Invoice{}, false, err
+	}
+	if len(lines) == 0 {
+		_ = tx.Rollback()
+		return Invoice{}, false, nil
+	}
+
+	inv = Invoice{UserID: userID, Period: p.String(), PeriodStart: p.Start, PeriodEnd: p.End, Lines: lines}
+	for _, l := range lines {
+		if l.Kind == LineRefund {
+			inv.Refunds += -l.Amount
+		} else {
+			inv.Charges += l.Amount
+		}
+	}
+	inv.Total = inv.Charges - inv.Refunds
+
+	n, err := nextNumberTx(ctx, tx, p.Start.Year())
+	if err != nil {
+		return Invoice{}, false, err
+	}
+	inv.Number = invoiceNumber(p.Start.Year(), n)
+
+	if err = insertInvoiceTx(ctx, tx, &inv); err != nil {
+		var myErr *mysql.MySQLError
+		if errors.As(err, &myErr) && myErr.Number == 1062 {
+			// A concurrent run stored it first; its number is used and ours is rolled back.
+			_ = tx.Rollback()
+			existing, getErr := Get(ctx, userID, p.String())
+			return existing, false, getErr
+		}
+		return Invoice{}, false, err
+	}
+	if err = tx.Commit(); err != nil {
+		return Invoice{}, false, err
+	}
+	return inv, true, nil
+}
+
+func collectLinesTx(ctx context.Context, tx *sqlx.Tx, userID int64, p Period) ([]Line, error) {
+	var charges []Line
+	const chargesQ = `
+		SELECT type, destination_prefix, amount AS unit_price, COUNT(*) AS quantity, SUM(amount) AS amount
+		FROM balance_holds
+		WHERE user_id = ? AND status = 'captured' AND updated_at >= ? AND updated_at < ?
+		GROUP BY type, destination_prefix, amount
+		ORDER BY type, destination_prefix, amount
+	`
+	if err := metrics.DBExecObserver("select_invoice_charges", func(c context.Context) error {
+		return tx.SelectContext(c, &charges, chargesQ, userID, p.Start, p.End)
+	})(ctx); err != nil {
+		return nil, err
+	}
+
+	var refund struct {
+		Quantity int64 `db:"quantity"`
+		Amount   int64 `db:"amount"`
+	}
+	const refundsQ = `SELECT COUNT(*) AS quantity, COALESCE(SUM(amount), 0) AS amount FROM refunds WHERE user_id = ? AND created_at >= ? AND created_at < ?`
+	if err := metrics.DBExecObserver("select_invoice_refunds", func(c context.Context) error {
+		return tx.GetContext(c, &refund, refundsQ, userID, p.Start, p.End)
+	})(ctx); err != nil {
+		return nil, err
+	}
+
+	lines := make([]Line, 0, len(charges)+1)
+	for _, l := range charges {
+		l.Kind = LineCharge
+		lines = append(lines, l)
+	}
+	if refund.Quantity > 0 {
+		lines = append(lines, Line{Kind: LineRefund, Quantity: refund.Quantity, Amount: -refund.Amount})
+	}
+	for i := range lines {
+		lines[i].LineNo = i + 1
+	}
+	return lines, nil
+}
+
+// nextNumberTx takes the next number of the year's sequence. The sequence row stays locked
+// until the invoice commits, so numbers are gapless and in creation order.
+func nextNumberTx(ctx context.Context, tx *sqlx.Tx, year int) (int64, error) {
+	const upsertQ = `INSERT INTO invoice_sequences (year, last_value) VALUES (?, 1) ON DUPLICATE KEY UPDATE last_value = last_value + 1`
+	if err := metrics.DBExecObserver("upsert_invoice_sequence", func(c context.Context) error {
+		_, err := tx.ExecContext(c, upsertQ, year)
+		return err
+	})(ctx); err != nil {
+		return 0, err
+	}
+	var n int64
+	const selectQ = `SELECT last_value FROM invoice_sequences WHERE year = ?`
+	if err := metrics.DBExecObserver("select_invoice_sequence", func(c context.Context) error {
+		return tx.GetContext(c, &n, selectQ, year)
+	})(ctx); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+func insertInvoiceTx(ctx context.Context, tx *sqlx.Tx, inv *Invoice) error {
+	const q = `
+		INSERT INTO invoices (invoice_number, user_id, period, period_start, period_end, charges, refunds, total)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`
+	if err := metrics.DBExecObserver("insert_invoice", func(c context.Context) error {
+		res, err := tx.ExecContext(c, q, inv.Number, inv.UserID, inv.Period, inv.PeriodStart, inv.PeriodEnd, inv.Charges, inv.Refunds, inv.Total)
+		if err != nil {
+			return err
+		}
+		inv.ID, err = res.LastInsertId()
+		return err
+	})(ctx); err != nil {
+		return err
+	}
+	inv.CreatedAt = time.Now()
+
+	const lineQ = `
+		INSERT INTO invoice_lines (invoice_id, line_no, kind, type, destination_prefix, unit_price, quantity, amount)
+		VALUES (:invoice_id, :line_no, :kind, :type, :destination_prefix, :unit_price, :quantity, :amount)
+	`
+	rows := make([]map[string]any, 0, len(inv.Lines))
+	for _, l := range inv.Lines {
+		rows = append(rows, map[string]any{
+			"invoice_id":         inv.ID,
+			"line_no":            l.LineNo,
+			"kind":               l.Kind,
+			"type":               l.Type,
+			"destination_prefix": l.DestinationPrefix,
+			"unit_price":         l.UnitPrice,
+			"quantity":           l.Quantity,
+			"amount":             l.Amount,
+		})
+	}
+	return metrics.DBExecObserver("insert_invoice_lines", func(c context.Context) error {
+		_, err := tx.NamedExecContext(c, lineQ, rows)
+		return err
+	})(ctx)
+}
+
+const invoiceColumns = `id, invoice_number, user_id, period, period_start, period_end, charges, refunds, total, created_at`
+
+// Get returns the customer's invoice for a period (YYYY-MM) with its lines.
+func Get(ctx context.Context, userID int64, period string) (Invoice, error) {
+	return getWhere(ctx, `user_id = ? AND period = ?`, userID, period)
+}
+
+// GetByNumber returns an invoice with its lines.
+func GetByNumber(ctx context.Context, number string) (Invoice, error) {
+	return getWhere(ctx, `invoice_number = ?`, number)
+}
+
+func getWhere(ctx context.Context, where string, args ...any) (Invoice, error) {
+	var inv Invoice
+	q := `SELECT ` + invoiceColumns + ` FROM invoices WHERE ` + where
+	if err := metrics.DBExecObserver("select_invoice", func(c context.Context) error {
+		return app.DB.GetContext(c, &inv, q, args...)
+	})(ctx); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Invoice{}, ErrInvoiceNotFound
+		}
+		return Invoice{}, err
+	}
+
+	const linesQ = `
+		SELECT line_no, kind, type, destination_prefix, unit_price, quantity, amount
+		FROM invoice_lines
+		WHERE invoice_id = ?
+		ORDER BY line_no
+	`
+	if err := metrics.DBExecObserver("select_invoice_lines", func(c context.Context) error {
+		return app.DB.SelectContext(c, &inv.Lines, linesQ, inv.ID)
+	})(ctx); err != nil {
+		return Invoice{}, err
+	}
+	return inv, nil
+}
+
+// List returns the customer's invoices, newest period first, without lines.
+func List(ctx context.Context, userID int64) ([]Invoice, error) {
+	q := `SELECT ` + invoiceColumns + ` FROM invoices WHERE user_id = ? ORDER BY period DESC`
+	out := []Invoice{}
+	queryFn := metrics.DBExecObserver("select_invoices", func(c context.Context) error {
+		return app.DB.SelectContext(c, &out, q, userID)
+	})
+	if err := queryFn(ctx); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// GenerateAll invoices every customer that was postpaid during the period and has charges or
+// refunds in it, and returns how many invoices were created; existing ones are skipped. A
+// customer switched to or from postpaid since the period started is found through
+// account_limit_audit, so a switch back to prepaid before the job runs does not skip the month.
+// A customer that fails is logged and does not stop the others; the failures are returned
+// together.
+func GenerateAll(ctx context.Context, p Period, now time.Time) (int, error) {
+	if now.Before(p.End) {
+		return 0, ErrPeriodOpen
+	}
+
+	var users []int64
+	const q = `
+		SELECT u.user_id FROM (
+			SELECT user_id FROM balance_holds WHERE status = 'captured' AND updated_at >= ? AND updated_at < ?
+			UNION
+			SELECT user_id FROM refunds WHERE created_at >= ? AND created_at < ?
+		) u
+		WHERE EXISTS (SELECT 1 FROM user_balances b WHERE b.user_id = u.user_id AND b.account_mode = 'postpaid')
+		   OR EXISTS (SELECT 1 FROM account_limit_audit a WHERE a.user_id = u.user_id AND a.created_at >= ?
+		              AND 'postpaid' IN (a.old_account_mode, a.new_account_mode))
+		ORDER BY u.user_id
+	`
+	if err := metrics.DBExecObserver("select_postpaid_users", func(c context.Context) error {
+		return app.DB.SelectContext(c, &users, q, p.Start, p.End, p.Start, p.End, p.Start)
+	})(ctx); err != nil {
+		return 0, err
+	}
+
+	n := 0
+	var errs []error
+	for _, userID := range users {
+		_, created, err := Generate(ctx, userID, p, now)
+		if err != nil {
+			app.Logger.Error("generate invoice", "user_id", userID, "period", p.String(), "err", err)
+			errs = append(errs, fmt.Errorf("invoice user %d: %w", userID, err))
+			continue
+		}
+		if created {
+			n++
+		}
+	}
+	return n, errors.Join(errs...)
+}
+
+// StartWorker invoices postpaid customers for the previous month every interval. Generation
+// is idempotent, so the job simply re-runs until the month is fully invoiced.
+func StartWorker(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		now := time.Now()
+		p := PreviousPeriod(now)
+		// Failed customers are logged by GenerateAll and retried on the next run.
+		n, err := GenerateAll(ctx, p, now)
+		if err != nil {
+			app.Logger.Error("generate invoices", "period", p.String(), "err", err)
+		}
+		if n > 0 {
+			app.Logger.Info("generated invoices", "period", p.String(), "count", n)
+		}
+	}
+}
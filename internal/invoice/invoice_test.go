@@ -0,0 +1,122 @@
+package invoice
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"sms-gateway/app"
+	"sms-gateway/testutil"
+)
+
+func TestPeriods(t *testing.T) {
+	p, err := ParsePeriod("2026-12")
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if p.String() != "2026-12" || p.End.Year() != 2027 || p.End.Month() != time.January {
+		t.Fatalf("unexpected period %+v", p)
+	}
+	if _, err := ParsePeriod("2026-13"); !errors.Is(err, ErrInvalidPeriod) {
+		t.Fatalf("expected ErrInvalidPeriod, got %v", err)
+	}
+
+	prev := PreviousPeriod(time.Date(2026, 1, 15, 10, 0, 0, 0, time.Local))
+	if prev.String() != "2025-12" {
+		t.Fatalf("expected 2025-12, got %s", prev)
+	}
+	if got := invoiceNumber(2026, 42); got != "INV-2026-000042" {
+		t.Fatalf("unexpected invoice number %s", got)
+	}
+}
+
+func TestGenerateIsIdempotentPerPeriod(t *testing.T) {
+	ctx := testutil.EnsureSetup(t)
+	testutil.ResetTables(ctx, t)
+
+	seed := []struct {
+		prefix string
+		amount int64
+		at     string
+	}{
+		{"98912", 4, "2026-01-03 10:00:00"},
+		{"98912", 4, "2026-01-20 10:00:00"},
+		{"", 2, "2026-01-31 23:59:59"},
+		{"", 2, "2026-02-01 00:00:00"}, // next period
+	}
+	for i, s := range seed {
+		if _, err := app.DB.ExecContext(ctx,
+			`INSERT INTO balance_holds (transaction_id, user_id, customer_id, recipient, type, destination_prefix, amount, status, expires_at, updated_at)
+			 VALUES (?, 900, 900, ?, 'normal', ?, ?, 'captured', ?, ?)`,
+			"inv-tx", i, s.prefix, s.amount, s.at, s.at); err != nil {
+			t.Fatalf("seed hold: %v", err)
+		}
+	}
+	if _, err := app.DB.ExecContext(ctx,
+		`INSERT INTO refunds (user_id, original_transaction_id, refund_transaction_id, amount, refund_key, created_at) VALUES (900, 'inv-tx', 'inv-rf', 3, 'full', '2026-01-25 00:00:00')`); err != nil {
+		t.Fatalf("seed refund: %v", err)
+	}
+
+	p, _ := ParsePeriod("2026-01")
+	if _, _, err := Generate(ctx, 900, p, p.End.Add(-time.Second)); !errors.Is(err, ErrPeriodOpen) {
+		t.Fatalf("expected ErrPeriodOpen, got %v", err)
+	}
+
+	inv, created, err := Generate(ctx, 900, p, p.End)
+	if err != nil || !created {
+		t.Fatalf("generate: created=%v err=%v", created, err)
+	}
+	if inv.Number != "INV-2026-000001" || inv.Charges != 10 || inv.Refunds != 3 || inv.Total != 7 || len(inv.Lines) != 3 {
+		t.Fatalf("unexpected invoice %+v", inv)
+	}
+
+	again, created, err := Generate(ctx, 900, p, p.End)
+	if err != nil || created {
+		t.Fatalf("second generate: created=%v err=%v", created, err)
+	}
+	if again.Number != inv.Number || again.Total != inv.Total || len(again.Lines) != 3 {
+		t.Fatalf("replay returned a different invoice %+v", again)
+	}
+	if again.Lines[0].DestinationPrefix != "" || again.Lines[1].DestinationPrefix != "98912" || again.Lines[1].Quantity != 2 {
+		t.Fatalf("unexpected lines %+v", again.Lines)
+	}
+}
+
+func TestGenerateAllInvoicesCustomersPostpaidDuringThePeriod(t *testing.T) {
+	ctx := testutil.EnsureSetup(t)
+	testutil.ResetTables(ctx, t)
+
+	// 910 was postpaid in January and switched back to prepaid before the run; 911 was prepaid
+	// all along; 912 is postpaid but did not send anything.
+	for _, u := range []struct {
+		id   int64
+		mode string
+	}{{910, "prepaid"}, {911, "prepaid"}, {912, "postpaid"}} {
+		if _, err := app.DB.ExecContext(ctx, "INSERT INTO user_balances (user_id, balance, account_mode) VALUES (?, 0, ?)", u.id, u.mode); err != nil {
+			t.Fatalf("seed balance: %v", err)
+		}
+	}
+	if _, err := app.DB.ExecContext(ctx,
+		`INSERT INTO account_limit_audit (user_id, old_account_mode, new_account_mode, old_credit_limit, new_credit_limit, created_at)
+		 VALUES (910, 'postpaid', 'prepaid', 100, 0, '2026-02-02 09:00:00')`); err != nil {
+		t.Fatalf("seed audit: %v", err)
+	}
+	for _, userID := range []int64{910, 911} {
+		if _, err := app.DB.ExecContext(ctx,
+			`INSERT INTO balance_holds (transaction_id, user_id, customer_id, recipient, type, destination_prefix, amount, status, expires_at, updated_at)
+			 VALUES (?, ?, ?, '+1', 'normal', '', 2, 'captured', '2026-01-10 10:00:00', '2026-01-10 10:00:00')`,
+			fmt.Sprint("all-tx-", userID), userID, userID); err != nil {
+			t.Fatalf("seed hold: %v", err)
+		}
+	}
+
+	p, _ := ParsePeriod("2026-01")
+	n, err := GenerateAll(ctx, p, time.Date(2026, 2, 3, 0, 0, 0, 0, time.Local))
+	if err != nil || n != 1 {
+		t.Fatalf("expected one invoice, got %d err=%v", n, err)
+	}
+	if _, err := Get(ctx, 910, p.String()); err != nil {
+		t.Fatalf("expected the customer switched back to prepaid to be invoiced: %v", err)
+	}
+}
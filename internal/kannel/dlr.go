@@ -0,0 +1,332 @@
+package kannel
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"sms-gateway/app"
+	"sms-gateway/config"
+	"sms-gateway/internal/outbox"
+	"sms-gateway/internal/sms"
+	"sms-gateway/pkg/metrics"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	scanBatchSize     = 500
+	deliveryBatchSize = 50
+	idleSleep         = 500 * time.Millisecond
+	maxAttempts       = 10
+	purgeBatchSize    = 1000
+
+	// settleDelay is how old a status event must be before it is scanned. Events are written
+	// in the transaction of their status change, which takes the id at insert but may commit
+	// after one with a higher id; waiting lets the lower ids commit first, so the cursor does
+	// not pass them.
+	settleDelay = 2 * time.Second
+
+	aggregateType = "kannel_dlr"
+	eventType     = "kannel.dlr"
+)
+
+type scannedEvent struct {
+	ID            int64          `db:"id"`
+	SmsIdentifier string         `db:"sms_identifier"`
+	Recipients    []byte         `db:"recipients"`
+	Status        sms.State      `db:"status"`
+	Provider      string         `db:"provider"`
+	CreatedAt     time.Time      `db:"created_at"`
+	Settled       bool           `db:"settled"`
+	Sender        sql.NullString `db:"sender"`
+	DLRURL        sql.NullString `db:"dlr_url"`
+	DLRMask       sql.NullInt64  `db:"dlr_mask"`
+}
+
+type callbackRow struct {
+	ID       int64           `db:"id"`
+	Payload  json.RawMessage `db:"payload"`
+	Attempts int             `db:"attempts"`
+}
+
+type callback struct {
+	URL string `json:"url"`
+}
+
+var httpClient = &http.Client{}
+
+// StartDLRDispatcher turns status changes of messages sent with a dlr-url into callbacks and
+// calls them until ctx is done. Status changes are read from sms_status_events behind a
+// cursor in kannel_dlr_cursor, so every instance may run it; callbacks are queued in
+// outbox_events and retried with backoff.
+func StartDLRDispatcher(ctx context.Context) error {
+	httpClient.Timeout = time.Duration(config.KannelDLRTimeoutSec) * time.Second
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		default:
+		}
+
+		scanned, err := ScanStatusEvents(ctx, scanBatchSize)
+		if err != nil {
+			app.Logger.Error("kannel scan status events", "err", err)
+		}
+
+		rows, err := claimCallbacks(ctx, deliveryBatchSize)
+		if err != nil {
+			app.Logger.Error("kannel claim callbacks", "err", err)
+		}
+		for _, r := range rows {
+			if err := dispatchOne(ctx, r); err != nil {
+				app.Logger.Error("kannel dispatch callback", "id", r.ID, "err", err)
+			}
+		}
+
+		if scanned < scanBatchSize && len(rows) == 0 {
+			time.Sleep(idleSleep)
+		}
+	}
+}
+
+// ScanStatusEvents moves the cursor over up to limit settled status events, queues a callback
+// per recipient for those of Kannel messages whose dlr-mask asks for the event's type, and
+// returns how many events it passed.
+func ScanStatusEvents(ctx context.Context, limit int) (_ int, err error) {
+	tx, err := app.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	var cursor int64
+	if err = metrics.DBExecObserver("select_kannel_dlr_cursor", func(c context.Context) error {
+		if _, err := tx.ExecContext(c, `INSERT IGNORE INTO kannel_dlr_cursor (id, last_event_id) VALUES (1, 0)`); err != nil {
+			return err
+		}
+		return tx.GetContext(c, &cursor, `SELECT last_event_id FROM kannel_dlr_cursor WHERE id = 1 FOR UPDATE`)
+	})(ctx); err != nil {
+		return 0, err
+	}
+
+	const selectQ = `
+		SELECT e.id, e.sms_identifier, e.recipients, e.status, e.provider, e.created_at,
+			e.created_at <= CURRENT_TIMESTAMP - INTERVAL ? SECOND AS settled,
+			k.sender, k.dlr_url, k.dlr_mask
+		FROM (
+			SELECT id, sms_identifier, recipients, status, provider, created_at
+			FROM sms_status_events
+			WHERE id > ?
+			ORDER BY id
+			LIMIT ?
+		) e
+		LEFT JOIN kannel_messages k ON k.sms_identifier = e.sms_identifier
+		ORDER BY e.id
+	`
+	var events []scannedEvent
+	if err = metrics.DBExecObserver("select_kannel_status_events", func(c context.Context) error {
+		return tx.SelectContext(c, &events, selectQ, int64(settleDelay.Seconds()), cursor, limit)
+	})(ctx); err != nil {
+		return 0, err
+	}
+
+	passed := 0
+	for _, e := range events {
+		if !e.Settled {
+			break
+		}
+		if e.DLRURL.Valid {
+			if err = queueCallbacksTx(ctx, tx, e); err != nil {
+				return 0, err
+			}
+		}
+		cursor = e.ID
+		passed++
+	}
+	if passed == 0 {
+		return 0, tx.Commit()
+	}
+
+	if err = metrics.DBExecObserver("update_kannel_dlr_cursor", func(c context.Context) error {
+		_, err := tx.ExecContext(c, `UPDATE kannel_dlr_cursor SET last_event_id = ? WHERE id = 1`, cursor)
+		return err
+	})(ctx); err != nil {
+		return 0, err
+	}
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+	return passed, nil
+}
+
+func queueCallbacksTx(ctx context.Context, tx *sqlx.Tx, e scannedEvent) error {
+	typ := dlrType(e.Status)
+	if typ == 0 || int(e.DLRMask.Int64)&typ == 0 {
+		return nil
+	}
+
+	var recipients []string
+	if err := json.Unmarshal(e.Recipients, &recipients); err != nil {
+		return err
+	}
+	for _, r := range recipients {
+		err := outbox.InsertTx(ctx, tx, outbox.Event{
+			AggregateType: aggregateType,
+			AggregateID:   fmt.Sprintf("%d:%s", e.ID, r),
+			EventType:     eventType,
+			Payload: callback{URL: expandDLRURL(e.DLRURL.String, dlrValues{
+				Type:          typ,
+				Recipient:     r,
+				Sender:        e.Sender.String,
+				Time:          e.CreatedAt,
+				Status:        e.Status,
+				Provider:      e.Provider,
+				SmsIdentifier: e.SmsIdentifier,
+			})},
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func claimCallbacks(ctx context.Context, limit int) ([]callbackRow, error) {
+	tx, err := app.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var rows []callbackRow
+	const selectQ = `
+		SELECT id, payload, attempts
+		FROM outbox_events
+		WHERE status = 'pending'
+		  AND aggregate_type = 'kannel_dlr'
+		  AND (next_run_at IS NULL OR next_run_at <= CURRENT_TIMESTAMP)
+		ORDER BY created_at ASC
+		LIMIT ?
+		FOR UPDATE SKIP LOCKED
+	`
+	if err := tx.SelectContext(ctx, &rows, selectQ, limit); err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		_ = tx.Commit()
+		return nil, nil
+	}
+
+	in := "?"
+	ids := []any{rows[0].ID}
+	for _, r := range rows[1:] {
+		in += ",?"
+		ids = append(ids, r.ID)
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE outbox_events SET status = 'processing' WHERE id IN (`+in+`)`, ids...); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+func dispatchOne(ctx context.Context, r callbackRow) error {
+	if err := deliver(ctx, r); err != nil {
+		return failOrRetry(ctx, r, err)
+	}
+	_, err := app.DB.ExecContext(ctx, `UPDATE outbox_events SET status='processed', last_error=NULL WHERE id=?`, r.ID)
+	return err
+}
+
+// deliver calls a dlr-url with GET, as Kannel does; any 2xx is a success.
+func deliver(ctx context.Context, r callbackRow) error {
+	var cb callback
+	if err := json.Unmarshal(r.Payload, &cb); err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, cb.URL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("dlr-url returned %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func failOrRetry(ctx context.Context, r callbackRow, cause error) error {
+	nextAttempts := r.Attempts + 1
+	if nextAttempts >= maxAttempts {
+		_, err := app.DB.ExecContext(ctx,
+			`UPDATE outbox_events SET status='failed', attempts=?, last_error=? WHERE id=?`,
+			nextAttempts, cause.Error(), r.ID,
+		)
+		return err
+	}
+
+	backoff := time.Second * time.Duration(1<<min(nextAttempts, 6))
+	_, err := app.DB.ExecContext(ctx,
+		`UPDATE outbox_events SET status='pending', attempts=?, next_run_at=?, last_error=? WHERE id=?`,
+		nextAttempts, time.Now().Add(backoff), cause.Error(), r.ID,
+	)
+	return err
+}
+
+// PurgeMessages deletes dlr-urls of messages older than retention, at most limit of them, and
+// returns how many it deleted.
+func PurgeMessages(ctx context.Context, retention time.Duration, limit int) (int64, error) {
+	const q = `DELETE FROM kannel_messages WHERE created_at <= CURRENT_TIMESTAMP - INTERVAL ? SECOND LIMIT ?`
+	var n int64
+	execFn := metrics.DBExecObserver("purge_kannel_messages", func(c context.Context) error {
+		res, err := app.DB.ExecContext(c, q, int64(retention.Seconds()), limit)
+		if err != nil {
+			return err
+		}
+		n, err = res.RowsAffected()
+		return err
+	})
+	if err := execFn(ctx); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// StartPurger deletes old dlr-urls every interval until ctx is done.
+func StartPurger(ctx context.Context, interval, retention time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+		for {
+			n, err := PurgeMessages(ctx, retention, purgeBatchSize)
+			if err != nil {
+				app.Logger.Error("purge kannel messages", "err", err)
+				break
+			}
+			if n < purgeBatchSize {
+				break
+			}
+		}
+	}
+}
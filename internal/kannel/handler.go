@@ -0,0 +1,153 @@
+package kannel
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"sms-gateway/app"
+	"sms-gateway/internal/auth"
+	"sms-gateway/internal/balance"
+	"sms-gateway/internal/model"
+	"sms-gateway/internal/sms"
+	"sms-gateway/pkg/metrics"
+	"sms-gateway/pkg/tracing"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/labstack/echo/v4"
+)
+
+// Kannel's replies; clients look at the status code and the leading number.
+const (
+	replyAccepted = "0: Accepted for delivery"
+	replyQueued   = "3: Queued for later delivery"
+	replyAuth     = "Authorization failed for sendsms"
+	replyFailed   = "Sending failed."
+)
+
+// SendHandler serves Kannel's sendsms interface (GET query or POST form): username is the
+// customer id and password one of its API keys. to holds one or more recipients separated
+// by spaces. The message is sent as normal type through sms.Send, like POST /sms/send.
+// Replies are plain text as Kannel's: 202 "0: Accepted for delivery", or "3: Queued for later
+// delivery" when the content policy holds the message for review.
+func SendHandler(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	customerID, ok := authenticate(c)
+	if !ok {
+		return c.String(http.StatusForbidden, replyAuth)
+	}
+	ctx = auth.WithCustomer(ctx, customerID)
+	ctx = tracing.WithUser(ctx, strconv.FormatInt(customerID, 10))
+
+	recipients := strings.Fields(c.FormValue("to"))
+	if len(recipients) == 0 {
+		return c.String(http.StatusBadRequest, "Missing receiver number, rejected")
+	}
+	coding, err := parseCoding(c.FormValue("coding"))
+	if err != nil {
+		return c.String(http.StatusBadRequest, "Invalid coding value, rejected")
+	}
+	text, err := decodeText(c.FormValue("text"), coding, c.FormValue("charset"))
+	if err != nil {
+		if errors.Is(err, ErrInvalidCharset) {
+			return c.String(http.StatusBadRequest, "Invalid charset, rejected")
+		}
+		return c.String(http.StatusBadRequest, "Invalid text for charset, rejected")
+	}
+	sender := c.FormValue("from")
+	if len(sender) > maxSenderLen {
+		return c.String(http.StatusBadRequest, "Invalid sender, rejected")
+	}
+	dlrURL := c.FormValue("dlr-url")
+	dlrMask, err := parseDLRMask(c.FormValue("dlr-mask"))
+	if err != nil {
+		return c.String(http.StatusBadRequest, "Invalid dlr-mask value, rejected")
+	}
+	if dlrURL != "" && !validDLRURL(dlrURL) {
+		return c.String(http.StatusBadRequest, "Invalid dlr-url, rejected")
+	}
+
+	var hooks []sms.TxHook
+	if dlrURL != "" && dlrMask != 0 {
+		// Stored with the message, so a message that is sent always has its callbacks.
+		hooks = append(hooks, func(ctx context.Context, tx *sqlx.Tx, s model.SMS) error {
+			return insertMessageTx(ctx, tx, message{
+				SmsIdentifier: s.SmsIdentifier,
+				CustomerID:    customerID,
+				Sender:        sender,
+				DLRURL:        dlrURL,
+				DLRMask:       dlrMask,
+			})
+		})
+	}
+
+	_, state, err := sms.Send(ctx, model.SMS{
+		CustomerID: customerID,
+		Text:       text,
+		Recipients: recipients,
+		Type:       model.NORMAL,
+	}, hooks...)
+	if err != nil {
+		var le *sms.LimitError
+		switch {
+		case errors.Is(err, sms.ErrNoRecipients), errors.As(err, new(*sms.RecipientError)):
+			return c.String(http.StatusBadRequest, "Invalid receiver number, rejected")
+		case errors.As(err, &le):
+			c.Response().Header().Set("Retry-After", strconv.Itoa(le.RetryAfterSeconds()))
+			return c.String(http.StatusTooManyRequests, "Send limit exceeded, rejected")
+		case errors.Is(err, sms.ErrOverLimit):
+			return c.String(http.StatusBadRequest, "Too many receivers, rejected")
+		case errors.Is(err, balance.ErrInsufficientBalance):
+			return c.String(http.StatusPaymentRequired, "Insufficient balance, rejected")
+		case errors.Is(err, sms.ErrBlocked):
+			return c.String(http.StatusUnprocessableEntity, "Message blocked by content policy, rejected")
+		}
+		app.Logger.Error("kannel send sms", "customer_id", customerID, "err", err)
+		return c.String(http.StatusServiceUnavailable, replyFailed)
+	}
+
+	if state == sms.Held {
+		return c.String(http.StatusAccepted, replyQueued)
+	}
+	return c.String(http.StatusAccepted, replyAccepted)
+}
+
+// authenticate checks username (the customer id) and password (an API key of that customer).
+func authenticate(c echo.Context) (int64, bool) {
+	customerID, err := strconv.ParseInt(c.FormValue("username"), 10, 64)
+	if err != nil || customerID <= 0 {
+		return 0, false
+	}
+	k, err := auth.Authenticate(c.Request().Context(), c.FormValue("password"))
+	if err != nil {
+		if !errors.Is(err, auth.ErrUnauthenticated) {
+			app.Logger.Error("kannel authenticate", "err", err)
+		}
+		return 0, false
+	}
+	return customerID, k.CustomerID == customerID
+}
+
+// message is the dlr-url of a message sent through this interface.
+type message struct {
+	SmsIdentifier string `db:"sms_identifier"`
+	CustomerID    int64  `db:"customer_id"`
+	Sender        string `db:"sender"`
+	DLRURL        string `db:"dlr_url"`
+	DLRMask       int    `db:"dlr_mask"`
+}
+
+func insertMessageTx(ctx context.Context, tx *sqlx.Tx, m message) error {
+	const q = `
+		INSERT INTO kannel_messages (sms_identifier, customer_id, sender, dlr_url, dlr_mask)
+		VALUES (:sms_identifier, :customer_id, :sender, :dlr_url, :dlr_mask)
+	`
+	execFn := metrics.DBExecObserver("insert_kannel_message", func(c context.Context) error {
+		_, err := tx.NamedExecContext(c, q, m)
+		return err
+	})
+	return execFn(ctx)
+}
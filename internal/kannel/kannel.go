@@ -0,0 +1,178 @@
+// Package kannel serves Kannel's /cgi-bin/sendsms interface on top of the gateway's send flow,
+// for customers migrating from Kannel, and calls their dlr-url on status changes.
+package kannel
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"sms-gateway/internal/sms"
+)
+
+// Kannel's coding values.
+const (
+	Coding7Bit = 0
+	Coding8Bit = 1
+	CodingUCS2 = 2
+)
+
+// DLR types, the bits of dlr-mask and the %d of a dlr-url.
+const (
+	DLRDelivered   = 1
+	DLRUndelivered = 2
+	DLRBuffered    = 4
+	DLRSubmitted   = 8
+	DLRRejected    = 16
+
+	dlrMaskAll = DLRDelivered | DLRUndelivered | DLRBuffered | DLRSubmitted | DLRRejected
+)
+
+// maxSenderLen bounds from; Kannel senders are up to 11 letters or 16 digits.
+const maxSenderLen = 32
+
+var (
+	ErrInvalidCoding  = errors.New("invalid coding value")
+	ErrInvalidCharset = errors.New("invalid charset")
+	ErrInvalidText    = errors.New("text does not match charset")
+)
+
+// dlrType maps a gateway state onto the DLR type Kannel reports for it. The gateway has no
+// handset receipts, so DONE (accepted by the operator) is reported as delivered.
+func dlrType(state sms.State) int {
+	switch state {
+	case sms.Pending, sms.Held:
+		return DLRBuffered
+	case sms.Sending:
+		return DLRSubmitted
+	case sms.Done:
+		return DLRDelivered
+	case sms.Failed:
+		return DLRUndelivered
+	case sms.Rejected:
+		return DLRRejected
+	default:
+		return 0
+	}
+}
+
+// parseCoding reads coding; empty means 7-bit.
+func parseCoding(v string) (int, error) {
+	if v == "" {
+		return Coding7Bit, nil
+	}
+	coding, err := strconv.Atoi(v)
+	if err != nil || coding < Coding7Bit || coding > CodingUCS2 {
+		return 0, ErrInvalidCoding
+	}
+	return coding, nil
+}
+
+// decodeText turns text in charset into UTF-8. Like Kannel, charset defaults to UTF-16BE for
+// UCS-2 and to UTF-8 otherwise.
+func decodeText(text string, coding int, charset string) (string, error) {
+	cs := strings.ToUpper(strings.ReplaceAll(charset, "_", "-"))
+	if cs == "" {
+		cs = "UTF-8"
+		if coding == CodingUCS2 {
+			cs = "UTF-16BE"
+		}
+	}
+
+	switch cs {
+	case "UTF-8", "UTF8":
+		if !utf8.ValidString(text) {
+			return "", ErrInvalidText
+		}
+		return text, nil
+	case "ISO-8859-1", "LATIN1", "ISO8859-1":
+		runes := make([]rune, len(text))
+		for i := 0; i < len(text); i++ {
+			runes[i] = rune(text[i])
+		}
+		return string(runes), nil
+	case "UTF-16BE", "UCS-2", "UCS-2BE", "UTF16BE":
+		if len(text)%2 != 0 {
+			return "", ErrInvalidText
+		}
+		units := make([]uint16, len(text)/2)
+		for i := range units {
+			units[i] = uint16(text[2*i])<<8 | uint16(text[2*i+1])
+		}
+		return string(utf16.Decode(units)), nil
+	default:
+		return "", ErrInvalidCharset
+	}
+}
+
+// dlrValues are what a dlr-url's escape codes are replaced with.
+type dlrValues struct {
+	Type          int
+	Recipient     string
+	Sender        string
+	Time          time.Time
+	Status        sms.State
+	Provider      string
+	SmsIdentifier string
+}
+
+// expandDLRURL replaces the escape codes Kannel supports in a dlr-url: %d type, %p recipient,
+// %P sender, %t time, %T unix time, %A status, %i provider, %I message id and %% itself.
+// Unknown codes are kept as they are.
+func expandDLRURL(tmpl string, v dlrValues) string {
+	var b strings.Builder
+	for i := 0; i < len(tmpl); i++ {
+		if tmpl[i] != '%' || i == len(tmpl)-1 {
+			b.WriteByte(tmpl[i])
+			continue
+		}
+		i++
+		switch tmpl[i] {
+		case 'd':
+			b.WriteString(strconv.Itoa(v.Type))
+		case 'p':
+			b.WriteString(url.QueryEscape(v.Recipient))
+		case 'P':
+			b.WriteString(url.QueryEscape(v.Sender))
+		case 't':
+			b.WriteString(url.QueryEscape(v.Time.Format(time.DateTime)))
+		case 'T':
+			b.WriteString(strconv.FormatInt(v.Time.Unix(), 10))
+		case 'A':
+			b.WriteString(url.QueryEscape(string(v.Status)))
+		case 'i':
+			b.WriteString(url.QueryEscape(v.Provider))
+		case 'I':
+			b.WriteString(url.QueryEscape(v.SmsIdentifier))
+		case '%':
+			b.WriteByte('%')
+		default:
+			b.WriteByte('%')
+			b.WriteByte(tmpl[i])
+		}
+	}
+	return b.String()
+}
+
+// validDLRURL reports whether tmpl expands to an absolute http(s) URL.
+func validDLRURL(tmpl string) bool {
+	u, err := url.Parse(expandDLRURL(tmpl, dlrValues{Time: time.Now()}))
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// parseDLRMask reads dlr-mask; empty means no callbacks.
+func parseDLRMask(v string) (int, error) {
+	if v == "" {
+		return 0, nil
+	}
+	mask, err := strconv.Atoi(v)
+	if err != nil || mask < 0 || mask > dlrMaskAll {
+		return 0, fmt.Errorf("invalid dlr-mask %q", v)
+	}
+	return mask, nil
+}
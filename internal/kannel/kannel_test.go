@@ -0,0 +1,171 @@
+package kannel
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"sms-gateway/app"
+	"sms-gateway/internal/sms"
+	"sms-gateway/testutil"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestDecodeText(t *testing.T) {
+	cases := []struct {
+		name    string
+		text    string
+		coding  int
+		charset string
+		want    string
+		wantErr error
+	}{
+		{name: "utf-8 by default", text: "salam ✓", coding: Coding7Bit, want: "salam ✓"},
+		{name: "latin1", text: "caf\xe9", coding: Coding7Bit, charset: "ISO-8859-1", want: "café"},
+		{name: "ucs-2 defaults to utf-16be", text: "\x06\x33\x06\x44\x06\x27\x06\x45", coding: CodingUCS2, want: "سلام"},
+		{name: "surrogate pair", text: "\xd8\x3d\xde\x00", coding: CodingUCS2, charset: "utf-16be", want: "😀"},
+		{name: "odd utf-16 length", text: "\x06", coding: CodingUCS2, wantErr: ErrInvalidText},
+		{name: "invalid utf-8", text: "\xff", coding: Coding7Bit, wantErr: ErrInvalidText},
+		{name: "unknown charset", text: "a", coding: Coding7Bit, charset: "KOI8-R", wantErr: ErrInvalidCharset},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := decodeText(tc.text, tc.coding, tc.charset)
+			if err != tc.wantErr || got != tc.want {
+				t.Fatalf("got %q, %v; want %q, %v", got, err, tc.want, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestExpandDLRURL(t *testing.T) {
+	v := dlrValues{
+		Type:          DLRDelivered,
+		Recipient:     "+98912",
+		Sender:        "My Shop",
+		Time:          time.Date(2026, 10, 18, 9, 30, 0, 0, time.UTC),
+		Status:        sms.Done,
+		Provider:      "operatorA",
+		SmsIdentifier: "abc",
+	}
+	got := expandDLRURL("http://example.com/dlr?type=%d&to=%p&from=%P&at=%t&ts=%T&s=%A&smsc=%i&id=%I&pct=%%&x=%z", v)
+	want := "http://example.com/dlr?type=1&to=%2B98912&from=My+Shop&at=2026-10-18+09%3A30%3A00&ts=1792315800&s=done&smsc=operatorA&id=abc&pct=%&x=%z"
+	if got != want {
+		t.Fatalf("got  %s\nwant %s", got, want)
+	}
+
+	if !validDLRURL("https://example.com/dlr?type=%d&id=%I") || validDLRURL("ftp://example.com/%d") || validDLRURL("/dlr?type=%d") {
+		t.Fatal("unexpected dlr-url validation")
+	}
+}
+
+func TestParseDLRMask(t *testing.T) {
+	for _, v := range []string{"-1", "32", "x"} {
+		if _, err := parseDLRMask(v); err == nil {
+			t.Fatalf("dlr-mask %q accepted", v)
+		}
+	}
+	if mask, err := parseDLRMask("3"); err != nil || mask != DLRDelivered|DLRUndelivered {
+		t.Fatalf("got %d, %v", mask, err)
+	}
+}
+
+func TestSendHandler_AuthorizationFailed(t *testing.T) {
+	for _, q := range []string{"username=7&password=nope&to=98912&text=hi", "username=abc&password=sgw_x&to=98912&text=hi"} {
+		req := httptest.NewRequest(http.MethodGet, "/cgi-bin/sendsms?"+q, nil)
+		rec := httptest.NewRecorder()
+		if err := SendHandler(echo.New().NewContext(req, rec)); err != nil {
+			t.Fatalf("handler err: %v", err)
+		}
+		if rec.Code != http.StatusForbidden || rec.Body.String() != replyAuth {
+			t.Fatalf("%s: got %d %q", q, rec.Code, rec.Body.String())
+		}
+	}
+}
+
+func TestScanStatusEvents(t *testing.T) {
+	ctx := testutil.EnsureSetup(t)
+	testutil.ResetTables(ctx, t)
+
+	tx, err := app.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		t.Fatalf("begin: %v", err)
+	}
+	if err := insertMessageTx(ctx, tx, message{SmsIdentifier: "k1", CustomerID: 5, Sender: "shop", DLRURL: "http://example.com/dlr?type=%d&to=%p", DLRMask: DLRDelivered | DLRUndelivered}); err != nil {
+		t.Fatalf("insert message: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("commit: %v", err)
+	}
+	const insertEvent = `INSERT INTO sms_status_events (customer_id, sms_identifier, recipients, status, provider, created_at) VALUES (?, ?, ?, ?, '', ?)`
+	old := time.Now().Add(-time.Minute)
+	for _, e := range []struct {
+		id         string
+		recipients string
+		status     sms.State
+		at         time.Time
+	}{
+		{"k1", `["+1","+2"]`, sms.Pending, old},
+		{"other", `["+3"]`, sms.Done, old},
+		{"k1", `["+1","+2"]`, sms.Done, old},
+		{"k1", `["+1"]`, sms.Failed, time.Now().Add(time.Minute)},
+	} {
+		if _, err := app.DB.ExecContext(ctx, insertEvent, 5, e.id, e.recipients, e.status, e.at); err != nil {
+			t.Fatalf("seed event: %v", err)
+		}
+	}
+
+	passed, err := ScanStatusEvents(ctx, 10)
+	if err != nil {
+		t.Fatalf("scan: %v", err)
+	}
+	// The last event is not settled yet.
+	if passed != 3 {
+		t.Fatalf("passed %d events, want 3", passed)
+	}
+	rows, err := claimCallbacks(ctx, 10)
+	if err != nil {
+		t.Fatalf("claim: %v", err)
+	}
+	// PENDING is not in the mask; DONE gives one callback per recipient.
+	if len(rows) != 2 {
+		t.Fatalf("queued %d callbacks, want 2", len(rows))
+	}
+	var cb callback
+	if err := json.Unmarshal(rows[0].Payload, &cb); err != nil || !strings.HasPrefix(cb.URL, "http://example.com/dlr?type=1&to=%2B") {
+		t.Fatalf("unexpected callback %+v, %v", cb, err)
+	}
+
+	if passed, err := ScanStatusEvents(ctx, 10); err != nil || passed != 0 {
+		t.Fatalf("rescan passed %d, %v", passed, err)
+	}
+}
+
+func TestDeliver(t *testing.T) {
+	var got string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.URL.RawQuery
+		if r.URL.Query().Get("type") == "2" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer srv.Close()
+
+	payload, _ := json.Marshal(callback{URL: srv.URL + "/dlr?type=1&id=abc"})
+	if err := deliver(context.Background(), callbackRow{ID: 1, Payload: payload}); err != nil {
+		t.Fatalf("deliver: %v", err)
+	}
+	if got != "type=1&id=abc" {
+		t.Fatalf("unexpected query %q", got)
+	}
+
+	payload, _ = json.Marshal(callback{URL: srv.URL + "/dlr?type=2"})
+	if err := deliver(context.Background(), callbackRow{ID: 2, Payload: payload}); err == nil {
+		t.Fatal("expected an error for a 500 reply")
+	}
+}
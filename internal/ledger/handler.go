@@ -0,0 +1,79 @@
+package ledger
+
+import (
+	"net/http"
+	"strconv"
+
+	"sms-gateway/app"
+
+	"github.com/labstack/echo/v4"
+)
+
+// BalancesHandler godoc
+// @Summary      Ledger account balances
+// @Description  Returns the system accounts (or one customer's wallet) and the trial balance, which must be 0
+// @Tags         admin
+// @Produce      json
+// @Security     AdminAuth
+// @Param        user_id query int false "Only this customer's wallet"
+// @Success      200 {object} map[string]any
+// @Failure      400 {object} apierror.Error "invalid user_id"
+// @Failure      401 {object} apierror.Error "unauthenticated"
+// @Failure      500 {object} apierror.Error "internal error"
+// @Router       /admin/ledger/accounts [get]
+func BalancesHandler(c echo.Context) error {
+	var userID *int64
+	if v := c.QueryParam("user_id"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid user_id")
+		}
+		userID = &id
+	}
+
+	accounts, err := Balances(c.Request().Context(), userID)
+	if err != nil {
+		app.Logger.Error("ledger balances", "err", err)
+		return err
+	}
+	trial, err := TrialBalance(c.Request().Context())
+	if err != nil {
+		app.Logger.Error("ledger trial balance", "err", err)
+		return err
+	}
+
+	out := map[string]any{}
+	out["accounts"] = accounts
+	out["trial_balance"] = trial
+
+	return c.JSON(http.StatusOK, out)
+}
+
+// JournalHandler godoc
+// @Summary      Ledger journal of a transaction
+// @Tags         admin
+// @Produce      json
+// @Security     AdminAuth
+// @Param        reference_id query string true "user_transactions.transaction_id"
+// @Success      200 {object} map[string]any
+// @Failure      400 {object} apierror.Error "reference_id is required"
+// @Failure      401 {object} apierror.Error "unauthenticated"
+// @Failure      500 {object} apierror.Error "internal error"
+// @Router       /admin/ledger/journals [get]
+func JournalHandler(c echo.Context) error {
+	referenceID := c.QueryParam("reference_id")
+	if referenceID == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "reference_id is required")
+	}
+
+	entries, err := ListJournalEntries(c.Request().Context(), referenceID)
+	if err != nil {
+		app.Logger.Error("ledger journal", "reference_id", referenceID, "err", err)
+		return err
+	}
+
+	out := map[string]any{}
+	out["entries"] = entries
+
+	return c.JSON(http.StatusOK, out)
+}
@@ -0,0 +1,265 @@
+package ledger
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"sms-gateway/app"
+	"sms-gateway/pkg/metrics"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Amounts are signed: every journal's entries sum to zero and an account's balance is the sum
+// of its entries. A positive wallet balance is money the customer can spend; revenue grows
+// positive as messages are delivered; funding, promo_credit, refunds and corrections go
+// negative by what they put into wallets.
+
+type Kind string
+
+const (
+	KindWallet      Kind = "wallet"
+	KindRevenue     Kind = "revenue"
+	KindRefunds     Kind = "refunds"
+	KindPromoCredit Kind = "promo_credit"
+	KindFunding     Kind = "funding"
+	KindCorrections Kind = "corrections"
+)
+
+// System account codes; wallets use WalletAccount.
+const (
+	Revenue     = "revenue"
+	Refunds     = "refunds"
+	PromoCredit = "promo_credit"
+	Funding     = "funding"
+	Corrections = "corrections"
+)
+
+type JournalType string
+
+const (
+	JournalDeposit    JournalType = "deposit"
+	JournalPromo      JournalType = "promo"
+	JournalCapture    JournalType = "capture"
+	JournalRefund     JournalType = "refund"
+	JournalCorrection JournalType = "correction"
+	// JournalTransfer moves balance between two wallets (parent and sub-account).
+	JournalTransfer JournalType = "transfer"
+)
+
+var ErrUnbalanced = errors.New("journal entries do not sum to zero")
+
+func WalletAccount(userID int64) string {
+	return fmt.Sprintf("wallet:%d", userID)
+}
+
+func kindOf(code string) (Kind, *int64) {
+	if strings.HasPrefix(code, "wallet:") {
+		var id int64
+		if _, err := fmt.Sscanf(code, "wallet:%d", &id); err == nil {
+			return KindWallet, &id
+		}
+	}
+	return Kind(code), nil
+}
+
+type Entry struct {
+	Account string
+	Amount  int64
+}
+
+type Journal struct {
+	Type JournalType
+	// ReferenceID is the user_transactions.transaction_id the journal mirrors; unique per Type.
+	ReferenceID string
+	UserID      int64
+	Entries     []Entry
+}
+
+func (j Journal) Validate() error {
+	if j.Type == "" || j.ReferenceID == "" || len(j.Entries) < 2 {
+		return errors.New("journal type, reference and at least two entries are required")
+	}
+	var sum int64
+	for _, e := range j.Entries {
+		if e.Account == "" {
+			return errors.New("entry account is required")
+		}
+		sum += e.Amount
+	}
+	if sum != 0 {
+		return ErrUnbalanced
+	}
+	return nil
+}
+
+// Transfer is the common two-legged journal: amount moves from one account to another.
+func Transfer(t JournalType, referenceID string, userID int64, from, to string, amount int64) Journal {
+	return Journal{
+		Type:        t,
+		ReferenceID: referenceID,
+		UserID:      userID,
+		Entries:     []Entry{{Account: from, Amount: -amount}, {Account: to, Amount: amount}},
+	}
+}
+
+// PostTx writes a balanced journal inside the caller's DB transaction, so it commits or rolls
+// back together with the balance change it records. Account balances are not stored: a
+// running total on the shared revenue account would serialise every capture on one row.
+func PostTx(ctx context.Context, tx *sqlx.Tx, j Journal) error {
+	if tx == nil {
+		return errors.New("tx is required")
+	}
+	if err := j.Validate(); err != nil {
+		return err
+	}
+
+	ids, err := ensureAccountsTx(ctx, tx, j.Entries)
+	if err != nil {
+		return err
+	}
+
+	var journalID int64
+	const insertJournal = `INSERT INTO ledger_journals (journal_type, reference_id, user_id) VALUES (?, ?, ?)`
+	if err := metrics.DBExecObserver("insert_ledger_journal", func(c context.Context) error {
+		res, err := tx.ExecContext(c, insertJournal, j.Type, j.ReferenceID, j.UserID)
+		if err != nil {
+			return err
+		}
+		journalID, err = res.LastInsertId()
+		return err
+	})(ctx); err != nil {
+		return err
+	}
+
+	valueStrings := make([]string, 0, len(j.Entries))
+	args := make([]any, 0, len(j.Entries)*3)
+	for _, e := range j.Entries {
+		valueStrings = append(valueStrings, "(?, ?, ?)")
+		args = append(args, journalID, ids[e.Account], e.Amount)
+	}
+	q := `INSERT INTO ledger_entries (journal_id, account_id, amount) VALUES ` + strings.Join(valueStrings, ",")
+	return metrics.DBExecObserver("insert_ledger_entries", func(c context.Context) error {
+		_, err := tx.ExecContext(c, q, args...)
+		return err
+	})(ctx)
+}
+
+func ensureAccountsTx(ctx context.Context, tx *sqlx.Tx, entries []Entry) (map[string]int64, error) {
+	codes := make([]any, 0, len(entries))
+	seen := map[string]bool{}
+	valueStrings := make([]string, 0, len(entries))
+	args := make([]any, 0, len(entries)*3)
+	for _, e := range entries {
+		if seen[e.Account] {
+			continue
+		}
+		seen[e.Account] = true
+		codes = append(codes, e.Account)
+		kind, userID := kindOf(e.Account)
+		valueStrings = append(valueStrings, "(?, ?, ?)")
+		args = append(args, e.Account, kind, userID)
+	}
+
+	insertQ := `INSERT INTO ledger_accounts (code, kind, user_id) VALUES ` + strings.Join(valueStrings, ",") + ` ON DUPLICATE KEY UPDATE code = code`
+	if err := metrics.DBExecObserver("ensure_ledger_accounts", func(c context.Context) error {
+		_, err := tx.ExecContext(c, insertQ, args...)
+		return err
+	})(ctx); err != nil {
+		return nil, err
+	}
+
+	var rows []struct {
+		ID   int64  `db:"id"`
+		Code string `db:"code"`
+	}
+	selectQ := `SELECT id, code FROM ledger_accounts WHERE code IN (?` + strings.Repeat(",?", len(codes)-1) + `)`
+	if err := metrics.DBExecObserver("select_ledger_accounts", func(c context.Context) error {
+		return tx.SelectContext(c, &rows, selectQ, codes...)
+	})(ctx); err != nil {
+		return nil, err
+	}
+
+	ids := make(map[string]int64, len(rows))
+	for _, r := range rows {
+		ids[r.Code] = r.ID
+	}
+	return ids, nil
+}
+
+type AccountBalance struct {
+	Code    string `db:"code" json:"code"`
+	Kind    Kind   `db:"kind" json:"kind"`
+	UserID  *int64 `db:"user_id" json:"user_id,omitempty"`
+	Balance int64  `db:"balance" json:"balance"`
+}
+
+// Balances returns the balance of every system account, or of one wallet when userID is set.
+func Balances(ctx context.Context, userID *int64) ([]AccountBalance, error) {
+	q := `
+		SELECT a.code, a.kind, a.user_id, COALESCE(SUM(e.amount), 0) AS balance
+		FROM ledger_accounts a
+		LEFT JOIN ledger_entries e ON e.account_id = a.id
+	`
+	var args []any
+	if userID != nil {
+		q += ` WHERE a.code = ?`
+		args = append(args, WalletAccount(*userID))
+	} else {
+		q += ` WHERE a.kind <> ?`
+		args = append(args, KindWallet)
+	}
+	q += ` GROUP BY a.id, a.code, a.kind, a.user_id ORDER BY a.code`
+
+	var out []AccountBalance
+	queryFn := metrics.DBExecObserver("select_ledger_balances", func(c context.Context) error {
+		return app.DB.SelectContext(c, &out, q, args...)
+	})
+	if err := queryFn(ctx); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// TrialBalance returns the sum of all entries, which is zero unless the ledger is corrupt.
+func TrialBalance(ctx context.Context) (int64, error) {
+	var sum int64
+	queryFn := metrics.DBExecObserver("select_ledger_trial_balance", func(c context.Context) error {
+		return app.DB.GetContext(c, &sum, `SELECT COALESCE(SUM(amount), 0) FROM ledger_entries`)
+	})
+	if err := queryFn(ctx); err != nil {
+		return 0, err
+	}
+	return sum, nil
+}
+
+type JournalEntry struct {
+	JournalID   int64       `db:"journal_id" json:"journal_id"`
+	Type        JournalType `db:"journal_type" json:"journal_type"`
+	ReferenceID string      `db:"reference_id" json:"reference_id"`
+	Account     string      `db:"code" json:"account"`
+	Amount      int64       `db:"amount" json:"amount"`
+	CreatedAt   string      `db:"created_at" json:"created_at"`
+}
+
+// ListJournalEntries returns the entries of the journals mirroring the given transaction.
+func ListJournalEntries(ctx context.Context, referenceID string) ([]JournalEntry, error) {
+	const q = `
+		SELECT j.id AS journal_id, j.journal_type, j.reference_id, a.code, e.amount, j.created_at
+		FROM ledger_journals j
+		JOIN ledger_entries e ON e.journal_id = j.id
+		JOIN ledger_accounts a ON a.id = e.account_id
+		WHERE j.reference_id = ?
+		ORDER BY j.id, e.id
+	`
+	var out []JournalEntry
+	queryFn := metrics.DBExecObserver("select_ledger_journal_entries", func(c context.Context) error {
+		return app.DB.SelectContext(c, &out, q, referenceID)
+	})
+	if err := queryFn(ctx); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
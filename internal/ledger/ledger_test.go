@@ -0,0 +1,33 @@
+package ledger
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestJournalValidate(t *testing.T) {
+	ok := Transfer(JournalCapture, "tx-1", 1, WalletAccount(1), Revenue, 5)
+	if err := ok.Validate(); err != nil {
+		t.Fatalf("expected transfer to be balanced: %v", err)
+	}
+
+	unbalanced := Journal{Type: JournalCapture, ReferenceID: "tx-2", Entries: []Entry{{Account: WalletAccount(1), Amount: -5}, {Account: Revenue, Amount: 4}}}
+	if err := unbalanced.Validate(); !errors.Is(err, ErrUnbalanced) {
+		t.Fatalf("expected unbalanced error, got %v", err)
+	}
+
+	single := Journal{Type: JournalCapture, ReferenceID: "tx-3", Entries: []Entry{{Account: Revenue, Amount: 0}}}
+	if err := single.Validate(); err == nil {
+		t.Fatalf("expected single-entry journal to be rejected")
+	}
+}
+
+func TestKindOf(t *testing.T) {
+	kind, userID := kindOf(WalletAccount(42))
+	if kind != KindWallet || userID == nil || *userID != 42 {
+		t.Fatalf("unexpected wallet kind %s %v", kind, userID)
+	}
+	if kind, userID := kindOf(Revenue); kind != KindRevenue || userID != nil {
+		t.Fatalf("unexpected revenue kind %s %v", kind, userID)
+	}
+}
@@ -7,11 +7,19 @@ const (
 	EXPRESS Type = "express"
 )
 
+// Priority bounds. Queues are declared with x-max-priority = MaxPriority and the
+// priority is used both for the outbox ordering and the AMQP message priority.
+const (
+	MinPriority = 0
+	MaxPriority = 10
+)
+
 type SMS struct {
 	CustomerID    int64    `json:"customer_id"`
 	Text          string   `json:"text"`
 	Recipients    []string `json:"recipients"`
 	Type          Type     `json:"type"`
+	Priority      *int     `json:"priority,omitempty"`
 	TransactionID string   `json:"transaction_id"`
 	SmsIdentifier string   `json:"sms_identifier"`
 }
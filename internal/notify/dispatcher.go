@@ -0,0 +1,226 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"sms-gateway/app"
+	"sms-gateway/config"
+	"sms-gateway/internal/model"
+	"sms-gateway/internal/operator"
+	"sms-gateway/pkg/webhook"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	batchSize   = 50
+	idleSleep   = 500 * time.Millisecond
+	maxAttempts = 10
+)
+
+type eventRow struct {
+	ID        int64           `db:"id"`
+	EventType string          `db:"event_type"`
+	Payload   json.RawMessage `db:"payload"`
+	Attempts  int             `db:"attempts"`
+}
+
+// notification holds the delivery fields every balance event payload may carry.
+type notification struct {
+	UserID        int64  `json:"user_id"`
+	WebhookURL    string `json:"webhook_url"`
+	ContactNumber string `json:"contact_number"`
+	Text          string `json:"text"`
+}
+
+// sendSMS delivers an alert straight through the operators. Alerts are sent on the
+// gateway's behalf, so they are not charged to the customer.
+var sendSMS = func(ctx context.Context, s model.SMS) error {
+	_, err := operator.Send(ctx, s)
+	return err
+}
+
+// customerClient calls the webhooks customers set on their alerts and refuses non-public
+// addresses. BALANCE_EVENTS_WEBHOOK_URL is the operator's own, which may well be internal, so
+// it goes through httpClient. Neither follows redirects.
+var (
+	httpClient = &http.Client{
+		Timeout:       10 * time.Second,
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+	customerClient = webhook.NewClient(10 * time.Second)
+)
+
+// StartDispatcher polls outbox_events for balance events (low-balance alerts, credit
+// threshold crossings) and delivers them by webhook and/or SMS.
+func StartDispatcher(ctx context.Context) error {
+	httpClient.Timeout = time.Duration(config.NotifyWebhookTimeoutSec) * time.Second
+	customerClient = webhook.NewClient(httpClient.Timeout)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		default:
+		}
+
+		rows, err := claimPending(ctx, batchSize)
+		if err != nil {
+			app.Logger.Error("notify claim pending", "err", err)
+			time.Sleep(idleSleep)
+			continue
+		}
+		if len(rows) == 0 {
+			time.Sleep(idleSleep)
+			continue
+		}
+
+		for _, r := range rows {
+			if err := dispatchOne(ctx, r); err != nil {
+				app.Logger.Error("notify dispatch one", "id", r.ID, "event_type", r.EventType, "err", err)
+			}
+		}
+	}
+}
+
+func claimPending(ctx context.Context, limit int) ([]eventRow, error) {
+	tx, err := app.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var rows []eventRow
+	const selectQ = `
+		SELECT id, event_type, payload, attempts
+		FROM outbox_events
+		WHERE status = 'pending'
+		  AND aggregate_type = 'balance'
+		  AND (next_run_at IS NULL OR next_run_at <= CURRENT_TIMESTAMP)
+		ORDER BY created_at ASC
+		LIMIT ?
+		FOR UPDATE SKIP LOCKED
+	`
+	if err := tx.SelectContext(ctx, &rows, selectQ, limit); err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		_ = tx.Commit()
+		return nil, nil
+	}
+
+	if err := markProcessing(ctx, tx, rows); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+func markProcessing(ctx context.Context, tx *sqlx.Tx, rows []eventRow) error {
+	in := "?"
+	ids := []any{rows[0].ID}
+	for _, r := range rows[1:] {
+		in += ",?"
+		ids = append(ids, r.ID)
+	}
+	_, err := tx.ExecContext(ctx, `UPDATE outbox_events SET status = 'processing' WHERE id IN (`+in+`)`, ids...)
+	return err
+}
+
+func dispatchOne(ctx context.Context, r eventRow) error {
+	if err := deliver(ctx, r); err != nil {
+		return failOrRetry(ctx, r, err)
+	}
+	_, err := app.DB.ExecContext(ctx, `UPDATE outbox_events SET status='processed', last_error=NULL WHERE id=?`, r.ID)
+	return err
+}
+
+// deliver sends the event to the customer's webhook or contact number. Producers write one
+// event per channel, so a retry repeats only the channel that failed. Events without a
+// customer channel (e.g. credit threshold crossings) go to BALANCE_EVENTS_WEBHOOK_URL.
+func deliver(ctx context.Context, r eventRow) error {
+	var n notification
+	if err := json.Unmarshal(r.Payload, &n); err != nil {
+		return err
+	}
+
+	url, client := n.WebhookURL, customerClient
+	if url == "" && n.ContactNumber == "" {
+		url, client = config.BalanceEventsWebhookURL, httpClient
+	}
+	if url == "" && n.ContactNumber == "" {
+		app.Logger.Info("balance event without delivery channel", "event_type", r.EventType, "user_id", n.UserID)
+		return nil
+	}
+
+	var errs []error
+	if url != "" {
+		errs = append(errs, postWebhook(ctx, client, url, r))
+	}
+	if n.ContactNumber != "" {
+		errs = append(errs, sendSMS(ctx, model.SMS{
+			CustomerID:    n.UserID,
+			Text:          n.Text,
+			Recipients:    []string{n.ContactNumber},
+			Type:          model.EXPRESS,
+			SmsIdentifier: uuid.NewString(),
+		}))
+	}
+	return errors.Join(errs...)
+}
+
+func postWebhook(ctx context.Context, client *http.Client, url string, r eventRow) error {
+	body, err := json.Marshal(map[string]any{
+		"id":         r.ID,
+		"event_type": r.EventType,
+		"data":       r.Payload,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	// Receivers de-duplicate retried deliveries by this id.
+	req.Header.Set("X-Event-ID", fmt.Sprint(r.ID))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("webhook %s returned %d", url, resp.StatusCode)
+	}
+	return nil
+}
+
+func failOrRetry(ctx context.Context, r eventRow, cause error) error {
+	nextAttempts := r.Attempts + 1
+	if nextAttempts >= maxAttempts {
+		_, err := app.DB.ExecContext(ctx,
+			`UPDATE outbox_events SET status='failed', attempts=?, last_error=? WHERE id=?`,
+			nextAttempts, cause.Error(), r.ID,
+		)
+		return err
+	}
+
+	backoff := time.Second * time.Duration(1<<min(nextAttempts, 6))
+	_, err := app.DB.ExecContext(ctx,
+		`UPDATE outbox_events SET status='pending', attempts=?, next_run_at=?, last_error=? WHERE id=?`,
+		nextAttempts, time.Now().Add(backoff), cause.Error(), r.ID,
+	)
+	return err
+}
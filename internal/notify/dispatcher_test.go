@@ -0,0 +1,97 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"sms-gateway/internal/model"
+	"sms-gateway/pkg/webhook"
+)
+
+// trustServer lets customer webhooks reach srv, which listens on loopback.
+func trustServer(t *testing.T, srv *httptest.Server) {
+	prev := customerClient
+	customerClient = srv.Client()
+	t.Cleanup(func() { customerClient = prev })
+}
+
+func TestDeliver_WebhookAndSMS(t *testing.T) {
+	var gotEventID string
+	var gotBody map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotEventID = r.Header.Get("X-Event-ID")
+		_ = json.NewDecoder(r.Body).Decode(&gotBody)
+	}))
+	defer srv.Close()
+	trustServer(t, srv)
+
+	var sent []model.SMS
+	prev := sendSMS
+	sendSMS = func(_ context.Context, s model.SMS) error {
+		sent = append(sent, s)
+		return nil
+	}
+	defer func() { sendSMS = prev }()
+
+	payload, _ := json.Marshal(notification{UserID: 7, WebhookURL: srv.URL, ContactNumber: "+98912", Text: "low balance"})
+	if err := deliver(context.Background(), eventRow{ID: 42, EventType: "balance.low_balance", Payload: payload}); err != nil {
+		t.Fatalf("deliver: %v", err)
+	}
+
+	if gotEventID != "42" || gotBody["event_type"] != "balance.low_balance" {
+		t.Fatalf("unexpected webhook call id=%q body=%v", gotEventID, gotBody)
+	}
+	if len(sent) != 1 || sent[0].Recipients[0] != "+98912" || sent[0].Text != "low balance" || sent[0].Type != model.EXPRESS {
+		t.Fatalf("unexpected sms %+v", sent)
+	}
+}
+
+func TestDeliver_WebhookErrorIsRetried(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer srv.Close()
+	trustServer(t, srv)
+
+	payload, _ := json.Marshal(notification{UserID: 7, WebhookURL: srv.URL})
+	if err := deliver(context.Background(), eventRow{ID: 1, EventType: "balance.low_balance", Payload: payload}); err == nil {
+		t.Fatalf("expected error for non-2xx webhook response")
+	}
+}
+
+func TestDeliver_CustomerWebhookRefusesInternalAddresses(t *testing.T) {
+	called := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+	defer srv.Close()
+
+	payload, _ := json.Marshal(notification{UserID: 7, WebhookURL: srv.URL})
+	err := deliver(context.Background(), eventRow{ID: 1, EventType: "balance.low_balance", Payload: payload})
+	if !errors.Is(err, webhook.ErrForbiddenAddress) || called {
+		t.Fatalf("expected loopback webhook to be refused, got err=%v called=%v", err, called)
+	}
+}
+
+func TestDeliver_WebhookRedirectIsNotFollowed(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatalf("redirect was followed")
+	}))
+	defer target.Close()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, target.URL, http.StatusFound)
+	}))
+	defer srv.Close()
+	trustServer(t, srv)
+	customerClient.CheckRedirect = webhook.NewClient(time.Second).CheckRedirect
+
+	payload, _ := json.Marshal(notification{UserID: 7, WebhookURL: srv.URL})
+	if err := deliver(context.Background(), eventRow{ID: 1, EventType: "balance.low_balance", Payload: payload}); err == nil {
+		t.Fatalf("expected a redirect to fail the delivery")
+	}
+}
@@ -2,8 +2,10 @@ package operator
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
+	"strings"
 	"time"
 
 	"sms-gateway/internal/model"
@@ -18,6 +20,19 @@ type Operator interface {
 	Send(ctx context.Context, s model.SMS) error
 }
 
+// RecipientError is returned by an operator that accepted the message for every recipient
+// except Failed. The call counts as a success: it is neither retried nor sent to the fallback.
+type RecipientError struct {
+	Failed []string
+	Err    error
+}
+
+func (e *RecipientError) Error() string {
+	return fmt.Sprintf("failed for recipients %s: %v", strings.Join(e.Failed, ","), e.Err)
+}
+
+func (e *RecipientError) Unwrap() error { return e.Err }
+
 var (
 	primaryOperator  Operator = operatorA.OA{}
 	fallbackOperator Operator = operatorB.OB{}
@@ -34,8 +49,9 @@ var (
 )
 
 func Send(ctx context.Context, s model.SMS) (string, error) {
-	if provider, err := dispatch(ctx, "operatorA", primaryOperator, operatorBreaker, s); err == nil {
-		return provider, nil
+	var partial *RecipientError
+	if provider, err := dispatch(ctx, "operatorA", primaryOperator, operatorBreaker, s); err == nil || errors.As(err, &partial) {
+		return provider, err
 	}
 
 	slog.Warn("primary operator failed, falling back")
@@ -69,11 +85,12 @@ func dispatch(ctx context.Context, name string, op Operator, breaker *circuitbre
 		err := wrap(func(c context.Context) error { return op.Send(c, s) })(sendCtx)
 		cancel()
 
-		if err == nil {
+		var partial *RecipientError
+		if err == nil || errors.As(err, &partial) {
 			if breaker != nil {
 				breaker.MarkSuccess()
 			}
-			return name, nil
+			return name, err
 		}
 
 		lastErr = err
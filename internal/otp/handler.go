@@ -0,0 +1,156 @@
+package otp
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"sms-gateway/app"
+	"sms-gateway/internal/auth"
+	"sms-gateway/internal/balance"
+	"sms-gateway/internal/sms"
+	"sms-gateway/pkg/apierror"
+
+	"github.com/labstack/echo/v4"
+)
+
+// SendPayload represents the request body for sending a one-time password.
+type SendPayload struct {
+	Recipient string `json:"recipient"`
+	Template  string `json:"template"`
+}
+
+// VerifyPayload represents the request body for verifying a one-time password.
+type VerifyPayload struct {
+	Recipient string `json:"recipient"`
+	Code      string `json:"code"`
+}
+
+// SendHandler godoc
+// @Summary      Send one-time password
+// @Description  Generates a code, renders it into the template ({code} placeholder) and sends it as express SMS
+// @Tags         otp
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        request body SendPayload true "OTP send request"
+// @Param        Idempotency-Key header string false "Makes the request safe to retry; repeats return the first response"
+// @Success      200 {object} SendResult
+// @Failure      400 {object} apierror.Error "invalid input"
+// @Failure      401 {object} apierror.Error "unauthenticated"
+// @Failure      402 {object} apierror.Error "insufficient balance"
+// @Failure      422 {object} apierror.Error "message blocked or held by content policy"
+// @Failure      429 {object} apierror.Error "resend cooldown or send limit exceeded"
+// @Failure      500 {object} apierror.Error "internal error"
+// @Router       /otp/send [post]
+func SendHandler(c echo.Context) error {
+	customerID, err := auth.CustomerID(c)
+	if err != nil {
+		return err
+	}
+
+	var req SendPayload
+	if err := json.NewDecoder(c.Request().Body).Decode(&req); err != nil {
+		app.Logger.Error("invalid input ", "err", err)
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid input")
+	}
+	if req.Recipient == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "recipient is required")
+	}
+
+	res, err := Send(c.Request().Context(), SendRequest{
+		CustomerID: customerID,
+		Recipient:  req.Recipient,
+		Template:   req.Template,
+	})
+	if err != nil {
+		var (
+			cooldown *CooldownError
+			re       *sms.RecipientError
+			le       *sms.LimitError
+		)
+		switch {
+		case errors.As(err, &re):
+			return apierror.New(http.StatusBadRequest, apierror.InvalidRecipient, err.Error())
+		case errors.As(err, &le):
+			c.Response().Header().Set("Retry-After", strconv.Itoa(le.RetryAfterSeconds()))
+			return apierror.WithDetails(http.StatusTooManyRequests, le.Code(), err.Error(),
+				map[string]any{"limit": le.Limit, "retry_after_sec": le.RetryAfterSeconds()})
+		case errors.Is(err, sms.ErrOverLimit):
+			return apierror.New(http.StatusBadRequest, apierror.OverLimit, err.Error())
+		case errors.As(err, &cooldown):
+			retryAfter := int(cooldown.RetryAfter.Seconds())
+			c.Response().Header().Set("Retry-After", strconv.Itoa(retryAfter))
+			return apierror.WithDetails(http.StatusTooManyRequests, apierror.RateLimited, "resend cooldown",
+				map[string]any{"retry_after_sec": retryAfter})
+		case errors.Is(err, ErrInvalidTemplate):
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		case errors.Is(err, balance.ErrInsufficientBalance):
+			return apierror.New(http.StatusPaymentRequired, apierror.InsufficientBalance, "insufficient balance")
+		case errors.Is(err, sms.ErrBlocked):
+			return apierror.New(http.StatusUnprocessableEntity, apierror.ContentBlocked, "message blocked by content policy")
+		case errors.Is(err, ErrHeldForReview):
+			return apierror.New(http.StatusUnprocessableEntity, apierror.ContentBlocked, err.Error())
+		}
+		app.Logger.Error("otp send", "user_id", customerID, "err", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "internal error")
+	}
+
+	return c.JSON(http.StatusOK, res)
+}
+
+// VerifyHandler godoc
+// @Summary      Verify one-time password
+// @Description  Checks a code; each wrong code counts against the attempt limit and a code can be used once
+// @Tags         otp
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        request body VerifyPayload true "OTP verify request"
+// @Param        Idempotency-Key header string false "Makes the request safe to retry; repeats return the first response"
+// @Success      200 {object} map[string]any
+// @Failure      400 {object} apierror.Error "invalid code"
+// @Failure      401 {object} apierror.Error "unauthenticated"
+// @Failure      404 {object} apierror.Error "no active code"
+// @Failure      410 {object} apierror.Error "code expired"
+// @Failure      429 {object} apierror.Error "too many attempts"
+// @Failure      500 {object} apierror.Error "internal error"
+// @Router       /otp/verify [post]
+func VerifyHandler(c echo.Context) error {
+	customerID, err := auth.CustomerID(c)
+	if err != nil {
+		return err
+	}
+
+	var req VerifyPayload
+	if err := json.NewDecoder(c.Request().Body).Decode(&req); err != nil {
+		app.Logger.Error("invalid input ", "err", err)
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid input")
+	}
+	if req.Recipient == "" || req.Code == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "recipient and code are required")
+	}
+
+	err = Verify(c.Request().Context(), VerifyRequest{
+		CustomerID: customerID,
+		Recipient:  req.Recipient,
+		Code:       req.Code,
+	})
+	switch {
+	case err == nil:
+	case errors.Is(err, ErrInvalidCode):
+		return apierror.New(http.StatusBadRequest, apierror.InvalidCode, err.Error())
+	case errors.Is(err, ErrNotFound):
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	case errors.Is(err, ErrExpired):
+		return apierror.New(http.StatusGone, apierror.CodeExpired, err.Error())
+	case errors.Is(err, ErrTooManyAttempts):
+		return apierror.New(http.StatusTooManyRequests, apierror.TooManyAttempts, err.Error())
+	default:
+		app.Logger.Error("otp verify", "user_id", customerID, "err", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "internal error")
+	}
+
+	return c.JSON(http.StatusOK, map[string]any{"verified": true})
+}
@@ -0,0 +1,239 @@
+package otp
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"sms-gateway/app"
+	"sms-gateway/config"
+	"sms-gateway/internal/model"
+	"sms-gateway/internal/sms"
+	"sms-gateway/pkg/metrics"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const codePlaceholder = "{code}"
+
+var (
+	ErrInvalidTemplate = errors.New("template must contain " + codePlaceholder)
+	ErrNotFound        = errors.New("no active code")
+	ErrExpired         = errors.New("code expired")
+	ErrTooManyAttempts = errors.New("too many attempts")
+	ErrInvalidCode     = errors.New("invalid code")
+	// ErrHeldForReview is returned instead of parking a code for manual review, where it
+	// would expire long before an admin decides.
+	ErrHeldForReview = errors.New("message needs manual review, which one-time codes cannot wait for")
+)
+
+// CooldownError is returned when a code was sent to the recipient too recently.
+type CooldownError struct {
+	RetryAfter time.Duration
+}
+
+func (e *CooldownError) Error() string {
+	return fmt.Sprintf("resend cooldown, retry after %s", e.RetryAfter)
+}
+
+type SendRequest struct {
+	CustomerID int64
+	Recipient  string
+	Template   string
+}
+
+type SendResult struct {
+	SmsIdentifier string `json:"sms_identifier"`
+	Status        string `json:"status"`
+	ExpiresIn     int    `json:"expires_in"`
+}
+
+// Send generates a new code for the recipient, replacing any previous one, and submits it
+// as an express SMS through sms.Send, so it is validated, counted against the customer's send
+// limits and retried on a deadlock like any other message. The code is stored in the send
+// transaction, and the outbox event is marked for redaction so the plaintext code is blanked
+// once the message is published.
+func Send(ctx context.Context, req SendRequest) (SendResult, error) {
+	tmpl := req.Template
+	if tmpl == "" {
+		tmpl = config.OTPDefaultTemplate
+	}
+	if !strings.Contains(tmpl, codePlaceholder) {
+		return SendResult{}, ErrInvalidTemplate
+	}
+
+	code, err := generateCode(config.OTPLength)
+	if err != nil {
+		return SendResult{}, err
+	}
+	salt, err := generateSalt()
+	if err != nil {
+		return SendResult{}, err
+	}
+
+	s, state, err := sms.Send(ctx, model.SMS{
+		CustomerID: req.CustomerID,
+		Text:       strings.ReplaceAll(tmpl, codePlaceholder, code),
+		Recipients: []string{req.Recipient},
+		Type:       model.EXPRESS,
+	}, func(ctx context.Context, tx *sqlx.Tx, s model.SMS) error {
+		return storeCodeTx(ctx, tx, req, s.SmsIdentifier, salt, code)
+	})
+	if err != nil {
+		return SendResult{}, err
+	}
+	return SendResult{SmsIdentifier: s.SmsIdentifier, Status: string(state), ExpiresIn: config.OTPTTLSec}, nil
+}
+
+// storeCodeTx checks the resend cooldown under the recipient's otp_codes row lock and stores
+// the new code. It fails with ErrHeldForReview for a message the content policy parked, which
+// rolls the whole send back, held_messages row included.
+func storeCodeTx(ctx context.Context, tx *sqlx.Tx, req SendRequest, smsIdentifier, salt, code string) error {
+	if err := sms.RedactTextTx(ctx, tx, smsIdentifier); err != nil {
+		if errors.Is(err, sms.ErrNotQueued) {
+			return ErrHeldForReview
+		}
+		return err
+	}
+
+	// Make sure the row exists (and is X-locked) so concurrent sends serialise on it.
+	const ensureRow = `INSERT INTO otp_codes (customer_id, recipient) VALUES (?, ?) ON DUPLICATE KEY UPDATE id = id`
+	if err := metrics.DBExecObserver("upsert_otp_code", func(c context.Context) error {
+		_, execErr := tx.ExecContext(c, ensureRow, req.CustomerID, req.Recipient)
+		return execErr
+	})(ctx); err != nil {
+		return err
+	}
+
+	const selectWait = `SELECT TIMESTAMPDIFF(SECOND, CURRENT_TIMESTAMP, last_sent_at + INTERVAL ? SECOND) FROM otp_codes WHERE customer_id = ? AND recipient = ? FOR UPDATE`
+	var wait sql.NullInt64
+	if err := metrics.DBExecObserver("select_otp_cooldown", func(c context.Context) error {
+		return tx.QueryRowxContext(c, selectWait, config.OTPResendCooldownSec, req.CustomerID, req.Recipient).Scan(&wait)
+	})(ctx); err != nil {
+		return err
+	}
+	if wait.Valid && wait.Int64 > 0 {
+		return &CooldownError{RetryAfter: time.Duration(wait.Int64) * time.Second}
+	}
+
+	const updateCode = `
+		UPDATE otp_codes
+		SET code_salt = ?, code_hash = ?, sms_identifier = ?, attempts = 0, max_attempts = ?,
+			expires_at = CURRENT_TIMESTAMP + INTERVAL ? SECOND, last_sent_at = CURRENT_TIMESTAMP, verified_at = NULL
+		WHERE customer_id = ? AND recipient = ?
+	`
+	return metrics.DBExecObserver("update_otp_code", func(c context.Context) error {
+		_, execErr := tx.ExecContext(c, updateCode, salt, hashCode(salt, code), smsIdentifier, config.OTPMaxAttempts, config.OTPTTLSec, req.CustomerID, req.Recipient)
+		return execErr
+	})(ctx)
+}
+
+type VerifyRequest struct {
+	CustomerID int64
+	Recipient  string
+	Code       string
+}
+
+// Verify checks a code under a row lock, so concurrent attempts are counted exactly
+// and a code can be consumed only once.
+func Verify(ctx context.Context, req VerifyRequest) (err error) {
+	tx, err := app.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var row struct {
+		Salt        string `db:"code_salt"`
+		Hash        string `db:"code_hash"`
+		Attempts    int    `db:"attempts"`
+		MaxAttempts int    `db:"max_attempts"`
+		Expired     bool   `db:"expired"`
+	}
+	const selectCode = `
+		SELECT code_salt, code_hash, attempts, max_attempts, expires_at <= CURRENT_TIMESTAMP AS expired
+		FROM otp_codes
+		WHERE customer_id = ? AND recipient = ? AND verified_at IS NULL
+		FOR UPDATE
+	`
+	if err = metrics.DBExecObserver("select_otp_code", func(c context.Context) error {
+		return tx.QueryRowxContext(c, selectCode, req.CustomerID, req.Recipient).StructScan(&row)
+	})(ctx); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNotFound
+		}
+		return err
+	}
+
+	switch {
+	case row.Hash == "":
+		return ErrNotFound
+	case row.Expired:
+		return ErrExpired
+	case row.Attempts >= row.MaxAttempts:
+		return ErrTooManyAttempts
+	}
+
+	if !hmac.Equal([]byte(hashCode(row.Salt, req.Code)), []byte(row.Hash)) {
+		const incAttempts = `UPDATE otp_codes SET attempts = attempts + 1 WHERE customer_id = ? AND recipient = ?`
+		if err = metrics.DBExecObserver("update_otp_attempts", func(c context.Context) error {
+			_, execErr := tx.ExecContext(c, incAttempts, req.CustomerID, req.Recipient)
+			return execErr
+		})(ctx); err != nil {
+			return err
+		}
+		if err = tx.Commit(); err != nil {
+			return err
+		}
+		return ErrInvalidCode
+	}
+
+	const markVerified = `UPDATE otp_codes SET verified_at = CURRENT_TIMESTAMP, code_hash = '' WHERE customer_id = ? AND recipient = ?`
+	if err = metrics.DBExecObserver("update_otp_verified", func(c context.Context) error {
+		_, execErr := tx.ExecContext(c, markVerified, req.CustomerID, req.Recipient)
+		return execErr
+	})(ctx); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func generateCode(length int) (string, error) {
+	if length <= 0 {
+		length = 6
+	}
+	var b strings.Builder
+	for i := 0; i < length; i++ {
+		n, err := rand.Int(rand.Reader, big.NewInt(10))
+		if err != nil {
+			return "", err
+		}
+		b.WriteByte(byte('0' + n.Int64()))
+	}
+	return b.String(), nil
+}
+
+func generateSalt() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// hashCode keys the hash with OTP_SECRET so a leaked table alone cannot be brute-forced offline.
+func hashCode(salt, code string) string {
+	mac := hmac.New(sha256.New, []byte(config.OTPSecret))
+	mac.Write([]byte(salt))
+	mac.Write([]byte(code))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,127 @@
+package otp
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"sms-gateway/app"
+	"sms-gateway/config"
+	"sms-gateway/internal/policy"
+	"sms-gateway/internal/sms"
+	"sms-gateway/testutil"
+)
+
+func TestGenerateCode(t *testing.T) {
+	code, err := generateCode(6)
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	if len(code) != 6 {
+		t.Fatalf("expected 6 digits, got %q", code)
+	}
+	for _, r := range code {
+		if r < '0' || r > '9' {
+			t.Fatalf("expected digits only, got %q", code)
+		}
+	}
+}
+
+func TestHashCode(t *testing.T) {
+	if hashCode("salt-a", "123456") == hashCode("salt-b", "123456") {
+		t.Fatalf("expected salt to change the hash")
+	}
+	if hashCode("salt-a", "123456") != hashCode("salt-a", "123456") {
+		t.Fatalf("expected deterministic hash")
+	}
+}
+
+// storeCode replaces the stored hash so tests know the plaintext code.
+func storeCode(t *testing.T, customerID int64, recipient, code string) {
+	t.Helper()
+	if _, err := app.DB.Exec(`UPDATE otp_codes SET code_salt = 's', code_hash = ? WHERE customer_id = ? AND recipient = ?`, hashCode("s", code), customerID, recipient); err != nil {
+		t.Fatalf("store code: %v", err)
+	}
+}
+
+func TestSendAndVerify(t *testing.T) {
+	ctx := testutil.EnsureSetup(t)
+	testutil.ResetTables(ctx, t)
+	if _, err := app.DB.ExecContext(ctx, "INSERT INTO user_balances (user_id, balance) VALUES (?, ?)", 21, 100); err != nil {
+		t.Fatalf("seed balance: %v", err)
+	}
+
+	if _, err := Send(ctx, SendRequest{CustomerID: 21, Recipient: "+1", Template: "code: {code}"}); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	var redacted int
+	if err := app.DB.GetContext(ctx, &redacted, "SELECT COUNT(*) FROM outbox_events WHERE event_type = 'sms.send' AND JSON_CONTAINS_PATH(payload, 'one', '$.redact')"); err != nil || redacted != 1 {
+		t.Fatalf("expected the code's outbox event marked for redaction, got %d err=%v", redacted, err)
+	}
+	var cooldown *CooldownError
+	if _, err := Send(ctx, SendRequest{CustomerID: 21, Recipient: "+1"}); !errors.As(err, &cooldown) {
+		t.Fatalf("expected cooldown, got %v", err)
+	}
+	if _, err := Send(ctx, SendRequest{CustomerID: 21, Recipient: "+2", Template: "no placeholder"}); !errors.Is(err, ErrInvalidTemplate) {
+		t.Fatalf("expected invalid template, got %v", err)
+	}
+	var re *sms.RecipientError
+	if _, err := Send(ctx, SendRequest{CustomerID: 21, Recipient: "not a number"}); !errors.As(err, &re) {
+		t.Fatalf("expected invalid recipient, got %v", err)
+	}
+	// A code cannot wait for review; nothing is stored or charged.
+	if _, err := policy.CreateRule(ctx, policy.Rule{Kind: policy.KindDomain, Pattern: "bit.ly", Action: policy.Hold}); err != nil {
+		t.Fatalf("create rule: %v", err)
+	}
+	if _, err := Send(ctx, SendRequest{CustomerID: 21, Recipient: "+3", Template: "{code} or bit.ly/x"}); !errors.Is(err, ErrHeldForReview) {
+		t.Fatalf("expected held for review, got %v", err)
+	}
+	var held int
+	if err := app.DB.GetContext(ctx, &held, "SELECT COUNT(*) FROM otp_codes WHERE customer_id = 21 AND recipient = '+3' AND code_hash <> ''"); err != nil || held != 0 {
+		t.Fatalf("expected no code for the held message, got %d err=%v", held, err)
+	}
+	if err := app.DB.GetContext(ctx, &held, "SELECT COUNT(*) FROM held_messages WHERE customer_id = 21"); err != nil || held != 0 {
+		t.Fatalf("expected no held message kept for the code, got %d err=%v", held, err)
+	}
+
+	storeCode(t, 21, "+1", "424242")
+	if err := Verify(ctx, VerifyRequest{CustomerID: 21, Recipient: "+1", Code: "000000"}); !errors.Is(err, ErrInvalidCode) {
+		t.Fatalf("expected invalid code, got %v", err)
+	}
+	if err := Verify(ctx, VerifyRequest{CustomerID: 21, Recipient: "+1", Code: "424242"}); err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if err := Verify(ctx, VerifyRequest{CustomerID: 21, Recipient: "+1", Code: "424242"}); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected code to be consumed, got %v", err)
+	}
+}
+
+func TestVerify_ConcurrentAttempts(t *testing.T) {
+	ctx := testutil.EnsureSetup(t)
+	testutil.ResetTables(ctx, t)
+	if _, err := app.DB.ExecContext(ctx, "INSERT INTO user_balances (user_id, balance) VALUES (?, ?)", 22, 100); err != nil {
+		t.Fatalf("seed balance: %v", err)
+	}
+	if _, err := Send(ctx, SendRequest{CustomerID: 22, Recipient: "+1"}); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	storeCode(t, 22, "+1", "111111")
+
+	var wg sync.WaitGroup
+	for i := 0; i < config.OTPMaxAttempts*2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = Verify(ctx, VerifyRequest{CustomerID: 22, Recipient: "+1", Code: "999999"})
+		}()
+	}
+	wg.Wait()
+
+	if err := Verify(ctx, VerifyRequest{CustomerID: 22, Recipient: "+1", Code: "111111"}); !errors.Is(err, ErrTooManyAttempts) {
+		t.Fatalf("expected attempt limit, got %v", err)
+	}
+	var attempts int
+	if err := app.DB.GetContext(ctx, &attempts, "SELECT attempts FROM otp_codes WHERE customer_id = 22"); err != nil || attempts != config.OTPMaxAttempts {
+		t.Fatalf("expected %d attempts, got %d err=%v", config.OTPMaxAttempts, attempts, err)
+	}
+}
@@ -0,0 +1,116 @@
+package policy
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"sms-gateway/app"
+
+	"github.com/labstack/echo/v4"
+)
+
+// CreateRulePayload represents the request body for creating a content rule.
+type CreateRulePayload struct {
+	CustomerID int64    `json:"customer_id"`
+	Kind       RuleKind `json:"kind"`
+	Pattern    string   `json:"pattern"`
+	Action     Action   `json:"action"`
+}
+
+// ListRulesHandler godoc
+// @Summary      List content rules
+// @Description  Returns global and per-customer content-policy rules
+// @Tags         admin
+// @Produce      json
+// @Security     AdminAuth
+// @Param        customer_id query string false "Only rules of this customer (0 for global)"
+// @Success      200 {object} map[string]any
+// @Failure      400 {object} apierror.Error "invalid customer_id"
+// @Failure      401 {object} apierror.Error "unauthenticated"
+// @Failure      500 {object} apierror.Error "internal error"
+// @Router       /admin/content-rules [get]
+func ListRulesHandler(c echo.Context) error {
+	var customerID *int64
+	if v := c.QueryParam("customer_id"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid customer_id")
+		}
+		customerID = &id
+	}
+
+	rules, err := ListRules(c.Request().Context(), customerID)
+	if err != nil {
+		app.Logger.Error("list content rules", "err", err)
+		return err
+	}
+
+	out := map[string]any{}
+	out["rules"] = rules
+
+	return c.JSON(http.StatusOK, out)
+}
+
+// CreateRuleHandler godoc
+// @Summary      Create content rule
+// @Description  Adds a keyword, regex or URL domain rule; customer_id 0 makes it global
+// @Tags         admin
+// @Accept       json
+// @Produce      json
+// @Security     AdminAuth
+// @Param        request body CreateRulePayload true "Content rule"
+// @Success      200 {object} Rule
+// @Failure      400 {object} apierror.Error "invalid input"
+// @Failure      401 {object} apierror.Error "unauthenticated"
+// @Failure      500 {object} apierror.Error "internal error"
+// @Router       /admin/content-rules [post]
+func CreateRuleHandler(c echo.Context) error {
+	var req CreateRulePayload
+	if err := json.NewDecoder(c.Request().Body).Decode(&req); err != nil {
+		app.Logger.Error("invalid input ", "err", err)
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid input")
+	}
+
+	rule, err := CreateRule(c.Request().Context(), Rule{
+		CustomerID: req.CustomerID,
+		Kind:       req.Kind,
+		Pattern:    req.Pattern,
+		Action:     req.Action,
+	})
+	if err != nil {
+		if errors.Is(err, ErrInvalidRule) {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		app.Logger.Error("create content rule", "err", err)
+		return err
+	}
+
+	return c.JSON(http.StatusOK, rule)
+}
+
+// DeleteRuleHandler godoc
+// @Summary      Delete content rule
+// @Tags         admin
+// @Produce      json
+// @Security     AdminAuth
+// @Param        id path int true "Rule ID"
+// @Success      200 {string} string "done"
+// @Failure      400 {object} apierror.Error "invalid id"
+// @Failure      401 {object} apierror.Error "unauthenticated"
+// @Failure      500 {object} apierror.Error "internal error"
+// @Router       /admin/content-rules/{id} [delete]
+func DeleteRuleHandler(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid id")
+	}
+
+	if err := DeleteRule(c.Request().Context(), id); err != nil {
+		app.Logger.Error("delete content rule", "id", id, "err", err)
+		return err
+	}
+
+	return c.JSON(http.StatusOK, "done")
+}
@@ -0,0 +1,344 @@
+package policy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"sms-gateway/app"
+	"sms-gateway/config"
+	"sms-gateway/internal/model"
+	"sms-gateway/pkg/metrics"
+)
+
+type Action string
+
+const (
+	Allow Action = "allow"
+	Hold  Action = "hold"
+	Block Action = "block"
+)
+
+type RuleKind string
+
+const (
+	// KindKeyword matches a case-insensitive substring of the text.
+	KindKeyword RuleKind = "keyword"
+	// KindRegex matches a regular expression against the text.
+	KindRegex RuleKind = "regex"
+	// KindDomain matches the host of every URL in the text (including subdomains).
+	KindDomain RuleKind = "domain"
+)
+
+var ErrInvalidRule = errors.New("invalid content rule")
+
+// Rule is a single content-policy rule. CustomerID 0 means the rule is global;
+// a customer's own rules override global ones.
+type Rule struct {
+	ID         int64    `db:"id" json:"id"`
+	CustomerID int64    `db:"customer_id" json:"customer_id"`
+	Kind       RuleKind `db:"kind" json:"kind"`
+	Pattern    string   `db:"pattern" json:"pattern"`
+	Action     Action   `db:"action" json:"action"`
+	CreatedAt  string   `db:"created_at" json:"created_at"`
+
+	re *regexp.Regexp
+}
+
+// Decision is the outcome of evaluating a message.
+type Decision struct {
+	Action Action `json:"action"`
+	RuleID int64  `json:"rule_id,omitempty"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// Stage is a pluggable content-policy check run before charging.
+type Stage interface {
+	Evaluate(ctx context.Context, s model.SMS) (Decision, error)
+}
+
+var (
+	stagesMu sync.RWMutex
+	stages   = []Stage{RuleStage{}}
+)
+
+// Use appends a stage to the policy chain.
+func Use(stage Stage) {
+	stagesMu.Lock()
+	defer stagesMu.Unlock()
+	stages = append(stages, stage)
+}
+
+// Evaluate runs every stage and returns the most severe decision.
+func Evaluate(ctx context.Context, s model.SMS) (Decision, error) {
+	stagesMu.RLock()
+	chain := append([]Stage(nil), stages...)
+	stagesMu.RUnlock()
+
+	out := Decision{Action: Allow}
+	for _, stage := range chain {
+		d, err := stage.Evaluate(ctx, s)
+		if err != nil {
+			return Decision{}, err
+		}
+		if severity(d.Action) > severity(out.Action) {
+			out = d
+		}
+	}
+	return out, nil
+}
+
+// RuleStage evaluates the keyword/regex/domain rules stored in content_rules.
+type RuleStage struct{}
+
+func (RuleStage) Evaluate(ctx context.Context, s model.SMS) (Decision, error) {
+	rules, err := cachedRules(ctx)
+	if err != nil {
+		return Decision{}, err
+	}
+	return evaluateRules(rules, s.CustomerID, s.Text, Action(config.ContentUnlistedURLAction)), nil
+}
+
+// evaluateRules is the pure part of RuleStage.
+// Text rules: when any of the customer's own rules match, only those count; otherwise global matches apply.
+// URL rules: every URL host is resolved against customer domain rules first, then global ones;
+// hosts matching no rule get unlistedURL.
+func evaluateRules(rules []Rule, customerID int64, text string, unlistedURL Action) Decision {
+	var customerText, globalText, customerDomain, globalDomain []Rule
+	for _, r := range rules {
+		if r.CustomerID != 0 && r.CustomerID != customerID {
+			continue
+		}
+		own := r.CustomerID == customerID && customerID != 0
+		switch r.Kind {
+		case KindDomain:
+			if own {
+				customerDomain = append(customerDomain, r)
+			} else {
+				globalDomain = append(globalDomain, r)
+			}
+		default:
+			if own {
+				customerText = append(customerText, r)
+			} else {
+				globalText = append(globalText, r)
+			}
+		}
+	}
+
+	out := Decision{Action: Allow}
+	consider := func(d Decision) {
+		if severity(d.Action) > severity(out.Action) {
+			out = d
+		}
+	}
+
+	if d, ok := matchText(customerText, text); ok {
+		consider(d)
+	} else if d, ok := matchText(globalText, text); ok {
+		consider(d)
+	}
+
+	for _, host := range extractHosts(text) {
+		if d, ok := matchDomain(customerDomain, host); ok {
+			consider(d)
+		} else if d, ok := matchDomain(globalDomain, host); ok {
+			consider(d)
+		} else if unlistedURL != "" && unlistedURL != Allow {
+			consider(Decision{Action: unlistedURL, Reason: fmt.Sprintf("unlisted url domain %s", host)})
+		}
+	}
+
+	return out
+}
+
+// matchText returns the most severe matching text rule.
+func matchText(rules []Rule, text string) (Decision, bool) {
+	lower := strings.ToLower(text)
+	var best Decision
+	matched := false
+	for _, r := range rules {
+		hit := false
+		switch r.Kind {
+		case KindKeyword:
+			hit = strings.Contains(lower, strings.ToLower(r.Pattern))
+		case KindRegex:
+			hit = r.re != nil && r.re.MatchString(text)
+		}
+		if hit && (!matched || severity(r.Action) > severity(best.Action)) {
+			best = Decision{Action: r.Action, RuleID: r.ID, Reason: fmt.Sprintf("%s rule %q matched", r.Kind, r.Pattern)}
+			matched = true
+		}
+	}
+	return best, matched
+}
+
+// matchDomain returns the most severe domain rule matching host.
+func matchDomain(rules []Rule, host string) (Decision, bool) {
+	var best Decision
+	matched := false
+	for _, r := range rules {
+		p := strings.ToLower(r.Pattern)
+		if host != p && !strings.HasSuffix(host, "."+p) {
+			continue
+		}
+		if !matched || severity(r.Action) > severity(best.Action) {
+			best = Decision{Action: r.Action, RuleID: r.ID, Reason: fmt.Sprintf("url domain %s matched %q", host, r.Pattern)}
+			matched = true
+		}
+	}
+	return best, matched
+}
+
+var urlPattern = regexp.MustCompile(`(?i)\b((?:https?://|www\.)[^\s]+|[a-z0-9][a-z0-9-]*(?:\.[a-z0-9-]+)*\.[a-z]{2,}(?:/[^\s]*)?)`)
+
+// extractHosts returns the lower-cased hosts of URL-looking tokens in text.
+func extractHosts(text string) []string {
+	var hosts []string
+	for _, m := range urlPattern.FindAllString(text, -1) {
+		raw := strings.TrimRight(m, ".,;:!?)'\"")
+		if !strings.Contains(strings.ToLower(raw), "://") {
+			raw = "http://" + raw
+		}
+		u, err := url.Parse(raw)
+		if err != nil || u.Hostname() == "" {
+			continue
+		}
+		hosts = append(hosts, strings.ToLower(u.Hostname()))
+	}
+	return hosts
+}
+
+func severity(a Action) int {
+	switch a {
+	case Block:
+		return 2
+	case Hold:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// Validate checks a rule and compiles its pattern.
+func (r *Rule) Validate() error {
+	if strings.TrimSpace(r.Pattern) == "" {
+		return fmt.Errorf("%w: pattern is required", ErrInvalidRule)
+	}
+	switch r.Action {
+	case Allow, Hold, Block:
+	default:
+		return fmt.Errorf("%w: unknown action %q", ErrInvalidRule, r.Action)
+	}
+	switch r.Kind {
+	case KindKeyword, KindDomain:
+	case KindRegex:
+		re, err := regexp.Compile(r.Pattern)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidRule, err)
+		}
+		r.re = re
+	default:
+		return fmt.Errorf("%w: unknown kind %q", ErrInvalidRule, r.Kind)
+	}
+	return nil
+}
+
+var (
+	cacheMu       sync.Mutex
+	cache         []Rule
+	cacheLoadedAt time.Time
+)
+
+func cachedRules(ctx context.Context) ([]Rule, error) {
+	cacheMu.Lock()
+	defer cacheMu.Unlock()
+
+	ttl := time.Duration(config.ContentRulesCacheTTLSec) * time.Second
+	if cache != nil && time.Since(cacheLoadedAt) < ttl {
+		return cache, nil
+	}
+
+	rules, err := ListRules(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	compiled := make([]Rule, 0, len(rules))
+	for _, r := range rules {
+		if err := r.Validate(); err != nil {
+			app.Logger.Error("skip invalid content rule", "id", r.ID, "err", err)
+			continue
+		}
+		compiled = append(compiled, r)
+	}
+	cache = compiled
+	cacheLoadedAt = time.Now()
+	return cache, nil
+}
+
+func invalidateCache() {
+	cacheMu.Lock()
+	defer cacheMu.Unlock()
+	cache = nil
+}
+
+// ListRules returns all rules, or only the given customer's rules when customerID is set.
+func ListRules(ctx context.Context, customerID *int64) ([]Rule, error) {
+	query := `SELECT id, customer_id, kind, pattern, action, created_at FROM content_rules`
+	var args []any
+	if customerID != nil {
+		query += ` WHERE customer_id = ?`
+		args = append(args, *customerID)
+	}
+	query += ` ORDER BY id`
+
+	var rules []Rule
+	queryFn := metrics.DBExecObserver("select_content_rules", func(c context.Context) error {
+		return app.DB.SelectContext(c, &rules, query, args...)
+	})
+	if err := queryFn(ctx); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+func CreateRule(ctx context.Context, r Rule) (Rule, error) {
+	if err := r.Validate(); err != nil {
+		return Rule{}, err
+	}
+
+	const query = `INSERT INTO content_rules (customer_id, kind, pattern, action) VALUES (?, ?, ?, ?)`
+	var id int64
+	execFn := metrics.DBExecObserver("insert_content_rule", func(c context.Context) error {
+		res, err := app.DB.ExecContext(c, query, r.CustomerID, r.Kind, r.Pattern, r.Action)
+		if err != nil {
+			return err
+		}
+		id, err = res.LastInsertId()
+		return err
+	})
+	if err := execFn(ctx); err != nil {
+		return Rule{}, err
+	}
+
+	invalidateCache()
+	r.ID = id
+	return r, nil
+}
+
+func DeleteRule(ctx context.Context, id int64) error {
+	execFn := metrics.DBExecObserver("delete_content_rule", func(c context.Context) error {
+		_, err := app.DB.ExecContext(c, `DELETE FROM content_rules WHERE id = ?`, id)
+		return err
+	})
+	if err := execFn(ctx); err != nil {
+		return err
+	}
+	invalidateCache()
+	return nil
+}
@@ -0,0 +1,92 @@
+package policy
+
+import (
+	"testing"
+)
+
+func mustRules(t *testing.T, rules ...Rule) []Rule {
+	t.Helper()
+	for i := range rules {
+		if err := rules[i].Validate(); err != nil {
+			t.Fatalf("validate rule %+v: %v", rules[i], err)
+		}
+	}
+	return rules
+}
+
+func TestEvaluateRules_Keyword(t *testing.T) {
+	rules := mustRules(t,
+		Rule{ID: 1, Kind: KindKeyword, Pattern: "Verify your account", Action: Block},
+	)
+	d := evaluateRules(rules, 7, "Please VERIFY YOUR ACCOUNT now", Allow)
+	if d.Action != Block || d.RuleID != 1 {
+		t.Fatalf("expected block by rule 1, got %+v", d)
+	}
+	d = evaluateRules(rules, 7, "your code is 1234", Allow)
+	if d.Action != Allow {
+		t.Fatalf("expected allow, got %+v", d)
+	}
+}
+
+func TestEvaluateRules_RegexHold(t *testing.T) {
+	rules := mustRules(t,
+		Rule{ID: 2, Kind: KindRegex, Pattern: `(?i)bank\s+card`, Action: Hold},
+	)
+	d := evaluateRules(rules, 7, "send your Bank  Card number", Allow)
+	if d.Action != Hold || d.RuleID != 2 {
+		t.Fatalf("expected hold by rule 2, got %+v", d)
+	}
+}
+
+func TestEvaluateRules_CustomerOverride(t *testing.T) {
+	rules := mustRules(t,
+		Rule{ID: 1, Kind: KindKeyword, Pattern: "password", Action: Block},
+		Rule{ID: 2, CustomerID: 7, Kind: KindKeyword, Pattern: "password", Action: Allow},
+	)
+	if d := evaluateRules(rules, 7, "reset your password", Allow); d.Action != Allow {
+		t.Fatalf("expected customer override to allow, got %+v", d)
+	}
+	if d := evaluateRules(rules, 8, "reset your password", Allow); d.Action != Block {
+		t.Fatalf("expected global block for other customer, got %+v", d)
+	}
+}
+
+func TestEvaluateRules_Domains(t *testing.T) {
+	rules := mustRules(t,
+		Rule{ID: 1, Kind: KindDomain, Pattern: "evil.example", Action: Block},
+		Rule{ID: 2, Kind: KindDomain, Pattern: "shop.ir", Action: Allow},
+	)
+	if d := evaluateRules(rules, 1, "login at https://secure.evil.example/login", Allow); d.Action != Block {
+		t.Fatalf("expected subdomain block, got %+v", d)
+	}
+	if d := evaluateRules(rules, 1, "order at www.shop.ir/orders", Hold); d.Action != Allow {
+		t.Fatalf("expected allow-listed domain, got %+v", d)
+	}
+	if d := evaluateRules(rules, 1, "see bit.ly/x1", Hold); d.Action != Hold {
+		t.Fatalf("expected unlisted domain hold, got %+v", d)
+	}
+	if d := evaluateRules(rules, 1, "see bit.ly/x1", Allow); d.Action != Allow {
+		t.Fatalf("expected unlisted domain allow, got %+v", d)
+	}
+}
+
+func TestExtractHosts(t *testing.T) {
+	hosts := extractHosts("Visit HTTPS://A.Example.com/path, or www.test.org. Code 12.50")
+	if len(hosts) != 2 || hosts[0] != "a.example.com" || hosts[1] != "www.test.org" {
+		t.Fatalf("unexpected hosts %v", hosts)
+	}
+}
+
+func TestRuleValidate(t *testing.T) {
+	cases := []Rule{
+		{Kind: KindKeyword, Pattern: "", Action: Block},
+		{Kind: "unknown", Pattern: "x", Action: Block},
+		{Kind: KindKeyword, Pattern: "x", Action: "drop"},
+		{Kind: KindRegex, Pattern: "(", Action: Block},
+	}
+	for _, r := range cases {
+		if err := r.Validate(); err == nil {
+			t.Fatalf("expected invalid rule %+v", r)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package pricing
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"sms-gateway/app"
+	"sms-gateway/internal/model"
+
+	"github.com/labstack/echo/v4"
+)
+
+// CreatePricePayload represents the request body for adding a price list row.
+type CreatePricePayload struct {
+	CustomerID        int64      `json:"customer_id"`
+	Type              model.Type `json:"type"`
+	DestinationPrefix string     `json:"destination_prefix"`
+	MinVolume         int        `json:"min_volume"`
+	Price             int64      `json:"price"`
+	EffectiveFrom     *time.Time `json:"effective_from"`
+}
+
+// ListPricesHandler godoc
+// @Summary      List prices
+// @Description  Returns the default price list and per-customer overrides
+// @Tags         admin
+// @Produce      json
+// @Security     AdminAuth
+// @Param        customer_id query string false "Only rows of this customer (0 for the default list)"
+// @Success      200 {object} map[string]any
+// @Failure      400 {object} apierror.Error "invalid customer_id"
+// @Failure      401 {object} apierror.Error "unauthenticated"
+// @Failure      500 {object} apierror.Error "internal error"
+// @Router       /admin/prices [get]
+func ListPricesHandler(c echo.Context) error {
+	var customerID *int64
+	if v := c.QueryParam("customer_id"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid customer_id")
+		}
+		customerID = &id
+	}
+
+	prices, err := ListPrices(c.Request().Context(), customerID)
+	if err != nil {
+		app.Logger.Error("list prices", "err", err)
+		return err
+	}
+
+	out := map[string]any{}
+	out["prices"] = prices
+
+	return c.JSON(http.StatusOK, out)
+}
+
+// CreatePriceHandler godoc
+// @Summary      Add price
+// @Description  Adds a price row; rows are immutable, so a change is a new row with a later effective_from
+// @Tags         admin
+// @Accept       json
+// @Produce      json
+// @Security     AdminAuth
+// @Param        request body CreatePricePayload true "Price row"
+// @Success      200 {object} Price
+// @Failure      400 {object} apierror.Error "invalid input"
+// @Failure      401 {object} apierror.Error "unauthenticated"
+// @Failure      500 {object} apierror.Error "internal error"
+// @Router       /admin/prices [post]
+func CreatePriceHandler(c echo.Context) error {
+	var req CreatePricePayload
+	if err := json.NewDecoder(c.Request().Body).Decode(&req); err != nil {
+		app.Logger.Error("invalid input ", "err", err)
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid input")
+	}
+
+	p := Price{
+		CustomerID:        req.CustomerID,
+		Type:              req.Type,
+		DestinationPrefix: req.DestinationPrefix,
+		MinVolume:         req.MinVolume,
+		Price:             req.Price,
+	}
+	if req.EffectiveFrom != nil {
+		p.EffectiveFrom = *req.EffectiveFrom
+	}
+
+	p, err := CreatePrice(c.Request().Context(), p)
+	if err != nil {
+		if errors.Is(err, ErrInvalidPrice) {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		app.Logger.Error("create price", "err", err)
+		return err
+	}
+
+	return c.JSON(http.StatusOK, p)
+}
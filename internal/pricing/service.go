@@ -0,0 +1,282 @@
+package pricing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"sms-gateway/app"
+	"sms-gateway/config"
+	"sms-gateway/internal/model"
+	"sms-gateway/pkg/metrics"
+)
+
+// BuiltinVersion is recorded when no price row matched and the built-in defaults were used.
+const BuiltinVersion = "builtin"
+
+var ErrInvalidPrice = errors.New("invalid price")
+
+// Price is one immutable price list row. CustomerID 0 is the default list; a row applies to
+// recipients starting with DestinationPrefix ("" matches all), to requests of at least MinVolume
+// messages, from EffectiveFrom on. Changes are made by adding rows, so a row ID identifies
+// exactly what a customer was charged.
+type Price struct {
+	ID                int64      `db:"id" json:"id"`
+	CustomerID        int64      `db:"customer_id" json:"customer_id"`
+	Type              model.Type `db:"type" json:"type"`
+	DestinationPrefix string     `db:"destination_prefix" json:"destination_prefix"`
+	MinVolume         int        `db:"min_volume" json:"min_volume"`
+	Price             int64      `db:"price" json:"price"`
+	EffectiveFrom     time.Time  `db:"effective_from" json:"effective_from"`
+}
+
+// Line is the price applied to a single recipient.
+type Line struct {
+	Recipient         string `json:"recipient"`
+	PriceID           int64  `json:"price_id"`
+	DestinationPrefix string `json:"destination_prefix"`
+	Price             int64  `json:"price"`
+}
+
+type Quote struct {
+	Total   int64  `json:"total"`
+	Version string `json:"version"`
+	Lines   []Line `json:"lines"`
+}
+
+type QuoteRequest struct {
+	CustomerID int64
+	Type       model.Type
+	// Recipients are priced one by one; when empty, Quantity messages are priced without a destination.
+	Recipients []string
+	Quantity   int
+}
+
+// Get prices a request using the cached price list.
+func Get(ctx context.Context, req QuoteRequest) (Quote, error) {
+	prices, err := cachedPrices(ctx)
+	if err != nil {
+		return Quote{}, err
+	}
+	return quote(prices, req, time.Now()), nil
+}
+
+func quote(prices []Price, req QuoteRequest, now time.Time) Quote {
+	volume := len(req.Recipients)
+	if volume == 0 {
+		volume = req.Quantity
+	}
+
+	recipients := req.Recipients
+	if len(recipients) == 0 {
+		recipients = make([]string, req.Quantity)
+	}
+
+	out := Quote{Lines: make([]Line, 0, len(recipients))}
+	versions := map[string]struct{}{}
+	for _, r := range recipients {
+		line := Line{Recipient: r}
+		if p, ok := resolve(prices, req.CustomerID, req.Type, r, volume, now); ok {
+			line.PriceID = p.ID
+			line.DestinationPrefix = p.DestinationPrefix
+			line.Price = p.Price
+			versions[strconv.FormatInt(p.ID, 10)] = struct{}{}
+		} else {
+			line.Price = builtinPrice(req.Type)
+			versions[BuiltinVersion] = struct{}{}
+		}
+		out.Total += line.Price
+		out.Lines = append(out.Lines, line)
+	}
+
+	ids := make([]string, 0, len(versions))
+	for v := range versions {
+		ids = append(ids, v)
+	}
+	sort.Strings(ids)
+	out.Version = strings.Join(ids, ",")
+	return out
+}
+
+// resolve picks the row for one recipient: customer override over default list,
+// then longest destination prefix, then highest volume tier, then latest effective row.
+func resolve(prices []Price, customerID int64, t model.Type, recipient string, volume int, now time.Time) (Price, bool) {
+	dest := normalize(recipient)
+	var best Price
+	found := false
+	for _, p := range prices {
+		if p.Type != t || p.EffectiveFrom.After(now) || p.MinVolume > volume {
+			continue
+		}
+		if p.CustomerID != 0 && p.CustomerID != customerID {
+			continue
+		}
+		if !strings.HasPrefix(dest, normalize(p.DestinationPrefix)) {
+			continue
+		}
+		if !found || better(p, best) {
+			best = p
+			found = true
+		}
+	}
+	return best, found
+}
+
+// HighestPrice returns the most customerID pays at time at for a message of type t to a
+// destination under prefix in a request of at least minVolume messages. Volume tiers and
+// longer prefixes only change the price at row boundaries, so those are the points checked.
+func HighestPrice(ctx context.Context, customerID int64, t model.Type, prefix string, minVolume int, at time.Time) (int64, error) {
+	prices, err := cachedPrices(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return highestPrice(prices, customerID, t, prefix, minVolume, at), nil
+}
+
+func highestPrice(prices []Price, customerID int64, t model.Type, prefix string, minVolume int, at time.Time) int64 {
+	prefix = normalize(prefix)
+	dests := []string{prefix}
+	volumes := []int{minVolume}
+	for _, p := range prices {
+		if p.Type != t || p.EffectiveFrom.After(at) || (p.CustomerID != 0 && p.CustomerID != customerID) {
+			continue
+		}
+		if d := normalize(p.DestinationPrefix); len(d) > len(prefix) && strings.HasPrefix(d, prefix) {
+			dests = append(dests, d)
+		}
+		if p.MinVolume > minVolume {
+			volumes = append(volumes, p.MinVolume)
+		}
+	}
+
+	var highest int64
+	for _, d := range dests {
+		for _, v := range volumes {
+			price := builtinPrice(t)
+			if p, ok := resolve(prices, customerID, t, d, v, at); ok {
+				price = p.Price
+			}
+			highest = max(highest, price)
+		}
+	}
+	return highest
+}
+
+func better(a, b Price) bool {
+	if (a.CustomerID != 0) != (b.CustomerID != 0) {
+		return a.CustomerID != 0
+	}
+	// Rows written before prefixes were normalized on insert may still carry "+" or "00".
+	if la, lb := len(normalize(a.DestinationPrefix)), len(normalize(b.DestinationPrefix)); la != lb {
+		return la > lb
+	}
+	if a.MinVolume != b.MinVolume {
+		return a.MinVolume > b.MinVolume
+	}
+	if !a.EffectiveFrom.Equal(b.EffectiveFrom) {
+		return a.EffectiveFrom.After(b.EffectiveFrom)
+	}
+	return a.ID > b.ID
+}
+
+func normalize(number string) string {
+	n := strings.TrimSpace(number)
+	n = strings.TrimPrefix(n, "+")
+	return strings.TrimPrefix(n, "00")
+}
+
+// builtinPrice is used when the price list has no matching row.
+func builtinPrice(t model.Type) int64 {
+	if t == model.EXPRESS {
+		return 3
+	}
+	return 1
+}
+
+var (
+	cacheMu       sync.Mutex
+	cache         []Price
+	cacheLoadedAt time.Time
+)
+
+func cachedPrices(ctx context.Context) ([]Price, error) {
+	cacheMu.Lock()
+	defer cacheMu.Unlock()
+
+	ttl := time.Duration(config.PricingCacheTTLSec) * time.Second
+	if cache != nil && time.Since(cacheLoadedAt) < ttl {
+		return cache, nil
+	}
+
+	prices, err := ListPrices(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	if prices == nil {
+		prices = []Price{}
+	}
+	cache = prices
+	cacheLoadedAt = time.Now()
+	return cache, nil
+}
+
+func invalidateCache() {
+	cacheMu.Lock()
+	defer cacheMu.Unlock()
+	cache = nil
+}
+
+// ListPrices returns all rows, or only the given customer's rows (0 for the default list).
+func ListPrices(ctx context.Context, customerID *int64) ([]Price, error) {
+	query := `SELECT id, customer_id, type, destination_prefix, min_volume, price, effective_from FROM prices`
+	var args []any
+	if customerID != nil {
+		query += ` WHERE customer_id = ?`
+		args = append(args, *customerID)
+	}
+	query += ` ORDER BY customer_id, type, destination_prefix, min_volume, effective_from`
+
+	var prices []Price
+	queryFn := metrics.DBExecObserver("select_prices", func(c context.Context) error {
+		return app.DB.SelectContext(c, &prices, query, args...)
+	})
+	if err := queryFn(ctx); err != nil {
+		return nil, err
+	}
+	return prices, nil
+}
+
+func CreatePrice(ctx context.Context, p Price) (Price, error) {
+	if p.Type != model.NORMAL && p.Type != model.EXPRESS {
+		return Price{}, fmt.Errorf("%w: unknown type %q", ErrInvalidPrice, p.Type)
+	}
+	if p.Price < 0 || p.MinVolume < 0 {
+		return Price{}, fmt.Errorf("%w: price and min_volume must not be negative", ErrInvalidPrice)
+	}
+	if p.EffectiveFrom.IsZero() {
+		p.EffectiveFrom = time.Now()
+	}
+	// Stored the way recipients are matched, so "+98", "0098" and "98" are the same prefix.
+	p.DestinationPrefix = normalize(p.DestinationPrefix)
+
+	const query = `INSERT INTO prices (customer_id, type, destination_prefix, min_volume, price, effective_from) VALUES (?, ?, ?, ?, ?, ?)`
+	execFn := metrics.DBExecObserver("insert_price", func(c context.Context) error {
+		res, err := app.DB.ExecContext(c, query, p.CustomerID, p.Type, p.DestinationPrefix, p.MinVolume, p.Price, p.EffectiveFrom)
+		if err != nil {
+			return err
+		}
+		p.ID, err = res.LastInsertId()
+		return err
+	})
+	if err := execFn(ctx); err != nil {
+		return Price{}, err
+	}
+
+	invalidateCache()
+	return p, nil
+}
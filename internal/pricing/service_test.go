@@ -0,0 +1,109 @@
+package pricing
+
+import (
+	"testing"
+	"time"
+
+	"sms-gateway/internal/model"
+)
+
+func TestQuote_Builtin(t *testing.T) {
+	now := time.Now()
+	if q := quote(nil, QuoteRequest{Type: model.EXPRESS, Quantity: 2}, now); q.Total != 6 || q.Version != BuiltinVersion {
+		t.Fatalf("expected express builtin 6, got %+v", q)
+	}
+	if q := quote(nil, QuoteRequest{Type: model.NORMAL, Quantity: 3}, now); q.Total != 3 || q.Version != BuiltinVersion {
+		t.Fatalf("expected normal builtin 3, got %+v", q)
+	}
+}
+
+func TestQuote_Resolution(t *testing.T) {
+	now := time.Now()
+	past := now.Add(-time.Hour)
+	prices := []Price{
+		{ID: 1, Type: model.NORMAL, Price: 10, EffectiveFrom: past},
+		{ID: 2, Type: model.NORMAL, DestinationPrefix: "98912", Price: 8, EffectiveFrom: past},
+		{ID: 3, Type: model.NORMAL, MinVolume: 100, Price: 5, EffectiveFrom: past},
+		{ID: 4, CustomerID: 7, Type: model.NORMAL, Price: 6, EffectiveFrom: past},
+		{ID: 5, Type: model.NORMAL, Price: 12, EffectiveFrom: now.Add(time.Hour)},
+		{ID: 6, Type: model.NORMAL, Price: 11, EffectiveFrom: past.Add(time.Minute)},
+	}
+
+	q := quote(prices, QuoteRequest{CustomerID: 1, Type: model.NORMAL, Recipients: []string{"+989121234567", "+14155550100"}}, now)
+	if q.Total != 8+11 || q.Version != "2,6" {
+		t.Fatalf("expected prefix price 8 + latest default 11 (version 2,6), got %+v", q)
+	}
+	if q.Lines[0].DestinationPrefix != "98912" {
+		t.Fatalf("expected matched prefix on line, got %+v", q.Lines[0])
+	}
+
+	q = quote(prices, QuoteRequest{CustomerID: 1, Type: model.NORMAL, Quantity: 100}, now)
+	if q.Total != 500 || q.Version != "3" {
+		t.Fatalf("expected volume tier 5 x 100, got total=%d version=%s", q.Total, q.Version)
+	}
+
+	q = quote(prices, QuoteRequest{CustomerID: 7, Type: model.NORMAL, Recipients: []string{"00989121234567"}}, now)
+	if q.Total != 6 || q.Version != "4" {
+		t.Fatalf("expected customer override 6, got %+v", q)
+	}
+
+	q = quote(prices, QuoteRequest{CustomerID: 1, Type: model.EXPRESS, Quantity: 1}, now)
+	if q.Total != 3 || q.Version != BuiltinVersion {
+		t.Fatalf("expected builtin express fallback, got %+v", q)
+	}
+}
+
+func TestQuote_PrefixLengthIgnoresInternationalPrefix(t *testing.T) {
+	past := time.Now().Add(-time.Hour)
+	prices := []Price{
+		{ID: 1, Type: model.NORMAL, DestinationPrefix: "+98", Price: 9, EffectiveFrom: past},
+		{ID: 2, Type: model.NORMAL, DestinationPrefix: "9891", Price: 7, EffectiveFrom: past},
+		{ID: 3, Type: model.NORMAL, DestinationPrefix: "00989", Price: 8, EffectiveFrom: past},
+	}
+	q := quote(prices, QuoteRequest{CustomerID: 1, Type: model.NORMAL, Recipients: []string{"+989121234567"}}, time.Now())
+	if q.Total != 7 || q.Version != "2" {
+		t.Fatalf("expected the longest normalized prefix 9891, got %+v", q)
+	}
+}
+
+func TestHighestPrice(t *testing.T) {
+	now := time.Now()
+	past := now.Add(-time.Hour)
+	prices := []Price{
+		{ID: 1, Type: model.NORMAL, Price: 10, EffectiveFrom: past},
+		{ID: 2, Type: model.NORMAL, DestinationPrefix: "98912", Price: 14, EffectiveFrom: past},
+		{ID: 3, Type: model.NORMAL, MinVolume: 100, Price: 5, EffectiveFrom: past},
+		{ID: 4, CustomerID: 7, Type: model.NORMAL, Price: 6, EffectiveFrom: past},
+		{ID: 5, Type: model.NORMAL, DestinationPrefix: "44", Price: 20, EffectiveFrom: now.Add(time.Hour)},
+	}
+
+	cases := []struct {
+		name       string
+		customerID int64
+		prefix     string
+		minVolume  int
+		at         time.Time
+		want       int64
+	}{
+		{name: "longer prefix costs more", customerID: 1, want: 14},
+		{name: "outside the longer prefix", customerID: 1, prefix: "+1", want: 10},
+		{name: "volume tier", customerID: 1, prefix: "1", minVolume: 100, want: 5},
+		{name: "customer override", customerID: 7, prefix: "98", want: 6},
+		{name: "future row", customerID: 1, prefix: "44", at: now.Add(2 * time.Hour), want: 20},
+		{name: "row not yet effective", customerID: 1, prefix: "44", want: 10},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			at := tc.at
+			if at.IsZero() {
+				at = now
+			}
+			if got := highestPrice(prices, tc.customerID, model.NORMAL, tc.prefix, tc.minVolume, at); got != tc.want {
+				t.Fatalf("got %d, want %d", got, tc.want)
+			}
+		})
+	}
+	if got := highestPrice(nil, 1, model.EXPRESS, "", 0, now); got != 3 {
+		t.Fatalf("expected builtin express 3, got %d", got)
+	}
+}
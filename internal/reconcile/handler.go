@@ -0,0 +1,145 @@
+package reconcile
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"sms-gateway/app"
+	"sms-gateway/config"
+	"sms-gateway/internal/auth"
+
+	"github.com/labstack/echo/v4"
+)
+
+// ApprovePayload represents the request body for approving a drift correction.
+type ApprovePayload struct {
+	// Actor is replaced by the name of the admin key behind the request.
+	Actor string `json:"actor"`
+}
+
+// RunHandler godoc
+// @Summary      Run balance reconciliation
+// @Description  Compares every balance with the sum of its transactions and records the drift
+// @Tags         admin
+// @Produce      json
+// @Security     AdminAuth
+// @Success      200 {object} Run
+// @Failure      401 {object} apierror.Error "unauthenticated"
+// @Failure      409 {object} apierror.Error "another reconciliation run is in progress"
+// @Failure      500 {object} apierror.Error "internal error"
+// @Router       /admin/reconciliation/runs [post]
+func RunHandler(c echo.Context) error {
+	run, err := Reconcile(c.Request().Context(), TriggerAPI, config.ReconcileBatchSize)
+	if err != nil {
+		if errors.Is(err, ErrRunInProgress) {
+			return echo.NewHTTPError(http.StatusConflict, err.Error())
+		}
+		app.Logger.Error("reconcile", "err", err)
+		return err
+	}
+
+	return c.JSON(http.StatusOK, run)
+}
+
+// ListRunsHandler godoc
+// @Summary      List reconciliation runs
+// @Tags         admin
+// @Produce      json
+// @Security     AdminAuth
+// @Param        limit query int false "Max rows (default 50)"
+// @Success      200 {object} map[string]any
+// @Failure      401 {object} apierror.Error "unauthenticated"
+// @Failure      500 {object} apierror.Error "internal error"
+// @Router       /admin/reconciliation/runs [get]
+func ListRunsHandler(c echo.Context) error {
+	limit := 50
+	if v, err := strconv.Atoi(c.QueryParam("limit")); err == nil && v > 0 && v <= 500 {
+		limit = v
+	}
+
+	runs, err := ListRuns(c.Request().Context(), limit)
+	if err != nil {
+		app.Logger.Error("list reconciliation runs", "err", err)
+		return err
+	}
+
+	out := map[string]any{}
+	out["runs"] = runs
+
+	return c.JSON(http.StatusOK, out)
+}
+
+// ListDriftsHandler godoc
+// @Summary      List drifts of a reconciliation run
+// @Tags         admin
+// @Produce      json
+// @Security     AdminAuth
+// @Param        id path int true "Run ID"
+// @Success      200 {object} map[string]any
+// @Failure      400 {object} apierror.Error "invalid id"
+// @Failure      401 {object} apierror.Error "unauthenticated"
+// @Failure      500 {object} apierror.Error "internal error"
+// @Router       /admin/reconciliation/runs/{id}/drifts [get]
+func ListDriftsHandler(c echo.Context) error {
+	runID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid id")
+	}
+
+	drifts, err := ListDrifts(c.Request().Context(), runID)
+	if err != nil {
+		app.Logger.Error("list reconciliation drifts", "run_id", runID, "err", err)
+		return err
+	}
+
+	out := map[string]any{}
+	out["drifts"] = drifts
+
+	return c.JSON(http.StatusOK, out)
+}
+
+// ApproveDriftHandler godoc
+// @Summary      Approve drift correction
+// @Description  Writes a corrective transaction so the user's transactions sum up to the balance again
+// @Tags         admin
+// @Accept       json
+// @Produce      json
+// @Security     AdminAuth
+// @Param        id path int true "Drift ID"
+// @Param        request body ApprovePayload false "Approver"
+// @Success      200 {object} Drift
+// @Failure      400 {object} apierror.Error "invalid input"
+// @Failure      401 {object} apierror.Error "unauthenticated"
+// @Failure      404 {object} apierror.Error "drift not found or already resolved"
+// @Failure      500 {object} apierror.Error "internal error"
+// @Router       /admin/reconciliation/drifts/{id}/approve [post]
+func ApproveDriftHandler(c echo.Context) error {
+	driftID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid id")
+	}
+
+	var req ApprovePayload
+	if c.Request().ContentLength != 0 {
+		if err := json.NewDecoder(c.Request().Body).Decode(&req); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid input")
+		}
+	}
+	actor := auth.Actor(c, req.Actor)
+	if actor == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid input")
+	}
+
+	d, err := ApproveDrift(c.Request().Context(), driftID, actor)
+	if err != nil {
+		if errors.Is(err, ErrDriftNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, err.Error())
+		}
+		app.Logger.Error("approve drift", "drift_id", driftID, "err", err)
+		return err
+	}
+
+	return c.JSON(http.StatusOK, d)
+}
@@ -0,0 +1,340 @@
+package reconcile
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"sms-gateway/app"
+	"sms-gateway/internal/balance"
+	"sms-gateway/internal/ledger"
+	"sms-gateway/pkg/metrics"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type Trigger string
+
+const (
+	TriggerWorker Trigger = "worker"
+	TriggerCLI    Trigger = "cli"
+	TriggerAPI    Trigger = "api"
+)
+
+type runStatus string
+
+const (
+	RunRunning   runStatus = "running"
+	RunCompleted runStatus = "completed"
+	RunFailed    runStatus = "failed"
+)
+
+type driftStatus string
+
+const (
+	DriftOpen      driftStatus = "open"
+	DriftCorrected driftStatus = "corrected"
+	DriftResolved  driftStatus = "resolved"
+)
+
+// lockName serialises runs across API instances and the CLI.
+const lockName = "sms_gateway_reconcile"
+
+var (
+	ErrRunInProgress = errors.New("another reconciliation run is in progress")
+	ErrDriftNotFound = errors.New("drift not found or already resolved")
+)
+
+type Run struct {
+	ID           int64     `db:"id" json:"id"`
+	Trigger      Trigger   `db:"trigger_source" json:"trigger"`
+	Status       runStatus `db:"status" json:"status"`
+	UsersChecked int64     `db:"users_checked" json:"users_checked"`
+	DriftCount   int64     `db:"drift_count" json:"drift_count"`
+	DriftTotal   int64     `db:"drift_total" json:"drift_total"`
+	Error        *string   `db:"error" json:"error,omitempty"`
+	StartedAt    string    `db:"started_at" json:"started_at"`
+	FinishedAt   *string   `db:"finished_at" json:"finished_at"`
+}
+
+// Drift is a user whose balance differs from the sum of their transactions or from their
+// ledger wallet. Drift = Balance - TransactionsSum, LedgerDrift = Balance - LedgerSum.
+type Drift struct {
+	ID                      int64       `db:"id" json:"id"`
+	RunID                   int64       `db:"run_id" json:"run_id"`
+	UserID                  int64       `db:"user_id" json:"user_id"`
+	Balance                 int64       `db:"balance" json:"balance"`
+	TransactionsSum         int64       `db:"transactions_sum" json:"transactions_sum"`
+	Drift                   int64       `db:"drift" json:"drift"`
+	LedgerSum               int64       `db:"ledger_sum" json:"ledger_sum"`
+	LedgerDrift             int64       `db:"ledger_drift" json:"ledger_drift"`
+	Status                  driftStatus `db:"status" json:"status"`
+	CorrectiveTransactionID *string     `db:"corrective_transaction_id" json:"corrective_transaction_id"`
+	ApprovedBy              *string     `db:"approved_by" json:"approved_by"`
+	CreatedAt               string      `db:"created_at" json:"created_at"`
+}
+
+type userSum struct {
+	UserID          int64 `db:"user_id"`
+	Balance         int64 `db:"balance"`
+	TransactionsSum int64 `db:"transactions_sum"`
+	LedgerSum       int64 `db:"ledger_sum"`
+}
+
+// findDrifts returns the rows whose balance does not match their transactions or ledger wallet.
+func findDrifts(rows []userSum) []userSum {
+	var out []userSum
+	for _, r := range rows {
+		if r.Balance != r.TransactionsSum || r.Balance != r.LedgerSum {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// StartWorker runs Reconcile every interval until ctx is done.
+func StartWorker(ctx context.Context, interval time.Duration, batchSize int) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		if _, err := Reconcile(ctx, TriggerWorker, batchSize); err != nil && !errors.Is(err, ErrRunInProgress) {
+			app.Logger.Error("reconciliation run", "err", err)
+		}
+	}
+}
+
+// Reconcile compares user_balances.balance (plus the user's balance shards) with
+// SUM(user_transactions.amount) and with the user's ledger wallet for every user, in batches of
+// batchSize users, and stores the run and every drift found.
+func Reconcile(ctx context.Context, trigger Trigger, batchSize int) (_ Run, err error) {
+	if batchSize <= 0 {
+		batchSize = 500
+	}
+
+	conn, err := app.DB.Connx(ctx)
+	if err != nil {
+		return Run{}, err
+	}
+	defer conn.Close()
+
+	var locked sql.NullInt64
+	if err := conn.QueryRowxContext(ctx, `SELECT GET_LOCK(?, 0)`, lockName).Scan(&locked); err != nil {
+		return Run{}, err
+	}
+	if !locked.Valid || locked.Int64 != 1 {
+		return Run{}, ErrRunInProgress
+	}
+	defer func() { _, _ = conn.ExecContext(context.Background(), `SELECT RELEASE_LOCK(?)`, lockName) }()
+
+	res, err := app.DB.ExecContext(ctx, `INSERT INTO reconciliation_runs (trigger_source, status) VALUES (?, ?)`, trigger, RunRunning)
+	if err != nil {
+		return Run{}, err
+	}
+	runID, err := res.LastInsertId()
+	if err != nil {
+		return Run{}, err
+	}
+
+	var checked, driftCount, driftTotal int64
+	defer func() {
+		status, result := RunCompleted, "success"
+		var errText any
+		if err != nil {
+			status, result, errText = RunFailed, "error", err.Error()
+		}
+		metrics.ReconcileRun(result, int(driftCount), driftTotal)
+		_, _ = app.DB.ExecContext(context.Background(),
+			`UPDATE reconciliation_runs SET status = ?, users_checked = ?, drift_count = ?, drift_total = ?, error = ?, finished_at = CURRENT_TIMESTAMP WHERE id = ?`,
+			status, checked, driftCount, driftTotal, errText, runID)
+	}()
+
+	var after int64
+	for {
+		rows, err := sumBatch(ctx, after, batchSize)
+		if err != nil {
+			return Run{}, err
+		}
+		if len(rows) == 0 {
+			break
+		}
+		checked += int64(len(rows))
+		after = rows[len(rows)-1].UserID
+
+		for _, d := range findDrifts(rows) {
+			drift, ledgerDrift := d.Balance-d.TransactionsSum, d.Balance-d.LedgerSum
+			driftCount++
+			driftTotal += abs(drift) + abs(ledgerDrift)
+			app.Logger.Warn("balance drift", "run_id", runID, "user_id", d.UserID, "balance", d.Balance, "transactions_sum", d.TransactionsSum, "ledger_sum", d.LedgerSum)
+			if _, err := app.DB.ExecContext(ctx,
+				`INSERT INTO reconciliation_drifts (run_id, user_id, balance, transactions_sum, drift, ledger_sum, ledger_drift) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+				runID, d.UserID, d.Balance, d.TransactionsSum, drift, d.LedgerSum, ledgerDrift); err != nil {
+				return Run{}, err
+			}
+		}
+
+		if len(rows) < batchSize {
+			break
+		}
+	}
+
+	app.Logger.Info("reconciliation finished", "run_id", runID, "users_checked", checked, "drift_count", driftCount, "drift_total", driftTotal)
+	return Run{ID: runID, Trigger: trigger, Status: RunCompleted, UsersChecked: checked, DriftCount: driftCount, DriftTotal: driftTotal}, nil
+}
+
+// sumBatch reads one batch inside a read-only REPEATABLE READ transaction, so each balance is
+// compared with the transactions and ledger entries that existed at the same snapshot.
+func sumBatch(ctx context.Context, afterUserID int64, limit int) ([]userSum, error) {
+	tx, err := app.DB.BeginTxx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	const q = `
+		SELECT b.user_id,
+		       b.balance + COALESCE((SELECT SUM(s.balance) FROM balance_shards s WHERE s.user_id = b.user_id), 0) AS balance,
+		       COALESCE((SELECT SUM(t.amount) FROM user_transactions t WHERE t.user_id = b.user_id), 0) AS transactions_sum,
+		       COALESCE((
+		           SELECT SUM(e.amount)
+		           FROM ledger_accounts a
+		           JOIN ledger_entries e ON e.account_id = a.id
+		           WHERE a.code = CONCAT('wallet:', b.user_id)
+		       ), 0) AS ledger_sum
+		FROM user_balances b
+		WHERE b.user_id > ?
+		ORDER BY b.user_id
+		LIMIT ?
+	`
+	var rows []userSum
+	queryFn := metrics.DBExecObserver("select_reconcile_batch", func(c context.Context) error {
+		return tx.SelectContext(c, &rows, q, afterUserID, limit)
+	})
+	if err := queryFn(ctx); err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+func ListRuns(ctx context.Context, limit int) ([]Run, error) {
+	const q = `SELECT id, trigger_source, status, users_checked, drift_count, drift_total, error, started_at, finished_at FROM reconciliation_runs ORDER BY id DESC LIMIT ?`
+	var out []Run
+	queryFn := metrics.DBExecObserver("select_reconciliation_runs", func(c context.Context) error {
+		return app.DB.SelectContext(c, &out, q, limit)
+	})
+	if err := queryFn(ctx); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func ListDrifts(ctx context.Context, runID int64) ([]Drift, error) {
+	const q = `SELECT id, run_id, user_id, balance, transactions_sum, drift, ledger_sum, ledger_drift, status, corrective_transaction_id, approved_by, created_at FROM reconciliation_drifts WHERE run_id = ? ORDER BY user_id`
+	var out []Drift
+	queryFn := metrics.DBExecObserver("select_reconciliation_drifts", func(c context.Context) error {
+		return app.DB.SelectContext(c, &out, q, runID)
+	})
+	if err := queryFn(ctx); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ApproveDrift writes a corrective transaction and/or a correction journal for an open drift,
+// so that the user's transactions and ledger wallet sum up to their balance again. The drift is recomputed under the balance row
+// lock; if it has meanwhile disappeared nothing is written and the drift is just resolved.
+func ApproveDrift(ctx context.Context, driftID int64, actor string) (_ Drift, err error) {
+	tx, err := app.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return Drift{}, err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	var d Drift
+	const selectQ = `SELECT id, run_id, user_id, balance, transactions_sum, drift, ledger_sum, ledger_drift, status, corrective_transaction_id, approved_by, created_at FROM reconciliation_drifts WHERE id = ? AND status = ? FOR UPDATE`
+	if err = tx.GetContext(ctx, &d, selectQ, driftID, DriftOpen); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Drift{}, ErrDriftNotFound
+		}
+		return Drift{}, err
+	}
+
+	current, currentLedger, err := currentDriftTx(ctx, tx, d.UserID)
+	if err != nil {
+		return Drift{}, err
+	}
+
+	status := DriftResolved
+	var correctiveTxID *string
+	if current != 0 {
+		desc := fmt.Sprintf("تراکنش اصلاحی مغایرت‌گیری %d", d.RunID)
+		id, err := balance.InsertCorrectionTx(ctx, tx, d.UserID, current, desc)
+		if err != nil {
+			return Drift{}, err
+		}
+		status, correctiveTxID = DriftCorrected, &id
+	}
+	if currentLedger != 0 {
+		ref := fmt.Sprintf("reconcile:%d", d.ID)
+		if err = ledger.PostTx(ctx, tx, ledger.Transfer(ledger.JournalCorrection, ref, d.UserID, ledger.Corrections, ledger.WalletAccount(d.UserID), currentLedger)); err != nil {
+			return Drift{}, err
+		}
+		status = DriftCorrected
+	}
+
+	const updateQ = `UPDATE reconciliation_drifts SET status = ?, corrective_transaction_id = ?, approved_by = ?, resolved_at = CURRENT_TIMESTAMP WHERE id = ?`
+	if _, err = tx.ExecContext(ctx, updateQ, status, correctiveTxID, actor, d.ID); err != nil {
+		return Drift{}, err
+	}
+	if err = tx.Commit(); err != nil {
+		return Drift{}, err
+	}
+
+	app.Logger.Info("reconciliation drift approved", "drift_id", d.ID, "user_id", d.UserID, "correction", current, "actor", actor)
+	d.Status, d.CorrectiveTransactionID, d.ApprovedBy = status, correctiveTxID, &actor
+	return d, nil
+}
+
+func currentDriftTx(ctx context.Context, tx *sqlx.Tx, userID int64) (int64, int64, error) {
+	var bal int64
+	if err := tx.QueryRowxContext(ctx, `SELECT balance FROM user_balances WHERE user_id = ? FOR UPDATE`, userID).Scan(&bal); err != nil {
+		return 0, 0, err
+	}
+	// Balance shards are locked after the user_balances row, in the order every writer uses.
+	var shards []int64
+	if err := tx.SelectContext(ctx, &shards, `SELECT balance FROM balance_shards WHERE user_id = ? ORDER BY shard FOR UPDATE`, userID); err != nil {
+		return 0, 0, err
+	}
+	for _, s := range shards {
+		bal += s
+	}
+	var sum int64
+	if err := tx.QueryRowxContext(ctx, `SELECT COALESCE(SUM(amount), 0) FROM user_transactions WHERE user_id = ?`, userID).Scan(&sum); err != nil {
+		return 0, 0, err
+	}
+	var ledgerSum int64
+	const ledgerQ = `SELECT COALESCE(SUM(e.amount), 0) FROM ledger_accounts a JOIN ledger_entries e ON e.account_id = a.id WHERE a.code = ?`
+	if err := tx.QueryRowxContext(ctx, ledgerQ, ledger.WalletAccount(userID)).Scan(&ledgerSum); err != nil {
+		return 0, 0, err
+	}
+	return bal - sum, bal - ledgerSum, nil
+}
+
+func abs(v int64) int64 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
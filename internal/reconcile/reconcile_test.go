@@ -0,0 +1,69 @@
+package reconcile
+
+import (
+	"errors"
+	"testing"
+
+	"sms-gateway/app"
+	"sms-gateway/internal/balance"
+	"sms-gateway/testutil"
+)
+
+func TestFindDrifts(t *testing.T) {
+	rows := []userSum{
+		{UserID: 1, Balance: 10, TransactionsSum: 10, LedgerSum: 10},
+		{UserID: 2, Balance: 7, TransactionsSum: 10, LedgerSum: 7},
+		{UserID: 3, Balance: 0, TransactionsSum: 0, LedgerSum: 0},
+		{UserID: 4, Balance: 5, TransactionsSum: 5, LedgerSum: 0},
+	}
+	got := findDrifts(rows)
+	if len(got) != 2 || got[0].UserID != 2 || got[1].UserID != 4 {
+		t.Fatalf("unexpected drifts %+v", got)
+	}
+}
+
+func TestReconcileAndApprove(t *testing.T) {
+	ctx := testutil.EnsureSetup(t)
+	testutil.ResetTables(ctx, t)
+
+	// User 1 is consistent; user 2's balance was edited by hand from 10 to 7.
+	for _, id := range []int64{1, 2} {
+		if _, err := balance.AddBalance(ctx, balance.AddBalanceRequest{CustomerID: id, Amount: 10}); err != nil {
+			t.Fatalf("seed balance: %v", err)
+		}
+	}
+	seed := []string{
+		"INSERT INTO user_balances (user_id, balance) VALUES (3, 0)",
+		"UPDATE user_balances SET balance = 7 WHERE user_id = 2",
+	}
+	for _, q := range seed {
+		if _, err := app.DB.ExecContext(ctx, q); err != nil {
+			t.Fatalf("seed: %v", err)
+		}
+	}
+
+	run, err := Reconcile(ctx, TriggerCLI, 2)
+	if err != nil {
+		t.Fatalf("reconcile: %v", err)
+	}
+	if run.UsersChecked != 3 || run.DriftCount != 1 || run.DriftTotal != 6 {
+		t.Fatalf("unexpected run %+v", run)
+	}
+	drifts, err := ListDrifts(ctx, run.ID)
+	if err != nil || len(drifts) != 1 || drifts[0].UserID != 2 || drifts[0].Drift != -3 || drifts[0].LedgerDrift != -3 {
+		t.Fatalf("unexpected drifts %+v err=%v", drifts, err)
+	}
+
+	d, err := ApproveDrift(ctx, drifts[0].ID, "alice")
+	if err != nil || d.Status != DriftCorrected || d.CorrectiveTransactionID == nil {
+		t.Fatalf("approve: %+v err=%v", d, err)
+	}
+	if _, err := ApproveDrift(ctx, drifts[0].ID, "alice"); !errors.Is(err, ErrDriftNotFound) {
+		t.Fatalf("expected second approval to fail, got %v", err)
+	}
+
+	run, err = Reconcile(ctx, TriggerCLI, 2)
+	if err != nil || run.DriftCount != 0 {
+		t.Fatalf("expected no drift after correction, got %+v err=%v", run, err)
+	}
+}
@@ -0,0 +1,272 @@
+package smppapi
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"sms-gateway/app"
+	"sms-gateway/internal/auth"
+	"sms-gateway/pkg/metrics"
+)
+
+// SMPP limits system_id to 15 and password to 8 characters.
+const (
+	maxSystemIDLen = 15
+	passwordLen    = 8
+)
+
+const passwordAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz23456789"
+
+var (
+	ErrInvalidAccount  = errors.New("invalid smpp account")
+	ErrAccountNotFound = errors.New("smpp account not found")
+	ErrInvalidSystemID = errors.New("unknown system_id")
+	ErrInvalidPassword = errors.New("invalid password")
+)
+
+// Account is an SMPP login of a customer with the limits of each of its binds. Only a salted
+// SHA-256 of the password is stored.
+type Account struct {
+	SystemID   string    `db:"system_id" json:"system_id"`
+	CustomerID int64     `db:"customer_id" json:"customer_id"`
+	MaxTPS     int       `db:"max_tps" json:"max_tps"`
+	WindowSize int       `db:"window_size" json:"window_size"`
+	CreatedAt  time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt  time.Time `db:"updated_at" json:"updated_at"`
+}
+
+// IssuedAccount is an account with a new password, which is returned once.
+type IssuedAccount struct {
+	Account
+	Password string `json:"password,omitempty"`
+}
+
+type accountRow struct {
+	Account
+	PasswordSalt string `db:"password_salt"`
+	PasswordHash string `db:"password_hash"`
+}
+
+func hashPassword(salt, password string) string {
+	sum := sha256.Sum256([]byte(salt + password))
+	return hex.EncodeToString(sum[:])
+}
+
+func newPassword() (string, error) {
+	// Bytes at or above limit are dropped so every character is equally likely.
+	limit := 256 - 256%len(passwordAlphabet)
+	out := make([]byte, 0, passwordLen)
+	b := make([]byte, 2*passwordLen)
+	for len(out) < passwordLen {
+		if _, err := rand.Read(b); err != nil {
+			return "", err
+		}
+		for _, c := range b {
+			if int(c) < limit && len(out) < passwordLen {
+				out = append(out, passwordAlphabet[int(c)%len(passwordAlphabet)])
+			}
+		}
+	}
+	return string(out), nil
+}
+
+func newSalt() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// SetAccount creates the account a.SystemID for a.CustomerID with a generated password, or
+// changes the limits of an existing one, which keeps its customer and password. Zero limits
+// are an error.
+func SetAccount(ctx context.Context, a Account) (_ IssuedAccount, err error) {
+	if a.SystemID == "" || len(a.SystemID) > maxSystemIDLen || a.CustomerID <= 0 || a.MaxTPS <= 0 || a.WindowSize <= 0 {
+		return IssuedAccount{}, ErrInvalidAccount
+	}
+
+	tx, err := app.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return IssuedAccount{}, err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	var existing []Account
+	if err = metrics.DBExecObserver("select_smpp_account_for_update", func(c context.Context) error {
+		return tx.SelectContext(c, &existing, `SELECT system_id, customer_id, max_tps, window_size, created_at, updated_at FROM smpp_accounts WHERE system_id = ? FOR UPDATE`, a.SystemID)
+	})(ctx); err != nil {
+		return IssuedAccount{}, err
+	}
+
+	var out IssuedAccount
+	if len(existing) > 0 {
+		if existing[0].CustomerID != a.CustomerID {
+			err = ErrInvalidAccount
+			return IssuedAccount{}, err
+		}
+		if err = metrics.DBExecObserver("update_smpp_account", func(c context.Context) error {
+			_, err := tx.ExecContext(c, `UPDATE smpp_accounts SET max_tps = ?, window_size = ? WHERE system_id = ?`, a.MaxTPS, a.WindowSize, a.SystemID)
+			return err
+		})(ctx); err != nil {
+			return IssuedAccount{}, err
+		}
+	} else {
+		var exists bool
+		if err = metrics.DBExecObserver("select_customer_exists", func(c context.Context) error {
+			return tx.GetContext(c, &exists, `SELECT EXISTS(SELECT 1 FROM customers WHERE id = ?)`, a.CustomerID)
+		})(ctx); err != nil {
+			return IssuedAccount{}, err
+		}
+		if !exists {
+			err = auth.ErrCustomerNotFound
+			return IssuedAccount{}, err
+		}
+
+		if out.Password, err = newPassword(); err != nil {
+			return IssuedAccount{}, err
+		}
+		var salt string
+		if salt, err = newSalt(); err != nil {
+			return IssuedAccount{}, err
+		}
+		const q = `
+			INSERT INTO smpp_accounts (system_id, customer_id, password_salt, password_hash, max_tps, window_size)
+			VALUES (?, ?, ?, ?, ?, ?)
+		`
+		if err = metrics.DBExecObserver("insert_smpp_account", func(c context.Context) error {
+			_, err := tx.ExecContext(c, q, a.SystemID, a.CustomerID, salt, hashPassword(salt, out.Password), a.MaxTPS, a.WindowSize)
+			return err
+		})(ctx); err != nil {
+			return IssuedAccount{}, err
+		}
+	}
+
+	if err = metrics.DBExecObserver("select_smpp_account", func(c context.Context) error {
+		return tx.GetContext(c, &out.Account, `SELECT system_id, customer_id, max_tps, window_size, created_at, updated_at FROM smpp_accounts WHERE system_id = ?`, a.SystemID)
+	})(ctx); err != nil {
+		return IssuedAccount{}, err
+	}
+	if err = tx.Commit(); err != nil {
+		return IssuedAccount{}, err
+	}
+	return out, nil
+}
+
+// ResetPassword gives an account a new generated password. Open binds stay up.
+func ResetPassword(ctx context.Context, systemID string) (IssuedAccount, error) {
+	password, err := newPassword()
+	if err != nil {
+		return IssuedAccount{}, err
+	}
+	salt, err := newSalt()
+	if err != nil {
+		return IssuedAccount{}, err
+	}
+
+	var n int64
+	execFn := metrics.DBExecObserver("update_smpp_account_password", func(c context.Context) error {
+		res, err := app.DB.ExecContext(c, `UPDATE smpp_accounts SET password_salt = ?, password_hash = ? WHERE system_id = ?`, salt, hashPassword(salt, password), systemID)
+		if err != nil {
+			return err
+		}
+		n, err = res.RowsAffected()
+		return err
+	})
+	if err := execFn(ctx); err != nil {
+		return IssuedAccount{}, err
+	}
+	if n == 0 {
+		return IssuedAccount{}, ErrAccountNotFound
+	}
+
+	a, err := getAccount(ctx, systemID)
+	if err != nil {
+		return IssuedAccount{}, err
+	}
+	return IssuedAccount{Account: a.Account, Password: password}, nil
+}
+
+// ListAccounts lists the accounts of a customer, or all of them when customerID is 0.
+func ListAccounts(ctx context.Context, customerID int64) ([]Account, error) {
+	query := `SELECT system_id, customer_id, max_tps, window_size, created_at, updated_at FROM smpp_accounts`
+	var args []any
+	if customerID > 0 {
+		query += ` WHERE customer_id = ?`
+		args = append(args, customerID)
+	}
+	query += ` ORDER BY system_id`
+
+	out := []Account{}
+	queryFn := metrics.DBExecObserver("select_smpp_accounts", func(c context.Context) error {
+		return app.DB.SelectContext(c, &out, query, args...)
+	})
+	if err := queryFn(ctx); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// DeleteAccount deletes an account. Open binds stay up until they unbind.
+func DeleteAccount(ctx context.Context, systemID string) error {
+	var n int64
+	execFn := metrics.DBExecObserver("delete_smpp_account", func(c context.Context) error {
+		res, err := app.DB.ExecContext(c, `DELETE FROM smpp_accounts WHERE system_id = ?`, systemID)
+		if err != nil {
+			return err
+		}
+		n, err = res.RowsAffected()
+		return err
+	})
+	if err := execFn(ctx); err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrAccountNotFound
+	}
+	return nil
+}
+
+// Authenticate returns the account of a bind's system_id and password.
+func Authenticate(ctx context.Context, systemID, password string) (Account, error) {
+	a, err := getAccount(ctx, systemID)
+	if err != nil {
+		if errors.Is(err, ErrAccountNotFound) {
+			return Account{}, ErrInvalidSystemID
+		}
+		return Account{}, err
+	}
+	if subtle.ConstantTimeCompare([]byte(hashPassword(a.PasswordSalt, password)), []byte(a.PasswordHash)) != 1 {
+		return Account{}, ErrInvalidPassword
+	}
+	return a.Account, nil
+}
+
+func getAccount(ctx context.Context, systemID string) (accountRow, error) {
+	const q = `
+		SELECT system_id, customer_id, password_salt, password_hash, max_tps, window_size, created_at, updated_at
+		FROM smpp_accounts
+		WHERE system_id = ?
+	`
+	var a accountRow
+	queryFn := metrics.DBExecObserver("select_smpp_account", func(c context.Context) error {
+		return app.DB.GetContext(c, &a, q, systemID)
+	})
+	if err := queryFn(ctx); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return accountRow{}, ErrAccountNotFound
+		}
+		return accountRow{}, err
+	}
+	return a, nil
+}
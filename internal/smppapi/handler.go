@@ -0,0 +1,144 @@
+package smppapi
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"sms-gateway/app"
+	"sms-gateway/internal/auth"
+
+	"github.com/labstack/echo/v4"
+)
+
+// AccountPayload is the body of PUT /admin/smpp-accounts/{system_id}.
+type AccountPayload struct {
+	CustomerID int64 `json:"customer_id" example:"42"`
+	MaxTPS     int   `json:"max_tps" example:"50"`
+	WindowSize int   `json:"window_size" example:"10"`
+}
+
+// ListAccountsHandler godoc
+// @Summary      List SMPP accounts
+// @Tags         admin
+// @Produce      json
+// @Security     AdminAuth
+// @Param        customer_id query int false "Only this customer's accounts"
+// @Success      200 {object} map[string]any
+// @Failure      400 {object} apierror.Error "invalid customer_id"
+// @Failure      401 {object} apierror.Error "unauthenticated"
+// @Failure      500 {object} apierror.Error "internal error"
+// @Router       /admin/smpp-accounts [get]
+func ListAccountsHandler(c echo.Context) error {
+	var customerID int64
+	if v := c.QueryParam("customer_id"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || id <= 0 {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid customer_id")
+		}
+		customerID = id
+	}
+
+	accounts, err := ListAccounts(c.Request().Context(), customerID)
+	if err != nil {
+		app.Logger.Error("list smpp accounts", "err", err)
+		return err
+	}
+
+	out := map[string]any{}
+	out["accounts"] = accounts
+
+	return c.JSON(http.StatusOK, out)
+}
+
+// SetAccountHandler godoc
+// @Summary      Create or update an SMPP account
+// @Description  Creates the account with a generated password, which is only returned here, or changes the throughput (submit_sm per second) and window of an existing one. Limits apply to each bind, from its next bind on
+// @Tags         admin
+// @Accept       json
+// @Produce      json
+// @Security     AdminAuth
+// @Param        system_id path string true "SMPP system_id (up to 15 characters)"
+// @Param        request body AccountPayload true "Account"
+// @Success      200 {object} IssuedAccount
+// @Failure      400 {object} apierror.Error "invalid input"
+// @Failure      401 {object} apierror.Error "unauthenticated"
+// @Failure      404 {object} apierror.Error "customer not found"
+// @Failure      500 {object} apierror.Error "internal error"
+// @Router       /admin/smpp-accounts/{system_id} [put]
+func SetAccountHandler(c echo.Context) error {
+	var req AccountPayload
+	if err := json.NewDecoder(c.Request().Body).Decode(&req); err != nil {
+		app.Logger.Error("invalid input ", "err", err)
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid input")
+	}
+
+	a, err := SetAccount(c.Request().Context(), Account{
+		SystemID:   c.Param("system_id"),
+		CustomerID: req.CustomerID,
+		MaxTPS:     req.MaxTPS,
+		WindowSize: req.WindowSize,
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrInvalidAccount):
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		case errors.Is(err, auth.ErrCustomerNotFound):
+			return echo.NewHTTPError(http.StatusNotFound, err.Error())
+		}
+		app.Logger.Error("set smpp account", "system_id", c.Param("system_id"), "err", err)
+		return err
+	}
+
+	return c.JSON(http.StatusOK, a)
+}
+
+// ResetPasswordHandler godoc
+// @Summary      Reset an SMPP account's password
+// @Description  Generates a new password, which is only returned here. Open binds stay up
+// @Tags         admin
+// @Produce      json
+// @Security     AdminAuth
+// @Param        system_id path string true "SMPP system_id"
+// @Success      200 {object} IssuedAccount
+// @Failure      401 {object} apierror.Error "unauthenticated"
+// @Failure      404 {object} apierror.Error "smpp account not found"
+// @Failure      500 {object} apierror.Error "internal error"
+// @Router       /admin/smpp-accounts/{system_id}/password [post]
+func ResetPasswordHandler(c echo.Context) error {
+	a, err := ResetPassword(c.Request().Context(), c.Param("system_id"))
+	if err != nil {
+		if errors.Is(err, ErrAccountNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, err.Error())
+		}
+		app.Logger.Error("reset smpp password", "system_id", c.Param("system_id"), "err", err)
+		return err
+	}
+
+	return c.JSON(http.StatusOK, a)
+}
+
+// DeleteAccountHandler godoc
+// @Summary      Delete an SMPP account
+// @Description  Open binds stay up until they unbind
+// @Tags         admin
+// @Produce      json
+// @Security     AdminAuth
+// @Param        system_id path string true "SMPP system_id"
+// @Success      200 {string} string "done"
+// @Failure      401 {object} apierror.Error "unauthenticated"
+// @Failure      404 {object} apierror.Error "smpp account not found"
+// @Failure      500 {object} apierror.Error "internal error"
+// @Router       /admin/smpp-accounts/{system_id} [delete]
+func DeleteAccountHandler(c echo.Context) error {
+	if err := DeleteAccount(c.Request().Context(), c.Param("system_id")); err != nil {
+		if errors.Is(err, ErrAccountNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, err.Error())
+		}
+		app.Logger.Error("delete smpp account", "system_id", c.Param("system_id"), "err", err)
+		return err
+	}
+
+	return c.JSON(http.StatusOK, "done")
+}
@@ -0,0 +1,41 @@
+package smppapi
+
+import (
+	"sync"
+	"time"
+)
+
+// limiter is a token bucket holding up to one second of rate.
+type limiter struct {
+	mu     sync.Mutex
+	rate   float64
+	tokens float64
+	last   time.Time
+	now    func() time.Time
+}
+
+func newLimiter(perSecond int) *limiter {
+	return &limiter{
+		rate:   float64(perSecond),
+		tokens: float64(perSecond),
+		last:   time.Now(),
+		now:    time.Now,
+	}
+}
+
+// allow takes a token if one is left.
+func (l *limiter) allow() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.rate {
+		l.tokens = l.rate
+	}
+	l.last = now
+	if l.tokens < 1 {
+		return false
+	}
+	l.tokens--
+	return true
+}
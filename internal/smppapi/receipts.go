@@ -0,0 +1,393 @@
+package smppapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"sms-gateway/app"
+	"sms-gateway/internal/sms"
+	"sms-gateway/pkg/metrics"
+	"sms-gateway/pkg/smpp"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	scanBatchSize    = 500
+	receiptBatchSize = 100
+	idleSleep        = 500 * time.Millisecond
+	maxAttempts      = 10
+	purgeBatchSize   = 1000
+
+	// settleDelay is how old a status event must be before it is scanned; see the Kannel DLR
+	// dispatcher, which reads the same events.
+	settleDelay = 2 * time.Second
+
+	// receiptLease is how long a claimed receipt is left to its deliver_sm before another
+	// instance may send it again.
+	receiptLease = 2 * respTimeout
+
+	// receiptOnFailure is the registered_delivery asking for receipts of failures only; 1 asks
+	// for all of them.
+	receiptOnFailure = 2
+
+	// receiptTimeLayout is YYMMDDhhmm, the date format of receipt texts.
+	receiptTimeLayout = "0601021504"
+)
+
+// message is a message submitted over SMPP with registered_delivery set.
+type message struct {
+	SmsIdentifier      string `db:"sms_identifier"`
+	CustomerID         int64  `db:"customer_id"`
+	SystemID           string `db:"system_id"`
+	SourceAddr         string `db:"source_addr"`
+	RegisteredDelivery int    `db:"registered_delivery"`
+}
+
+func insertMessageTx(ctx context.Context, tx *sqlx.Tx, m message) error {
+	const q = `
+		INSERT INTO smpp_messages (sms_identifier, customer_id, system_id, source_addr, registered_delivery)
+		VALUES (:sms_identifier, :customer_id, :system_id, :source_addr, :registered_delivery)
+	`
+	execFn := metrics.DBExecObserver("insert_smpp_message", func(c context.Context) error {
+		_, err := tx.NamedExecContext(c, q, m)
+		return err
+	})
+	return execFn(ctx)
+}
+
+type scannedEvent struct {
+	ID                 int64      `db:"id"`
+	SmsIdentifier      string     `db:"sms_identifier"`
+	Recipients         []byte     `db:"recipients"`
+	Status             sms.State  `db:"status"`
+	CreatedAt          time.Time  `db:"created_at"`
+	Settled            bool       `db:"settled"`
+	SystemID           *string    `db:"system_id"`
+	SourceAddr         *string    `db:"source_addr"`
+	RegisteredDelivery *int       `db:"registered_delivery"`
+	SubmittedAt        *time.Time `db:"submitted_at"`
+}
+
+type receipt struct {
+	ID            int64     `db:"id"`
+	SystemID      string    `db:"system_id"`
+	SmsIdentifier string    `db:"sms_identifier"`
+	Recipient     string    `db:"recipient"`
+	SourceAddr    string    `db:"source_addr"`
+	Status        sms.State `db:"status"`
+	SubmittedAt   time.Time `db:"submitted_at"`
+	DoneAt        time.Time `db:"done_at"`
+	Attempts      int       `db:"attempts"`
+}
+
+// receiptState maps a final status to the stat of the receipt text and its message_state.
+func receiptState(state sms.State) (string, byte, bool) {
+	switch state {
+	case sms.Done:
+		return "DELIVRD", smpp.StateDelivered, true
+	case sms.Failed:
+		return "UNDELIV", smpp.StateUndeliverable, true
+	case sms.Rejected:
+		return "REJECTD", smpp.StateRejected, true
+	default:
+		return "", 0, false
+	}
+}
+
+// receiptMessage is the deliver_sm of a receipt: from the recipient to the submit's
+// source_addr, with the customary receipt text and the receipted_message_id and
+// message_state TLVs.
+func receiptMessage(r receipt) smpp.ShortMessage {
+	stat, state, _ := receiptState(r.Status)
+	dlvrd := 0
+	if r.Status == sms.Done {
+		dlvrd = 1
+	}
+	text := fmt.Sprintf("id:%s sub:001 dlvrd:%03d submit date:%s done date:%s stat:%s err:000 text:",
+		r.SmsIdentifier, dlvrd, r.SubmittedAt.Format(receiptTimeLayout), r.DoneAt.Format(receiptTimeLayout), stat)
+	return smpp.ShortMessage{
+		SourceAddr:      r.Recipient,
+		DestinationAddr: r.SourceAddr,
+		EsmClass:        smpp.EsmClassDeliveryReceipt,
+		DataCoding:      smpp.CodingIA5,
+		Message:         []byte(text),
+		TLVs: []smpp.TLV{
+			{Tag: smpp.TagReceiptedMessageID, Value: append([]byte(r.SmsIdentifier), 0)},
+			{Tag: smpp.TagMessageState, Value: []byte{state}},
+		},
+	}
+}
+
+// sendReceipts queues receipts for final status changes and sends those of the accounts
+// bound here as receivers until ctx is done. Status changes are read from
+// sms_status_events behind a cursor in smpp_receipt_cursor, so every instance may scan;
+// a receipt goes to whichever instance its account is bound to.
+func (s *Server) sendReceipts(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		default:
+		}
+
+		scanned, err := ScanStatusEvents(ctx, scanBatchSize)
+		if err != nil {
+			app.Logger.Error("smpp scan status events", "err", err)
+		}
+
+		var rows []receipt
+		if systemIDs := s.receiverSystemIDs(); len(systemIDs) > 0 {
+			rows, err = claimReceipts(ctx, systemIDs, receiptBatchSize)
+			if err != nil {
+				app.Logger.Error("smpp claim receipts", "err", err)
+			}
+		}
+		var wg sync.WaitGroup
+		for _, r := range rows {
+			sess := s.receiverFor(r.SystemID)
+			if sess == nil {
+				// Unbound since the claim; the lease runs out and another bind gets it.
+				continue
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				s.sendReceipt(ctx, sess, r)
+			}()
+		}
+		wg.Wait()
+
+		if scanned < scanBatchSize && len(rows) == 0 {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(idleSleep):
+			}
+		}
+	}
+}
+
+// sendReceipt sends one receipt and deletes it once acknowledged, or after maxAttempts.
+// Otherwise it is sent again when its lease runs out.
+func (s *Server) sendReceipt(ctx context.Context, sess *session, r receipt) {
+	err := sess.deliver(ctx, receiptMessage(r))
+	if err == nil {
+		metrics.SMPPReceipt("ok")
+	} else {
+		metrics.SMPPReceipt("failed")
+		app.Logger.Warn("smpp deliver receipt", "id", r.ID, "system_id", r.SystemID, "attempts", r.Attempts, "err", err)
+		if r.Attempts < maxAttempts {
+			return
+		}
+	}
+	if err := deleteReceipt(ctx, r.ID); err != nil {
+		app.Logger.Error("smpp delete receipt", "id", r.ID, "err", err)
+	}
+}
+
+// ScanStatusEvents moves the cursor over up to limit settled status events, queues a receipt
+// per recipient for the final ones of SMPP messages whose registered_delivery asks for them,
+// and returns how many events it passed.
+func ScanStatusEvents(ctx context.Context, limit int) (_ int, err error) {
+	tx, err := app.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	var cursor int64
+	if err = metrics.DBExecObserver("select_smpp_receipt_cursor", func(c context.Context) error {
+		if _, err := tx.ExecContext(c, `INSERT IGNORE INTO smpp_receipt_cursor (id, last_event_id) VALUES (1, 0)`); err != nil {
+			return err
+		}
+		return tx.GetContext(c, &cursor, `SELECT last_event_id FROM smpp_receipt_cursor WHERE id = 1 FOR UPDATE`)
+	})(ctx); err != nil {
+		return 0, err
+	}
+
+	const selectQ = `
+		SELECT e.id, e.sms_identifier, e.recipients, e.status, e.created_at,
+			e.created_at <= CURRENT_TIMESTAMP - INTERVAL ? SECOND AS settled,
+			m.system_id, m.source_addr, m.registered_delivery, m.created_at AS submitted_at
+		FROM (
+			SELECT id, sms_identifier, recipients, status, created_at
+			FROM sms_status_events
+			WHERE id > ?
+			ORDER BY id
+			LIMIT ?
+		) e
+		LEFT JOIN smpp_messages m ON m.sms_identifier = e.sms_identifier
+		ORDER BY e.id
+	`
+	var events []scannedEvent
+	if err = metrics.DBExecObserver("select_smpp_status_events", func(c context.Context) error {
+		return tx.SelectContext(c, &events, selectQ, int64(settleDelay.Seconds()), cursor, limit)
+	})(ctx); err != nil {
+		return 0, err
+	}
+
+	passed := 0
+	for _, e := range events {
+		if !e.Settled {
+			break
+		}
+		if e.SystemID != nil {
+			if err = queueReceiptsTx(ctx, tx, e); err != nil {
+				return 0, err
+			}
+		}
+		cursor = e.ID
+		passed++
+	}
+	if passed == 0 {
+		return 0, tx.Commit()
+	}
+
+	if err = metrics.DBExecObserver("update_smpp_receipt_cursor", func(c context.Context) error {
+		_, err := tx.ExecContext(c, `UPDATE smpp_receipt_cursor SET last_event_id = ? WHERE id = 1`, cursor)
+		return err
+	})(ctx); err != nil {
+		return 0, err
+	}
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+	return passed, nil
+}
+
+func queueReceiptsTx(ctx context.Context, tx *sqlx.Tx, e scannedEvent) error {
+	if _, _, ok := receiptState(e.Status); !ok {
+		return nil
+	}
+	if *e.RegisteredDelivery == receiptOnFailure && e.Status == sms.Done {
+		return nil
+	}
+
+	var recipients []string
+	if err := json.Unmarshal(e.Recipients, &recipients); err != nil {
+		return err
+	}
+	const q = `
+		INSERT IGNORE INTO smpp_receipts (event_id, system_id, sms_identifier, recipient, source_addr, status, submitted_at, done_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`
+	for _, r := range recipients {
+		err := metrics.DBExecObserver("insert_smpp_receipt", func(c context.Context) error {
+			_, err := tx.ExecContext(c, q, e.ID, *e.SystemID, e.SmsIdentifier, r, *e.SourceAddr, e.Status, *e.SubmittedAt, e.CreatedAt)
+			return err
+		})(ctx)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// claimReceipts leases up to limit due receipts of the given accounts.
+func claimReceipts(ctx context.Context, systemIDs []string, limit int) ([]receipt, error) {
+	tx, err := app.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	selectQ, args, err := sqlx.In(`
+		SELECT id, system_id, sms_identifier, recipient, source_addr, status, submitted_at, done_at, attempts
+		FROM smpp_receipts
+		WHERE system_id IN (?)
+		  AND (next_run_at IS NULL OR next_run_at <= CURRENT_TIMESTAMP)
+		ORDER BY id
+		LIMIT ?
+		FOR UPDATE SKIP LOCKED
+	`, systemIDs, limit)
+	if err != nil {
+		return nil, err
+	}
+	var rows []receipt
+	if err := tx.SelectContext(ctx, &rows, selectQ, args...); err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		_ = tx.Commit()
+		return nil, nil
+	}
+
+	ids := make([]int64, len(rows))
+	for i := range rows {
+		rows[i].Attempts++
+		ids[i] = rows[i].ID
+	}
+	updateQ, args, err := sqlx.In(`UPDATE smpp_receipts SET attempts = attempts + 1, next_run_at = CURRENT_TIMESTAMP + INTERVAL ? SECOND WHERE id IN (?)`,
+		int64(receiptLease.Seconds()), ids)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.ExecContext(ctx, updateQ, args...); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+func deleteReceipt(ctx context.Context, id int64) error {
+	execFn := metrics.DBExecObserver("delete_smpp_receipt", func(c context.Context) error {
+		_, err := app.DB.ExecContext(c, `DELETE FROM smpp_receipts WHERE id = ?`, id)
+		return err
+	})
+	return execFn(ctx)
+}
+
+// Purge deletes SMPP messages and unsent receipts older than retention, at most limit of
+// each, and returns how many it deleted.
+func Purge(ctx context.Context, retention time.Duration, limit int) (int64, error) {
+	var total int64
+	for _, table := range []string{"smpp_messages", "smpp_receipts"} {
+		var n int64
+		execFn := metrics.DBExecObserver("purge_"+table, func(c context.Context) error {
+			res, err := app.DB.ExecContext(c, `DELETE FROM `+table+` WHERE created_at <= CURRENT_TIMESTAMP - INTERVAL ? SECOND LIMIT ?`, int64(retention.Seconds()), limit)
+			if err != nil {
+				return err
+			}
+			n, err = res.RowsAffected()
+			return err
+		})
+		if err := execFn(ctx); err != nil {
+			return total, err
+		}
+		total += n
+	}
+	return total, nil
+}
+
+// StartPurger deletes old SMPP messages and receipts every interval until ctx is done.
+func StartPurger(ctx context.Context, interval, retention time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+		for {
+			n, err := Purge(ctx, retention, purgeBatchSize)
+			if err != nil {
+				app.Logger.Error("purge smpp messages", "err", err)
+				break
+			}
+			if n < purgeBatchSize {
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,159 @@
+// Package smppapi is an SMPP 3.4 server for customers that submit over SMPP instead of HTTP.
+// Binds authenticate with the customer's SMPP accounts, submit_sm goes through sms.Send like
+// POST /sms/send, and delivery receipts are returned as deliver_sm.
+package smppapi
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+
+	"sms-gateway/app"
+	"sms-gateway/internal/sms"
+)
+
+// Hooks replaced in tests.
+var (
+	authenticate  = Authenticate
+	send          = sms.Send
+	recordMessage = insertMessageTx
+)
+
+// Server accepts SMPP connections and keeps track of their binds, so receipts can be sent to
+// the receiving binds of an account.
+type Server struct {
+	mu       sync.Mutex
+	listener net.Listener
+	sessions map[*session]struct{}
+	next     map[string]int
+	closing  bool
+	wg       sync.WaitGroup
+}
+
+// New returns a server; Serve starts it.
+func New() *Server {
+	return &Server{
+		sessions: map[*session]struct{}{},
+		next:     map[string]int{},
+	}
+}
+
+// Serve accepts connections on lis and sends delivery receipts until Shutdown. It returns nil
+// after Shutdown.
+func (s *Server) Serve(lis net.Listener) error {
+	s.mu.Lock()
+	if s.closing {
+		s.mu.Unlock()
+		return lis.Close()
+	}
+	s.listener = lis
+	s.mu.Unlock()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	receiptsDone := make(chan struct{})
+	go func() {
+		defer close(receiptsDone)
+		s.sendReceipts(ctx)
+	}()
+
+	for {
+		conn, err := lis.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closing := s.closing
+			s.mu.Unlock()
+			cancel()
+			<-receiptsDone
+			if closing || errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+
+		sess := newSession(s, conn)
+		s.mu.Lock()
+		if s.closing {
+			s.mu.Unlock()
+			_ = conn.Close()
+			continue
+		}
+		s.sessions[sess] = struct{}{}
+		s.wg.Add(1)
+		s.mu.Unlock()
+
+		go func() {
+			defer s.wg.Done()
+			sess.serve()
+			s.mu.Lock()
+			delete(s.sessions, sess)
+			s.mu.Unlock()
+		}()
+	}
+}
+
+// Shutdown stops accepting connections, lets every session finish the submit_sm it is
+// processing and unbinds it. Sessions still open when ctx ends are closed.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	s.closing = true
+	if s.listener != nil {
+		_ = s.listener.Close()
+	}
+	for sess := range s.sessions {
+		sess.stop()
+	}
+	s.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		s.mu.Lock()
+		for sess := range s.sessions {
+			sess.close()
+		}
+		s.mu.Unlock()
+		app.Logger.Warn("smpp shutdown timed out; closed open sessions")
+		return ctx.Err()
+	}
+}
+
+// receiverSystemIDs lists the accounts with a bind on this server that takes receipts.
+func (s *Server) receiverSystemIDs() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	seen := map[string]bool{}
+	var ids []string
+	for sess := range s.sessions {
+		if a, ok := sess.receiver(); ok && !seen[a.SystemID] {
+			seen[a.SystemID] = true
+			ids = append(ids, a.SystemID)
+		}
+	}
+	return ids
+}
+
+// receiverFor picks one of the account's receiving binds, in turn.
+func (s *Server) receiverFor(systemID string) *session {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var binds []*session
+	for sess := range s.sessions {
+		if a, ok := sess.receiver(); ok && a.SystemID == systemID {
+			binds = append(binds, sess)
+		}
+	}
+	if len(binds) == 0 {
+		return nil
+	}
+	i := s.next[systemID] % len(binds)
+	s.next[systemID] = i + 1
+	return binds[i]
+}
@@ -0,0 +1,394 @@
+package smppapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"sms-gateway/app"
+	"sms-gateway/config"
+	"sms-gateway/internal/auth"
+	"sms-gateway/internal/balance"
+	"sms-gateway/internal/model"
+	"sms-gateway/internal/sms"
+	"sms-gateway/pkg/metrics"
+	"sms-gateway/pkg/smpp"
+	"sms-gateway/pkg/tracing"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	// bindTimeout is how long a connection may stay unbound.
+	bindTimeout = 30 * time.Second
+	// idleTimeout closes binds that send nothing, not even enquire_link.
+	idleTimeout = 2 * time.Minute
+	// writeTimeout bounds writing one PDU.
+	writeTimeout = 10 * time.Second
+	// submitTimeout bounds authenticating a bind and sending one submit_sm.
+	submitTimeout = 30 * time.Second
+	// respTimeout is how long a deliver_sm waits for its deliver_sm_resp.
+	respTimeout = 30 * time.Second
+
+	// priorityExpress is the lowest priority_flag sent as express.
+	priorityExpress = 2
+	// registeredDeliveryMask holds the registered_delivery bits asking for receipts.
+	registeredDeliveryMask = 0x03
+)
+
+var errSessionClosed = errors.New("smpp session closed")
+
+// session is one SMPP connection. PDUs are read by serve; each submit_sm is processed in its
+// own goroutine and answered out of order, as SMPP allows, up to the account's window.
+type session struct {
+	srv    *Server
+	conn   net.Conn
+	remote string
+
+	writeMu sync.Mutex
+
+	mu       sync.Mutex
+	account  Account
+	bindType smpp.CommandID // 0 until bound
+	pending  map[uint32]chan smpp.PDU
+
+	limiter  *limiter
+	window   chan struct{} // submit_sm being processed
+	outbound chan struct{} // deliver_sm waiting for their resp
+
+	seq       atomic.Uint32
+	submits   sync.WaitGroup
+	stopping  atomic.Bool
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func newSession(srv *Server, conn net.Conn) *session {
+	return &session{
+		srv:     srv,
+		conn:    conn,
+		remote:  conn.RemoteAddr().String(),
+		pending: map[uint32]chan smpp.PDU{},
+		done:    make(chan struct{}),
+	}
+}
+
+// serve reads PDUs until the ESME unbinds, the connection fails or the server stops. Submits
+// in flight are answered before the connection is closed.
+func (s *session) serve() {
+	defer s.close()
+
+	for {
+		timeout := idleTimeout
+		if _, ok := s.bound(); !ok {
+			timeout = bindTimeout
+		}
+		_ = s.conn.SetReadDeadline(time.Now().Add(timeout))
+		if s.stopping.Load() {
+			break
+		}
+
+		p, err := smpp.ReadPDU(s.conn)
+		if err != nil {
+			if errors.Is(err, smpp.ErrPDULen) {
+				_ = s.write(smpp.PDU{ID: smpp.GenericNack, Status: smpp.StatusInvCmdLen})
+			}
+			break
+		}
+		if !s.handle(p) {
+			break
+		}
+	}
+
+	s.submits.Wait()
+	bindType, ok := s.bound()
+	if !ok {
+		return
+	}
+	if s.stopping.Load() {
+		// Tell the ESME to rebind elsewhere; its unbind_resp is not waited for.
+		_ = s.write(smpp.PDU{ID: smpp.Unbind, Seq: s.nextSeq()})
+	}
+	metrics.SMPPBindClosed(bindType.String())
+}
+
+// handle answers one PDU and reports whether to keep reading.
+func (s *session) handle(p smpp.PDU) bool {
+	switch p.ID {
+	case smpp.BindTransmitter, smpp.BindReceiver, smpp.BindTransceiver:
+		return s.bind(p)
+	case smpp.SubmitSM:
+		s.submit(p)
+	case smpp.EnquireLink:
+		s.respond(p, smpp.StatusOK, nil)
+	case smpp.Unbind:
+		s.respond(p, smpp.StatusOK, nil)
+		return false
+	case smpp.DeliverSMResp, smpp.GenericNack:
+		s.resolve(p)
+	case smpp.EnquireLinkResp, smpp.UnbindResp:
+	default:
+		if !p.ID.IsResponse() {
+			metrics.SMPPRequest(p.ID.String(), fmt.Sprintf("0x%08x", uint32(smpp.StatusInvCmdID)))
+			_ = s.write(smpp.PDU{ID: smpp.GenericNack, Status: smpp.StatusInvCmdID, Seq: p.Seq})
+		}
+	}
+	return true
+}
+
+// bind authenticates a bind against the SMPP accounts; a failed bind closes the connection.
+func (s *session) bind(p smpp.PDU) bool {
+	if _, ok := s.bound(); ok {
+		s.respond(p, smpp.StatusAlyBnd, nil)
+		return true
+	}
+	b, err := smpp.ParseBind(p.Body)
+	if err != nil {
+		s.respond(p, smpp.StatusBindFail, nil)
+		return false
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), submitTimeout)
+	defer cancel()
+	a, err := authenticate(ctx, b.SystemID, b.Password)
+	if err != nil {
+		status := smpp.StatusBindFail
+		switch {
+		case errors.Is(err, ErrInvalidSystemID):
+			status = smpp.StatusInvSysID
+		case errors.Is(err, ErrInvalidPassword):
+			status = smpp.StatusInvPaswd
+		default:
+			app.Logger.Error("smpp authenticate", "system_id", b.SystemID, "err", err)
+		}
+		app.Logger.Warn("smpp bind failed", "system_id", b.SystemID, "remote", s.remote, "err", err)
+		s.respond(p, status, nil)
+		return false
+	}
+
+	s.mu.Lock()
+	s.account = a
+	s.bindType = p.ID
+	s.limiter = newLimiter(a.MaxTPS)
+	s.window = make(chan struct{}, a.WindowSize)
+	s.outbound = make(chan struct{}, a.WindowSize)
+	s.mu.Unlock()
+
+	s.respond(p, smpp.StatusOK, smpp.SystemIDBody(config.AppName))
+	metrics.SMPPBindOpened(p.ID.String())
+	app.Logger.Info("smpp bound", "system_id", a.SystemID, "customer_id", a.CustomerID, "bind_type", p.ID.String(), "remote", s.remote)
+	return true
+}
+
+// submit admits a submit_sm against the bind's throughput and window and sends it in the
+// background.
+func (s *session) submit(p smpp.PDU) {
+	bindType, ok := s.bound()
+	if !ok || bindType == smpp.BindReceiver {
+		s.respond(p, smpp.StatusInvBndSts, nil)
+		return
+	}
+	if !s.limiter.allow() {
+		s.respond(p, smpp.StatusThrottled, nil)
+		return
+	}
+	select {
+	case s.window <- struct{}{}:
+	default:
+		s.respond(p, smpp.StatusMsgQFul, nil)
+		return
+	}
+
+	s.submits.Add(1)
+	go func() {
+		defer s.submits.Done()
+		defer func() { <-s.window }()
+		status, body := s.send(p)
+		s.respond(p, status, body)
+	}()
+}
+
+// send runs a submit_sm through sms.Send, like POST /sms/send, and returns the
+// submit_sm_resp, whose message_id is the sms_identifier.
+func (s *session) send(p smpp.PDU) (smpp.Status, []byte) {
+	m, err := smpp.ParseShortMessage(p.Body)
+	if err != nil {
+		return smpp.StatusInvMsgLen, nil
+	}
+	// Concatenated parts would be charged and sent one by one; they are not reassembled.
+	if m.EsmClass&smpp.EsmClassUDHI != 0 {
+		return smpp.StatusInvEsmClass, nil
+	}
+	text, err := smpp.DecodeText(m.DataCoding, m.Text())
+	if err != nil {
+		return smpp.StatusSubmitFail, nil
+	}
+	typ := model.NORMAL
+	if m.PriorityFlag >= priorityExpress {
+		typ = model.EXPRESS
+	}
+
+	a := s.accountOf()
+	ctx, cancel := context.WithTimeout(context.Background(), submitTimeout)
+	defer cancel()
+	ctx = auth.WithCustomer(ctx, a.CustomerID)
+	ctx = tracing.WithUser(ctx, strconv.FormatInt(a.CustomerID, 10))
+
+	var hooks []sms.TxHook
+	if m.RegisteredDelivery&registeredDeliveryMask != 0 {
+		// Stored with the message, so a message that is sent always has its receipts.
+		hooks = append(hooks, func(ctx context.Context, tx *sqlx.Tx, sent model.SMS) error {
+			return recordMessage(ctx, tx, message{
+				SmsIdentifier:      sent.SmsIdentifier,
+				CustomerID:         a.CustomerID,
+				SystemID:           a.SystemID,
+				SourceAddr:         m.SourceAddr,
+				RegisteredDelivery: int(m.RegisteredDelivery & registeredDeliveryMask),
+			})
+		})
+	}
+
+	sent, _, err := send(ctx, model.SMS{
+		CustomerID: a.CustomerID,
+		Text:       text,
+		Recipients: []string{m.DestinationAddr},
+		Type:       typ,
+	}, hooks...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sms.ErrNoRecipients), errors.As(err, new(*sms.RecipientError)):
+			return smpp.StatusInvDstAdr, nil
+		case errors.As(err, new(*sms.LimitError)):
+			return smpp.StatusThrottled, nil
+		case errors.Is(err, sms.ErrOverLimit):
+			return smpp.StatusSubmitFail, nil
+		case errors.Is(err, balance.ErrInsufficientBalance):
+			return smpp.StatusTempAppError, nil
+		case errors.Is(err, sms.ErrBlocked):
+			return smpp.StatusRejectAppError, nil
+		}
+		app.Logger.Error("smpp send sms", "system_id", a.SystemID, "err", err)
+		return smpp.StatusSysErr, nil
+	}
+
+	return smpp.StatusOK, smpp.MessageIDBody(sent.SmsIdentifier)
+}
+
+// deliver sends a deliver_sm and waits for its deliver_sm_resp, within the bind's window.
+func (s *session) deliver(ctx context.Context, m smpp.ShortMessage) error {
+	select {
+	case s.outbound <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-s.done:
+		return errSessionClosed
+	}
+	defer func() { <-s.outbound }()
+
+	seq := s.nextSeq()
+	ch := make(chan smpp.PDU, 1)
+	s.mu.Lock()
+	s.pending[seq] = ch
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.pending, seq)
+		s.mu.Unlock()
+	}()
+
+	if err := s.write(smpp.PDU{ID: smpp.DeliverSM, Seq: seq, Body: m.Bytes()}); err != nil {
+		return err
+	}
+
+	timer := time.NewTimer(respTimeout)
+	defer timer.Stop()
+	select {
+	case resp := <-ch:
+		if resp.Status != smpp.StatusOK {
+			return resp.Status
+		}
+		return nil
+	case <-timer.C:
+		return fmt.Errorf("no deliver_sm_resp in %s", respTimeout)
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-s.done:
+		return errSessionClosed
+	}
+}
+
+// resolve hands a deliver_sm_resp or generic_nack to the deliver waiting for it.
+func (s *session) resolve(p smpp.PDU) {
+	s.mu.Lock()
+	ch, ok := s.pending[p.Seq]
+	s.mu.Unlock()
+	if !ok {
+		return
+	}
+	select {
+	case ch <- p:
+	default:
+	}
+}
+
+func (s *session) respond(p smpp.PDU, status smpp.Status, body []byte) {
+	if status != smpp.StatusOK {
+		body = nil
+	}
+	metrics.SMPPRequest(p.ID.String(), fmt.Sprintf("0x%08x", uint32(status)))
+	if err := s.write(smpp.PDU{ID: p.ID.Resp(), Status: status, Seq: p.Seq, Body: body}); err != nil {
+		app.Logger.Warn("smpp write response", "command", p.ID.String(), "remote", s.remote, "err", err)
+	}
+}
+
+func (s *session) write(p smpp.PDU) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	_ = s.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	return smpp.WritePDU(s.conn, p)
+}
+
+// nextSeq returns sequence numbers 1 to 0x7FFFFFFF, then starts over.
+func (s *session) nextSeq() uint32 {
+	return s.seq.Add(1)%0x7FFFFFFF + 1
+}
+
+func (s *session) bound() (smpp.CommandID, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.bindType, s.bindType != 0
+}
+
+func (s *session) accountOf() Account {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.account
+}
+
+// receiver returns the account of a bind that takes deliver_sm.
+func (s *session) receiver() (Account, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stopping.Load() {
+		return Account{}, false
+	}
+	return s.account, s.bindType == smpp.BindReceiver || s.bindType == smpp.BindTransceiver
+}
+
+// stop makes serve return after the submits in flight are answered.
+func (s *session) stop() {
+	s.stopping.Store(true)
+	_ = s.conn.SetReadDeadline(time.Now())
+}
+
+func (s *session) close() {
+	s.closeOnce.Do(func() {
+		close(s.done)
+		_ = s.conn.Close()
+	})
+}
@@ -0,0 +1,462 @@
+package smppapi
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"sms-gateway/app"
+	"sms-gateway/internal/auth"
+	"sms-gateway/internal/balance"
+	"sms-gateway/internal/model"
+	"sms-gateway/internal/sms"
+	"sms-gateway/pkg/smpp"
+	"sms-gateway/testutil"
+
+	"github.com/jmoiron/sqlx"
+)
+
+func init() {
+	if app.Logger == nil {
+		app.Logger = slog.New(slog.NewTextHandler(bytes.NewBuffer(nil), nil))
+	}
+}
+
+// esme is the client end of a session served over net.Pipe.
+type esme struct {
+	t    *testing.T
+	conn net.Conn
+	seq  uint32
+}
+
+// stubAccount makes every bind with password "secret" succeed as a.
+func stubAccount(t *testing.T, a Account) {
+	t.Helper()
+	prevAuth, prevSend, prevRecord := authenticate, send, recordMessage
+	t.Cleanup(func() { authenticate, send, recordMessage = prevAuth, prevSend, prevRecord })
+	authenticate = func(_ context.Context, systemID, password string) (Account, error) {
+		if systemID != a.SystemID {
+			return Account{}, ErrInvalidSystemID
+		}
+		if password != "secret" {
+			return Account{}, ErrInvalidPassword
+		}
+		return a, nil
+	}
+	recordMessage = func(context.Context, *sqlx.Tx, message) error { return nil }
+}
+
+func connect(t *testing.T) (*esme, *session) {
+	t.Helper()
+	server, client := net.Pipe()
+	sess := newSession(New(), server)
+	go sess.serve()
+	t.Cleanup(func() { _ = client.Close() })
+	return &esme{t: t, conn: client}, sess
+}
+
+func (e *esme) write(id smpp.CommandID, body []byte) uint32 {
+	e.t.Helper()
+	e.seq++
+	if err := smpp.WritePDU(e.conn, smpp.PDU{ID: id, Seq: e.seq, Body: body}); err != nil {
+		e.t.Fatalf("write %s: %v", id, err)
+	}
+	return e.seq
+}
+
+func (e *esme) read() smpp.PDU {
+	e.t.Helper()
+	_ = e.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	p, err := smpp.ReadPDU(e.conn)
+	if err != nil {
+		e.t.Fatalf("read: %v", err)
+	}
+	return p
+}
+
+func (e *esme) call(id smpp.CommandID, body []byte) smpp.PDU {
+	e.t.Helper()
+	seq := e.write(id, body)
+	p := e.read()
+	if p.ID != id.Resp() || p.Seq != seq {
+		e.t.Fatalf("got %s seq %d, want %s seq %d", p.ID, p.Seq, id.Resp(), seq)
+	}
+	return p
+}
+
+func (e *esme) bind(id smpp.CommandID) {
+	e.t.Helper()
+	if p := e.call(id, smpp.Bind{SystemID: "shop", Password: "secret", InterfaceVersion: 0x34}.Bytes()); p.Status != smpp.StatusOK {
+		e.t.Fatalf("bind status %v", p.Status)
+	}
+}
+
+func submitBody(dest string) []byte {
+	return smpp.ShortMessage{SourceAddr: "Shop", DestinationAddr: dest, Message: []byte("Hi")}.Bytes()
+}
+
+func TestBind_Failures(t *testing.T) {
+	stubAccount(t, Account{SystemID: "shop", CustomerID: 42, MaxTPS: 10, WindowSize: 10})
+
+	for _, tc := range []struct {
+		name   string
+		bind   smpp.Bind
+		status smpp.Status
+	}{
+		{"unknown system_id", smpp.Bind{SystemID: "other", Password: "secret"}, smpp.StatusInvSysID},
+		{"wrong password", smpp.Bind{SystemID: "shop", Password: "guess"}, smpp.StatusInvPaswd},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c, _ := connect(t)
+			if p := c.call(smpp.BindTransceiver, tc.bind.Bytes()); p.Status != tc.status {
+				t.Fatalf("status %v, want %v", p.Status, tc.status)
+			}
+			// A failed bind closes the connection.
+			_ = c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+			if _, err := smpp.ReadPDU(c.conn); err == nil {
+				t.Fatal("connection still open after a failed bind")
+			}
+		})
+	}
+}
+
+func TestSubmit(t *testing.T) {
+	stubAccount(t, Account{SystemID: "shop", CustomerID: 42, MaxTPS: 10, WindowSize: 10})
+	var (
+		got      model.SMS
+		recorded message
+	)
+	send = func(ctx context.Context, s model.SMS, hooks ...sms.TxHook) (model.SMS, sms.State, error) {
+		got = s
+		s.SmsIdentifier = "sms-1"
+		for _, hook := range hooks {
+			if err := hook(ctx, nil, s); err != nil {
+				return s, "", err
+			}
+		}
+		return s, sms.Pending, nil
+	}
+	recordMessage = func(_ context.Context, _ *sqlx.Tx, m message) error {
+		recorded = m
+		return nil
+	}
+
+	c, _ := connect(t)
+	if p := c.call(smpp.SubmitSM, submitBody("+98912")); p.Status != smpp.StatusInvBndSts {
+		t.Fatalf("unbound submit status %v", p.Status)
+	}
+	c.bind(smpp.BindTransceiver)
+	if p := c.call(smpp.BindTransmitter, smpp.Bind{SystemID: "shop", Password: "secret"}.Bytes()); p.Status != smpp.StatusAlyBnd {
+		t.Fatalf("second bind status %v", p.Status)
+	}
+	if p := c.call(smpp.EnquireLink, nil); p.Status != smpp.StatusOK {
+		t.Fatalf("enquire_link status %v", p.Status)
+	}
+
+	body := smpp.ShortMessage{
+		SourceAddr:         "Shop",
+		DestinationAddr:    "+98912",
+		PriorityFlag:       2,
+		RegisteredDelivery: 1,
+		DataCoding:         smpp.CodingUCS2,
+		Message:            []byte{0x06, 0x33, 0x06, 0x44, 0x06, 0x27, 0x06, 0x45},
+	}.Bytes()
+	p := c.call(smpp.SubmitSM, body)
+	if p.Status != smpp.StatusOK {
+		t.Fatalf("submit status %v", p.Status)
+	}
+	if id, _ := smpp.ParseMessageID(p.Body); id != "sms-1" {
+		t.Fatalf("message_id %q", id)
+	}
+	if got.CustomerID != 42 || got.Text != "سلام" || got.Type != model.EXPRESS || len(got.Recipients) != 1 || got.Recipients[0] != "+98912" {
+		t.Fatalf("sent %+v", got)
+	}
+	if recorded.SmsIdentifier != "sms-1" || recorded.SystemID != "shop" || recorded.SourceAddr != "Shop" || recorded.RegisteredDelivery != 1 {
+		t.Fatalf("recorded %+v", recorded)
+	}
+
+	if p := c.call(smpp.SubmitSM, append(submitBody("+98912")[:10:10], 0x40)); p.Status != smpp.StatusInvMsgLen {
+		t.Fatalf("truncated submit status %v", p.Status)
+	}
+	if p := c.call(smpp.Unbind, nil); p.Status != smpp.StatusOK {
+		t.Fatalf("unbind status %v", p.Status)
+	}
+}
+
+func TestSubmit_Errors(t *testing.T) {
+	stubAccount(t, Account{SystemID: "shop", CustomerID: 42, MaxTPS: 100, WindowSize: 10})
+	var sendErr error
+	send = func(_ context.Context, s model.SMS, _ ...sms.TxHook) (model.SMS, sms.State, error) {
+		return s, "", sendErr
+	}
+
+	c, _ := connect(t)
+	c.bind(smpp.BindTransmitter)
+	for _, tc := range []struct {
+		err    error
+		status smpp.Status
+	}{
+		{&sms.RecipientError{Recipient: "x"}, smpp.StatusInvDstAdr},
+		{&sms.LimitError{Limit: sms.LimitRequestsPerSec, RetryAfter: time.Second}, smpp.StatusThrottled},
+		{balance.ErrInsufficientBalance, smpp.StatusTempAppError},
+		{sms.ErrBlocked, smpp.StatusRejectAppError},
+		{errors.New("db down"), smpp.StatusSysErr},
+	} {
+		sendErr = tc.err
+		if p := c.call(smpp.SubmitSM, submitBody("+98912")); p.Status != tc.status {
+			t.Fatalf("%v: status %v, want %v", tc.err, p.Status, tc.status)
+		}
+	}
+
+	udh := smpp.ShortMessage{DestinationAddr: "+98912", EsmClass: smpp.EsmClassUDHI, Message: []byte{0x05, 0x00, 0x03, 0x01, 0x02, 0x01, 'H'}}
+	if p := c.call(smpp.SubmitSM, udh.Bytes()); p.Status != smpp.StatusInvEsmClass {
+		t.Fatalf("udhi status %v", p.Status)
+	}
+}
+
+func TestSubmit_ReceiverBind(t *testing.T) {
+	stubAccount(t, Account{SystemID: "shop", CustomerID: 42, MaxTPS: 10, WindowSize: 10})
+	c, _ := connect(t)
+	c.bind(smpp.BindReceiver)
+	if p := c.call(smpp.SubmitSM, submitBody("+98912")); p.Status != smpp.StatusInvBndSts {
+		t.Fatalf("status %v, want ESME_RINVBNDSTS", p.Status)
+	}
+}
+
+func TestSubmit_Throttled(t *testing.T) {
+	stubAccount(t, Account{SystemID: "shop", CustomerID: 42, MaxTPS: 1, WindowSize: 10})
+	send = func(_ context.Context, s model.SMS, _ ...sms.TxHook) (model.SMS, sms.State, error) {
+		return s, sms.Pending, nil
+	}
+	c, _ := connect(t)
+	c.bind(smpp.BindTransmitter)
+	if p := c.call(smpp.SubmitSM, submitBody("+98912")); p.Status != smpp.StatusOK {
+		t.Fatalf("first submit status %v", p.Status)
+	}
+	if p := c.call(smpp.SubmitSM, submitBody("+98912")); p.Status != smpp.StatusThrottled {
+		t.Fatalf("second submit status %v, want ESME_RTHROTTLED", p.Status)
+	}
+}
+
+func TestSubmit_WindowFull(t *testing.T) {
+	stubAccount(t, Account{SystemID: "shop", CustomerID: 42, MaxTPS: 100, WindowSize: 1})
+	release := make(chan struct{})
+	send = func(_ context.Context, s model.SMS, _ ...sms.TxHook) (model.SMS, sms.State, error) {
+		<-release
+		s.SmsIdentifier = "sms-1"
+		return s, sms.Pending, nil
+	}
+	c, _ := connect(t)
+	c.bind(smpp.BindTransmitter)
+
+	first := c.write(smpp.SubmitSM, submitBody("+98912"))
+	if p := c.call(smpp.SubmitSM, submitBody("+98912")); p.Status != smpp.StatusMsgQFul {
+		t.Fatalf("second submit status %v, want ESME_RMSGQFUL", p.Status)
+	}
+	close(release)
+	if p := c.read(); p.Seq != first || p.Status != smpp.StatusOK {
+		t.Fatalf("first submit answered with %+v", p)
+	}
+}
+
+func TestDeliverReceipt(t *testing.T) {
+	stubAccount(t, Account{SystemID: "shop", CustomerID: 42, MaxTPS: 10, WindowSize: 10})
+	c, sess := connect(t)
+	c.bind(smpp.BindReceiver)
+	if a, ok := sess.receiver(); !ok || a.SystemID != "shop" {
+		t.Fatalf("receiver %+v, %v", a, ok)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- sess.deliver(context.Background(), receiptMessage(receipt{
+			SmsIdentifier: "sms-1",
+			Recipient:     "+98912",
+			SourceAddr:    "Shop",
+			Status:        sms.Failed,
+			SubmittedAt:   time.Date(2026, 10, 18, 9, 30, 0, 0, time.Local),
+			DoneAt:        time.Date(2026, 10, 18, 9, 31, 0, 0, time.Local),
+		}))
+	}()
+
+	p := c.read()
+	if p.ID != smpp.DeliverSM {
+		t.Fatalf("got %s, want deliver_sm", p.ID)
+	}
+	m, err := smpp.ParseShortMessage(p.Body)
+	if err != nil {
+		t.Fatalf("parse deliver_sm: %v", err)
+	}
+	want := "id:sms-1 sub:001 dlvrd:000 submit date:2610180930 done date:2610180931 stat:UNDELIV err:000 text:"
+	if m.EsmClass != smpp.EsmClassDeliveryReceipt || m.SourceAddr != "+98912" || m.DestinationAddr != "Shop" || string(m.Message) != want {
+		t.Fatalf("deliver_sm %+v", m)
+	}
+	if v, _ := m.TLV(smpp.TagMessageState); len(v) != 1 || v[0] != smpp.StateUndeliverable {
+		t.Fatalf("message_state %v", v)
+	}
+	if v, _ := m.TLV(smpp.TagReceiptedMessageID); string(v) != "sms-1\x00" {
+		t.Fatalf("receipted_message_id %q", v)
+	}
+
+	if err := smpp.WritePDU(c.conn, smpp.PDU{ID: smpp.DeliverSMResp, Seq: p.Seq, Body: smpp.MessageIDBody("")}); err != nil {
+		t.Fatalf("write deliver_sm_resp: %v", err)
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("deliver: %v", err)
+	}
+}
+
+func TestStopUnbinds(t *testing.T) {
+	stubAccount(t, Account{SystemID: "shop", CustomerID: 42, MaxTPS: 10, WindowSize: 10})
+	c, sess := connect(t)
+	c.bind(smpp.BindTransceiver)
+	sess.stop()
+	if p := c.read(); p.ID != smpp.Unbind {
+		t.Fatalf("got %s, want unbind", p.ID)
+	}
+	if _, ok := sess.receiver(); ok {
+		t.Fatal("stopping session still takes receipts")
+	}
+}
+
+func TestLimiter(t *testing.T) {
+	now := time.Unix(0, 0)
+	l := newLimiter(2)
+	l.now = func() time.Time { return now }
+	l.last = now
+
+	if !l.allow() || !l.allow() || l.allow() {
+		t.Fatal("want a burst of 2")
+	}
+	now = now.Add(500 * time.Millisecond)
+	if !l.allow() || l.allow() {
+		t.Fatal("want one token after half a second")
+	}
+}
+
+func TestAccounts(t *testing.T) {
+	ctx := testutil.EnsureSetup(t)
+	testutil.ResetTables(ctx, t)
+
+	if _, err := SetAccount(ctx, Account{SystemID: "shop", CustomerID: 9999, MaxTPS: 10, WindowSize: 5}); !errors.Is(err, auth.ErrCustomerNotFound) {
+		t.Fatalf("unknown customer: got %v", err)
+	}
+	if _, _, err := auth.CreateCustomer(ctx, auth.Customer{ID: 7, Name: "shop"}, "default"); err != nil {
+		t.Fatalf("create customer: %v", err)
+	}
+
+	created, err := SetAccount(ctx, Account{SystemID: "shop", CustomerID: 7, MaxTPS: 10, WindowSize: 5})
+	if err != nil || len(created.Password) != passwordLen {
+		t.Fatalf("create: %+v, %v", created, err)
+	}
+	updated, err := SetAccount(ctx, Account{SystemID: "shop", CustomerID: 7, MaxTPS: 20, WindowSize: 5})
+	if err != nil || updated.Password != "" || updated.MaxTPS != 20 {
+		t.Fatalf("update: %+v, %v", updated, err)
+	}
+	if _, err := SetAccount(ctx, Account{SystemID: "shop", CustomerID: 8, MaxTPS: 20, WindowSize: 5}); !errors.Is(err, ErrInvalidAccount) {
+		t.Fatalf("other customer: got %v", err)
+	}
+
+	if a, err := Authenticate(ctx, "shop", created.Password); err != nil || a.CustomerID != 7 || a.MaxTPS != 20 {
+		t.Fatalf("authenticate: %+v, %v", a, err)
+	}
+	if _, err := Authenticate(ctx, "shop", "wrong"); !errors.Is(err, ErrInvalidPassword) {
+		t.Fatalf("wrong password: got %v", err)
+	}
+	if _, err := Authenticate(ctx, "nobody", created.Password); !errors.Is(err, ErrInvalidSystemID) {
+		t.Fatalf("unknown system_id: got %v", err)
+	}
+
+	reset, err := ResetPassword(ctx, "shop")
+	if err != nil {
+		t.Fatalf("reset: %v", err)
+	}
+	if _, err := Authenticate(ctx, "shop", created.Password); !errors.Is(err, ErrInvalidPassword) {
+		t.Fatalf("old password: got %v", err)
+	}
+	if _, err := Authenticate(ctx, "shop", reset.Password); err != nil {
+		t.Fatalf("new password: %v", err)
+	}
+
+	if err := DeleteAccount(ctx, "shop"); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if err := DeleteAccount(ctx, "shop"); !errors.Is(err, ErrAccountNotFound) {
+		t.Fatalf("delete again: got %v", err)
+	}
+}
+
+func TestScanStatusEvents(t *testing.T) {
+	ctx := testutil.EnsureSetup(t)
+	testutil.ResetTables(ctx, t)
+
+	tx, err := app.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		t.Fatalf("begin: %v", err)
+	}
+	for _, m := range []message{
+		{SmsIdentifier: "all", CustomerID: 5, SystemID: "shop", SourceAddr: "Shop", RegisteredDelivery: 1},
+		{SmsIdentifier: "failures", CustomerID: 5, SystemID: "shop", SourceAddr: "Shop", RegisteredDelivery: receiptOnFailure},
+	} {
+		if err := insertMessageTx(ctx, tx, m); err != nil {
+			t.Fatalf("insert message: %v", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("commit: %v", err)
+	}
+	const insertEvent = `INSERT INTO sms_status_events (customer_id, sms_identifier, recipients, status, provider, created_at) VALUES (?, ?, ?, ?, '', ?)`
+	old := time.Now().Add(-time.Minute)
+	for _, e := range []struct {
+		id         string
+		recipients string
+		status     sms.State
+		at         time.Time
+	}{
+		{"all", `["+1","+2"]`, sms.Sending, old},
+		{"all", `["+1","+2"]`, sms.Done, old},
+		{"failures", `["+3"]`, sms.Done, old},
+		{"other", `["+4"]`, sms.Failed, old},
+		{"failures", `["+3"]`, sms.Failed, time.Now().Add(time.Minute)},
+	} {
+		if _, err := app.DB.ExecContext(ctx, insertEvent, 5, e.id, e.recipients, e.status, e.at); err != nil {
+			t.Fatalf("seed event: %v", err)
+		}
+	}
+
+	passed, err := ScanStatusEvents(ctx, 10)
+	if err != nil {
+		t.Fatalf("scan: %v", err)
+	}
+	// The last event is not settled yet.
+	if passed != 4 {
+		t.Fatalf("passed %d events, want 4", passed)
+	}
+	if rows, err := claimReceipts(ctx, []string{"other"}, 10); err != nil || len(rows) != 0 {
+		t.Fatalf("claimed %d receipts of another account, %v", len(rows), err)
+	}
+	rows, err := claimReceipts(ctx, []string{"shop"}, 10)
+	if err != nil {
+		t.Fatalf("claim: %v", err)
+	}
+	// Only the final status of "all" asks for receipts, one per recipient.
+	if len(rows) != 2 || rows[0].SmsIdentifier != "all" || rows[0].Status != sms.Done || rows[0].Attempts != 1 || !strings.HasPrefix(rows[0].Recipient, "+") {
+		t.Fatalf("claimed %+v", rows)
+	}
+	// Claimed receipts are leased.
+	if again, err := claimReceipts(ctx, []string{"shop"}, 10); err != nil || len(again) != 0 {
+		t.Fatalf("claimed %d leased receipts, %v", len(again), err)
+	}
+	if err := deleteReceipt(ctx, rows[0].ID); err != nil {
+		t.Fatalf("delete receipt: %v", err)
+	}
+
+	if passed, err := ScanStatusEvents(ctx, 10); err != nil || passed != 0 {
+		t.Fatalf("rescan passed %d, %v", passed, err)
+	}
+}
@@ -0,0 +1,115 @@
+package sms
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"sms-gateway/app"
+	"sms-gateway/config"
+	"sms-gateway/pkg/metrics"
+	amqp "sms-gateway/pkg/queue"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// bridgeBuffer is how many local events may wait for the bridge before they are not sent
+	// to other instances.
+	bridgeBuffer = 1024
+
+	bridgeRetryDelay = 5 * time.Second
+)
+
+// bridgeMessage is a status event on the fanout exchange. Origin lets an instance skip the
+// events it published itself, which its subscribers already got.
+type bridgeMessage struct {
+	Origin string `json:"origin"`
+	StatusEvent
+}
+
+var (
+	instanceID    = uuid.NewString()
+	bridgeRunning atomic.Bool
+	bridgeOut     = make(chan StatusEvent, bridgeBuffer)
+)
+
+// forwardStatus queues a local event for the other instances while the bridge runs.
+func forwardStatus(e StatusEvent) {
+	if !bridgeRunning.Load() {
+		return
+	}
+	select {
+	case bridgeOut <- e:
+	default:
+		metrics.StatusBridgeEvent("out", "dropped")
+	}
+}
+
+// StartStatusBridge shares status events with the other instances through the fanout exchange
+// RABBIT_STATUS_EXCHANGE until ctx is done, so a subscriber sees changes made anywhere. It
+// reconnects after errors; events of that gap reach remote subscribers only through replay.
+func StartStatusBridge(ctx context.Context) error {
+	bridgeRunning.Store(true)
+	defer bridgeRunning.Store(false)
+
+	for {
+		err := runStatusBridge(ctx)
+		if ctx.Err() != nil {
+			return nil
+		}
+		app.Logger.Error("status bridge", "err", err)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(bridgeRetryDelay):
+		}
+	}
+}
+
+func runStatusBridge(ctx context.Context) error {
+	conn, err := amqp.NewRabbitConnection(config.RabbitmqUri)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = conn.Close() }()
+
+	deliveries, err := conn.ConsumeFanout(ctx, config.AppName, config.StatusExchange)
+	if err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case e := <-bridgeOut:
+			body, err := json.Marshal(bridgeMessage{Origin: instanceID, StatusEvent: e})
+			if err != nil {
+				return err
+			}
+			if err := conn.PublishContext(ctx, amqp.PublishRequest{Exchange: config.StatusExchange, Msg: body}); err != nil {
+				metrics.StatusBridgeEvent("out", "error")
+				return err
+			}
+			metrics.StatusBridgeEvent("out", "ok")
+		case d, ok := <-deliveries:
+			if !ok {
+				return errors.New("status bridge deliveries closed")
+			}
+			var m bridgeMessage
+			if err := json.Unmarshal(d.Body, &m); err != nil {
+				app.Logger.Error("cannot unmarshal status event", "err", err)
+				metrics.StatusBridgeEvent("in", "error")
+				continue
+			}
+			if m.Origin == instanceID {
+				continue
+			}
+			hub.publish(m.StatusEvent)
+			metrics.StatusBridgeEvent("in", "ok")
+		}
+	}
+}
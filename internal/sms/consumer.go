@@ -60,7 +60,8 @@ func StartConsumers(ctx context.Context) error {
 
 			return nil
 		}),
-		0,
+		config.ConsumerPrefetch,
+		amqp.QueueArgs(model.MaxPriority),
 	)
 
 	normalConsumer := amqp.MakeConsumerWithWorkers(
@@ -90,7 +91,8 @@ func StartConsumers(ctx context.Context) error {
 
 			return nil
 		}),
-		0,
+		config.ConsumerPrefetch,
+		amqp.QueueArgs(model.MaxPriority),
 	)
 
 	go func() {
@@ -0,0 +1,127 @@
+package sms
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"sms-gateway/app"
+	"sms-gateway/internal/model"
+	"sms-gateway/pkg/metrics"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const statusEventPurgeBatchSize = 1000
+
+type statusEventRow struct {
+	ID            int64     `db:"id"`
+	CustomerID    int64     `db:"customer_id"`
+	SmsIdentifier string    `db:"sms_identifier"`
+	Recipients    []byte    `db:"recipients"`
+	Status        State     `db:"status"`
+	Provider      string    `db:"provider"`
+	CreatedAt     time.Time `db:"created_at"`
+}
+
+// recordStatusTx stores the status change of s in sms_status_events inside the transaction
+// that makes it, so a committed change always has its event, and returns the event with its id.
+func recordStatusTx(ctx context.Context, tx *sqlx.Tx, s model.SMS, state State, provider ...string) (StatusEvent, error) {
+	e := newStatusEvent(s, state, provider...)
+	recipients, err := json.Marshal(e.Recipients)
+	if err != nil {
+		return StatusEvent{}, err
+	}
+
+	const q = `INSERT INTO sms_status_events (customer_id, sms_identifier, recipients, status, provider) VALUES (?, ?, ?, ?, ?)`
+	execFn := metrics.DBExecObserver("insert_sms_status_event", func(c context.Context) error {
+		res, err := tx.ExecContext(c, q, e.CustomerID, e.SmsIdentifier, recipients, e.Status, e.Provider)
+		if err != nil {
+			return err
+		}
+		e.ID, err = res.LastInsertId()
+		return err
+	})
+	if err := execFn(ctx); err != nil {
+		return StatusEvent{}, err
+	}
+	return e, nil
+}
+
+// StatusEventsSince returns up to limit of customerID's recorded events after afterID, oldest
+// first. Events older than STATUS_EVENT_RETENTION_SEC are gone.
+func StatusEventsSince(ctx context.Context, customerID, afterID int64, limit int) ([]StatusEvent, error) {
+	const q = `
+		SELECT id, customer_id, sms_identifier, recipients, status, provider, created_at
+		FROM sms_status_events
+		WHERE customer_id = ? AND id > ?
+		ORDER BY id
+		LIMIT ?
+	`
+	var rows []statusEventRow
+	queryFn := metrics.DBExecObserver("select_sms_status_events", func(c context.Context) error {
+		return app.DB.SelectContext(c, &rows, q, customerID, afterID, limit)
+	})
+	if err := queryFn(ctx); err != nil {
+		return nil, err
+	}
+
+	events := make([]StatusEvent, 0, len(rows))
+	for _, r := range rows {
+		e := StatusEvent{
+			ID:            r.ID,
+			CustomerID:    r.CustomerID,
+			SmsIdentifier: r.SmsIdentifier,
+			Status:        r.Status,
+			Provider:      r.Provider,
+			Time:          r.CreatedAt.UTC(),
+		}
+		if err := json.Unmarshal(r.Recipients, &e.Recipients); err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, nil
+}
+
+// PurgeStatusEvents deletes events older than retention, at most limit of them, and returns how
+// many it deleted.
+func PurgeStatusEvents(ctx context.Context, retention time.Duration, limit int) (int64, error) {
+	const q = `DELETE FROM sms_status_events WHERE created_at <= CURRENT_TIMESTAMP - INTERVAL ? SECOND LIMIT ?`
+	var n int64
+	execFn := metrics.DBExecObserver("purge_sms_status_events", func(c context.Context) error {
+		res, err := app.DB.ExecContext(c, q, int64(retention.Seconds()), limit)
+		if err != nil {
+			return err
+		}
+		n, err = res.RowsAffected()
+		return err
+	})
+	if err := execFn(ctx); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// StartStatusEventPurger deletes events older than retention every interval until ctx is done.
+func StartStatusEventPurger(ctx context.Context, interval, retention time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+		for {
+			n, err := PurgeStatusEvents(ctx, retention, statusEventPurgeBatchSize)
+			if err != nil {
+				app.Logger.Error("purge status events", "err", err)
+				break
+			}
+			if n < statusEventPurgeBatchSize {
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package sms
+
+import (
+	"sync"
+	"time"
+
+	"sms-gateway/internal/model"
+	"sms-gateway/pkg/metrics"
+)
+
+// subscriberBuffer is how many events a subscriber may fall behind before it misses some.
+const subscriberBuffer = 256
+
+// StatusEvent is a committed status change of some recipients of one message. ID orders the
+// events of a customer and is what a client resumes from.
+type StatusEvent struct {
+	ID            int64     `json:"id"`
+	CustomerID    int64     `json:"customer_id"`
+	SmsIdentifier string    `json:"sms_identifier"`
+	Recipients    []string  `json:"recipients"`
+	Status        State     `json:"status"`
+	Provider      string    `json:"provider,omitempty"`
+	Time          time.Time `json:"time"`
+}
+
+type statusHub struct {
+	mu     sync.RWMutex
+	subs   map[int64]map[chan StatusEvent]struct{}
+	closed bool
+}
+
+var hub = &statusHub{subs: map[int64]map[chan StatusEvent]struct{}{}}
+
+// SubscribeStatus streams the status changes of customerID's messages, made by this instance
+// or, while StartStatusBridge runs, by any other. A subscriber that does not keep up misses
+// events rather than slowing down sending. cancel must be called once the caller stops
+// reading; it closes the channel unless CloseStatusSubscribers already did.
+func SubscribeStatus(customerID int64) (events <-chan StatusEvent, cancel func()) {
+	return hub.subscribe(customerID)
+}
+
+func (h *statusHub) subscribe(customerID int64) (<-chan StatusEvent, func()) {
+	ch := make(chan StatusEvent, subscriberBuffer)
+
+	h.mu.Lock()
+	if h.closed {
+		h.mu.Unlock()
+		close(ch)
+		return ch, func() {}
+	}
+	if h.subs[customerID] == nil {
+		h.subs[customerID] = map[chan StatusEvent]struct{}{}
+	}
+	h.subs[customerID][ch] = struct{}{}
+	h.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			h.mu.Lock()
+			defer h.mu.Unlock()
+			if _, ok := h.subs[customerID][ch]; !ok {
+				return
+			}
+			delete(h.subs[customerID], ch)
+			if len(h.subs[customerID]) == 0 {
+				delete(h.subs, customerID)
+			}
+			close(ch)
+		})
+	}
+}
+
+// CloseStatusSubscribers closes every subscription, and those made later, so that open streams
+// end; it is called when the server shuts down.
+func CloseStatusSubscribers() {
+	hub.closeAll()
+}
+
+func (h *statusHub) closeAll() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, chans := range h.subs {
+		for ch := range chans {
+			close(ch)
+		}
+	}
+	h.subs = map[int64]map[chan StatusEvent]struct{}{}
+	h.closed = true
+}
+
+func (h *statusHub) publish(e StatusEvent) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for ch := range h.subs[e.CustomerID] {
+		select {
+		case ch <- e:
+		default:
+			metrics.StatusEventDropped()
+		}
+	}
+}
+
+// PublishStatus tells subscribers on every instance about e, which SubmitTx or
+// UpdateSMSStatusTx recorded with the status change. Call it only after that transaction
+// committed; ingresses that commit SubmitTx themselves call it after their commit. Clients that
+// miss it read it back from sms_status_events.
+func PublishStatus(e StatusEvent) {
+	hub.publish(e)
+	forwardStatus(e)
+}
+
+func newStatusEvent(s model.SMS, state State, provider ...string) StatusEvent {
+	e := StatusEvent{
+		CustomerID:    s.CustomerID,
+		SmsIdentifier: s.SmsIdentifier,
+		Recipients:    s.Recipients,
+		Status:        state,
+		Time:          time.Now().UTC(),
+	}
+	if len(provider) > 0 {
+		e.Provider = provider[0]
+	}
+	return e
+}
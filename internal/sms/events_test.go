@@ -0,0 +1,68 @@
+package sms
+
+import (
+	"testing"
+
+	"sms-gateway/internal/model"
+)
+
+func TestSubscribeStatus(t *testing.T) {
+	events, cancel := SubscribeStatus(7)
+	other, cancelOther := SubscribeStatus(8)
+	defer cancelOther()
+
+	hub.publish(newStatusEvent(model.SMS{CustomerID: 7, SmsIdentifier: "a", Recipients: []string{"1"}}, Done, "operatorA"))
+
+	select {
+	case e := <-events:
+		if e.SmsIdentifier != "a" || e.Status != Done || e.Provider != "operatorA" {
+			t.Fatalf("unexpected event %+v", e)
+		}
+	default:
+		t.Fatal("no event for subscriber")
+	}
+	select {
+	case e := <-other:
+		t.Fatalf("event of another customer delivered: %+v", e)
+	default:
+	}
+
+	cancel()
+	cancel()
+	if _, ok := <-events; ok {
+		t.Fatal("channel still open after cancel")
+	}
+	// Publishing without subscribers must not block or panic.
+	hub.publish(newStatusEvent(model.SMS{CustomerID: 7, SmsIdentifier: "b"}, Failed))
+}
+
+func TestSubscribeStatus_SlowSubscriber(t *testing.T) {
+	events, cancel := SubscribeStatus(9)
+	defer cancel()
+
+	for i := 0; i < subscriberBuffer+10; i++ {
+		hub.publish(newStatusEvent(model.SMS{CustomerID: 9, SmsIdentifier: "x"}, Sending))
+	}
+	if len(events) != subscriberBuffer {
+		t.Fatalf("buffered %d events, want %d", len(events), subscriberBuffer)
+	}
+}
+
+func TestCloseStatusSubscribers(t *testing.T) {
+	h := &statusHub{subs: map[int64]map[chan StatusEvent]struct{}{}}
+	events, cancel := h.subscribe(7)
+
+	h.closeAll()
+	if _, ok := <-events; ok {
+		t.Fatal("channel still open after closeAll")
+	}
+	// cancel after closeAll must not close the channel twice.
+	cancel()
+
+	late, cancelLate := h.subscribe(7)
+	defer cancelLate()
+	if _, ok := <-late; ok {
+		t.Fatal("subscription after closeAll is open")
+	}
+	h.publish(newStatusEvent(model.SMS{CustomerID: 7, SmsIdentifier: "c"}, Done))
+}
@@ -1,110 +1,94 @@
 package sms
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
 	"sms-gateway/app"
 	"sms-gateway/config"
+	"sms-gateway/internal/auth"
 	"sms-gateway/internal/balance"
 	"sms-gateway/internal/model"
 	"sms-gateway/internal/outbox"
-	"sms-gateway/pkg/tracing"
+	"sms-gateway/pkg/apierror"
+	"sms-gateway/pkg/metrics"
+	"strconv"
+	"strings"
 
-	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
 	"github.com/labstack/echo/v4"
 )
 
 // SendHandler godoc
 // @Summary      Send SMS request
-// @Description  Deducts balance, enqueues SMS for processing, returns processing ack
+// @Description  Checks send quotas and rate limits and content policy, deducts balance, enqueues SMS for processing (or holds it for review), returns processing ack
 // @Tags         sms
 // @Accept       json
 // @Produce      json
-// @Param        request body model.SMS true "SMS request"
+// @Security     BearerAuth
+// @Param        request body model.SMS true "SMS request (customer_id is taken from the API key)"
+// @Param        Idempotency-Key header string false "Makes the request safe to retry; repeats return the first response"
 // @Success      200 {object} map[string]any "ack with sms_identifier"
-// @Failure      400 {string} string "invalid input"
-// @Failure      402 {string} string "dont have Not Enough Balance"
-// @Failure      500 {string} string "internal error"
+// @Failure      400 {object} apierror.Error "invalid input"
+// @Failure      401 {object} apierror.Error "unauthenticated"
+// @Failure      402 {object} apierror.Error "insufficient balance"
+// @Failure      422 {object} apierror.Error "message blocked by content policy"
+// @Failure      429 {object} apierror.Error "send limit exceeded"
+// @Failure      500 {object} apierror.Error "internal error"
 // @Router       /sms/send [post]
 func SendHandler(c echo.Context) error {
+	customerID, err := auth.CustomerID(c)
+	if err != nil {
+		return err
+	}
+
 	var s model.SMS
 	if err := json.NewDecoder(c.Request().Body).Decode(&s); err != nil {
 		app.Logger.Error("invalid input ", "err", err)
 		return echo.NewHTTPError(http.StatusBadRequest, "invalid input")
 	}
+	s.CustomerID = customerID
 
-	ctxWithUser := tracing.WithUser(c.Request().Context(), fmt.Sprint(s.CustomerID))
-	c.SetRequest(c.Request().WithContext(ctxWithUser))
-
-	if len(s.Recipients) == 0 {
-		app.Logger.Error("zero recipients")
-		return echo.NewHTTPError(http.StatusBadRequest, "zero recipients")
-	}
-
-	s.SmsIdentifier = uuid.NewString()
-	// Atomic: deduct balance (user_transactions) + insert outbox (pending) in ONE DB transaction.
-	tx, err := app.DB.BeginTxx(c.Request().Context(), nil)
-	if err != nil {
-		app.Logger.Error("begin tx", "err", err)
-		return echo.NewHTTPError(http.StatusInternalServerError, "internal error")
-	}
-	defer func() {
-		_ = tx.Rollback()
-	}()
-
-	transactionID, err := balance.ChargeTx(c.Request().Context(), tx, balance.ChargeRequest{
-		CustomerID: s.CustomerID,
-		Quantity:   len(s.Recipients),
-		Type:       s.Type,
-	})
+	s, state, err := Send(c.Request().Context(), s)
 	if err != nil {
-		if errors.Is(err, balance.ErrInsufficientBalance) {
+		var (
+			re *RecipientError
+			le *LimitError
+		)
+		switch {
+		case errors.Is(err, ErrNoRecipients):
+			app.Logger.Error("zero recipients")
+			return apierror.New(http.StatusBadRequest, apierror.InvalidRecipient, err.Error())
+		case errors.As(err, &re):
+			return apierror.WithDetails(http.StatusBadRequest, apierror.InvalidRecipient, err.Error(),
+				map[string]any{"index": re.Index, "recipient": re.Recipient})
+		case errors.As(err, &le):
+			c.Response().Header().Set("Retry-After", strconv.Itoa(le.RetryAfterSeconds()))
+			return apierror.WithDetails(http.StatusTooManyRequests, le.Code(), err.Error(),
+				map[string]any{"limit": le.Limit, "retry_after_sec": le.RetryAfterSeconds()})
+		case errors.Is(err, ErrOverLimit):
+			return apierror.New(http.StatusBadRequest, apierror.OverLimit, err.Error())
+		case errors.Is(err, balance.ErrInsufficientBalance):
 			app.Logger.Error("User Has Not Enough Balance ", "user id ", s.CustomerID)
-			return echo.NewHTTPError(http.StatusPaymentRequired, "dont have Not Enough Balance ")
+			return apierror.New(http.StatusPaymentRequired, apierror.InsufficientBalance, "insufficient balance")
+		case errors.Is(err, ErrBlocked):
+			return apierror.New(http.StatusUnprocessableEntity, apierror.ContentBlocked, "message blocked by content policy")
+		case errors.Is(err, ErrPriorityOutOfRange):
+			return apierror.New(http.StatusBadRequest, apierror.PriorityOutOfRange, err.Error())
 		}
-		app.Logger.Error("ChargeTx ", "err", err)
-		return echo.NewHTTPError(http.StatusInternalServerError, "internal error")
-	}
-	s.TransactionID = transactionID
-
-	priority := 0
-	if s.Type == model.EXPRESS {
-		priority = 10
-	}
-
-	// Initial state: PENDING (inserted with the outbox record)
-	if err := InsertPendingTx(c.Request().Context(), tx, s); err != nil {
-		app.Logger.Error("insert sms pending", "err", err)
+		app.Logger.Error("send sms", "err", err)
 		return echo.NewHTTPError(http.StatusInternalServerError, "internal error")
 	}
 
-	// Store SMS message in outbox for the job to publish to Rabbit.
-	if err := outbox.InsertTx(c.Request().Context(), tx, outbox.Event{
-		AggregateType: "sms",
-		AggregateID:   s.SmsIdentifier,
-		EventType:     "sms.send",
-		Priority:      priority,
-		Status:        outbox.StatusPending,
-		Payload: map[string]any{
-			"exchange":       config.SmsExchange,
-			"routing_key":    getQueue(s.Type),
-			"sms":            s,
-			"transaction_id": s.TransactionID,
-		},
-	}); err != nil {
-		app.Logger.Error("insert outbox", "err", err)
-		return echo.NewHTTPError(http.StatusInternalServerError, "internal error")
-	}
-
-	if err := tx.Commit(); err != nil {
-		app.Logger.Error("commit tx", "err", err)
-		return echo.NewHTTPError(http.StatusInternalServerError, "internal error")
+	status := "processing"
+	if state == Held {
+		status = string(Held)
 	}
 
 	return c.JSON(http.StatusOK, map[string]string{
-		"status":         "processing",
+		"status":         status,
 		"sms_identifier": s.SmsIdentifier,
 	})
 }
@@ -115,18 +99,19 @@ func SendHandler(c echo.Context) error {
 // @Tags         sms
 // @Accept       json
 // @Produce      json
-// @Param        user_id query string true "User ID"
+// @Security     BearerAuth
 // @Param        status query string false "Filter by status (pending|sending|done|failed)"
 // @Param        sms_identifier query string false "Filter by sms_identifier"
 // @Success      200 {object} map[string]any
-// @Failure      400 {string} string "user_id is required"
-// @Failure      500 {string} string "internal error"
+// @Failure      401 {object} apierror.Error "unauthenticated"
+// @Failure      500 {object} apierror.Error "internal error"
 // @Router       /sms/history [get]
 func HistoryHandler(c echo.Context) error {
-	userID := c.QueryParam("user_id")
-	if userID == "" {
-		return echo.NewHTTPError(http.StatusBadRequest, "user_id is required")
+	customerID, err := auth.CustomerID(c)
+	if err != nil {
+		return err
 	}
+	userID := fmt.Sprint(customerID)
 
 	status := c.QueryParam("status")
 	smsIdentifier := c.QueryParam("sms_identifier")
@@ -143,6 +128,50 @@ func HistoryHandler(c echo.Context) error {
 	return c.JSON(http.StatusOK, out)
 }
 
+// insertOutboxTx stores the sms.send event the outbox publisher pushes to Rabbit.
+func insertOutboxTx(ctx context.Context, tx *sqlx.Tx, s model.SMS) error {
+	priority := defaultPriority(s.Type)
+	if s.Priority != nil {
+		priority = *s.Priority
+	}
+
+	return outbox.InsertTx(ctx, tx, outbox.Event{
+		AggregateType: "sms",
+		AggregateID:   s.SmsIdentifier,
+		EventType:     "sms.send",
+		Priority:      priority,
+		Status:        outbox.StatusPending,
+		Payload: map[string]any{
+			"exchange":       config.SmsExchange,
+			"routing_key":    getQueue(s.Type),
+			"sms":            s,
+			"transaction_id": s.TransactionID,
+		},
+	})
+}
+
+// RedactTextTx marks the sms.send event of a message so the publisher blanks its text once the
+// message is handed to Rabbit, for texts such as one-time codes that must not stay in the
+// database. A message held for review has no event yet; ErrNotQueued is returned for it.
+func RedactTextTx(ctx context.Context, tx *sqlx.Tx, smsIdentifier string) error {
+	const q = `UPDATE outbox_events SET payload = JSON_SET(payload, '$.redact', true) WHERE aggregate_type = 'sms' AND aggregate_id = ? AND event_type = 'sms.send'`
+	var rows int64
+	if err := metrics.DBExecObserver("update_outbox_redact", func(c context.Context) error {
+		res, err := tx.ExecContext(c, q, smsIdentifier)
+		if err != nil {
+			return err
+		}
+		rows, err = res.RowsAffected()
+		return err
+	})(ctx); err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrNotQueued
+	}
+	return nil
+}
+
 func getQueue(s model.Type) string {
 	switch s {
 	case model.NORMAL:
@@ -153,3 +182,18 @@ func getQueue(s model.Type) string {
 		return config.NormalQueue
 	}
 }
+
+// validRecipient accepts a phone number of up to 15 digits (E.164), with or without the
+// leading "+".
+func validRecipient(r string) bool {
+	digits := strings.TrimPrefix(r, "+")
+	if digits == "" || len(digits) > 15 {
+		return false
+	}
+	for _, ch := range digits {
+		if ch < '0' || ch > '9' {
+			return false
+		}
+	}
+	return true
+}
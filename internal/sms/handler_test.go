@@ -14,7 +14,9 @@ import (
 
 	"sms-gateway/app"
 	"sms-gateway/config"
+	"sms-gateway/internal/auth"
 	"sms-gateway/internal/model"
+	"sms-gateway/pkg/apierror"
 	amqp "sms-gateway/pkg/queue"
 
 	"github.com/labstack/echo/v4"
@@ -26,6 +28,11 @@ func initTestLogger() {
 	}
 }
 
+// authed returns req as authenticated for customerID, like auth.Middleware does.
+func authed(req *http.Request, customerID int64) *http.Request {
+	return req.WithContext(auth.WithCustomer(req.Context(), customerID))
+}
+
 func startApp(t *testing.T) func() {
 	t.Helper()
 	ctx := context.Background()
@@ -53,7 +60,7 @@ func startApp(t *testing.T) func() {
 func TestSendHandler_InvalidJSON(t *testing.T) {
 	initTestLogger()
 	e := echo.New()
-	req := httptest.NewRequest(http.MethodPost, "/sms/send", bytes.NewBufferString("{bad json"))
+	req := authed(httptest.NewRequest(http.MethodPost, "/sms/send", bytes.NewBufferString("{bad json")), 1)
 	rec := httptest.NewRecorder()
 	ctx := e.NewContext(req, rec)
 
@@ -67,8 +74,8 @@ func TestSendHandler_InvalidJSON(t *testing.T) {
 func TestSendHandler_ZeroRecipients(t *testing.T) {
 	initTestLogger()
 	e := echo.New()
-	body := `{"customer_id":1,"recipients":[],"type":"normal"}`
-	req := httptest.NewRequest(http.MethodPost, "/sms/send", bytes.NewBufferString(body))
+	body := `{"recipients":[],"type":"normal"}`
+	req := authed(httptest.NewRequest(http.MethodPost, "/sms/send", bytes.NewBufferString(body)), 1)
 	rec := httptest.NewRecorder()
 	ctx := e.NewContext(req, rec)
 
@@ -81,19 +88,37 @@ func TestSendHandler_ZeroRecipients(t *testing.T) {
 	}
 }
 
-func TestHistoryHandler_MissingUserID(t *testing.T) {
+func TestSendHandler_InvalidRecipient(t *testing.T) {
+	initTestLogger()
+	e := echo.New()
+	body := `{"recipients":["+98912000001","0912-abc"],"type":"normal"}`
+	req := authed(httptest.NewRequest(http.MethodPost, "/sms/send", bytes.NewBufferString(body)), 1)
+	rec := httptest.NewRecorder()
+	ctx := e.NewContext(req, rec)
+
+	err := SendHandler(ctx)
+	he, ok := err.(*echo.HTTPError)
+	if !ok || he.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %v", err)
+	}
+	if ae, ok := he.Message.(*apierror.Error); !ok || ae.Code != apierror.InvalidRecipient {
+		t.Fatalf("expected INVALID_RECIPIENT, got %#v", he.Message)
+	}
+}
+
+func TestHistoryHandler_Unauthenticated(t *testing.T) {
 	initTestLogger()
 	e := echo.New()
-	req := httptest.NewRequest(http.MethodGet, "/sms/history", nil)
+	req := httptest.NewRequest(http.MethodGet, "/sms/history?user_id=1", nil)
 	rec := httptest.NewRecorder()
 	ctx := e.NewContext(req, rec)
 
 	err := HistoryHandler(ctx)
 	if err == nil {
-		t.Fatalf("expected error when user_id missing")
+		t.Fatalf("expected error without an authenticated customer")
 	}
-	if he, ok := err.(*echo.HTTPError); !ok || he.Code != http.StatusBadRequest {
-		t.Fatalf("expected 400, got %v", err)
+	if he, ok := err.(*echo.HTTPError); !ok || he.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401, got %v", err)
 	}
 }
 
@@ -106,8 +131,8 @@ func TestSendHandler_BalanceError(t *testing.T) {
 	_ = app.DB.Close()
 
 	e := echo.New()
-	body := `{"customer_id":1,"recipients":["+1"],"type":"normal"}`
-	req := httptest.NewRequest(http.MethodPost, "/sms/send", bytes.NewBufferString(body))
+	body := `{"recipients":["+1"],"type":"normal"}`
+	req := authed(httptest.NewRequest(http.MethodPost, "/sms/send", bytes.NewBufferString(body)), 1)
 	rec := httptest.NewRecorder()
 	ctx := e.NewContext(req, rec)
 
@@ -131,8 +156,8 @@ func TestSendHandler_NotEnoughBalance(t *testing.T) {
 	_, _ = app.DB.ExecContext(context.Background(), "INSERT INTO user_balances (user_id, balance) VALUES (?, ?)", 1, 1)
 
 	e := echo.New()
-	body := `{"customer_id":1,"recipients":["+1","+2"],"type":"normal"}`
-	req := httptest.NewRequest(http.MethodPost, "/sms/send", bytes.NewBufferString(body))
+	body := `{"recipients":["+1","+2"],"type":"normal"}`
+	req := authed(httptest.NewRequest(http.MethodPost, "/sms/send", bytes.NewBufferString(body)), 1)
 	rec := httptest.NewRecorder()
 	ctx := e.NewContext(req, rec)
 
@@ -157,8 +182,8 @@ func TestSendHandler_DeductError(t *testing.T) {
 	_, _ = app.DB.ExecContext(context.Background(), "DROP TABLE user_balances")
 
 	e := echo.New()
-	body := `{"customer_id":1,"recipients":["+1"],"type":"normal"}`
-	req := httptest.NewRequest(http.MethodPost, "/sms/send", bytes.NewBufferString(body))
+	body := `{"recipients":["+1"],"type":"normal"}`
+	req := authed(httptest.NewRequest(http.MethodPost, "/sms/send", bytes.NewBufferString(body)), 1)
 	rec := httptest.NewRecorder()
 	ctx := e.NewContext(req, rec)
 
@@ -185,8 +210,8 @@ func TestSendHandler_PublishError(t *testing.T) {
 	_, _ = app.DB.ExecContext(context.Background(), "DROP TABLE outbox_events")
 
 	e := echo.New()
-	body := `{"customer_id":1,"recipients":["+1"],"type":"normal"}`
-	req := httptest.NewRequest(http.MethodPost, "/sms/send", bytes.NewBufferString(body))
+	body := `{"recipients":["+1"],"type":"normal"}`
+	req := authed(httptest.NewRequest(http.MethodPost, "/sms/send", bytes.NewBufferString(body)), 1)
 	rec := httptest.NewRecorder()
 	ctx := e.NewContext(req, rec)
 
@@ -209,8 +234,8 @@ func TestSendHandler_Success(t *testing.T) {
 	}
 
 	e := echo.New()
-	body := `{"customer_id":1,"recipients":["+1"],"type":"normal"}`
-	req := httptest.NewRequest(http.MethodPost, "/sms/send", bytes.NewBufferString(body))
+	body := `{"recipients":["+1"],"type":"normal"}`
+	req := authed(httptest.NewRequest(http.MethodPost, "/sms/send", bytes.NewBufferString(body)), 1)
 	rec := httptest.NewRecorder()
 	ctx := e.NewContext(req, rec)
 
@@ -230,7 +255,7 @@ func TestHistoryHandler_Error(t *testing.T) {
 	_ = app.DB.Close()
 
 	e := echo.New()
-	req := httptest.NewRequest(http.MethodGet, "/sms/history?user_id=1", nil)
+	req := authed(httptest.NewRequest(http.MethodGet, "/sms/history", nil), 1)
 	rec := httptest.NewRecorder()
 	ctx := e.NewContext(req, rec)
 
@@ -252,7 +277,7 @@ func TestHistoryHandler_Success(t *testing.T) {
 	}
 
 	e := echo.New()
-	req := httptest.NewRequest(http.MethodGet, "/sms/history?user_id=5&status=pending&sms_identifier=sid-1", nil)
+	req := authed(httptest.NewRequest(http.MethodGet, "/sms/history?status=pending&sms_identifier=sid-1", nil), 5)
 	rec := httptest.NewRecorder()
 	ctx := e.NewContext(req, rec)
 
@@ -275,3 +300,23 @@ func TestGetQueue(t *testing.T) {
 		t.Fatalf("unexpected queue for default: %s", q)
 	}
 }
+
+func TestSendHandler_PriorityOutOfRange(t *testing.T) {
+	initTestLogger()
+	cleanup := startApp(t)
+	t.Cleanup(cleanup)
+
+	_, _ = app.DB.ExecContext(context.Background(), "DELETE FROM priority_limits")
+	_, _ = app.DB.ExecContext(context.Background(), "INSERT INTO user_balances (user_id, balance) VALUES (?, ?) ON DUPLICATE KEY UPDATE balance = 1000", 1, 1000)
+
+	e := echo.New()
+	body := `{"recipients":["+1"],"type":"normal","priority":9}`
+	req := authed(httptest.NewRequest(http.MethodPost, "/sms/send", bytes.NewBufferString(body)), 1)
+	rec := httptest.NewRecorder()
+	ctx := e.NewContext(req, rec)
+
+	err := SendHandler(ctx)
+	if he, ok := err.(*echo.HTTPError); !ok || he.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %v", err)
+	}
+}
@@ -0,0 +1,322 @@
+package sms
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"sms-gateway/app"
+	"sms-gateway/pkg/apierror"
+	"sms-gateway/pkg/metrics"
+
+	"github.com/labstack/echo/v4"
+)
+
+var (
+	ErrInvalidSendLimits = errors.New("invalid send limits")
+	// ErrOverLimit means a single request is larger than one of the customer's limits, so
+	// retrying it can never succeed.
+	ErrOverLimit = errors.New("request exceeds a send limit")
+	// ErrLimitExceeded is matched by every *LimitError.
+	ErrLimitExceeded = errors.New("send limit exceeded")
+)
+
+// Names of the limits a send can be refused by.
+const (
+	LimitDailyQuota       = "daily_quota"
+	LimitMonthlyQuota     = "monthly_quota"
+	LimitRequestsPerSec   = "requests_per_sec"
+	LimitRecipientsPerSec = "recipients_per_sec"
+)
+
+// LimitError is returned by AdmitSend when the customer used up one of its limits.
+type LimitError struct {
+	Limit      string
+	RetryAfter time.Duration
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("%s exceeded, retry after %s", e.Limit, e.RetryAfter)
+}
+
+func (e *LimitError) Unwrap() error {
+	return ErrLimitExceeded
+}
+
+// RetryAfterSeconds is the Retry-After header value, rounded up to whole seconds.
+func (e *LimitError) RetryAfterSeconds() int {
+	return max(int((e.RetryAfter+time.Second-1)/time.Second), 1)
+}
+
+// Code tells quotas, which refill at the next day or month, from the per-second rate limits.
+func (e *LimitError) Code() apierror.Code {
+	if e.Limit == LimitDailyQuota || e.Limit == LimitMonthlyQuota {
+		return apierror.QuotaExceeded
+	}
+	return apierror.RateLimited
+}
+
+// SendLimits caps what a customer may send; 0 means unlimited. Quotas count recipients
+// (messages) per calendar day and month, rate limits count per second. Without a row a
+// customer is only limited by its balance.
+type SendLimits struct {
+	CustomerID       int64 `db:"customer_id" json:"customer_id"`
+	DailyQuota       int64 `db:"daily_quota" json:"daily_quota"`
+	MonthlyQuota     int64 `db:"monthly_quota" json:"monthly_quota"`
+	RequestsPerSec   int64 `db:"requests_per_sec" json:"requests_per_sec"`
+	RecipientsPerSec int64 `db:"recipients_per_sec" json:"recipients_per_sec"`
+}
+
+func (l SendLimits) Validate() error {
+	if l.CustomerID == 0 || l.DailyQuota < 0 || l.MonthlyQuota < 0 || l.RequestsPerSec < 0 || l.RecipientsPerSec < 0 {
+		return ErrInvalidSendLimits
+	}
+	return nil
+}
+
+// SendUsage is a customer's limits with what is used in the current day, month and second.
+type SendUsage struct {
+	SendLimits
+	DayUsed          int64 `db:"day_used" json:"day_used"`
+	MonthUsed        int64 `db:"month_used" json:"month_used"`
+	WindowRequests   int64 `db:"window_requests" json:"window_requests"`
+	WindowRecipients int64 `db:"window_recipients" json:"window_recipients"`
+	DayResetSec      int64 `db:"day_reset_sec" json:"day_reset_sec"`
+	MonthResetSec    int64 `db:"month_reset_sec" json:"month_reset_sec"`
+}
+
+// The counters live in the send_limits row and are reset lazily: a counter whose period
+// start is not the current day, month or second (all on the DB clock, so every API instance
+// agrees) counts as zero.
+const (
+	monthStartExpr       = `(CURRENT_DATE - INTERVAL (DAYOFMONTH(CURRENT_DATE) - 1) DAY)`
+	dayUsedExpr          = `IF(day_start <=> CURRENT_DATE, day_used, 0)`
+	monthUsedExpr        = `IF(month_start <=> ` + monthStartExpr + `, month_used, 0)`
+	windowRequestsExpr   = `IF(window_start = UNIX_TIMESTAMP(), window_requests, 0)`
+	windowRecipientsExpr = `IF(window_start = UNIX_TIMESTAMP(), window_recipients, 0)`
+)
+
+// AdmitSend counts a request for recipients messages against the customer's limits in one
+// conditional UPDATE, so concurrent requests on any number of API instances cannot overshoot
+// them. It returns a *LimitError (429) when a limit is used up, and ErrOverLimit (400) when the
+// request alone is larger than a limit. The returned release gives the quota back and must be
+// called when the send is not accepted after all.
+func AdmitSend(ctx context.Context, customerID int64, recipients int) (release func(), err error) {
+	n := int64(recipients)
+	// SET assignments see the columns already assigned, so the period starts go last.
+	const admitQ = `
+		UPDATE send_limits
+		SET day_used = ` + dayUsedExpr + ` + ?,
+		    month_used = ` + monthUsedExpr + ` + ?,
+		    window_requests = ` + windowRequestsExpr + ` + 1,
+		    window_recipients = ` + windowRecipientsExpr + ` + ?,
+		    day_start = CURRENT_DATE,
+		    month_start = ` + monthStartExpr + `,
+		    window_start = UNIX_TIMESTAMP()
+		WHERE customer_id = ?
+		  AND (daily_quota = 0 OR ` + dayUsedExpr + ` + ? <= daily_quota)
+		  AND (monthly_quota = 0 OR ` + monthUsedExpr + ` + ? <= monthly_quota)
+		  AND (requests_per_sec = 0 OR ` + windowRequestsExpr + ` + 1 <= requests_per_sec)
+		  AND (recipients_per_sec = 0 OR ` + windowRecipientsExpr + ` + ? <= recipients_per_sec)
+	`
+	noop := func() {}
+
+	// A second attempt covers a window that rolled over between the UPDATE and the read.
+	for attempt := 0; attempt < 2; attempt++ {
+		var rows int64
+		if err := metrics.DBExecObserver("update_send_limits_admit", func(c context.Context) error {
+			res, err := app.DB.ExecContext(c, admitQ, n, n, n, customerID, n, n, n)
+			if err != nil {
+				return err
+			}
+			rows, err = res.RowsAffected()
+			return err
+		})(ctx); err != nil {
+			return noop, err
+		}
+		if rows > 0 {
+			return func() { releaseSend(context.WithoutCancel(ctx), customerID, n) }, nil
+		}
+
+		u, err := GetSendUsage(ctx, customerID)
+		if err != nil {
+			return noop, err
+		}
+		if u == nil {
+			return noop, nil
+		}
+		if err := u.check(n); err != nil {
+			var le *LimitError
+			if errors.As(err, &le) {
+				metrics.SendLimited(le.Limit)
+			}
+			return noop, err
+		}
+	}
+	return noop, &LimitError{Limit: LimitRequestsPerSec, RetryAfter: time.Second}
+}
+
+// check returns the limit a request for n messages is refused by, if any.
+func (u SendUsage) check(n int64) error {
+	switch {
+	case u.DailyQuota > 0 && n > u.DailyQuota,
+		u.MonthlyQuota > 0 && n > u.MonthlyQuota,
+		u.RecipientsPerSec > 0 && n > u.RecipientsPerSec:
+		return fmt.Errorf("%w: %d recipients", ErrOverLimit, n)
+	case u.MonthlyQuota > 0 && u.MonthUsed+n > u.MonthlyQuota:
+		return &LimitError{Limit: LimitMonthlyQuota, RetryAfter: time.Duration(u.MonthResetSec) * time.Second}
+	case u.DailyQuota > 0 && u.DayUsed+n > u.DailyQuota:
+		return &LimitError{Limit: LimitDailyQuota, RetryAfter: time.Duration(u.DayResetSec) * time.Second}
+	case u.RequestsPerSec > 0 && u.WindowRequests+1 > u.RequestsPerSec:
+		return &LimitError{Limit: LimitRequestsPerSec, RetryAfter: time.Second}
+	case u.RecipientsPerSec > 0 && u.WindowRecipients+n > u.RecipientsPerSec:
+		return &LimitError{Limit: LimitRecipientsPerSec, RetryAfter: time.Second}
+	}
+	return nil
+}
+
+// releaseSend gives back quota counted by AdmitSend for a send that was not accepted. Requests
+// stay counted against the rate limits.
+func releaseSend(ctx context.Context, customerID, n int64) {
+	const q = `
+		UPDATE send_limits
+		SET day_used = IF(day_start <=> CURRENT_DATE, GREATEST(day_used - ?, 0), day_used),
+		    month_used = IF(month_start <=> ` + monthStartExpr + `, GREATEST(month_used - ?, 0), month_used)
+		WHERE customer_id = ?
+	`
+	if err := metrics.DBExecObserver("update_send_limits_release", func(c context.Context) error {
+		_, err := app.DB.ExecContext(c, q, n, n, customerID)
+		return err
+	})(ctx); err != nil {
+		app.Logger.Error("release send quota", "customer_id", customerID, "err", err)
+	}
+}
+
+// GetSendUsage returns the customer's limits and current usage, or nil when it has no limits.
+func GetSendUsage(ctx context.Context, customerID int64) (*SendUsage, error) {
+	const q = `
+		SELECT customer_id, daily_quota, monthly_quota, requests_per_sec, recipients_per_sec,
+		       ` + dayUsedExpr + ` AS day_used, ` + monthUsedExpr + ` AS month_used,
+		       ` + windowRequestsExpr + ` AS window_requests, ` + windowRecipientsExpr + ` AS window_recipients,
+		       TIMESTAMPDIFF(SECOND, NOW(), CURRENT_DATE + INTERVAL 1 DAY) AS day_reset_sec,
+		       TIMESTAMPDIFF(SECOND, NOW(), ` + monthStartExpr + ` + INTERVAL 1 MONTH) AS month_reset_sec
+		FROM send_limits
+		WHERE customer_id = ?
+	`
+	var u SendUsage
+	queryFn := metrics.DBExecObserver("select_send_limits", func(c context.Context) error {
+		return app.DB.GetContext(c, &u, q, customerID)
+	})
+	if err := queryFn(ctx); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &u, nil
+}
+
+// SetSendLimits sets the customer's limits; the current counters are kept.
+func SetSendLimits(ctx context.Context, l SendLimits) error {
+	if err := l.Validate(); err != nil {
+		return err
+	}
+
+	const q = `
+		INSERT INTO send_limits (customer_id, daily_quota, monthly_quota, requests_per_sec, recipients_per_sec) VALUES (?, ?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE daily_quota = VALUES(daily_quota), monthly_quota = VALUES(monthly_quota),
+			requests_per_sec = VALUES(requests_per_sec), recipients_per_sec = VALUES(recipients_per_sec)
+	`
+	execFn := metrics.DBExecObserver("upsert_send_limits", func(c context.Context) error {
+		_, err := app.DB.ExecContext(c, q, l.CustomerID, l.DailyQuota, l.MonthlyQuota, l.RequestsPerSec, l.RecipientsPerSec)
+		return err
+	})
+	return execFn(ctx)
+}
+
+// SendLimitsPayload represents the request body for setting a customer's send limits.
+type SendLimitsPayload struct {
+	DailyQuota       int64 `json:"daily_quota"`
+	MonthlyQuota     int64 `json:"monthly_quota"`
+	RequestsPerSec   int64 `json:"requests_per_sec"`
+	RecipientsPerSec int64 `json:"recipients_per_sec"`
+}
+
+// GetSendLimitsHandler godoc
+// @Summary      Get customer send limits
+// @Description  Returns the customer's quotas and rate limits with the current usage
+// @Tags         admin
+// @Produce      json
+// @Security     AdminAuth
+// @Param        customer_id path int true "Customer ID"
+// @Success      200 {object} SendUsage
+// @Failure      400 {object} apierror.Error "invalid customer_id"
+// @Failure      401 {object} apierror.Error "unauthenticated"
+// @Failure      404 {object} apierror.Error "no limits set"
+// @Failure      500 {object} apierror.Error "internal error"
+// @Router       /admin/send-limits/{customer_id} [get]
+func GetSendLimitsHandler(c echo.Context) error {
+	customerID, err := strconv.ParseInt(c.Param("customer_id"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid customer_id")
+	}
+
+	usage, err := GetSendUsage(c.Request().Context(), customerID)
+	if err != nil {
+		app.Logger.Error("get send limits", "customer_id", customerID, "err", err)
+		return err
+	}
+	if usage == nil {
+		return echo.NewHTTPError(http.StatusNotFound, "no limits set")
+	}
+
+	return c.JSON(http.StatusOK, usage)
+}
+
+// SetSendLimitsHandler godoc
+// @Summary      Set customer send limits
+// @Description  Sets daily/monthly message quotas and per-second request/recipient rate limits; 0 means unlimited
+// @Tags         admin
+// @Accept       json
+// @Produce      json
+// @Security     AdminAuth
+// @Param        customer_id path int true "Customer ID"
+// @Param        request body SendLimitsPayload true "Send limits"
+// @Success      200 {string} string "done"
+// @Failure      400 {object} apierror.Error "invalid input"
+// @Failure      401 {object} apierror.Error "unauthenticated"
+// @Failure      500 {object} apierror.Error "internal error"
+// @Router       /admin/send-limits/{customer_id} [put]
+func SetSendLimitsHandler(c echo.Context) error {
+	customerID, err := strconv.ParseInt(c.Param("customer_id"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid customer_id")
+	}
+
+	var req SendLimitsPayload
+	if err := json.NewDecoder(c.Request().Body).Decode(&req); err != nil {
+		app.Logger.Error("invalid input ", "err", err)
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid input")
+	}
+
+	if err := SetSendLimits(c.Request().Context(), SendLimits{
+		CustomerID:       customerID,
+		DailyQuota:       req.DailyQuota,
+		MonthlyQuota:     req.MonthlyQuota,
+		RequestsPerSec:   req.RequestsPerSec,
+		RecipientsPerSec: req.RecipientsPerSec,
+	}); err != nil {
+		if errors.Is(err, ErrInvalidSendLimits) {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		app.Logger.Error("set send limits", "customer_id", customerID, "err", err)
+		return err
+	}
+
+	return c.JSON(http.StatusOK, "done")
+}
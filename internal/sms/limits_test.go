@@ -0,0 +1,135 @@
+package sms
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"sms-gateway/app"
+	"sms-gateway/testutil"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestSendUsageCheck(t *testing.T) {
+	cases := []struct {
+		name  string
+		usage SendUsage
+		n     int64
+		limit string
+		over  bool
+	}{
+		{name: "no limits", usage: SendUsage{DayUsed: 1000}, n: 5},
+		{name: "within quota", usage: SendUsage{SendLimits: SendLimits{DailyQuota: 10}, DayUsed: 5}, n: 5},
+		{name: "daily quota", usage: SendUsage{SendLimits: SendLimits{DailyQuota: 10}, DayUsed: 6, DayResetSec: 60}, n: 5, limit: LimitDailyQuota},
+		{name: "monthly before daily", usage: SendUsage{SendLimits: SendLimits{DailyQuota: 10, MonthlyQuota: 10}, DayUsed: 10, MonthUsed: 10, MonthResetSec: 3600}, n: 1, limit: LimitMonthlyQuota},
+		{name: "requests per second", usage: SendUsage{SendLimits: SendLimits{RequestsPerSec: 2}, WindowRequests: 2}, n: 1, limit: LimitRequestsPerSec},
+		{name: "recipients per second", usage: SendUsage{SendLimits: SendLimits{RecipientsPerSec: 10}, WindowRecipients: 8}, n: 3, limit: LimitRecipientsPerSec},
+		{name: "larger than a limit", usage: SendUsage{SendLimits: SendLimits{RecipientsPerSec: 10}}, n: 11, over: true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.usage.check(tc.n)
+			var le *LimitError
+			switch {
+			case tc.over:
+				if !errors.Is(err, ErrOverLimit) {
+					t.Fatalf("expected over limit, got %v", err)
+				}
+			case tc.limit != "":
+				if !errors.As(err, &le) || le.Limit != tc.limit || !errors.Is(err, ErrLimitExceeded) {
+					t.Fatalf("expected %s, got %v", tc.limit, err)
+				}
+				if le.RetryAfterSeconds() < 1 {
+					t.Fatalf("expected a retry after, got %v", le.RetryAfter)
+				}
+			default:
+				if err != nil {
+					t.Fatalf("expected admitted, got %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestLimitErrorRetryAfterSeconds(t *testing.T) {
+	if s := (&LimitError{RetryAfter: 1500 * time.Millisecond}).RetryAfterSeconds(); s != 2 {
+		t.Fatalf("expected rounding up to 2, got %d", s)
+	}
+}
+
+func TestAdmitSend_DailyQuota(t *testing.T) {
+	ctx := testutil.EnsureSetup(t)
+	testutil.ResetTables(ctx, t)
+
+	if _, err := AdmitSend(ctx, 41, 100); err != nil {
+		t.Fatalf("expected unlimited without a row, got %v", err)
+	}
+
+	if err := SetSendLimits(ctx, SendLimits{CustomerID: 41, DailyQuota: 5}); err != nil {
+		t.Fatalf("set limits: %v", err)
+	}
+	if _, err := AdmitSend(ctx, 41, 3); err != nil {
+		t.Fatalf("admit: %v", err)
+	}
+	release, err := AdmitSend(ctx, 41, 2)
+	if err != nil {
+		t.Fatalf("admit: %v", err)
+	}
+	var le *LimitError
+	if _, err := AdmitSend(ctx, 41, 1); !errors.As(err, &le) || le.Limit != LimitDailyQuota || le.RetryAfter <= 0 {
+		t.Fatalf("expected daily quota, got %v", err)
+	}
+	if _, err := AdmitSend(ctx, 41, 6); !errors.Is(err, ErrOverLimit) {
+		t.Fatalf("expected over limit, got %v", err)
+	}
+
+	release()
+	if u, err := GetSendUsage(ctx, 41); err != nil || u.DayUsed != 3 || u.MonthUsed != 3 {
+		t.Fatalf("expected 3 used after release, got %+v err=%v", u, err)
+	}
+	if _, err := AdmitSend(ctx, 41, 2); err != nil {
+		t.Fatalf("expected released quota to be usable, got %v", err)
+	}
+}
+
+func TestSendHandler_RateLimited(t *testing.T) {
+	initTestLogger()
+	cleanup := startApp(t)
+	t.Cleanup(cleanup)
+
+	ctx := testutil.EnsureSetup(t)
+	testutil.ResetTables(ctx, t)
+	if _, err := app.DB.ExecContext(ctx, "INSERT INTO user_balances (user_id, balance) VALUES (?, ?)", 42, 1000); err != nil {
+		t.Fatalf("seed balance: %v", err)
+	}
+	if err := SetSendLimits(ctx, SendLimits{CustomerID: 42, RequestsPerSec: 1}); err != nil {
+		t.Fatalf("set limits: %v", err)
+	}
+
+	// Three requests in a row cannot all land in different seconds.
+	e := echo.New()
+	limited := 0
+	for i := 0; i < 3; i++ {
+		body := `{"recipients":["+1"],"type":"normal"}`
+		req := authed(httptest.NewRequest(http.MethodPost, "/sms/send", bytes.NewBufferString(body)), 42)
+		rec := httptest.NewRecorder()
+		err := SendHandler(e.NewContext(req, rec))
+		if err == nil {
+			continue
+		}
+		if he, ok := err.(*echo.HTTPError); !ok || he.Code != http.StatusTooManyRequests {
+			t.Fatalf("expected 429, got %v", err)
+		}
+		if rec.Header().Get("Retry-After") != "1" {
+			t.Fatalf("expected Retry-After 1, got %q", rec.Header().Get("Retry-After"))
+		}
+		limited++
+	}
+	if limited == 0 {
+		t.Fatalf("expected at least one limited request")
+	}
+}
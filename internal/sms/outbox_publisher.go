@@ -27,6 +27,9 @@ type smsOutboxPayload struct {
 	Transaction string    `json:"transaction_id"`
 }
 
+// redactText blanks sms.text of events marked by RedactTextTx once they are processed or failed.
+const redactText = `IF(JSON_CONTAINS_PATH(payload, 'one', '$.redact'), JSON_SET(payload, '$.sms.text', ''), payload)`
+
 const (
 	highPriorityMin = 5
 
@@ -165,15 +168,28 @@ func publishOne(ctx context.Context, r outboxRow) error {
 		return failOrRetry(ctx, r.ID, r.Attempts, err, &p)
 	}
 
+	// Events written before numeric priorities existed carry none; fall back to the type default.
+	priority := defaultPriority(p.SMS.Type)
+	if p.SMS.Priority != nil {
+		priority = *p.SMS.Priority
+	}
+	if priority < model.MinPriority {
+		priority = model.MinPriority
+	}
+	if priority > model.MaxPriority {
+		priority = model.MaxPriority
+	}
+
 	if err := app.Rabbit.PublishContext(ctx, amqp.PublishRequest{
 		Exchange: p.Exchange,
 		Key:      p.RoutingKey,
 		Msg:      msg,
+		Priority: uint8(priority),
 	}); err != nil {
 		return failOrRetry(ctx, r.ID, r.Attempts, err, &p)
 	}
 
-	_, err = app.DB.ExecContext(ctx, `UPDATE outbox_events SET status='processed', last_error=NULL WHERE id=?`, r.ID)
+	_, err = app.DB.ExecContext(ctx, `UPDATE outbox_events SET status='processed', last_error=NULL, payload=`+redactText+` WHERE id=?`, r.ID)
 	return err
 }
 
@@ -186,12 +202,12 @@ func failOrRetry(ctx context.Context, id int64, attempts int, cause error, paylo
 	nextRun := time.Now().Add(backoff)
 
 	if nextAttempts >= maxAttempts {
-		// Permanent failure: refund (best-effort) and mark failed.
+		// Permanent failure: release the hold (best-effort) and mark failed.
 		if payload != nil && payload.SMS.TransactionID != "" && payload.SMS.CustomerID != 0 {
-			_ = balance.Refund(ctx, model.SMS{CustomerID: payload.SMS.CustomerID, TransactionID: payload.SMS.TransactionID})
+			_ = balance.Release(ctx, model.SMS{CustomerID: payload.SMS.CustomerID, TransactionID: payload.SMS.TransactionID})
 		}
 		_, err := app.DB.ExecContext(ctx,
-			`UPDATE outbox_events SET status='failed', attempts=?, last_error=? WHERE id=?`,
+			`UPDATE outbox_events SET status='failed', attempts=?, last_error=?, payload=`+redactText+` WHERE id=?`,
 			nextAttempts, cause.Error(), id,
 		)
 		return err
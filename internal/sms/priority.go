@@ -0,0 +1,165 @@
+package sms
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"sms-gateway/app"
+	"sms-gateway/config"
+	"sms-gateway/internal/model"
+	"sms-gateway/pkg/metrics"
+
+	"github.com/labstack/echo/v4"
+)
+
+var ErrPriorityOutOfRange = errors.New("priority out of range")
+
+// PriorityLimits bounds the priorities a customer may request. Without a row a customer
+// may only lower the priority below the default of the message type.
+type PriorityLimits struct {
+	CustomerID  int64 `db:"customer_id" json:"customer_id"`
+	MinPriority int   `db:"min_priority" json:"min_priority"`
+	MaxPriority int   `db:"max_priority" json:"max_priority"`
+}
+
+func defaultPriority(t model.Type) int {
+	if t == model.EXPRESS {
+		return config.ExpressDefaultPriority
+	}
+	return config.NormalDefaultPriority
+}
+
+// resolvePriority returns the requested priority, or the type default, validated against the customer's limits.
+func resolvePriority(ctx context.Context, s model.SMS) (int, error) {
+	def := defaultPriority(s.Type)
+	if s.Priority == nil {
+		return def, nil
+	}
+
+	limits, err := GetPriorityLimits(ctx, s.CustomerID)
+	if err != nil {
+		return 0, err
+	}
+	if limits == nil {
+		limits = &PriorityLimits{CustomerID: s.CustomerID, MinPriority: model.MinPriority, MaxPriority: def}
+	}
+
+	p := *s.Priority
+	if p < limits.MinPriority || p > limits.MaxPriority {
+		return 0, fmt.Errorf("%w: allowed %d..%d", ErrPriorityOutOfRange, limits.MinPriority, limits.MaxPriority)
+	}
+	return p, nil
+}
+
+func GetPriorityLimits(ctx context.Context, customerID int64) (*PriorityLimits, error) {
+	const query = `SELECT customer_id, min_priority, max_priority FROM priority_limits WHERE customer_id = ?`
+	var limits PriorityLimits
+	queryFn := metrics.DBExecObserver("select_priority_limits", func(c context.Context) error {
+		return app.DB.GetContext(c, &limits, query, customerID)
+	})
+	if err := queryFn(ctx); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &limits, nil
+}
+
+func SetPriorityLimits(ctx context.Context, limits PriorityLimits) error {
+	if limits.MinPriority < model.MinPriority || limits.MaxPriority > model.MaxPriority || limits.MinPriority > limits.MaxPriority {
+		return fmt.Errorf("%w: limits must satisfy %d <= min <= max <= %d", ErrPriorityOutOfRange, model.MinPriority, model.MaxPriority)
+	}
+
+	const query = `
+		INSERT INTO priority_limits (customer_id, min_priority, max_priority) VALUES (?, ?, ?)
+		ON DUPLICATE KEY UPDATE min_priority = VALUES(min_priority), max_priority = VALUES(max_priority)
+	`
+	execFn := metrics.DBExecObserver("upsert_priority_limits", func(c context.Context) error {
+		_, err := app.DB.ExecContext(c, query, limits.CustomerID, limits.MinPriority, limits.MaxPriority)
+		return err
+	})
+	return execFn(ctx)
+}
+
+// PriorityLimitsPayload represents the request body for setting a customer's priority limits.
+type PriorityLimitsPayload struct {
+	MinPriority int `json:"min_priority"`
+	MaxPriority int `json:"max_priority"`
+}
+
+// GetPriorityLimitsHandler godoc
+// @Summary      Get customer priority limits
+// @Tags         admin
+// @Produce      json
+// @Security     AdminAuth
+// @Param        customer_id path int true "Customer ID"
+// @Success      200 {object} PriorityLimits
+// @Failure      400 {object} apierror.Error "invalid customer_id"
+// @Failure      401 {object} apierror.Error "unauthenticated"
+// @Failure      404 {object} apierror.Error "no limits set"
+// @Failure      500 {object} apierror.Error "internal error"
+// @Router       /admin/priority-limits/{customer_id} [get]
+func GetPriorityLimitsHandler(c echo.Context) error {
+	customerID, err := strconv.ParseInt(c.Param("customer_id"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid customer_id")
+	}
+
+	limits, err := GetPriorityLimits(c.Request().Context(), customerID)
+	if err != nil {
+		app.Logger.Error("get priority limits", "customer_id", customerID, "err", err)
+		return err
+	}
+	if limits == nil {
+		return echo.NewHTTPError(http.StatusNotFound, "no limits set")
+	}
+
+	return c.JSON(http.StatusOK, limits)
+}
+
+// SetPriorityLimitsHandler godoc
+// @Summary      Set customer priority limits
+// @Description  Sets the range of numeric priorities the customer may request
+// @Tags         admin
+// @Accept       json
+// @Produce      json
+// @Security     AdminAuth
+// @Param        customer_id path int true "Customer ID"
+// @Param        request body PriorityLimitsPayload true "Priority limits"
+// @Success      200 {string} string "done"
+// @Failure      400 {object} apierror.Error "invalid input"
+// @Failure      401 {object} apierror.Error "unauthenticated"
+// @Failure      500 {object} apierror.Error "internal error"
+// @Router       /admin/priority-limits/{customer_id} [put]
+func SetPriorityLimitsHandler(c echo.Context) error {
+	customerID, err := strconv.ParseInt(c.Param("customer_id"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid customer_id")
+	}
+
+	var req PriorityLimitsPayload
+	if err := json.NewDecoder(c.Request().Body).Decode(&req); err != nil {
+		app.Logger.Error("invalid input ", "err", err)
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid input")
+	}
+
+	if err := SetPriorityLimits(c.Request().Context(), PriorityLimits{
+		CustomerID:  customerID,
+		MinPriority: req.MinPriority,
+		MaxPriority: req.MaxPriority,
+	}); err != nil {
+		if errors.Is(err, ErrPriorityOutOfRange) {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		app.Logger.Error("set priority limits", "customer_id", customerID, "err", err)
+		return err
+	}
+
+	return c.JSON(http.StatusOK, "done")
+}
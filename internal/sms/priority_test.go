@@ -0,0 +1,39 @@
+package sms
+
+import (
+	"errors"
+	"testing"
+
+	"sms-gateway/internal/model"
+	"sms-gateway/testutil"
+)
+
+func TestResolvePriority(t *testing.T) {
+	ctx := testutil.EnsureSetup(t)
+	testutil.ResetTables(ctx, t)
+
+	if p, err := resolvePriority(ctx, model.SMS{CustomerID: 31, Type: model.EXPRESS}); err != nil || p != defaultPriority(model.EXPRESS) {
+		t.Fatalf("expected express default, got %d err=%v", p, err)
+	}
+
+	low := 0
+	if p, err := resolvePriority(ctx, model.SMS{CustomerID: 31, Type: model.NORMAL, Priority: &low}); err != nil || p != 0 {
+		t.Fatalf("expected lowered priority, got %d err=%v", p, err)
+	}
+
+	high := 9
+	if _, err := resolvePriority(ctx, model.SMS{CustomerID: 31, Type: model.NORMAL, Priority: &high}); !errors.Is(err, ErrPriorityOutOfRange) {
+		t.Fatalf("expected out of range without limits, got %v", err)
+	}
+
+	if err := SetPriorityLimits(ctx, PriorityLimits{CustomerID: 31, MinPriority: 0, MaxPriority: 9}); err != nil {
+		t.Fatalf("set limits: %v", err)
+	}
+	if p, err := resolvePriority(ctx, model.SMS{CustomerID: 31, Type: model.NORMAL, Priority: &high}); err != nil || p != 9 {
+		t.Fatalf("expected 9 within limits, got %d err=%v", p, err)
+	}
+
+	if err := SetPriorityLimits(ctx, PriorityLimits{CustomerID: 31, MinPriority: 5, MaxPriority: 11}); !errors.Is(err, ErrPriorityOutOfRange) {
+		t.Fatalf("expected invalid limits, got %v", err)
+	}
+}
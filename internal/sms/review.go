@@ -0,0 +1,311 @@
+package sms
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"sms-gateway/app"
+	"sms-gateway/config"
+	"sms-gateway/internal/balance"
+	"sms-gateway/internal/model"
+	"sms-gateway/internal/policy"
+	"sms-gateway/pkg/apierror"
+	"sms-gateway/pkg/metrics"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/labstack/echo/v4"
+)
+
+type reviewStatus string
+
+const (
+	ReviewHeld     reviewStatus = "held"
+	ReviewApproved reviewStatus = "approved"
+	ReviewRejected reviewStatus = "rejected"
+)
+
+var ErrHeldMessageNotFound = errors.New("held message not found or already reviewed")
+
+type HeldMessage struct {
+	SmsIdentifier string          `db:"sms_identifier" json:"sms_identifier"`
+	CustomerID    int64           `db:"customer_id" json:"customer_id"`
+	TransactionID string          `db:"transaction_id" json:"transaction_id"`
+	Payload       json.RawMessage `db:"payload" json:"sms"`
+	RuleID        int64           `db:"rule_id" json:"rule_id"`
+	Reason        string          `db:"reason" json:"reason"`
+	Status        reviewStatus    `db:"status" json:"status"`
+	ReviewedAt    *string         `db:"reviewed_at" json:"reviewed_at"`
+	CreatedAt     string          `db:"created_at" json:"created_at"`
+}
+
+func insertHeldMessageTx(ctx context.Context, tx *sqlx.Tx, s model.SMS, d policy.Decision) error {
+	b, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+
+	const q = `INSERT INTO held_messages (sms_identifier, customer_id, transaction_id, payload, rule_id, reason, status) VALUES (?, ?, ?, CAST(? AS JSON), ?, ?, ?)`
+	execFn := metrics.DBExecObserver("insert_held_message", func(c context.Context) error {
+		_, err := tx.ExecContext(c, q, s.SmsIdentifier, s.CustomerID, s.TransactionID, string(b), d.RuleID, d.Reason, ReviewHeld)
+		return err
+	})
+	return execFn(ctx)
+}
+
+func ListHeldMessages(ctx context.Context, status string, limit int) ([]HeldMessage, error) {
+	query := `SELECT sms_identifier, customer_id, transaction_id, payload, rule_id, COALESCE(reason, '') AS reason, status, reviewed_at, created_at FROM held_messages`
+	var args []any
+	if status != "" {
+		query += ` WHERE status = ?`
+		args = append(args, status)
+	}
+	query += ` ORDER BY created_at ASC LIMIT ?`
+	args = append(args, limit)
+
+	var out []HeldMessage
+	queryFn := metrics.DBExecObserver("select_held_messages", func(c context.Context) error {
+		return app.DB.SelectContext(c, &out, query, args...)
+	})
+	if err := queryFn(ctx); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ApproveHeld releases a held message into the normal outbox flow. Its balance hold gets a
+// fresh HOLD_TTL_SEC; if the hold already expired the message cannot be approved.
+func ApproveHeld(ctx context.Context, smsIdentifier string) error {
+	var ev StatusEvent
+	err := reviewHeld(ctx, smsIdentifier, ReviewApproved, func(tx *sqlx.Tx, s model.SMS) error {
+		if err := balance.ExtendHoldsTx(ctx, tx, s.TransactionID, time.Duration(config.HoldTTLSec)*time.Second); err != nil {
+			return err
+		}
+		var err error
+		if ev, err = UpdateSMSStatusTx(ctx, tx, s, Pending); err != nil {
+			return err
+		}
+		return insertOutboxTx(ctx, tx, s)
+	})
+	if err != nil {
+		return err
+	}
+	PublishStatus(ev)
+	return nil
+}
+
+// RejectHeld marks a held message as rejected and releases its balance hold.
+func RejectHeld(ctx context.Context, smsIdentifier string) error {
+	var ev StatusEvent
+	err := reviewHeld(ctx, smsIdentifier, ReviewRejected, func(tx *sqlx.Tx, s model.SMS) error {
+		var err error
+		if ev, err = UpdateSMSStatusTx(ctx, tx, s, Rejected); err != nil {
+			return err
+		}
+		return balance.ReleaseTx(ctx, tx, s)
+	})
+	if err != nil {
+		return err
+	}
+	PublishStatus(ev)
+	return nil
+}
+
+// heldExpiryBatchSize bounds how many overdue held messages one pass rejects.
+const heldExpiryBatchSize = 100
+
+// StartHeldExpirer rejects messages still waiting for review once their balance hold is past
+// REVIEW_HOLD_TTL_SEC, every interval until ctx is done. balance.StartHoldExpirer leaves those
+// holds alone, so a message is either approved in time or ends up rejected, never stuck held.
+func StartHeldExpirer(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+		for {
+			n, err := rejectOverdueHeld(ctx, heldExpiryBatchSize)
+			if err != nil {
+				app.Logger.Error("reject overdue held messages", "err", err)
+				break
+			}
+			if n > 0 {
+				app.Logger.Info("rejected overdue held messages", "count", n)
+			}
+			if n < heldExpiryBatchSize {
+				break
+			}
+		}
+	}
+}
+
+// rejectOverdueHeld rejects up to limit held messages whose hold is past its expiry, or was
+// already expired by an older version, and returns how many it rejected.
+func rejectOverdueHeld(ctx context.Context, limit int) (int, error) {
+	var ids []string
+	const selectQ = `
+		SELECT m.sms_identifier
+		FROM held_messages m
+		WHERE m.status = ?
+		  AND EXISTS (
+			SELECT 1 FROM balance_holds h
+			WHERE h.transaction_id = m.transaction_id
+			  AND (h.status = ? OR (h.status = ? AND h.expires_at <= CURRENT_TIMESTAMP))
+		  )
+		ORDER BY m.created_at
+		LIMIT ?
+	`
+	if err := metrics.DBExecObserver("select_overdue_held_messages", func(c context.Context) error {
+		return app.DB.SelectContext(c, &ids, selectQ, ReviewHeld, balance.HoldExpired, balance.HoldHeld, limit)
+	})(ctx); err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for _, id := range ids {
+		if err := RejectHeld(ctx, id); err != nil {
+			// Reviewed by an admin in the meantime.
+			if errors.Is(err, ErrHeldMessageNotFound) {
+				continue
+			}
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+// reviewHeld locks the held row, applies the outcome and flips its status in one DB transaction,
+// so concurrent approve/reject calls cannot both succeed.
+func reviewHeld(ctx context.Context, smsIdentifier string, outcome reviewStatus, apply func(*sqlx.Tx, model.SMS) error) (err error) {
+	tx, err := app.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	var payload json.RawMessage
+	const selectQ = `SELECT payload FROM held_messages WHERE sms_identifier = ? AND status = ? FOR UPDATE`
+	queryFn := metrics.DBExecObserver("select_held_message_for_update", func(c context.Context) error {
+		return tx.QueryRowxContext(c, selectQ, smsIdentifier, ReviewHeld).Scan(&payload)
+	})
+	if err = queryFn(ctx); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrHeldMessageNotFound
+		}
+		return err
+	}
+
+	var s model.SMS
+	if err = json.Unmarshal(payload, &s); err != nil {
+		return err
+	}
+
+	if err = apply(tx, s); err != nil {
+		return err
+	}
+
+	const updateQ = `UPDATE held_messages SET status = ?, reviewed_at = CURRENT_TIMESTAMP WHERE sms_identifier = ?`
+	execFn := metrics.DBExecObserver("update_held_message_status", func(c context.Context) error {
+		_, execErr := tx.ExecContext(c, updateQ, outcome, smsIdentifier)
+		return execErr
+	})
+	if err = execFn(ctx); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ListHeldHandler godoc
+// @Summary      List messages held for review
+// @Tags         admin
+// @Produce      json
+// @Security     AdminAuth
+// @Param        status query string false "Filter by review status (held|approved|rejected), default held"
+// @Param        limit query int false "Max rows (default 100)"
+// @Success      200 {object} map[string]any
+// @Failure      401 {object} apierror.Error "unauthenticated"
+// @Failure      500 {object} apierror.Error "internal error"
+// @Router       /admin/held-messages [get]
+func ListHeldHandler(c echo.Context) error {
+	status := c.QueryParam("status")
+	if status == "" {
+		status = string(ReviewHeld)
+	}
+	limit := 100
+	if v, err := strconv.Atoi(c.QueryParam("limit")); err == nil && v > 0 && v <= 1000 {
+		limit = v
+	}
+
+	messages, err := ListHeldMessages(c.Request().Context(), status, limit)
+	if err != nil {
+		app.Logger.Error("list held messages", "err", err)
+		return err
+	}
+
+	out := map[string]any{}
+	out["messages"] = messages
+
+	return c.JSON(http.StatusOK, out)
+}
+
+// ApproveHeldHandler godoc
+// @Summary      Approve held message
+// @Description  Moves a held message to pending and enqueues it for sending
+// @Tags         admin
+// @Produce      json
+// @Security     AdminAuth
+// @Param        sms_identifier path string true "SMS identifier"
+// @Success      200 {string} string "done"
+// @Failure      401 {object} apierror.Error "unauthenticated"
+// @Failure      404 {object} apierror.Error "held message not found"
+// @Failure      409 {object} apierror.Error "balance hold expired"
+// @Failure      500 {object} apierror.Error "internal error"
+// @Router       /admin/held-messages/{sms_identifier}/approve [post]
+func ApproveHeldHandler(c echo.Context) error {
+	return reviewHandler(c, ApproveHeld)
+}
+
+// RejectHeldHandler godoc
+// @Summary      Reject held message
+// @Description  Marks a held message as rejected and releases the customer's balance hold
+// @Tags         admin
+// @Produce      json
+// @Security     AdminAuth
+// @Param        sms_identifier path string true "SMS identifier"
+// @Success      200 {string} string "done"
+// @Failure      401 {object} apierror.Error "unauthenticated"
+// @Failure      404 {object} apierror.Error "held message not found"
+// @Failure      500 {object} apierror.Error "internal error"
+// @Router       /admin/held-messages/{sms_identifier}/reject [post]
+func RejectHeldHandler(c echo.Context) error {
+	return reviewHandler(c, RejectHeld)
+}
+
+func reviewHandler(c echo.Context, review func(context.Context, string) error) error {
+	smsIdentifier := c.Param("sms_identifier")
+	if err := review(c.Request().Context(), smsIdentifier); err != nil {
+		if errors.Is(err, ErrHeldMessageNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, "held message not found")
+		}
+		if errors.Is(err, balance.ErrNoActiveHold) {
+			return apierror.New(http.StatusConflict, apierror.HoldExpired, "balance hold expired")
+		}
+		app.Logger.Error("review held message", "sms_identifier", smsIdentifier, "err", err)
+		return err
+	}
+
+	return c.JSON(http.StatusOK, "done")
+}
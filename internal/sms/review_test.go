@@ -0,0 +1,147 @@
+package sms
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"sms-gateway/app"
+	"sms-gateway/internal/balance"
+	"sms-gateway/internal/policy"
+	"sms-gateway/testutil"
+
+	"github.com/labstack/echo/v4"
+)
+
+func sendHeld(t *testing.T) string {
+	t.Helper()
+	e := echo.New()
+	body := `{"text":"claim your prize at bit.ly/abc","recipients":["+1","+2"],"type":"normal"}`
+	req := authed(httptest.NewRequest(http.MethodPost, "/sms/send", bytes.NewBufferString(body)), 11)
+	rec := httptest.NewRecorder()
+	if err := SendHandler(e.NewContext(req, rec)); err != nil {
+		t.Fatalf("send handler err: %v", err)
+	}
+	var out map[string]string
+	if err := json.Unmarshal(rec.Body.Bytes(), &out); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if out["status"] != string(Held) {
+		t.Fatalf("expected held status, got %v", out)
+	}
+	return out["sms_identifier"]
+}
+
+func seedReview(t *testing.T) {
+	t.Helper()
+	ctx := testutil.EnsureSetup(t)
+	testutil.ResetTables(ctx, t)
+	if _, err := app.DB.ExecContext(ctx, "INSERT INTO user_balances (user_id, balance) VALUES (?, ?)", 11, 100); err != nil {
+		t.Fatalf("seed balance: %v", err)
+	}
+	if _, err := policy.CreateRule(ctx, policy.Rule{Kind: policy.KindDomain, Pattern: "bit.ly", Action: policy.Hold}); err != nil {
+		t.Fatalf("seed rule: %v", err)
+	}
+}
+
+func TestSendHandler_Blocked(t *testing.T) {
+	ctx := testutil.EnsureSetup(t)
+	testutil.ResetTables(ctx, t)
+	if _, err := policy.CreateRule(ctx, policy.Rule{Kind: policy.KindKeyword, Pattern: "password", Action: policy.Block}); err != nil {
+		t.Fatalf("seed rule: %v", err)
+	}
+
+	e := echo.New()
+	body := `{"text":"send your password","recipients":["+1"],"type":"normal"}`
+	req := authed(httptest.NewRequest(http.MethodPost, "/sms/send", bytes.NewBufferString(body)), 11)
+	rec := httptest.NewRecorder()
+	err := SendHandler(e.NewContext(req, rec))
+	if he, ok := err.(*echo.HTTPError); !ok || he.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected 422, got %v", err)
+	}
+}
+
+func TestRejectHeld_ReleasesHold(t *testing.T) {
+	seedReview(t)
+	ctx := testutil.EnsureSetup(t)
+
+	id := sendHeld(t)
+	if b, _ := balance.GetUserBalances(ctx, "11"); b.Available != 98 || b.Held != 2 {
+		t.Fatalf("expected 2 held, got %+v", b)
+	}
+
+	if err := RejectHeld(ctx, id); err != nil {
+		t.Fatalf("reject: %v", err)
+	}
+	if b, _ := balance.GetUserBalances(ctx, "11"); b.Balance != 100 || b.Held != 0 {
+		t.Fatalf("expected hold released, got %+v", b)
+	}
+	rows, _ := GetUserHistory(ctx, "11", string(Rejected), id)
+	if len(rows) != 2 {
+		t.Fatalf("expected 2 rejected rows, got %d", len(rows))
+	}
+
+	if err := RejectHeld(ctx, id); !errors.Is(err, ErrHeldMessageNotFound) {
+		t.Fatalf("expected second review to fail, got %v", err)
+	}
+}
+
+func TestApproveHeld_Enqueues(t *testing.T) {
+	seedReview(t)
+	ctx := testutil.EnsureSetup(t)
+
+	id := sendHeld(t)
+	if err := ApproveHeld(ctx, id); err != nil {
+		t.Fatalf("approve: %v", err)
+	}
+	rows, _ := GetUserHistory(ctx, "11", string(Pending), id)
+	if len(rows) != 2 {
+		t.Fatalf("expected 2 pending rows, got %d", len(rows))
+	}
+	var n int
+	if err := app.DB.GetContext(ctx, &n, "SELECT COUNT(*) FROM outbox_events WHERE aggregate_id = ?", id); err != nil || n != 1 {
+		t.Fatalf("expected one outbox event, got %d err=%v", n, err)
+	}
+}
+
+func TestApproveHeld_ExpiredHold(t *testing.T) {
+	seedReview(t)
+	ctx := testutil.EnsureSetup(t)
+
+	id := sendHeld(t)
+	if _, err := app.DB.ExecContext(ctx, "UPDATE balance_holds SET status = 'expired'"); err != nil {
+		t.Fatalf("expire holds: %v", err)
+	}
+	if err := ApproveHeld(ctx, id); !errors.Is(err, balance.ErrNoActiveHold) {
+		t.Fatalf("expected expired hold error, got %v", err)
+	}
+}
+
+func TestRejectOverdueHeld(t *testing.T) {
+	seedReview(t)
+	ctx := testutil.EnsureSetup(t)
+
+	overdue := sendHeld(t)
+	waiting := sendHeld(t)
+	if _, err := app.DB.ExecContext(ctx,
+		"UPDATE balance_holds h JOIN held_messages m ON m.transaction_id = h.transaction_id SET h.expires_at = CURRENT_TIMESTAMP - INTERVAL 1 MINUTE WHERE m.sms_identifier = ?", overdue); err != nil {
+		t.Fatalf("expire hold: %v", err)
+	}
+
+	n, err := rejectOverdueHeld(ctx, heldExpiryBatchSize)
+	if err != nil || n != 1 {
+		t.Fatalf("expected one rejected message, got %d err=%v", n, err)
+	}
+	if rows, _ := GetUserHistory(ctx, "11", string(Rejected), overdue); len(rows) != 2 {
+		t.Fatalf("expected 2 rejected rows, got %d", len(rows))
+	}
+	if b, _ := balance.GetUserBalances(ctx, "11"); b.Held != 2 {
+		t.Fatalf("expected only the waiting message held, got %+v", b)
+	}
+	if err := ApproveHeld(ctx, waiting); err != nil {
+		t.Fatalf("approve waiting message: %v", err)
+	}
+}
@@ -5,25 +5,212 @@ import (
 	"errors"
 	"fmt"
 	"sms-gateway/app"
+	"sms-gateway/config"
 	"sms-gateway/internal/balance"
 	"sms-gateway/internal/model"
 	"sms-gateway/internal/operator"
+	"sms-gateway/internal/policy"
+	"sms-gateway/internal/usage"
 	"sms-gateway/pkg/metrics"
 	"sms-gateway/pkg/tracing"
 	"strings"
+	"time"
 
+	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
 )
 
 type State string
 
 const (
-	Pending State = "pending"
-	Sending State = "sending"
-	Done    State = "done"
-	Failed  State = "failed"
+	Pending  State = "pending"
+	Held     State = "held"
+	Sending  State = "sending"
+	Done     State = "done"
+	Failed   State = "failed"
+	Rejected State = "rejected"
 )
 
+var (
+	ErrBlocked      = errors.New("message blocked by content policy")
+	ErrNoRecipients = errors.New("zero recipients")
+	ErrNotQueued    = errors.New("message is not queued for sending")
+)
+
+// RecipientError rejects a request whose recipient at Index is not a phone number.
+type RecipientError struct {
+	Index     int
+	Recipient string
+}
+
+func (e *RecipientError) Error() string {
+	return "invalid recipient"
+}
+
+// CheckRecipients returns ErrNoRecipients or a *RecipientError for the first recipient that
+// is not a phone number.
+func CheckRecipients(recipients []string) error {
+	if len(recipients) == 0 {
+		return ErrNoRecipients
+	}
+	for i, r := range recipients {
+		if !validRecipient(r) {
+			return &RecipientError{Index: i, Recipient: r}
+		}
+	}
+	return nil
+}
+
+// TxHook stores what an ingress keeps about a submitted message in the send transaction, so it
+// commits or rolls back with the message.
+type TxHook func(ctx context.Context, tx *sqlx.Tx, s model.SMS) error
+
+// Send is the customer send flow shared by every ingress: it validates the recipients, admits
+// the message against the customer's send limits and submits it. Limits that were taken are
+// given back when the submit fails.
+func Send(ctx context.Context, s model.SMS, hooks ...TxHook) (model.SMS, State, error) {
+	if err := CheckRecipients(s.Recipients); err != nil {
+		return s, "", err
+	}
+
+	release, err := AdmitSend(ctx, s.CustomerID, len(s.Recipients))
+	if err != nil {
+		return s, "", err
+	}
+
+	s, state, err := Submit(ctx, s, hooks...)
+	if err != nil {
+		release()
+		return s, "", err
+	}
+	return s, state, nil
+}
+
+// submitAttempts bounds how often Submit runs the send transaction after a deadlock.
+const submitAttempts = 3
+
+// Submit runs SubmitTx and then hooks in its own DB transaction. A charge can deadlock with a transfer or the
+// shard rebalancer on the payer's balance rows; the transaction is rolled back then and run
+// again, with a new SmsIdentifier.
+func Submit(ctx context.Context, s model.SMS, hooks ...TxHook) (model.SMS, State, error) {
+	var err error
+	for attempt := 0; attempt < submitAttempts; attempt++ {
+		if attempt > 0 {
+			app.Logger.Warn("retrying sms submit", "user id ", s.CustomerID, "attempt", attempt, "err", err)
+			time.Sleep(time.Duration(20*(1<<attempt)) * time.Millisecond)
+		}
+		var out model.SMS
+		var ev StatusEvent
+		out, ev, err = submitOnce(ctx, s, hooks)
+		if err == nil {
+			PublishStatus(ev)
+			return out, ev.Status, nil
+		}
+		if !balance.IsRetryable(err) {
+			return out, "", err
+		}
+	}
+	return s, "", err
+}
+
+func submitOnce(ctx context.Context, s model.SMS, hooks []TxHook) (_ model.SMS, _ StatusEvent, err error) {
+	tx, err := app.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return s, StatusEvent{}, err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	s, ev, err := SubmitTx(ctx, tx, s)
+	if err != nil {
+		return s, StatusEvent{}, err
+	}
+	for _, hook := range hooks {
+		if err = hook(ctx, tx, s); err != nil {
+			return s, StatusEvent{}, err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return s, StatusEvent{}, err
+	}
+	return s, ev, nil
+}
+
+// SubmitTx is the send flow shared by every ingress: content policy, ChargeTx, then either
+// PENDING rows + outbox event, or HELD rows when the policy asks for manual review.
+// It assigns SmsIdentifier and TransactionID and returns the recorded event of the initial
+// state, for PublishStatus once tx is committed.
+func SubmitTx(ctx context.Context, tx *sqlx.Tx, s model.SMS) (model.SMS, StatusEvent, error) {
+	if tx == nil {
+		return s, StatusEvent{}, errors.New("tx is required")
+	}
+	if len(s.Recipients) == 0 {
+		return s, StatusEvent{}, errors.New("no recipients")
+	}
+
+	priority, err := resolvePriority(ctx, s)
+	if err != nil {
+		return s, StatusEvent{}, err
+	}
+	s.Priority = &priority
+
+	decision, err := policy.Evaluate(ctx, s)
+	if err != nil {
+		return s, StatusEvent{}, err
+	}
+	if decision.Action == policy.Block {
+		app.Logger.Warn("sms blocked by content policy", "user id ", s.CustomerID, "rule_id", decision.RuleID, "reason", decision.Reason)
+		return s, StatusEvent{}, ErrBlocked
+	}
+
+	s.SmsIdentifier = uuid.NewString()
+	charge := balance.ChargeRequest{
+		CustomerID:    s.CustomerID,
+		Quantity:      len(s.Recipients),
+		Type:          s.Type,
+		Recipients:    s.Recipients,
+		SmsIdentifier: s.SmsIdentifier,
+	}
+	if decision.Action == policy.Hold {
+		// Review can take longer than a delivery; keep the hold until an admin decides.
+		charge.HoldTTL = time.Duration(config.ReviewHoldTTLSec) * time.Second
+	}
+	transactionID, err := balance.ChargeTx(ctx, tx, charge)
+	if err != nil {
+		return s, StatusEvent{}, err
+	}
+	s.TransactionID = transactionID
+
+	if decision.Action == policy.Hold {
+		// Held but parked: an admin approves (enqueue) or rejects (release) it later.
+		if err := InsertHeldTx(ctx, tx, s); err != nil {
+			return s, StatusEvent{}, err
+		}
+		if err := insertHeldMessageTx(ctx, tx, s, decision); err != nil {
+			return s, StatusEvent{}, err
+		}
+		ev, err := recordStatusTx(ctx, tx, s, Held)
+		return s, ev, err
+	}
+
+	// Initial state: PENDING (inserted with the outbox record)
+	if err := InsertPendingTx(ctx, tx, s); err != nil {
+		return s, StatusEvent{}, err
+	}
+
+	// Store SMS message in outbox for the job to publish to Rabbit.
+	if err := insertOutboxTx(ctx, tx, s); err != nil {
+		return s, StatusEvent{}, err
+	}
+
+	ev, err := recordStatusTx(ctx, tx, s, Pending)
+	return s, ev, err
+}
+
 func sendSms(ctx context.Context, s model.SMS) error {
 	ctx = tracing.WithUser(ctx, fmt.Sprint(s.CustomerID))
 	ctx, span := tracing.Start(ctx, "sms.send",
@@ -38,32 +225,84 @@ func sendSms(ctx context.Context, s model.SMS) error {
 	}
 
 	provider, err := operator.Send(ctx, s)
-	if err != nil {
+	var partial *operator.RecipientError
+	if err != nil && !errors.As(err, &partial) {
 		app.Logger.Error("err in sending msg to provider", "err", err)
 		if err := UpdateSMSStatus(ctx, s, Failed); err != nil {
 			app.Logger.Error("err in update sms status to failed", "err", err)
 			return err
 		}
-		if err := balance.Refund(ctx, s); err != nil {
-			app.Logger.Error("err in Refund ", "err", err)
+		if err := balance.Release(ctx, s); err != nil {
+			app.Logger.Error("err in Release ", "err", err)
 			return err
 		}
 		return err
 	}
 
-	if err := UpdateSMSStatus(ctx, s, Done, provider); err != nil {
+	delivered := s
+	if partial != nil {
+		app.Logger.Warn("sms partially failed", "user_id", s.CustomerID, "failed", len(partial.Failed), "err", partial.Err)
+		var failed model.SMS
+		delivered, failed = splitRecipients(s, partial.Failed)
+		if len(failed.Recipients) > 0 {
+			if err := UpdateSMSStatus(ctx, failed, Failed, provider); err != nil {
+				app.Logger.Error("err in update sms status to failed", "err", err)
+				return err
+			}
+			if err := balance.Release(ctx, failed); err != nil {
+				app.Logger.Error("err in Release ", "err", err)
+				return err
+			}
+		}
+		if len(delivered.Recipients) == 0 {
+			return nil
+		}
+	}
+
+	if err := UpdateSMSStatus(ctx, delivered, Done, provider); err != nil {
 		app.Logger.Error("err in update sms status to done", "err", err)
 		return err
 	}
+	if err := balance.Capture(ctx, delivered); err != nil {
+		app.Logger.Error("err in Capture ", "err", err)
+		return err
+	}
 
 	app.Logger.Info("sms processed successfully", "user_id", s.CustomerID, "type", s.Type)
 
 	return nil
 }
 
+// splitRecipients splits s into the recipients that were delivered and those listed in failed.
+func splitRecipients(s model.SMS, failed []string) (delivered, rest model.SMS) {
+	isFailed := make(map[string]bool, len(failed))
+	for _, r := range failed {
+		isFailed[r] = true
+	}
+	delivered, rest = s, s
+	delivered.Recipients, rest.Recipients = nil, nil
+	for _, r := range s.Recipients {
+		if isFailed[r] {
+			rest.Recipients = append(rest.Recipients, r)
+		} else {
+			delivered.Recipients = append(delivered.Recipients, r)
+		}
+	}
+	return delivered, rest
+}
+
 // InsertPendingTx inserts PENDING rows for each recipient inside the given DB transaction.
 // This should be called from the API flow when inserting the outbox event.
 func InsertPendingTx(ctx context.Context, tx *sqlx.Tx, s model.SMS) error {
+	return insertStatusTx(ctx, tx, s, Pending)
+}
+
+// InsertHeldTx inserts HELD rows for a message waiting for manual content review.
+func InsertHeldTx(ctx context.Context, tx *sqlx.Tx, s model.SMS) error {
+	return insertStatusTx(ctx, tx, s, Held)
+}
+
+func insertStatusTx(ctx context.Context, tx *sqlx.Tx, s model.SMS, state State) error {
 	if tx == nil {
 		return errors.New("tx is required")
 	}
@@ -78,18 +317,30 @@ func InsertPendingTx(ctx context.Context, tx *sqlx.Tx, s model.SMS) error {
 	// If the row already exists, keep it unchanged.
 	const prefix = `INSERT INTO sms_status (user_id,type,status,recipient,provider,sms_identifier,created_at,updated_at) VALUES `
 	const suffix = ` ON DUPLICATE KEY UPDATE updated_at = updated_at`
-	execFn := metrics.DBExecObserver("insert_sms_pending", func(c context.Context) error {
+	var inserted int64
+	execFn := metrics.DBExecObserver("insert_sms_"+string(state), func(c context.Context) error {
 		valueStrings := make([]string, 0, len(s.Recipients))
 		args := make([]any, 0, len(s.Recipients)*6)
 		for _, recipient := range s.Recipients {
 			valueStrings = append(valueStrings, "(?, ?, ?, ?, '', ?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)")
-			args = append(args, s.CustomerID, s.Type, Pending, recipient, s.SmsIdentifier)
+			args = append(args, s.CustomerID, s.Type, state, recipient, s.SmsIdentifier)
 		}
 		q := prefix + strings.Join(valueStrings, ",") + suffix
-		_, err := tx.ExecContext(c, q, args...)
+		res, err := tx.ExecContext(c, q, args...)
+		if err != nil {
+			return err
+		}
+		inserted, err = res.RowsAffected()
 		return err
 	})
-	return execFn(ctx)
+	if err := execFn(ctx); err != nil {
+		return err
+	}
+	// Rows that already existed report 0 affected rows and are not counted again.
+	if inserted == 0 {
+		return nil
+	}
+	return usage.RecordTx(ctx, tx, []usage.Delta{{UserID: s.CustomerID, Type: string(s.Type), Status: string(state), Messages: inserted}})
 }
 
 // InsertPending inserts PENDING rows for each recipient using the global DB connection.
@@ -108,7 +359,51 @@ func InsertPending(ctx context.Context, s model.SMS) error {
 
 // UpdateSMSStatus updates existing sms_status rows for each recipient.
 // This is used by the consumer/worker: PENDING -> SENDING -> DONE/FAILED.
-func UpdateSMSStatus(ctx context.Context, s model.SMS, state State, provider ...string) error {
+func UpdateSMSStatus(ctx context.Context, s model.SMS, state State, provider ...string) (err error) {
+	tx, err := app.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	ev, err := UpdateSMSStatusTx(ctx, tx, s, state, provider...)
+	if err != nil {
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+	PublishStatus(ev)
+	return nil
+}
+
+type statusRow struct {
+	UserID   int64      `db:"user_id"`
+	Type     model.Type `db:"type"`
+	Status   State      `db:"status"`
+	Provider string     `db:"provider"`
+	Day      time.Time  `db:"day"`
+}
+
+// UpdateSMSStatusTx is UpdateSMSStatus inside the given DB transaction. It returns the recorded
+// event of the change, for PublishStatus once tx is committed.
+func UpdateSMSStatusTx(ctx context.Context, tx *sqlx.Tx, s model.SMS, state State, provider ...string) (StatusEvent, error) {
+	if err := updateSMSStatusRowsTx(ctx, tx, s, state, provider...); err != nil {
+		return StatusEvent{}, err
+	}
+	return recordStatusTx(ctx, tx, s, state, provider...)
+}
+
+// updateSMSStatusRowsTx locks the rows first so the transition from their previous status and
+// provider can be recorded for the usage rollup.
+func updateSMSStatusRowsTx(ctx context.Context, tx *sqlx.Tx, s model.SMS, state State, provider ...string) error {
+	if tx == nil {
+		return errors.New("tx is required")
+	}
 	if len(s.Recipients) == 0 {
 		return errors.New("no recipients")
 	}
@@ -121,21 +416,39 @@ func UpdateSMSStatus(ctx context.Context, s model.SMS, state State, provider ...
 		providerName = provider[0]
 	}
 
+	in := "?" + strings.Repeat(",?", len(s.Recipients)-1)
+	args := make([]any, 0, 1+len(s.Recipients))
+	args = append(args, s.SmsIdentifier)
+	for _, recipient := range s.Recipients {
+		args = append(args, recipient)
+	}
+
+	var old []statusRow
+	selectQ := `SELECT user_id, type, status, provider, DATE(created_at) AS day FROM sms_status WHERE sms_identifier = ? AND recipient IN (` + in + `) FOR UPDATE`
+	if err := metrics.DBExecObserver("select_sms_status_for_update", func(c context.Context) error {
+		return tx.SelectContext(c, &old, selectQ, args...)
+	})(ctx); err != nil {
+		return err
+	}
+
 	// Batch update recipients in one query.
-	const qPrefix = `UPDATE sms_status SET status = ?, provider = ?, updated_at = CURRENT_TIMESTAMP WHERE sms_identifier = ? AND recipient IN (`
-	execFn := metrics.DBExecObserver("update_sms_status", func(c context.Context) error {
-		placeholders := make([]string, 0, len(s.Recipients))
-		args := make([]any, 0, 3+len(s.Recipients))
-		args = append(args, state, providerName, s.SmsIdentifier)
-		for _, recipient := range s.Recipients {
-			placeholders = append(placeholders, "?")
-			args = append(args, recipient)
-		}
-		q := qPrefix + strings.Join(placeholders, ",") + `)`
-		_, err := app.DB.ExecContext(c, q, args...)
+	updateQ := `UPDATE sms_status SET status = ?, provider = ?, updated_at = CURRENT_TIMESTAMP WHERE sms_identifier = ? AND recipient IN (` + in + `)`
+	if err := metrics.DBExecObserver("update_sms_status", func(c context.Context) error {
+		_, err := tx.ExecContext(c, updateQ, append([]any{state, providerName}, args...)...)
 		return err
-	})
-	return execFn(ctx)
+	})(ctx); err != nil {
+		return err
+	}
+
+	counts := map[statusRow]int64{}
+	for _, r := range old {
+		counts[r]++
+	}
+	var deltas []usage.Delta
+	for r, n := range counts {
+		deltas = append(deltas, usage.Transition(r.Day, r.UserID, string(r.Type), r.Provider, string(r.Status), providerName, string(state), n)...)
+	}
+	return usage.RecordTx(ctx, tx, deltas)
 }
 
 type UserHistory struct {
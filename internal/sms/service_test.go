@@ -3,8 +3,10 @@ package sms
 import (
 	"sms-gateway/testutil"
 	"testing"
+	"time"
 
 	"sms-gateway/internal/model"
+	"sms-gateway/internal/usage"
 )
 
 func TestUpdateSMS_InsertAndHistory(t *testing.T) {
@@ -68,3 +70,62 @@ func TestSendSms_NoRecipients(t *testing.T) {
 		t.Fatalf("expected error for no recipients")
 	}
 }
+
+func TestSplitRecipients(t *testing.T) {
+	s := model.SMS{CustomerID: 3, TransactionID: "tx", Recipients: []string{"+1", "+2", "+3"}}
+	delivered, failed := splitRecipients(s, []string{"+2"})
+	if len(delivered.Recipients) != 2 || delivered.Recipients[0] != "+1" || delivered.Recipients[1] != "+3" {
+		t.Fatalf("unexpected delivered recipients %v", delivered.Recipients)
+	}
+	if len(failed.Recipients) != 1 || failed.Recipients[0] != "+2" || failed.TransactionID != "tx" {
+		t.Fatalf("unexpected failed part %+v", failed)
+	}
+}
+
+func TestStatusTransitionsRollUpIntoUsage(t *testing.T) {
+	ctx := testutil.EnsureSetup(t)
+	testutil.ResetTables(ctx, t)
+
+	s := model.SMS{CustomerID: 42, Recipients: []string{"+1", "+2", "+3"}, Type: model.EXPRESS, SmsIdentifier: "usage-1"}
+	if err := InsertPending(ctx, s); err != nil {
+		t.Fatalf("insert pending: %v", err)
+	}
+	// Re-inserting is a no-op and must not be counted twice.
+	if err := InsertPending(ctx, s); err != nil {
+		t.Fatalf("insert pending again: %v", err)
+	}
+	if err := UpdateSMSStatus(ctx, s, Sending); err != nil {
+		t.Fatalf("sending: %v", err)
+	}
+	delivered, failed := splitRecipients(s, []string{"+3"})
+	if err := UpdateSMSStatus(ctx, delivered, Done, "op-a"); err != nil {
+		t.Fatalf("done: %v", err)
+	}
+	if err := UpdateSMSStatus(ctx, failed, Failed, "op-a"); err != nil {
+		t.Fatalf("failed: %v", err)
+	}
+
+	if _, err := usage.Fold(ctx, 1000); err != nil {
+		t.Fatalf("fold: %v", err)
+	}
+
+	customer := int64(42)
+	rows, err := usage.Report(ctx, usage.ReportRequest{
+		From:       time.Now().AddDate(0, 0, -1),
+		To:         time.Now().AddDate(0, 0, 1),
+		CustomerID: &customer,
+		GroupBy:    []usage.Dimension{usage.ByType, usage.ByProvider, usage.ByStatus},
+	})
+	if err != nil {
+		t.Fatalf("report: %v", err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("expected only final states, got %+v", rows)
+	}
+	if rows[0].Status != string(Done) || rows[0].Messages != 2 || rows[0].Provider != "op-a" || rows[0].Type != string(model.EXPRESS) {
+		t.Fatalf("unexpected done row %+v", rows[0])
+	}
+	if rows[1].Status != string(Failed) || rows[1].Messages != 1 {
+		t.Fatalf("unexpected failed row %+v", rows[1])
+	}
+}
@@ -0,0 +1,137 @@
+package sms
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"sms-gateway/app"
+	"sms-gateway/internal/auth"
+	"sms-gateway/pkg/metrics"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	streamReplayPageSize = 500
+	streamHeartbeat      = 15 * time.Second
+)
+
+// StreamStatusHandler godoc
+// @Summary      Stream SMS status changes
+// @Description  Server-Sent Events stream of the customer's status changes ("event: status", data is a status event). A client that reconnects with Last-Event-ID, or last_event_id, first gets the changes it missed, as far back as STATUS_EVENT_RETENTION_SEC.
+// @Tags         sms
+// @Produce      text/event-stream
+// @Security     BearerAuth
+// @Param        sms_identifier query string false "Only changes of this message"
+// @Param        Last-Event-ID header int false "Id of the last event received"
+// @Param        last_event_id query int false "Same as Last-Event-ID, for clients that cannot set headers"
+// @Success      200 {object} StatusEvent "one per event"
+// @Failure      400 {object} apierror.Error "invalid input"
+// @Failure      401 {object} apierror.Error "unauthenticated"
+// @Router       /sms/status/stream [get]
+func StreamStatusHandler(c echo.Context) error {
+	customerID, err := auth.CustomerID(c)
+	if err != nil {
+		return err
+	}
+
+	lastID := int64(0)
+	raw := c.Request().Header.Get("Last-Event-ID")
+	if raw == "" {
+		raw = c.QueryParam("last_event_id")
+	}
+	if raw != "" {
+		lastID, err = strconv.ParseInt(raw, 10, 64)
+		if err != nil || lastID < 0 {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid last event id")
+		}
+	}
+	smsIdentifier := c.QueryParam("sms_identifier")
+
+	// Subscribe before the replay so nothing committed in between is missed; live events the
+	// replay already sent are skipped by id.
+	events, cancel := SubscribeStatus(customerID)
+	defer cancel()
+
+	metrics.StatusStreamOpened()
+	defer metrics.StatusStreamClosed()
+
+	res := c.Response()
+	res.Header().Set(echo.HeaderContentType, "text/event-stream")
+	res.Header().Set(echo.HeaderCacheControl, "no-cache")
+	res.Header().Set("X-Accel-Buffering", "no")
+	res.WriteHeader(http.StatusOK)
+	res.Flush()
+
+	ctx := c.Request().Context()
+	send := func(e StatusEvent) error {
+		if smsIdentifier != "" && e.SmsIdentifier != smsIdentifier {
+			return nil
+		}
+		data, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		// Events that could not be recorded go out without an id, so a client resumes from the
+		// last one that was.
+		if e.ID > 0 {
+			_, err = fmt.Fprintf(res, "id: %d\nevent: status\ndata: %s\n\n", e.ID, data)
+		} else {
+			_, err = fmt.Fprintf(res, "event: status\ndata: %s\n\n", data)
+		}
+		if err != nil {
+			return err
+		}
+		res.Flush()
+		return nil
+	}
+
+	if lastID > 0 {
+		for {
+			page, err := StatusEventsSince(ctx, customerID, lastID, streamReplayPageSize)
+			if err != nil {
+				// The client reconnects with the same id and tries again.
+				app.Logger.Error("replay status events", "customer_id", customerID, "last_event_id", lastID, "err", err)
+				return nil
+			}
+			for _, e := range page {
+				if err := send(e); err != nil {
+					return nil
+				}
+				lastID = e.ID
+			}
+			if len(page) < streamReplayPageSize {
+				break
+			}
+		}
+	}
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(res, ": ping\n\n"); err != nil {
+				return nil
+			}
+			res.Flush()
+		case e, ok := <-events:
+			if !ok {
+				return nil
+			}
+			// Ids are only compared with the replay: events of other instances may arrive
+			// slightly out of order.
+			if e.ID > 0 && e.ID <= lastID {
+				continue
+			}
+			if err := send(e); err != nil {
+				return nil
+			}
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package sms
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"sms-gateway/app"
+	"sms-gateway/internal/model"
+	"sms-gateway/testutil"
+
+	"github.com/labstack/echo/v4"
+)
+
+// publishRecorded records a status change the way UpdateSMSStatusTx does and publishes it.
+func publishRecorded(ctx context.Context, t *testing.T, s model.SMS, state State, provider ...string) {
+	t.Helper()
+	tx, err := app.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		t.Fatalf("begin: %v", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+	e, err := recordStatusTx(ctx, tx, s, state, provider...)
+	if err != nil {
+		t.Fatalf("record status: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("commit: %v", err)
+	}
+	PublishStatus(e)
+}
+
+func TestStatusEventsSince(t *testing.T) {
+	ctx := testutil.EnsureSetup(t)
+	testutil.ResetTables(ctx, t)
+
+	publishRecorded(ctx, t, model.SMS{CustomerID: 21, SmsIdentifier: "a", Recipients: []string{"+1", "+2"}}, Pending)
+	publishRecorded(ctx, t, model.SMS{CustomerID: 22, SmsIdentifier: "b", Recipients: []string{"+3"}}, Pending)
+	publishRecorded(ctx, t, model.SMS{CustomerID: 21, SmsIdentifier: "a", Recipients: []string{"+1"}}, Done, "operatorA")
+
+	events, err := StatusEventsSince(ctx, 21, 0, 10)
+	if err != nil {
+		t.Fatalf("events since: %v", err)
+	}
+	if len(events) != 2 || events[0].ID >= events[1].ID {
+		t.Fatalf("expected two ordered events, got %+v", events)
+	}
+	if e := events[1]; e.Status != Done || e.Provider != "operatorA" || len(e.Recipients) != 1 || e.Recipients[0] != "+1" {
+		t.Fatalf("unexpected event %+v", e)
+	}
+
+	rest, err := StatusEventsSince(ctx, 21, events[0].ID, 10)
+	if err != nil {
+		t.Fatalf("events since: %v", err)
+	}
+	if len(rest) != 1 || rest[0].ID != events[1].ID {
+		t.Fatalf("expected the second event only, got %+v", rest)
+	}
+}
+
+func TestStreamStatusHandler_Resume(t *testing.T) {
+	ctx := testutil.EnsureSetup(t)
+	testutil.ResetTables(ctx, t)
+
+	publishRecorded(ctx, t, model.SMS{CustomerID: 23, SmsIdentifier: "a", Recipients: []string{"+1"}}, Pending)
+	publishRecorded(ctx, t, model.SMS{CustomerID: 23, SmsIdentifier: "a", Recipients: []string{"+1"}}, Sending)
+	events, err := StatusEventsSince(ctx, 23, 0, 10)
+	if err != nil || len(events) != 2 {
+		t.Fatalf("seed events: %v %+v", err, events)
+	}
+
+	reqCtx, cancel := context.WithCancel(context.Background())
+	req := authed(httptest.NewRequest(http.MethodGet, "/sms/status/stream", nil), 23).WithContext(reqCtx)
+	req.Header.Set("Last-Event-ID", strconv.FormatInt(events[0].ID, 10))
+	rec := httptest.NewRecorder()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- StreamStatusHandler(echo.New().NewContext(req, rec))
+	}()
+	// Let the replay run, then wait for a live event before the client leaves.
+	time.Sleep(200 * time.Millisecond)
+	publishRecorded(ctx, t, model.SMS{CustomerID: 23, SmsIdentifier: "a", Recipients: []string{"+1"}}, Done)
+	time.Sleep(200 * time.Millisecond)
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("stream handler err: %v", err)
+	}
+
+	body := rec.Body.String()
+	if rec.Header().Get(echo.HeaderContentType) != "text/event-stream" {
+		t.Fatalf("unexpected content type %q", rec.Header().Get(echo.HeaderContentType))
+	}
+	if strings.Contains(body, "id: "+strconv.FormatInt(events[0].ID, 10)+"\n") {
+		t.Fatalf("event before Last-Event-ID replayed:\n%s", body)
+	}
+	if !strings.Contains(body, "id: "+strconv.FormatInt(events[1].ID, 10)+"\n") ||
+		strings.Count(body, "event: status\n") != 2 || !strings.Contains(body, `"status":"done"`) {
+		t.Fatalf("expected the missed and the live event:\n%s", body)
+	}
+}
+
+func TestStreamStatusHandler_InvalidLastEventID(t *testing.T) {
+	initTestLogger()
+	req := authed(httptest.NewRequest(http.MethodGet, "/sms/status/stream?last_event_id=abc", nil), 23)
+	rec := httptest.NewRecorder()
+
+	err := StreamStatusHandler(echo.New().NewContext(req, rec))
+	he, ok := err.(*echo.HTTPError)
+	if !ok || he.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %v", err)
+	}
+}
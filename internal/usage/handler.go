@@ -0,0 +1,121 @@
+package usage
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"sms-gateway/app"
+	"sms-gateway/internal/auth"
+
+	"github.com/labstack/echo/v4"
+)
+
+// ReportHandler godoc
+// @Summary      Usage report
+// @Description  The authenticated customer's message counts from the daily rollup for messages created in [from, to), grouped by any of day, type, provider and status. Counts lag by at most USAGE_ROLLUP_INTERVAL_SEC
+// @Tags         reports
+// @Produce      json
+// @Security     BearerAuth
+// @Param        from query string false "First day (YYYY-MM-DD), inclusive; defaults to 30 days ago"
+// @Param        to query string false "Last day (YYYY-MM-DD), exclusive; defaults to tomorrow"
+// @Param        type query string false "Only this message type"
+// @Param        status query string false "Only this status (e.g. done, failed)"
+// @Param        group_by query string false "Comma-separated: day, customer, type, provider, status"
+// @Success      200 {object} map[string]any
+// @Failure      400 {object} apierror.Error "invalid input"
+// @Failure      401 {object} apierror.Error "unauthenticated"
+// @Failure      500 {object} apierror.Error "internal error"
+// @Router       /reports/usage [get]
+func ReportHandler(c echo.Context) error {
+	customerID, err := auth.CustomerID(c)
+	if err != nil {
+		return err
+	}
+
+	req, err := parseReportRequest(c)
+	if err != nil {
+		return err
+	}
+	req.CustomerID = &customerID
+
+	return report(c, req)
+}
+
+// AdminReportHandler godoc
+// @Summary      Usage report over all customers
+// @Description  Message counts from the daily rollup for messages created in [from, to), grouped by any of day, customer, type, provider and status. Counts lag by at most USAGE_ROLLUP_INTERVAL_SEC
+// @Tags         admin
+// @Produce      json
+// @Security     AdminAuth
+// @Param        from query string false "First day (YYYY-MM-DD), inclusive; defaults to 30 days ago"
+// @Param        to query string false "Last day (YYYY-MM-DD), exclusive; defaults to tomorrow"
+// @Param        customer_id query int false "Only this customer"
+// @Param        type query string false "Only this message type"
+// @Param        status query string false "Only this status (e.g. done, failed)"
+// @Param        group_by query string false "Comma-separated: day, customer, type, provider, status"
+// @Success      200 {object} map[string]any
+// @Failure      400 {object} apierror.Error "invalid input"
+// @Failure      401 {object} apierror.Error "unauthenticated"
+// @Failure      500 {object} apierror.Error "internal error"
+// @Router       /admin/reports/usage [get]
+func AdminReportHandler(c echo.Context) error {
+	req, err := parseReportRequest(c)
+	if err != nil {
+		return err
+	}
+	if v := c.QueryParam("customer_id"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid customer_id")
+		}
+		req.CustomerID = &id
+	}
+
+	return report(c, req)
+}
+
+func parseReportRequest(c echo.Context) (ReportRequest, error) {
+	today := time.Now()
+	req := ReportRequest{
+		From:   today.AddDate(0, 0, -30),
+		To:     today.AddDate(0, 0, 1),
+		Type:   c.QueryParam("type"),
+		Status: c.QueryParam("status"),
+	}
+
+	var err error
+	if v := c.QueryParam("from"); v != "" {
+		if req.From, err = time.Parse(time.DateOnly, v); err != nil {
+			return req, echo.NewHTTPError(http.StatusBadRequest, "invalid from")
+		}
+	}
+	if v := c.QueryParam("to"); v != "" {
+		if req.To, err = time.Parse(time.DateOnly, v); err != nil {
+			return req, echo.NewHTTPError(http.StatusBadRequest, "invalid to")
+		}
+	}
+	if req.GroupBy, err = ParseGroupBy(c.QueryParam("group_by")); err != nil {
+		return req, echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	return req, nil
+}
+
+func report(c echo.Context, req ReportRequest) error {
+	rows, err := Report(c.Request().Context(), req)
+	if err != nil {
+		if errors.Is(err, ErrInvalidReport) {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		app.Logger.Error("usage report", "err", err)
+		return err
+	}
+
+	out := map[string]any{}
+	out["from"] = req.From.Format(time.DateOnly)
+	out["to"] = req.To.Format(time.DateOnly)
+	out["rows"] = rows
+
+	return c.JSON(http.StatusOK, out)
+}
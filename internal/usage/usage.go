@@ -0,0 +1,314 @@
+package usage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"sms-gateway/app"
+	"sms-gateway/pkg/metrics"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Delta moves Messages into (or, when negative, out of) one usage_daily bucket. Day is the
+// day the message was created; zero means today.
+type Delta struct {
+	Day      time.Time
+	UserID   int64
+	Type     string
+	Provider string
+	Status   string
+	Messages int64
+}
+
+// RecordTx appends deltas inside the caller's DB transaction, so they commit together with the
+// status change they describe. Deltas are folded into usage_daily by StartRollup instead of
+// being applied here: a busy customer's daily bucket would otherwise be a hot row on the send path.
+func RecordTx(ctx context.Context, tx *sqlx.Tx, deltas []Delta) error {
+	if tx == nil {
+		return errors.New("tx is required")
+	}
+	if len(deltas) == 0 {
+		return nil
+	}
+
+	valueStrings := make([]string, 0, len(deltas))
+	args := make([]any, 0, len(deltas)*6)
+	for _, d := range deltas {
+		var day any
+		if !d.Day.IsZero() {
+			day = d.Day
+		}
+		valueStrings = append(valueStrings, "(COALESCE(?, CURRENT_DATE), ?, ?, ?, ?, ?)")
+		args = append(args, day, d.UserID, d.Type, d.Provider, d.Status, d.Messages)
+	}
+	q := `INSERT INTO usage_deltas (day, user_id, type, provider, status, messages) VALUES ` + strings.Join(valueStrings, ",")
+	execFn := metrics.DBExecObserver("insert_usage_deltas", func(c context.Context) error {
+		_, err := tx.ExecContext(c, q, args...)
+		return err
+	})
+	return execFn(ctx)
+}
+
+// Transition returns the deltas for count messages moving from one bucket to another.
+func Transition(day time.Time, userID int64, typ, fromProvider, fromStatus, toProvider, toStatus string, count int64) []Delta {
+	if fromProvider == toProvider && fromStatus == toStatus {
+		return nil
+	}
+	return []Delta{
+		{Day: day, UserID: userID, Type: typ, Provider: fromProvider, Status: fromStatus, Messages: -count},
+		{Day: day, UserID: userID, Type: typ, Provider: toProvider, Status: toStatus, Messages: count},
+	}
+}
+
+type deltaRow struct {
+	ID       int64     `db:"id"`
+	Day      time.Time `db:"day"`
+	UserID   int64     `db:"user_id"`
+	Type     string    `db:"type"`
+	Provider string    `db:"provider"`
+	Status   string    `db:"status"`
+	Messages int64     `db:"messages"`
+}
+
+type bucket struct {
+	Day      string
+	UserID   int64
+	Type     string
+	Provider string
+	Status   string
+}
+
+// Fold moves up to limit deltas into usage_daily and returns how many it consumed. Deltas are
+// claimed with SKIP LOCKED, so several instances can fold concurrently.
+func Fold(ctx context.Context, limit int) (_ int, err error) {
+	tx, err := app.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	var rows []deltaRow
+	const selectQ = `
+		SELECT id, day, user_id, type, provider, status, messages
+		FROM usage_deltas
+		ORDER BY id
+		LIMIT ?
+		FOR UPDATE SKIP LOCKED
+	`
+	if err = metrics.DBExecObserver("select_usage_deltas", func(c context.Context) error {
+		return tx.SelectContext(c, &rows, selectQ, limit)
+	})(ctx); err != nil {
+		return 0, err
+	}
+	if len(rows) == 0 {
+		return 0, tx.Commit()
+	}
+
+	sums := map[bucket]int64{}
+	ids := make([]any, 0, len(rows))
+	for _, r := range rows {
+		sums[bucket{r.Day.Format(time.DateOnly), r.UserID, r.Type, r.Provider, r.Status}] += r.Messages
+		ids = append(ids, r.ID)
+	}
+
+	// Upsert in key order so concurrent folds lock usage_daily rows in the same order.
+	keys := make([]bucket, 0, len(sums))
+	for k, v := range sums {
+		if v != 0 {
+			keys = append(keys, k)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a.UserID != b.UserID {
+			return a.UserID < b.UserID
+		}
+		if a.Day != b.Day {
+			return a.Day < b.Day
+		}
+		if a.Type != b.Type {
+			return a.Type < b.Type
+		}
+		if a.Provider != b.Provider {
+			return a.Provider < b.Provider
+		}
+		return a.Status < b.Status
+	})
+
+	if len(keys) > 0 {
+		valueStrings := make([]string, 0, len(keys))
+		args := make([]any, 0, len(keys)*6)
+		for _, k := range keys {
+			valueStrings = append(valueStrings, "(?, ?, ?, ?, ?, ?)")
+			args = append(args, k.Day, k.UserID, k.Type, k.Provider, k.Status, sums[k])
+		}
+		upsertQ := `INSERT INTO usage_daily (day, user_id, type, provider, status, messages) VALUES ` +
+			strings.Join(valueStrings, ",") +
+			` ON DUPLICATE KEY UPDATE messages = messages + VALUES(messages)`
+		if err = metrics.DBExecObserver("upsert_usage_daily", func(c context.Context) error {
+			_, execErr := tx.ExecContext(c, upsertQ, args...)
+			return execErr
+		})(ctx); err != nil {
+			return 0, err
+		}
+	}
+
+	deleteQ := `DELETE FROM usage_deltas WHERE id IN (?` + strings.Repeat(",?", len(ids)-1) + `)`
+	if err = metrics.DBExecObserver("delete_usage_deltas", func(c context.Context) error {
+		_, execErr := tx.ExecContext(c, deleteQ, ids...)
+		return execErr
+	})(ctx); err != nil {
+		return 0, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+	return len(rows), nil
+}
+
+// StartRollup folds usage deltas every interval until ctx is done.
+func StartRollup(ctx context.Context, interval time.Duration, batchSize int) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		for {
+			n, err := Fold(ctx, batchSize)
+			if err != nil {
+				app.Logger.Error("fold usage deltas", "err", err)
+				break
+			}
+			if n < batchSize {
+				break
+			}
+		}
+	}
+}
+
+// Dimension is a usage_daily column a report can be grouped by.
+type Dimension string
+
+const (
+	ByDay      Dimension = "day"
+	ByCustomer Dimension = "customer"
+	ByType     Dimension = "type"
+	ByProvider Dimension = "provider"
+	ByStatus   Dimension = "status"
+)
+
+var dimensionColumns = map[Dimension]string{
+	ByDay:      "DATE_FORMAT(day, '%Y-%m-%d')",
+	ByCustomer: "user_id",
+	ByType:     "type",
+	ByProvider: "provider",
+	ByStatus:   "status",
+}
+
+var dimensionOrder = []Dimension{ByDay, ByCustomer, ByType, ByProvider, ByStatus}
+
+var ErrInvalidReport = errors.New("invalid usage report")
+
+// ParseGroupBy parses a comma-separated list of dimensions.
+func ParseGroupBy(v string) ([]Dimension, error) {
+	if v == "" {
+		return nil, nil
+	}
+	seen := map[Dimension]bool{}
+	var out []Dimension
+	for _, p := range strings.Split(v, ",") {
+		d := Dimension(strings.TrimSpace(p))
+		if _, ok := dimensionColumns[d]; !ok {
+			return nil, fmt.Errorf("%w: unknown group_by %q", ErrInvalidReport, p)
+		}
+		if !seen[d] {
+			seen[d] = true
+			out = append(out, d)
+		}
+	}
+	return out, nil
+}
+
+// ReportRequest selects usage of messages created in [From, To) (whole days).
+type ReportRequest struct {
+	From       time.Time
+	To         time.Time
+	CustomerID *int64
+	Type       string
+	Status     string
+	GroupBy    []Dimension
+}
+
+// Row is one group of a usage report; only the grouped dimensions are set.
+type Row struct {
+	Day        string `db:"day" json:"day,omitempty"`
+	CustomerID int64  `db:"customer" json:"customer_id,omitempty"`
+	Type       string `db:"type" json:"type,omitempty"`
+	Provider   string `db:"provider" json:"provider,omitempty"`
+	Status     string `db:"status" json:"status,omitempty"`
+	Messages   int64  `db:"messages" json:"messages"`
+}
+
+// Report aggregates usage_daily. Deltas not folded yet (at most one rollup interval old) are
+// not included.
+func Report(ctx context.Context, req ReportRequest) ([]Row, error) {
+	if req.From.IsZero() || req.To.IsZero() || !req.From.Before(req.To) {
+		return nil, fmt.Errorf("%w: from must be before to", ErrInvalidReport)
+	}
+
+	grouped := map[Dimension]bool{}
+	for _, d := range req.GroupBy {
+		grouped[d] = true
+	}
+	selects := make([]string, 0, len(dimensionOrder)+1)
+	groups := make([]string, 0, len(dimensionOrder))
+	for _, d := range dimensionOrder {
+		if grouped[d] {
+			selects = append(selects, dimensionColumns[d]+" AS "+string(d))
+			groups = append(groups, string(d))
+		}
+	}
+	selects = append(selects, "COALESCE(SUM(messages), 0) AS messages")
+
+	q := `SELECT ` + strings.Join(selects, ", ") + ` FROM usage_daily WHERE day >= ? AND day < ?`
+	args := []any{req.From.Format(time.DateOnly), req.To.Format(time.DateOnly)}
+	if req.CustomerID != nil {
+		q += ` AND user_id = ?`
+		args = append(args, *req.CustomerID)
+	}
+	if req.Type != "" {
+		q += ` AND type = ?`
+		args = append(args, req.Type)
+	}
+	if req.Status != "" {
+		q += ` AND status = ?`
+		args = append(args, req.Status)
+	}
+	if len(groups) > 0 {
+		q += ` GROUP BY ` + strings.Join(groups, ", ") + ` HAVING messages <> 0 ORDER BY ` + strings.Join(groups, ", ")
+	}
+
+	out := []Row{}
+	queryFn := metrics.DBExecObserver("select_usage_report", func(c context.Context) error {
+		return app.DB.SelectContext(c, &out, q, args...)
+	})
+	if err := queryFn(ctx); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
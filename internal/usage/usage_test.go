@@ -0,0 +1,33 @@
+package usage
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParseGroupBy(t *testing.T) {
+	got, err := ParseGroupBy("status, day,status")
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if len(got) != 2 || got[0] != ByStatus || got[1] != ByDay {
+		t.Fatalf("unexpected dimensions %v", got)
+	}
+
+	if _, err := ParseGroupBy("day,recipient"); !errors.Is(err, ErrInvalidReport) {
+		t.Fatalf("expected ErrInvalidReport, got %v", err)
+	}
+}
+
+func TestTransition(t *testing.T) {
+	day := time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC)
+	if d := Transition(day, 1, "normal", "op", "done", "op", "done", 3); d != nil {
+		t.Fatalf("expected no deltas for an unchanged bucket, got %+v", d)
+	}
+
+	d := Transition(day, 1, "normal", "", "sending", "op", "done", 3)
+	if len(d) != 2 || d[0].Status != "sending" || d[0].Messages != -3 || d[1].Provider != "op" || d[1].Messages != 3 {
+		t.Fatalf("unexpected deltas %+v", d)
+	}
+}
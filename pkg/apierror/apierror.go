@@ -0,0 +1,100 @@
+package apierror
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Code is a stable, machine-readable error code. Clients should branch on it rather than on
+// the message, which may change.
+type Code string
+
+// Generic codes, used for errors that carry no more specific one (see ForStatus).
+const (
+	InvalidInput     Code = "INVALID_INPUT"
+	Unauthenticated  Code = "UNAUTHENTICATED"
+	Forbidden        Code = "FORBIDDEN"
+	NotFound         Code = "NOT_FOUND"
+	MethodNotAllowed Code = "METHOD_NOT_ALLOWED"
+	Conflict         Code = "CONFLICT"
+	Gone             Code = "GONE"
+	Unprocessable    Code = "UNPROCESSABLE"
+	RateLimited      Code = "RATE_LIMITED"
+	Internal         Code = "INTERNAL"
+	Unavailable      Code = "UNAVAILABLE"
+)
+
+// Domain codes.
+const (
+	InvalidAPIKey            Code = "INVALID_API_KEY"
+	InsufficientBalance      Code = "INSUFFICIENT_BALANCE"
+	InvalidRecipient         Code = "INVALID_RECIPIENT"
+	ContentBlocked           Code = "CONTENT_BLOCKED"
+	PriorityOutOfRange       Code = "PRIORITY_OUT_OF_RANGE"
+	QuotaExceeded            Code = "QUOTA_EXCEEDED"
+	OverLimit                Code = "OVER_LIMIT"
+	PaymentReferenceConflict Code = "PAYMENT_REFERENCE_CONFLICT"
+	RefundExceedsCharge      Code = "REFUND_EXCEEDS_CHARGE"
+	HoldExpired              Code = "HOLD_EXPIRED"
+	InvalidCode              Code = "INVALID_CODE"
+	CodeExpired              Code = "CODE_EXPIRED"
+	TooManyAttempts          Code = "TOO_MANY_ATTEMPTS"
+	IdempotencyKeyInUse      Code = "IDEMPOTENCY_KEY_IN_USE"
+	IdempotencyKeyReused     Code = "IDEMPOTENCY_KEY_REUSED"
+)
+
+// Error is the JSON body of every failed /v1 response.
+type Error struct {
+	Code      Code   `json:"code"`
+	Message   string `json:"message"`
+	Details   any    `json:"details,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// New returns an HTTP error with a typed code. It is an *echo.HTTPError like the errors handlers
+// already return, so the unversioned routes keep rendering it as {"message": ...}.
+func New(status int, code Code, message string) *echo.HTTPError {
+	return echo.NewHTTPError(status, &Error{Code: code, Message: message})
+}
+
+// WithDetails is New with details, e.g. the offending field or the limit that was hit.
+func WithDetails(status int, code Code, message string, details any) *echo.HTTPError {
+	return echo.NewHTTPError(status, &Error{Code: code, Message: message, Details: details})
+}
+
+// ForStatus is the generic code for errors created without one.
+func ForStatus(status int) Code {
+	switch status {
+	case http.StatusBadRequest:
+		return InvalidInput
+	case http.StatusUnauthorized:
+		return Unauthenticated
+	case http.StatusPaymentRequired:
+		return InsufficientBalance
+	case http.StatusForbidden:
+		return Forbidden
+	case http.StatusNotFound:
+		return NotFound
+	case http.StatusMethodNotAllowed:
+		return MethodNotAllowed
+	case http.StatusConflict:
+		return Conflict
+	case http.StatusGone:
+		return Gone
+	case http.StatusUnprocessableEntity:
+		return Unprocessable
+	case http.StatusTooManyRequests:
+		return RateLimited
+	case http.StatusServiceUnavailable:
+		return Unavailable
+	}
+	if status >= 400 && status < 500 {
+		return InvalidInput
+	}
+	return Internal
+}
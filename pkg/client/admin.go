@@ -0,0 +1,90 @@
+package client
+
+import (
+	"context"
+	"net/url"
+	"time"
+)
+
+// Price is a price per message for a destination prefix from a monthly volume on.
+type Price struct {
+	ID                int64       `json:"id"`
+	CustomerID        int64       `json:"customer_id"`
+	Type              MessageType `json:"type"`
+	DestinationPrefix string      `json:"destination_prefix"`
+	MinVolume         int         `json:"min_volume"`
+	Price             int64       `json:"price"`
+	EffectiveFrom     time.Time   `json:"effective_from"`
+}
+
+// PriceRequest adds a price. CustomerID 0 is the default price list.
+type PriceRequest struct {
+	CustomerID        int64       `json:"customer_id,omitempty"`
+	Type              MessageType `json:"type"`
+	DestinationPrefix string      `json:"destination_prefix"`
+	MinVolume         int         `json:"min_volume"`
+	Price             int64       `json:"price"`
+	// EffectiveFrom nil makes the price effective immediately.
+	EffectiveFrom *time.Time `json:"effective_from,omitempty"`
+}
+
+// ListPrices lists the prices of a customer, or every price list when customerID is 0 (admin).
+func (c *Client) ListPrices(ctx context.Context, customerID int64) ([]Price, error) {
+	query := url.Values{}
+	setInt(query, "customer_id", customerID)
+
+	var out struct {
+		Prices []Price `json:"prices"`
+	}
+	err := c.get(ctx, "/admin/prices", query, &out)
+	return out.Prices, err
+}
+
+// CreatePrice adds a price (admin).
+func (c *Client) CreatePrice(ctx context.Context, req PriceRequest) (Price, error) {
+	var out Price
+	err := c.adminPost(ctx, "/admin/prices", req, &out, false)
+	return out, err
+}
+
+// ContentRule is a content rule: a keyword, regex or URL domain with the action on a match.
+type ContentRule struct {
+	ID         int64  `json:"id"`
+	CustomerID int64  `json:"customer_id"`
+	Kind       string `json:"kind"`
+	Pattern    string `json:"pattern"`
+	Action     string `json:"action"`
+	CreatedAt  string `json:"created_at"`
+}
+
+// ContentRuleRequest adds a content rule. CustomerID 0 applies it to every customer.
+type ContentRuleRequest struct {
+	CustomerID int64  `json:"customer_id"`
+	Kind       string `json:"kind"`
+	Pattern    string `json:"pattern"`
+	Action     string `json:"action"`
+}
+
+// ListContentRules lists the rules of a customer, or all rules when customerID is 0 (admin).
+func (c *Client) ListContentRules(ctx context.Context, customerID int64) ([]ContentRule, error) {
+	query := url.Values{}
+	setInt(query, "customer_id", customerID)
+
+	var out struct {
+		Rules []ContentRule `json:"rules"`
+	}
+	err := c.get(ctx, "/admin/content-rules", query, &out)
+	return out.Rules, err
+}
+
+// CreateContentRule adds a content rule (admin).
+func (c *Client) CreateContentRule(ctx context.Context, req ContentRuleRequest) (ContentRule, error) {
+	var out ContentRule
+	err := c.adminPost(ctx, "/admin/content-rules", req, &out, false)
+	return out, err
+}
+
+// DeleteContentRule deletes a content rule (admin).
+func (c *Client) DeleteContentRule(ctx context.Context, id int64) error {
+	return c.delete(ctx, pathf("/admin/content-rules/%d", id), nil)
+}
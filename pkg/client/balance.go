@@ -0,0 +1,294 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Balance is a customer's balance with its latest transactions.
+type Balance struct {
+	Balance      int64         `json:"balance"`
+	Held         int64         `json:"held"`
+	Available    int64         `json:"available"`
+	AccountMode  string        `json:"account_mode"`
+	CreditLimit  int64         `json:"credit_limit"`
+	Transactions []Transaction `json:"transactions"`
+}
+
+// Transaction is one balance change in Balance.
+type Transaction struct {
+	Amount          int64     `json:"Amount"`
+	TransactionType string    `json:"TransactionType"`
+	Description     string    `json:"Description"`
+	TransactionID   string    `json:"transaction_id"`
+	PriceVersion    string    `json:"price_version,omitempty"`
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+// GetBalance returns the customer's balance.
+func (c *Client) GetBalance(ctx context.Context) (Balance, error) {
+	var out Balance
+	err := c.get(ctx, "/balance", nil, &out)
+	return out, err
+}
+
+// StatementQuery selects a page of the statement; zero fields use the gateway's defaults.
+type StatementQuery struct {
+	From   time.Time
+	To     time.Time
+	Types  []string
+	Cursor string
+	Limit  int
+}
+
+func (q StatementQuery) values() url.Values {
+	v := url.Values{}
+	setTime(v, "from", q.From)
+	setTime(v, "to", q.To)
+	setString(v, "type", strings.Join(q.Types, ","))
+	setString(v, "cursor", q.Cursor)
+	setInt(v, "limit", int64(q.Limit))
+	return v
+}
+
+// Statement is a page of balance transactions with the balances around it.
+type Statement struct {
+	UserID         int64           `json:"user_id"`
+	From           *time.Time      `json:"from,omitempty"`
+	To             time.Time       `json:"to"`
+	OpeningBalance int64           `json:"opening_balance"`
+	ClosingBalance int64           `json:"closing_balance"`
+	Transactions   []StatementLine `json:"transactions"`
+	// NextCursor is set when there are more transactions; pass it as StatementQuery.Cursor.
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// StatementLine is one transaction of a Statement.
+type StatementLine struct {
+	ID               int64     `json:"id"`
+	Amount           int64     `json:"amount"`
+	TransactionType  string    `json:"transaction_type"`
+	Description      string    `json:"description"`
+	TransactionID    string    `json:"transaction_id"`
+	ReferenceID      string    `json:"reference_id,omitempty"`
+	PriceVersion     string    `json:"price_version,omitempty"`
+	PaymentSource    string    `json:"payment_source,omitempty"`
+	PaymentReference string    `json:"payment_reference,omitempty"`
+	CreatedAt        time.Time `json:"created_at"`
+}
+
+// GetStatement returns a page of the customer's statement.
+func (c *Client) GetStatement(ctx context.Context, q StatementQuery) (Statement, error) {
+	var out Statement
+	err := c.get(ctx, "/balance/statement", q.values(), &out)
+	return out, err
+}
+
+// StatementCSV returns the whole statement for the period as CSV; Cursor and Limit are ignored.
+func (c *Client) StatementCSV(ctx context.Context, q StatementQuery) ([]byte, error) {
+	v := q.values()
+	v.Del("cursor")
+	v.Del("limit")
+	v.Set("format", "csv")
+
+	var out []byte
+	err := c.get(ctx, "/balance/statement", v, &out)
+	return out, err
+}
+
+// Alert is a low-balance alert.
+type Alert struct {
+	ID            int64   `json:"id"`
+	UserID        int64   `json:"user_id"`
+	Threshold     int64   `json:"threshold"`
+	WebhookURL    string  `json:"webhook_url,omitempty"`
+	ContactNumber string  `json:"contact_number,omitempty"`
+	Armed         bool    `json:"armed"`
+	LastFiredAt   *string `json:"last_fired_at"`
+}
+
+// AlertRequest is the body of POST /balance/alerts; at least one of WebhookURL and
+// ContactNumber is required.
+type AlertRequest struct {
+	Threshold     int64  `json:"threshold"`
+	WebhookURL    string `json:"webhook_url,omitempty"`
+	ContactNumber string `json:"contact_number,omitempty"`
+}
+
+// ListAlerts lists the customer's low-balance alerts.
+func (c *Client) ListAlerts(ctx context.Context) ([]Alert, error) {
+	var out struct {
+		Alerts []Alert `json:"alerts"`
+	}
+	err := c.get(ctx, "/balance/alerts", nil, &out)
+	return out.Alerts, err
+}
+
+// SetAlert creates or replaces the alert for req.Threshold.
+func (c *Client) SetAlert(ctx context.Context, req AlertRequest) error {
+	return c.post(ctx, "/balance/alerts", req, nil)
+}
+
+// DeleteAlert deletes an alert.
+func (c *Client) DeleteAlert(ctx context.Context, id int64) error {
+	return c.delete(ctx, pathf("/balance/alerts/%d", id), nil)
+}
+
+// AddBalanceRequest is the body of POST /balance/add.
+type AddBalanceRequest struct {
+	UserID      int64  `json:"user_id"`
+	Amount      uint64 `json:"balance"`
+	Description string `json:"description,omitempty"`
+	Promo       bool   `json:"promo,omitempty"`
+	// PaymentSource and PaymentReference identify the payment; a repeated reference is
+	// not credited twice. The reference is required, so that a retry, even by another
+	// process, cannot credit the payment twice.
+	PaymentSource    string `json:"payment_source,omitempty"`
+	PaymentReference string `json:"payment_reference,omitempty"`
+}
+
+// TopUp is a credited payment.
+type TopUp struct {
+	TransactionID    string    `json:"transaction_id"`
+	UserID           int64     `json:"user_id"`
+	Amount           int64     `json:"amount"`
+	PaymentSource    string    `json:"payment_source,omitempty"`
+	PaymentReference string    `json:"payment_reference,omitempty"`
+	CreatedAt        time.Time `json:"created_at"`
+	// Replayed is set when the payment reference was credited before.
+	Replayed bool `json:"replayed"`
+}
+
+// ErrPaymentReferenceRequired is returned by AddBalance without a PaymentReference.
+var ErrPaymentReferenceRequired = errors.New("payment reference is required")
+
+// AddBalance credits a customer (admin).
+func (c *Client) AddBalance(ctx context.Context, req AddBalanceRequest) (TopUp, error) {
+	if req.PaymentReference == "" {
+		return TopUp{}, ErrPaymentReferenceRequired
+	}
+	var out TopUp
+	err := c.adminPost(ctx, "/balance/add", req, &out, true)
+	return out, err
+}
+
+// RefundRequest is the body of POST /admin/refunds.
+type RefundRequest struct {
+	UserID        int64  `json:"user_id"`
+	TransactionID string `json:"transaction_id"`
+	Amount        int64  `json:"amount"`
+	// Key deduplicates refunds; empty means "full", so repeated full refunds of a charge
+	// collapse into one. Partial refunds need a key each.
+	Key    string `json:"key"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// Refund is a refund of (part of) a charge.
+type Refund struct {
+	ID                    int64  `json:"id"`
+	UserID                int64  `json:"user_id"`
+	OriginalTransactionID string `json:"original_transaction_id"`
+	RefundTransactionID   string `json:"refund_transaction_id"`
+	Amount                int64  `json:"amount"`
+	RefundKey             string `json:"refund_key"`
+	Reason                string `json:"reason"`
+	CreatedAt             string `json:"created_at"`
+}
+
+// Refund refunds (part of) a charge (admin).
+func (c *Client) Refund(ctx context.Context, req RefundRequest) (Refund, error) {
+	var out Refund
+	err := c.adminPost(ctx, "/admin/refunds", req, &out, true)
+	return out, err
+}
+
+// ListRefunds lists the refunds of a charge (admin).
+func (c *Client) ListRefunds(ctx context.Context, transactionID string) ([]Refund, error) {
+	query := url.Values{}
+	setString(query, "transaction_id", transactionID)
+
+	var out struct {
+		Refunds []Refund `json:"refunds"`
+	}
+	err := c.get(ctx, "/admin/refunds", query, &out)
+	return out.Refunds, err
+}
+
+// Account holds a customer's billing settings.
+type Account struct {
+	UserID          int64  `json:"user_id"`
+	AccountMode     string `json:"account_mode"`
+	CreditLimit     int64  `json:"credit_limit"`
+	CreditSoftLimit *int64 `json:"credit_soft_limit"`
+}
+
+// AccountAudit is one change of an account's billing settings.
+type AccountAudit struct {
+	ID                 int64  `json:"id"`
+	UserID             int64  `json:"user_id"`
+	OldMode            string `json:"old_account_mode"`
+	NewMode            string `json:"new_account_mode"`
+	OldCreditLimit     int64  `json:"old_credit_limit"`
+	NewCreditLimit     int64  `json:"new_credit_limit"`
+	OldCreditSoftLimit *int64 `json:"old_credit_soft_limit"`
+	NewCreditSoftLimit *int64 `json:"new_credit_soft_limit"`
+	Actor              string `json:"actor"`
+	Reason             string `json:"reason"`
+	CreatedAt          string `json:"created_at"`
+}
+
+// AccountDetails is an account with the audit trail of its changes.
+type AccountDetails struct {
+	Account Account        `json:"account"`
+	Audit   []AccountAudit `json:"audit"`
+}
+
+// AccountRequest is the body of PUT /admin/accounts/{user_id}.
+type AccountRequest struct {
+	AccountMode     string `json:"account_mode"`
+	CreditLimit     int64  `json:"credit_limit"`
+	CreditSoftLimit *int64 `json:"credit_soft_limit"`
+	Reason          string `json:"reason,omitempty"`
+}
+
+// GetAccount returns a customer's billing settings (admin).
+func (c *Client) GetAccount(ctx context.Context, userID int64) (AccountDetails, error) {
+	var out AccountDetails
+	err := c.get(ctx, pathf("/admin/accounts/%d", userID), nil, &out)
+	return out, err
+}
+
+// SetAccount changes a customer's billing settings (admin).
+func (c *Client) SetAccount(ctx context.Context, userID int64, req AccountRequest) error {
+	return c.put(ctx, pathf("/admin/accounts/%d", userID), req, nil)
+}
+
+// BalanceShard is one shard of a customer's balance.
+type BalanceShard struct {
+	Shard   int   `json:"shard"`
+	Balance int64 `json:"balance"`
+	Held    int64 `json:"held"`
+}
+
+// GetShards returns the shards of a customer's balance (admin).
+func (c *Client) GetShards(ctx context.Context, userID int64) ([]BalanceShard, error) {
+	var out struct {
+		Shards []BalanceShard `json:"shards"`
+	}
+	err := c.get(ctx, pathf("/admin/accounts/%d/shards", userID), nil, &out)
+	return out.Shards, err
+}
+
+// SetShards spreads a customer's balance over n shards (admin).
+func (c *Client) SetShards(ctx context.Context, userID int64, n int) error {
+	return c.put(ctx, pathf("/admin/accounts/%d/shards", userID), map[string]int{"shards": n}, nil)
+}
+
+func setTime(q url.Values, key string, t time.Time) {
+	if !t.IsZero() {
+		q.Set(key, t.Format(time.RFC3339))
+	}
+}
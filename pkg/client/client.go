@@ -0,0 +1,293 @@
+// Package client is a Go client for the gateway's HTTP API.
+//
+// Every call takes a context, which bounds the whole call including retries. Calls are
+// retried with exponential backoff when the gateway rate limits them, and on network errors
+// and 5xx responses when repeating them is safe: reads, PUTs and DELETEs, customer POSTs
+// (which carry an Idempotency-Key) and admin POSTs that have their own deduplication key.
+//
+//	c := client.New("http://localhost:8080", client.WithAPIKey(key))
+//	res, err := c.SendSMS(ctx, client.SendSMSRequest{Text: "hi", Recipients: []string{"09120000000"}})
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"sms-gateway/pkg/apierror"
+
+	"github.com/google/uuid"
+)
+
+// APIVersionPrefix is prepended to every request path.
+const APIVersionPrefix = "/v1"
+
+const (
+	defaultMaxRetries = 3
+	defaultMinBackoff = 100 * time.Millisecond
+	defaultMaxBackoff = 5 * time.Second
+	defaultTimeout    = 30 * time.Second
+	defaultUserAgent  = "sms-gateway-go-client"
+)
+
+// Client calls the gateway with one API key: a customer key for the customer endpoints or an
+// admin key for the admin ones. It is safe for concurrent use.
+type Client struct {
+	baseURL    string
+	apiKey     string
+	httpClient *http.Client
+	userAgent  string
+	maxRetries int
+	minBackoff time.Duration
+	maxBackoff time.Duration
+}
+
+// Option configures a Client.
+type Option func(*Client)
+
+// WithAPIKey sets the key sent as `Authorization: Bearer <key>`.
+func WithAPIKey(key string) Option {
+	return func(c *Client) { c.apiKey = key }
+}
+
+// WithHTTPClient replaces the default HTTP client, which times out each attempt after 30s.
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) { c.httpClient = hc }
+}
+
+// WithMaxRetries sets how many times a failed call is retried; 0 disables retries.
+func WithMaxRetries(n int) Option {
+	return func(c *Client) { c.maxRetries = max(n, 0) }
+}
+
+// WithBackoff bounds the delay between retries. The delay doubles from min up to max, with
+// jitter. A Retry-After longer than max is not waited for; the error is returned instead.
+func WithBackoff(min, max time.Duration) Option {
+	return func(c *Client) { c.minBackoff, c.maxBackoff = min, max }
+}
+
+// WithUserAgent sets the User-Agent header.
+func WithUserAgent(ua string) Option {
+	return func(c *Client) { c.userAgent = ua }
+}
+
+// New returns a client for the gateway at baseURL, e.g. "http://localhost:8080".
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		httpClient: &http.Client{Timeout: defaultTimeout},
+		userAgent:  defaultUserAgent,
+		maxRetries: defaultMaxRetries,
+		minBackoff: defaultMinBackoff,
+		maxBackoff: defaultMaxBackoff,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// WithKey returns a copy of the client that uses another API key, sharing the HTTP client.
+func (c *Client) WithKey(key string) *Client {
+	cp := *c
+	cp.apiKey = key
+	return &cp
+}
+
+type idempotencyKeyCtx struct{}
+
+// WithIdempotencyKey makes the customer POST made with ctx use key as its Idempotency-Key
+// instead of a random one. Use it to repeat a call safely across process restarts; a key
+// must not be reused for a different request.
+func WithIdempotencyKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, idempotencyKeyCtx{}, key)
+}
+
+type request struct {
+	method string
+	path   string
+	query  url.Values
+	body   any
+	// idempotencyKey is sent as the Idempotency-Key header.
+	idempotencyKey string
+	// retrySafe marks requests that may run again after a network error or a 5xx.
+	retrySafe bool
+}
+
+func (c *Client) get(ctx context.Context, path string, query url.Values, out any) error {
+	return c.do(ctx, request{method: http.MethodGet, path: path, query: query, retrySafe: true}, out)
+}
+
+func (c *Client) put(ctx context.Context, path string, body, out any) error {
+	return c.do(ctx, request{method: http.MethodPut, path: path, body: body, retrySafe: true}, out)
+}
+
+func (c *Client) delete(ctx context.Context, path string, out any) error {
+	return c.do(ctx, request{method: http.MethodDelete, path: path, retrySafe: true}, out)
+}
+
+// post sends a customer POST with an Idempotency-Key, so that it is safe to retry.
+func (c *Client) post(ctx context.Context, path string, body, out any) error {
+	key, _ := ctx.Value(idempotencyKeyCtx{}).(string)
+	if key == "" {
+		key = uuid.NewString()
+	}
+	return c.do(ctx, request{method: http.MethodPost, path: path, body: body, idempotencyKey: key, retrySafe: true}, out)
+}
+
+// adminPost sends an admin POST. The admin routes do not take Idempotency-Key; retrySafe is
+// set by the endpoints that deduplicate by a key in the body or are idempotent on their own.
+func (c *Client) adminPost(ctx context.Context, path string, body, out any, retrySafe bool) error {
+	return c.do(ctx, request{method: http.MethodPost, path: path, body: body, retrySafe: retrySafe}, out)
+}
+
+func (c *Client) do(ctx context.Context, r request, out any) error {
+	var body []byte
+	if r.body != nil {
+		var err error
+		if body, err = json.Marshal(r.body); err != nil {
+			return fmt.Errorf("encode request: %w", err)
+		}
+	}
+
+	for attempt := 0; ; attempt++ {
+		err := c.once(ctx, r, body, out)
+		if err == nil {
+			return nil
+		}
+		wait, ok := c.retryDelay(ctx, r, err, attempt)
+		if !ok {
+			return err
+		}
+		t := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return err
+		case <-t.C:
+		}
+	}
+}
+
+func (c *Client) once(ctx context.Context, r request, body []byte, out any) error {
+	u := c.baseURL + APIVersionPrefix + r.path
+	if len(r.query) > 0 {
+		u += "?" + r.query.Encode()
+	}
+	var rd io.Reader
+	if body != nil {
+		rd = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, r.method, u, rd)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", c.userAgent)
+	if c.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	}
+	if r.idempotencyKey != "" {
+		req.Header.Set("Idempotency-Key", r.idempotencyKey)
+	}
+
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		return &url.Error{Op: r.method, URL: u, Err: err}
+	}
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return newError(res, data)
+	}
+
+	switch v := out.(type) {
+	case nil:
+		return nil
+	case *[]byte:
+		*v = data
+		return nil
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("decode response: %w", err)
+	}
+	return nil
+}
+
+// retryDelay reports whether the failed attempt should be retried and after how long.
+func (c *Client) retryDelay(ctx context.Context, r request, err error, attempt int) (time.Duration, bool) {
+	if attempt >= c.maxRetries || ctx.Err() != nil {
+		return 0, false
+	}
+
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		switch {
+		case apiErr.StatusCode == http.StatusTooManyRequests:
+			// Rejected before doing anything, so it is safe to repeat any request.
+			if apiErr.RetryAfter > c.maxBackoff {
+				return 0, false
+			}
+			if apiErr.RetryAfter > 0 {
+				return apiErr.RetryAfter, true
+			}
+			return c.backoff(attempt), true
+		case apiErr.Code == apierror.IdempotencyKeyInUse:
+			// An earlier attempt is still running; its response is replayed once it finishes.
+			return c.backoff(attempt), true
+		case r.retrySafe && retryableStatus(apiErr.StatusCode):
+			return c.backoff(attempt), true
+		}
+		return 0, false
+	}
+
+	var urlErr *url.Error
+	if r.retrySafe && errors.As(err, &urlErr) {
+		return c.backoff(attempt), true
+	}
+	return 0, false
+}
+
+func retryableStatus(status int) bool {
+	switch status {
+	case http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// backoff is the delay before retry attempt+1: exponential with jitter in [d/2, d].
+func (c *Client) backoff(attempt int) time.Duration {
+	d := c.minBackoff << attempt
+	if d <= 0 || d > c.maxBackoff {
+		d = c.maxBackoff
+	}
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + rand.N(d/2+1)
+}
+
+func pathf(format string, args ...any) string {
+	for i, a := range args {
+		if s, ok := a.(string); ok {
+			args[i] = url.PathEscape(s)
+		}
+	}
+	return fmt.Sprintf(format, args...)
+}
@@ -0,0 +1,158 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"sms-gateway/pkg/apierror"
+)
+
+func newTestClient(t *testing.T, h http.HandlerFunc) *Client {
+	t.Helper()
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+	return New(srv.URL, WithAPIKey("k"), WithBackoff(time.Millisecond, 10*time.Millisecond))
+}
+
+func writeError(w http.ResponseWriter, status int, code apierror.Code) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(apierror.Error{Code: code, Message: string(code), RequestID: "req-1"})
+}
+
+func TestSendSMSRetriesWithTheSameIdempotencyKey(t *testing.T) {
+	var mu sync.Mutex
+	var keys []string
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/sms/send" || r.Header.Get("Authorization") != "Bearer k" {
+			t.Errorf("unexpected request %s %s", r.URL.Path, r.Header.Get("Authorization"))
+		}
+		mu.Lock()
+		keys = append(keys, r.Header.Get("Idempotency-Key"))
+		n := len(keys)
+		mu.Unlock()
+		if n < 3 {
+			writeError(w, http.StatusServiceUnavailable, apierror.Unavailable)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(SendSMSResponse{Status: "ok", SmsIdentifier: "id-1"})
+	})
+
+	res, err := c.SendSMS(context.Background(), SendSMSRequest{Text: "hi", Recipients: []string{"0912"}, Type: Normal})
+	if err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	if res.SmsIdentifier != "id-1" {
+		t.Fatalf("expected id-1, got %+v", res)
+	}
+	if len(keys) != 3 || keys[0] == "" || keys[0] != keys[1] || keys[1] != keys[2] {
+		t.Fatalf("expected three attempts with one key, got %q", keys)
+	}
+}
+
+func TestUnsafePostIsNotRetriedOnServerError(t *testing.T) {
+	calls := 0
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		writeError(w, http.StatusInternalServerError, apierror.Internal)
+	})
+
+	_, err := c.CreateCustomer(context.Background(), CreateCustomerRequest{CustomerID: 1, Name: "a"})
+	if !IsCode(err, apierror.Internal) {
+		t.Fatalf("expected INTERNAL, got %v", err)
+	}
+	if calls != 1 {
+		t.Fatalf("expected one attempt, got %d", calls)
+	}
+}
+
+func TestRateLimitedRequestsHonourRetryAfter(t *testing.T) {
+	calls := 0
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Retry-After", "30")
+		writeError(w, http.StatusTooManyRequests, apierror.RateLimited)
+	})
+
+	_, err := c.CreateCustomer(context.Background(), CreateCustomerRequest{CustomerID: 1, Name: "a"})
+	var apiErr *Error
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("expected *Error, got %v", err)
+	}
+	if apiErr.StatusCode != http.StatusTooManyRequests || apiErr.RetryAfter != 30*time.Second || apiErr.RequestID != "req-1" {
+		t.Fatalf("unexpected error %+v", apiErr)
+	}
+	// Waiting 30s is beyond the maximum backoff, so the error is returned at once.
+	if calls != 1 {
+		t.Fatalf("expected one attempt, got %d", calls)
+	}
+}
+
+func TestAddBalanceRetriesWithPaymentReference(t *testing.T) {
+	var refs []string
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		var req AddBalanceRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		refs = append(refs, req.PaymentReference)
+		if len(refs) == 1 {
+			writeError(w, http.StatusBadGateway, apierror.Internal)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(TopUp{UserID: req.UserID, Amount: int64(req.Amount), PaymentReference: req.PaymentReference})
+	})
+
+	if _, err := c.AddBalance(context.Background(), AddBalanceRequest{UserID: 7, Amount: 100}); !errors.Is(err, ErrPaymentReferenceRequired) {
+		t.Fatalf("expected ErrPaymentReferenceRequired, got %v", err)
+	}
+	if len(refs) != 0 {
+		t.Fatalf("expected no request without a reference, got %q", refs)
+	}
+
+	topUp, err := c.AddBalance(context.Background(), AddBalanceRequest{UserID: 7, Amount: 100, PaymentReference: "pay-1"})
+	if err != nil {
+		t.Fatalf("add balance: %v", err)
+	}
+	if len(refs) != 2 || refs[0] != "pay-1" || refs[1] != "pay-1" || topUp.PaymentReference != "pay-1" {
+		t.Fatalf("expected a retry with the same reference, got %q", refs)
+	}
+}
+
+func TestContextCancelStopsRetries(t *testing.T) {
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		writeError(w, http.StatusServiceUnavailable, apierror.Unavailable)
+	}))
+	t.Cleanup(srv.Close)
+	c := New(srv.URL, WithMaxRetries(10), WithBackoff(time.Second, time.Second))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := c.GetBalance(ctx)
+	if !IsStatus(err, http.StatusServiceUnavailable) {
+		t.Fatalf("expected the last error, got %v", err)
+	}
+	if calls != 1 || time.Since(start) > 500*time.Millisecond {
+		t.Fatalf("expected the call to stop with its context, calls=%d after %s", calls, time.Since(start))
+	}
+}
+
+func TestGenerateInvoicesResult(t *testing.T) {
+	var one, all GenerateInvoicesResult
+	if err := json.Unmarshal([]byte(`{"period":"2026-09","created":true,"invoice":{"id":3}}`), &one); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal([]byte(`{"period":"2026-09","created":12}`), &all); err != nil {
+		t.Fatal(err)
+	}
+	if one.Created != 1 || one.Invoice == nil || one.Invoice.ID != 3 || all.Created != 12 || all.Invoice != nil {
+		t.Fatalf("unexpected results %+v %+v", one, all)
+	}
+}
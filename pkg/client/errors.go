@@ -0,0 +1,71 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"sms-gateway/pkg/apierror"
+)
+
+// Error is a non-2xx response of the gateway.
+type Error struct {
+	StatusCode int
+	Code       apierror.Code
+	Message    string
+	// Details is the raw "details" of the error envelope, e.g. the limit that was hit.
+	Details   json.RawMessage
+	RequestID string
+	// RetryAfter is the Retry-After of 429 responses.
+	RetryAfter time.Duration
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%d %s: %s", e.StatusCode, e.Code, e.Message)
+}
+
+// IsCode reports whether err is an *Error with the given code.
+func IsCode(err error, code apierror.Code) bool {
+	var e *Error
+	return errors.As(err, &e) && e.Code == code
+}
+
+// IsStatus reports whether err is an *Error with the given HTTP status.
+func IsStatus(err error, status int) bool {
+	var e *Error
+	return errors.As(err, &e) && e.StatusCode == status
+}
+
+func newError(res *http.Response, body []byte) *Error {
+	var envelope struct {
+		Code      apierror.Code   `json:"code"`
+		Message   string          `json:"message"`
+		Details   json.RawMessage `json:"details"`
+		RequestID string          `json:"request_id"`
+	}
+	_ = json.Unmarshal(body, &envelope)
+
+	e := &Error{
+		StatusCode: res.StatusCode,
+		Code:       envelope.Code,
+		Message:    envelope.Message,
+		Details:    envelope.Details,
+		RequestID:  envelope.RequestID,
+	}
+	if e.Code == "" {
+		e.Code = apierror.ForStatus(res.StatusCode)
+	}
+	if e.Message == "" {
+		e.Message = http.StatusText(res.StatusCode)
+	}
+	if e.RequestID == "" {
+		e.RequestID = res.Header.Get("X-Request-Id")
+	}
+	if secs, err := strconv.Atoi(res.Header.Get("Retry-After")); err == nil && secs > 0 {
+		e.RetryAfter = time.Duration(secs) * time.Second
+	}
+	return e
+}
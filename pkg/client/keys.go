@@ -0,0 +1,190 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// APIKey is a customer API key; the key itself is only returned when it is issued.
+type APIKey struct {
+	ID         int64      `json:"id"`
+	CustomerID int64      `json:"customer_id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+// IssuedKey is a newly issued API key.
+type IssuedKey struct {
+	APIKey
+	Key string `json:"key"`
+}
+
+// AdminKey is an admin key; the key itself is only returned when it is issued.
+type AdminKey struct {
+	ID         int64      `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+// IssuedAdminKey is a newly issued admin key.
+type IssuedAdminKey struct {
+	AdminKey
+	Key string `json:"key"`
+}
+
+// Customer is an API customer.
+type Customer struct {
+	ID        int64     `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// CreateCustomerRequest is the body of POST /admin/customers.
+type CreateCustomerRequest struct {
+	CustomerID int64  `json:"customer_id"`
+	Name       string `json:"name"`
+	KeyName    string `json:"key_name,omitempty"`
+}
+
+// CreatedCustomer is a new customer with its first API key.
+type CreatedCustomer struct {
+	Customer Customer  `json:"customer"`
+	Key      IssuedKey `json:"key"`
+}
+
+// AuditQuery filters the admin audit log; zero fields match everything.
+type AuditQuery struct {
+	Actor    string
+	Route    string
+	From     time.Time
+	To       time.Time
+	BeforeID int64
+	Limit    int
+}
+
+// AuditEntry is one admin write.
+type AuditEntry struct {
+	ID         int64     `json:"id"`
+	AdminKeyID int64     `json:"admin_key_id"`
+	Actor      string    `json:"actor"`
+	Method     string    `json:"method"`
+	Route      string    `json:"route"`
+	Path       string    `json:"path"`
+	Payload    *string   `json:"payload,omitempty"`
+	IP         string    `json:"ip"`
+	Status     int       `json:"status"`
+	Error      *string   `json:"error,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// AuditPage is a page of the audit log, newest first.
+type AuditPage struct {
+	Entries []AuditEntry `json:"entries"`
+	// NextBeforeID is passed as AuditQuery.BeforeID for the next page; 0 on the last one.
+	NextBeforeID int64 `json:"next_before_id"`
+}
+
+// ListKeys lists the customer's API keys.
+func (c *Client) ListKeys(ctx context.Context) ([]APIKey, error) {
+	var out struct {
+		Keys []APIKey `json:"keys"`
+	}
+	err := c.get(ctx, "/keys", nil, &out)
+	return out.Keys, err
+}
+
+// CreateKey issues another API key for the customer. The gateway does not store responses
+// carrying keys, so it is not retried after a network error or a 5xx.
+func (c *Client) CreateKey(ctx context.Context, name string) (IssuedKey, error) {
+	var out IssuedKey
+	err := c.do(ctx, request{method: http.MethodPost, path: "/keys", body: map[string]string{"name": name}}, &out)
+	return out, err
+}
+
+// RotateKey issues a replacement for a key; the old key keeps working for grace. Like
+// CreateKey it is not retried after a network error or a 5xx.
+func (c *Client) RotateKey(ctx context.Context, id int64, grace time.Duration) (IssuedKey, error) {
+	body := map[string]int{"grace_sec": int(grace.Seconds())}
+	var out IssuedKey
+	err := c.do(ctx, request{method: http.MethodPost, path: pathf("/keys/%d/rotate", id), body: body}, &out)
+	return out, err
+}
+
+// RevokeKey revokes one of the customer's keys.
+func (c *Client) RevokeKey(ctx context.Context, id int64) error {
+	return c.delete(ctx, pathf("/keys/%d", id), nil)
+}
+
+// CreateCustomer creates a customer with a first API key (admin). An existing customer id is
+// rejected with CONFLICT.
+func (c *Client) CreateCustomer(ctx context.Context, req CreateCustomerRequest) (CreatedCustomer, error) {
+	var out CreatedCustomer
+	err := c.adminPost(ctx, "/admin/customers", req, &out, false)
+	return out, err
+}
+
+// ListCustomerKeys lists a customer's API keys (admin).
+func (c *Client) ListCustomerKeys(ctx context.Context, customerID int64) ([]APIKey, error) {
+	var out struct {
+		Keys []APIKey `json:"keys"`
+	}
+	err := c.get(ctx, pathf("/admin/customers/%d/keys", customerID), nil, &out)
+	return out.Keys, err
+}
+
+// CreateCustomerKey issues an API key for a customer (admin).
+func (c *Client) CreateCustomerKey(ctx context.Context, customerID int64, name string) (IssuedKey, error) {
+	var out IssuedKey
+	err := c.adminPost(ctx, pathf("/admin/customers/%d/keys", customerID), map[string]string{"name": name}, &out, false)
+	return out, err
+}
+
+// RevokeCustomerKey revokes a customer's API key (admin).
+func (c *Client) RevokeCustomerKey(ctx context.Context, customerID, id int64) error {
+	return c.delete(ctx, pathf("/admin/customers/%d/keys/%d", customerID, id), nil)
+}
+
+// ListAdminKeys lists the admin keys (admin).
+func (c *Client) ListAdminKeys(ctx context.Context) ([]AdminKey, error) {
+	var out struct {
+		Keys []AdminKey `json:"keys"`
+	}
+	err := c.get(ctx, "/admin/keys", nil, &out)
+	return out.Keys, err
+}
+
+// CreateAdminKey issues an admin key (admin).
+func (c *Client) CreateAdminKey(ctx context.Context, name string) (IssuedAdminKey, error) {
+	var out IssuedAdminKey
+	err := c.adminPost(ctx, "/admin/keys", map[string]string{"name": name}, &out, false)
+	return out, err
+}
+
+// RevokeAdminKey revokes an admin key (admin).
+func (c *Client) RevokeAdminKey(ctx context.Context, id int64) error {
+	return c.delete(ctx, pathf("/admin/keys/%d", id), nil)
+}
+
+// AuditLog returns a page of the admin audit log (admin).
+func (c *Client) AuditLog(ctx context.Context, q AuditQuery) (AuditPage, error) {
+	query := url.Values{}
+	setString(query, "actor", q.Actor)
+	setString(query, "route", q.Route)
+	setTime(query, "from", q.From)
+	setTime(query, "to", q.To)
+	setInt(query, "before_id", q.BeforeID)
+	setInt(query, "limit", int64(q.Limit))
+
+	var out AuditPage
+	err := c.get(ctx, "/admin/audit-log", query, &out)
+	return out, err
+}
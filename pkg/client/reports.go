@@ -0,0 +1,271 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// UsageQuery selects a usage report over the whole days [From, To).
+type UsageQuery struct {
+	From time.Time
+	To   time.Time
+	// CustomerID narrows an admin report to one customer; customer reports ignore it.
+	CustomerID int64
+	Type       string
+	Status     string
+	// GroupBy lists the dimensions to group by: day, customer, type, provider, status.
+	GroupBy []string
+}
+
+func (q UsageQuery) values() url.Values {
+	v := url.Values{}
+	if !q.From.IsZero() {
+		v.Set("from", q.From.Format(time.DateOnly))
+	}
+	if !q.To.IsZero() {
+		v.Set("to", q.To.Format(time.DateOnly))
+	}
+	setString(v, "type", q.Type)
+	setString(v, "status", q.Status)
+	setString(v, "group_by", strings.Join(q.GroupBy, ","))
+	return v
+}
+
+// UsageReport is the message counts of a UsageQuery.
+type UsageReport struct {
+	From string     `json:"from"`
+	To   string     `json:"to"`
+	Rows []UsageRow `json:"rows"`
+}
+
+// UsageRow is one group of a usage report; only the grouped dimensions are set.
+type UsageRow struct {
+	Day        string `json:"day,omitempty"`
+	CustomerID int64  `json:"customer_id,omitempty"`
+	Type       string `json:"type,omitempty"`
+	Provider   string `json:"provider,omitempty"`
+	Status     string `json:"status,omitempty"`
+	Messages   int64  `json:"messages"`
+}
+
+// UsageReport returns the customer's usage.
+func (c *Client) UsageReport(ctx context.Context, q UsageQuery) (UsageReport, error) {
+	var out UsageReport
+	err := c.get(ctx, "/reports/usage", q.values(), &out)
+	return out, err
+}
+
+// AdminUsageReport returns the usage of all customers, or of q.CustomerID (admin).
+func (c *Client) AdminUsageReport(ctx context.Context, q UsageQuery) (UsageReport, error) {
+	v := q.values()
+	setInt(v, "customer_id", q.CustomerID)
+
+	var out UsageReport
+	err := c.get(ctx, "/admin/reports/usage", v, &out)
+	return out, err
+}
+
+// Invoice is a customer's invoice for one period.
+type Invoice struct {
+	ID          int64         `json:"id"`
+	Number      string        `json:"invoice_number"`
+	UserID      int64         `json:"user_id"`
+	Period      string        `json:"period"`
+	PeriodStart time.Time     `json:"period_start"`
+	PeriodEnd   time.Time     `json:"period_end"`
+	Charges     int64         `json:"charges"`
+	Refunds     int64         `json:"refunds"`
+	Total       int64         `json:"total"`
+	CreatedAt   time.Time     `json:"created_at"`
+	Lines       []InvoiceLine `json:"lines,omitempty"`
+}
+
+// InvoiceLine is one line of an Invoice.
+type InvoiceLine struct {
+	LineNo            int    `json:"line_no"`
+	Kind              string `json:"kind"`
+	Type              string `json:"type,omitempty"`
+	DestinationPrefix string `json:"destination_prefix,omitempty"`
+	UnitPrice         int64  `json:"unit_price"`
+	Quantity          int64  `json:"quantity"`
+	Amount            int64  `json:"amount"`
+}
+
+// GenerateInvoicesResult is the outcome of generating invoices for a period.
+type GenerateInvoicesResult struct {
+	Period string
+	// Created is the number of invoices created; existing invoices are left as they are.
+	Created int
+	// Invoice is the customer's invoice when one customer was asked for.
+	Invoice *Invoice
+}
+
+func (r *GenerateInvoicesResult) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		Period  string          `json:"period"`
+		Created json.RawMessage `json:"created"`
+		Invoice *Invoice        `json:"invoice"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	r.Period, r.Invoice = raw.Period, raw.Invoice
+
+	// "created" is a bool for one customer and a count for all of them.
+	var created bool
+	if err := json.Unmarshal(raw.Created, &created); err == nil {
+		r.Created = 0
+		if created {
+			r.Created = 1
+		}
+		return nil
+	}
+	return json.Unmarshal(raw.Created, &r.Created)
+}
+
+// ListInvoices lists the customer's invoices, without their lines.
+func (c *Client) ListInvoices(ctx context.Context) ([]Invoice, error) {
+	var out struct {
+		Invoices []Invoice `json:"invoices"`
+	}
+	err := c.get(ctx, "/invoices", nil, &out)
+	return out.Invoices, err
+}
+
+// GetInvoice returns one of the customer's invoices with its lines.
+func (c *Client) GetInvoice(ctx context.Context, number string) (Invoice, error) {
+	var out Invoice
+	err := c.get(ctx, pathf("/invoices/%s", number), nil, &out)
+	return out, err
+}
+
+// InvoiceCSV returns one of the customer's invoices as CSV.
+func (c *Client) InvoiceCSV(ctx context.Context, number string) ([]byte, error) {
+	var out []byte
+	err := c.get(ctx, pathf("/invoices/%s", number), url.Values{"format": {"csv"}}, &out)
+	return out, err
+}
+
+// GenerateInvoices creates the invoices of a closed month ("YYYY-MM") for one customer, or
+// for every postpaid customer when userID is 0 (admin).
+func (c *Client) GenerateInvoices(ctx context.Context, period string, userID int64) (GenerateInvoicesResult, error) {
+	body := map[string]any{"period": period, "user_id": userID}
+	var out GenerateInvoicesResult
+	err := c.adminPost(ctx, "/admin/invoices/generate", body, &out, true)
+	return out, err
+}
+
+// LedgerAccount is the balance of one ledger account.
+type LedgerAccount struct {
+	Code    string `json:"code"`
+	Kind    string `json:"kind"`
+	UserID  *int64 `json:"user_id,omitempty"`
+	Balance int64  `json:"balance"`
+}
+
+// LedgerBalances lists ledger accounts with the sum over all accounts, which is 0 when the
+// books balance.
+type LedgerBalances struct {
+	Accounts     []LedgerAccount `json:"accounts"`
+	TrialBalance int64           `json:"trial_balance"`
+}
+
+// JournalEntry is one posting of a ledger journal.
+type JournalEntry struct {
+	JournalID   int64  `json:"journal_id"`
+	Type        string `json:"journal_type"`
+	ReferenceID string `json:"reference_id"`
+	Account     string `json:"account"`
+	Amount      int64  `json:"amount"`
+	CreatedAt   string `json:"created_at"`
+}
+
+// LedgerAccounts returns the ledger balances, of one customer when userID is set (admin).
+func (c *Client) LedgerAccounts(ctx context.Context, userID int64) (LedgerBalances, error) {
+	query := url.Values{}
+	setInt(query, "user_id", userID)
+
+	var out LedgerBalances
+	err := c.get(ctx, "/admin/ledger/accounts", query, &out)
+	return out, err
+}
+
+// LedgerJournals returns the postings of the journals for a reference, e.g. a transaction
+// id (admin).
+func (c *Client) LedgerJournals(ctx context.Context, referenceID string) ([]JournalEntry, error) {
+	query := url.Values{}
+	setString(query, "reference_id", referenceID)
+
+	var out struct {
+		Entries []JournalEntry `json:"entries"`
+	}
+	err := c.get(ctx, "/admin/ledger/journals", query, &out)
+	return out.Entries, err
+}
+
+// ReconciliationRun is one comparison of balances with their transactions.
+type ReconciliationRun struct {
+	ID           int64   `json:"id"`
+	Trigger      string  `json:"trigger"`
+	Status       string  `json:"status"`
+	UsersChecked int64   `json:"users_checked"`
+	DriftCount   int64   `json:"drift_count"`
+	DriftTotal   int64   `json:"drift_total"`
+	Error        *string `json:"error,omitempty"`
+	StartedAt    string  `json:"started_at"`
+	FinishedAt   *string `json:"finished_at"`
+}
+
+// Drift is a balance that did not match its transactions in a run.
+type Drift struct {
+	ID                      int64   `json:"id"`
+	RunID                   int64   `json:"run_id"`
+	UserID                  int64   `json:"user_id"`
+	Balance                 int64   `json:"balance"`
+	TransactionsSum         int64   `json:"transactions_sum"`
+	Drift                   int64   `json:"drift"`
+	LedgerSum               int64   `json:"ledger_sum"`
+	LedgerDrift             int64   `json:"ledger_drift"`
+	Status                  string  `json:"status"`
+	CorrectiveTransactionID *string `json:"corrective_transaction_id"`
+	ApprovedBy              *string `json:"approved_by"`
+	CreatedAt               string  `json:"created_at"`
+}
+
+// ListReconciliationRuns lists the latest runs; limit 0 uses the gateway's default (admin).
+func (c *Client) ListReconciliationRuns(ctx context.Context, limit int) ([]ReconciliationRun, error) {
+	query := url.Values{}
+	setInt(query, "limit", int64(limit))
+
+	var out struct {
+		Runs []ReconciliationRun `json:"runs"`
+	}
+	err := c.get(ctx, "/admin/reconciliation/runs", query, &out)
+	return out.Runs, err
+}
+
+// RunReconciliation runs a reconciliation and returns it when it finishes (admin).
+func (c *Client) RunReconciliation(ctx context.Context) (ReconciliationRun, error) {
+	var out ReconciliationRun
+	err := c.adminPost(ctx, "/admin/reconciliation/runs", nil, &out, false)
+	return out, err
+}
+
+// ListDrifts lists the drifts found by a run (admin).
+func (c *Client) ListDrifts(ctx context.Context, runID int64) ([]Drift, error) {
+	var out struct {
+		Drifts []Drift `json:"drifts"`
+	}
+	err := c.get(ctx, pathf("/admin/reconciliation/runs/%d/drifts", runID), nil, &out)
+	return out.Drifts, err
+}
+
+// ApproveDrift books the corrective transaction of a drift (admin).
+func (c *Client) ApproveDrift(ctx context.Context, id int64) (Drift, error) {
+	var out Drift
+	err := c.adminPost(ctx, pathf("/admin/reconciliation/drifts/%d/approve", id), nil, &out, false)
+	return out, err
+}
@@ -0,0 +1,64 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// SMPPAccount is an SMPP login of a customer with the limits of each of its binds.
+type SMPPAccount struct {
+	SystemID   string    `json:"system_id"`
+	CustomerID int64     `json:"customer_id"`
+	MaxTPS     int       `json:"max_tps"`
+	WindowSize int       `json:"window_size"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// IssuedSMPPAccount is an SMPP account with its password, which is set when the account is
+// created or its password reset.
+type IssuedSMPPAccount struct {
+	SMPPAccount
+	Password string `json:"password,omitempty"`
+}
+
+// SMPPAccountRequest is the body of PUT /admin/smpp-accounts/{system_id}.
+type SMPPAccountRequest struct {
+	CustomerID int64 `json:"customer_id"`
+	MaxTPS     int   `json:"max_tps"`
+	WindowSize int   `json:"window_size"`
+}
+
+// ListSMPPAccounts lists the SMPP accounts of a customer, or all of them when customerID is 0
+// (admin).
+func (c *Client) ListSMPPAccounts(ctx context.Context, customerID int64) ([]SMPPAccount, error) {
+	query := url.Values{}
+	setInt(query, "customer_id", customerID)
+	var out struct {
+		Accounts []SMPPAccount `json:"accounts"`
+	}
+	err := c.get(ctx, "/admin/smpp-accounts", query, &out)
+	return out.Accounts, err
+}
+
+// SetSMPPAccount creates an SMPP account or changes its limits (admin). The password is only
+// returned on create, so it is not retried after a network error or a 5xx.
+func (c *Client) SetSMPPAccount(ctx context.Context, systemID string, req SMPPAccountRequest) (IssuedSMPPAccount, error) {
+	var out IssuedSMPPAccount
+	err := c.do(ctx, request{method: http.MethodPut, path: pathf("/admin/smpp-accounts/%s", systemID), body: req}, &out)
+	return out, err
+}
+
+// ResetSMPPPassword gives an SMPP account a new password (admin).
+func (c *Client) ResetSMPPPassword(ctx context.Context, systemID string) (IssuedSMPPAccount, error) {
+	var out IssuedSMPPAccount
+	err := c.adminPost(ctx, pathf("/admin/smpp-accounts/%s/password", systemID), nil, &out, false)
+	return out, err
+}
+
+// DeleteSMPPAccount deletes an SMPP account (admin).
+func (c *Client) DeleteSMPPAccount(ctx context.Context, systemID string) error {
+	return c.delete(ctx, pathf("/admin/smpp-accounts/%s", systemID), nil)
+}
@@ -0,0 +1,210 @@
+package client
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+)
+
+// MessageType is the delivery class of a message.
+type MessageType string
+
+const (
+	Normal  MessageType = "normal"
+	Express MessageType = "express"
+)
+
+// SendSMSRequest is the body of POST /sms/send.
+type SendSMSRequest struct {
+	Text       string      `json:"text"`
+	Recipients []string    `json:"recipients"`
+	Type       MessageType `json:"type"`
+	// Priority orders messages of one customer; nil uses the gateway's default.
+	Priority *int `json:"priority,omitempty"`
+}
+
+// SendSMSResponse is the result of an accepted send.
+type SendSMSResponse struct {
+	Status        string `json:"status"`
+	SmsIdentifier string `json:"sms_identifier"`
+}
+
+// HistoryEntry is the status of a message to one recipient.
+type HistoryEntry struct {
+	UserID        int64       `json:"user_id"`
+	Type          MessageType `json:"type"`
+	Status        string      `json:"status"`
+	Recipient     string      `json:"recipient"`
+	Provider      string      `json:"provider"`
+	SmsIdentifier string      `json:"sms_identifier"`
+	CreatedAt     string      `json:"created_at"`
+	UpdatedAt     string      `json:"updated_at"`
+}
+
+// HistoryQuery filters History; empty fields match everything.
+type HistoryQuery struct {
+	Status        string
+	SmsIdentifier string
+}
+
+// SendSMS sends one message to its recipients, charging the customer.
+func (c *Client) SendSMS(ctx context.Context, req SendSMSRequest) (SendSMSResponse, error) {
+	var out SendSMSResponse
+	err := c.post(ctx, "/sms/send", req, &out)
+	return out, err
+}
+
+// History lists the customer's messages per recipient.
+func (c *Client) History(ctx context.Context, q HistoryQuery) ([]HistoryEntry, error) {
+	query := url.Values{}
+	setString(query, "status", q.Status)
+	setString(query, "sms_identifier", q.SmsIdentifier)
+
+	var out struct {
+		History []HistoryEntry `json:"history"`
+	}
+	err := c.get(ctx, "/sms/history", query, &out)
+	return out.History, err
+}
+
+// OTPSendRequest is the body of POST /otp/send. Template must contain "{code}"; empty uses
+// the gateway's default.
+type OTPSendRequest struct {
+	Recipient string `json:"recipient"`
+	Template  string `json:"template,omitempty"`
+}
+
+// OTPSendResult is the message that carries the code and how long the code is valid.
+type OTPSendResult struct {
+	SmsIdentifier string `json:"sms_identifier"`
+	Status        string `json:"status"`
+	ExpiresIn     int    `json:"expires_in"`
+}
+
+// SendOTP sends a one-time code. A second code for the recipient within the cooldown is
+// rejected with RATE_LIMITED.
+func (c *Client) SendOTP(ctx context.Context, req OTPSendRequest) (OTPSendResult, error) {
+	var out OTPSendResult
+	err := c.post(ctx, "/otp/send", req, &out)
+	return out, err
+}
+
+// VerifyOTP checks a code; it returns nil when the code is correct, and an *Error with
+// INVALID_CODE, CODE_EXPIRED or TOO_MANY_ATTEMPTS otherwise.
+func (c *Client) VerifyOTP(ctx context.Context, recipient, code string) error {
+	body := map[string]string{"recipient": recipient, "code": code}
+	return c.post(ctx, "/otp/verify", body, nil)
+}
+
+// HeldMessage is a message held for review by a content rule.
+type HeldMessage struct {
+	SmsIdentifier string  `json:"sms_identifier"`
+	CustomerID    int64   `json:"customer_id"`
+	TransactionID string  `json:"transaction_id"`
+	SMS           HeldSMS `json:"sms"`
+	RuleID        int64   `json:"rule_id"`
+	Reason        string  `json:"reason"`
+	Status        string  `json:"status"`
+	ReviewedAt    *string `json:"reviewed_at"`
+	CreatedAt     string  `json:"created_at"`
+}
+
+// HeldSMS is the message as it was submitted.
+type HeldSMS struct {
+	CustomerID    int64       `json:"customer_id"`
+	Text          string      `json:"text"`
+	Recipients    []string    `json:"recipients"`
+	Type          MessageType `json:"type"`
+	Priority      *int        `json:"priority,omitempty"`
+	TransactionID string      `json:"transaction_id"`
+	SmsIdentifier string      `json:"sms_identifier"`
+}
+
+// ListHeldMessages lists held messages by status (default "held"); limit 0 uses the
+// gateway's default.
+func (c *Client) ListHeldMessages(ctx context.Context, status string, limit int) ([]HeldMessage, error) {
+	query := url.Values{}
+	setString(query, "status", status)
+	setInt(query, "limit", int64(limit))
+
+	var out struct {
+		Messages []HeldMessage `json:"messages"`
+	}
+	err := c.get(ctx, "/admin/held-messages", query, &out)
+	return out.Messages, err
+}
+
+// ApproveHeld releases a held message for delivery.
+func (c *Client) ApproveHeld(ctx context.Context, smsIdentifier string) error {
+	return c.adminPost(ctx, pathf("/admin/held-messages/%s/approve", smsIdentifier), nil, nil, false)
+}
+
+// RejectHeld drops a held message and releases its balance hold.
+func (c *Client) RejectHeld(ctx context.Context, smsIdentifier string) error {
+	return c.adminPost(ctx, pathf("/admin/held-messages/%s/reject", smsIdentifier), nil, nil, false)
+}
+
+// PriorityLimits is the range of priorities a customer may send with.
+type PriorityLimits struct {
+	CustomerID  int64 `json:"customer_id"`
+	MinPriority int   `json:"min_priority"`
+	MaxPriority int   `json:"max_priority"`
+}
+
+// GetPriorityLimits returns a customer's priority range.
+func (c *Client) GetPriorityLimits(ctx context.Context, customerID int64) (PriorityLimits, error) {
+	var out PriorityLimits
+	err := c.get(ctx, pathf("/admin/priority-limits/%d", customerID), nil, &out)
+	return out, err
+}
+
+// SetPriorityLimits replaces a customer's priority range.
+func (c *Client) SetPriorityLimits(ctx context.Context, customerID int64, minPriority, maxPriority int) error {
+	body := map[string]int{"min_priority": minPriority, "max_priority": maxPriority}
+	return c.put(ctx, pathf("/admin/priority-limits/%d", customerID), body, nil)
+}
+
+// SendLimits are a customer's quotas and rate limits; 0 means unlimited.
+type SendLimits struct {
+	CustomerID       int64 `json:"customer_id,omitempty"`
+	DailyQuota       int64 `json:"daily_quota"`
+	MonthlyQuota     int64 `json:"monthly_quota"`
+	RequestsPerSec   int64 `json:"requests_per_sec"`
+	RecipientsPerSec int64 `json:"recipients_per_sec"`
+}
+
+// SendUsage is a customer's limits with the current usage against them.
+type SendUsage struct {
+	SendLimits
+	DayUsed          int64 `json:"day_used"`
+	MonthUsed        int64 `json:"month_used"`
+	WindowRequests   int64 `json:"window_requests"`
+	WindowRecipients int64 `json:"window_recipients"`
+	DayResetSec      int64 `json:"day_reset_sec"`
+	MonthResetSec    int64 `json:"month_reset_sec"`
+}
+
+// GetSendLimits returns a customer's send limits and usage.
+func (c *Client) GetSendLimits(ctx context.Context, customerID int64) (SendUsage, error) {
+	var out SendUsage
+	err := c.get(ctx, pathf("/admin/send-limits/%d", customerID), nil, &out)
+	return out, err
+}
+
+// SetSendLimits replaces a customer's send limits; limits.CustomerID is ignored.
+func (c *Client) SetSendLimits(ctx context.Context, customerID int64, limits SendLimits) error {
+	limits.CustomerID = 0
+	return c.put(ctx, pathf("/admin/send-limits/%d", customerID), limits, nil)
+}
+
+func setString(q url.Values, key, v string) {
+	if v != "" {
+		q.Set(key, v)
+	}
+}
+
+func setInt(q url.Values, key string, v int64) {
+	if v != 0 {
+		q.Set(key, strconv.FormatInt(v, 10))
+	}
+}
@@ -0,0 +1,138 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// SubAccount is a child customer of the calling customer.
+type SubAccount struct {
+	ChildID      int64  `json:"child_id"`
+	ParentID     int64  `json:"parent_id"`
+	Name         string `json:"name"`
+	ChargeParent bool   `json:"charge_parent"`
+	// CreatedByParent is set for children the customer created; only their balance can be
+	// transferred back.
+	CreatedByParent bool      `json:"created_by_parent"`
+	CreatedAt       time.Time `json:"created_at"`
+	Balance         int64     `json:"balance"`
+	Available       int64     `json:"available"`
+}
+
+// SubAccountRequest is the body of POST /sub-accounts.
+type SubAccountRequest struct {
+	ChildID int64  `json:"child_id"`
+	Name    string `json:"name"`
+	// ChargeParent charges the child's sends to the parent's balance.
+	ChargeParent bool   `json:"charge_parent"`
+	KeyName      string `json:"key_name,omitempty"`
+}
+
+// CreatedSubAccount is a new sub-account with the child's first API key.
+type CreatedSubAccount struct {
+	SubAccount SubAccount `json:"sub_account"`
+	Key        IssuedKey  `json:"key"`
+}
+
+// LinkSubAccountRequest is the body of PUT /admin/sub-accounts/{child_id}.
+type LinkSubAccountRequest struct {
+	ParentID     int64  `json:"parent_id"`
+	Name         string `json:"name"`
+	ChargeParent bool   `json:"charge_parent"`
+}
+
+// SubAccountUsage is what one child sent of one message type.
+type SubAccountUsage struct {
+	CustomerID   int64       `json:"customer_id"`
+	Type         MessageType `json:"type"`
+	Messages     int64       `json:"messages"`
+	Amount       int64       `json:"amount"`
+	PaidByParent int64       `json:"paid_by_parent"`
+}
+
+// SubAccountUsageReport is the usage of all children in [From, To).
+type SubAccountUsageReport struct {
+	From  time.Time         `json:"from"`
+	To    time.Time         `json:"to"`
+	Usage []SubAccountUsage `json:"usage"`
+	Total struct {
+		Messages     int64 `json:"messages"`
+		Amount       int64 `json:"amount"`
+		PaidByParent int64 `json:"paid_by_parent"`
+	} `json:"total"`
+}
+
+// TransferResult is a balance transfer between a parent and a child.
+type TransferResult struct {
+	TransactionID string `json:"transaction_id"`
+	From          int64  `json:"from"`
+	To            int64  `json:"to"`
+	Amount        int64  `json:"amount"`
+}
+
+// ListSubAccounts lists the customer's children with their balances.
+func (c *Client) ListSubAccounts(ctx context.Context) ([]SubAccount, error) {
+	var out struct {
+		SubAccounts []SubAccount `json:"sub_accounts"`
+	}
+	err := c.get(ctx, "/sub-accounts", nil, &out)
+	return out.SubAccounts, err
+}
+
+// CreateSubAccount creates a new customer as a child of the customer. The response carries
+// the child's key, so like CreateKey it is not retried after a network error or a 5xx.
+func (c *Client) CreateSubAccount(ctx context.Context, req SubAccountRequest) (CreatedSubAccount, error) {
+	var out CreatedSubAccount
+	err := c.do(ctx, request{method: http.MethodPost, path: "/sub-accounts", body: req}, &out)
+	return out, err
+}
+
+// UpdateSubAccount changes a child's name and charge_parent.
+func (c *Client) UpdateSubAccount(ctx context.Context, childID int64, name string, chargeParent bool) error {
+	body := map[string]any{"name": name, "charge_parent": chargeParent}
+	return c.put(ctx, pathf("/sub-accounts/%d", childID), body, nil)
+}
+
+// LinkSubAccount makes an existing customer a child of req.ParentID (admin).
+func (c *Client) LinkSubAccount(ctx context.Context, childID int64, req LinkSubAccountRequest) error {
+	return c.put(ctx, pathf("/admin/sub-accounts/%d", childID), req, nil)
+}
+
+// SubAccountUsage returns the children's usage in [from, to); zero times use the last 30 days.
+func (c *Client) SubAccountUsage(ctx context.Context, from, to time.Time) (SubAccountUsageReport, error) {
+	query := url.Values{}
+	setTime(query, "from", from)
+	setTime(query, "to", to)
+
+	var out SubAccountUsageReport
+	err := c.get(ctx, "/sub-accounts/usage", query, &out)
+	return out, err
+}
+
+// Transfer moves amount from the customer to a child; a negative amount moves it back from a
+// child the customer created.
+func (c *Client) Transfer(ctx context.Context, childID, amount int64, description string) (TransferResult, error) {
+	body := map[string]any{"amount": amount, "description": description}
+	var out TransferResult
+	err := c.post(ctx, pathf("/sub-accounts/%d/transfer", childID), body, &out)
+	return out, err
+}
+
+// ListSubAccountPrices lists a child's prices.
+func (c *Client) ListSubAccountPrices(ctx context.Context, childID int64) ([]Price, error) {
+	var out struct {
+		Prices []Price `json:"prices"`
+	}
+	err := c.get(ctx, pathf("/sub-accounts/%d/prices", childID), nil, &out)
+	return out.Prices, err
+}
+
+// CreateSubAccountPrice adds a price for a child; req.CustomerID is ignored.
+func (c *Client) CreateSubAccountPrice(ctx context.Context, childID int64, req PriceRequest) (Price, error) {
+	req.CustomerID = 0
+	var out Price
+	err := c.post(ctx, pathf("/sub-accounts/%d/prices", childID), req, &out)
+	return out, err
+}
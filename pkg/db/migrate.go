@@ -5,6 +5,8 @@ import (
 	"strings"
 )
 
+// MigrateFromFile creates the tables of the schema file that do not exist yet, then adds the
+// columns and indexes the schema gained since existing tables were created.
 func MigrateFromFile(database *DB, path string) error {
 	content, err := os.ReadFile(path)
 	if err != nil {
@@ -24,5 +26,5 @@ func MigrateFromFile(database *DB, path string) error {
 			return err
 		}
 	}
-	return nil
+	return upgradeTables(database)
 }
@@ -0,0 +1,96 @@
+package db
+
+import "fmt"
+
+// upgrade is a change db.sql made to a table after it was first created. MigrateFromFile only
+// creates missing tables, so the change is applied to an existing one when check counts no
+// rows showing it is already in place.
+type upgrade struct {
+	check string
+	args  []any
+	alter []string
+}
+
+// addColumn adds column to table; backfill runs once after it, for rows written before.
+func addColumn(table, column, definition string, backfill ...string) upgrade {
+	return upgrade{
+		check: `SELECT COUNT(*) FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND COLUMN_NAME = ?`,
+		args:  []any{table, column},
+		alter: append([]string{fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition)}, backfill...),
+	}
+}
+
+// widenColumn redefines a text column of table that is shorter than length characters.
+func widenColumn(table, column, definition string, length int) upgrade {
+	return upgrade{
+		check: `SELECT COUNT(*) FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND COLUMN_NAME = ? AND CHARACTER_MAXIMUM_LENGTH >= ?`,
+		args:  []any{table, column, length},
+		alter: []string{fmt.Sprintf("ALTER TABLE %s MODIFY COLUMN %s %s", table, column, definition)},
+	}
+}
+
+// addIndex adds index on columns to table; unique makes it a unique key.
+func addIndex(table, index, columns string, unique bool) upgrade {
+	kind := "INDEX"
+	if unique {
+		kind = "UNIQUE KEY"
+	}
+	return upgrade{
+		check: `SELECT COUNT(*) FROM information_schema.STATISTICS WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND INDEX_NAME = ?`,
+		args:  []any{table, index},
+		alter: []string{fmt.Sprintf("ALTER TABLE %s ADD %s %s (%s)", table, kind, index, columns)},
+	}
+}
+
+// upgrades are applied in order, oldest first.
+var upgrades = []upgrade{
+	// Per-customer prices.
+	addColumn("user_transactions", "price_version", "VARCHAR(255) NULL"),
+	// Balance holds.
+	addColumn("user_balances", "held", "BIGINT NOT NULL DEFAULT 0"),
+	addColumn("user_transactions", "reference_id", "VARCHAR(50) NULL"),
+	addIndex("user_transactions", "idx_user_transactions_reference_id", "reference_id", false),
+	// Postpaid accounts.
+	addColumn("user_balances", "account_mode", "VARCHAR(20) NOT NULL DEFAULT 'prepaid'"),
+	addColumn("user_balances", "credit_limit", "BIGINT NOT NULL DEFAULT 0"),
+	addColumn("user_balances", "credit_soft_limit", "BIGINT NULL"),
+	// Low-balance alerts: one outbox event per channel.
+	widenColumn("outbox_events", "aggregate_id", "VARCHAR(100) NOT NULL", 100),
+	// Ledger check in reconciliation.
+	addColumn("reconciliation_drifts", "ledger_sum", "BIGINT NOT NULL DEFAULT 0"),
+	addColumn("reconciliation_drifts", "ledger_drift", "BIGINT NOT NULL DEFAULT 0"),
+	// Sub-accounts: holds record who sent, which before was always who paid.
+	addColumn("balance_holds", "customer_id", "BIGINT NOT NULL DEFAULT 0",
+		"UPDATE balance_holds SET customer_id = user_id WHERE customer_id = 0"),
+	addIndex("balance_holds", "idx_balance_holds_customer_status", "customer_id, status, updated_at", false),
+	addColumn("sub_accounts", "created_by_parent", "TINYINT(1) NOT NULL DEFAULT 0"),
+	// Invoices.
+	addIndex("balance_holds", "idx_balance_holds_user_status_updated", "user_id, status, updated_at", false),
+	// Idempotent top-ups.
+	addColumn("user_transactions", "payment_source", "VARCHAR(50) NULL"),
+	addColumn("user_transactions", "payment_reference", "VARCHAR(100) NULL"),
+	addIndex("user_transactions", "uq_user_transactions_payment", "payment_source, payment_reference", true),
+	// Sharded balances.
+	addColumn("user_balances", "shards", "INT NOT NULL DEFAULT 0"),
+	addColumn("balance_holds", "shard", "INT NOT NULL DEFAULT 0"),
+	// Holds of messages in review are left to the held-message expirer.
+	addIndex("held_messages", "idx_held_messages_transaction", "transaction_id, status", false),
+}
+
+func upgradeTables(database *DB) error {
+	for _, u := range upgrades {
+		var n int
+		if err := database.Get(&n, u.check, u.args...); err != nil {
+			return err
+		}
+		if n > 0 {
+			continue
+		}
+		for _, stmt := range u.alter {
+			if _, err := database.Exec(stmt); err != nil {
+				return fmt.Errorf("upgrade: %s: %w", stmt, err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,21 @@
+package metrics
+
+import (
+	prom "github.com/prometheus/client_golang/prometheus"
+)
+
+var auditWriteFailures = prom.NewCounter(
+	prom.CounterOpts{
+		Name: "admin_audit_write_failures_total",
+		Help: "Count of admin requests whose audit log entry could not be written",
+	},
+)
+
+func init() {
+	prom.MustRegister(auditWriteFailures)
+}
+
+// AuditWriteFailed records an admin request that is missing from the audit log.
+func AuditWriteFailed() {
+	auditWriteFailures.Inc()
+}
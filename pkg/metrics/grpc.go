@@ -0,0 +1,66 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	prom "github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	grpcRequests = prom.NewCounterVec(
+		prom.CounterOpts{
+			Name: "grpc_requests_total",
+			Help: "Total gRPC calls processed",
+		},
+		[]string{"method", "code"},
+	)
+	grpcDuration = prom.NewHistogramVec(
+		prom.HistogramOpts{
+			Name:    "grpc_request_duration_seconds",
+			Help:    "gRPC call latency; for streams, how long the stream was open",
+			Buckets: prom.DefBuckets,
+		},
+		[]string{"method"},
+	)
+	statusEventsDropped = prom.NewCounter(
+		prom.CounterOpts{
+			Name: "sms_status_events_dropped_total",
+			Help: "Count of status events not delivered to a subscriber that fell behind",
+		},
+	)
+)
+
+func init() {
+	prom.MustRegister(grpcRequests, grpcDuration, statusEventsDropped)
+}
+
+func GRPCUnaryInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		start := time.Now()
+		resp, err := handler(ctx, req)
+		observeGRPC(info.FullMethod, start, err)
+		return resp, err
+	}
+}
+
+func GRPCStreamInterceptor() grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		start := time.Now()
+		err := handler(srv, ss)
+		observeGRPC(info.FullMethod, start, err)
+		return err
+	}
+}
+
+func observeGRPC(method string, start time.Time, err error) {
+	grpcDuration.WithLabelValues(method).Observe(time.Since(start).Seconds())
+	grpcRequests.WithLabelValues(method, status.Code(err).String()).Inc()
+}
+
+// StatusEventDropped records a status event a slow subscriber missed.
+func StatusEventDropped() {
+	statusEventsDropped.Inc()
+}
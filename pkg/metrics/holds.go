@@ -0,0 +1,21 @@
+package metrics
+
+import (
+	prom "github.com/prometheus/client_golang/prometheus"
+)
+
+var expiredHoldsCaptured = prom.NewCounter(
+	prom.CounterOpts{
+		Name: "balance_expired_holds_captured_total",
+		Help: "Holds captured after they had expired, charged from the balance again",
+	},
+)
+
+func init() {
+	prom.MustRegister(expiredHoldsCaptured)
+}
+
+// ExpiredHoldsCaptured records n holds whose delivery was reported after they expired.
+func ExpiredHoldsCaptured(n int) {
+	expiredHoldsCaptured.Add(float64(n))
+}
@@ -0,0 +1,22 @@
+package metrics
+
+import (
+	prom "github.com/prometheus/client_golang/prometheus"
+)
+
+var sendLimited = prom.NewCounterVec(
+	prom.CounterOpts{
+		Name: "send_limited_total",
+		Help: "Count of send requests refused by a customer quota or rate limit",
+	},
+	[]string{"limit"},
+)
+
+func init() {
+	prom.MustRegister(sendLimited)
+}
+
+// SendLimited records a send refused by the given limit.
+func SendLimited(limit string) {
+	sendLimited.WithLabelValues(limit).Inc()
+}
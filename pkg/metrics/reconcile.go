@@ -0,0 +1,40 @@
+package metrics
+
+import (
+	prom "github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	reconcileRuns = prom.NewCounterVec(
+		prom.CounterOpts{
+			Name: "reconcile_runs_total",
+			Help: "Count of balance reconciliation runs",
+		},
+		[]string{"result"},
+	)
+	reconcileDriftUsers = prom.NewGauge(
+		prom.GaugeOpts{
+			Name: "reconcile_drift_users",
+			Help: "Users whose balance differed from the sum of their transactions in the last run",
+		},
+	)
+	reconcileDriftAmount = prom.NewGauge(
+		prom.GaugeOpts{
+			Name: "reconcile_drift_amount_abs",
+			Help: "Sum of absolute balance drift found in the last run",
+		},
+	)
+)
+
+func init() {
+	prom.MustRegister(reconcileRuns, reconcileDriftUsers, reconcileDriftAmount)
+}
+
+// ReconcileRun records the outcome of a reconciliation run.
+func ReconcileRun(result string, driftUsers int, driftAbs int64) {
+	reconcileRuns.WithLabelValues(result).Inc()
+	if result == "success" {
+		reconcileDriftUsers.Set(float64(driftUsers))
+		reconcileDriftAmount.Set(float64(driftAbs))
+	}
+}
@@ -0,0 +1,52 @@
+package metrics
+
+import (
+	prom "github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	smppBinds = prom.NewGaugeVec(
+		prom.GaugeOpts{
+			Name: "smpp_binds",
+			Help: "Number of open SMPP binds, by bind type",
+		},
+		[]string{"bind_type"},
+	)
+	smppRequests = prom.NewCounterVec(
+		prom.CounterOpts{
+			Name: "smpp_requests_total",
+			Help: "SMPP requests answered, by command and command_status",
+		},
+		[]string{"command", "status"},
+	)
+	smppReceipts = prom.NewCounterVec(
+		prom.CounterOpts{
+			Name: "smpp_receipts_total",
+			Help: "Delivery receipts sent as deliver_sm, by result",
+		},
+		[]string{"result"},
+	)
+)
+
+func init() {
+	prom.MustRegister(smppBinds, smppRequests, smppReceipts)
+}
+
+// SMPPBindOpened records an open bind; SMPPBindClosed undoes it.
+func SMPPBindOpened(bindType string) {
+	smppBinds.WithLabelValues(bindType).Inc()
+}
+
+func SMPPBindClosed(bindType string) {
+	smppBinds.WithLabelValues(bindType).Dec()
+}
+
+// SMPPRequest records the response to an SMPP request.
+func SMPPRequest(command, status string) {
+	smppRequests.WithLabelValues(command, status).Inc()
+}
+
+// SMPPReceipt records a delivery receipt that was acknowledged (ok) or not (failed).
+func SMPPReceipt(result string) {
+	smppReceipts.WithLabelValues(result).Inc()
+}
@@ -0,0 +1,39 @@
+package metrics
+
+import (
+	prom "github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	statusStreams = prom.NewGauge(
+		prom.GaugeOpts{
+			Name: "sms_status_streams",
+			Help: "Number of open status event streams",
+		},
+	)
+	statusBridgeEvents = prom.NewCounterVec(
+		prom.CounterOpts{
+			Name: "sms_status_bridge_events_total",
+			Help: "Status events exchanged with other instances, by direction (out|in) and result",
+		},
+		[]string{"direction", "result"},
+	)
+)
+
+func init() {
+	prom.MustRegister(statusStreams, statusBridgeEvents)
+}
+
+// StatusStreamOpened records an open status stream; StatusStreamClosed undoes it.
+func StatusStreamOpened() {
+	statusStreams.Inc()
+}
+
+func StatusStreamClosed() {
+	statusStreams.Dec()
+}
+
+// StatusBridgeEvent records a status event sent to (out) or received from (in) other instances.
+func StatusBridgeEvent(direction, result string) {
+	statusBridgeEvents.WithLabelValues(direction, result).Inc()
+}
@@ -35,6 +35,8 @@ type PublishRequest struct {
 	Exchange string
 	Key      string
 	Msg      []byte
+	// Priority is the AMQP message priority; only honoured by queues declared with x-max-priority.
+	Priority uint8
 }
 
 func (rp *RabbitConnection) PublishContext(ctx context.Context, req PublishRequest) error {
@@ -60,6 +62,7 @@ func (rp *RabbitConnection) PublishContext(ctx context.Context, req PublishReque
 	publishFn := metrics.OperatorObserver("rabbit_publish", func(c context.Context) error {
 		return ch.PublishWithContext(c, req.Exchange, req.Key, false, false, amqp091.Publishing{
 			Timestamp: time.Now(),
+			Priority:  req.Priority,
 			Body:      req.Msg,
 		})
 	})
@@ -70,7 +73,7 @@ func (rp *RabbitConnection) PublishContext(ctx context.Context, req PublishReque
 	return nil
 }
 
-func (rp *RabbitConnection) ConsumeContext(ctx context.Context, appName string, queueName string, routingKey string, exchangeName string, prefetch int,
+func (rp *RabbitConnection) ConsumeContext(ctx context.Context, appName string, queueName string, routingKey string, exchangeName string, prefetch int, queueArgs amqp091.Table,
 ) (<-chan amqp091.Delivery, error) {
 	ctx, span := tracing.Start(ctx, "rabbit.consume",
 		tracing.Attr("queue", queueName),
@@ -85,7 +88,10 @@ func (rp *RabbitConnection) ConsumeContext(ctx context.Context, appName string,
 		return nil, err
 	}
 
-	_, err = ch.QueueDeclare(queueName, true, false, false, false, amqp091.Table{})
+	if queueArgs == nil {
+		queueArgs = amqp091.Table{}
+	}
+	_, err = ch.QueueDeclare(queueName, true, false, false, false, queueArgs)
 	if err != nil {
 		slog.Error("cannot declare rabbit queue", "err", err)
 		return nil, err
@@ -138,3 +144,40 @@ func (rp *RabbitConnection) Close() error {
 	}
 	return rp.Conn.Close()
 }
+
+// ConsumeFanout declares a durable fanout exchange and consumes it through an exclusive,
+// server-named queue that is deleted with the connection, so every consumer gets every
+// message. Deliveries are acked automatically.
+func (rp *RabbitConnection) ConsumeFanout(ctx context.Context, appName string, exchangeName string) (<-chan amqp091.Delivery, error) {
+	ch, err := rp.Conn.Channel()
+	if err != nil {
+		slog.Error("cannot create channel from rabbit mq connection", "err", err)
+		return nil, err
+	}
+
+	if err = ch.ExchangeDeclare(exchangeName, "fanout", true, false, false, false, amqp091.Table{}); err != nil {
+		slog.Error("cannot declare rabbit exchange", "err", err)
+		return nil, err
+	}
+	q, err := ch.QueueDeclare("", false, true, true, false, amqp091.Table{})
+	if err != nil {
+		slog.Error("cannot declare rabbit queue", "err", err)
+		return nil, err
+	}
+	if err = ch.QueueBind(q.Name, "", exchangeName, false, amqp091.Table{}); err != nil {
+		slog.Error("cannot bind rabbit queue", "err", err)
+		return nil, err
+	}
+
+	delivery, err := ch.ConsumeWithContext(ctx, q.Name, fmt.Sprintf("consumer-%s-%s", appName, uuid.NewString()),
+		true,
+		true,
+		false,
+		false,
+		amqp091.Table{})
+	if err != nil {
+		slog.Error("cannot consume rabbit queue", "err", err)
+		return nil, err
+	}
+	return delivery, nil
+}
@@ -2,6 +2,8 @@ package amqp
 
 import (
 	"context"
+	"errors"
+	"fmt"
 
 	"github.com/rabbitmq/amqp091-go"
 )
@@ -15,6 +17,18 @@ type QueueSetup struct {
 	URI      string
 	Exchange string
 	Bindings []QueueBinding
+	// MaxPriority, when > 0, declares every queue as a priority queue (x-max-priority).
+	MaxPriority int
+}
+
+// QueueArgs returns the declare arguments for a queue with the given max priority.
+// Declarations of the same queue must use identical arguments, so consumers use it too.
+func QueueArgs(maxPriority int) amqp091.Table {
+	args := amqp091.Table{}
+	if maxPriority > 0 {
+		args["x-max-priority"] = int32(maxPriority)
+	}
+	return args
 }
 
 func SetupQueues(ctx context.Context, cfg QueueSetup) error {
@@ -44,7 +58,12 @@ func SetupQueues(ctx context.Context, cfg QueueSetup) error {
 	}
 
 	for _, b := range cfg.Bindings {
-		if _, err = ch.QueueDeclare(b.Queue, true, false, false, false, amqp091.Table{}); err != nil {
+		if _, err = ch.QueueDeclare(b.Queue, true, false, false, false, QueueArgs(cfg.MaxPriority)); err != nil {
+			var amqpErr *amqp091.Error
+			if errors.As(err, &amqpErr) && amqpErr.Code == amqp091.PreconditionFailed {
+				// An existing queue declared with other arguments, e.g. before priority queues.
+				return fmt.Errorf("queue %s exists with other arguments, recreate it (see README, Migrating to priority queues): %w", b.Queue, err)
+			}
 			return err
 		}
 		if err = ch.QueueBind(b.Queue, b.RoutingKey, cfg.Exchange, false, amqp091.Table{}); err != nil {
@@ -17,6 +17,7 @@ type ConsumerConfig struct {
 	WorkerGoRoutineCount int
 	DeliveryHandler      func(ctx context.Context, dv amqp091.Delivery) error
 	Prefetch             int
+	QueueArgs            amqp091.Table
 }
 
 func MakeConsumerWithWorkers(
@@ -28,6 +29,7 @@ func MakeConsumerWithWorkers(
 	workerCount int,
 	deliveryHandler func(ctx context.Context, dv amqp091.Delivery) error,
 	prefetch int,
+	queueArgs amqp091.Table,
 ) func(ctx context.Context) error {
 	return func(ctx context.Context) error {
 		var conn *RabbitConnection
@@ -52,6 +54,7 @@ func MakeConsumerWithWorkers(
 				routingKey,
 				exchangeName,
 				prefetch,
+				queueArgs,
 			)
 
 			if err != nil {
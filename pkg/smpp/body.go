@@ -0,0 +1,273 @@
+package smpp
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+var ErrShortBody = errors.New("pdu body too short")
+
+// Optional parameter (TLV) tags.
+const (
+	TagReceiptedMessageID uint16 = 0x001E
+	TagMessagePayload     uint16 = 0x0424
+	TagMessageState       uint16 = 0x0427
+)
+
+// message_state values of delivery receipts.
+const (
+	StateEnroute       byte = 1
+	StateDelivered     byte = 2
+	StateExpired       byte = 3
+	StateDeleted       byte = 4
+	StateUndeliverable byte = 5
+	StateAccepted      byte = 6
+	StateUnknown       byte = 7
+	StateRejected      byte = 8
+)
+
+// ESM class bits.
+const (
+	EsmClassDeliveryReceipt byte = 0x04
+	EsmClassUDHI            byte = 0x40
+)
+
+// Bind is the body of bind_transmitter, bind_receiver and bind_transceiver.
+type Bind struct {
+	SystemID         string
+	Password         string
+	SystemType       string
+	InterfaceVersion byte
+	AddrTON          byte
+	AddrNPI          byte
+	AddressRange     string
+}
+
+// ParseBind decodes a bind body.
+func ParseBind(body []byte) (Bind, error) {
+	d := decoder{b: body}
+	b := Bind{
+		SystemID:         d.cstring(),
+		Password:         d.cstring(),
+		SystemType:       d.cstring(),
+		InterfaceVersion: d.byte(),
+		AddrTON:          d.byte(),
+		AddrNPI:          d.byte(),
+		AddressRange:     d.cstring(),
+	}
+	return b, d.err
+}
+
+// Bytes encodes b.
+func (b Bind) Bytes() []byte {
+	var e encoder
+	e.cstring(b.SystemID)
+	e.cstring(b.Password)
+	e.cstring(b.SystemType)
+	e.byte(b.InterfaceVersion)
+	e.byte(b.AddrTON)
+	e.byte(b.AddrNPI)
+	e.cstring(b.AddressRange)
+	return e.b
+}
+
+// SystemIDBody is the body of bind_*_resp: the SMSC's system_id.
+func SystemIDBody(systemID string) []byte {
+	var e encoder
+	e.cstring(systemID)
+	return e.b
+}
+
+// MessageIDBody is the body of submit_sm_resp and deliver_sm_resp.
+func MessageIDBody(messageID string) []byte {
+	var e encoder
+	e.cstring(messageID)
+	return e.b
+}
+
+// ParseMessageID decodes the body of submit_sm_resp or deliver_sm_resp.
+func ParseMessageID(body []byte) (string, error) {
+	d := decoder{b: body}
+	id := d.cstring()
+	return id, d.err
+}
+
+// TLV is an optional parameter.
+type TLV struct {
+	Tag   uint16
+	Value []byte
+}
+
+// ShortMessage is the body of submit_sm and deliver_sm, which share their layout.
+type ShortMessage struct {
+	ServiceType          string
+	SourceAddrTON        byte
+	SourceAddrNPI        byte
+	SourceAddr           string
+	DestAddrTON          byte
+	DestAddrNPI          byte
+	DestinationAddr      string
+	EsmClass             byte
+	ProtocolID           byte
+	PriorityFlag         byte
+	ScheduleDeliveryTime string
+	ValidityPeriod       string
+	RegisteredDelivery   byte
+	ReplaceIfPresentFlag byte
+	DataCoding           byte
+	SmDefaultMsgID       byte
+	Message              []byte
+	TLVs                 []TLV
+}
+
+// ParseShortMessage decodes a submit_sm or deliver_sm body.
+func ParseShortMessage(body []byte) (ShortMessage, error) {
+	d := decoder{b: body}
+	m := ShortMessage{
+		ServiceType:          d.cstring(),
+		SourceAddrTON:        d.byte(),
+		SourceAddrNPI:        d.byte(),
+		SourceAddr:           d.cstring(),
+		DestAddrTON:          d.byte(),
+		DestAddrNPI:          d.byte(),
+		DestinationAddr:      d.cstring(),
+		EsmClass:             d.byte(),
+		ProtocolID:           d.byte(),
+		PriorityFlag:         d.byte(),
+		ScheduleDeliveryTime: d.cstring(),
+		ValidityPeriod:       d.cstring(),
+		RegisteredDelivery:   d.byte(),
+		ReplaceIfPresentFlag: d.byte(),
+		DataCoding:           d.byte(),
+		SmDefaultMsgID:       d.byte(),
+	}
+	m.Message = d.bytes(int(d.byte()))
+	for d.err == nil && d.off < len(d.b) {
+		tag := d.uint16()
+		m.TLVs = append(m.TLVs, TLV{Tag: tag, Value: d.bytes(int(d.uint16()))})
+	}
+	return m, d.err
+}
+
+// Bytes encodes m. Message must not be longer than 254 octets; longer text goes into a
+// message_payload TLV.
+func (m ShortMessage) Bytes() []byte {
+	var e encoder
+	e.cstring(m.ServiceType)
+	e.byte(m.SourceAddrTON)
+	e.byte(m.SourceAddrNPI)
+	e.cstring(m.SourceAddr)
+	e.byte(m.DestAddrTON)
+	e.byte(m.DestAddrNPI)
+	e.cstring(m.DestinationAddr)
+	e.byte(m.EsmClass)
+	e.byte(m.ProtocolID)
+	e.byte(m.PriorityFlag)
+	e.cstring(m.ScheduleDeliveryTime)
+	e.cstring(m.ValidityPeriod)
+	e.byte(m.RegisteredDelivery)
+	e.byte(m.ReplaceIfPresentFlag)
+	e.byte(m.DataCoding)
+	e.byte(m.SmDefaultMsgID)
+	e.byte(byte(len(m.Message)))
+	e.b = append(e.b, m.Message...)
+	for _, t := range m.TLVs {
+		e.uint16(t.Tag)
+		e.uint16(uint16(len(t.Value)))
+		e.b = append(e.b, t.Value...)
+	}
+	return e.b
+}
+
+// TLV returns the value of the first TLV with tag.
+func (m ShortMessage) TLV(tag uint16) ([]byte, bool) {
+	for _, t := range m.TLVs {
+		if t.Tag == tag {
+			return t.Value, true
+		}
+	}
+	return nil, false
+}
+
+// Text returns the message octets: short_message, or message_payload when short_message is
+// empty.
+func (m ShortMessage) Text() []byte {
+	if len(m.Message) == 0 {
+		if v, ok := m.TLV(TagMessagePayload); ok {
+			return v
+		}
+	}
+	return m.Message
+}
+
+type decoder struct {
+	b   []byte
+	off int
+	err error
+}
+
+func (d *decoder) cstring() string {
+	if d.err != nil {
+		return ""
+	}
+	for i := d.off; i < len(d.b); i++ {
+		if d.b[i] == 0 {
+			s := string(d.b[d.off:i])
+			d.off = i + 1
+			return s
+		}
+	}
+	d.err = ErrShortBody
+	return ""
+}
+
+func (d *decoder) byte() byte {
+	if d.err != nil {
+		return 0
+	}
+	if d.off >= len(d.b) {
+		d.err = ErrShortBody
+		return 0
+	}
+	v := d.b[d.off]
+	d.off++
+	return v
+}
+
+func (d *decoder) uint16() uint16 {
+	b := d.bytes(2)
+	if d.err != nil {
+		return 0
+	}
+	return binary.BigEndian.Uint16(b)
+}
+
+func (d *decoder) bytes(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if d.off+n > len(d.b) {
+		d.err = ErrShortBody
+		return nil
+	}
+	v := d.b[d.off : d.off+n]
+	d.off += n
+	return v
+}
+
+type encoder struct {
+	b []byte
+}
+
+func (e *encoder) cstring(s string) {
+	e.b = append(e.b, s...)
+	e.b = append(e.b, 0)
+}
+
+func (e *encoder) byte(v byte) {
+	e.b = append(e.b, v)
+}
+
+func (e *encoder) uint16(v uint16) {
+	e.b = binary.BigEndian.AppendUint16(e.b, v)
+}
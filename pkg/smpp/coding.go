@@ -0,0 +1,77 @@
+package smpp
+
+import (
+	"errors"
+	"unicode/utf16"
+)
+
+// data_coding values DecodeText understands.
+const (
+	CodingDefault byte = 0x00 // SMSC default alphabet, GSM 03.38 here
+	CodingIA5     byte = 0x01
+	CodingLatin1  byte = 0x03
+	CodingUCS2    byte = 0x08
+)
+
+var (
+	ErrUnsupportedCoding = errors.New("unsupported data_coding")
+	ErrInvalidText       = errors.New("text does not match data_coding")
+)
+
+// gsm7 is the GSM 03.38 default alphabet, one unpacked septet per octet.
+var gsm7 = []rune("@£$¥èéùìòÇ\nØø\rÅåΔ_ΦΓΛΩΠΨΣΘΞ\x1bÆæßÉ !\"#¤%&'()*+,-./0123456789:;<=>?" +
+	"¡ABCDEFGHIJKLMNOPQRSTUVWXYZÄÖÑÜ§¿abcdefghijklmnopqrstuvwxyzäöñüà")
+
+// gsm7Ext is the extension table reached through the 0x1B escape.
+var gsm7Ext = map[byte]rune{
+	0x0A: '\f', 0x14: '^', 0x28: '{', 0x29: '}', 0x2F: '\\',
+	0x3C: '[', 0x3D: '~', 0x3E: ']', 0x40: '|', 0x65: '€',
+}
+
+// DecodeText turns the octets of a short message into a string: GSM 03.38 for the default
+// alphabet (unpacked, as SMPP carries it), ASCII, Latin-1 or UCS-2 (as UTF-16BE).
+func DecodeText(dataCoding byte, b []byte) (string, error) {
+	switch dataCoding {
+	case CodingDefault:
+		out := make([]rune, 0, len(b))
+		for i := 0; i < len(b); i++ {
+			c := b[i]
+			if c >= 0x80 {
+				return "", ErrInvalidText
+			}
+			if c == 0x1B && i+1 < len(b) {
+				if r, ok := gsm7Ext[b[i+1]]; ok {
+					out = append(out, r)
+					i++
+					continue
+				}
+			}
+			out = append(out, gsm7[c])
+		}
+		return string(out), nil
+	case CodingIA5:
+		for _, c := range b {
+			if c >= 0x80 {
+				return "", ErrInvalidText
+			}
+		}
+		return string(b), nil
+	case CodingLatin1:
+		out := make([]rune, len(b))
+		for i, c := range b {
+			out[i] = rune(c)
+		}
+		return string(out), nil
+	case CodingUCS2:
+		if len(b)%2 != 0 {
+			return "", ErrInvalidText
+		}
+		units := make([]uint16, len(b)/2)
+		for i := range units {
+			units[i] = uint16(b[2*i])<<8 | uint16(b[2*i+1])
+		}
+		return string(utf16.Decode(units)), nil
+	default:
+		return "", ErrUnsupportedCoding
+	}
+}
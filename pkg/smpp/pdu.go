@@ -0,0 +1,157 @@
+// Package smpp reads and writes SMPP 3.4 PDUs: the header, the bind, submit_sm and deliver_sm
+// bodies and their TLVs. It knows nothing about sessions; see internal/smppapi for the server.
+package smpp
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// CommandID identifies a PDU.
+type CommandID uint32
+
+const (
+	GenericNack         CommandID = 0x80000000
+	BindReceiver        CommandID = 0x00000001
+	BindReceiverResp    CommandID = 0x80000001
+	BindTransmitter     CommandID = 0x00000002
+	BindTransmitterResp CommandID = 0x80000002
+	SubmitSM            CommandID = 0x00000004
+	SubmitSMResp        CommandID = 0x80000004
+	DeliverSM           CommandID = 0x00000005
+	DeliverSMResp       CommandID = 0x80000005
+	Unbind              CommandID = 0x00000006
+	UnbindResp          CommandID = 0x80000006
+	BindTransceiver     CommandID = 0x00000009
+	BindTransceiverResp CommandID = 0x80000009
+	EnquireLink         CommandID = 0x00000015
+	EnquireLinkResp     CommandID = 0x80000015
+)
+
+// IsResponse reports whether id is a response to another PDU.
+func (id CommandID) IsResponse() bool {
+	return id&0x80000000 != 0
+}
+
+// Resp is the response to id.
+func (id CommandID) Resp() CommandID {
+	return id | 0x80000000
+}
+
+func (id CommandID) String() string {
+	switch id {
+	case GenericNack:
+		return "generic_nack"
+	case BindReceiver:
+		return "bind_receiver"
+	case BindReceiverResp:
+		return "bind_receiver_resp"
+	case BindTransmitter:
+		return "bind_transmitter"
+	case BindTransmitterResp:
+		return "bind_transmitter_resp"
+	case SubmitSM:
+		return "submit_sm"
+	case SubmitSMResp:
+		return "submit_sm_resp"
+	case DeliverSM:
+		return "deliver_sm"
+	case DeliverSMResp:
+		return "deliver_sm_resp"
+	case Unbind:
+		return "unbind"
+	case UnbindResp:
+		return "unbind_resp"
+	case BindTransceiver:
+		return "bind_transceiver"
+	case BindTransceiverResp:
+		return "bind_transceiver_resp"
+	case EnquireLink:
+		return "enquire_link"
+	case EnquireLinkResp:
+		return "enquire_link_resp"
+	default:
+		return fmt.Sprintf("0x%08x", uint32(id))
+	}
+}
+
+// Status is a command_status; the values are the ESME_* error codes.
+type Status uint32
+
+const (
+	StatusOK             Status = 0x00000000 // ESME_ROK
+	StatusInvMsgLen      Status = 0x00000001 // ESME_RINVMSGLEN
+	StatusInvCmdLen      Status = 0x00000002 // ESME_RINVCMDLEN
+	StatusInvCmdID       Status = 0x00000003 // ESME_RINVCMDID
+	StatusInvBndSts      Status = 0x00000004 // ESME_RINVBNDSTS
+	StatusAlyBnd         Status = 0x00000005 // ESME_RALYBND
+	StatusSysErr         Status = 0x00000008 // ESME_RSYSERR
+	StatusInvDstAdr      Status = 0x0000000B // ESME_RINVDSTADR
+	StatusBindFail       Status = 0x0000000D // ESME_RBINDFAIL
+	StatusInvPaswd       Status = 0x0000000E // ESME_RINVPASWD
+	StatusInvSysID       Status = 0x0000000F // ESME_RINVSYSID
+	StatusMsgQFul        Status = 0x00000014 // ESME_RMSGQFUL
+	StatusInvEsmClass    Status = 0x00000043 // ESME_RINVESMCLASS
+	StatusSubmitFail     Status = 0x00000045 // ESME_RSUBMITFAIL
+	StatusThrottled      Status = 0x00000058 // ESME_RTHROTTLED
+	StatusPermAppError   Status = 0x00000064 // ESME_RX_P_APPN
+	StatusTempAppError   Status = 0x00000066 // ESME_RX_T_APPN
+	StatusRejectAppError Status = 0x00000065 // ESME_RX_R_APPN
+)
+
+func (s Status) Error() string {
+	return fmt.Sprintf("smpp status 0x%08x", uint32(s))
+}
+
+// HeaderLen is the length of the PDU header: command_length, command_id, command_status and
+// sequence_number.
+const HeaderLen = 16
+
+// MaxPDULen bounds the PDUs ReadPDU accepts.
+const MaxPDULen = 64 * 1024
+
+var ErrPDULen = errors.New("invalid command_length")
+
+// PDU is one SMPP PDU with its body undecoded.
+type PDU struct {
+	ID     CommandID
+	Status Status
+	Seq    uint32
+	Body   []byte
+}
+
+// ReadPDU reads one PDU from r.
+func ReadPDU(r io.Reader) (PDU, error) {
+	var hdr [HeaderLen]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return PDU{}, err
+	}
+	n := binary.BigEndian.Uint32(hdr[0:4])
+	if n < HeaderLen || n > MaxPDULen {
+		return PDU{}, ErrPDULen
+	}
+	p := PDU{
+		ID:     CommandID(binary.BigEndian.Uint32(hdr[4:8])),
+		Status: Status(binary.BigEndian.Uint32(hdr[8:12])),
+		Seq:    binary.BigEndian.Uint32(hdr[12:16]),
+		Body:   make([]byte, n-HeaderLen),
+	}
+	if _, err := io.ReadFull(r, p.Body); err != nil {
+		return PDU{}, err
+	}
+	return p, nil
+}
+
+// WritePDU writes p to w in one call.
+func WritePDU(w io.Writer, p PDU) error {
+	b := make([]byte, HeaderLen+len(p.Body))
+	binary.BigEndian.PutUint32(b[0:4], uint32(len(b)))
+	binary.BigEndian.PutUint32(b[4:8], uint32(p.ID))
+	binary.BigEndian.PutUint32(b[8:12], uint32(p.Status))
+	binary.BigEndian.PutUint32(b[12:16], p.Seq)
+	copy(b[HeaderLen:], p.Body)
+	_, err := w.Write(b)
+	return err
+}
@@ -0,0 +1,102 @@
+package smpp
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestPDURoundTrip(t *testing.T) {
+	in := PDU{ID: SubmitSMResp, Status: StatusThrottled, Seq: 7, Body: MessageIDBody("abc")}
+	var buf bytes.Buffer
+	if err := WritePDU(&buf, in); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if got := buf.Len(); got != HeaderLen+4 {
+		t.Fatalf("wrote %d bytes, want %d", got, HeaderLen+4)
+	}
+	out, err := ReadPDU(&buf)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if !reflect.DeepEqual(in, out) {
+		t.Fatalf("got %+v, want %+v", out, in)
+	}
+	if id, err := ParseMessageID(out.Body); err != nil || id != "abc" {
+		t.Fatalf("message id %q, %v", id, err)
+	}
+}
+
+func TestReadPDU_InvalidLength(t *testing.T) {
+	for _, n := range []byte{0, HeaderLen - 1} {
+		hdr := make([]byte, HeaderLen)
+		hdr[3] = n
+		if _, err := ReadPDU(bytes.NewReader(hdr)); err != ErrPDULen {
+			t.Fatalf("command_length %d: got %v, want ErrPDULen", n, err)
+		}
+	}
+}
+
+func TestBindRoundTrip(t *testing.T) {
+	in := Bind{SystemID: "shop", Password: "secret", SystemType: "", InterfaceVersion: 0x34, AddressRange: "98*"}
+	out, err := ParseBind(in.Bytes())
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if out != in {
+		t.Fatalf("got %+v, want %+v", out, in)
+	}
+	if _, err := ParseBind([]byte("shop\x00secret")); err != ErrShortBody {
+		t.Fatalf("truncated bind: got %v, want ErrShortBody", err)
+	}
+}
+
+func TestShortMessageRoundTrip(t *testing.T) {
+	in := ShortMessage{
+		SourceAddr:         "Shop",
+		DestinationAddr:    "+989121234567",
+		PriorityFlag:       2,
+		RegisteredDelivery: 1,
+		DataCoding:         CodingUCS2,
+		TLVs:               []TLV{{Tag: TagMessagePayload, Value: []byte{0x06, 0x33}}},
+	}
+	out, err := ParseShortMessage(in.Bytes())
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if out.SourceAddr != in.SourceAddr || out.DestinationAddr != in.DestinationAddr || out.PriorityFlag != 2 || out.RegisteredDelivery != 1 || out.DataCoding != CodingUCS2 {
+		t.Fatalf("got %+v, want %+v", out, in)
+	}
+	// short_message is empty, so the text is taken from message_payload.
+	if got := out.Text(); !bytes.Equal(got, []byte{0x06, 0x33}) {
+		t.Fatalf("text %x", got)
+	}
+}
+
+func TestDecodeText(t *testing.T) {
+	cases := []struct {
+		name    string
+		coding  byte
+		in      []byte
+		want    string
+		wantErr error
+	}{
+		{name: "gsm default", coding: CodingDefault, in: []byte("Hello @\x00\x02"), want: "Hello ¡@$"},
+		{name: "gsm extension", coding: CodingDefault, in: []byte{0x1B, 0x65, 0x31, 0x1B, 0x3C}, want: "€1["},
+		{name: "gsm trailing escape", coding: CodingDefault, in: []byte{0x41, 0x1B}, want: "A\x1b"},
+		{name: "gsm out of range", coding: CodingDefault, in: []byte{0x80}, wantErr: ErrInvalidText},
+		{name: "ia5", coding: CodingIA5, in: []byte("abc"), want: "abc"},
+		{name: "latin1", coding: CodingLatin1, in: []byte("caf\xe9"), want: "café"},
+		{name: "ucs2", coding: CodingUCS2, in: []byte{0x06, 0x33, 0x06, 0x44, 0x06, 0x27, 0x06, 0x45}, want: "سلام"},
+		{name: "ucs2 odd length", coding: CodingUCS2, in: []byte{0x06}, wantErr: ErrInvalidText},
+		{name: "binary", coding: 0x04, in: []byte{0x01}, wantErr: ErrUnsupportedCoding},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := DecodeText(tc.coding, tc.in)
+			if err != tc.wantErr || got != tc.want {
+				t.Fatalf("got %q, %v; want %q, %v", got, err, tc.want, tc.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+// Package webhook guards calls to customer-supplied URLs, so a webhook cannot be pointed at
+// the gateway's own network.
+package webhook
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+	"time"
+)
+
+var (
+	ErrInvalidURL = errors.New("webhook url must be an absolute http or https url")
+	// ErrForbiddenAddress is returned for hosts that are or resolve to loopback, private,
+	// link-local, multicast or unspecified addresses.
+	ErrForbiddenAddress = errors.New("webhook host is not a public address")
+)
+
+// CheckURL parses raw and resolves its host; every address it resolves to must be public.
+// The check is repeated when connecting (see NewClient), as DNS may answer differently then.
+func CheckURL(ctx context.Context, raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return ErrInvalidURL
+	}
+	ips, err := net.DefaultResolver.LookupIPAddr(ctx, u.Hostname())
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidURL, err)
+	}
+	for _, ip := range ips {
+		if !public(ip.IP) {
+			return fmt.Errorf("%w: %s", ErrForbiddenAddress, ip.IP)
+		}
+	}
+	return nil
+}
+
+// NewClient returns a client for customer webhooks: it connects only to public addresses,
+// goes through no proxy, does not follow redirects and gives up after timeout.
+func NewClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		Control: func(_, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !public(ip) {
+				return fmt.Errorf("%w: %s", ErrForbiddenAddress, host)
+			}
+			return nil
+		},
+	}
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: timeout,
+			MaxIdleConnsPerHost: 2,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+func public(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified())
+}
@@ -52,6 +52,7 @@ func SetupAppTest(t *testing.T) (context.Context, func()) {
 	_ = os.Setenv("RABBIT_SMS_EXCHANGE", "sms_exchange")
 	_ = os.Setenv("EXPRESS_QUEUE", "sms_express")
 	_ = os.Setenv("NORMAL_QUEUE", "sms_normal")
+	_ = os.Setenv("OTP_SECRET", "test-otp-secret")
 
 	mysqlC, host, port := MySQL(ctx, t)
 
@@ -148,4 +149,48 @@ func ResetTables(ctx context.Context, t *testing.T) {
 	if _, err := app.DB.ExecContext(ctx, "DELETE FROM outbox_events"); err != nil {
 		t.Fatalf("truncate outbox_events: %v", err)
 	}
+	if _, err := app.DB.ExecContext(ctx, "DELETE FROM content_rules"); err != nil {
+		t.Fatalf("truncate content_rules: %v", err)
+	}
+	if _, err := app.DB.ExecContext(ctx, "DELETE FROM held_messages"); err != nil {
+		t.Fatalf("truncate held_messages: %v", err)
+	}
+	if _, err := app.DB.ExecContext(ctx, "DELETE FROM otp_codes"); err != nil {
+		t.Fatalf("truncate otp_codes: %v", err)
+	}
+	if _, err := app.DB.ExecContext(ctx, "DELETE FROM priority_limits"); err != nil {
+		t.Fatalf("truncate priority_limits: %v", err)
+	}
+	if _, err := app.DB.ExecContext(ctx, "DELETE FROM send_limits"); err != nil {
+		t.Fatalf("truncate send_limits: %v", err)
+	}
+	if _, err := app.DB.ExecContext(ctx, "DELETE FROM prices"); err != nil {
+		t.Fatalf("truncate prices: %v", err)
+	}
+	if _, err := app.DB.ExecContext(ctx, "DELETE FROM balance_holds"); err != nil {
+		t.Fatalf("truncate balance_holds: %v", err)
+	}
+	if _, err := app.DB.ExecContext(ctx, "DELETE FROM refunds"); err != nil {
+		t.Fatalf("truncate refunds: %v", err)
+	}
+	if _, err := app.DB.ExecContext(ctx, "DELETE FROM account_limit_audit"); err != nil {
+		t.Fatalf("truncate account_limit_audit: %v", err)
+	}
+	if _, err := app.DB.ExecContext(ctx, "DELETE FROM low_balance_alerts"); err != nil {
+		t.Fatalf("truncate low_balance_alerts: %v", err)
+	}
+	if _, err := app.DB.ExecContext(ctx, "DELETE FROM reconciliation_runs"); err != nil {
+		t.Fatalf("truncate reconciliation_runs: %v", err)
+	}
+	if _, err := app.DB.ExecContext(ctx, "DELETE FROM reconciliation_drifts"); err != nil {
+		t.Fatalf("truncate reconciliation_drifts: %v", err)
+	}
+	if _, err := app.DB.ExecContext(ctx, "DELETE FROM sub_accounts"); err != nil {
+		t.Fatalf("truncate sub_accounts: %v", err)
+	}
+	for _, table := range []string{"ledger_entries", "ledger_journals", "ledger_accounts", "usage_deltas", "usage_daily", "invoice_lines", "invoices", "invoice_sequences", "balance_shards", "api_keys", "customers", "admin_keys", "admin_audit_log", "idempotency_keys", "sms_status_events", "kannel_messages", "kannel_dlr_cursor", "smpp_accounts", "smpp_messages", "smpp_receipt_cursor", "smpp_receipts"} {
+		if _, err := app.DB.ExecContext(ctx, "DELETE FROM "+table); err != nil {
+			t.Fatalf("truncate %s: %v", table, err)
+		}
+	}
 }